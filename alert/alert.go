@@ -0,0 +1,517 @@
+// Package alert evaluates speedtest results against alert rules and emits
+// notifications when a rule changes state.
+package alert
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"speedplane/model"
+)
+
+// Rule states.
+const (
+	StateOK       = "ok"
+	StateDegraded = "degraded"
+)
+
+// Event kinds.
+const (
+	EventDegraded  = "degraded"  // ok -> degraded
+	EventRecovered = "recovered" // degraded -> ok
+	EventReminder  = "reminder"  // still degraded after RenotifyEvery
+)
+
+// Metrics that rules can watch.
+var metrics = map[string]func(model.SpeedtestResult) float64{
+	"download_mbps":   func(r model.SpeedtestResult) float64 { return r.DownloadMbps },
+	"upload_mbps":     func(r model.SpeedtestResult) float64 { return r.UploadMbps },
+	"ping_ms":         func(r model.SpeedtestResult) float64 { return r.PingMs },
+	"jitter_ms":       func(r model.SpeedtestResult) float64 { return r.JitterMs },
+	"packet_loss_pct": func(r model.SpeedtestResult) float64 { return r.PacketLossPct },
+}
+
+// Event describes a rule changing state, or a reminder that it is still degraded.
+type Event struct {
+	Kind      string                 `json:"kind"`
+	RuleID    string                 `json:"rule_id"`
+	RuleName  string                 `json:"rule_name"`
+	Metric    string                 `json:"metric"`
+	Operator  string                 `json:"operator"`
+	Threshold float64                `json:"threshold"`
+	Severity  string                 `json:"severity"` // Of the rule, one of model.AlertSeverities
+	Value     float64                `json:"value"`
+	Since     time.Time              `json:"since"`              // When the incident started
+	Schedule  string                 `json:"schedule,omitempty"` // ID of the schedule whose alert overrides raised the event
+	Time      time.Time              `json:"time"`
+	Result    *model.SpeedtestResult `json:"result,omitempty"`
+	Snoozed   bool                   `json:"snoozed,omitempty"` // Recorded but not sent, see Engine.Snooze
+}
+
+// Summary returns a one-line human-readable description of the event.
+func (e Event) Summary() string {
+	switch e.Kind {
+	case EventRecovered:
+		return fmt.Sprintf("[recovered] %s: %s is %.2f after %s", e.RuleName, e.Metric, e.Value, e.Time.Sub(e.Since).Round(time.Second))
+	case EventReminder:
+		return fmt.Sprintf("[still degraded] %s: %s is %.2f (%s %.2f) for %s", e.RuleName, e.Metric, e.Value, e.Operator, e.Threshold, e.Time.Sub(e.Since).Round(time.Second))
+	default:
+		return fmt.Sprintf("[degraded] %s: %s is %.2f (%s %.2f)", e.RuleName, e.Metric, e.Value, e.Operator, e.Threshold)
+	}
+}
+
+// Notifier delivers alert events.
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// NotifierFunc adapts a function to the Notifier interface.
+type NotifierFunc func(ctx context.Context, e Event) error
+
+// Notify calls f(ctx, e).
+func (f NotifierFunc) Notify(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// ValidateRule checks that a rule's metric, operator, recovery threshold and
+// re-notify interval are usable.
+func ValidateRule(rule model.AlertRule) error {
+	if _, ok := metrics[rule.Metric]; !ok {
+		return fmt.Errorf("rule %q: unknown metric %q", rule.Name, rule.Metric)
+	}
+	if rule.Operator != "<" && rule.Operator != ">" {
+		return fmt.Errorf("rule %q: operator must be \"<\" or \">\"", rule.Name)
+	}
+	if rule.Recover != nil {
+		if rule.Operator == "<" && *rule.Recover < rule.Threshold {
+			return fmt.Errorf("rule %q: recover must be at least the threshold for \"<\" rules", rule.Name)
+		}
+		if rule.Operator == ">" && *rule.Recover > rule.Threshold {
+			return fmt.Errorf("rule %q: recover must be at most the threshold for \">\" rules", rule.Name)
+		}
+	}
+	if rule.For < 0 || rule.RecoverFor < 0 {
+		return fmt.Errorf("rule %q: for and recover_for must not be negative", rule.Name)
+	}
+	if rule.Severity != "" && !slices.Contains(model.AlertSeverities, rule.Severity) {
+		return fmt.Errorf("rule %q: severity must be one of %s", rule.Name, strings.Join(model.AlertSeverities, ", "))
+	}
+	if rule.RenotifyEvery != "" {
+		d, err := time.ParseDuration(rule.RenotifyEvery)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("rule %q: invalid renotify_every %q", rule.Name, rule.RenotifyEvery)
+		}
+	}
+	return nil
+}
+
+// RuleState is the current state of one rule.
+type RuleState struct {
+	Rule         model.AlertRule `json:"rule"`
+	State        string          `json:"state"`
+	Since        time.Time       `json:"since,omitempty"` // When the current state began
+	LastValue    *float64        `json:"last_value,omitempty"`
+	LastNotified time.Time       `json:"last_notified,omitempty"`
+	Acknowledged time.Time       `json:"acknowledged,omitempty"`  // When the current incident was acknowledged, which stops its reminders
+	SnoozedUntil time.Time       `json:"snoozed_until,omitempty"` // Notifications are held back until then, see Engine.Snooze
+
+	streak      int       // Consecutive results pointing away from the current state
+	streakStart time.Time // Timestamp of the first result in the streak
+	sent        bool      // The current incident was notified, by its degraded event or a reminder
+}
+
+// Engine tracks rule states across results. Notifications fire only on
+// transitions, after For (or RecoverFor) consecutive results, and again every
+// RenotifyEvery while a rule stays degraded.
+type Engine struct {
+	mu        sync.Mutex
+	rules     []model.AlertRule
+	states    map[string]*RuleState
+	notifiers []Notifier
+	schedule  string      // Stamped on events of a schedule's engine, see Router
+	record    func(Event) // Keeps events for the alert history, see SetRecorder
+	sending   sync.WaitGroup
+}
+
+// NewEngine creates an Engine with the given rules and notifiers.
+func NewEngine(rules []model.AlertRule, notifiers ...Notifier) *Engine {
+	e := &Engine{
+		states:    make(map[string]*RuleState),
+		notifiers: notifiers,
+	}
+	e.SetRules(rules)
+	return e
+}
+
+// SetRules replaces the rule set. States of rules that still exist are kept.
+func (e *Engine) SetRules(rules []model.AlertRule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rules = append([]model.AlertRule(nil), rules...)
+	states := make(map[string]*RuleState, len(rules))
+	for _, rule := range rules {
+		if st, ok := e.states[rule.ID]; ok {
+			st.Rule = rule
+			states[rule.ID] = st
+			continue
+		}
+		states[rule.ID] = &RuleState{Rule: rule, State: StateOK}
+	}
+	e.states = states
+}
+
+// Rules returns a copy of the rule set.
+func (e *Engine) Rules() []model.AlertRule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]model.AlertRule(nil), e.rules...)
+}
+
+// SetRecorder sets a function that receives every event before it is sent,
+// e.g. to keep an alert history. Schedule engines created by a Router share
+// the global engine's.
+func (e *Engine) SetRecorder(fn func(Event)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.record = fn
+}
+
+// Acknowledge marks the incident of a degraded rule that started at since as
+// seen, so no more reminders are sent for it. It reports false if the rule
+// isn't in that incident any more.
+func (e *Engine) Acknowledge(ruleID string, since time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	st, ok := e.states[ruleID]
+	// Compared to the second, as the alert history stores it
+	if !ok || st.State != StateDegraded || st.Since.Unix() != since.Unix() {
+		return false
+	}
+	st.Acknowledged = time.Now()
+	return true
+}
+
+// AcknowledgeActive acknowledges the current incident of a degraded rule, as
+// Acknowledge does, and returns when it started. It reports false if the
+// rule doesn't exist or isn't degraded.
+func (e *Engine) AcknowledgeActive(ruleID string) (time.Time, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	st, ok := e.states[ruleID]
+	if !ok || st.State != StateDegraded {
+		return time.Time{}, false
+	}
+	if st.Acknowledged.IsZero() {
+		st.Acknowledged = time.Now()
+	}
+	return st.Since, true
+}
+
+// Snooze holds back the notifications of a rule until the given time: its
+// events are still evaluated and recorded, see SetRecorder, but not sent,
+// and no reminders are due meanwhile. The recovery of an incident that was
+// notified before is sent all the same, so channels that opened an incident
+// for it, such as PagerDuty, resolve it. Unlike an acknowledgement a snooze
+// outlasts the current incident. A zero until lifts it. It reports false if
+// the rule doesn't exist.
+func (e *Engine) Snooze(ruleID string, until time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	st, ok := e.states[ruleID]
+	if !ok {
+		return false
+	}
+	st.SnoozedUntil = until
+	return true
+}
+
+// Restore brings back the rule states kept across a restart: latest holds
+// the latest recorded event of each rule, see SetRecorder, and snoozes the
+// rules' snoozes. A rule whose latest event left it degraded is degraded
+// again, with the incident's start, acknowledgement and last notification,
+// so reminders and its recovery are still sent. Events and snoozes of
+// other engines' schedules and of unknown rules are skipped. Call it before
+// the first result is observed.
+func (e *Engine) Restore(latest []model.AlertRecord, snoozes []model.AlertSnooze) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, rec := range latest {
+		st, ok := e.states[rec.RuleID]
+		if !ok || rec.Schedule != e.schedule {
+			continue
+		}
+		value := rec.Value
+		st.LastValue = &value
+		if rec.Kind == EventRecovered {
+			st.State = StateOK
+			st.Since = rec.Time
+			continue
+		}
+		st.State = StateDegraded
+		st.Since = rec.Since
+		st.LastNotified = rec.Time
+		// Reminders aren't raised while snoozed, so only a degraded event
+		// can be latest and snoozed
+		st.sent = !rec.Snoozed
+		if rec.AcknowledgedAt != nil {
+			st.Acknowledged = *rec.AcknowledgedAt
+		}
+	}
+	for _, sn := range snoozes {
+		if st, ok := e.states[sn.RuleID]; ok && sn.Schedule == e.schedule {
+			st.SnoozedUntil = sn.Until
+		}
+	}
+}
+
+// State returns the current state of a rule.
+func (e *Engine) State(ruleID string) (RuleState, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	st, ok := e.states[ruleID]
+	if !ok {
+		return RuleState{}, false
+	}
+	return *st, true
+}
+
+// States returns a snapshot of all rule states in rule order.
+func (e *Engine) States() []RuleState {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	out := make([]RuleState, 0, len(e.rules))
+	for _, rule := range e.rules {
+		out = append(out, *e.states[rule.ID])
+	}
+	return out
+}
+
+// Observe evaluates a new result against every enabled rule and sends
+// notifications for the resulting events, which are also returned.
+func (e *Engine) Observe(result *model.SpeedtestResult) []Event {
+	if result == nil {
+		return nil
+	}
+
+	e.mu.Lock()
+	now := time.Now()
+	var events []Event
+	for _, rule := range e.rules {
+		if !rule.Enabled {
+			continue
+		}
+		value, ok := metricValue(rule.Metric, *result)
+		if !ok {
+			continue
+		}
+		st := e.states[rule.ID]
+		sent := st.sent
+		if ev, fire := st.observe(value, result); fire {
+			ev.Schedule = e.schedule
+			ev.Snoozed = now.Before(st.SnoozedUntil) && !(ev.Kind == EventRecovered && sent)
+			st.sent = ev.Kind == EventDegraded && !ev.Snoozed
+			events = append(events, ev)
+		}
+	}
+	e.mu.Unlock()
+
+	e.dispatch(events)
+	return events
+}
+
+// Start sends reminders for degraded rules whose RenotifyEvery has elapsed,
+// checking every minute until ctx is cancelled.
+func (e *Engine) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				e.dispatch(e.reminders(now))
+			}
+		}
+	}()
+}
+
+// Notify sends an event raised outside the rules, e.g. the disk filling up,
+// to the engine's notifiers.
+func (e *Engine) Notify(ev Event) {
+	e.dispatch([]Event{ev})
+}
+
+// Wait waits until the notifications sent so far have been delivered or
+// have failed, or ctx is done.
+func (e *Engine) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		e.sending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("alert: notifications still being sent: %w", ctx.Err())
+	}
+}
+
+func (e *Engine) reminders(now time.Time) []Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var events []Event
+	for _, rule := range e.rules {
+		st := e.states[rule.ID]
+		if !rule.Enabled || st.State != StateDegraded || rule.RenotifyEvery == "" || !st.Acknowledged.IsZero() || now.Before(st.SnoozedUntil) {
+			continue
+		}
+		every, err := time.ParseDuration(rule.RenotifyEvery)
+		if err != nil || every <= 0 || now.Sub(st.LastNotified) < every {
+			continue
+		}
+		st.LastNotified = now
+		st.sent = true
+		ev := st.event(EventReminder, now, nil)
+		ev.Schedule = e.schedule
+		events = append(events, ev)
+	}
+	return events
+}
+
+func (e *Engine) dispatch(events []Event) {
+	e.mu.Lock()
+	notifiers := e.notifiers
+	record := e.record
+	e.mu.Unlock()
+
+	for _, ev := range events {
+		if ev.Snoozed {
+			log.Printf("[alert] (snoozed) %s", ev.Summary())
+		} else {
+			log.Printf("[alert] %s", ev.Summary())
+		}
+		if record != nil {
+			record(ev)
+		}
+		if ev.Snoozed {
+			continue
+		}
+		for _, n := range notifiers {
+			e.sending.Add(1)
+			go func(n Notifier, ev Event) {
+				defer e.sending.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				if err := n.Notify(ctx, ev); err != nil {
+					log.Printf("[alert] notify %s: %v", ev.RuleName, err)
+				}
+			}(n, ev)
+		}
+	}
+}
+
+// observe updates the state with a new value and reports whether it
+// transitioned, returning the event to send.
+func (st *RuleState) observe(value float64, result *model.SpeedtestResult) (Event, bool) {
+	rule := st.Rule
+	st.LastValue = &value
+	now := result.Timestamp
+
+	if st.State == StateOK {
+		if !breaches(rule, value) {
+			st.streak = 0
+			return Event{}, false
+		}
+		st.streak++
+		if st.streak == 1 {
+			st.streakStart = now
+		}
+		if st.streak < max(rule.For, 1) {
+			return Event{}, false
+		}
+		st.State = StateDegraded
+		st.Since = st.streakStart
+		st.Acknowledged = time.Time{}
+		st.streak = 0
+		st.LastNotified = time.Now()
+		return st.event(EventDegraded, now, result), true
+	}
+
+	if !recovered(rule, value) {
+		st.streak = 0
+		return Event{}, false
+	}
+	st.streak++
+	if st.streak < max(rule.RecoverFor, 1) {
+		return Event{}, false
+	}
+	ev := st.event(EventRecovered, now, result)
+	st.State = StateOK
+	st.Since = now
+	st.Acknowledged = time.Time{}
+	st.streak = 0
+	st.LastNotified = time.Now()
+	return ev, true
+}
+
+func (st *RuleState) event(kind string, now time.Time, result *model.SpeedtestResult) Event {
+	ev := Event{
+		Kind:      kind,
+		RuleID:    st.Rule.ID,
+		RuleName:  st.Rule.Name,
+		Metric:    st.Rule.Metric,
+		Operator:  st.Rule.Operator,
+		Threshold: st.Rule.Threshold,
+		Severity:  st.Rule.Severity,
+		Since:     st.Since,
+		Time:      now,
+		Result:    result,
+	}
+	if ev.Severity == "" {
+		ev.Severity = model.DefaultAlertSeverity
+	}
+	if st.LastValue != nil {
+		ev.Value = *st.LastValue
+	}
+	return ev
+}
+
+func metricValue(metric string, r model.SpeedtestResult) (float64, bool) {
+	fn, ok := metrics[metric]
+	if !ok {
+		return 0, false
+	}
+	return fn(r), true
+}
+
+// breaches reports whether value crosses the rule's threshold.
+func breaches(rule model.AlertRule, value float64) bool {
+	if rule.Operator == ">" {
+		return value > rule.Threshold
+	}
+	return value < rule.Threshold
+}
+
+// recovered reports whether value is back past the recovery threshold, which
+// may sit further from the threshold than the breach point (hysteresis).
+func recovered(rule model.AlertRule, value float64) bool {
+	limit := rule.Threshold
+	if rule.Recover != nil {
+		limit = *rule.Recover
+	}
+	if rule.Operator == ">" {
+		return value <= limit
+	}
+	return value >= limit
+}
@@ -0,0 +1,200 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"speedplane/model"
+)
+
+// Router evaluates each result with the engine of the schedule that produced
+// it. Schedules without alert overrides share the global engine; each
+// schedule with overrides gets its own, with the global rules and notifiers
+// layered under its own, and keeps its own rule states.
+type Router struct {
+	global *Engine
+	named  map[string]Notifier
+
+	mu      sync.Mutex
+	ctx     context.Context
+	engines map[string]*Engine  // By schedule ID
+	latest  []model.AlertRecord // Restored into schedule engines as they are created, see Restore
+	snoozes []model.AlertSnooze
+}
+
+// NewRouter creates a Router over the global engine. named holds the
+// notifiers schedules can select by name.
+func NewRouter(global *Engine, named map[string]Notifier) *Router {
+	return &Router{
+		global:  global,
+		named:   named,
+		engines: make(map[string]*Engine),
+	}
+}
+
+// Validate checks a schedule's alert overrides: its rules must be valid and
+// its webhooks must exist.
+func (r *Router) Validate(a *model.ScheduleAlerts) error {
+	if a == nil {
+		return nil
+	}
+	for _, name := range a.Webhooks {
+		if _, ok := r.named[name]; !ok {
+			return fmt.Errorf("unknown webhook %q", name)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, rule := range a.Rules {
+		if rule.ID == "" {
+			return fmt.Errorf("rule %q: missing id", rule.Name)
+		}
+		if seen[rule.ID] {
+			return fmt.Errorf("rule %q: duplicate id %q", rule.Name, rule.ID)
+		}
+		seen[rule.ID] = true
+		if err := ValidateRule(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start sends reminders for the global engine and for schedule engines,
+// including ones created later, until ctx is cancelled.
+func (r *Router) Start(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ctx = ctx
+	r.global.Start(ctx)
+	for _, e := range r.engines {
+		e.Start(ctx)
+	}
+}
+
+// Restore brings back the rule states of the global engine and of schedule
+// engines, including ones created later, see Engine.Restore.
+func (r *Router) Restore(latest []model.AlertRecord, snoozes []model.AlertSnooze) {
+	r.global.Restore(latest, snoozes)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latest, r.snoozes = latest, snoozes
+	for _, e := range r.engines {
+		e.Restore(latest, snoozes)
+	}
+}
+
+// Wait waits for the notifications of the global engine and of schedule
+// engines, see Engine.Wait.
+func (r *Router) Wait(ctx context.Context) error {
+	r.mu.Lock()
+	engines := []*Engine{r.global}
+	for _, e := range r.engines {
+		engines = append(engines, e)
+	}
+	r.mu.Unlock()
+
+	for _, e := range engines {
+		if err := e.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Observe evaluates a result produced by sc, which is nil for runs outside
+// the schedules, and returns the events sent.
+func (r *Router) Observe(sc *model.Schedule, result *model.SpeedtestResult) []Event {
+	if sc == nil || sc.Alerts == nil {
+		return r.global.Observe(result)
+	}
+	if sc.Alerts.Silent {
+		return nil
+	}
+	return r.engine(sc.ID, *sc.Alerts).Observe(result)
+}
+
+// engine returns the engine for a schedule, brought up to date with its
+// overrides, which may have been edited since its last result.
+func (r *Router) engine(id string, a model.ScheduleAlerts) *Engine {
+	r.global.mu.Lock()
+	rules := layerRules(r.global.rules, a.Rules)
+	notifiers := r.global.notifiers
+	record := r.global.record
+	r.global.mu.Unlock()
+
+	if len(a.Webhooks) > 0 {
+		notifiers = nil
+		for _, name := range a.Webhooks {
+			if n, ok := r.named[name]; ok {
+				notifiers = append(notifiers, n)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.engines[id]
+	if !ok {
+		e = NewEngine(rules, notifiers...)
+		e.schedule = id
+		e.record = record
+		e.Restore(r.latest, r.snoozes)
+		r.engines[id] = e
+		if r.ctx != nil {
+			e.Start(r.ctx)
+		}
+		return e
+	}
+	e.SetRules(rules)
+	e.mu.Lock()
+	e.notifiers = notifiers
+	e.record = record
+	e.mu.Unlock()
+	return e
+}
+
+// Engine returns the engine of the given schedule, the global engine when
+// schedule is empty, or nil if the schedule has no engine of its own yet.
+func (r *Router) Engine(schedule string) *Engine {
+	if schedule == "" {
+		return r.global
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.engines[schedule]
+}
+
+// Acknowledge acknowledges an incident of the engine of the given schedule,
+// or of the global engine when schedule is empty; see Engine.Acknowledge.
+func (r *Router) Acknowledge(schedule, ruleID string, since time.Time) bool {
+	e := r.Engine(schedule)
+	return e != nil && e.Acknowledge(ruleID, since)
+}
+
+// layerRules returns the global rules with those sharing an ID with an
+// override replaced by it, followed by the remaining overrides.
+func layerRules(global, overrides []model.AlertRule) []model.AlertRule {
+	byID := make(map[string]model.AlertRule, len(overrides))
+	for _, rule := range overrides {
+		byID[rule.ID] = rule
+	}
+	out := make([]model.AlertRule, 0, len(global)+len(overrides))
+	for _, rule := range global {
+		if o, ok := byID[rule.ID]; ok {
+			rule = o
+			delete(byID, rule.ID)
+		}
+		out = append(out, rule)
+	}
+	for _, rule := range overrides {
+		if _, ok := byID[rule.ID]; ok {
+			out = append(out, rule)
+		}
+	}
+	return out
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"speedplane/alert"
+	"speedplane/model"
+)
+
+// maxAlertRuleBody bounds a rule accepted by /api/alerts/rules.
+const maxAlertRuleBody = 64 << 10
+
+// SetAlertRulesSaver sets the function that persists the global alert rules
+// after they are edited through /api/alerts/rules. Without it edits only
+// last until the server restarts.
+func (s *Server) SetAlertRulesSaver(fn func([]model.AlertRule) error) {
+	s.saveAlertRules = fn
+}
+
+// handleAlertRules lists the global alert rules or adds one.
+func (s *Server) handleAlertRules(w http.ResponseWriter, r *http.Request) {
+	if s.alerts == nil {
+		http.Error(w, "alerts not enabled", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rules := s.alerts.Rules()
+		if rules == nil {
+			rules = []model.AlertRule{}
+		}
+		writeJSON(w, http.StatusOK, rules)
+
+	case http.MethodPost:
+		rule, ok := decodeAlertRule(w, r)
+		if !ok {
+			return
+		}
+		if rule.ID == "" {
+			rule.ID = model.NewID()
+		}
+
+		s.alertRulesMu.Lock()
+		defer s.alertRulesMu.Unlock()
+		rules := s.alerts.Rules()
+		for _, cur := range rules {
+			if cur.ID == rule.ID {
+				http.Error(w, "rule id already exists", http.StatusConflict)
+				return
+			}
+		}
+		if !s.setAlertRules(w, append(rules, rule)) {
+			return
+		}
+		writeJSON(w, http.StatusCreated, rule)
+
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAlertRuleByID gets, replaces or deletes one global alert rule.
+// Replacing a rule keeps its state, so editing the threshold of a degraded
+// rule doesn't raise the alert again.
+func (s *Server) handleAlertRuleByID(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/alerts/rules/")
+	if id == "" || s.alerts == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		for _, rule := range s.alerts.Rules() {
+			if rule.ID == id {
+				writeJSON(w, http.StatusOK, rule)
+				return
+			}
+		}
+		http.NotFound(w, r)
+
+	case http.MethodPut:
+		upd, ok := decodeAlertRule(w, r)
+		if !ok {
+			return
+		}
+		upd.ID = id
+
+		s.alertRulesMu.Lock()
+		defer s.alertRulesMu.Unlock()
+		rules := s.alerts.Rules()
+		i := alertRuleIndex(rules, id)
+		if i < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		rules[i] = upd
+		if !s.setAlertRules(w, rules) {
+			return
+		}
+		writeJSON(w, http.StatusOK, upd)
+
+	case http.MethodDelete:
+		s.alertRulesMu.Lock()
+		defer s.alertRulesMu.Unlock()
+		rules := s.alerts.Rules()
+		i := alertRuleIndex(rules, id)
+		if i < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if !s.setAlertRules(w, append(rules[:i], rules[i+1:]...)) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut+", "+http.MethodDelete)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeAlertRule reads and validates a rule from the request body, writing
+// the error response if it is invalid.
+func decodeAlertRule(w http.ResponseWriter, r *http.Request) (model.AlertRule, bool) {
+	var rule model.AlertRule
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAlertRuleBody)).Decode(&rule); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return rule, false
+	}
+	if rule.Name == "" {
+		http.Error(w, "missing name", http.StatusBadRequest)
+		return rule, false
+	}
+	if err := alert.ValidateRule(rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return rule, false
+	}
+	return rule, true
+}
+
+func alertRuleIndex(rules []model.AlertRule, id string) int {
+	for i, rule := range rules {
+		if rule.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// setAlertRules saves and applies the global rule set, writing the error
+// response if saving fails. The caller holds alertRulesMu.
+func (s *Server) setAlertRules(w http.ResponseWriter, rules []model.AlertRule) bool {
+	if s.saveAlertRules != nil {
+		if err := s.saveAlertRules(rules); err != nil {
+			http.Error(w, "failed to save rules", http.StatusInternalServerError)
+			log.Printf("alert rules: %v", err)
+			return false
+		}
+	}
+	s.alerts.SetRules(rules)
+	return true
+}
+
+// handleAlertHistory lists the alert events within from and to (RFC 3339,
+// default the last 30 days), newest first, up to limit (default 100).
+func (s *Server) handleAlertHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	to := time.Now()
+	from := to.Add(-30 * 24 * time.Hour)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	events, err := s.store.ListAlerts(r.Context(), from, to, limit)
+	if err != nil {
+		http.Error(w, "failed to load alert history", http.StatusInternalServerError)
+		log.Printf("alert history: %v", err)
+		return
+	}
+	if events == nil {
+		events = []model.AlertRecord{}
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+// handleAlertHistoryAck acknowledges the incident of an alert event on POST
+// /api/alerts/history/{id}/ack: its events are marked acknowledged and, if
+// the rule is still degraded, no more reminders are sent for it.
+func (s *Server) handleAlertHistoryAck(w http.ResponseWriter, r *http.Request) {
+	idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/alerts/history/"), "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || action != "ack" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	rec, err := s.store.AcknowledgeAlert(r.Context(), id, time.Now())
+	if err != nil {
+		http.Error(w, "failed to acknowledge alert", http.StatusInternalServerError)
+		log.Printf("alert ack: %v", err)
+		return
+	}
+	if rec == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if s.alertRouter != nil && rec.Kind != alert.EventRecovered {
+		s.alertRouter.Acknowledge(rec.Schedule, rec.RuleID, rec.Since)
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
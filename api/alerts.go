@@ -0,0 +1,217 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"speedplane/alert"
+	"speedplane/model"
+	"speedplane/notify"
+)
+
+// SetAlertEngine sets the engine whose rule states are served by /api/alerts.
+func (s *Server) SetAlertEngine(e *alert.Engine) {
+	s.alerts = e
+}
+
+// SetAlertRouter sets the router used to validate the alert overrides of
+// schedules created or updated through the API.
+func (s *Server) SetAlertRouter(r *alert.Router) {
+	s.alertRouter = r
+}
+
+// handleAlerts lists alert rules with their current state.
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	states := []alert.RuleState{}
+	if s.alerts != nil {
+		states = s.alerts.States()
+	}
+	writeJSON(w, http.StatusOK, states)
+}
+
+// maxSnooze caps how long an alert may be snoozed, as maxMaintenance does
+// for maintenance windows.
+const maxSnooze = 7 * 24 * time.Hour
+
+type snoozeRequest struct {
+	Duration string `json:"duration"` // Go duration, e.g. "4h"
+}
+
+// handleAlertAction acknowledges or snoozes the alert of one rule:
+//
+//	POST   /api/alerts/{rule_id}/ack     acknowledges its current incident
+//	POST   /api/alerts/{rule_id}/snooze  holds back its notifications for a duration
+//	DELETE /api/alerts/{rule_id}/snooze  lifts the snooze
+//
+// The global rules are meant unless ?schedule= names a schedule with alert
+// overrides. Each responds with the rule's state.
+func (s *Server) handleAlertAction(w http.ResponseWriter, r *http.Request) {
+	ruleID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/alerts/"), "/")
+	if ruleID == "" || (action != "ack" && action != "snooze") || s.alertRouter == nil {
+		http.NotFound(w, r)
+		return
+	}
+	schedule := r.URL.Query().Get("schedule")
+	e := s.alertRouter.Engine(schedule)
+	if e == nil {
+		http.Error(w, "schedule has no alerts of its own", http.StatusNotFound)
+		return
+	}
+	if _, ok := e.State(ruleID); !ok {
+		http.Error(w, "unknown rule", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case action == "ack" && r.Method == http.MethodPost:
+		since, ok := e.AcknowledgeActive(ruleID)
+		if !ok {
+			http.Error(w, "rule is not degraded", http.StatusConflict)
+			return
+		}
+		if _, err := s.store.AcknowledgeIncident(r.Context(), schedule, ruleID, since, time.Now()); err != nil {
+			log.Printf("alert ack: %v", err)
+		}
+
+	case action == "snooze" && r.Method == http.MethodPost:
+		var req snoozeRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAlertRuleBody)).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 || d > maxSnooze {
+			http.Error(w, "duration must be a positive Go duration of at most 168h", http.StatusBadRequest)
+			return
+		}
+		until := time.Now().Add(d)
+		e.Snooze(ruleID, until)
+		if err := s.store.SetAlertSnooze(r.Context(), schedule, ruleID, until); err != nil {
+			log.Printf("alert snooze: %v", err)
+		}
+
+	case action == "snooze" && r.Method == http.MethodDelete:
+		e.Snooze(ruleID, time.Time{})
+		if err := s.store.SetAlertSnooze(r.Context(), schedule, ruleID, time.Time{}); err != nil {
+			log.Printf("alert snooze: %v", err)
+		}
+
+	default:
+		allow := http.MethodPost
+		if action == "snooze" {
+			allow += ", " + http.MethodDelete
+		}
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	st, _ := e.State(ruleID)
+	writeJSON(w, http.StatusOK, st)
+}
+
+// validateScheduleAlerts checks a schedule's alert overrides against the
+// configured rules and webhooks.
+func (s *Server) validateScheduleAlerts(a *model.ScheduleAlerts) error {
+	if s.alertRouter == nil || a == nil {
+		return nil
+	}
+	if err := s.alertRouter.Validate(a); err != nil {
+		return fmt.Errorf("invalid alerts: %v", err)
+	}
+	return nil
+}
+
+// NotifyChannel is a channel alerts are sent to, with the name schedules
+// select it by; unnamed channels notify every alert.
+type NotifyChannel struct {
+	Name    string
+	Channel notify.Channel
+}
+
+// SetNotifyChannels sets the alert channels /api/admin/webhooks/test can
+// fire: webhooks, then Teams, Matrix, PagerDuty and Opsgenie channels, in
+// the order configured.
+func (s *Server) SetNotifyChannels(channels []NotifyChannel) {
+	s.channels = channels
+}
+
+// webhookTest is the response of /api/admin/webhooks/test.
+type webhookTest struct {
+	Webhook     string `json:"webhook"`  // Name, or position among the channels for unnamed ones
+	Endpoint    string `json:"endpoint"` // Where the channel sends to
+	ContentType string `json:"content_type"`
+	Body        string `json:"body"`
+	Sent        bool   `json:"sent"`
+	Error       string `json:"error,omitempty"` // Why rendering or delivery failed
+}
+
+// handleAdminWebhookTest renders a sample event, degraded unless the kind
+// parameter asks for recovered or reminder, carrying the latest result, with the channel named by the webhook parameter, or at that
+// position (from 0) among all channels in the order of SetNotifyChannels,
+// and sends it unless dry_run is set. The response shows the rendered body and
+// whether it was delivered, so templates can be checked against the
+// receiving service.
+func (s *Server) handleAdminWebhookTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	name := q.Get("webhook")
+	var ch notify.Channel
+	for i, c := range s.channels {
+		if (c.Name != "" && c.Name == name) || strconv.Itoa(i) == name {
+			ch = c.Channel
+			break
+		}
+	}
+	if ch == nil {
+		http.Error(w, "unknown webhook", http.StatusNotFound)
+		return
+	}
+
+	latest, err := s.store.LatestResult(r.Context())
+	if err != nil {
+		log.Printf("webhook test: latest result: %v", err)
+	}
+	event := notify.SampleEvent(latest, time.Now().UTC())
+	switch kind := q.Get("kind"); kind {
+	case "":
+	case alert.EventDegraded, alert.EventRecovered, alert.EventReminder:
+		event.Kind = kind
+	default:
+		http.Error(w, "invalid kind, must be degraded, recovered or reminder", http.StatusBadRequest)
+		return
+	}
+
+	resp := webhookTest{Webhook: name, Endpoint: ch.Endpoint()}
+	body, contentType, err := ch.Render(event)
+	if err != nil {
+		resp.Error = err.Error()
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	resp.Body, resp.ContentType = string(body), contentType
+	if dryRun, _ := strconv.ParseBool(q.Get("dry_run")); !dryRun {
+		if err := ch.Notify(r.Context(), event); err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Sent = true
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
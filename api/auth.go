@@ -0,0 +1,64 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// ConfigureAdmin sets the bearer token required for admin endpoints and whether
+// /debug/pprof is exposed. An empty token leaves admin endpoints open, which is
+// only sensible when they are bound to a separate, private listener.
+// It must be called before RegisterAdmin.
+func (s *Server) ConfigureAdmin(token string, enablePprof bool) {
+	s.setAdminToken(token)
+	s.enablePprof = enablePprof
+}
+
+func (s *Server) setAdminToken(token string) {
+	s.adminMu.Lock()
+	defer s.adminMu.Unlock()
+	s.adminToken = token
+}
+
+// isAdmin reports whether r carries the admin token, or no token is set.
+func (s *Server) isAdmin(r *http.Request) bool {
+	s.adminMu.RLock()
+	defer s.adminMu.RUnlock()
+	return s.adminToken == "" || tokenMatches(bearerToken(r), s.adminToken)
+}
+
+// hasAdminToken reports whether admin endpoints require a token.
+func (s *Server) hasAdminToken() bool {
+	s.adminMu.RLock()
+	defer s.adminMu.RUnlock()
+	return s.adminToken != ""
+}
+
+// RequireAdmin wraps a handler so it is only reachable with the admin token.
+func (s *Server) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.isAdmin(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="speedplane"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer ..." header.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+func tokenMatches(got, want string) bool {
+	if got == "" || want == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"speedplane/model"
+)
+
+// Baseline window limits, in weeks.
+const (
+	defaultBaselineWeeks = 4
+	maxBaselineWeeks     = 52
+)
+
+// baselineCacheAge is how long clients may cache a baseline; it only moves
+// as new results arrive.
+const baselineCacheAge = 5 * time.Minute
+
+// baselineHour is the expected range of a metric for one hour of the day.
+type baselineHour struct {
+	Hour   int      `json:"hour"`  // 0-23 in the configured timezone
+	Count  int      `json:"count"` // Results the range is based on
+	Median *float64 `json:"median"`
+	MAD    *float64 `json:"mad"`   // Median absolute deviation from Median
+	Lower  *float64 `json:"lower"` // Median - MAD
+	Upper  *float64 `json:"upper"` // Median + MAD
+}
+
+type baselineResponse struct {
+	Metric   string         `json:"metric"`
+	Weeks    int            `json:"weeks"`
+	Timezone string         `json:"timezone"`
+	Hours    []baselineHour `json:"hours"` // Always 24 entries; values are null for hours without results
+}
+
+// metricValue returns the value of a chart metric for a result.
+func metricValue(r model.SpeedtestResult, metric string) float64 {
+	switch metric {
+	case "download":
+		return r.DownloadMbps
+	case "upload":
+		return r.UploadMbps
+	case "ping":
+		return r.PingMs
+	case "jitter":
+		return r.JitterMs
+	case "packet_loss":
+		return r.PacketLossPct
+	}
+	return math.NaN()
+}
+
+// handleBaseline returns the expected range of a metric for each hour of the
+// day, as the median ± MAD of successful results over the last few weeks, so
+// charts can overlay a "normal for this time" band. The median and MAD are
+// robust against the occasional outlier that would skew a mean ± stddev.
+func (s *Server) handleBaseline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+
+	metric := q.Get("metric")
+	switch metric {
+	case "download", "upload", "ping", "jitter", "packet_loss":
+	case "":
+		http.Error(w, "metric parameter required (download, upload, ping, jitter, packet_loss)", http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, "invalid metric, must be download, upload, ping, jitter, or packet_loss", http.StatusBadRequest)
+		return
+	}
+
+	weeks := defaultBaselineWeeks
+	if v := q.Get("weeks"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxBaselineWeeks {
+			http.Error(w, "invalid weeks, must be between 1 and 52", http.StatusBadRequest)
+			return
+		}
+		weeks = n
+	}
+
+	filter, err := resultFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	loc := s.location()
+	now := time.Now().In(loc)
+	results, err := s.store.ListResultsPage(r.Context(), now.AddDate(0, 0, -7*weeks), now, filter, 0, 0)
+	if err != nil {
+		http.Error(w, "failed to load results", http.StatusInternalServerError)
+		log.Printf("baseline: %v", err)
+		return
+	}
+
+	var byHour [24][]float64
+	for _, res := range results {
+		// Outages aren't part of what's normal
+		if resultFailed(res) {
+			continue
+		}
+		v := metricValue(res, metric)
+		if v < 0 || math.IsNaN(v) {
+			continue
+		}
+		h := res.Timestamp.In(loc).Hour()
+		byHour[h] = append(byHour[h], v)
+	}
+
+	resp := baselineResponse{
+		Metric:   metric,
+		Weeks:    weeks,
+		Timezone: loc.String(),
+		Hours:    make([]baselineHour, 24),
+	}
+	for h, values := range byHour {
+		bh := baselineHour{Hour: h, Count: len(values)}
+		if len(values) > 0 {
+			median := calculatePercentiles(values).Median
+			deviations := make([]float64, len(values))
+			for i, v := range values {
+				deviations[i] = math.Abs(v - median)
+			}
+			mad := calculatePercentiles(deviations).Median
+			lower, upper := median-mad, median+mad
+			bh.Median, bh.MAD, bh.Lower, bh.Upper = &median, &mad, &lower, &upper
+		}
+		resp.Hours[h] = bh
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "failed to encode baseline", http.StatusInternalServerError)
+		return
+	}
+	WriteCacheable(w, r, "application/json", baselineCacheAge, body)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"speedplane/benchmark"
+	"speedplane/model"
+)
+
+// benchmarkTimeout bounds how long the summary waits for the benchmark
+// service; the summary is served without a comparison when it's slow.
+const benchmarkTimeout = 5 * time.Second
+
+// benchmarkSummary compares the last 30 days' averages against results for
+// the same ISP and region.
+type benchmarkSummary struct {
+	ISP         string             `json:"isp"`
+	Country     string             `json:"country"`
+	Samples     int                `json:"samples"`
+	Percentiles map[string]float64 `json:"percentiles"` // By metric; higher is better, also for ping
+	Summary     string             `json:"summary"`
+}
+
+// SetBenchmark sets the benchmark service client whose percentiles are
+// added to /api/summary. nil leaves them out.
+func (s *Server) SetBenchmark(c *benchmark.Client) {
+	s.benchmark = c
+}
+
+// benchmarkFor compares avg, for the ISP and server country of latest, with
+// the benchmark service. It returns nil without a service, results or
+// percentiles to compare against.
+func (s *Server) benchmarkFor(ctx context.Context, latest *model.SpeedtestResult, avg aggregate) *benchmarkSummary {
+	if s.benchmark == nil || latest == nil || avg.Count == 0 || latest.ISP == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, benchmarkTimeout)
+	defer cancel()
+	dist, err := s.benchmark.Distribution(ctx, latest.ISP, latest.ServerCountry)
+	if err != nil {
+		log.Printf("summary: %v", err)
+		return nil
+	}
+
+	values := map[string]float64{
+		"download_mbps": avg.AvgDownloadMbps,
+		"upload_mbps":   avg.AvgUploadMbps,
+		"ping_ms":       avg.AvgPingMs,
+	}
+	out := &benchmarkSummary{
+		ISP:         latest.ISP,
+		Country:     latest.ServerCountry,
+		Samples:     dist.Samples,
+		Percentiles: make(map[string]float64, len(values)),
+	}
+	for metric, v := range values {
+		if rank, ok := dist.Rank(metric, v); ok {
+			out.Percentiles[metric] = math.Round(rank)
+		}
+	}
+	if len(out.Percentiles) == 0 {
+		return nil
+	}
+	if rank, ok := out.Percentiles["download_mbps"]; ok {
+		out.Summary = fmt.Sprintf("Your download speed is in the %s percentile for %s", ordinal(int(rank)), latest.ISP)
+		if latest.ServerCountry != "" {
+			out.Summary += " in " + latest.ServerCountry
+		}
+	}
+	return out
+}
+
+// ordinal formats n as 1st, 2nd, 3rd, 4th and so on.
+func ordinal(n int) string {
+	suffix := "th"
+	switch n % 10 {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+	if n%100 >= 11 && n%100 <= 13 {
+		suffix = "th"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
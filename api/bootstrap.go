@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"speedplane/model"
+	"speedplane/storage"
+)
+
+// Bootstrap is what the dashboard loads first: the latest result, the
+// summary of all connections, the schedules and the next scheduled run. The
+// index page embeds it so the dashboard renders without waiting for the API.
+type Bootstrap struct {
+	Latest    *model.SpeedtestResult `json:"latest,omitempty"` // Without its raw engine output
+	Summary   summaryResponse        `json:"summary"`
+	Schedules []model.Schedule       `json:"schedules"`
+	NextRun   map[string]interface{} `json:"next_run"`
+	ReadOnly  bool                   `json:"read_only,omitempty"` // Only the public endpoints are available, see Public
+}
+
+// Bootstrap collects the dashboard's initial data.
+func (s *Server) Bootstrap(ctx context.Context) (Bootstrap, error) {
+	latest, err := s.store.LatestResult(ctx)
+	if err != nil {
+		return Bootstrap{}, fmt.Errorf("latest result: %w", err)
+	}
+	if latest != nil {
+		latest.RawJSON = nil
+	}
+	summary, err := s.summary(ctx, storage.ResultFilter{})
+	if err != nil {
+		return Bootstrap{}, err
+	}
+	schedules := s.sched.Schedules()
+	if schedules == nil {
+		schedules = []model.Schedule{}
+	}
+	return Bootstrap{
+		Latest:    latest,
+		Summary:   summary,
+		Schedules: schedules,
+		NextRun:   s.nextRun(),
+	}, nil
+}
+
+// Public returns b for a read-only visitor of a public dashboard, without the
+// schedules and next run, which aren't public.
+func (b Bootstrap) Public() Bootstrap {
+	b.Schedules, b.NextRun = nil, nil
+	b.ReadOnly = true
+	return b
+}
+
+// handleBootstrap returns the dashboard's initial data in one request, for
+// clients that don't load it from the index page.
+func (s *Server) handleBootstrap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := s.Bootstrap(r.Context())
+	if err != nil {
+		http.Error(w, "failed to load dashboard data", http.StatusInternalServerError)
+		log.Printf("bootstrap: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/storage"
+)
+
+// bucketIntervals are the bucket widths accepted by /api/chart-data/buckets.
+var bucketIntervals = map[string]time.Duration{
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+	"1w": 7 * 24 * time.Hour,
+}
+
+type bucketsResponse struct {
+	Metric   string           `json:"metric"`
+	Interval string           `json:"interval"`
+	Agg      string           `json:"agg"`
+	Buckets  []storage.Bucket `json:"buckets"`
+}
+
+// handleChartBuckets returns one aggregated point per hour, day or week for a
+// metric, which is what charts want for ranges longer than a few days, with
+// the p10-p90 band around it for charts that shade the spread rather than
+// draw a noisy line. Buckets follow the configured timezone and omit
+// periods without results; daily and weekly ones reach back into archived
+// days through their rollups.
+func (s *Server) handleChartBuckets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+
+	metric := q.Get("metric")
+	switch metric {
+	case "download", "upload", "ping", "jitter", "packet_loss":
+	case "":
+		http.Error(w, "metric parameter required (download, upload, ping, jitter, packet_loss)", http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, "invalid metric, must be download, upload, ping, jitter, or packet_loss", http.StatusBadRequest)
+		return
+	}
+
+	interval := q.Get("interval")
+	if interval == "" {
+		interval = "1h"
+	}
+	width, ok := bucketIntervals[interval]
+	if !ok {
+		http.Error(w, "invalid interval, must be 1h, 1d, or 1w", http.StatusBadRequest)
+		return
+	}
+
+	agg := q.Get("agg")
+	switch agg {
+	case "":
+		agg = storage.AggAvg
+	case storage.AggAvg, storage.AggMedian, storage.AggP95:
+	default:
+		http.Error(w, "invalid agg, must be avg, median, or p95", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	from := now.AddDate(0, 0, -30)
+	to := now
+	switch q.Get("range") {
+	case "":
+	case "24h":
+		from = now.AddDate(0, 0, -1)
+	case "7d":
+		from = now.AddDate(0, 0, -7)
+	case "30d":
+		from = now.AddDate(0, 0, -30)
+	case "all":
+		from = time.Time{}
+	default:
+		http.Error(w, "invalid range, must be 24h, 7d, 30d, or all", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+
+	filter, err := resultFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	buckets, err := s.store.BucketResults(r.Context(), from, to, filter, storage.BucketQuery{
+		Metric:   metric,
+		Agg:      agg,
+		Interval: width,
+		Location: s.location(),
+	})
+	if err != nil {
+		http.Error(w, "failed to aggregate results", http.StatusInternalServerError)
+		log.Printf("chart buckets: %v", err)
+		return
+	}
+	if buckets == nil {
+		buckets = []storage.Bucket{}
+	}
+
+	writeJSON(w, http.StatusOK, bucketsResponse{
+		Metric:   metric,
+		Interval: interval,
+		Agg:      agg,
+		Buckets:  buckets,
+	})
+}
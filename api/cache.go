@@ -0,0 +1,177 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WriteCacheable writes body with a strong ETag and a public Cache-Control
+// max-age, answering 304 Not Modified when the client already has it.
+func WriteCacheable(w http.ResponseWriter, r *http.Request, contentType string, maxAge time.Duration, body []byte) {
+	writeETagged(w, r, hashETag(body), fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())), contentType, body)
+}
+
+// hashETag returns a strong ETag derived from data.
+func hashETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// writeETagged writes body with the given ETag and Cache-Control header, or
+// 304 Not Modified when the request's If-None-Match matches etag.
+func writeETagged(w http.ResponseWriter, r *http.Request, etag, cacheControl, contentType string, body []byte) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// responseCacheTTL bounds how long a cached response is served. Responses
+// cover windows ending now, so they drift even when no result is saved.
+const responseCacheTTL = time.Minute
+
+// Limits of the response cache. Past maxCachedResponses the cache is
+// cleared rather than evicting entries one at a time; larger bodies aren't
+// cached.
+const (
+	maxCachedResponses = 256
+	maxCachedBody      = 4 << 20
+)
+
+// responseCache keeps the responses of expensive read endpoints, such as the
+// 30-day aggregates of /api/summary, until a result is saved or deleted, so
+// a dashboard open on several devices doesn't recompute them on every
+// refresh.
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedResponse
+
+	hits, misses atomic.Uint64
+}
+
+type cachedResponse struct {
+	generation  uint64 // storage.Store.Generation when the response was computed
+	expires     time.Time
+	contentType string
+	body        []byte
+}
+
+func (c *responseCache) get(key string, generation uint64, now time.Time) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || e.generation != generation || now.After(e.expires) {
+		c.misses.Add(1)
+		return cachedResponse{}, false
+	}
+	c.hits.Add(1)
+	return e, true
+}
+
+func (c *responseCache) put(key string, e cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil || len(c.entries) >= maxCachedResponses {
+		c.entries = make(map[string]cachedResponse)
+	}
+	c.entries[key] = e
+}
+
+// clear drops all cached responses, e.g. when settings they depend on change.
+func (c *responseCache) clear() {
+	c.mu.Lock()
+	c.entries = nil
+	c.mu.Unlock()
+}
+
+// len returns the number of cached responses.
+func (c *responseCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// cached serves GET requests for next from the response cache, keyed by path
+// and query, and caches its successful responses. Responses must depend
+// only on the query, the stored results and failed runs, and the settings.
+func (s *Server) cached(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+		// Encode sorts parameters, so their order doesn't matter
+		key := r.URL.Path + "?" + r.URL.Query().Encode()
+		generation := s.store.Generation()
+		now := time.Now()
+		if e, ok := s.responses.get(key, generation, now); ok {
+			w.Header().Set("Content-Type", e.contentType)
+			w.Header().Set("X-Cache", "hit")
+			_, _ = w.Write(e.body)
+			return
+		}
+
+		w.Header().Set("X-Cache", "miss")
+		rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		if rec.status == http.StatusOK && !rec.tooLarge {
+			s.responses.put(key, cachedResponse{
+				generation:  generation,
+				expires:     now.Add(responseCacheTTL),
+				contentType: w.Header().Get("Content-Type"),
+				body:        rec.body.Bytes(),
+			})
+		}
+	}
+}
+
+// recordingWriter passes a response through while keeping a copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	tooLarge bool
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if !w.tooLarge {
+		if w.body.Len()+len(p) > maxCachedBody {
+			w.tooLarge = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(p)
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
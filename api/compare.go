@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"speedplane/model"
+)
+
+// Directions of a metric change in a comparison.
+const (
+	changeBetter = "better"
+	changeWorse  = "worse"
+	changeSame   = "same"
+)
+
+type metricDelta struct {
+	A         float64  `json:"a"`
+	B         float64  `json:"b"`
+	Delta     float64  `json:"delta"`                // B - A
+	PctChange *float64 `json:"pct_change,omitempty"` // Relative to A; omitted when A is 0
+	Change    string   `json:"change"`               // better, worse or same
+}
+
+type fieldDiff struct {
+	Field string `json:"field"`
+	A     string `json:"a"`
+	B     string `json:"b"`
+}
+
+type compareResponse struct {
+	A           *model.SpeedtestResult `json:"a"`
+	B           *model.SpeedtestResult `json:"b"`
+	Metrics     map[string]metricDelta `json:"metrics"`
+	Differences []fieldDiff            `json:"differences"` // Server, ISP, IP and link fields that differ
+}
+
+// handleCompareResults compares result b against result a, e.g. before and
+// after a router firmware update. The URL can be shared as a link.
+func (s *Server) handleCompareResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	idA, idB := q.Get("a"), q.Get("b")
+	if idA == "" || idB == "" {
+		http.Error(w, "a and b parameters required", http.StatusBadRequest)
+		return
+	}
+
+	var results [2]*model.SpeedtestResult
+	for i, id := range []string{idA, idB} {
+		res, err := s.store.GetResult(r.Context(), id)
+		if err != nil {
+			http.Error(w, "failed to load result", http.StatusInternalServerError)
+			log.Printf("compare results: get %s: %v", id, err)
+			return
+		}
+		if res == nil {
+			http.Error(w, fmt.Sprintf("result %s not found", id), http.StatusNotFound)
+			return
+		}
+		res.RawJSON = nil
+		results[i] = res
+	}
+	a, b := results[0], results[1]
+
+	writeJSON(w, http.StatusOK, compareResponse{
+		A: a,
+		B: b,
+		Metrics: map[string]metricDelta{
+			"download_mbps":   compareMetric(a.DownloadMbps, b.DownloadMbps, true),
+			"upload_mbps":     compareMetric(a.UploadMbps, b.UploadMbps, true),
+			"ping_ms":         compareMetric(a.PingMs, b.PingMs, false),
+			"jitter_ms":       compareMetric(a.JitterMs, b.JitterMs, false),
+			"packet_loss_pct": compareMetric(a.PacketLossPct, b.PacketLossPct, false),
+		},
+		Differences: diffResults(a, b),
+	})
+}
+
+// compareMetric describes the change from a to b for a metric where higher
+// values are better or, if higherIsBetter is false, worse.
+func compareMetric(a, b float64, higherIsBetter bool) metricDelta {
+	d := metricDelta{A: a, B: b, Delta: b - a, Change: changeSame}
+	if a != 0 {
+		pct := (b - a) / a * 100
+		d.PctChange = &pct
+	}
+	switch {
+	case b > a && higherIsBetter, b < a && !higherIsBetter:
+		d.Change = changeBetter
+	case b != a:
+		d.Change = changeWorse
+	}
+	return d
+}
+
+// diffResults lists the descriptive fields that differ between a and b.
+func diffResults(a, b *model.SpeedtestResult) []fieldDiff {
+	linkA, linkB := a.Link, b.Link
+	if linkA == nil {
+		linkA = &model.LinkInfo{}
+	}
+	if linkB == nil {
+		linkB = &model.LinkInfo{}
+	}
+
+	fields := []fieldDiff{
+		{"isp", a.ISP, b.ISP},
+		{"external_ip", a.ExternalIP, b.ExternalIP},
+		{"server_id", a.ServerID, b.ServerID},
+		{"server_name", a.ServerName, b.ServerName},
+		{"server_country", a.ServerCountry, b.ServerCountry},
+		{"engine", a.Engine, b.Engine},
+		{"link_interface", linkA.Interface, linkB.Interface},
+		{"link_type", string(linkA.Type), string(linkB.Type)},
+		{"link_ssid", linkA.SSID, linkB.SSID},
+	}
+
+	diffs := []fieldDiff{}
+	for _, f := range fields {
+		if f.A != f.B {
+			diffs = append(diffs, f)
+		}
+	}
+	return diffs
+}
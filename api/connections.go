@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"speedplane/model"
+)
+
+// SetConnections sets the named connections, such as "fiber" and
+// "lte-backup", that schedules, manual runs and triggers may select with
+// their connection field or parameter. The default connection is always
+// available and must not be listed.
+func (s *Server) SetConnections(names []string) error {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if err := model.ValidateConnection(name); err != nil {
+			return err
+		}
+		if name == model.DefaultConnection {
+			return fmt.Errorf("connection name %q is reserved", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("connection %q is configured twice", name)
+		}
+		seen[name] = true
+	}
+	s.connections = append([]string(nil), names...)
+	return nil
+}
+
+// connection resolves a connection selected by a request or schedule: empty
+// and "default" select the default connection, returned as "". ok is false
+// for connections that aren't configured.
+func (s *Server) connection(name string) (conn string, ok bool) {
+	if name == "" || name == model.DefaultConnection {
+		return "", true
+	}
+	return name, slices.Contains(s.connections, name)
+}
+
+// handleConnections lists the connections results can be filtered by with
+// the connection parameter, the default connection first.
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, append([]string{model.DefaultConnection}, s.connections...))
+}
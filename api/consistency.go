@@ -0,0 +1,118 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/model"
+	"speedplane/storage"
+)
+
+// consistencyDay is the consistency of one UTC day of results.
+type consistencyDay struct {
+	Day         time.Time          `json:"day"` // Midnight UTC
+	Count       int                `json:"count"`
+	Archived    bool               `json:"archived,omitempty"`    // Read from the day's rollup
+	Consistency *model.Consistency `json:"consistency,omitempty"` // Unset with too few results
+}
+
+// handleConsistency returns the consistency of each UTC day, the days rollups
+// are kept for, within from/to (RFC3339, default the last 30 days), oldest
+// first. Days still in the database are scored from their results and
+// narrowed by the usual filter parameters; archived days come from their
+// rollups, which cover every result of the day, so they are only included
+// without a filter.
+func (s *Server) handleConsistency(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	to := time.Now()
+	from := to.UTC().Truncate(24*time.Hour).AddDate(0, 0, -29)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	filter, err := resultFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results, err := s.store.ListResultsPage(r.Context(), from, to, filter, 0, 0)
+	if err != nil {
+		http.Error(w, "failed to load results", http.StatusInternalServerError)
+		log.Printf("consistency: %v", err)
+		return
+	}
+	days := consistencyDays(results)
+
+	if filter == (storage.ResultFilter{}) {
+		rollups, err := s.store.ListRollups(r.Context(), from.UTC().Truncate(24*time.Hour), to)
+		if err != nil {
+			http.Error(w, "failed to load rollups", http.StatusInternalServerError)
+			log.Printf("consistency: rollups: %v", err)
+			return
+		}
+		days = mergeRollupDays(days, rollups)
+	}
+	writeJSON(w, http.StatusOK, days)
+}
+
+// consistencyDays scores results, oldest first, per UTC day.
+func consistencyDays(results []model.SpeedtestResult) []consistencyDay {
+	days := []consistencyDay{}
+	for i := 0; i < len(results); {
+		d := results[i].Timestamp.UTC().Truncate(24 * time.Hour)
+		j := i
+		for j < len(results) && results[j].Timestamp.UTC().Truncate(24*time.Hour).Equal(d) {
+			j++
+		}
+		days = append(days, consistencyDay{
+			Day:         d,
+			Count:       j - i,
+			Consistency: model.ComputeConsistency(results[i:j]),
+		})
+		i = j
+	}
+	return days
+}
+
+// mergeRollupDays adds the days of rollups, oldest first, that aren't in
+// days. Days whose archive was imported back have both; their results are
+// what the rollup is recomputed from on the next archive run, so they win.
+func mergeRollupDays(days []consistencyDay, rollups []storage.Rollup) []consistencyDay {
+	out := make([]consistencyDay, 0, len(days)+len(rollups))
+	i := 0
+	for _, ru := range rollups {
+		for ; i < len(days) && days[i].Day.Before(ru.Day); i++ {
+			out = append(out, days[i])
+		}
+		if i < len(days) && days[i].Day.Equal(ru.Day) {
+			continue
+		}
+		out = append(out, consistencyDay{
+			Day:         ru.Day,
+			Count:       ru.Count,
+			Archived:    true,
+			Consistency: ru.Consistency,
+		})
+	}
+	return append(out, days[i:]...)
+}
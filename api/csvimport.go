@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"speedplane/ingest"
+	"speedplane/model"
+)
+
+// maxImportBody bounds a CSV import, which holds the whole file.
+const maxImportBody = 32 << 20
+
+// importPreviewRows is how many mapped rows a dry run returns.
+const importPreviewRows = 10
+
+// csvImportRequest is a CSV export to import with the mapping of its
+// columns to result fields.
+type csvImportRequest struct {
+	CSV        string                 `json:"csv"`
+	Delimiter  string                 `json:"delimiter,omitempty"` // One character or "tab"; default ","
+	Fields     map[string]importField `json:"fields,omitempty"`    // By result field, as an ingest source's
+	Connection string                 `json:"connection,omitempty"`
+	Tags       []string               `json:"tags,omitempty"`
+	DryRun     bool                   `json:"dry_run,omitempty"` // Map and preview the rows without storing them
+}
+
+type importField struct {
+	Path   string  `json:"path"` // Column name
+	Scale  float64 `json:"scale,omitempty"`
+	Unit   string  `json:"unit,omitempty"`
+	Format string  `json:"format,omitempty"`
+}
+
+type csvImportResponse struct {
+	Columns []string                `json:"columns"`
+	Rows    int                     `json:"rows"`
+	Preview []model.SpeedtestResult `json:"preview,omitempty"` // First rows as mapped, on a dry run
+	Error   string                  `json:"error,omitempty"`   // First row that doesn't map, on a dry run
+	Saved   int                     `json:"saved"`
+	IDs     []string                `json:"ids,omitempty"`
+}
+
+// handleImportCSV imports a CSV export from a router or another app,
+// mapping its columns to result fields with the same fields as an ingest
+// source, plus units and timestamp formats. A dry run returns the columns
+// and the first rows as they would be stored, which is what the
+// dashboard's import wizard builds the mapping from. Like /api/ingest,
+// nothing is stored unless every row maps, and rows already stored are
+// skipped, so importing the same file again is safe.
+func (s *Server) handleImportCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req csvImportRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportBody)).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	comma, ok := csvDelimiter(req.Delimiter)
+	if !ok {
+		http.Error(w, "delimiter must be one character", http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.connection(req.Connection); !ok {
+		http.Error(w, "unknown connection", http.StatusBadRequest)
+		return
+	}
+	for _, tag := range req.Tags {
+		if err := model.ValidateTag(tag); err != nil {
+			http.Error(w, "invalid tags: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	fields := make(map[string]ingest.Field, len(req.Fields))
+	for name, f := range req.Fields {
+		fields[name] = ingest.Field{Path: f.Path, Scale: f.Scale, Unit: f.Unit, Format: f.Format}
+	}
+	mapping, err := ingest.NewMapping(fields, s.location())
+	if err != nil {
+		http.Error(w, "invalid fields: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	columns, rows, err := ingest.SplitCSV(strings.NewReader(req.CSV), comma)
+	if err != nil {
+		http.Error(w, "invalid csv: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := csvImportResponse{Columns: columns, Rows: len(rows)}
+
+	if req.DryRun {
+		preview := rows[:min(len(rows), importPreviewRows)]
+		if resp.Preview, err = s.mapMeasurements(preview, mapping, req.Connection, req.Tags); err == nil {
+			// Rows past the preview are checked too, so an import that
+			// passed the dry run doesn't fail halfway through the file
+			_, err = s.mapMeasurements(rows, mapping, req.Connection, req.Tags)
+		}
+		if err != nil {
+			resp.Preview = nil
+			resp.Error = rowError(err)
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	if len(rows) == 0 {
+		http.Error(w, "no rows", http.StatusBadRequest)
+		return
+	}
+	results, err := s.mapMeasurements(rows, mapping, req.Connection, req.Tags)
+	if err != nil {
+		http.Error(w, rowError(err), http.StatusBadRequest)
+		return
+	}
+	ids, ok := s.saveMeasurements(w, r, results, "csv import")
+	if !ok {
+		return
+	}
+	resp.Saved, resp.IDs = len(ids), ids
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// rowError names the failing measurement of a mapping error as a row of the
+// file, counting the header as row 1 as spreadsheet apps do.
+func rowError(err error) string {
+	var me *measurementError
+	if !errors.As(err, &me) {
+		return err.Error()
+	}
+	return fmt.Sprintf("row %d: %v", me.Index+2, me.Err)
+}
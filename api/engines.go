@@ -0,0 +1,58 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/model"
+)
+
+// handleEngineComparisons lists comparisons of schedules that run several
+// engines per slot, oldest first. By default it returns the last 30 days;
+// from/to (RFC3339) change the window and connection limits it to one
+// connection.
+func (s *Server) handleEngineComparisons(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+
+	conn, err := connectionParam(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comparisons, err := s.store.ListEngineComparisons(r.Context(), from, to, conn)
+	if err != nil {
+		http.Error(w, "failed to load engine comparisons", http.StatusInternalServerError)
+		log.Printf("engine comparisons: %v", err)
+		return
+	}
+	if comparisons == nil {
+		comparisons = []model.EngineComparison{}
+	}
+	writeJSON(w, http.StatusOK, comparisons)
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"speedplane/storage"
+)
+
+// exportChunk is the most an export writes at once when rate limited, so the
+// stream stays smooth rather than arriving in bursts.
+const exportChunk = 16 << 10
+
+// ExportLimit caps what one request to the export endpoints and
+// /api/history.ndjson may download. Zero values are unlimited.
+type ExportLimit struct {
+	MaxRange time.Duration // Widest from/to range; "all" history is refused when set
+	MaxRows  int           // Most results one export may contain
+	Rate     int           // Bytes per second, shared by all of the scope's exports at once
+}
+
+// ExportToken is a read-only token for the export endpoints with its own
+// limits, e.g. for a spreadsheet or a backup script.
+type ExportToken struct {
+	Name  string
+	Token string
+	Limit ExportLimit
+}
+
+// exportLimits holds the scopes exports are limited by: one per export
+// token and one for requests without a token.
+type exportLimits struct {
+	requireToken bool
+	anonymous    *exportScope
+	tokens       []*exportScope
+}
+
+// exportScope is who an export is made for. A nil scope is the admin token,
+// which isn't limited.
+type exportScope struct {
+	name     string // Of the export token; empty for requests without one
+	token    string
+	limit    ExportLimit
+	throttle *throttle // nil without a rate limit
+}
+
+func newExportScope(name, token string, limit ExportLimit) *exportScope {
+	sc := &exportScope{name: name, token: token, limit: limit}
+	if limit.Rate > 0 {
+		sc.throttle = &throttle{rate: limit.Rate}
+	}
+	return sc
+}
+
+// SetExportLimits sets the limits for exports by requests without a token,
+// whether such requests may export at all, and the export tokens with their
+// own limits. Requests with the admin token are never limited. Tokens follow
+// the same rules as trigger tokens.
+func (s *Server) SetExportLimits(anonymous ExportLimit, requireToken bool, tokens []ExportToken) error {
+	if err := anonymous.validate(); err != nil {
+		return err
+	}
+	limits := exportLimits{requireToken: requireToken, anonymous: newExportScope("", "", anonymous)}
+	seen := make(map[string]bool, len(tokens))
+	for _, t := range tokens {
+		if len(t.Token) < minTriggerTokenLength {
+			return fmt.Errorf("export token %q: token must be at least %d characters", t.Name, minTriggerTokenLength)
+		}
+		if seen[t.Token] {
+			return fmt.Errorf("export token %q: token is used by another export token", t.Name)
+		}
+		seen[t.Token] = true
+		if err := t.Limit.validate(); err != nil {
+			return fmt.Errorf("export token %q: %w", t.Name, err)
+		}
+		limits.tokens = append(limits.tokens, newExportScope(t.Name, t.Token, t.Limit))
+	}
+	s.exports = limits
+	return nil
+}
+
+func (l ExportLimit) validate() error {
+	if l.MaxRange < 0 || l.MaxRows < 0 || l.Rate < 0 {
+		return fmt.Errorf("export limits must not be negative")
+	}
+	return nil
+}
+
+// exportScope returns the scope r exports under. Like ingest, the token may
+// be sent as ?token= for tools that can't set headers. It reports false when
+// r may not export at all.
+func (s *Server) exportScope(r *http.Request) (*exportScope, bool) {
+	if s.hasAdminToken() && s.isAdmin(r) {
+		return nil, true
+	}
+	if sc := s.exportToken(r); sc != nil {
+		return sc, true
+	}
+	if s.exports.requireToken {
+		return nil, false
+	}
+	return s.exports.anonymous, true
+}
+
+// exportToken returns the scope of the export token r carries, or nil,
+// comparing in constant time.
+func (s *Server) exportToken(r *http.Request) *exportScope {
+	token := bearerToken(r)
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	var found *exportScope
+	for _, sc := range s.exports.tokens {
+		if tokenMatches(token, sc.token) {
+			found = sc
+		}
+	}
+	return found
+}
+
+// beginExport checks that r may export the results recorded from from to to
+// matching filter, answering it with an error if not. Exports over the row
+// limit are refused, rather than cut short, so a client never takes a
+// partial export for the whole history.
+func (s *Server) beginExport(w http.ResponseWriter, r *http.Request, from, to time.Time, filter storage.ResultFilter) (*exportScope, bool) {
+	sc, ok := s.exportScope(r)
+	if !ok {
+		exportTokenRequired(w)
+		return nil, false
+	}
+	if sc == nil {
+		return nil, true
+	}
+	if max := sc.limit.MaxRange; max > 0 && (from.IsZero() || to.Sub(from) > max) {
+		sc.refused(r, "range")
+		http.Error(w, fmt.Sprintf("exports are limited to %s; narrow the range", formatRange(max)), http.StatusForbidden)
+		return nil, false
+	}
+	if max := sc.limit.MaxRows; max > 0 {
+		n, err := s.store.CountResults(r.Context(), from, to, filter)
+		if err != nil {
+			http.Error(w, "failed to count results", http.StatusInternalServerError)
+			return nil, false
+		}
+		if n > max {
+			sc.refused(r, "row")
+			http.Error(w, fmt.Sprintf("export of %d results is over the limit of %d; narrow the range", n, max), http.StatusForbidden)
+			return nil, false
+		}
+	}
+	return sc, true
+}
+
+func exportTokenRequired(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="speedplane"`)
+	http.Error(w, "export token required", http.StatusUnauthorized)
+}
+
+// refused logs an export refused for going over a limit, so a leaked token
+// being tried against it shows up.
+func (sc *exportScope) refused(r *http.Request, limit string) {
+	if sc.name != "" {
+		log.Printf("export: %s refused over the %s limit of export token %q", r.URL.Path, limit, sc.name)
+	}
+}
+
+// maxRows returns the most results sc may export, 0 for no limit.
+func (sc *exportScope) maxRows() int {
+	if sc == nil {
+		return 0
+	}
+	return sc.limit.MaxRows
+}
+
+// writer returns w, rate limited for sc.
+func (sc *exportScope) writer(ctx context.Context, w io.Writer) io.Writer {
+	if sc == nil || sc.throttle == nil {
+		return w
+	}
+	return &throttledWriter{ctx: ctx, w: w, t: sc.throttle}
+}
+
+// formatRange formats an export range limit in days where it is whole days.
+func formatRange(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		days := int(d / (24 * time.Hour))
+		if days == 1 {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", days)
+	}
+	return d.String()
+}
+
+// throttle paces writes to rate bytes per second, allowing a second's worth
+// at once. It is shared by concurrent exports, so starting several doesn't
+// multiply the rate.
+type throttle struct {
+	rate int
+
+	mu   sync.Mutex
+	next time.Time // When the bytes reserved so far are due to be sent
+}
+
+// wait blocks until n more bytes may be sent.
+func (t *throttle) wait(ctx context.Context, n int) error {
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	delay := t.next.Sub(now) - time.Second
+	t.next = t.next.Add(time.Duration(n) * time.Second / time.Duration(t.rate))
+	t.mu.Unlock()
+
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type throttledWriter struct {
+	ctx context.Context
+	w   io.Writer
+	t   *throttle
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := min(len(p), exportChunk, tw.t.rate)
+		if err := tw.t.wait(tw.ctx, chunk); err != nil {
+			return written, err
+		}
+		n, err := tw.w.Write(p[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[chunk:]
+	}
+	return written, nil
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"speedplane/diskspace"
+)
+
+// healthCheckTimeout bounds how long /readyz waits for the database.
+const healthCheckTimeout = 2 * time.Second
+
+// Component check outcomes reported by /readyz.
+const (
+	checkOK      = "ok"
+	checkFail    = "fail"
+	checkSkipped = "skipped" // Not supported or not applicable here
+)
+
+// componentStatus is the outcome of one readiness check.
+type componentStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+type readinessResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]componentStatus `json:"components"`
+}
+
+// handleHealthz is the liveness probe: it answers as long as the process
+// can serve requests, without touching the database, so a slow disk
+// doesn't get the process restarted.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":         "ok",
+		"uptime_seconds": int64(time.Since(s.startedAt).Seconds()),
+	})
+}
+
+// handleReadyz is the readiness probe: 200 when the database answers, the
+// scheduler is running, the latest result was saved and there's disk space
+// left, and 503 with the components that failed otherwise.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	resp := readinessResponse{
+		Status: checkOK,
+		Components: map[string]componentStatus{
+			"database":   s.checkDatabase(ctx),
+			"scheduler":  s.checkScheduler(),
+			"last_write": s.checkLastWrite(),
+			"disk":       s.checkDisk(),
+		},
+	}
+	code := http.StatusOK
+	for _, c := range resp.Components {
+		if c.Status == checkFail {
+			resp.Status = checkFail
+			code = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, code, resp)
+}
+
+func (s *Server) checkDatabase(ctx context.Context) componentStatus {
+	start := time.Now()
+	if err := s.store.Ping(ctx); err != nil {
+		return componentStatus{Status: checkFail, Message: err.Error()}
+	}
+	return componentStatus{Status: checkOK, Message: fmt.Sprintf("answered in %d ms", time.Since(start).Milliseconds())}
+}
+
+func (s *Server) checkScheduler() componentStatus {
+	switch {
+	case s.sched == nil:
+		return componentStatus{Status: checkSkipped, Message: "no scheduler"}
+	case !s.sched.Running():
+		return componentStatus{Status: checkFail, Message: "not running"}
+	}
+	if until := s.sched.PausedUntil(); !until.IsZero() {
+		return componentStatus{Status: checkOK, Message: "paused until " + until.Format(time.RFC3339)}
+	}
+	return componentStatus{Status: checkOK}
+}
+
+func (s *Server) checkLastWrite() componentStatus {
+	last := s.store.LastWrite()
+	switch {
+	case last == nil:
+		return componentStatus{Status: checkOK, Message: "no results saved since start"}
+	case last.Error != nil:
+		return componentStatus{Status: checkFail, Message: fmt.Sprintf("saving a result at %s failed: %v", last.Time.Format(time.RFC3339), last.Error)}
+	}
+	return componentStatus{Status: checkOK, Message: "last result saved at " + last.Time.Format(time.RFC3339)}
+}
+
+// SetDiskGuard sets the guard whose latest check /readyz reports as disk.
+func (s *Server) SetDiskGuard(g *diskspace.Guard) {
+	s.diskGuard = g
+}
+
+func (s *Server) checkDisk() componentStatus {
+	if s.diskGuard == nil {
+		return componentStatus{Status: checkSkipped, Message: "disk space guard is off"}
+	}
+	st := s.diskGuard.Status()
+	switch {
+	case errors.Is(st.Err, diskspace.ErrUnsupported):
+		return componentStatus{Status: checkSkipped, Message: st.Err.Error()}
+	case st.Err != nil:
+		return componentStatus{Status: checkFail, Message: st.Err.Error()}
+	}
+	msg := fmt.Sprintf("%d MiB free, at least %d MiB needed", st.Free>>20, st.MinFree>>20)
+	if st.Low {
+		return componentStatus{Status: checkFail, Message: msg + "; results are not being saved"}
+	}
+	return componentStatus{Status: checkOK, Message: msg}
+}
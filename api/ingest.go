@@ -0,0 +1,211 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"speedplane/ingest"
+	"speedplane/model"
+	"speedplane/storage"
+)
+
+// maxIngestBody limits the size of a batch posted to /api/ingest.
+const maxIngestBody = 10 << 20
+
+// IngestSource is an external tool allowed to store results through
+// /api/ingest, identified by its token.
+type IngestSource struct {
+	Name       string
+	Token      string
+	Connection string   // Connection results are stored under; empty for the default one
+	Tags       []string // Attached to every result from the source
+	Mapping    *ingest.Mapping
+}
+
+type ingestResponse struct {
+	Source string   `json:"source"`
+	Saved  int      `json:"saved"` // Including measurements that were already stored
+	IDs    []string `json:"ids"`   // Of the stored results, in the order posted
+}
+
+// SetIngestSources sets the sources accepted by /api/ingest. Tokens follow
+// the same rules as trigger tokens, and connections must be configured, so
+// it must be called after SetConnections.
+func (s *Server) SetIngestSources(sources []IngestSource) error {
+	seen := make(map[string]bool, len(sources))
+	for _, src := range sources {
+		if len(src.Token) < minTriggerTokenLength {
+			return fmt.Errorf("ingest %q: token must be at least %d characters", src.Name, minTriggerTokenLength)
+		}
+		if seen[src.Token] {
+			return fmt.Errorf("ingest %q: token is used by another source", src.Name)
+		}
+		seen[src.Token] = true
+		for _, tag := range src.Tags {
+			if err := model.ValidateTag(tag); err != nil {
+				return fmt.Errorf("ingest %q: %w", src.Name, err)
+			}
+		}
+		if _, ok := s.connection(src.Connection); !ok {
+			return fmt.Errorf("ingest %q: unknown connection %q", src.Name, src.Connection)
+		}
+		if src.Mapping == nil {
+			return fmt.Errorf("ingest %q: no mapping", src.Name)
+		}
+	}
+	s.ingest = append([]IngestSource(nil), sources...)
+	return nil
+}
+
+// findIngestSource returns the source with the given token, comparing in
+// constant time.
+func (s *Server) findIngestSource(token string) (IngestSource, bool) {
+	var found IngestSource
+	ok := false
+	for _, src := range s.ingest {
+		if tokenMatches(token, src.Token) {
+			found, ok = src, true
+		}
+	}
+	return found, ok
+}
+
+// handleIngest stores measurements an external tool posts to /api/ingest,
+// authenticated with its token as a bearer token or ?token=, for tools that
+// can't set headers. The body is one measurement, a JSON array of them or
+// JSON Lines, or with Content-Type text/csv a CSV file with a header row,
+// each mapped to a result with the source's field mapping. Nothing is
+// stored unless every measurement maps; like POST /api/results,
+// measurements that are already stored are not stored again.
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	token := bearerToken(r)
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	src, ok := s.findIngestSource(token)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="speedplane"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var items []json.RawMessage
+	var err error
+	body := http.MaxBytesReader(w, r.Body, maxIngestBody)
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "text/csv" {
+		comma, ok := csvDelimiter(r.URL.Query().Get("delimiter"))
+		if !ok {
+			http.Error(w, "delimiter must be one character", http.StatusBadRequest)
+			return
+		}
+		if _, items, err = ingest.SplitCSV(body, comma); err != nil {
+			http.Error(w, "invalid csv: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if items, err = ingest.Split(body); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if len(items) == 0 {
+		http.Error(w, "no measurements", http.StatusBadRequest)
+		return
+	}
+
+	results, err := s.mapMeasurements(items, src.Mapping, src.Connection, src.Tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ids, ok := s.saveMeasurements(w, r, results, "ingest "+strconv.Quote(src.Name))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, ingestResponse{Source: src.Name, Saved: len(ids), IDs: ids})
+}
+
+// mapMeasurements maps each measurement to a result on the given connection
+// with the given tags, redacted per the privacy settings. It returns an
+// error naming the first measurement that doesn't map.
+func (s *Server) mapMeasurements(items []json.RawMessage, mapping *ingest.Mapping, connection string, tags []string) ([]model.SpeedtestResult, error) {
+	conn, _ := s.connection(connection)
+	results := make([]model.SpeedtestResult, 0, len(items))
+	for i, raw := range items {
+		res, err := mapping.Result(raw)
+		if err != nil {
+			return nil, &measurementError{Index: i, Err: err}
+		}
+		res.Connection = conn
+		res.Tags = append([]string(nil), tags...)
+		if s.redactor != nil {
+			s.redactor.Result(&res)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// measurementError is a measurement of a batch that doesn't map.
+type measurementError struct {
+	Index int // From 0
+	Err   error
+}
+
+func (e *measurementError) Error() string {
+	return fmt.Sprintf("measurement %d: %v", e.Index+1, e.Err)
+}
+
+// saveMeasurements stores mapped results, skipping those already stored, and
+// returns their IDs. If one can't be stored it writes the error response
+// and reports false; results before it stay stored.
+func (s *Server) saveMeasurements(w http.ResponseWriter, r *http.Request, results []model.SpeedtestResult, source string) ([]string, bool) {
+	ids := make([]string, 0, len(results))
+	for i := range results {
+		if err := s.store.SaveResult(r.Context(), &results[i]); err != nil {
+			if errors.Is(err, storage.ErrResultConflict) {
+				http.Error(w, fmt.Sprintf("measurement %d: a different result with this id already exists", i+1), http.StatusConflict)
+				return nil, false
+			}
+			if errors.Is(err, storage.ErrLowDiskSpace) {
+				http.Error(w, err.Error(), http.StatusInsufficientStorage)
+				return nil, false
+			}
+			http.Error(w, "failed to save result", http.StatusInternalServerError)
+			log.Printf("%s: save result: %v", source, err)
+			return nil, false
+		}
+		ids = append(ids, results[i].ID)
+	}
+	log.Printf("%s: stored %d results", source, len(ids))
+
+	if len(results) > 0 {
+		latest := results[len(results)-1]
+		s.BroadcastSpeedtestComplete(&latest)
+	}
+	return ids, true
+}
+
+// csvDelimiter reads the ?delimiter= of a CSV upload: one character, "tab"
+// or empty for a comma.
+func csvDelimiter(v string) (rune, bool) {
+	switch v {
+	case "":
+		return ',', true
+	case "tab", "\t":
+		return '\t', true
+	}
+	runes := []rune(v)
+	if len(runes) != 1 || runes[0] == '"' || runes[0] == '\r' || runes[0] == '\n' {
+		return 0, false
+	}
+	return runes[0], true
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Sparkline dimensions in SVG user units; the kiosk page scales them to fit.
+const (
+	sparklineWidth  = 300
+	sparklineHeight = 60
+)
+
+// KioskView is the data behind the /kiosk display.
+type KioskView struct {
+	Latest            *PublicResult
+	NextRun           *time.Time
+	DownloadSparkline string // SVG polyline points, empty with fewer than two results
+	UploadSparkline   string
+	PingSparkline     string
+}
+
+// Kiosk builds the kiosk view: the latest result, the next scheduled run and
+// sparklines over the given window.
+func (s *Server) Kiosk(ctx context.Context, window time.Duration) (KioskView, error) {
+	now := time.Now()
+	results, err := s.store.ListResults(ctx, now.Add(-window), now)
+	if err != nil {
+		return KioskView{}, err
+	}
+
+	view := KioskView{
+		NextRun: s.sched.NextRunInfo().NextRun,
+	}
+	if len(results) == 0 {
+		latest, err := s.store.LatestResult(ctx)
+		if err != nil {
+			return KioskView{}, err
+		}
+		if latest != nil {
+			view.Latest = publicResult(*latest)
+		}
+		return view, nil
+	}
+
+	view.Latest = publicResult(results[len(results)-1])
+
+	download := make([]float64, len(results))
+	upload := make([]float64, len(results))
+	ping := make([]float64, len(results))
+	for i, r := range results {
+		download[i] = r.DownloadMbps
+		upload[i] = r.UploadMbps
+		ping[i] = r.PingMs
+	}
+	view.DownloadSparkline = sparklinePoints(download, sparklineWidth, sparklineHeight)
+	view.UploadSparkline = sparklinePoints(upload, sparklineWidth, sparklineHeight)
+	view.PingSparkline = sparklinePoints(ping, sparklineWidth, sparklineHeight)
+	return view, nil
+}
+
+// sparklinePoints scales values into a width x height box and returns them
+// as an SVG polyline points attribute, oldest value on the left.
+func sparklinePoints(values []float64, width, height float64) string {
+	if len(values) < 2 {
+		return ""
+	}
+
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo = min(lo, v)
+		hi = max(hi, v)
+	}
+	span := hi - lo
+	if span == 0 {
+		span = 1
+	}
+
+	var b strings.Builder
+	step := width / float64(len(values)-1)
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		x := float64(i) * step
+		y := height - (v-lo)/span*height
+		fmt.Fprintf(&b, "%.1f,%.1f", x, y)
+	}
+	return b.String()
+}
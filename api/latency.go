@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/latency"
+	"speedplane/model"
+)
+
+// SetWorkingLatency sets the tester POST /api/working-latency runs.
+func (s *Server) SetWorkingLatency(t *latency.Tester) {
+	s.workingLatency = t
+}
+
+// handleWorkingLatency lists working latency tests, oldest first, on GET and
+// runs one on POST. GET returns the last 7 days by default; from/to
+// (RFC3339) change the window and target limits it to one target. POST
+// tests the target named by the target parameter, or the first configured
+// one, which saturates the link for several seconds.
+func (s *Server) handleWorkingLatency(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listWorkingLatency(w, r)
+	case http.MethodPost:
+		s.runWorkingLatency(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) listWorkingLatency(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	to := time.Now()
+	from := to.AddDate(0, 0, -7)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+
+	tests, err := s.store.ListWorkingLatency(r.Context(), from, to, q.Get("target"))
+	if err != nil {
+		http.Error(w, "failed to load working latency tests", http.StatusInternalServerError)
+		log.Printf("working latency tests: %v", err)
+		return
+	}
+	if tests == nil {
+		tests = []model.WorkingLatency{}
+	}
+	writeJSON(w, http.StatusOK, tests)
+}
+
+func (s *Server) runWorkingLatency(w http.ResponseWriter, r *http.Request) {
+	if s.workingLatency == nil || len(s.workingLatency.Targets) == 0 {
+		http.Error(w, "no working latency targets configured", http.StatusNotFound)
+		return
+	}
+	if s.isShuttingDown() {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	res, err := s.workingLatency.Test(r.Context(), r.URL.Query().Get("target"))
+	switch {
+	case errors.Is(err, latency.ErrUnknownTarget):
+		http.Error(w, "unknown target", http.StatusBadRequest)
+		return
+	case errors.Is(err, latency.ErrBusy):
+		http.Error(w, "a working latency test is already running", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "working latency test failed", http.StatusInternalServerError)
+		log.Printf("working latency test: %v", err)
+		return
+	}
+
+	if err := s.store.SaveWorkingLatency(r.Context(), res); err != nil {
+		log.Printf("save working latency test: %v", err)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
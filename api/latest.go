@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/model"
+)
+
+type latestResponse struct {
+	Result     *model.SpeedtestResult `json:"result"`
+	AgeSeconds int64                  `json:"age_seconds"`
+}
+
+// handleLatest returns only the most recent result, without its raw engine
+// output, plus its age. The ETag follows the result rather than the body, so
+// polling clients get 304 Not Modified until a new result is saved; compute
+// the current age from the result timestamp when revalidating.
+func (s *Server) handleLatest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	latest, err := s.store.LatestResult(r.Context())
+	if err != nil {
+		http.Error(w, "failed to load latest result", http.StatusInternalServerError)
+		log.Printf("latest result: %v", err)
+		return
+	}
+	if latest == nil {
+		http.Error(w, "no results yet", http.StatusNotFound)
+		return
+	}
+
+	latest.RawJSON = nil
+	body, err := json.Marshal(latestResponse{
+		Result:     latest,
+		AgeSeconds: int64(time.Since(latest.Timestamp).Seconds()),
+	})
+	if err != nil {
+		http.Error(w, "failed to encode result", http.StatusInternalServerError)
+		return
+	}
+
+	etag := hashETag([]byte(latest.ID + "|" + latest.Timestamp.UTC().Format(time.RFC3339Nano)))
+	writeETagged(w, r, etag, "no-cache", "application/json", body)
+}
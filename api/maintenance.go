@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"speedplane/model"
+)
+
+// maxMaintenance caps how long a single maintenance window may pause testing,
+// so a typo in the duration can't silently stop measurements for good.
+const maxMaintenance = 7 * 24 * time.Hour
+
+type maintenanceRequest struct {
+	Duration string `json:"duration"` // Go duration, e.g. "30m"
+	Reason   string `json:"reason"`
+}
+
+type maintenanceResponse struct {
+	Active     bool              `json:"active"`
+	Until      *time.Time        `json:"until,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+	Annotation *model.Annotation `json:"annotation,omitempty"`
+}
+
+// RestoreMaintenance resumes a maintenance window that was still running when
+// the server stopped, so a restart during a router upgrade doesn't end it.
+func (s *Server) RestoreMaintenance(ctx context.Context) error {
+	a, err := s.store.ActiveAnnotation(ctx, model.AnnotationMaintenance, time.Now())
+	if err != nil || a == nil {
+		return err
+	}
+	s.maintenanceMu.Lock()
+	s.maintenance = a
+	s.maintenanceMu.Unlock()
+	s.sched.Pause(a.End)
+	log.Printf("maintenance until %s: %s", a.End.Format(time.RFC3339), a.Text)
+	return nil
+}
+
+// activeMaintenance returns the current maintenance window, or nil.
+func (s *Server) activeMaintenance() *model.Annotation {
+	s.maintenanceMu.Lock()
+	defer s.maintenanceMu.Unlock()
+	if s.maintenance == nil || s.sched.PausedUntil().IsZero() {
+		return nil
+	}
+	a := *s.maintenance
+	return &a
+}
+
+func maintenanceState(a *model.Annotation) maintenanceResponse {
+	if a == nil {
+		return maintenanceResponse{}
+	}
+	return maintenanceResponse{Active: true, Until: &a.End, Reason: a.Text, Annotation: a}
+}
+
+// handleAdminMaintenance pauses schedules and monitors for planned work, such
+// as a router upgrade, so it doesn't show up as an outage or raise alerts.
+// POST starts (or replaces) a window of the given duration and records the
+// reason as an annotation, GET reports the current window and DELETE ends it
+// early.
+func (s *Server) handleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, maintenanceState(s.activeMaintenance()))
+
+	case http.MethodPost:
+		var req maintenanceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 || d > maxMaintenance {
+			http.Error(w, "duration must be a positive Go duration of at most 168h", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		a := &model.Annotation{
+			Kind:  model.AnnotationMaintenance,
+			Start: now,
+			End:   now.Add(d),
+			Text:  strings.TrimSpace(req.Reason),
+		}
+		s.maintenanceMu.Lock()
+		defer s.maintenanceMu.Unlock()
+		if prev := s.maintenance; prev != nil && prev.End.After(now) {
+			// A new window replaces the running one rather than overlapping it
+			if err := s.store.EndAnnotation(r.Context(), prev.ID, now); err != nil {
+				log.Printf("maintenance: end annotation %d: %v", prev.ID, err)
+			}
+		}
+		if err := s.store.SaveAnnotation(r.Context(), a); err != nil {
+			http.Error(w, "failed to save annotation", http.StatusInternalServerError)
+			log.Printf("maintenance: save annotation: %v", err)
+			return
+		}
+		s.maintenance = a
+		s.sched.Pause(a.End)
+		s.BroadcastNextRun()
+		log.Printf("maintenance until %s: %s", a.End.Format(time.RFC3339), a.Text)
+		writeJSON(w, http.StatusOK, maintenanceState(a))
+
+	case http.MethodDelete:
+		s.maintenanceMu.Lock()
+		defer s.maintenanceMu.Unlock()
+		if s.maintenance == nil || s.sched.PausedUntil().IsZero() {
+			http.Error(w, "no maintenance in progress", http.StatusNotFound)
+			return
+		}
+		now := time.Now().UTC().Truncate(time.Second)
+		if err := s.store.EndAnnotation(r.Context(), s.maintenance.ID, now); err != nil {
+			http.Error(w, "failed to update annotation", http.StatusInternalServerError)
+			log.Printf("maintenance: end annotation %d: %v", s.maintenance.ID, err)
+			return
+		}
+		s.maintenance = nil
+		s.sched.Resume()
+		s.BroadcastNextRun()
+		log.Printf("maintenance ended early")
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost+", "+http.MethodDelete)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAnnotations lists annotations overlapping the last 30 days, or the
+// window given by from/to (RFC3339).
+func (s *Server) handleAnnotations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	to := time.Now()
+	from := to.Add(-30 * 24 * time.Hour)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+
+	annotations, err := s.store.ListAnnotations(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, "failed to load annotations", http.StatusInternalServerError)
+		log.Printf("annotations: %v", err)
+		return
+	}
+	if annotations == nil {
+		annotations = []model.Annotation{}
+	}
+	writeJSON(w, http.StatusOK, annotations)
+}
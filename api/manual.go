@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"speedplane/model"
+	"speedplane/plugins"
+	"speedplane/privacy"
+	"speedplane/storage"
+)
+
+// Unsaved manual runs are kept in memory, by default for an hour and at
+// most ten of them, so one can still be saved after its results dialog was
+// closed. See SetManualResultLimits.
+const (
+	DefaultMaxManualResults = 10
+	DefaultManualResultTTL  = time.Hour
+)
+
+// ManualResult is an unsaved manual run's result, held until it expires.
+type ManualResult struct {
+	model.SpeedtestResult
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// manualResults holds the latest unsaved manual runs, oldest first.
+type manualResults struct {
+	mu      sync.Mutex
+	results []ManualResult
+	limit   int           // Results held at most; 0 means DefaultMaxManualResults
+	ttl     time.Duration // How long each is held; 0 means DefaultManualResultTTL
+}
+
+// SetManualResultLimits sets how many unsaved manual runs are held at most
+// and for how long. Zero values keep the defaults.
+func (s *Server) SetManualResultLimits(limit int, ttl time.Duration) {
+	s.manual.mu.Lock()
+	defer s.manual.mu.Unlock()
+	s.manual.limit, s.manual.ttl = limit, ttl
+}
+
+// add keeps res, dropping the oldest results beyond the limit.
+func (m *manualResults) add(res model.SpeedtestResult, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune(now)
+	ttl := m.ttl
+	if ttl <= 0 {
+		ttl = DefaultManualResultTTL
+	}
+	limit := m.limit
+	if limit <= 0 {
+		limit = DefaultMaxManualResults
+	}
+	m.results = append(m.results, ManualResult{SpeedtestResult: res, ExpiresAt: now.Add(ttl)})
+	if n := len(m.results) - limit; n > 0 {
+		m.results = append(m.results[:0:0], m.results[n:]...)
+	}
+}
+
+// list returns the results that haven't expired, newest first.
+func (m *manualResults) list(now time.Time) []ManualResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune(now)
+	out := make([]ManualResult, 0, len(m.results))
+	for i := len(m.results) - 1; i >= 0; i-- {
+		out = append(out, m.results[i])
+	}
+	return out
+}
+
+func (m *manualResults) get(id string, now time.Time) (model.SpeedtestResult, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune(now)
+	for _, r := range m.results {
+		if r.ID == id {
+			return r.SpeedtestResult, true
+		}
+	}
+	return model.SpeedtestResult{}, false
+}
+
+// remove drops the result with id, reporting whether it was held.
+func (m *manualResults) remove(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.results {
+		if r.ID == id {
+			m.results = append(m.results[:i:i], m.results[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// prune drops expired results. m.mu must be held.
+func (m *manualResults) prune(now time.Time) {
+	i := 0
+	for i < len(m.results) && !now.Before(m.results[i].ExpiresAt) {
+		i++
+	}
+	if i > 0 {
+		m.results = append(m.results[:0:0], m.results[i:]...)
+	}
+}
+
+// handleManualResults lists the unsaved manual runs still held.
+func (s *Server) handleManualResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	results := s.manual.list(time.Now())
+	if s.redactor != nil {
+		for i := range results {
+			privacy.Strip(&results[i].SpeedtestResult)
+		}
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// handleManualResult saves an unsaved manual run
+// (POST /api/manual-results/{id}/save) or discards it
+// (DELETE /api/manual-results/{id}).
+func (s *Server) handleManualResult(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/manual-results/")
+	id, action, _ := strings.Cut(rest, "/")
+	switch {
+	case id == "":
+		http.NotFound(w, r)
+	case action == "" && r.Method == http.MethodDelete:
+		if !s.manual.remove(id) {
+			http.Error(w, "manual result not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case action == "":
+		w.Header().Set("Allow", http.MethodDelete)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	case action == "save" && r.Method == http.MethodPost:
+		s.saveManualResult(w, r, id)
+	case action == "save":
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// saveManualResult stores a held manual run as a scheduled run's result is
+// stored, hooks and alerts included, answering as POST /api/results would:
+// 201 when stored, 200 when it already was.
+func (s *Server) saveManualResult(w http.ResponseWriter, r *http.Request, id string) {
+	res, ok := s.manual.get(id, time.Now())
+	if !ok {
+		http.Error(w, "manual result not found or expired", http.StatusNotFound)
+		return
+	}
+	save := s.saveManual
+	if save == nil {
+		save = func(ctx context.Context, res *model.SpeedtestResult) (bool, error) {
+			created, err := s.store.SaveResultIfNew(ctx, res)
+			if created {
+				s.BroadcastSpeedtestComplete(res)
+			}
+			return created, err
+		}
+	}
+	created, err := save(r.Context(), &res)
+	if err != nil {
+		if errors.Is(err, plugins.ErrVetoed) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if errors.Is(err, storage.ErrResultConflict) {
+			http.Error(w, "a different result with this id already exists", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, storage.ErrLowDiskSpace) {
+			http.Error(w, err.Error(), http.StatusInsufficientStorage)
+			return
+		}
+		http.Error(w, "failed to save result", http.StatusInternalServerError)
+		log.Printf("save manual result: %v", err)
+		return
+	}
+	s.manual.remove(id)
+	if !created {
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	w.Header().Set("Location", "/api/results/"+url.PathEscape(res.ID))
+	writeJSON(w, http.StatusCreated, res)
+}
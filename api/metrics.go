@@ -0,0 +1,150 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"speedplane/storage"
+)
+
+// handleMetrics exposes the latest measurement and server state in the
+// Prometheus text exposition format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	total, err := s.store.CountResults(r.Context(), time.Time{}, time.Now(), storage.ResultFilter{})
+	if err != nil {
+		http.Error(w, "failed to count results", http.StatusInternalServerError)
+		log.Printf("metrics: count results: %v", err)
+		return
+	}
+	latest, err := s.store.LatestResult(r.Context())
+	if err != nil {
+		http.Error(w, "failed to load latest result", http.StatusInternalServerError)
+		log.Printf("metrics: latest result: %v", err)
+		return
+	}
+
+	var b strings.Builder
+	writeMetric(&b, "speedplane_results_total", "gauge", "Number of stored speedtest results.", float64(total))
+	writeMetric(&b, "speedplane_websocket_clients", "gauge", "Number of connected WebSocket clients.", float64(s.wsManager.Count()))
+	writeMetric(&b, "speedplane_response_cache_hits_total", "counter", "Summary and chart requests answered from the response cache.", float64(s.responses.hits.Load()))
+	writeMetric(&b, "speedplane_response_cache_misses_total", "counter", "Summary and chart requests that had to be computed.", float64(s.responses.misses.Load()))
+	writeMetric(&b, "speedplane_response_cache_entries", "gauge", "Number of responses in the response cache.", float64(s.responses.len()))
+
+	if latest != nil {
+		writeMetric(&b, "speedplane_last_result_timestamp_seconds", "gauge", "Unix time of the latest result.", float64(latest.Timestamp.Unix()))
+		writeMetric(&b, "speedplane_last_download_mbps", "gauge", "Download speed of the latest result in Mbps.", latest.DownloadMbps)
+		writeMetric(&b, "speedplane_last_upload_mbps", "gauge", "Upload speed of the latest result in Mbps.", latest.UploadMbps)
+		writeMetric(&b, "speedplane_last_ping_ms", "gauge", "Ping of the latest result in milliseconds.", latest.PingMs)
+		writeMetric(&b, "speedplane_last_jitter_ms", "gauge", "Jitter of the latest result in milliseconds.", latest.JitterMs)
+		writeMetric(&b, "speedplane_last_packet_loss_pct", "gauge", "Packet loss of the latest result in percent.", latest.PacketLossPct)
+		if latest.PathMTU != nil && latest.PathMTU.MTU > 0 {
+			writeMetric(&b, "speedplane_last_path_mtu_bytes", "gauge", "Path MTU to the test server of the latest result in bytes.", float64(latest.PathMTU.MTU))
+		}
+	}
+
+	probes, err := s.store.LatestProbeResults(r.Context())
+	if err != nil {
+		log.Printf("metrics: latest probe results: %v", err)
+	} else if len(probes) > 0 {
+		loss := make(map[string]float64, len(probes))
+		rtt := make(map[string]float64, len(probes))
+		for _, p := range probes {
+			loss[p.Target] = p.LossPct
+			if p.Received > 0 {
+				rtt[p.Target] = p.RTTAvgMs
+			}
+		}
+		writeLabeledMetric(&b, "speedplane_probe_loss_pct", "gauge", "Packet loss of the latest probe round per target in percent.", "target", loss)
+		if len(rtt) > 0 {
+			writeLabeledMetric(&b, "speedplane_probe_rtt_avg_ms", "gauge", "Average round-trip time of the latest probe round per target in milliseconds.", "target", rtt)
+		}
+	}
+
+	dish, err := s.store.LatestStarlinkStatus(r.Context())
+	if err != nil {
+		log.Printf("metrics: latest starlink status: %v", err)
+	} else if dish != nil {
+		up := 0.0
+		if dish.Error == "" && dish.OutageCause == "" {
+			up = 1
+		}
+		writeMetric(&b, "speedplane_starlink_up", "gauge", "Whether the Starlink dish was reachable and connected at the latest reading.", up)
+		if dish.Error == "" {
+			writeMetric(&b, "speedplane_starlink_downlink_mbps", "gauge", "Downlink traffic through the Starlink dish at the latest reading in Mbps.", dish.DownlinkMbps)
+			writeMetric(&b, "speedplane_starlink_uplink_mbps", "gauge", "Uplink traffic through the Starlink dish at the latest reading in Mbps.", dish.UplinkMbps)
+			writeMetric(&b, "speedplane_starlink_ping_ms", "gauge", "Latency from the Starlink dish to its point of presence in milliseconds.", dish.PingMs)
+			writeMetric(&b, "speedplane_starlink_ping_drop_pct", "gauge", "Share of pings from the Starlink dish to its point of presence that were dropped in percent.", dish.PingDropPct)
+			writeMetric(&b, "speedplane_starlink_obstructed_pct", "gauge", "Share of the Starlink dish's sky view that is obstructed in percent.", dish.ObstructedPct)
+		}
+	}
+
+	check, err := s.store.LatestReachabilityCheck(r.Context())
+	if err != nil {
+		log.Printf("metrics: latest reachability check: %v", err)
+	} else if check != nil {
+		if check.Reachable != nil {
+			writeMetric(&b, "speedplane_port_reachable", "gauge", "Whether the checked port was reachable from outside at the latest reachability check.", boolMetric(*check.Reachable))
+		}
+		if check.RouterIP != "" {
+			writeMetric(&b, "speedplane_cgnat", "gauge", "Whether the router's WAN address was not the public address at the latest reachability check.", boolMetric(check.CGNAT))
+		}
+	}
+
+	cmp, err := s.store.LatestEngineComparison(r.Context())
+	if err != nil {
+		log.Printf("metrics: latest engine comparison: %v", err)
+	} else if cmp != nil {
+		writeLabeledMetric(&b, "speedplane_engine_divergence_pct", "gauge", "How far the slowest engine was below the fastest at the latest multi-engine run in percent.", "direction", map[string]float64{
+			"download": cmp.DownloadDivergencePct,
+			"upload":   cmp.UploadDivergencePct,
+		})
+	}
+
+	if s.sched != nil {
+		if next := s.sched.NextRunTime(); next != nil {
+			writeMetric(&b, "speedplane_next_run_timestamp_seconds", "gauge", "Unix time of the next scheduled run.", float64(next.Unix()))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+func boolMetric(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func writeMetric(b *strings.Builder, name, kind, help string, value float64) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+	fmt.Fprintf(b, "%s %g\n", name, value)
+}
+
+// writeLabeledMetric writes one sample per label value, sorted for stable
+// output.
+func writeLabeledMetric(b *strings.Builder, name, kind, help, label string, values map[string]float64) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(b, "%s{%s=%s} %g\n", name, label, strconv.Quote(k), values[k])
+	}
+}
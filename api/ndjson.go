@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/model"
+	"speedplane/privacy"
+)
+
+// handleHistoryNDJSON streams history as newline-delimited JSON, one result
+// per line, oldest first. It takes the same range, from/to and filter
+// parameters as /api/history, but reads results from the database a page at
+// a time as the client consumes them, so even the whole history can be piped
+// into jq or a database loader without being held in memory. As with
+// exports, hidden external IP addresses are left out, and the same export
+// limits apply.
+func (s *Server) handleHistoryNDJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	from, to, err := historyRange(q, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := resultFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sc, ok := s.beginExport(w, r, from, to, filter)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	rc := http.NewResponseController(w)
+	buf := bufio.NewWriter(sc.writer(r.Context(), w))
+	enc := json.NewEncoder(buf)
+	strip := !s.showsIPs(r)
+	n := 0
+	err = s.store.EachResult(r.Context(), from, to, filter, func(res model.SpeedtestResult) error {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		if strip {
+			privacy.Strip(&res)
+		}
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+		n++
+		// Flush regularly so the client sees progress and a slow reader
+		// holds up the stream rather than buffering it here
+		if buf.Buffered() < 32<<10 {
+			return nil
+		}
+		if err := buf.Flush(); err != nil {
+			return err
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	})
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err != nil && r.Context().Err() == nil {
+		// Headers are sent, so the client only sees a truncated stream
+		log.Printf("history ndjson: stopped after %d results: %v", n, err)
+	}
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"speedplane/model"
+	"speedplane/storage"
+)
+
+// defaultPlanThreshold is the share of the plan's speed a result must reach
+// to count as meeting it in plan reports, unless ?threshold= says otherwise.
+const defaultPlanThreshold = 80
+
+type plansResponse struct {
+	Connection string             `json:"connection"`
+	Current    *model.PlanPeriod  `json:"current,omitempty"`
+	Plans      []model.PlanPeriod `json:"plans"` // Oldest first
+}
+
+// planPct is a result or average as a percentage of the plan's speeds.
+type planPct struct {
+	DownloadPct float64 `json:"download_pct"`
+	UploadPct   float64 `json:"upload_pct"`
+}
+
+// planSummary adds the current plan and how results compare to the plans
+// they were recorded under to /api/summary.
+type planSummary struct {
+	Current  *model.PlanPeriod  `json:"current,omitempty"`
+	Latest   *planPct           `json:"latest,omitempty"`
+	Averages map[string]planPct `json:"averages"` // By summary window, for windows with results under a plan
+}
+
+// planReportRow covers the results of one month under one plan.
+type planReportRow struct {
+	Month           string     `json:"month"` // "YYYY-MM" in the configured timezone
+	Plan            model.Plan `json:"plan"`
+	Count           int        `json:"count"`
+	AvgDownloadMbps float64    `json:"avg_download_mbps"`
+	AvgUploadMbps   float64    `json:"avg_upload_mbps"`
+	planPct
+	DownloadMetPct float64            `json:"download_met_pct"` // Share of results reaching the threshold for download
+	UploadMetPct   float64            `json:"upload_met_pct"`
+	CostPerMbps    *float64           `json:"cost_per_mbps,omitempty"` // Plan price per Mbps of average download; needs a price
+	Consistency    *model.Consistency `json:"consistency,omitempty"`   // Unset with too few results
+}
+
+type planReport struct {
+	Connection   string          `json:"connection"`
+	From         time.Time       `json:"from"`
+	To           time.Time       `json:"to"`
+	ThresholdPct float64         `json:"threshold_pct"`
+	Rows         []planReportRow `json:"rows"`
+	Unplanned    int             `json:"unplanned"` // Results from before the first plan, left out of the rows
+}
+
+// planHistory returns the plans of a connection from the settings, oldest
+// first.
+func (s *Server) planHistory(connection string) []model.PlanPeriod {
+	if s.getSettings == nil {
+		return nil
+	}
+	return model.PlanHistory(s.getSettings().Plans, connection, s.location())
+}
+
+// pctOfPlan returns a result's speeds as a percentage of the plan's.
+func pctOfPlan(r model.SpeedtestResult, p model.Plan) planPct {
+	return planPct{
+		DownloadPct: r.DownloadMbps / p.DownloadMbps * 100,
+		UploadPct:   r.UploadMbps / p.UploadMbps * 100,
+	}
+}
+
+func roundPct(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// summarizePlans compares results, and the latest one, with the plan each
+// was recorded under. It returns nil without plans.
+func summarizePlans(history []model.PlanPeriod, results []model.SpeedtestResult, latest *model.SpeedtestResult, now time.Time) *planSummary {
+	if len(history) == 0 {
+		return nil
+	}
+	out := &planSummary{
+		Current:  model.PlanAt(history, now),
+		Averages: make(map[string]planPct),
+	}
+	if latest != nil {
+		if p := model.PlanAt(history, latest.Timestamp); p != nil {
+			pct := pctOfPlan(*latest, p.Plan)
+			out.Latest = &planPct{DownloadPct: roundPct(pct.DownloadPct), UploadPct: roundPct(pct.UploadPct)}
+		}
+	}
+	for _, win := range summaryWindows(now) {
+		var sum planPct
+		n := 0
+		for _, r := range results {
+			if !win.contains(r.Timestamp) {
+				continue
+			}
+			p := model.PlanAt(history, r.Timestamp)
+			if p == nil {
+				continue
+			}
+			pct := pctOfPlan(r, p.Plan)
+			sum.DownloadPct += pct.DownloadPct
+			sum.UploadPct += pct.UploadPct
+			n++
+		}
+		if n > 0 {
+			out.Averages[win.name] = planPct{
+				DownloadPct: roundPct(sum.DownloadPct / float64(n)),
+				UploadPct:   roundPct(sum.UploadPct / float64(n)),
+			}
+		}
+	}
+	return out
+}
+
+// handlePlans lists a connection's plans (?connection=, default the default
+// connection) with the time each was in effect. Plans are set in the config
+// file or with PUT /api/settings.
+func (s *Server) handlePlans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	conn, err := connectionParam(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	history := s.planHistory(conn)
+	if history == nil {
+		history = []model.PlanPeriod{}
+	}
+	if conn == "" {
+		conn = model.DefaultConnection
+	}
+	writeJSON(w, http.StatusOK, plansResponse{
+		Connection: conn,
+		Current:    model.PlanAt(history, time.Now()),
+		Plans:      history,
+	})
+}
+
+// handlePlanReport compares results against the plan in effect when each was
+// recorded, per month and plan: average speeds as a percentage of the plan's
+// and the share of results reaching ?threshold= percent of it (default 80).
+// It covers the last 12 months, or the window given by from/to (RFC3339).
+func (s *Server) handlePlanReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	loc := s.location()
+	to := time.Now().In(loc)
+	from := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, loc).AddDate(0, -11, 0)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	threshold := float64(defaultPlanThreshold)
+	if v := q.Get("threshold"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t <= 0 || t > 100 {
+			http.Error(w, "threshold must be a percentage between 0 and 100", http.StatusBadRequest)
+			return
+		}
+		threshold = t
+	}
+	conn, err := connectionParam(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results, err := s.store.ListResultsPage(r.Context(), from, to, storage.ResultFilter{Connection: conn}, 0, 0)
+	if err != nil {
+		http.Error(w, "failed to load results", http.StatusInternalServerError)
+		log.Printf("plan report: %v", err)
+		return
+	}
+
+	report := buildPlanReport(s.planHistory(conn), results, threshold, loc)
+	if conn == "" {
+		conn = model.DefaultConnection
+	}
+	report.Connection = conn
+	report.From = from.UTC()
+	report.To = to.UTC().Truncate(time.Second)
+	writeJSON(w, http.StatusOK, report)
+}
+
+// buildPlanReport groups results, oldest first, by month in loc and the plan
+// they were recorded under.
+func buildPlanReport(history []model.PlanPeriod, results []model.SpeedtestResult, threshold float64, loc *time.Location) planReport {
+	report := planReport{ThresholdPct: threshold, Rows: []planReportRow{}}
+	type sums struct {
+		down, up, downPct, upPct float64
+		downMet, upMet           int
+		results                  []model.SpeedtestResult
+	}
+	var acc []sums
+	index := make(map[string]int) // By month and plan start
+	for _, r := range results {
+		p := model.PlanAt(history, r.Timestamp)
+		if p == nil {
+			report.Unplanned++
+			continue
+		}
+		month := r.Timestamp.In(loc).Format("2006-01")
+		key := month + " " + p.Start
+		i, ok := index[key]
+		if !ok {
+			i = len(report.Rows)
+			index[key] = i
+			report.Rows = append(report.Rows, planReportRow{Month: month, Plan: p.Plan})
+			acc = append(acc, sums{})
+		}
+		pct := pctOfPlan(r, p.Plan)
+		a := &acc[i]
+		a.down += r.DownloadMbps
+		a.up += r.UploadMbps
+		a.downPct += pct.DownloadPct
+		a.upPct += pct.UploadPct
+		a.results = append(a.results, r)
+		if pct.DownloadPct >= threshold {
+			a.downMet++
+		}
+		if pct.UploadPct >= threshold {
+			a.upMet++
+		}
+		report.Rows[i].Count++
+	}
+	for i := range report.Rows {
+		row, a := &report.Rows[i], acc[i]
+		n := float64(row.Count)
+		row.AvgDownloadMbps = math.Round(a.down/n*100) / 100
+		row.AvgUploadMbps = math.Round(a.up/n*100) / 100
+		row.DownloadPct = roundPct(a.downPct / n)
+		row.UploadPct = roundPct(a.upPct / n)
+		row.DownloadMetPct = roundPct(float64(a.downMet) / n * 100)
+		row.UploadMetPct = roundPct(float64(a.upMet) / n * 100)
+		row.CostPerMbps = costPerMbps(row.Plan.Price, a.down/n)
+		row.Consistency = model.ComputeConsistency(a.results)
+	}
+	return report
+}
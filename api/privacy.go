@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+
+	"speedplane/model"
+	"speedplane/privacy"
+)
+
+// SetPrivacy sets how the external IP address of results received at
+// /api/ingest is redacted. With a redactor set, the address, and where it
+// appears in the engine's raw output, is also left out of exports and
+// WebSocket broadcasts.
+func (s *Server) SetPrivacy(r *privacy.Redactor) {
+	s.redactor = r
+}
+
+// forExport strips the external IP address from results, in place, when it
+// is hidden. Requests with the admin token still get it, as signed results
+// only verify with the address they were signed with.
+func (s *Server) forExport(r *http.Request, results []model.SpeedtestResult) []model.SpeedtestResult {
+	if s.showsIPs(r) {
+		return results
+	}
+	for i := range results {
+		privacy.Strip(&results[i])
+	}
+	return results
+}
+
+// showsIPs reports whether r gets external IP addresses: unless they are
+// hidden, or with the admin token.
+func (s *Server) showsIPs(r *http.Request) bool {
+	return s.redactor == nil || (s.hasAdminToken() && s.isAdmin(r))
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/model"
+)
+
+// handleProbes lists packet-loss probe results. By default it returns the
+// last 24 hours for all targets; from/to (RFC3339) and target narrow the
+// window, and result_id returns only the round that ran alongside that
+// speedtest.
+func (s *Server) handleProbes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+
+	var results []model.ProbeResult
+	var err error
+	if id := q.Get("result_id"); id != "" {
+		results, err = s.store.ProbeResultsForRun(r.Context(), id)
+	} else {
+		to := time.Now()
+		from := to.Add(-24 * time.Hour)
+		if v := q.Get("from"); v != "" {
+			t, perr := time.Parse(time.RFC3339, v)
+			if perr != nil {
+				http.Error(w, "invalid from", http.StatusBadRequest)
+				return
+			}
+			from = t
+		}
+		if v := q.Get("to"); v != "" {
+			t, perr := time.Parse(time.RFC3339, v)
+			if perr != nil {
+				http.Error(w, "invalid to", http.StatusBadRequest)
+				return
+			}
+			to = t
+		}
+		results, err = s.store.ListProbeResults(r.Context(), from, to, q.Get("target"))
+	}
+	if err != nil {
+		http.Error(w, "failed to load probe results", http.StatusInternalServerError)
+		log.Printf("probe results: %v", err)
+		return
+	}
+	if results == nil {
+		results = []model.ProbeResult{}
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// publicEndpoints are the API endpoints a public dashboard serves to
+// visitors without the admin token, for GET only: what the dashboard needs to
+// show the latest result and charts in the chosen theme, and the status
+// page's summary, which is meant for sharing. openapi.yaml describes them.
+var publicEndpoints = []string{
+	"/api/health",
+	"/api/summary",
+	"/api/chart-data",
+	"/api/chart-data/buckets",
+	"/api/latest",
+	"/api/status",
+	"/api/theme",
+	"/api/schemes",
+	"/api/themes",
+	"/api/openapi.yaml",
+}
+
+// publicEvents are the WebSocket events a public dashboard sends to visitors
+// without the admin token: new results, which /api/latest serves anyway,
+// and the reset that makes dashboards reload. Schedules, next runs and the
+// progress of running tests are left out, as they are from the bootstrap
+// data, see Bootstrap.Public.
+var publicEvents = []string{
+	"status",
+	"ping",
+	"speedtest-complete",
+	"data-reset",
+}
+
+// publicEvent reports whether a WebSocket message may be sent to visitors of
+// a public dashboard.
+func publicEvent(message map[string]interface{}) bool {
+	typ, _ := message["type"].(string)
+	return slices.Contains(publicEvents, typ)
+}
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// SetPublic sets whether the dashboard is public. A public dashboard only
+// serves the endpoints in publicEndpoints to requests without the admin
+// token, see Public.
+func (s *Server) SetPublic(public bool) {
+	s.public = public
+}
+
+// ReadOnly reports whether r only gets the public subset of the API.
+func (s *Server) ReadOnly(r *http.Request) bool {
+	return s.public && !(s.hasAdminToken() && s.isAdmin(r))
+}
+
+// Public wraps the dashboard's handler so that, with a public dashboard,
+// requests to the API without the admin token get 401 unless they are for a
+// public endpoint. Endpoints that check tokens of their own, triggers,
+// ingest and exports with an export token, are left to do so, as is
+// first-run setup, which refuses changes once it is done. The endpoints
+// RegisterAdmin adds, /metrics and /debug/pprof/, get 401 too when they
+// share the handler, as they are open to everyone without an admin token.
+// Other pages are unaffected; /ws only sends such requests publicEvents.
+func (s *Server) Public(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !restrictedPath(r.URL.Path) || !s.ReadOnly(r) || s.publicRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="speedplane"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// restrictedPath reports whether path is one of the API or admin endpoints
+// a public dashboard only serves in part, see Public.
+func restrictedPath(path string) bool {
+	return strings.HasPrefix(path, "/api/") || path == "/metrics" || strings.HasPrefix(path, "/debug/pprof/")
+}
+
+// publicRequest reports whether r may be served on a public dashboard
+// without the admin token.
+func (s *Server) publicRequest(r *http.Request) bool {
+	path := r.URL.Path
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		if slices.Contains(publicEndpoints, path) || strings.HasPrefix(path, "/api/themes/") && path != "/api/themes/validate" {
+			return true
+		}
+	}
+	switch {
+	case strings.HasPrefix(path, "/api/triggers/"), path == "/api/ingest", path == "/api/setup":
+		return true
+	case strings.HasPrefix(path, "/api/export/"), path == "/api/history.ndjson":
+		return s.exportToken(r) != nil
+	}
+	return false
+}
+
+// handleOpenAPI serves the OpenAPI description of the public endpoints and
+// how the rest of the API is authenticated.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/model"
+	"speedplane/push"
+)
+
+// maxPushSubscriptionBody limits the size of subscriptions accepted by
+// /api/push/subscribe.
+const maxPushSubscriptionBody = 16 << 10
+
+// SetPush enables Web Push: /api/push/key, subscriptions with
+// /api/push/subscribe and test notifications with /api/push/test.
+func (s *Server) SetPush(n *push.Notifier) {
+	s.push = n
+}
+
+// handlePushKey returns the VAPID public key browsers subscribe with.
+func (s *Server) handlePushKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.push == nil {
+		http.Error(w, "push notifications are not enabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"public_key": s.push.Sender.Keys.PublicKey()})
+}
+
+// handlePushSubscribe stores the subscription a browser got from
+// PushManager.subscribe() (POST), or removes one by its endpoint (DELETE).
+func (s *Server) handlePushSubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodPost+", "+http.MethodDelete)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.push == nil {
+		http.Error(w, "push notifications are not enabled", http.StatusNotFound)
+		return
+	}
+
+	var sub model.PushSubscription
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushSubscriptionBody)).Decode(&sub); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		found, err := s.store.DeletePushSubscription(r.Context(), sub.Endpoint)
+		if err != nil {
+			http.Error(w, "failed to delete subscription", http.StatusInternalServerError)
+			log.Printf("push: delete subscription: %v", err)
+			return
+		}
+		if !found {
+			http.Error(w, "subscription not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := push.ValidateSubscription(sub); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sub.Created = time.Now().UTC()
+	if err := s.store.SavePushSubscription(r.Context(), sub); err != nil {
+		http.Error(w, "failed to save subscription", http.StatusInternalServerError)
+		log.Printf("push: save subscription: %v", err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handlePushTest sends a test notification to every subscribed browser.
+func (s *Server) handlePushTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.push == nil {
+		http.Error(w, "push notifications are not enabled", http.StatusNotFound)
+		return
+	}
+
+	err := s.push.Send(r.Context(), push.Message{
+		Title: "speedplane",
+		Body:  "Notifications are working",
+		Tag:   "test",
+		URL:   "./",
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
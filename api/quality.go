@@ -0,0 +1,94 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/model"
+)
+
+// serverQualityResponse is the body of GET /api/server-quality.
+type serverQualityResponse struct {
+	From            time.Time             `json:"from"`
+	To              time.Time             `json:"to"`
+	Connection      string                `json:"connection"`
+	MaxDeviationPct float64               `json:"max_deviation_pct"`
+	AutoExclude     bool                  `json:"auto_exclude"` // Whether diverging Ookla servers are skipped by tests
+	Servers         []model.ServerQuality `json:"servers"`
+}
+
+// SetServerQuality sets how /api/server-quality scores servers: the history
+// it covers by default, how far a server may deviate from the fleet median
+// before it is flagged, and whether tests avoid flagged servers.
+func (s *Server) SetServerQuality(window time.Duration, maxDeviationPct float64, autoExclude bool) {
+	s.qualityWindow = window
+	s.maxDeviationPct = maxDeviationPct
+	s.autoExclude = autoExclude
+}
+
+// handleServerQuality scores the test servers used on a connection, best
+// first. By default it covers the configured window up to now; from/to
+// (RFC3339) change it. Servers are scored per connection, the default one
+// unless connection names another, since lines of different speeds can't
+// share a fleet median.
+func (s *Server) handleServerQuality(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := s.qualityWindow
+	if window <= 0 {
+		window = model.DefaultQualityWindow
+	}
+	maxDeviationPct := s.maxDeviationPct
+	if maxDeviationPct <= 0 {
+		maxDeviationPct = model.DefaultMaxDeviationPct
+	}
+
+	q := r.URL.Query()
+	to := time.Now()
+	from := to.Add(-window)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+
+	conn, err := connectionParam(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if conn == "" {
+		conn = model.DefaultConnection
+	}
+
+	servers, err := s.store.ScoreServers(r.Context(), from, to, conn, maxDeviationPct)
+	if err != nil {
+		http.Error(w, "failed to score servers", http.StatusInternalServerError)
+		log.Printf("server quality: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, serverQualityResponse{
+		From:            from.UTC(),
+		To:              to.UTC(),
+		Connection:      conn,
+		MaxDeviationPct: maxDeviationPct,
+		AutoExclude:     s.autoExclude,
+		Servers:         servers,
+	})
+}
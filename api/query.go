@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limits of /api/query: rows returned by default and at most, the longest a
+// query may run, and the longest query text accepted.
+const (
+	defaultQueryRows = 1000
+	maxQueryRows     = 10000
+	queryTimeout     = 10 * time.Second
+	maxQueryBody     = 64 << 10
+)
+
+// handleQuery runs a read-only SQL query against the database for ad-hoc
+// analysis. Unlike other admin endpoints it is off until an admin token is
+// set, as it reads everything the database holds. The query comes as ?sql=
+// on GET or as the body of a POST, and must be a single SELECT; it runs on
+// a read-only connection, for at most queryTimeout, and returns at most
+// ?limit= rows. ?format=csv returns CSV instead of JSON.
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if !s.hasAdminToken() {
+		http.Error(w, "set an admin token to use /api/query", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+	var query string
+	switch r.Method {
+	case http.MethodGet:
+		query = q.Get("sql")
+	case http.MethodPost:
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxQueryBody))
+		if err != nil {
+			http.Error(w, "query too long", http.StatusRequestEntityTooLarge)
+			return
+		}
+		query = string(body)
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := defaultQueryRows
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxQueryRows {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxQueryRows), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), queryTimeout)
+	defer cancel()
+	res, err := s.store.Query(ctx, query, limit)
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, fmt.Sprintf("query took longer than %s", queryTimeout), http.StatusGatewayTimeout)
+		return
+	case ctx.Err() != nil:
+		return // The client went away
+	case err != nil:
+		http.Error(w, "query failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Clients can't tell a cut-off CSV from a whole one otherwise
+	w.Header().Set("X-Truncated", strconv.FormatBool(res.Truncated))
+	if format != "csv" {
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	writer := csv.NewWriter(w)
+	writer.Write(res.Columns)
+	record := make([]string, len(res.Columns))
+	for _, row := range res.Rows {
+		for i, v := range row {
+			switch v := v.(type) {
+			case nil:
+				record[i] = ""
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+			case []byte:
+				record[i] = fmt.Sprintf("%x", v)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+}
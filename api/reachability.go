@@ -0,0 +1,58 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/model"
+)
+
+// handleReachability lists reachability checks, oldest first. By default it
+// returns the last 7 days; from/to (RFC3339) change the window. Addresses
+// are left out when external IPs are hidden, unless the request carries the
+// admin token.
+func (s *Server) handleReachability(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	to := time.Now()
+	from := to.AddDate(0, 0, -7)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+
+	checks, err := s.store.ListReachabilityChecks(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, "failed to load reachability checks", http.StatusInternalServerError)
+		log.Printf("reachability checks: %v", err)
+		return
+	}
+	if checks == nil {
+		checks = []model.ReachabilityCheck{}
+	}
+	if !s.showsIPs(r) {
+		for i := range checks {
+			checks[i].PublicIP, checks[i].RouterIP = "", ""
+		}
+	}
+
+	writeJSON(w, http.StatusOK, checks)
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"sort"
+	"time"
+
+	"speedplane/downtime"
+	"speedplane/model"
+)
+
+// reliability summarises how often tests succeeded and how long the
+// connection was up within a summary window.
+type reliability struct {
+	Attempted   int      `json:"attempted"`        // Results plus runs that failed with an error
+	Succeeded   int      `json:"succeeded"`        // Results that moved data
+	SuccessRate *float64 `json:"success_rate_pct"` // nil without attempts
+	UptimePct   *float64 `json:"uptime_pct"`       // Share of the observed part of the window outside outages; nil before the first test
+}
+
+// SetDowntime sets the calendar of expected downtime, such as an ISP's
+// maintenance windows, whose runs are left out of outages, uptime and
+// success rates.
+func (s *Server) SetDowntime(cal *downtime.Calendar) {
+	s.downtime = cal
+}
+
+// connEvent is one observation of the connection: a result, or a run that
+// failed without one.
+type connEvent struct {
+	at   time.Time
+	down bool
+}
+
+// connectionEvents merges results and failed runs into observations, oldest
+// first, leaving out those during expected downtime.
+func connectionEvents(results []model.SpeedtestResult, failures []model.RunFailure, cal *downtime.Calendar) []connEvent {
+	events := make([]connEvent, 0, len(results)+len(failures))
+	for _, r := range results {
+		if _, expected := cal.Covers(r.Timestamp); !expected {
+			events = append(events, connEvent{at: r.Timestamp, down: resultFailed(r)})
+		}
+	}
+	for _, f := range failures {
+		if _, expected := cal.Covers(f.Timestamp); !expected {
+			events = append(events, connEvent{at: f.Timestamp, down: true})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].at.Before(events[j].at)
+	})
+	return events
+}
+
+// outagePeriods groups consecutive down observations into outages, oldest
+// first, each ending at the next up observation. An ongoing outage's
+// duration runs up to the latest down observation.
+func outagePeriods(events []connEvent) []Outage {
+	var outages []Outage
+	var current *Outage
+	var lastDown time.Time
+
+	for _, e := range events {
+		if e.down {
+			if current == nil {
+				current = &Outage{Start: e.at}
+			}
+			lastDown = e.at
+			continue
+		}
+		if current != nil {
+			end := e.at
+			current.End = &end
+			current.Duration = end.Sub(current.Start).Round(time.Second).String()
+			outages = append(outages, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		current.Ongoing = true
+		current.Duration = lastDown.Sub(current.Start).Round(time.Second).String()
+		outages = append(outages, *current)
+	}
+	return outages
+}
+
+// computeReliability counts attempts and successes per summary window and
+// measures uptime as the part of the window, from the first observation up to
+// now, not covered by an outage. Ongoing outages count as down until now.
+// Runs during expected downtime in cal count as neither.
+func computeReliability(results []model.SpeedtestResult, failures []model.RunFailure, now time.Time, cal *downtime.Calendar) map[string]reliability {
+	events := connectionEvents(results, failures, cal)
+	outages := outagePeriods(events)
+	windows := summaryWindows(now)
+	out := make(map[string]reliability, len(windows))
+
+	for _, win := range windows {
+		var rel reliability
+		for _, r := range results {
+			if _, expected := cal.Covers(r.Timestamp); expected || !win.contains(r.Timestamp) {
+				continue
+			}
+			rel.Attempted++
+			if !resultFailed(r) {
+				rel.Succeeded++
+			}
+		}
+		for _, f := range failures {
+			if _, expected := cal.Covers(f.Timestamp); !expected && win.contains(f.Timestamp) {
+				rel.Attempted++
+			}
+		}
+		if rel.Attempted > 0 {
+			rate := float64(rel.Succeeded) / float64(rel.Attempted) * 100
+			rel.SuccessRate = &rate
+		}
+
+		if len(events) > 0 {
+			start, end := win.from, win.to
+			if first := events[0].at; first.After(start) {
+				start = first
+			}
+			if now.Before(end) {
+				end = now
+			}
+			if end.After(start) {
+				var down time.Duration
+				for _, o := range outages {
+					oEnd := now
+					if o.End != nil {
+						oEnd = *o.End
+					}
+					down += overlap(o.Start, oEnd, start, end)
+				}
+				uptime := (1 - float64(down)/float64(end.Sub(start))) * 100
+				rel.UptimePct = &uptime
+			}
+		}
+
+		out[win.name] = rel
+	}
+
+	return out
+}
+
+// overlap returns how much of [aStart, aEnd) lies within [bStart, bEnd).
+func overlap(aStart, aEnd, bStart, bEnd time.Time) time.Duration {
+	if aStart.Before(bStart) {
+		aStart = bStart
+	}
+	if aEnd.After(bEnd) {
+		aEnd = bEnd
+	}
+	if !aEnd.After(aStart) {
+		return 0
+	}
+	return aEnd.Sub(aStart)
+}
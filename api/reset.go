@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/storage"
+)
+
+// resetTokenTTL is how long a confirmation token from /api/admin/reset can
+// be used for.
+const resetTokenTTL = 5 * time.Minute
+
+type resetRequest struct {
+	Confirm string `json:"confirm"`
+}
+
+type resetChallenge struct {
+	Confirm   string    `json:"confirm"` // Send back to delete the data
+	ExpiresAt time.Time `json:"expires_at"`
+	Results   int       `json:"results"` // Results that would be deleted
+}
+
+// SetReset sets the function that deletes all recorded data, enabling
+// /api/admin/reset.
+func (s *Server) SetReset(fn func(ctx context.Context) error) {
+	s.reset = fn
+}
+
+// handleAdminReset deletes all recorded data, e.g. before the install is
+// repurposed. It takes two requests so it can't happen by accident: a POST
+// without a body returns a confirmation token, and a POST of
+// {"confirm": token} within five minutes deletes the data. Any maintenance
+// window is ended, as its annotation is deleted with the rest. It is off
+// until an admin token is set, as the admin endpoints are open without one.
+func (s *Server) handleAdminReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.reset == nil {
+		http.Error(w, "reset is not available", http.StatusNotFound)
+		return
+	}
+	if !s.hasAdminToken() {
+		http.Error(w, "set an admin token to use /api/admin/reset", http.StatusForbidden)
+		return
+	}
+	var req resetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	s.resetMu.Lock()
+	defer s.resetMu.Unlock()
+	now := time.Now()
+
+	if req.Confirm == "" {
+		n, err := s.store.CountResults(r.Context(), time.Time{}, now.Add(24*time.Hour), storage.ResultFilter{})
+		if err != nil {
+			http.Error(w, "failed to count results", http.StatusInternalServerError)
+			return
+		}
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			http.Error(w, "failed to create token", http.StatusInternalServerError)
+			return
+		}
+		s.resetToken = hex.EncodeToString(b)
+		s.resetExpires = now.Add(resetTokenTTL).UTC().Truncate(time.Second)
+		writeJSON(w, http.StatusOK, resetChallenge{Confirm: s.resetToken, ExpiresAt: s.resetExpires, Results: n})
+		return
+	}
+
+	if !tokenMatches(req.Confirm, s.resetToken) || now.After(s.resetExpires) {
+		http.Error(w, "invalid or expired confirmation token", http.StatusForbidden)
+		return
+	}
+	s.resetToken = ""
+	if err := s.reset(r.Context()); err != nil {
+		http.Error(w, "failed to delete data", http.StatusInternalServerError)
+		log.Printf("reset: %v", err)
+		return
+	}
+
+	s.maintenanceMu.Lock()
+	if s.maintenance != nil {
+		s.maintenance = nil
+		s.sched.Resume()
+	}
+	s.maintenanceMu.Unlock()
+	log.Printf("reset: all recorded data deleted")
+	s.wsManager.Broadcast(map[string]interface{}{"type": "data-reset"})
+	s.BroadcastNextRun()
+	w.WriteHeader(http.StatusNoContent)
+}
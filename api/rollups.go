@@ -0,0 +1,51 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/storage"
+)
+
+// handleRollups returns the daily rollups kept for archived results, for
+// charts that reach back past the retention window. from/to default to all
+// rollups.
+func (s *Server) handleRollups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	from := time.Time{}
+	to := time.Now()
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+
+	rollups, err := s.store.ListRollups(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, "failed to load rollups", http.StatusInternalServerError)
+		log.Printf("rollups: %v", err)
+		return
+	}
+	if rollups == nil {
+		rollups = []storage.Rollup{}
+	}
+	writeJSON(w, http.StatusOK, rollups)
+}
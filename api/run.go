@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"speedplane/model"
+	"speedplane/scheduler"
+	"speedplane/speedtest"
+)
+
+// maxRunBody limits the size of requests to /api/run and /api/run/stream.
+const maxRunBody = 4 << 10
+
+// runOptions override the defaults for a single manual run. All of them are
+// optional, and so is the body they're read from.
+type runOptions struct {
+	Engine   string   `json:"engine,omitempty"`    // One of model.Engines
+	ServerID string   `json:"server_id,omitempty"` // Ookla server to test against instead of the closest
+	Phases   []string `json:"phases,omitempty"`    // Subset of ping, download and upload
+	Tags     []string `json:"tags,omitempty"`      // Attached to the result
+	Save     *bool    `json:"save,omitempty"`      // Overrides SaveManualRuns
+}
+
+// readRunOptions reads and checks the options of a manual run from the
+// request body, if there is one.
+func readRunOptions(w http.ResponseWriter, r *http.Request) (runOptions, error) {
+	var opts runOptions
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRunBody)).Decode(&opts)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return opts, errors.New("invalid json")
+	}
+
+	engine := opts.Engine
+	if engine == "" {
+		engine = model.EngineOokla
+	}
+	if !slices.Contains(model.Engines, engine) {
+		return opts, fmt.Errorf("unknown engine %q", engine)
+	}
+	if opts.ServerID != "" && engine != model.EngineOokla {
+		return opts, errors.New("server_id is only supported by the ookla engine")
+	}
+	if opts.ServerID != "" && strings.TrimFunc(opts.ServerID, isDigit) != "" {
+		return opts, errors.New("server_id must be numeric")
+	}
+	if len(opts.Phases) > 0 {
+		if engine != model.EngineOokla && engine != model.EngineCloudflare {
+			return opts, fmt.Errorf("engine %q always runs every phase", engine)
+		}
+		for i, p := range opts.Phases {
+			if !slices.Contains(speedtest.Phases, p) {
+				return opts, fmt.Errorf("unknown phase %q, must be ping, download, or upload", p)
+			}
+			if slices.Contains(opts.Phases[:i], p) {
+				return opts, fmt.Errorf("phase %q is listed twice", p)
+			}
+		}
+	}
+	if opts.Save != nil && *opts.Save && partialPhases(opts.Phases) {
+		return opts, errors.New("runs that skip phases can't be saved")
+	}
+	for _, tag := range opts.Tags {
+		if err := model.ValidateTag(tag); err != nil {
+			return opts, fmt.Errorf("invalid tag: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+// partialPhases reports whether a run of phases skips any. Skipped
+// measurements read as zero, as if the line were down, so such runs are
+// never saved.
+func partialPhases(phases []string) bool {
+	return len(phases) > 0 && len(phases) < len(speedtest.Phases)
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// context returns a copy of ctx that applies the options to its run.
+func (o runOptions) context(ctx context.Context) context.Context {
+	if o.Engine != "" {
+		ctx = scheduler.WithEngines(ctx, []string{o.Engine})
+	}
+	ctx = scheduler.WithTags(ctx, o.Tags)
+	ctx = speedtest.WithServer(ctx, o.ServerID)
+	return speedtest.WithPhases(ctx, o.Phases)
+}
+
+// saveRun reports whether a run with o is saved: as asked, or as
+// SaveManualRuns says.
+func (s *Server) saveRun(o runOptions) bool {
+	switch {
+	case partialPhases(o.Phases):
+		return false
+	case o.Save != nil:
+		return *o.Save && s.runAndSave != nil
+	}
+	return s.saveManualRuns()
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+type runtimeMemStats struct {
+	AllocBytes      uint64 `json:"alloc_bytes"`
+	TotalAllocBytes uint64 `json:"total_alloc_bytes"`
+	SysBytes        uint64 `json:"sys_bytes"`
+	HeapInuseBytes  uint64 `json:"heap_inuse_bytes"`
+	HeapObjects     uint64 `json:"heap_objects"`
+}
+
+type runtimeGCStats struct {
+	NumGC        uint32  `json:"num_gc"`
+	PauseTotalMs float64 `json:"pause_total_ms"`
+	LastGC       string  `json:"last_gc,omitempty"`
+}
+
+type runtimeDBStats struct {
+	OpenConnections int   `json:"open_connections"`
+	InUse           int   `json:"in_use"`
+	Idle            int   `json:"idle"`
+	WaitCount       int64 `json:"wait_count"`
+	WaitDurationMs  int64 `json:"wait_duration_ms"`
+}
+
+type runtimeResponse struct {
+	StartedAt     string          `json:"started_at"`
+	UptimeSeconds int64           `json:"uptime_seconds"`
+	GoVersion     string          `json:"go_version"`
+	Goroutines    int             `json:"goroutines"`
+	Memory        runtimeMemStats `json:"memory"`
+	GC            runtimeGCStats  `json:"gc"`
+	DB            runtimeDBStats  `json:"db"`
+	WSClients     int             `json:"ws_clients"`
+}
+
+// handleAdminRuntime reports process diagnostics for tracking down memory growth.
+func (s *Server) handleAdminRuntime(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	var lastGC string
+	if mem.LastGC > 0 {
+		lastGC = time.Unix(0, int64(mem.LastGC)).UTC().Format(time.RFC3339)
+	}
+
+	dbStats := s.store.DBStats()
+
+	writeJSON(w, http.StatusOK, runtimeResponse{
+		StartedAt:     s.startedAt.UTC().Format(time.RFC3339),
+		UptimeSeconds: int64(time.Since(s.startedAt).Seconds()),
+		GoVersion:     runtime.Version(),
+		Goroutines:    runtime.NumGoroutine(),
+		Memory: runtimeMemStats{
+			AllocBytes:      mem.Alloc,
+			TotalAllocBytes: mem.TotalAlloc,
+			SysBytes:        mem.Sys,
+			HeapInuseBytes:  mem.HeapInuse,
+			HeapObjects:     mem.HeapObjects,
+		},
+		GC: runtimeGCStats{
+			NumGC:        mem.NumGC,
+			PauseTotalMs: float64(mem.PauseTotalNs) / 1e6,
+			LastGC:       lastGC,
+		},
+		DB: runtimeDBStats{
+			OpenConnections: dbStats.OpenConnections,
+			InUse:           dbStats.InUse,
+			Idle:            dbStats.Idle,
+			WaitCount:       dbStats.WaitCount,
+			WaitDurationMs:  dbStats.WaitDuration.Milliseconds(),
+		},
+		WSClients: s.wsManager.Count(),
+	})
+}
+
+// registerPprof mounts the net/http/pprof handlers behind the admin check.
+func (s *Server) registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", s.RequireAdmin(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", s.RequireAdmin(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", s.RequireAdmin(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", s.RequireAdmin(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", s.RequireAdmin(pprof.Trace))
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"speedplane/scheduler"
+)
+
+type schedulerResponse struct {
+	Running           bool                       `json:"running"`
+	PausedUntil       *time.Time                 `json:"paused_until,omitempty"`
+	MaxStaggerSeconds int64                      `json:"max_stagger_seconds"`
+	Schedules         []scheduler.ScheduleStatus `json:"schedules"`
+}
+
+// handleAdminScheduler reports what the scheduler knows about each schedule:
+// when it last ran and runs next, its startup stagger, and whether a busy
+// connection is holding it back.
+func (s *Server) handleAdminScheduler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := schedulerResponse{
+		Running:           s.sched.Running(),
+		MaxStaggerSeconds: int64(scheduler.MaxStagger / time.Second),
+		Schedules:         s.sched.Status(),
+	}
+	if until := s.sched.PausedUntil(); !until.IsZero() {
+		resp.PausedUntil = &until
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
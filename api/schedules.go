@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"speedplane/model"
+	"speedplane/scheduler"
+)
+
+// maxSchedulesBody bounds the schedule list accepted by PUT
+// /api/schedules/bulk.
+const maxSchedulesBody = 1 << 20
+
+// handleSchedulesBulk gets or replaces every schedule at once, so a fleet
+// can keep its schedules in a file and sync them to each instance with one
+// call. A PUT is validated as a whole: one invalid schedule rejects the
+// list and leaves the current schedules as they are.
+func (s *Server) handleSchedulesBulk(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		schedules := s.sched.Schedules()
+		if schedules == nil {
+			schedules = []model.Schedule{}
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="speedplane-schedules.json"`)
+		writeJSON(w, http.StatusOK, schedules)
+
+	case http.MethodPut:
+		var schedules []model.Schedule
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSchedulesBody)).Decode(&schedules); err != nil {
+			http.Error(w, "invalid json, expected a list of schedules", http.StatusBadRequest)
+			return
+		}
+		if schedules == nil {
+			schedules = []model.Schedule{}
+		}
+		if err := s.validateSchedules(schedules); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.sched.SetSchedules(schedules)
+		if s.saveConfig != nil {
+			s.saveConfig()
+		}
+		s.BroadcastNextRun()
+		writeJSON(w, http.StatusOK, schedules)
+
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// validateSchedules checks a complete schedule list and fills in defaults
+// as POST /api/schedules does: interval type, a new ID and the ID as name.
+// IDs are kept when given, so the same list synced to several instances
+// keeps each schedule's history of last runs and its stagger.
+func (s *Server) validateSchedules(schedules []model.Schedule) error {
+	seen := make(map[string]bool, len(schedules))
+	for i := range schedules {
+		sc := &schedules[i]
+		if err := s.validateSchedule(sc); err != nil {
+			return fmt.Errorf("schedule %d: %w", i+1, err)
+		}
+		if seen[sc.ID] {
+			return fmt.Errorf("schedule %d: duplicate id %q", i+1, sc.ID)
+		}
+		seen[sc.ID] = true
+	}
+	return nil
+}
+
+// validateSchedule checks one schedule, as created, updated, synced or set
+// up, and fills in its defaults: a new ID, the ID as name and interval type.
+func (s *Server) validateSchedule(sc *model.Schedule) error {
+	if sc.ID == "" {
+		sc.ID = model.NewID()
+	}
+	if sc.Name == "" {
+		sc.Name = sc.ID
+	}
+	if sc.Type == "" {
+		sc.Type = model.ScheduleInterval
+	}
+	switch sc.Type {
+	case model.ScheduleInterval:
+		if d, err := time.ParseDuration(sc.Every); err != nil || d < time.Minute {
+			return errors.New("every must be a duration of at least 1m, e.g. \"1h\"")
+		}
+	case model.ScheduleDaily:
+		if _, err := time.Parse("15:04", sc.TimeOfDay); err != nil {
+			return errors.New("time_of_day must be HH:MM")
+		}
+	case model.ScheduleCron:
+		if _, err := scheduler.ParseCron(sc.Cron); err != nil {
+			return fmt.Errorf("invalid cron: %v", err)
+		}
+	default:
+		return fmt.Errorf("unknown type %q", sc.Type)
+	}
+	var ok bool
+	if sc.Connection, ok = s.connection(sc.Connection); !ok {
+		return errors.New("unknown connection")
+	}
+	if err := model.ValidateEngines(sc.Engines); err != nil {
+		return err
+	}
+	return s.validateScheduleAlerts(sc.Alerts)
+}
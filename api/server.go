@@ -2,11 +2,16 @@ package api
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -15,9 +20,20 @@ import (
 
 	"github.com/gorilla/websocket"
 
+	"speedplane/alert"
+	"speedplane/benchmark"
+	"speedplane/diskspace"
+	"speedplane/downtime"
+	"speedplane/i18n"
+	"speedplane/latency"
 	"speedplane/model"
+	"speedplane/privacy"
+	"speedplane/push"
 	"speedplane/scheduler"
+	"speedplane/share"
+	"speedplane/snapshot"
 	"speedplane/storage"
+	"speedplane/update"
 )
 
 // RunFunc is a function that executes a speedtest without progress updates.
@@ -80,22 +96,148 @@ type Server struct {
 	store        *storage.Store
 	runSpeedtest RunFunc
 	runWithProgress RunWithProgressFunc
+	runAndSave   RunWithProgressFunc // Manual runs while SaveManualRuns is on; see SetManualSave
+	saveManual   func(context.Context, *model.SpeedtestResult) (bool, error) // Held manual runs; see SetManualSave
 	sched        *scheduler.Scheduler
 	progress     *progressTracker
 	saveConfig   func()
 	getSaveManualRuns func() bool
 	setSaveManualRuns func(bool) error
+	getSettings  func() Settings
+	setSettings  func(Settings) error
 	wsManager    *WSConnectionManager
+	startedAt    time.Time
+	adminMu      sync.RWMutex
+	adminToken   string // Guarded by adminMu, as first-run setup sets it
+	enablePprof  bool
+	loc          *time.Location // Timezone for day boundaries; nil means time.Local
+	alerts       *alert.Engine
+	alertRouter  *alert.Router
+	alertRulesMu sync.Mutex // Serializes edits of the global rules, see handleAlertRules
+	saveAlertRules func([]model.AlertRule) error
+	channels     []NotifyChannel // Alert channels, for /api/admin/webhooks/test
+	triggers     []Trigger
+	connections  []string // Named connections besides the default one
+	downtime     *downtime.Calendar // Expected downtime, left out of outages and uptime
+	benchmark    *benchmark.Client  // Optional percentile comparison for the summary
+	signingKey   ed25519.PublicKey  // Set when results are signed at capture
+	redactor     *privacy.Redactor  // Redacts ingested addresses; when set, they are left out of exports and broadcasts
+	ingest       []IngestSource
+	workingLatency *latency.Tester // Runs POST /api/working-latency; nil when no targets are configured
+	qualityWindow   time.Duration // Default history /api/server-quality scores
+	maxDeviationPct float64       // Deviation from the fleet median at which servers are flagged
+	autoExclude     bool          // Whether tests skip flagged Ookla servers
+	reset        func(ctx context.Context) error // Deletes all recorded data, see handleAdminReset
+	snapshots    *snapshot.Exporter // Uploads history snapshots, see handleAdminSnapshot
+	setupPending func() bool                     // Whether first-run setup is offered, see handleSetup
+	setup        func(SetupRequest) (bool, error) // Applies first-run setup
+	setupMu      sync.Mutex
+	updates      *update.Checker // Reports the running and latest versions, see handleVersion
+	responses    responseCache   // Summary and chart responses, see cached
+	push         *push.Notifier  // Web Push; nil when not enabled
+	manual       manualResults   // Unsaved manual runs, see handleManualResults
+	shares       *share.Signer   // Signs share links; nil when not enabled
+	diskGuard    *diskspace.Guard // Free space of the database's disk; nil when off
+	exports      exportLimits     // Who may export and how much, see SetExportLimits
+	public       bool             // Whether visitors only get the public endpoints, see Public
+
+	resetMu      sync.Mutex
+	resetToken   string // Confirmation token issued by /api/admin/reset
+	resetExpires time.Time
+
+	maintenanceMu sync.Mutex
+	maintenance   *model.Annotation // Current maintenance window, see handleAdminMaintenance
+
+	shutdownMu   sync.RWMutex
+	shuttingDown bool
 }
 
-// runManual executes a speedtest for manual runs. Results are never saved automatically.
-func (s *Server) runManual(ctx context.Context) (*model.SpeedtestResult, error) {
-	return s.runSpeedtest(ctx)
+// runManual executes a speedtest for manual runs, whose opts the caller
+// applied to ctx, saving the result as saveRun says. It reports whether the
+// result was saved.
+func (s *Server) runManual(ctx context.Context, opts runOptions) (*model.SpeedtestResult, bool, error) {
+	if s.saveRun(opts) {
+		return s.runManualAndSave(ctx, nil)
+	}
+	res, err := s.runSpeedtest(ctx)
+	return s.unsavedResult(res, err, !partialPhases(opts.Phases))
+}
+
+// runManualWithProgress executes a speedtest with progress for manual runs, saving the result as saveRun says.
+func (s *Server) runManualWithProgress(ctx context.Context, opts runOptions, progress func(stage string, message string)) (*model.SpeedtestResult, bool, error) {
+	if s.saveRun(opts) {
+		return s.runManualAndSave(ctx, progress)
+	}
+	res, err := s.runWithProgress(ctx, progress)
+	return s.unsavedResult(res, err, !partialPhases(opts.Phases))
+}
+
+// SetManualSave sets the runner that tests and saves manual runs while
+// SaveManualRuns is on, and save, which saves a manual run held unsaved and
+// reports whether it was stored rather than already there. Both save and
+// report results as scheduled runs are, broadcasts included.
+func (s *Server) SetManualSave(run RunWithProgressFunc, save func(ctx context.Context, res *model.SpeedtestResult) (bool, error)) {
+	s.runAndSave = run
+	s.saveManual = save
+}
+
+func (s *Server) saveManualRuns() bool {
+	return s.runAndSave != nil && s.getSaveManualRuns != nil && s.getSaveManualRuns()
+}
+
+func (s *Server) runManualAndSave(ctx context.Context, progress func(stage string, message string)) (*model.SpeedtestResult, bool, error) {
+	res, err := s.runAndSave(ctx, progress)
+	if err != nil {
+		return nil, false, err
+	}
+	return res, true, nil
+}
+
+// unsavedResult gives an unsaved manual run's result an ID, so saving it
+// with POST /api/results more than once stores it once, and holds on to it
+// for /api/manual-results if hold is set.
+func (s *Server) unsavedResult(res *model.SpeedtestResult, err error, hold bool) (*model.SpeedtestResult, bool, error) {
+	if err != nil {
+		return nil, false, err
+	}
+	if res.ID == "" {
+		res.ID = model.NewID()
+	}
+	if hold {
+		s.manual.add(*res, time.Now())
+	}
+	return res, false, nil
+}
+
+// BeginShutdown makes the server refuse new speedtest runs.
+func (s *Server) BeginShutdown() {
+	s.shutdownMu.Lock()
+	defer s.shutdownMu.Unlock()
+	s.shuttingDown = true
+}
+
+func (s *Server) isShuttingDown() bool {
+	s.shutdownMu.RLock()
+	defer s.shutdownMu.RUnlock()
+	return s.shuttingDown
 }
 
-// runManualWithProgress executes a speedtest with progress for manual runs. Results are never saved automatically.
-func (s *Server) runManualWithProgress(ctx context.Context, progress func(stage string, message string)) (*model.SpeedtestResult, error) {
-	return s.runWithProgress(ctx, progress)
+// CloseWebSockets disconnects all WebSocket clients with a going-away close frame.
+func (s *Server) CloseWebSockets() {
+	s.wsManager.CloseAll("server shutting down")
+}
+
+// SetLocation sets the timezone used for "today"/"yesterday" boundaries and
+// for timestamps in exports. It must be called before Register.
+func (s *Server) SetLocation(loc *time.Location) {
+	s.loc = loc
+}
+
+func (s *Server) location() *time.Location {
+	if s.loc == nil {
+		return time.Local
+	}
+	return s.loc
 }
 
 // NewServer creates a new API server with the given dependencies.
@@ -110,34 +252,91 @@ func NewServer(store *storage.Store, runFn RunFunc, runWithProgressFn RunWithPro
 		getSaveManualRuns: getSaveManualRuns,
 		setSaveManualRuns: setSaveManualRuns,
 		wsManager:      NewWSConnectionManager(),
+		startedAt:      time.Now(),
 	}
 }
 
 // Register registers all API routes with the given HTTP mux.
 func (s *Server) Register(mux *http.ServeMux) {
-	mux.HandleFunc("/api/health", s.handleHealth)
-	mux.HandleFunc("/api/summary", s.handleSummary)
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/api/health", s.handleHealthz) // Kept for existing monitors
+	mux.HandleFunc("/api/summary", s.cached(s.handleSummary))
+	mux.HandleFunc("/api/latest", s.handleLatest)
+	mux.HandleFunc("/api/bootstrap", s.handleBootstrap)
 	mux.HandleFunc("/api/history", s.handleHistory)
+	mux.HandleFunc("/api/history.ndjson", s.handleHistoryNDJSON)
 	mux.HandleFunc("/api/results", s.handleResults)
 	mux.HandleFunc("/api/results/", s.handleResultByID)
-	mux.HandleFunc("/api/chart-data", s.handleChartData)
+	mux.HandleFunc("/api/results/compare", s.handleCompareResults)
+	mux.HandleFunc("/api/manual-results", s.handleManualResults)
+	mux.HandleFunc("/api/manual-results/", s.handleManualResult)
+	mux.HandleFunc("/api/chart-data", s.cached(s.handleChartData))
+	mux.HandleFunc("/api/chart-data/buckets", s.cached(s.handleChartBuckets))
+	mux.HandleFunc("/api/baseline", s.handleBaseline)
+	mux.HandleFunc("/api/rollups", s.handleRollups)
+	mux.HandleFunc("/api/consistency", s.handleConsistency)
 	mux.HandleFunc("/api/run", s.handleRun)
 	mux.HandleFunc("/api/run/stream", s.handleRunStream)
 	mux.HandleFunc("/api/run/progress/", s.handleRunProgress)
+	mux.HandleFunc("/api/setup", s.handleSetup)
+	mux.HandleFunc("/api/version", s.handleVersion)
+	mux.HandleFunc("/api/openapi.yaml", s.handleOpenAPI)
 	mux.HandleFunc("/api/schedules", s.handleSchedules)
 	mux.HandleFunc("/api/schedules/", s.handleScheduleByID)
+	mux.HandleFunc("/api/schedules/bulk", s.handleSchedulesBulk)
 	mux.HandleFunc("/api/next-run", s.handleNextRun)
 	mux.HandleFunc("/api/export/history.json", s.handleExportHistoryJSON)
 	mux.HandleFunc("/api/export/history.csv", s.handleExportHistoryCSV)
 	mux.HandleFunc("/api/export/current.json", s.handleExportCurrentJSON)
 	mux.HandleFunc("/api/export/current.csv", s.handleExportCurrentCSV)
 	mux.HandleFunc("/api/preferences", s.handlePreferences)
+	mux.HandleFunc("/api/settings", s.handleSettings)
+	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/api/alerts", s.handleAlerts)
+	mux.HandleFunc("/api/alerts/", s.handleAlertAction)
+	mux.HandleFunc("/api/alerts/rules", s.handleAlertRules)
+	mux.HandleFunc("/api/alerts/rules/", s.handleAlertRuleByID)
+	mux.HandleFunc("/api/alerts/history", s.handleAlertHistory)
+	mux.HandleFunc("/api/alerts/history/", s.handleAlertHistoryAck)
+	mux.HandleFunc("/api/probes", s.handleProbes)
+	mux.HandleFunc("/api/starlink", s.handleStarlink)
+	mux.HandleFunc("/api/utilization", s.handleUtilization)
+	mux.HandleFunc("/api/reachability", s.handleReachability)
+	mux.HandleFunc("/api/working-latency", s.handleWorkingLatency)
+	mux.HandleFunc("/api/engine-comparisons", s.handleEngineComparisons)
+	mux.HandleFunc("/api/server-quality", s.handleServerQuality)
+	mux.HandleFunc("/api/triggers/", s.handleTrigger)
+	mux.HandleFunc("/api/ingest", s.handleIngest)
+	mux.HandleFunc("/api/import/csv", s.handleImportCSV)
+	mux.HandleFunc("/api/query", s.RequireAdmin(s.handleQuery))
+	mux.HandleFunc("/api/connections", s.handleConnections)
+	mux.HandleFunc("/api/annotations", s.handleAnnotations)
+	mux.HandleFunc("/api/plans", s.handlePlans)
+	mux.HandleFunc("/api/plan-report", s.handlePlanReport)
+	mux.HandleFunc("/api/stats", s.handleStats)
+	mux.HandleFunc("/api/signing-key", s.handleSigningKey)
+	mux.HandleFunc("/api/verify", s.handleVerify)
+	mux.HandleFunc("/api/push/key", s.handlePushKey)
+	mux.HandleFunc("/api/push/subscribe", s.handlePushSubscribe)
+	mux.HandleFunc("/api/push/test", s.handlePushTest)
 	mux.HandleFunc("/ws", s.handleWebSocket)
 }
 
-func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	resp := map[string]string{"status": "ok"}
-	writeJSON(w, http.StatusOK, resp)
+// RegisterAdmin registers the metrics and /api/admin/ routes with the given HTTP mux.
+// These are kept separate from Register so they can be served on their own listener.
+func (s *Server) RegisterAdmin(mux *http.ServeMux) {
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/api/admin/runtime", s.RequireAdmin(s.handleAdminRuntime))
+	mux.HandleFunc("/api/admin/scheduler", s.RequireAdmin(s.handleAdminScheduler))
+	mux.HandleFunc("/api/admin/maintenance", s.RequireAdmin(s.handleAdminMaintenance))
+	mux.HandleFunc("/api/admin/reset", s.RequireAdmin(s.handleAdminReset))
+	mux.HandleFunc("/api/admin/webhooks/test", s.RequireAdmin(s.handleAdminWebhookTest))
+	mux.HandleFunc("/api/admin/snapshot", s.RequireAdmin(s.handleAdminSnapshot))
+	mux.HandleFunc("/api/admin/share", s.RequireAdmin(s.handleAdminShare))
+	if s.enablePprof {
+		s.registerPprof(mux)
+	}
 }
 
 // ---------- summary / history ----------
@@ -152,19 +351,46 @@ type aggregate struct {
 }
 
 type summaryResponse struct {
-	Latest   *model.SpeedtestResult `json:"latest,omitempty"`
-	Averages map[string]aggregate   `json:"averages"`
+	Latest      *model.SpeedtestResult `json:"latest,omitempty"`
+	Averages    map[string]aggregate   `json:"averages"`
+	Reliability map[string]reliability `json:"reliability"`
+	Consistency map[string]*model.Consistency `json:"consistency"` // Windows with too few results are left out
+	Benchmark   *benchmarkSummary      `json:"benchmark,omitempty"` // When a benchmark service is configured
+	Plan        *planSummary           `json:"plan,omitempty"`      // When ISP plans are set
 }
 
 func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
-	now := time.Now()
-	from := now.AddDate(0, 0, -30)
+	filter, err := resultFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	results, err := s.store.ListResults(from, now)
+	resp, err := s.summary(r.Context(), filter)
 	if err != nil {
-		http.Error(w, "failed to load results", http.StatusInternalServerError)
+		http.Error(w, "failed to load summary", http.StatusInternalServerError)
+		log.Printf("summary: %v", err)
 		return
 	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// summary computes the averages, reliability and consistency of the last 30
+// days of results matching filter, for /api/summary and the index page.
+func (s *Server) summary(ctx context.Context, filter storage.ResultFilter) (summaryResponse, error) {
+	now := time.Now().In(s.location())
+	from := now.AddDate(0, 0, -30)
+	conn := filter.Connection
+
+	results, err := s.store.ListResultsPage(ctx, from, now, filter, 0, 0)
+	if err != nil {
+		return summaryResponse{}, fmt.Errorf("results: %w", err)
+	}
+	failures, err := s.store.ListRunFailures(ctx, from, now, conn)
+	if err != nil {
+		return summaryResponse{}, fmt.Errorf("run failures: %w", err)
+	}
+	failures = filterFailures(failures, filter)
 
 	var latest *model.SpeedtestResult
 	if len(results) > 0 {
@@ -173,22 +399,62 @@ func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := summaryResponse{
-		Latest:   latest,
-		Averages: computeAggregates(results, now),
+		Latest:      latest,
+		Averages:    computeAggregates(results, now),
+		Reliability: computeReliability(results, failures, now, s.downtime),
+		Consistency: computeConsistency(results, now),
+	}
+	resp.Benchmark = s.benchmarkFor(ctx, latest, resp.Averages["last30days"])
+	resp.Plan = summarizePlans(s.planHistory(conn), results, latest, now)
+	return resp, nil
+}
+
+// filterFailures returns the failed runs that match f. Failed runs record
+// their engine and server, when one was selected, but not a link or tags, so
+// with a link or tag filter none match and success rates and uptime are
+// computed from results alone.
+func filterFailures(failures []model.RunFailure, f storage.ResultFilter) []model.RunFailure {
+	if f.LinkType != "" || f.Tag != "" {
+		return nil
 	}
-	writeJSON(w, http.StatusOK, resp)
+	if f.ServerID == "" && f.Engine == "" {
+		return failures
+	}
+	var out []model.RunFailure
+	for _, fail := range failures {
+		if f.ServerID != "" && fail.ServerID != f.ServerID {
+			continue
+		}
+		engine := fail.Engine
+		if engine == "" {
+			engine = model.EngineOokla // Recorded before engines could be chosen
+		}
+		if f.Engine != "" && engine != f.Engine {
+			continue
+		}
+		out = append(out, fail)
+	}
+	return out
 }
 
-func computeAggregates(results []model.SpeedtestResult, now time.Time) map[string]aggregate {
-	loc := now.Location()
-	startToday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+// summaryWindow is a named period the summary reports on.
+type summaryWindow struct {
+	name string
+	from time.Time
+	to   time.Time
+}
+
+func (w summaryWindow) contains(t time.Time) bool {
+	return !t.Before(w.from) && t.Before(w.to)
+}
+
+// summaryWindows returns the summary periods, with day boundaries in now's
+// location.
+func summaryWindows(now time.Time) []summaryWindow {
+	startToday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
 	endToday := startToday.AddDate(0, 0, 1)
 
-	windows := []struct {
-		name string
-		from time.Time
-		to   time.Time
-	}{
+	return []summaryWindow{
 		{"today", startToday, endToday},
 		{"yesterday", startToday.AddDate(0, 0, -1), startToday},
 		{"last2days", startToday.AddDate(0, 0, -2), endToday},
@@ -196,14 +462,16 @@ func computeAggregates(results []model.SpeedtestResult, now time.Time) map[strin
 		{"last7days", startToday.AddDate(0, 0, -7), endToday},
 		{"last30days", startToday.AddDate(0, 0, -30), endToday},
 	}
+}
 
+func computeAggregates(results []model.SpeedtestResult, now time.Time) map[string]aggregate {
+	windows := summaryWindows(now)
 	out := make(map[string]aggregate, len(windows))
 
 	for _, win := range windows {
 		var agg aggregate
 		for _, r := range results {
-			t := r.Timestamp.In(loc)
-			if t.Before(win.from) || !t.Before(win.to) {
+			if !win.contains(r.Timestamp) {
 				continue
 			}
 			agg.Count++
@@ -227,12 +495,30 @@ func computeAggregates(results []model.SpeedtestResult, now time.Time) map[strin
 	return out
 }
 
-func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query()
+// computeConsistency scores the consistency of results in each summary
+// window.
+func computeConsistency(results []model.SpeedtestResult, now time.Time) map[string]*model.Consistency {
+	out := make(map[string]*model.Consistency)
+	for _, win := range summaryWindows(now) {
+		var in []model.SpeedtestResult
+		for _, r := range results {
+			if win.contains(r.Timestamp) {
+				in = append(in, r)
+			}
+		}
+		if c := model.ComputeConsistency(in); c != nil {
+			out[win.name] = c
+		}
+	}
+	return out
+}
 
-	now := time.Now()
-	from := now.AddDate(0, 0, -30) // Default to 30 days
-	to := now
+// historyRange reads the range parameter (24h, 7d, 30d or all, default
+// 30d) and the from/to parameters (RFC3339), which override it, of history
+// requests.
+func historyRange(q url.Values, now time.Time) (from, to time.Time, err error) {
+	from = now.AddDate(0, 0, -30) // Default to 30 days
+	to = now
 
 	// Handle range parameter (24h, 7d, 30d, all)
 	if rangeParam := q.Get("range"); rangeParam != "" {
@@ -244,10 +530,9 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 		case "30d":
 			from = now.AddDate(0, 0, -30)
 		case "all":
-			from = time.Time{} // Zero time for "all" (stored as 0001-01-01 in RFC3339)
+			from = time.Time{} // Zero time for "all"
 		default:
-			http.Error(w, "invalid range, must be 24h, 7d, 30d, or all", http.StatusBadRequest)
-			return
+			return from, to, errors.New("invalid range, must be 24h, 7d, 30d, or all")
 		}
 	}
 
@@ -255,19 +540,34 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 	if v := q.Get("from"); v != "" {
 		t, err := time.Parse(time.RFC3339, v)
 		if err != nil {
-			http.Error(w, "invalid from", http.StatusBadRequest)
-			return
+			return from, to, errors.New("invalid from")
 		}
 		from = t
 	}
 	if v := q.Get("to"); v != "" {
 		t, err := time.Parse(time.RFC3339, v)
 		if err != nil {
-			http.Error(w, "invalid to", http.StatusBadRequest)
-			return
+			return from, to, errors.New("invalid to")
 		}
 		to = t
 	}
+	return from, to, nil
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	from, to, err := historyRange(q, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := resultFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	limit, _ := strconv.Atoi(q.Get("limit"))
 	offset, _ := strconv.Atoi(q.Get("offset"))
@@ -280,12 +580,12 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 
 	if limit > 0 {
 		// Paginated response: return { results, total }
-		total, err := s.store.CountResults(from, to)
+		total, err := s.store.CountResults(r.Context(), from, to, filter)
 		if err != nil {
 			http.Error(w, "failed to count history", http.StatusInternalServerError)
 			return
 		}
-		results, err := s.store.ListResultsPage(from, to, limit, offset)
+		results, err := s.store.ListResultsPage(r.Context(), from, to, filter, limit, offset)
 		if err != nil {
 			http.Error(w, "failed to load history", http.StatusInternalServerError)
 			return
@@ -297,7 +597,7 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	results, err := s.store.ListResults(from, to)
+	results, err := s.store.ListResultsPage(r.Context(), from, to, filter, 0, 0)
 	if err != nil {
 		http.Error(w, "failed to load history", http.StatusInternalServerError)
 		return
@@ -306,7 +606,57 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, results)
 }
 
-// handleResults handles POST requests to save a result.
+// resultFilter reads the optional link parameter (wired, wifi, virtual or
+// unknown), tag, server_id, engine and connection parameters that restrict
+// history, chart data, the summary and exports to results recorded over that
+// kind of link, carrying that tag, measured against that server or with that
+// engine, or measured over that named connection.
+func resultFilter(q url.Values) (storage.ResultFilter, error) {
+	var f storage.ResultFilter
+	switch link := model.LinkType(q.Get("link")); link {
+	case "":
+	case model.LinkWired, model.LinkWiFi, model.LinkVirtual, model.LinkUnknown:
+		f.LinkType = link
+	default:
+		return f, errors.New("invalid link, must be wired, wifi, virtual, or unknown")
+	}
+	if tag := q.Get("tag"); tag != "" {
+		if err := model.ValidateTag(tag); err != nil {
+			return f, fmt.Errorf("invalid tag: %v", err)
+		}
+		f.Tag = tag
+	}
+	f.ServerID = q.Get("server_id")
+	if engine := q.Get("engine"); engine != "" {
+		if !slices.Contains(model.Engines, engine) {
+			return f, fmt.Errorf("invalid engine, must be one of %s", strings.Join(model.Engines, ", "))
+		}
+		f.Engine = engine
+	}
+	conn, err := connectionParam(q)
+	if err != nil {
+		return f, err
+	}
+	f.Connection = conn
+	return f, nil
+}
+
+// connectionParam reads the optional connection parameter. Unknown
+// connections aren't rejected; they just match no results.
+func connectionParam(q url.Values) (string, error) {
+	conn := q.Get("connection")
+	if conn == "" {
+		return "", nil
+	}
+	if err := model.ValidateConnection(conn); err != nil {
+		return "", fmt.Errorf("invalid connection: %v", err)
+	}
+	return conn, nil
+}
+
+// handleResults handles POST requests to save a result, such as a manual
+// run's: 201 Created when it is stored, 200 when it already was (nothing is
+// written) and 409 Conflict when its ID belongs to a different result.
 func (s *Server) handleResults(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.Header().Set("Allow", http.MethodPost)
@@ -319,27 +669,83 @@ func (s *Server) handleResults(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
+	for _, tag := range res.Tags {
+		if err := model.ValidateTag(tag); err != nil {
+			http.Error(w, "invalid tags: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if res.Connection != "" {
+		if err := model.ValidateConnection(res.Connection); err != nil {
+			http.Error(w, "invalid connection: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
-	if err := s.store.SaveResult(&res); err != nil {
+	// Saving is idempotent, so clients can safely retry, and a manual run
+	// saved by SaveManualRuns can be saved again: the result's ID is honoured,
+	// and res.ID is set to the stored result's ID if this measurement was
+	// already saved.
+	id := res.ID
+	created, err := s.store.SaveResultIfNew(r.Context(), &res)
+	if err != nil {
+		if errors.Is(err, storage.ErrResultConflict) {
+			http.Error(w, "a different result with this id already exists", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, storage.ErrLowDiskSpace) {
+			http.Error(w, err.Error(), http.StatusInsufficientStorage)
+			return
+		}
 		http.Error(w, "failed to save result", http.StatusInternalServerError)
 		log.Printf("save result: %v", err)
 		return
 	}
+	// It no longer needs holding for /api/manual-results
+	s.manual.remove(id)
+	if !created {
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
 
-	writeJSON(w, http.StatusOK, res)
+	s.BroadcastSpeedtestComplete(&res)
+	w.Header().Set("Location", "/api/results/"+url.PathEscape(res.ID))
+	writeJSON(w, http.StatusCreated, res)
 }
 
-// handleResultByID handles operations on a specific result by ID.
+// handleResultByID handles operations on a specific result by ID:
+// /api/results/{id}, /api/results/{id}/raw for the engine's raw output and
+// /api/results/{id}/verify to check its signature.
 func (s *Server) handleResultByID(w http.ResponseWriter, r *http.Request) {
-	id := strings.TrimPrefix(r.URL.Path, "/api/results/")
+	id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/results/"), "/")
 	if id == "" {
 		http.NotFound(w, r)
 		return
 	}
 
+	switch sub {
+	case "":
+	case "raw":
+		s.handleResultRaw(w, r, id)
+		return
+	case "verify":
+		s.handleResultVerify(w, r, id)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
 	switch r.Method {
+	case http.MethodGet:
+		res, ok := s.loadResult(w, r, id)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+
 	case http.MethodDelete:
-		if err := s.store.DeleteResult(id); err != nil {
+		if err := s.store.DeleteResult(r.Context(), id); err != nil {
 			if err.Error() == "result not found" {
 				http.NotFound(w, r)
 				return
@@ -351,11 +757,49 @@ func (s *Server) handleResultByID(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 
 	default:
-		w.Header().Set("Allow", http.MethodDelete)
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodDelete)
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
+// handleResultRaw returns the speedtest engine's raw output for a result as
+// it was recorded, for debugging discrepancies between engines.
+func (s *Server) handleResultRaw(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	res, ok := s.loadResult(w, r, id)
+	if !ok {
+		return
+	}
+	if len(res.RawJSON) == 0 {
+		http.Error(w, "result has no raw engine output", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(res.RawJSON)
+}
+
+// loadResult fetches a result by ID, writing a 404 or 500 response and
+// returning false if it can't.
+func (s *Server) loadResult(w http.ResponseWriter, r *http.Request, id string) (*model.SpeedtestResult, bool) {
+	res, err := s.store.GetResult(r.Context(), id)
+	if err != nil {
+		http.Error(w, "failed to load result", http.StatusInternalServerError)
+		log.Printf("get result %s: %v", id, err)
+		return nil, false
+	}
+	if res == nil {
+		http.Error(w, "result not found", http.StatusNotFound)
+		return nil, false
+	}
+	return res, true
+}
+
 // ---------- run-now ----------
 
 func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
@@ -369,14 +813,35 @@ func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "speedtest runner not configured", http.StatusInternalServerError)
 		return
 	}
+	if s.isShuttingDown() {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
 
-	res, err := s.runManual(r.Context())
+	conn, ok := s.connection(r.URL.Query().Get("connection"))
+	if !ok {
+		http.Error(w, "unknown connection", http.StatusBadRequest)
+		return
+	}
+	opts, err := readRunOptions(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, saved, err := s.runManual(opts.context(scheduler.WithConnection(r.Context(), conn)), opts)
+	if errors.Is(err, storage.ErrLowDiskSpace) {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
 	if err != nil {
 		http.Error(w, "speedtest failed", http.StatusInternalServerError)
 		log.Printf("run speedtest: %v", err)
 		return
 	}
 
+	// Without it, POST the result to /api/results to keep it
+	w.Header().Set("X-Result-Saved", strconv.FormatBool(saved))
 	writeJSON(w, http.StatusOK, res)
 }
 
@@ -392,9 +857,24 @@ func (s *Server) handleRunStream(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "speedtest runner not configured", http.StatusInternalServerError)
 		return
 	}
+	if s.isShuttingDown() {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, ok := s.connection(r.URL.Query().Get("connection"))
+	if !ok {
+		http.Error(w, "unknown connection", http.StatusBadRequest)
+		return
+	}
+	opts, err := readRunOptions(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Generate session ID
-	sessionID := generateID()
+	sessionID := model.NewID()
 
 	// Set up SSE headers
 	w.Header().Set("Content-Type", "text/event-stream")
@@ -417,9 +897,10 @@ func (s *Server) handleRunStream(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Run speedtest in goroutine
-	ctx := r.Context()
+	ctx := opts.context(scheduler.WithConnection(r.Context(), conn))
 	resultCh := make(chan struct {
 		result *model.SpeedtestResult
+		saved  bool
 		err    error
 	}, 1)
 
@@ -428,8 +909,9 @@ func (s *Server) handleRunStream(w http.ResponseWriter, r *http.Request) {
 			if r := recover(); r != nil {
 				resultCh <- struct {
 					result *model.SpeedtestResult
+					saved  bool
 					err    error
-				}{nil, fmt.Errorf("panic: %v", r)}
+				}{nil, false, fmt.Errorf("panic: %v", r)}
 			}
 		}()
 
@@ -444,11 +926,12 @@ func (s *Server) handleRunStream(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		result, err := s.runManualWithProgress(ctx, progressFn)
+		result, saved, err := s.runManualWithProgress(ctx, opts, progressFn)
 		resultCh <- struct {
 			result *model.SpeedtestResult
+			saved  bool
 			err    error
-		}{result, err}
+		}{result, saved, err}
 		// Close channel to signal completion to main loop
 		// removeSession will also try to close it, but has recover to handle double-close
 		close(progressCh)
@@ -472,6 +955,7 @@ func (s *Server) handleRunStream(w http.ResponseWriter, r *http.Request) {
 					fmt.Fprintf(w, "data: %s\n\n", mustJSON(map[string]interface{}{
 						"type":    "completed",
 						"result":  final.result,
+						"saved":   final.saved,
 						"message": "Speedtest completed successfully",
 					}))
 				}
@@ -556,12 +1040,17 @@ func (s *Server) handleNextRun(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	writeJSON(w, http.StatusOK, s.nextRun())
+}
+
+// nextRun describes when the next scheduled test runs, for /api/next-run
+// and next-run WebSocket messages.
+func (s *Server) nextRun() map[string]interface{} {
 	info := s.sched.NextRunInfo()
 	if info.NextRun == nil {
-		writeJSON(w, http.StatusOK, map[string]interface{}{
+		return map[string]interface{}{
 			"next_run": nil,
-		})
-		return
+		}
 	}
 
 	now := time.Now()
@@ -570,12 +1059,30 @@ func (s *Server) handleNextRun(w http.ResponseWriter, r *http.Request) {
 		remaining = 0
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
+	resp := map[string]interface{}{
 		"next_run":          info.NextRun.UTC().Format(time.RFC3339),
 		"remaining":         int64(remaining.Seconds()),
 		"interval_duration": int64(info.IntervalDuration.Seconds()),
 		"timestamp":         now.Unix(),
-	})
+	}
+	if until := s.sched.PausedUntil(); !until.IsZero() {
+		resp["paused_until"] = until.UTC().Format(time.RFC3339)
+	}
+	return resp
+}
+
+// nextRunMessage is nextRun as a next-run WebSocket message.
+func (s *Server) nextRunMessage() map[string]interface{} {
+	msg := s.nextRun()
+	msg["type"] = "next-run"
+	return msg
+}
+
+// BroadcastNextRun pushes the next scheduled run to WebSocket clients, so
+// countdowns stay current without polling. Call it whenever schedules
+// change or a run starts or completes.
+func (s *Server) BroadcastNextRun() {
+	s.wsManager.Broadcast(s.nextRunMessage())
 }
 
 // ---------- chart data API ----------
@@ -666,10 +1173,16 @@ func (s *Server) handleChartData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	filter, err := resultFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	from := now.AddDate(0, 0, -days)
 	to := now
 
-	results, err := s.store.ListResults(from, to)
+	results, err := s.store.ListResultsPage(r.Context(), from, to, filter, 0, 0)
 	if err != nil {
 		http.Error(w, "failed to load history", http.StatusInternalServerError)
 		return
@@ -684,11 +1197,12 @@ func (s *Server) handleChartData(w http.ResponseWriter, r *http.Request) {
 	var values []float64
 	for _, r := range results {
 		var val float64
+		phase := "ping"
 		switch metric {
 		case "download":
-			val = r.DownloadMbps
+			val, phase = r.DownloadMbps, "download"
 		case "upload":
-			val = r.UploadMbps
+			val, phase = r.UploadMbps, "upload"
 		case "ping":
 			val = r.PingMs
 		case "jitter":
@@ -697,7 +1211,8 @@ func (s *Server) handleChartData(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "invalid metric, must be download, upload, ping, or jitter", http.StatusBadRequest)
 			return
 		}
-		if val >= 0 {
+		// A failed phase of a partial result measured nothing
+		if val >= 0 && !r.PhaseFailed(phase) {
 			values = append(values, val)
 		}
 	}
@@ -738,12 +1253,10 @@ func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "invalid json", http.StatusBadRequest)
 			return
 		}
-		if sc.Type == "" {
-			sc.Type = model.ScheduleInterval
-		}
-		sc.ID = generateID()
-		if sc.Name == "" {
-			sc.Name = sc.ID
+		sc.ID = model.NewID()
+		if err := s.validateSchedule(&sc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
 		cur := s.sched.Schedules()
@@ -753,6 +1266,7 @@ func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
 		if s.saveConfig != nil {
 			s.saveConfig()
 		}
+		s.BroadcastNextRun()
 
 		writeJSON(w, http.StatusCreated, sc)
 
@@ -788,6 +1302,10 @@ func (s *Server) handleScheduleByID(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		upd.ID = id
+		if err := s.validateSchedule(&upd); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		found := false
 		for i := range cur {
@@ -806,6 +1324,7 @@ func (s *Server) handleScheduleByID(w http.ResponseWriter, r *http.Request) {
 		if s.saveConfig != nil {
 			s.saveConfig()
 		}
+		s.BroadcastNextRun()
 		writeJSON(w, http.StatusOK, upd)
 
 	case http.MethodDelete:
@@ -827,6 +1346,7 @@ func (s *Server) handleScheduleByID(w http.ResponseWriter, r *http.Request) {
 		if s.saveConfig != nil {
 			s.saveConfig()
 		}
+		s.BroadcastNextRun()
 		w.WriteHeader(http.StatusNoContent)
 
 	default:
@@ -843,10 +1363,6 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	}
 }
 
-func generateID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
-}
-
 // ---------- export API ----------
 
 func (s *Server) handleExportHistoryJSON(w http.ResponseWriter, r *http.Request) {
@@ -868,7 +1384,17 @@ func (s *Server) handleExportHistoryJSON(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	results, err := s.store.ListResults(from, to)
+	filter, err := resultFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sc, ok := s.beginExport(w, r, from, to, filter)
+	if !ok {
+		return
+	}
+	results, err := s.store.ListResultsPage(r.Context(), from, to, filter, sc.maxRows(), 0)
 	if err != nil {
 		http.Error(w, "failed to load history", http.StatusInternalServerError)
 		return
@@ -877,7 +1403,10 @@ func (s *Server) handleExportHistoryJSON(w http.ResponseWriter, r *http.Request)
 	filename := fmt.Sprintf("speedtest-history-%s.json", time.Now().Format("20060102-150405"))
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
-	writeJSON(w, http.StatusOK, results)
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(sc.writer(r.Context(), w)).Encode(s.forExport(r, results)); err != nil && r.Context().Err() == nil {
+		log.Printf("export history json: %v", err)
+	}
 }
 
 func (s *Server) handleExportHistoryCSV(w http.ResponseWriter, r *http.Request) {
@@ -899,7 +1428,17 @@ func (s *Server) handleExportHistoryCSV(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	results, err := s.store.ListResults(from, to)
+	filter, err := resultFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sc, ok := s.beginExport(w, r, from, to, filter)
+	if !ok {
+		return
+	}
+	results, err := s.store.ListResultsPage(r.Context(), from, to, filter, sc.maxRows(), 0)
 	if err != nil {
 		http.Error(w, "failed to load history", http.StatusInternalServerError)
 		return
@@ -909,41 +1448,7 @@ func (s *Server) handleExportHistoryCSV(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", "text/csv")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
 
-	writer := csv.NewWriter(w)
-	defer writer.Flush()
-
-	// Write header
-	header := []string{
-		"ID", "Timestamp", "Download (Mbps)", "Upload (Mbps)", "Ping (ms)",
-		"Jitter (ms)", "Packet Loss (%)", "ISP", "External IP",
-		"Server ID", "Server Name", "Server Country",
-	}
-	if err := writer.Write(header); err != nil {
-		log.Printf("write CSV header error: %v", err)
-		return
-	}
-
-	// Write data rows
-	for _, r := range results {
-		row := []string{
-			r.ID,
-			r.Timestamp.Format(time.RFC3339),
-			strconv.FormatFloat(r.DownloadMbps, 'f', 2, 64),
-			strconv.FormatFloat(r.UploadMbps, 'f', 2, 64),
-			strconv.FormatFloat(r.PingMs, 'f', 2, 64),
-			strconv.FormatFloat(r.JitterMs, 'f', 2, 64),
-			strconv.FormatFloat(r.PacketLossPct, 'f', 2, 64),
-			r.ISP,
-			r.ExternalIP,
-			r.ServerID,
-			r.ServerName,
-			r.ServerCountry,
-		}
-		if err := writer.Write(row); err != nil {
-			log.Printf("write CSV row error: %v", err)
-			return
-		}
-	}
+	writeResultsCSV(sc.writer(r.Context(), w), s.forExport(r, results), s.formatter(), s.location())
 }
 
 func (s *Server) handleExportCurrentJSON(w http.ResponseWriter, r *http.Request) {
@@ -951,7 +1456,11 @@ func (s *Server) handleExportCurrentJSON(w http.ResponseWriter, r *http.Request)
 	from := now.AddDate(0, 0, -1)
 	to := now
 
-	results, err := s.store.ListResults(from, to)
+	if _, ok := s.exportScope(r); !ok {
+		exportTokenRequired(w)
+		return
+	}
+	results, err := s.store.ListResults(r.Context(), from, to)
 	if err != nil {
 		http.Error(w, "failed to load current data", http.StatusInternalServerError)
 		return
@@ -971,7 +1480,7 @@ func (s *Server) handleExportCurrentJSON(w http.ResponseWriter, r *http.Request)
 	filename := fmt.Sprintf("speedtest-current-%s.json", time.Now().Format("20060102-150405"))
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
-	writeJSON(w, http.StatusOK, latest)
+	writeJSON(w, http.StatusOK, s.forExport(r, []model.SpeedtestResult{*latest})[0])
 }
 
 func (s *Server) handleExportCurrentCSV(w http.ResponseWriter, r *http.Request) {
@@ -979,7 +1488,11 @@ func (s *Server) handleExportCurrentCSV(w http.ResponseWriter, r *http.Request)
 	from := now.AddDate(0, 0, -1)
 	to := now
 
-	results, err := s.store.ListResults(from, to)
+	if _, ok := s.exportScope(r); !ok {
+		exportTokenRequired(w)
+		return
+	}
+	results, err := s.store.ListResults(r.Context(), from, to)
 	if err != nil {
 		http.Error(w, "failed to load current data", http.StatusInternalServerError)
 		return
@@ -1000,39 +1513,69 @@ func (s *Server) handleExportCurrentCSV(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", "text/csv")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
 
+	writeResultsCSV(w, s.forExport(r, []model.SpeedtestResult{*latest}), s.formatter(), s.location())
+}
+
+// writeResultsCSV writes results as CSV with headers, bandwidth, numbers and
+// timestamps rendered for the configured locale, units and timezone.
+func writeResultsCSV(w io.Writer, results []model.SpeedtestResult, f i18n.Formatter, loc *time.Location) {
 	writer := csv.NewWriter(w)
+	writer.Comma = f.CSVDelimiter()
 	defer writer.Flush()
 
 	// Write header
+	unit := f.BandwidthUnit()
 	header := []string{
-		"ID", "Timestamp", "Download (Mbps)", "Upload (Mbps)", "Ping (ms)",
-		"Jitter (ms)", "Packet Loss (%)", "ISP", "External IP",
-		"Server ID", "Server Name", "Server Country",
+		f.T("col.id"), f.T("col.timestamp"), f.T("col.download", unit), f.T("col.upload", unit), f.T("col.ping"),
+		f.T("col.jitter"), f.T("col.packet_loss"), f.T("col.isp"), f.T("col.external_ip"),
+		f.T("col.server_id"), f.T("col.server_name"), f.T("col.server_country"),
+		f.T("col.link_interface"), f.T("col.link_type"), f.T("col.link_speed"), f.T("col.ssid"), f.T("col.signal"),
+		f.T("col.tags"), f.T("col.connection"), f.T("col.note"),
 	}
 	if err := writer.Write(header); err != nil {
 		log.Printf("write CSV header error: %v", err)
 		return
 	}
 
-	// Write data row
-	row := []string{
-		latest.ID,
-		latest.Timestamp.Format(time.RFC3339),
-		strconv.FormatFloat(latest.DownloadMbps, 'f', 2, 64),
-		strconv.FormatFloat(latest.UploadMbps, 'f', 2, 64),
-		strconv.FormatFloat(latest.PingMs, 'f', 2, 64),
-		strconv.FormatFloat(latest.JitterMs, 'f', 2, 64),
-		strconv.FormatFloat(latest.PacketLossPct, 'f', 2, 64),
-		latest.ISP,
-		latest.ExternalIP,
-		latest.ServerID,
-		latest.ServerName,
-		latest.ServerCountry,
-	}
-	if err := writer.Write(row); err != nil {
-		log.Printf("write CSV row error: %v", err)
-		return
+	// Write data rows
+	for _, r := range results {
+		row := []string{
+			r.ID,
+			f.FormatDateTime(r.Timestamp.In(loc)),
+			f.FormatBandwidth(r.DownloadMbps),
+			f.FormatBandwidth(r.UploadMbps),
+			f.FormatNumber(r.PingMs, 2),
+			f.FormatNumber(r.JitterMs, 2),
+			f.FormatNumber(r.PacketLossPct, 2),
+			r.ISP,
+			r.ExternalIP,
+			r.ServerID,
+			r.ServerName,
+			r.ServerCountry,
+		}
+		if l := r.Link; l != nil {
+			row = append(row, l.Interface, string(l.Type), optionalInt(l.SpeedMbps), l.SSID, optionalInt(l.SignalDBm))
+		} else {
+			row = append(row, "", "", "", "", "")
+		}
+		conn := r.Connection
+		if conn == "" {
+			conn = model.DefaultConnection
+		}
+		row = append(row, strings.Join(r.Tags, " "), conn, r.Note)
+		if err := writer.Write(row); err != nil {
+			log.Printf("write CSV row error: %v", err)
+			return
+		}
+	}
+}
+
+// optionalInt formats v, leaving the cell empty when it wasn't recorded.
+func optionalInt(v int) string {
+	if v == 0 {
+		return ""
 	}
+	return strconv.Itoa(v)
 }
 
 // ---------- preferences API ----------
@@ -1095,7 +1638,8 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	defer conn.Close()
 
 	// Register connection with manager
-	s.wsManager.Add(conn)
+	readOnly := s.ReadOnly(r)
+	s.wsManager.Add(conn, readOnly)
 	defer s.wsManager.Remove(conn)
 
 	log.Printf("WebSocket client connected from %s", r.RemoteAddr)
@@ -1108,6 +1652,12 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		log.Printf("WebSocket write error: %v", err)
 		return
 	}
+	if !readOnly {
+		if err := s.wsManager.WriteJSON(conn, s.nextRunMessage()); err != nil {
+			log.Printf("WebSocket write error: %v", err)
+			return
+		}
+	}
 
 	// Set up ping/pong
 	pingTicker := time.NewTicker(30 * time.Second)
@@ -1148,8 +1698,25 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// BroadcastSpeedtestProgress broadcasts the progress of a scheduled or
+// triggered speedtest, so dashboards can show that a test is running.
+func (s *Server) BroadcastSpeedtestProgress(id string, stage string, message string) {
+	s.wsManager.Broadcast(map[string]interface{}{
+		"type":     "speedtest-progress",
+		"schedule": id,
+		"stage":    stage,
+		"message":  message,
+		"time":     time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
 // BroadcastSpeedtestComplete broadcasts when a scheduled speedtest completes
 func (s *Server) BroadcastSpeedtestComplete(result *model.SpeedtestResult) {
+	if s.redactor != nil {
+		stripped := *result
+		privacy.Strip(&stripped)
+		result = &stripped
+	}
 	s.wsManager.Broadcast(map[string]interface{}{
 		"type":    "speedtest-complete",
 		"result":  result,
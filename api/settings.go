@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"speedplane/config"
+	"speedplane/i18n"
+	"speedplane/model"
+)
+
+// ErrInvalidSetting is wrapped by settings setters to reject a value with 400 instead of 500.
+var ErrInvalidSetting = errors.New("invalid setting")
+
+// Settings are the user-adjustable options exposed by /api/settings.
+type Settings struct {
+	SaveManualRuns bool               `json:"save_manual_runs"`
+	Theme          config.ThemeConfig `json:"theme"`
+	Locale         string             `json:"locale"`
+	Units          config.UnitsConfig `json:"units"`
+	Plans          []model.Plan       `json:"plans"` // ISP plans over time, see /api/plans
+}
+
+// SetSettingsHandlers sets the functions used to read and persist settings.
+func (s *Server) SetSettingsHandlers(get func() Settings, set func(Settings) error) {
+	s.getSettings = get
+	s.setSettings = set
+}
+
+// handleSettings returns the current settings (GET) or applies a partial update (PUT).
+// Fields missing from the PUT body keep their current values.
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	if s.getSettings == nil || s.setSettings == nil {
+		http.Error(w, "settings not configured", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.getSettings())
+
+	case http.MethodPut:
+		settings := s.getSettings()
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.setSettings(settings); err != nil {
+			if errors.Is(err, ErrInvalidSetting) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "failed to update settings", http.StatusInternalServerError)
+			log.Printf("update settings: %v", err)
+			return
+		}
+		// Plans and the timezone change what summaries are computed from
+		s.responses.clear()
+
+		writeJSON(w, http.StatusOK, s.getSettings())
+
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// formatter returns the i18n.Formatter for the current locale and units settings.
+func (s *Server) formatter() i18n.Formatter {
+	if s.getSettings == nil {
+		return i18n.NewFormatter("", "", "")
+	}
+	settings := s.getSettings()
+	return i18n.NewFormatter(settings.Locale, settings.Units.Bandwidth, settings.Units.Clock)
+}
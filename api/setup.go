@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/model"
+)
+
+// MinAdminTokenLength is the shortest admin token first-run setup accepts.
+const MinAdminTokenLength = 16
+
+// SetupRequest is the first-run setup: what a new install needs before
+// anything useful happens.
+type SetupRequest struct {
+	AdminToken string          `json:"admin_token"`        // Required for /api/admin/* from then on
+	Timezone   string          `json:"timezone,omitempty"` // IANA name; empty keeps the server's
+	Plan       *model.Plan     `json:"plan,omitempty"`     // The default connection's plan; start defaults to today
+	Schedule   *model.Schedule `json:"schedule,omitempty"` // Default: hourly
+}
+
+// SetupStatus tells clients whether to show the setup wizard.
+type SetupStatus struct {
+	Required        bool   `json:"required"`
+	Timezone        string `json:"timezone,omitempty"`         // Timezone in effect, suggested while setup is required
+	RestartRequired bool   `json:"restart_required,omitempty"` // After setup, when the timezone changed
+}
+
+// SetSetup enables first-run setup. pending reports whether it is still
+// offered, as it is only while no config file exists; apply saves the
+// setup, returning whether a restart is needed for all of it to take
+// effect, and wraps ErrInvalidSetting to reject a value.
+func (s *Server) SetSetup(pending func() bool, apply func(SetupRequest) (bool, error)) {
+	s.setupPending = pending
+	s.setup = apply
+}
+
+func (s *Server) setupRequired() bool {
+	return s.setupPending != nil && s.setupPending()
+}
+
+// handleSetup serves the first-run setup wizard. GET reports whether setup
+// is required; POST applies a SetupRequest once, after which the admin token
+// is enforced. Until then anyone who can reach the server can complete
+// setup, as on any fresh install.
+func (s *Server) handleSetup(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		status := SetupStatus{Required: s.setupRequired()}
+		if status.Required {
+			status.Timezone = s.location().String()
+		}
+		writeJSON(w, http.StatusOK, status)
+
+	case http.MethodPost:
+		s.setupMu.Lock()
+		defer s.setupMu.Unlock()
+		if !s.setupRequired() {
+			http.Error(w, "setup is already complete", http.StatusConflict)
+			return
+		}
+		var req SetupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if err := s.completeSetup(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		restart, err := s.setup(req)
+		if err != nil {
+			if errors.Is(err, ErrInvalidSetting) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "failed to save setup", http.StatusInternalServerError)
+			log.Printf("setup: %v", err)
+			return
+		}
+		s.setAdminToken(req.AdminToken)
+		s.responses.clear()
+		s.BroadcastNextRun()
+		log.Printf("setup: complete, admin token set")
+		writeJSON(w, http.StatusOK, SetupStatus{RestartRequired: restart})
+
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// completeSetup validates req and fills in the defaults.
+func (s *Server) completeSetup(req *SetupRequest) error {
+	if len(req.AdminToken) < MinAdminTokenLength {
+		return fmt.Errorf("admin_token must be at least %d characters", MinAdminTokenLength)
+	}
+	loc := s.location()
+	if req.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(req.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q", req.Timezone)
+		}
+	}
+	if p := req.Plan; p != nil {
+		if p.Start == "" {
+			p.Start = time.Now().In(loc).Format(model.PlanDateLayout)
+		}
+		if p.Connection != "" {
+			return errors.New("plan: only the default connection can be set up")
+		}
+	}
+
+	if req.Schedule == nil {
+		req.Schedule = &model.Schedule{Name: "Hourly", Type: model.ScheduleInterval, Every: "1h"}
+	}
+	sc := req.Schedule
+	sc.ID = model.NewID()
+	sc.Enabled = true
+	if sc.Name == "" {
+		sc.Name = "Default"
+	}
+	if err := s.validateSchedule(sc); err != nil {
+		return fmt.Errorf("schedule: %w", err)
+	}
+	return nil
+}
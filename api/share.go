@@ -0,0 +1,298 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"speedplane/model"
+	"speedplane/share"
+	"speedplane/storage"
+)
+
+// maxShareBody limits the size of requests to /api/admin/share.
+const maxShareBody = 4 << 10
+
+// Share links expire after a week unless asked otherwise, and at most after
+// 90 days. They cover at most a year of results.
+const (
+	defaultShareExpiry = 7 * 24 * time.Hour
+	maxShareExpiry     = 90 * 24 * time.Hour
+	maxShareRange      = 366 * 24 * time.Hour
+)
+
+// Shared chart dimensions in SVG user units; the page scales them to fit.
+const (
+	shareChartWidth  = 600
+	shareChartHeight = 200
+)
+
+// shareMetrics are the charts links can be made for, as in /api/chart-data.
+var shareMetrics = []string{"download", "upload", "ping", "jitter"}
+
+type shareRequest struct {
+	Metric     string     `json:"metric"`
+	Range      string     `json:"range,omitempty"` // 24h, 7d or 30d up to now, or:
+	From       *time.Time `json:"from,omitempty"`
+	To         *time.Time `json:"to,omitempty"`
+	Connection string     `json:"connection,omitempty"`
+	ExpiresIn  string     `json:"expires_in,omitempty"` // Go duration, e.g. "72h"
+}
+
+type shareResponse struct {
+	URL  string `json:"url"`  // For the host and scheme the request was made with
+	Path string `json:"path"` // Relative to the dashboard
+	share.Link
+}
+
+// SharedChart is what a share link shows: the values of its metric over its
+// range, oldest first.
+type SharedChart struct {
+	Link      share.Link       `json:"link"`
+	Points    []SharedPoint    `json:"points"`
+	Stats     *percentileStats `json:"stats,omitempty"`
+	Sparkline string           `json:"-"` // SVG polyline points, empty with fewer than two points
+}
+
+// SharedPoint is one result's value of a shared metric.
+type SharedPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// Bandwidth reports whether the chart is of throughput, in Mbps, rather
+// than of latency in milliseconds.
+func (c SharedChart) Bandwidth() bool {
+	return c.Link.Metric == "download" || c.Link.Metric == "upload"
+}
+
+// SetShareSigner enables share links: /api/admin/share creates them and
+// ShareHandler serves them.
+func (s *Server) SetShareSigner(signer *share.Signer) {
+	s.shares = signer
+}
+
+// handleAdminShare creates a link granting read access to one chart over a
+// fixed range, for people without access to the dashboard. Ranges given as
+// 24h, 7d or 30d end when the link is made, so it shows the same results
+// however late it is opened.
+func (s *Server) handleAdminShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.shares == nil {
+		http.Error(w, "share links are not enabled", http.StatusNotFound)
+		return
+	}
+
+	var req shareRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxShareBody)).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(shareMetrics, req.Metric) {
+		http.Error(w, "invalid metric, must be download, upload, ping, or jitter", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	link := share.Link{Metric: req.Metric}
+	switch {
+	case req.From != nil && req.To != nil:
+		link.From, link.To = *req.From, *req.To
+	case req.From != nil || req.To != nil:
+		http.Error(w, "from and to must be given together", http.StatusBadRequest)
+		return
+	case req.Range == "24h":
+		link.From, link.To = now.AddDate(0, 0, -1), now
+	case req.Range == "7d":
+		link.From, link.To = now.AddDate(0, 0, -7), now
+	case req.Range == "30d":
+		link.From, link.To = now.AddDate(0, 0, -30), now
+	default:
+		http.Error(w, "range (24h, 7d, 30d) or from and to required", http.StatusBadRequest)
+		return
+	}
+	if !link.From.Before(link.To) || link.To.Sub(link.From) > maxShareRange {
+		http.Error(w, "from must be before to, and at most a year earlier", http.StatusBadRequest)
+		return
+	}
+
+	if req.Connection != "" {
+		if err := model.ValidateConnection(req.Connection); err != nil {
+			http.Error(w, fmt.Sprintf("invalid connection: %v", err), http.StatusBadRequest)
+			return
+		}
+		if _, ok := s.connection(req.Connection); !ok {
+			http.Error(w, "unknown connection", http.StatusBadRequest)
+			return
+		}
+		link.Connection = req.Connection
+	}
+
+	expiry := defaultShareExpiry
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 || d > maxShareExpiry {
+			http.Error(w, "expires_in must be a positive duration of at most 2160h", http.StatusBadRequest)
+			return
+		}
+		expiry = d
+	}
+	link.Expires = now.Add(expiry)
+
+	token := s.shares.Sign(link)
+	// Sign keeps times to the second; report what the link actually grants
+	link, err := s.shares.Verify(token, now)
+	if err != nil {
+		http.Error(w, "failed to sign link", http.StatusInternalServerError)
+		log.Printf("share: verify new link: %v", err)
+		return
+	}
+	path := "/share/" + token
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	writeJSON(w, http.StatusCreated, shareResponse{
+		URL:  scheme + "://" + r.Host + path,
+		Path: path,
+		Link: link,
+	})
+}
+
+// RequireShare wraps a handler so it is only reachable through a valid share
+// link, /share/<token>[/...], passing on the link it grants. Expired links
+// get 410 Gone and anything else not found, so tokens can't be probed.
+func (s *Server) RequireShare(next func(http.ResponseWriter, *http.Request, share.Link)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.shares == nil {
+			http.NotFound(w, r)
+			return
+		}
+		token, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/share/"), "/")
+		link, err := s.shares.Verify(token, time.Now())
+		switch {
+		case errors.Is(err, share.ErrExpired):
+			http.Error(w, "this link has expired", http.StatusGone)
+			return
+		case err != nil:
+			http.NotFound(w, r)
+			return
+		}
+		// The token is in the URL: keep it out of Referer headers and search
+		// engines
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("X-Robots-Tag", "noindex")
+		next(w, r, link)
+	}
+}
+
+// ShareHandler serves share links: the page rendered by page at
+// /share/<token>, and the chart's values at /share/<token>/data.json and
+// /share/<token>/data.csv.
+func (s *Server) ShareHandler(page func(http.ResponseWriter, *http.Request, SharedChart)) http.Handler {
+	return s.RequireShare(func(w http.ResponseWriter, r *http.Request, link share.Link) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		_, file, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/share/"), "/")
+		if file != "" && file != "data.json" && file != "data.csv" {
+			http.NotFound(w, r)
+			return
+		}
+
+		chart, err := s.SharedChart(r.Context(), link)
+		if err != nil {
+			http.Error(w, "failed to load results", http.StatusInternalServerError)
+			log.Printf("share: %v", err)
+			return
+		}
+		// Results rarely change once the range is over, but may still be
+		// deleted or arrive late from remote agents
+		w.Header().Set("Cache-Control", "private, max-age=300")
+
+		switch file {
+		case "":
+			page(w, r, chart)
+		case "data.json":
+			writeJSON(w, http.StatusOK, chart)
+		case "data.csv":
+			filename := fmt.Sprintf("speedtest-%s-%s-%s.csv", link.Metric,
+				link.From.In(s.location()).Format("20060102"), link.To.In(s.location()).Format("20060102"))
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+			s.writeSharedCSV(w, chart)
+		}
+	})
+}
+
+// SharedChart loads the values a share link grants access to. Only the
+// metric and when each result was measured are included.
+func (s *Server) SharedChart(ctx context.Context, link share.Link) (SharedChart, error) {
+	results, err := s.store.ListResultsPage(ctx, link.From, link.To, storage.ResultFilter{Connection: link.Connection}, 0, 0)
+	if err != nil {
+		return SharedChart{}, err
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Timestamp.Before(results[j].Timestamp)
+	})
+
+	chart := SharedChart{Link: link, Points: []SharedPoint{}}
+	var values []float64
+	for _, r := range results {
+		v := chartMetric(r, link.Metric)
+		if v < 0 {
+			continue
+		}
+		chart.Points = append(chart.Points, SharedPoint{Timestamp: r.Timestamp, Value: v})
+		values = append(values, v)
+	}
+	if len(values) > 0 {
+		stats := calculatePercentiles(values)
+		chart.Stats = &stats
+	}
+	chart.Sparkline = sparklinePoints(values, shareChartWidth, shareChartHeight)
+	return chart, nil
+}
+
+// chartMetric returns a result's value of one of shareMetrics.
+func chartMetric(r model.SpeedtestResult, metric string) float64 {
+	switch metric {
+	case "download":
+		return r.DownloadMbps
+	case "upload":
+		return r.UploadMbps
+	case "ping":
+		return r.PingMs
+	case "jitter":
+		return r.JitterMs
+	}
+	return -1
+}
+
+func (s *Server) writeSharedCSV(w http.ResponseWriter, chart SharedChart) {
+	unit := "ms"
+	if chart.Bandwidth() {
+		unit = "mbps"
+	}
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"timestamp", chart.Link.Metric + "_" + unit})
+	loc := s.location()
+	for _, p := range chart.Points {
+		_ = cw.Write([]string{p.Timestamp.In(loc).Format(time.RFC3339), fmt.Sprintf("%.2f", p.Value)})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"net/http"
+
+	"speedplane/model"
+	"speedplane/signing"
+)
+
+// maxVerifyBody limits the size of exports accepted by /api/verify.
+const maxVerifyBody = 32 << 20
+
+type verifyResponse struct {
+	Valid    int             `json:"valid"`
+	Invalid  int             `json:"invalid"`
+	Unsigned int             `json:"unsigned"`
+	Results  []signing.Check `json:"results"`
+}
+
+// SetSigningKey sets the public key results are signed with, enabling
+// /api/signing-key and the verification endpoints.
+func (s *Server) SetSigningKey(key ed25519.PublicKey) {
+	s.signingKey = key
+}
+
+// handleSigningKey serves the public key as PEM, for verifying exports
+// offline with "speedplane verify --key".
+func (s *Server) handleSigningKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.signingKey == nil {
+		http.Error(w, "result signing is not enabled", http.StatusNotFound)
+		return
+	}
+	data, err := signing.EncodePublicKey(s.signingKey)
+	if err != nil {
+		http.Error(w, "failed to encode key", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	_, _ = w.Write(data)
+}
+
+// handleResultVerify checks the signature of a stored result.
+func (s *Server) handleResultVerify(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.signingKey == nil {
+		http.Error(w, "result signing is not enabled", http.StatusNotFound)
+		return
+	}
+	res, ok := s.loadResult(w, r, id)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, signing.VerifyAll(s.signingKey, []model.SpeedtestResult{*res})[0])
+}
+
+// handleVerify checks the signatures of results in an export posted as the
+// body: a JSON array as from /api/export/history.json, a single result, or
+// JSON Lines.
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.signingKey == nil {
+		http.Error(w, "result signing is not enabled", http.StatusNotFound)
+		return
+	}
+	results, err := signing.ReadResults(http.MaxBytesReader(w, r.Body, maxVerifyBody))
+	if err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	resp := verifyResponse{Results: signing.VerifyAll(s.signingKey, results)}
+	for _, c := range resp.Results {
+		switch c.Status {
+		case signing.StatusValid:
+			resp.Valid++
+		case signing.StatusInvalid:
+			resp.Invalid++
+		default:
+			resp.Unsigned++
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/snapshot"
+)
+
+// SetSnapshots sets the exporter behind /api/admin/snapshot.
+func (s *Server) SetSnapshots(e *snapshot.Exporter) {
+	s.snapshots = e
+}
+
+// handleAdminSnapshot uploads a snapshot of history to the configured
+// bucket and describes it. It takes the range and from/to parameters of
+// /api/history, but defaults to the whole history.
+func (s *Server) handleAdminSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.snapshots == nil {
+		http.Error(w, "snapshots are not configured", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	if q.Get("range") == "" {
+		q.Set("range", "all")
+	}
+	from, to, err := historyRange(q, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snap, err := s.snapshots.Export(r.Context(), from, to)
+	if err != nil {
+		log.Printf("snapshot: %v", err)
+		http.Error(w, "snapshot failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	log.Printf("snapshot: uploaded %d results to %s", snap.Results, snap.Key)
+	writeJSON(w, http.StatusOK, snap)
+}
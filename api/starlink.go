@@ -0,0 +1,52 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/model"
+)
+
+// handleStarlink lists readings of the Starlink dish's status, oldest first.
+// By default it returns the last 24 hours; from/to (RFC3339) change the
+// window.
+func (s *Server) handleStarlink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+
+	readings, err := s.store.ListStarlinkStatus(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, "failed to load starlink status", http.StatusInternalServerError)
+		log.Printf("starlink status: %v", err)
+		return
+	}
+	if readings == nil {
+		readings = []model.StarlinkStatus{}
+	}
+
+	writeJSON(w, http.StatusOK, readings)
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"speedplane/model"
+	"speedplane/storage"
+)
+
+// valueMonth is what a month of service cost per Mbps actually delivered.
+type valueMonth struct {
+	Month           string   `json:"month"` // "YYYY-MM" in the configured timezone
+	Provider        string   `json:"provider"`
+	Price           float64  `json:"price"`
+	Currency        string   `json:"currency,omitempty"`
+	AvgDownloadMbps float64  `json:"avg_download_mbps"`
+	CostPerMbps     *float64 `json:"cost_per_mbps,omitempty"`
+}
+
+// valuePlan compares what a plan cost per advertised and per delivered Mbps
+// over the time it was in effect.
+type valuePlan struct {
+	Provider              string   `json:"provider"`
+	Start                 string   `json:"start"`
+	Price                 float64  `json:"price"`
+	Currency              string   `json:"currency,omitempty"`
+	DownloadMbps          float64  `json:"download_mbps"` // Advertised
+	Count                 int      `json:"count"`
+	AvgDownloadMbps       float64  `json:"avg_download_mbps"`
+	AdvertisedCostPerMbps *float64 `json:"advertised_cost_per_mbps,omitempty"`
+	CostPerMbps           *float64 `json:"cost_per_mbps,omitempty"`
+}
+
+type statsResponse struct {
+	Connection string       `json:"connection"`
+	From       time.Time    `json:"from"`
+	To         time.Time    `json:"to"`
+	Months     []valueMonth `json:"months"`
+	Plans      []valuePlan  `json:"plans"`
+}
+
+// costPerMbps returns a monthly price divided by a speed, or nil without a
+// price or speed.
+func costPerMbps(price, mbps float64) *float64 {
+	if price <= 0 || mbps <= 0 {
+		return nil
+	}
+	v := math.Round(price/mbps*1000) / 1000
+	return &v
+}
+
+// handleStats reports value for money: the cost per delivered Mbps of
+// average download for each month and each plan, from the plans' prices. It
+// covers the time since the first plan, or the window given by from/to
+// (RFC3339).
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	conn, err := connectionParam(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	history := s.planHistory(conn)
+	to := time.Now()
+	from := to.AddDate(-1, 0, 0)
+	if len(history) > 0 {
+		from = history[0].From
+	}
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+
+	results, err := s.store.ListResultsPage(r.Context(), from, to, storage.ResultFilter{Connection: conn}, 0, 0)
+	if err != nil {
+		http.Error(w, "failed to load results", http.StatusInternalServerError)
+		log.Printf("stats: %v", err)
+		return
+	}
+
+	if conn == "" {
+		conn = model.DefaultConnection
+	}
+	resp := statsResponse{
+		Connection: conn,
+		From:       from.UTC(),
+		To:         to.UTC().Truncate(time.Second),
+		Months:     []valueMonth{},
+		Plans:      []valuePlan{},
+	}
+	report := buildPlanReport(history, results, defaultPlanThreshold, s.location())
+	for _, row := range report.Rows {
+		resp.Months = append(resp.Months, valueMonth{
+			Month:           row.Month,
+			Provider:        row.Plan.Provider,
+			Price:           row.Plan.Price,
+			Currency:        row.Plan.Currency,
+			AvgDownloadMbps: row.AvgDownloadMbps,
+			CostPerMbps:     row.CostPerMbps,
+		})
+	}
+
+	// Whole plans, in the order they took effect
+	sums := make(map[string]float64, len(history))
+	counts := make(map[string]int, len(history))
+	for _, r := range results {
+		if p := model.PlanAt(history, r.Timestamp); p != nil {
+			sums[p.Start] += r.DownloadMbps
+			counts[p.Start]++
+		}
+	}
+	for _, p := range history {
+		n := counts[p.Start]
+		if n == 0 {
+			continue
+		}
+		avg := sums[p.Start] / float64(n)
+		resp.Plans = append(resp.Plans, valuePlan{
+			Provider:              p.Provider,
+			Start:                 p.Start,
+			Price:                 p.Price,
+			Currency:              p.Currency,
+			DownloadMbps:          p.DownloadMbps,
+			Count:                 n,
+			AvgDownloadMbps:       math.Round(avg*100) / 100,
+			AdvertisedCostPerMbps: costPerMbps(p.Price, p.DownloadMbps),
+			CostPerMbps:           costPerMbps(p.Price, avg),
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/model"
+)
+
+// Connection states reported by the status page.
+const (
+	StatusUp      = "up"
+	StatusDown    = "down"
+	StatusUnknown = "unknown"
+)
+
+// maxStatusOutages limits how many recent outages the status page lists.
+const maxStatusOutages = 10
+
+// statusCacheAge is how long clients and proxies may cache the status page.
+const statusCacheAge = time.Minute
+
+// PublicResult is a speedtest result without the fields that identify the
+// connection (external IP, raw engine output), safe to show publicly.
+type PublicResult struct {
+	Timestamp     time.Time `json:"timestamp"`
+	DownloadMbps  float64   `json:"download_mbps"`
+	UploadMbps    float64   `json:"upload_mbps"`
+	PingMs        float64   `json:"ping_ms"`
+	JitterMs      float64   `json:"jitter_ms"`
+	PacketLossPct float64   `json:"packet_loss_pct"`
+	ISP           string    `json:"isp,omitempty"`
+	ServerName    string    `json:"server_name,omitempty"`
+	ServerCountry string    `json:"server_country,omitempty"`
+}
+
+// Outage is a period in which consecutive speedtests failed to move data.
+// An ongoing outage's duration runs up to the latest failed result.
+type Outage struct {
+	Start    time.Time  `json:"start"`
+	End      *time.Time `json:"end,omitempty"` // nil while ongoing
+	Duration string     `json:"duration"`
+	Ongoing  bool       `json:"ongoing"`
+}
+
+// StatusSummary is the data behind /status and /api/status. It only changes
+// when a new result is saved, so it can be cached and revalidated by ETag.
+type StatusSummary struct {
+	State       string        `json:"state"`
+	Latest      *PublicResult `json:"latest,omitempty"`
+	Averages30d aggregate     `json:"averages_30d"`
+	Outages     []Outage      `json:"outages"`
+}
+
+// Status builds the public status summary from the last 30 days of results
+// and failed runs.
+func (s *Server) Status(ctx context.Context) (StatusSummary, error) {
+	now := time.Now().In(s.location())
+	from := now.AddDate(0, 0, -30)
+	results, err := s.store.ListResults(ctx, from, now)
+	if err != nil {
+		return StatusSummary{}, err
+	}
+	failures, err := s.store.ListRunFailures(ctx, from, now, "")
+	if err != nil {
+		return StatusSummary{}, err
+	}
+	events := connectionEvents(results, failures, s.downtime)
+
+	summary := StatusSummary{
+		State:       StatusUnknown,
+		Averages30d: computeAggregates(results, now)["last30days"],
+		Outages:     findOutages(events),
+	}
+	if len(results) > 0 {
+		summary.Latest = publicResult(results[len(results)-1])
+	}
+	if len(events) > 0 {
+		summary.State = StatusUp
+		if events[len(events)-1].down {
+			summary.State = StatusDown
+		}
+	}
+	return summary, nil
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	summary, err := s.Status(r.Context())
+	if err != nil {
+		http.Error(w, "failed to load status", http.StatusInternalServerError)
+		log.Printf("status: %v", err)
+		return
+	}
+
+	body, err := json.Marshal(summary)
+	if err != nil {
+		http.Error(w, "failed to encode status", http.StatusInternalServerError)
+		return
+	}
+	WriteCacheable(w, r, "application/json", statusCacheAge, body)
+}
+
+func publicResult(r model.SpeedtestResult) *PublicResult {
+	return &PublicResult{
+		Timestamp:     r.Timestamp,
+		DownloadMbps:  r.DownloadMbps,
+		UploadMbps:    r.UploadMbps,
+		PingMs:        r.PingMs,
+		JitterMs:      r.JitterMs,
+		PacketLossPct: r.PacketLossPct,
+		ISP:           r.ISP,
+		ServerName:    r.ServerName,
+		ServerCountry: r.ServerCountry,
+	}
+}
+
+// resultFailed reports whether a result shows the connection as down: no
+// throughput in either direction or total packet loss.
+func resultFailed(r model.SpeedtestResult) bool {
+	return r.DownloadMbps <= 0 || r.UploadMbps <= 0 || r.PacketLossPct >= 100
+}
+
+// findOutages returns the most recent outages in events, newest first.
+func findOutages(events []connEvent) []Outage {
+	outages := outagePeriods(events)
+
+	// Most recent first
+	for i, j := 0, len(outages)-1; i < j; i, j = i+1, j-1 {
+		outages[i], outages[j] = outages[j], outages[i]
+	}
+	if len(outages) > maxStatusOutages {
+		outages = outages[:maxStatusOutages]
+	}
+	if outages == nil {
+		outages = []Outage{}
+	}
+	return outages
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"speedplane/model"
+	"speedplane/scheduler"
+)
+
+// minTriggerTokenLength keeps trigger URLs from being guessable.
+const minTriggerTokenLength = 16
+
+// Trigger is a tokenized URL that starts a test when POSTed to.
+type Trigger struct {
+	Name  string
+	Token string
+	Tags  []string // Attached to every result the trigger starts
+}
+
+// SetTriggers sets the tokens accepted by /api/triggers/{token}/run. Each
+// token must be unique and at least 16 characters long.
+func (s *Server) SetTriggers(triggers []Trigger) error {
+	seen := make(map[string]bool, len(triggers))
+	for _, t := range triggers {
+		if len(t.Token) < minTriggerTokenLength {
+			return fmt.Errorf("trigger %q: token must be at least %d characters", t.Name, minTriggerTokenLength)
+		}
+		if strings.ContainsAny(t.Token, "/?#") {
+			return fmt.Errorf("trigger %q: token must not contain '/', '?' or '#'", t.Name)
+		}
+		if seen[t.Token] {
+			return fmt.Errorf("trigger %q: token is used by another trigger", t.Name)
+		}
+		seen[t.Token] = true
+		for _, tag := range t.Tags {
+			if err := model.ValidateTag(tag); err != nil {
+				return fmt.Errorf("trigger %q: %w", t.Name, err)
+			}
+		}
+	}
+	s.triggers = append([]Trigger(nil), triggers...)
+	return nil
+}
+
+// findTrigger returns the trigger with the given token, comparing in
+// constant time.
+func (s *Server) findTrigger(token string) (Trigger, bool) {
+	var found Trigger
+	ok := false
+	for _, t := range s.triggers {
+		if tokenMatches(token, t.Token) {
+			found, ok = t, true
+		}
+	}
+	return found, ok
+}
+
+// handleTrigger starts a test for POST /api/triggers/{token}/run and returns
+// right away; the result is saved like a scheduled one. Optional tag
+// parameters are attached to the result along with the trigger's own tags,
+// and an optional connection parameter selects the connection to test.
+func (s *Server) handleTrigger(w http.ResponseWriter, r *http.Request) {
+	token, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/triggers/"), "/")
+	trigger, ok := s.findTrigger(token)
+	if !ok || action != "run" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	tags := append([]string{}, trigger.Tags...)
+	for _, tag := range r.URL.Query()["tag"] {
+		if err := model.ValidateTag(tag); err != nil {
+			http.Error(w, "invalid tag: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	conn, ok := s.connection(r.URL.Query().Get("connection"))
+	if !ok {
+		http.Error(w, "unknown connection", http.StatusBadRequest)
+		return
+	}
+
+	if s.isShuttingDown() {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if err := s.sched.RunNow(conn, tags); err != nil {
+		switch {
+		case errors.Is(err, scheduler.ErrRunInProgress):
+			http.Error(w, "a triggered test is already running", http.StatusConflict)
+		case errors.Is(err, scheduler.ErrDraining):
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		case errors.Is(err, scheduler.ErrPaused):
+			http.Error(w, "paused for maintenance", http.StatusServiceUnavailable)
+		default:
+			http.Error(w, "failed to start speedtest", http.StatusInternalServerError)
+		}
+		return
+	}
+	log.Printf("trigger %q started a speedtest (tags %v)", trigger.Name, tags)
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":  "started",
+		"trigger": trigger.Name,
+		"tags":    tags,
+	})
+}
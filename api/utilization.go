@@ -0,0 +1,57 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"speedplane/model"
+)
+
+// handleUtilization lists WAN utilization samples read from the router's
+// counters, oldest first. By default it returns the last 24 hours for all
+// connections; from/to (RFC3339) and connection narrow it down.
+func (s *Server) handleUtilization(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	conn, err := connectionParam(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	samples, err := s.store.ListWANUtilization(r.Context(), from, to, conn)
+	if err != nil {
+		http.Error(w, "failed to load utilization", http.StatusInternalServerError)
+		log.Printf("wan utilization: %v", err)
+		return
+	}
+	if samples == nil {
+		samples = []model.WANUtilization{}
+	}
+
+	writeJSON(w, http.StatusOK, samples)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+
+	"speedplane/update"
+)
+
+// SetUpdates sets the update checker behind /api/version.
+func (s *Server) SetUpdates(c *update.Checker) {
+	s.updates = c
+}
+
+// handleVersion reports the running version and, once an update check has
+// succeeded, the latest release and whether it is newer.
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.updates == nil {
+		http.Error(w, "version is not available", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.updates.Status())
+}
+
+// BroadcastUpdateAvailable tells dashboards that a newer release exists, so
+// they can show a notice.
+func (s *Server) BroadcastUpdateAvailable(rel update.Release) {
+	s.wsManager.Broadcast(map[string]interface{}{
+		"type":    "update-available",
+		"version": s.updates.Status().Version,
+		"latest":  rel.Version,
+		"url":     rel.URL,
+	})
+}
@@ -2,14 +2,16 @@ package api
 
 import (
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 // connWithMutex wraps a WebSocket connection with its own mutex for thread-safe writes.
 type connWithMutex struct {
-	conn *websocket.Conn
-	mu   sync.Mutex
+	conn     *websocket.Conn
+	mu       sync.Mutex
+	readOnly bool // Only gets publicEvents
 }
 
 // WSConnectionManager manages WebSocket connections for broadcasting.
@@ -25,12 +27,14 @@ func NewWSConnectionManager() *WSConnectionManager {
 	}
 }
 
-// Add adds a connection to the manager.
-func (m *WSConnectionManager) Add(conn *websocket.Conn) {
+// Add adds a connection to the manager. Read-only connections, those of
+// visitors to a public dashboard, are only sent publicEvents.
+func (m *WSConnectionManager) Add(conn *websocket.Conn, readOnly bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.connections[conn] = &connWithMutex{
-		conn: conn,
+		conn:     conn,
+		readOnly: readOnly,
 	}
 }
 
@@ -41,6 +45,13 @@ func (m *WSConnectionManager) Remove(conn *websocket.Conn) {
 	delete(m.connections, conn)
 }
 
+// Count returns the number of connected clients.
+func (m *WSConnectionManager) Count() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.connections)
+}
+
 // Broadcast sends a message to all connected clients.
 func (m *WSConnectionManager) Broadcast(message map[string]interface{}) {
 	m.mu.RLock()
@@ -51,8 +62,13 @@ func (m *WSConnectionManager) Broadcast(message map[string]interface{}) {
 	}
 	m.mu.RUnlock()
 
+	public := publicEvent(message)
+
 	// Now iterate and write to each connection (without holding the main lock)
 	for _, cwm := range conns {
+		if cwm.readOnly && !public {
+			continue
+		}
 		cwm.mu.Lock()
 		err := cwm.conn.WriteJSON(message)
 		cwm.mu.Unlock()
@@ -79,3 +95,22 @@ func (m *WSConnectionManager) WriteJSON(conn *websocket.Conn, message interface{
 	defer cwm.mu.Unlock()
 	return cwm.conn.WriteJSON(message)
 }
+
+// CloseAll sends a close frame to every client and closes the connections.
+func (m *WSConnectionManager) CloseAll(reason string) {
+	m.mu.Lock()
+	conns := make([]*connWithMutex, 0, len(m.connections))
+	for _, cwm := range m.connections {
+		conns = append(conns, cwm)
+	}
+	m.connections = make(map[*websocket.Conn]*connWithMutex)
+	m.mu.Unlock()
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	for _, cwm := range conns {
+		cwm.mu.Lock()
+		_ = cwm.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		_ = cwm.conn.Close()
+		cwm.mu.Unlock()
+	}
+}
@@ -0,0 +1,55 @@
+package speedplane
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"time"
+
+	"speedplane/config"
+	"speedplane/storage"
+)
+
+// archiveEvery is how often the server archives results that have left the
+// retention window.
+const archiveEvery = 24 * time.Hour
+
+// runArchiver applies the retention settings of cfg at startup and then
+// daily, until ctx is cancelled: it trims raw engine output past its
+// retention and, when archiving is enabled, archives results past theirs.
+func runArchiver(ctx context.Context, store *storage.Store, cfg config.ArchiveConfig, dir string) {
+	for {
+		if raw := cfg.RawRetention(); raw > 0 {
+			n, err := store.TrimRawOutput(ctx, time.Now().Add(-raw), cfg.KeepFailedRaw)
+			if err != nil {
+				log.Printf("archive: trim raw output: %v", err)
+			} else if n > 0 {
+				log.Printf("archive: trimmed the raw output of %d results", n)
+			}
+		}
+		if cfg.Enabled {
+			n, err := store.ArchiveResults(ctx, time.Now().Add(-cfg.Retention()), dir)
+			if err != nil {
+				log.Printf("archive: %v", err)
+			} else if n > 0 {
+				log.Printf("archive: moved %d results to %s", n, dir)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(archiveEvery):
+		}
+	}
+}
+
+// WipeData deletes everything a server has recorded: the database's results,
+// probe rounds, failures, rollups and annotations, and the archive files under
+// dataDir.
+func WipeData(ctx context.Context, store *storage.Store, dataDir string) error {
+	if err := store.Wipe(ctx); err != nil {
+		return err
+	}
+	return storage.RemoveArchives(filepath.Join(dataDir, "archive"))
+}
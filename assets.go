@@ -0,0 +1,173 @@
+package speedplane
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// immutableCacheControl is sent for asset URLs carrying the asset's content
+// hash (?v=), which change whenever the asset does.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// assetEncodings are the precompressed variants looked for next to each
+// asset, by file extension, in order of preference.
+var assetEncodings = []struct{ coding, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// asset is a frontend file embedded in the binary, with the precompressed
+// variants built next to it (main.js.br, main.js.gz).
+type asset struct {
+	contentType string
+	hash        string            // Hex digest of the uncompressed content
+	variants    map[string][]byte // By content coding, "" for uncompressed
+}
+
+// loadAsset reads name and its precompressed variants from fsys. It returns
+// nil, without an error, when name doesn't exist.
+func loadAsset(fsys fs.FS, name, contentType string) (*asset, error) {
+	body, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	a := newAsset(body, contentType)
+	for _, e := range assetEncodings {
+		encoded, err := fs.ReadFile(fsys, name+e.ext)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		a.variants[e.coding] = encoded
+	}
+	return a, nil
+}
+
+// newAsset returns an asset serving body, without precompressed variants.
+func newAsset(body []byte, contentType string) *asset {
+	sum := sha256.Sum256(body)
+	return &asset{
+		contentType: contentType,
+		hash:        hex.EncodeToString(sum[:8]),
+		variants:    map[string][]byte{"": body},
+	}
+}
+
+// version returns the asset's content hash, for ?v= in the URLs the pages
+// load it from. A nil asset has no version.
+func (a *asset) version() string {
+	if a == nil {
+		return ""
+	}
+	return a.hash
+}
+
+// ServeHTTP serves the asset, precompressed when the client accepts it. URLs
+// with the current ?v= are cached for good; others are revalidated by ETag.
+func (a *asset) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	coding := ""
+	if len(a.variants) > 1 {
+		w.Header().Add("Vary", "Accept-Encoding")
+		accept := r.Header.Get("Accept-Encoding")
+		for _, e := range assetEncodings {
+			if _, ok := a.variants[e.coding]; ok && acceptsEncoding(accept, e.coding) {
+				coding = e.coding
+				break
+			}
+		}
+	}
+
+	// Each encoding is a different representation, so it gets its own ETag
+	etag := `"` + a.hash + `"`
+	if coding != "" {
+		etag = `"` + a.hash + "-" + coding + `"`
+	}
+	w.Header().Set("ETag", etag)
+	if r.URL.Query().Get("v") == a.hash {
+		w.Header().Set("Cache-Control", immutableCacheControl)
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body := a.variants[coding]
+	w.Header().Set("Content-Type", a.contentType)
+	if coding != "" {
+		w.Header().Set("Content-Encoding", coding)
+	}
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header value allows
+// coding, named or through "*", with a non-zero quality.
+func acceptsEncoding(header, coding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.TrimSpace(name)
+		if !strings.EqualFold(name, coding) && name != "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if name != "*" {
+			return q > 0
+		}
+		wildcard = q > 0
+	}
+	return wildcard
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// isClientRoute reports whether a request path that no other handler serves
+// is a dashboard view, routed by the frontend, rather than a missing file or
+// API endpoint.
+func isClientRoute(p string) bool {
+	if p == "/api" || strings.HasPrefix(p, "/api/") || strings.HasPrefix(p, "/static/") {
+		return false
+	}
+	return !strings.Contains(path.Base(p), ".")
+}
@@ -0,0 +1,205 @@
+// Package benchmark compares results against aggregated percentiles for the
+// same ISP and region from an opt-in benchmark service, and optionally
+// contributes anonymized results to it.
+//
+// A compatible service implements two endpoints below its base URL:
+//
+//	GET  /v1/percentiles?isp=...&country=...  returns a Distribution
+//	POST /v1/results                          accepts a Sample
+package benchmark
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"speedplane/model"
+)
+
+// DefaultCacheFor is how long a Client reuses a fetched distribution.
+const DefaultCacheFor = 6 * time.Hour
+
+// Metrics for which lower values are better, so their rank is inverted.
+var lowerIsBetter = map[string]bool{
+	"ping_ms":         true,
+	"jitter_ms":       true,
+	"packet_loss_pct": true,
+}
+
+// Distribution is the service's aggregate of results for one ISP and region.
+type Distribution struct {
+	ISP     string `json:"isp"`
+	Country string `json:"country"`
+	Samples int    `json:"samples"`
+	// Metrics maps a metric, e.g. "download_mbps", to the value at each
+	// percentile, keyed "10", "50", "90" and so on.
+	Metrics map[string]map[string]float64 `json:"metrics"`
+}
+
+// Rank returns the percentile, 0-100, that value falls in for metric, where
+// higher is always better: 35 means better than 35% of results. Values are
+// interpolated between the reported percentiles and clamped to their range.
+// ok is false when the service reports no data for the metric.
+func (d *Distribution) Rank(metric string, value float64) (rank float64, ok bool) {
+	type point struct{ pct, value float64 }
+	var points []point
+	for k, v := range d.Metrics[metric] {
+		pct, err := strconv.ParseFloat(k, 64)
+		if err != nil || pct < 0 || pct > 100 {
+			continue
+		}
+		points = append(points, point{pct, v})
+	}
+	if len(points) == 0 {
+		return 0, false
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].pct < points[j].pct })
+
+	switch {
+	case value <= points[0].value:
+		rank = points[0].pct
+	case value >= points[len(points)-1].value:
+		rank = points[len(points)-1].pct
+	default:
+		for i := 1; i < len(points); i++ {
+			lo, hi := points[i-1], points[i]
+			if value > hi.value {
+				continue
+			}
+			if hi.value == lo.value {
+				rank = hi.pct
+			} else {
+				rank = lo.pct + (value-lo.value)/(hi.value-lo.value)*(hi.pct-lo.pct)
+			}
+			break
+		}
+	}
+	if lowerIsBetter[metric] {
+		rank = 100 - rank
+	}
+	return rank, true
+}
+
+// Sample is the anonymized part of a result shared with the service: no IP
+// address, server or result ID, and the time only to the hour.
+type Sample struct {
+	ISP           string    `json:"isp"`
+	Country       string    `json:"country"`
+	Hour          time.Time `json:"hour"`
+	DownloadMbps  float64   `json:"download_mbps"`
+	UploadMbps    float64   `json:"upload_mbps"`
+	PingMs        float64   `json:"ping_ms"`
+	JitterMs      float64   `json:"jitter_ms"`
+	PacketLossPct float64   `json:"packet_loss_pct"`
+}
+
+// NewSample anonymizes a result. The test server's country stands in for
+// the region, as the nearest server is usually in it.
+func NewSample(r model.SpeedtestResult) Sample {
+	return Sample{
+		ISP:           r.ISP,
+		Country:       r.ServerCountry,
+		Hour:          r.Timestamp.UTC().Truncate(time.Hour),
+		DownloadMbps:  r.DownloadMbps,
+		UploadMbps:    r.UploadMbps,
+		PingMs:        r.PingMs,
+		JitterMs:      r.JitterMs,
+		PacketLossPct: r.PacketLossPct,
+	}
+}
+
+type cacheEntry struct {
+	dist    *Distribution
+	fetched time.Time
+}
+
+// Client talks to a benchmark service.
+type Client struct {
+	URL      string // Base URL of the service
+	HTTP     *http.Client
+	CacheFor time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry // By ISP and country
+}
+
+// NewClient creates a Client for the service at baseURL with a 10 second
+// request timeout.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		URL:      strings.TrimRight(baseURL, "/"),
+		HTTP:     &http.Client{Timeout: 10 * time.Second},
+		CacheFor: DefaultCacheFor,
+		cache:    make(map[string]cacheEntry),
+	}
+}
+
+// Distribution returns the percentiles for an ISP and country, from the
+// cache when they were fetched within CacheFor.
+func (c *Client) Distribution(ctx context.Context, isp, country string) (*Distribution, error) {
+	key := isp + "\x00" + country
+	c.mu.Lock()
+	entry, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok && time.Since(entry.fetched) < c.CacheFor {
+		return entry.dist, nil
+	}
+
+	q := url.Values{"isp": {isp}, "country": {country}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL+"/v1/percentiles?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "speedplane")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("benchmark: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("benchmark: unexpected status %s", resp.Status)
+	}
+	var dist Distribution
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&dist); err != nil {
+		return nil, fmt.Errorf("benchmark: decode percentiles: %w", err)
+	}
+
+	c.mu.Lock()
+	c.cache[key] = cacheEntry{dist: &dist, fetched: time.Now()}
+	c.mu.Unlock()
+	return &dist, nil
+}
+
+// Submit contributes an anonymized result to the service.
+func (c *Client) Submit(ctx context.Context, r model.SpeedtestResult) error {
+	body, err := json.Marshal(NewSample(r))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+"/v1/results", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "speedplane")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("benchmark: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("benchmark: unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"speedplane/config"
+	"speedplane/storage"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Archive old results to compressed files",
+	Long:  "Move results older than the retention window to gzipped JSON Lines files under {data_dir}/archive, and import them back.",
+}
+
+var archiveRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Archive results older than the retention window now",
+	Long:  "Archive results older than archive.retention_days (default 365) now, whether or not archiving is enabled for the server.",
+	Args:  cobra.NoArgs,
+	RunE:  runArchiveRun,
+	// main prints the error
+	SilenceErrors: true,
+}
+
+var archiveImportCmd = &cobra.Command{
+	Use:   "import FILE...",
+	Short: "Import archived results back into the database",
+	Long:  "Import results from archive files (.jsonl.gz) or plain JSON Lines files. Results that are already stored are skipped.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runArchiveImport,
+	// main prints the error
+	SilenceErrors: true,
+}
+
+func init() {
+	archiveCmd.PersistentFlags().StringVar(&configPath, "config", "", "Config file path (full path with filename, or directory to use default filename 'speedplane.config', default: current directory)")
+	archiveCmd.PersistentFlags().StringVar(&dbPath, "db", "", "Database path (full path with filename, or directory to use default filename 'speedplane.results')")
+	archiveCmd.AddCommand(archiveRunCmd)
+	archiveCmd.AddCommand(archiveImportCmd)
+	rootCmd.AddCommand(archiveCmd)
+}
+
+// openStore opens the database the server would use with the same
+// --config and --db flags.
+func openStore(cmd *cobra.Command) (config.Config, *storage.Store, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return cfg, nil, fmt.Errorf("load config: %w", err)
+	}
+	if cmd.Flags().Changed("db") {
+		cfg.DBPath = dbPath
+	}
+	if cfg.DataDir, err = filepath.Abs(cfg.DataDir); err != nil {
+		return cfg, nil, fmt.Errorf("resolve data dir: %w", err)
+	}
+	store, err := storage.New(cfg.DBPath, cfg.DataDir)
+	if err != nil {
+		return cfg, nil, fmt.Errorf("initialize storage: %w", err)
+	}
+	store.SetQueryTimeout(cfg.QueryDuration())
+	return cfg, store, nil
+}
+
+func runArchiveRun(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	cfg, store, err := openStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	dir := filepath.Join(cfg.DataDir, "archive")
+	n, err := store.ArchiveResults(cmd.Context(), time.Now().Add(-cfg.Archive.Retention()), dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Archived %d results to %s\n", n, dir)
+	return nil
+}
+
+func runArchiveImport(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	_, store, err := openStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	for _, path := range args {
+		n, err := store.ImportArchive(cmd.Context(), path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported %s: %d results\n", path, n)
+	}
+	return nil
+}
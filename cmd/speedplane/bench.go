@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"speedplane"
+	"speedplane/config"
+	"speedplane/demo"
+	"speedplane/storage"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	benchResults     int
+	benchEvery       time.Duration
+	benchIterations  int
+	benchConcurrency int
+	benchDir         string
+)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure database and API performance on this machine",
+	Long: "Seed a temporary database with synthetic results and measure how fast it stores and serves them, " +
+		"to help pick a schedule frequency and retention that small hardware such as a Raspberry Pi Zero keeps up with. " +
+		"The configured database is never touched.",
+}
+
+var benchStorageCmd = &cobra.Command{
+	Use:   "storage",
+	Short: "Measure result inserts and the dashboard's database queries",
+	Long:  "Store --results synthetic results one at a time, as tests do, then time the queries behind the dashboard. Reports the database size per result.",
+	Args:  cobra.NoArgs,
+	RunE:  runBenchStorage,
+	// main prints the error
+	SilenceErrors: true,
+}
+
+var benchAPICmd = &cobra.Command{
+	Use:   "api",
+	Short: "Measure the dashboard's API requests",
+	Long: "Seed --results synthetic results, then serve the dashboard's API requests in process, --concurrency at a time, bypassing the response cache. " +
+		"Reports requests per second and p50/p99 handler latencies.",
+	Args: cobra.NoArgs,
+	RunE: runBenchAPI,
+	// main prints the error
+	SilenceErrors: true,
+}
+
+func init() {
+	benchCmd.PersistentFlags().StringVar(&configPath, "config", "", "Config file path (full path with filename, or directory to use default filename 'speedplane.config', default: current directory)")
+	benchCmd.PersistentFlags().IntVar(&benchResults, "results", 20000, "Synthetic results to seed")
+	benchCmd.PersistentFlags().DurationVar(&benchEvery, "every", time.Hour, "Time between seeded results, as the schedule you plan would run tests")
+	benchCmd.PersistentFlags().IntVar(&benchIterations, "iterations", 50, "Times each query or request is repeated")
+	benchCmd.PersistentFlags().StringVar(&benchDir, "dir", "", "Directory for the temporary database (default: the data directory, so its disk is measured)")
+	benchAPICmd.Flags().IntVar(&benchConcurrency, "concurrency", 4, "Requests served at once")
+	benchCmd.AddCommand(benchStorageCmd)
+	benchCmd.AddCommand(benchAPICmd)
+	rootCmd.AddCommand(benchCmd)
+}
+
+// benchStats summarises the durations of repeated calls.
+type benchStats struct {
+	calls    int
+	elapsed  time.Duration // Wall time, less than the sum of the calls when concurrent
+	p50, p99 time.Duration
+}
+
+func (st benchStats) perSecond() float64 {
+	if st.elapsed <= 0 {
+		return 0
+	}
+	return float64(st.calls) / st.elapsed.Seconds()
+}
+
+func newBenchStats(durations []time.Duration, elapsed time.Duration) benchStats {
+	slices.Sort(durations)
+	return benchStats{
+		calls:   len(durations),
+		elapsed: elapsed,
+		p50:     percentile(durations, 50),
+		p99:     percentile(durations, 99),
+	}
+}
+
+// percentile returns the p-th percentile of sorted by the nearest-rank
+// method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// measure calls fn n times from concurrency goroutines, stopping at the
+// first error.
+func measure(ctx context.Context, n, concurrency int, fn func(i int) error) (benchStats, error) {
+	durations := make([]time.Duration, n)
+	next := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	start := time.Now()
+	for range max(concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				t := time.Now()
+				if err := fn(i); err != nil {
+					errOnce.Do(func() { firstErr = err })
+					cancel()
+					return
+				}
+				durations[i] = time.Since(t)
+			}
+		}()
+	}
+feed:
+	for i := range n {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		return benchStats{}, firstErr
+	}
+	return newBenchStats(durations, time.Since(start)), nil
+}
+
+// benchSetup loads the config and creates the temporary directory the
+// benchmark's database goes in, returning its path.
+func benchSetup() (config.Config, string, error) {
+	if benchResults < 1 || benchIterations < 1 || benchEvery <= 0 {
+		return config.Config{}, "", fmt.Errorf("--results, --iterations and --every must be positive")
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return cfg, "", fmt.Errorf("load config: %w", err)
+	}
+	dir := benchDir
+	if dir == "" {
+		dir = cfg.DataDir
+	}
+	tmp, err := os.MkdirTemp(dir, "speedplane-bench-")
+	if err != nil {
+		return cfg, "", fmt.Errorf("create temporary directory: %w", err)
+	}
+	return cfg, tmp, nil
+}
+
+// seedBench stores benchResults synthetic results, benchEvery apart up to
+// now, one at a time as tests do, and returns how long each insert took.
+func seedBench(ctx context.Context, store *storage.Store) (benchStats, error) {
+	gen := demo.NewGenerator(1)
+	start := time.Now().Add(-time.Duration(benchResults-1) * benchEvery)
+	return measure(ctx, benchResults, 1, func(i int) error {
+		return store.SaveResult(ctx, gen.Result(start.Add(time.Duration(i)*benchEvery)))
+	})
+}
+
+func printSeeded(st benchStats) {
+	span := time.Duration(benchResults-1) * benchEvery
+	fmt.Printf("Seeded %d results, one every %s (%.0f days), in %s\n", benchResults, benchEvery, span.Hours()/24, st.elapsed.Round(time.Millisecond))
+}
+
+func printStats(w io.Writer, name string, st benchStats) {
+	fmt.Fprintf(w, "%s\t%.0f/s\t%s\t%s\n", name, st.perSecond(), formatLatency(st.p50), formatLatency(st.p99))
+}
+
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+}
+
+func runBenchStorage(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	ctx := cmd.Context()
+	cfg, tmp, err := benchSetup()
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	loc, err := cfg.Location()
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(tmp, "speedplane.results")
+	store, err := storage.New(path, tmp)
+	if err != nil {
+		return fmt.Errorf("initialize storage: %w", err)
+	}
+	defer store.Close()
+
+	inserts, err := seedBench(ctx, store)
+	if err != nil {
+		return fmt.Errorf("seed: %w", err)
+	}
+	printSeeded(inserts)
+
+	now := time.Now()
+	all := storage.ResultFilter{}
+	queries := []struct {
+		name string
+		fn   func() error
+	}{
+		{"latest result", func() error { _, err := store.LatestResult(ctx); return err }},
+		{"count, 30 days", func() error { _, err := store.CountResults(ctx, now.AddDate(0, 0, -30), now, all); return err }},
+		{"list, 24 hours", func() error { _, err := store.ListResultsPage(ctx, now.AddDate(0, 0, -1), now, all, 0, 0); return err }},
+		{"list, 7 days", func() error { _, err := store.ListResultsPage(ctx, now.AddDate(0, 0, -7), now, all, 0, 0); return err }},
+		{"list, 30 days", func() error { _, err := store.ListResultsPage(ctx, now.AddDate(0, 0, -30), now, all, 0, 0); return err }},
+		{"history page of 50", func() error { _, err := store.ListResultsPage(ctx, time.Time{}, now, all, 50, 0); return err }},
+		{"daily medians, all", func() error {
+			q := storage.BucketQuery{Metric: "download", Agg: storage.AggMedian, Interval: 24 * time.Hour, Location: loc}
+			_, err := store.BucketResults(ctx, time.Time{}, now, all, q)
+			return err
+		}},
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\trate\tp50\tp99")
+	printStats(w, "insert", inserts)
+	for _, q := range queries {
+		st, err := measure(ctx, benchIterations, 1, func(int) error { return q.fn() })
+		if err != nil {
+			return fmt.Errorf("%s: %w", q.name, err)
+		}
+		printStats(w, q.name, st)
+	}
+	w.Flush()
+
+	// Closing checkpoints the write-ahead log, so the file holds everything
+	if err := store.Close(); err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	perResult := float64(info.Size()) / float64(benchResults)
+	perYear := perResult * float64(365*24*time.Hour/benchEvery)
+	fmt.Printf("Database: %.1f MiB, %.0f bytes per result; a year of tests every %s takes about %.1f MiB\n",
+		float64(info.Size())/(1<<20), perResult, benchEvery, perYear/(1<<20))
+	return nil
+}
+
+func runBenchAPI(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	ctx := cmd.Context()
+	cfg, tmp, err := benchSetup()
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "speedplane.results")
+	store, err := storage.New(path, tmp)
+	if err != nil {
+		return fmt.Errorf("initialize storage: %w", err)
+	}
+	inserts, err := seedBench(ctx, store)
+	store.Close()
+	if err != nil {
+		return fmt.Errorf("seed: %w", err)
+	}
+	printSeeded(inserts)
+
+	// Only settings that change what the dashboard's requests cost carry
+	// over. The config is saved so first-run setup isn't offered.
+	bc := config.Default()
+	bc.DataDir, bc.DBPath = tmp, path
+	bc.Timezone, bc.Locale, bc.Units = cfg.Timezone, cfg.Locale, cfg.Units
+	bc.Connections, bc.Plans = cfg.Connections, cfg.Plans
+	if err := config.Save(bc); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+
+	// Demo mode keeps the server from reaching out to anything; the
+	// history is already there, so it seeds none of its own
+	log.SetOutput(io.Discard)
+	srv, err := speedplane.New(bc, speedplane.Options{Demo: true})
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+	handler := srv.Handler()
+
+	requests := []struct{ name, url string }{
+		{"latest", "/api/latest"},
+		{"summary", "/api/summary"},
+		{"chart, 24 hours", "/api/chart-data?range=24h&metric=download"},
+		{"chart, 7 days", "/api/chart-data?range=7d&metric=download"},
+		{"chart, 30 days", "/api/chart-data?range=30d&metric=download"},
+		{"daily medians, all", "/api/chart-data/buckets?metric=download&interval=1d&agg=median&range=all"},
+		{"history page of 50", "/api/history?range=30d&limit=50"},
+		{"bootstrap", "/api/bootstrap"},
+		{"index page", "/"},
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%d at once\trate\tp50\tp99\n", benchConcurrency)
+	for _, req := range requests {
+		st, err := measure(ctx, benchIterations, benchConcurrency, func(i int) error {
+			// A parameter of its own keeps each request out of the response cache
+			sep := "?"
+			if strings.Contains(req.url, "?") {
+				sep = "&"
+			}
+			r := httptest.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s%sbench=%d", req.url, sep, i), nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			if rec.Code != http.StatusOK {
+				return fmt.Errorf("status %d", rec.Code)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", req.name, err)
+		}
+		printStats(w, req.name, st)
+	}
+	return w.Flush()
+}
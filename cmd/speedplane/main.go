@@ -2,44 +2,34 @@ package main
 
 import (
 	"context"
-	"embed"
 	"fmt"
-	"html/template"
-	"io/fs"
 	"log"
-	"net"
-	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"os/user"
 	"path/filepath"
-	"speedplane/api"
-	"speedplane/config"
-	"speedplane/model"
-	"speedplane/scheduler"
-	"speedplane/speedtest"
-	"speedplane/storage"
-	"speedplane/theme"
 	"syscall"
-	"time"
+
+	"speedplane"
+	"speedplane/config"
 
 	"github.com/spf13/cobra"
 )
 
-//go:embed templates
-var templatesFS embed.FS
-
-//go:embed web/dist
-var staticFS embed.FS
-
 var (
-	configPath string
-	dbPath     string
-	listen     string
-	listenPort int
-	public     bool
-	appVersion = "1.1.39"
+	configPath  string
+	dbPath      string
+	listen      string
+	listenPort  int
+	listenAddrs []string
+	socketMode  string
+	adminListen string
+	enablePprof bool
+	themeDev    bool
+	timezone    string
+	public      bool
+	demoMode    bool
 )
 
 var rootCmd = &cobra.Command{
@@ -70,12 +60,19 @@ var configSystemdCmd = &cobra.Command{
 }
 
 func init() {
-	rootCmd.Version = appVersion
+	rootCmd.Version = speedplane.Version
 	rootCmd.Flags().StringVar(&configPath, "config", "", "Config file path (full path with filename, or directory to use default filename 'speedplane.config', default: current directory)")
 	rootCmd.Flags().StringVar(&dbPath, "db", "", "Database path (full path with filename, or directory to use default filename 'speedplane.results')")
 	rootCmd.Flags().StringVar(&listen, "listen", "all", "IP address to listen on (default: all)")
 	rootCmd.Flags().IntVar(&listenPort, "listen-port", 8080, "Port to listen on (default: 8080)")
+	rootCmd.Flags().StringSliceVar(&listenAddrs, "listen-addr", nil, "Additional address to listen on, host:port or unix:/path/to.sock (repeatable)")
+	rootCmd.Flags().StringVar(&socketMode, "socket-mode", "", "Permissions for unix socket listeners in octal (e.g. 0660)")
+	rootCmd.Flags().StringVar(&adminListen, "admin-listen", "", "Separate address for /metrics and /api/admin/* (e.g. 127.0.0.1:9090, default: served on the main listeners)")
+	rootCmd.Flags().BoolVar(&enablePprof, "pprof", false, "Expose /debug/pprof on the admin endpoints")
+	rootCmd.Flags().BoolVar(&themeDev, "theme-dev", false, "Watch the themes directory and reload templates on change")
+	rootCmd.Flags().StringVar(&timezone, "timezone", "", "IANA timezone for day boundaries and daily schedules (e.g. Australia/Brisbane, default: server timezone)")
 	rootCmd.Flags().BoolVar(&public, "public", false, "Enable public dashboard access")
+	rootCmd.Flags().BoolVar(&demoMode, "demo", false, "Serve generated demo history and return synthetic results instead of running real speedtests (uses a temporary database unless --db is given)")
 
 	configGenerateCmd.Flags().StringVar(&configPath, "config", "", "Config file path (full path with filename, or directory to use default filename 'speedplane.config', default: current directory)")
 	configSystemdCmd.Flags().Bool("deploy", false, "Deploy the service file to /etc/systemd/system/ and reload systemd daemon")
@@ -100,207 +97,46 @@ func run(cmd *cobra.Command, args []string) {
 			cfg.ListenAddr = fmt.Sprintf(":%d", listenPort)
 		}
 	}
-	if cmd.Flags().Changed("public") {
-		cfg.PublicDashboard = public
-	}
-	if cmd.Flags().Changed("db") {
-		cfg.DBPath = dbPath
-	}
-
-	// Ensure data directory exists and is absolute
-	dataDirAbs, err := filepath.Abs(cfg.DataDir)
-	if err != nil {
-		log.Fatalf("resolve data dir: %v", err)
-	}
-	cfg.DataDir = dataDirAbs
-
-	store, err := storage.New(cfg.DBPath, cfg.DataDir)
-	if err != nil {
-		log.Fatalf("initialize storage: %v", err)
-	}
-	defer func() {
-		_ = store.Close()
-	}()
-
-	// Load schedules and lastRun from config
-	if cfg.Schedules == nil {
-		cfg.Schedules = []model.Schedule{}
+	if cmd.Flags().Changed("listen-addr") {
+		cfg.ListenAddrs = listenAddrs
 	}
-	if cfg.LastRun == nil {
-		cfg.LastRun = make(map[string]time.Time)
-	}
-
-	runner := speedtest.NewRunner()
-
-	runAndSave := func(ctx context.Context) (*model.SpeedtestResult, error) {
-		res, err := runner.Run(ctx)
-		if err != nil {
-			return nil, err
-		}
-		if err := store.SaveResult(res); err != nil {
-			return nil, err
-		}
-		return res, nil
+	if cmd.Flags().Changed("socket-mode") {
+		cfg.SocketMode = socketMode
 	}
-
-	// Run without saving (for manual runs when SaveManualRuns is false)
-	runWithoutSave := func(ctx context.Context) (*model.SpeedtestResult, error) {
-		return runner.Run(ctx)
+	if cmd.Flags().Changed("admin-listen") {
+		cfg.AdminListenAddr = adminListen
 	}
-
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
-
-	sched := scheduler.New(runAndSave, cfg.Schedules, cfg.LastRun)
-
-	// Save config when schedules or lastRun change
-	saveConfig := func() {
-		cfg.Schedules = sched.Schedules()
-		cfg.LastRun = sched.LastRun()
-		if err := config.Save(cfg); err != nil {
-			log.Printf("failed to save config: %v", err)
-		}
+	if cmd.Flags().Changed("pprof") {
+		cfg.EnablePprof = enablePprof
 	}
-	sched.SetOnUpdate(saveConfig)
-
-	// Initialize theme manager
-	themeManager, err := theme.NewManager(templatesFS)
-	if err != nil {
-		log.Fatalf("initialize theme manager: %v", err)
+	if cmd.Flags().Changed("theme-dev") {
+		cfg.ThemeDevMode = themeDev
 	}
-	themeHandler := theme.NewHandler(themeManager)
-
-	// Load index.html template from static files
-	indexHTML, err := staticFS.ReadFile("web/dist/index.html")
-	if err != nil {
-		log.Fatalf("Failed to read index.html: %v", err)
+	if cmd.Flags().Changed("timezone") {
+		cfg.Timezone = timezone
 	}
-	indexTemplate := template.Must(template.New("index").Parse(string(indexHTML)))
-
-	mux := http.NewServeMux()
-
-	// Create progress-enabled runner that doesn't save (for manual runs when SaveManualRuns is false)
-	runWithProgressWithoutSave := func(ctx context.Context, progress func(stage string, message string)) (*model.SpeedtestResult, error) {
-		return runner.RunWithProgress(ctx, progress)
-	}
-
-	// Getter function for SaveManualRuns preference
-	getSaveManualRuns := func() bool {
-		return cfg.SaveManualRuns
-	}
-
-	// Setter function for SaveManualRuns preference
-	setSaveManualRuns := func(value bool) error {
-		cfg.SaveManualRuns = value
-		return config.Save(cfg)
+	if cmd.Flags().Changed("public") {
+		cfg.PublicDashboard = public
 	}
-
-	apiServer := api.NewServer(store, runWithoutSave, runWithProgressWithoutSave, sched, saveConfig, getSaveManualRuns, setSaveManualRuns)
-
-	// Broadcast when scheduled speedtests complete
-	sched.SetOnComplete(func(result *model.SpeedtestResult) {
-		apiServer.BroadcastSpeedtestComplete(result)
-	})
-
-	apiServer.Register(mux)
-	sched.Start(ctx)
-
-	// Theme API endpoints
-	mux.HandleFunc("/api/theme", themeHandler.HandleTheme)
-	mux.HandleFunc("/api/schemes", themeHandler.HandleSchemes)
-
-	// Index page handler
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/" {
-			http.NotFound(w, r)
-			return
-		}
-
-		defaultTemplate := "speedplane"
-		defaultScheme := "default"
-		templatesList := themeManager.ListTemplates()
-		if len(templatesList) > 0 {
-			defaultTemplate = templatesList[0]
-			if templateInfo := themeManager.GetTemplate(defaultTemplate); templateInfo != nil {
-				for schemeName := range templateInfo.Schemes {
-					defaultScheme = schemeName
-					break
-				}
-			}
-		}
-
-		templateName := defaultTemplate
-		schemeName := defaultScheme
-
-		templateMenuHTML := themeHandler.GenerateTemplateMenuHTML(templateName)
-		schemeMenuHTML := themeHandler.GenerateSchemeMenuHTML(templateName)
-
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		_ = indexTemplate.Execute(w, map[string]any{
-			"Title":            "speedplane",
-			"TemplatesList":    templatesList,
-			"TemplateMenuHTML": template.HTML(templateMenuHTML),
-			"SchemeMenuHTML":   template.HTML(schemeMenuHTML),
-			"CurrentTemplate":  templateName,
-			"CurrentScheme":    schemeName,
-			"AppVersion":       appVersion,
-			"Year":             time.Now().Year(),
-		})
-	})
-
-	// Static files
-	staticContent, err := fs.Sub(staticFS, "web/dist")
-	if err != nil {
-		log.Fatalf("Failed to create static file sub-filesystem: %v", err)
+	if cmd.Flags().Changed("db") {
+		cfg.DBPath = dbPath
 	}
 
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticContent))))
-
-	// Serve JS/CSS files directly
-	mux.HandleFunc("/main.js", func(w http.ResponseWriter, r *http.Request) {
-		content, err := staticFS.ReadFile("web/dist/main.js")
-		if err != nil {
-			http.NotFound(w, r)
-			return
-		}
-		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
-		_, _ = w.Write(content)
-	})
-	mux.HandleFunc("/main.js.map", func(w http.ResponseWriter, r *http.Request) {
-		content, err := staticFS.ReadFile("web/dist/main.js.map")
+	opts := speedplane.Options{Demo: demoMode}
+	if demoMode && !cmd.Flags().Changed("db") {
+		dir, err := os.MkdirTemp("", "speedplane-demo-")
 		if err != nil {
-			http.NotFound(w, r)
-			return
+			log.Fatalf("create demo database: %v", err)
 		}
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		_, _ = w.Write(content)
-	})
-	mux.HandleFunc("/styles.css", func(w http.ResponseWriter, r *http.Request) {
-		// Styles are now loaded via theme API, but keep for backwards compatibility
-		http.NotFound(w, r)
-	})
-
-	srv := &http.Server{
-		Addr:    cfg.ListenAddr,
-		Handler: mux,
+		defer os.RemoveAll(dir)
+		opts.DBPath = dir
 	}
 
-	// Print listening addresses
-	printListeningAddresses(cfg.ListenAddr)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("http server: %v", err)
-		}
-	}()
-
-	<-ctx.Done()
-	log.Println("shutting down...")
-
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer shutdownCancel()
-	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Printf("server shutdown: %v", err)
+	if err := speedplane.Run(ctx, cfg, opts); err != nil {
+		log.Fatal(err)
 	}
 }
 
@@ -454,36 +290,6 @@ WantedBy=multi-user.target
 	}
 }
 
-func printListeningAddresses(addr string) {
-	host, port, err := net.SplitHostPort(addr)
-	if err != nil {
-		log.Printf("listening on http://%s", addr)
-		return
-	}
-
-	if host == "" || host == "0.0.0.0" || host == "::" {
-		// Listening on all interfaces
-		addrs, err := net.InterfaceAddrs()
-		if err == nil {
-			log.Println("listening on:")
-			for _, a := range addrs {
-				if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-					if ipnet.IP.To4() != nil {
-						log.Printf("  http://%s:%s", ipnet.IP.String(), port)
-					}
-				}
-			}
-			// Also show localhost
-			log.Printf("  http://localhost:%s", port)
-			log.Printf("  http://127.0.0.1:%s", port)
-		} else {
-			log.Printf("listening on http://0.0.0.0:%s", port)
-		}
-	} else {
-		log.Printf("listening on http://%s:%s", host, port)
-	}
-}
-
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"speedplane/storage"
+
+	"github.com/spf13/cobra"
+)
+
+// minTimestampStep is the smallest step back in stored timestamps reported
+// as a possible switch from local time to UTC.
+const minTimestampStep = 10 * time.Minute
+
+var (
+	normalizeZone      string
+	normalizeTable     string
+	normalizeBefore    string
+	normalizeBeforeRow int64
+	normalizeYes       bool
+)
+
+var dbNormalizeCmd = &cobra.Command{
+	Use:   "normalize-timestamps",
+	Short: "Find and fix timestamps stored in local time",
+	Long: "Look for rows stored in local time instead of UTC, as by older versions, and convert them to UTC. " +
+		"Without --before or --before-row only reports: rows timestamped in the future, and places where timestamps step back in the order rows were stored, " +
+		"which is where rows stored in a zone east of UTC give way to rows stored in UTC. " +
+		"With either, converts the timestamps of the rows they select from --zone to UTC. Stop the server and back up the database first.",
+	Args: cobra.NoArgs,
+	RunE: runDBNormalize,
+	// main prints the error
+	SilenceErrors: true,
+}
+
+func init() {
+	dbNormalizeCmd.Flags().StringVar(&normalizeZone, "zone", "", "IANA zone the rows were stored in, e.g. Europe/Berlin (default: the configured timezone)")
+	dbNormalizeCmd.Flags().StringVar(&normalizeTable, "table", "", "Table to audit or fix: "+strings.Join(storage.TimestampTables(), ", ")+" (default: audit all; required to fix)")
+	dbNormalizeCmd.Flags().StringVar(&normalizeBefore, "before", "", "Fix rows timestamped before this RFC 3339 time, as stored")
+	dbNormalizeCmd.Flags().Int64Var(&normalizeBeforeRow, "before-row", 0, "Fix rows stored before this row, as reported by the audit")
+	dbNormalizeCmd.Flags().BoolVar(&normalizeYes, "yes", false, "Don't ask for confirmation")
+	dbCmd.AddCommand(dbNormalizeCmd)
+}
+
+func runDBNormalize(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	cfg, store, err := openStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	name := normalizeZone
+	if name == "" {
+		name = cfg.Timezone
+	}
+	if name == "" {
+		return fmt.Errorf("no timezone configured, pass --zone")
+	}
+	zone, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("invalid zone %q: %w", name, err)
+	}
+
+	tables := storage.TimestampTables()
+	if normalizeTable != "" {
+		tables = []string{normalizeTable}
+	}
+	now := time.Now()
+	for _, table := range tables {
+		audit, err := store.AuditTimestamps(cmd.Context(), table, now, minTimestampStep)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d rows, %d in the future\n", audit.Table, audit.Rows, audit.Future)
+		for _, step := range audit.Steps {
+			_, offset := step.Previous.In(zone).Zone()
+			fmt.Printf("  row %d steps back %s, from %s to %s (%s is UTC%+g)\n", step.Row, step.Back(),
+				step.Previous.Format(time.RFC3339), step.At.Format(time.RFC3339), zone, float64(offset)/3600)
+		}
+	}
+
+	var sel storage.TimestampSelection
+	switch {
+	case normalizeBefore != "" && normalizeBeforeRow > 0:
+		return fmt.Errorf("pass --before or --before-row, not both")
+	case normalizeBefore != "":
+		if sel.Before, err = time.Parse(time.RFC3339, normalizeBefore); err != nil {
+			return fmt.Errorf("invalid --before: %w", err)
+		}
+	case normalizeBeforeRow > 0:
+		sel.BeforeRow = normalizeBeforeRow
+	default:
+		fmt.Println("Nothing changed; pass --table with --before or --before-row to convert rows")
+		return nil
+	}
+	if normalizeTable == "" {
+		return fmt.Errorf("pass --table to convert rows")
+	}
+
+	if !normalizeYes {
+		fmt.Printf("This converts the selected rows of %s from %s to UTC, and can't be undone. Back up the database and stop the server first.\n", normalizeTable, zone)
+		fmt.Print(`Type "convert" to continue: `)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != "convert" {
+			return fmt.Errorf("not confirmed, nothing changed")
+		}
+	}
+	n, err := store.NormalizeTimestamps(cmd.Context(), normalizeTable, zone, sel)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Converted %d rows of %s from %s to UTC\n", n, normalizeTable, zone)
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"speedplane/model"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	remoteServer string
+	remoteToken  string
+	remoteSave   bool
+	remoteJSON   bool
+	remoteConn   string
+)
+
+var remoteCmd = &cobra.Command{
+	Use:   "remote",
+	Short: "Control a remote speedplane instance",
+	Long:  "Run commands against another speedplane instance's API.",
+}
+
+var remoteRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run a speedtest on a remote instance",
+	Long:  "Start a speedtest on a remote speedplane instance and stream its progress. The token is sent as a bearer token, e.g. for an authenticating reverse proxy; it defaults to $SPEEDPLANE_TOKEN.",
+	Args:  cobra.NoArgs,
+	RunE:  runRemoteRun,
+	// main prints the error
+	SilenceErrors: true,
+}
+
+func init() {
+	remoteCmd.PersistentFlags().StringVar(&remoteServer, "server", "", "Base URL of the remote instance (e.g. https://speedplane.example.com)")
+	remoteCmd.PersistentFlags().StringVar(&remoteToken, "token", os.Getenv("SPEEDPLANE_TOKEN"), "Bearer token for the remote API (default: $SPEEDPLANE_TOKEN)")
+	_ = remoteCmd.MarkPersistentFlagRequired("server")
+	remoteRunCmd.Flags().BoolVar(&remoteSave, "save", false, "Save the result on the remote instance")
+	remoteRunCmd.Flags().BoolVar(&remoteJSON, "json", false, "Print the result as JSON instead of a summary")
+	remoteRunCmd.Flags().StringVar(&remoteConn, "connection", "", "Named connection to test (default: the remote's default connection)")
+	remoteCmd.AddCommand(remoteRunCmd)
+	rootCmd.AddCommand(remoteCmd)
+}
+
+// remoteEvent is a server-sent event from /api/run/stream.
+type remoteEvent struct {
+	Type    string                 `json:"type"` // started, progress, completed or error
+	Stage   string                 `json:"stage"`
+	Message string                 `json:"message"`
+	Result  *model.SpeedtestResult `json:"result"`
+}
+
+func runRemoteRun(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	base := strings.TrimRight(remoteServer, "/")
+	// Tests take a while; only the connection setup gets a deadline.
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 30 * time.Second,
+	}}
+
+	target := base + "/api/run/stream"
+	if remoteConn != "" {
+		target += "?connection=" + url.QueryEscape(remoteConn)
+	}
+	resp, err := remoteRequest(client, http.MethodPost, target, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result *model.SpeedtestResult
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024) // Results carry the engine's raw output
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var ev remoteEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return fmt.Errorf("parse event: %w", err)
+		}
+		switch ev.Type {
+		case "started":
+			fmt.Fprintf(os.Stderr, "%s\n", ev.Message)
+		case "progress":
+			fmt.Fprintf(os.Stderr, "[%s] %s\n", ev.Stage, ev.Message)
+		case "error":
+			return fmt.Errorf("remote speedtest failed: %s", ev.Message)
+		case "completed":
+			result = ev.Result
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read progress: %w", err)
+	}
+	if result == nil {
+		return fmt.Errorf("stream ended without a result")
+	}
+
+	if remoteSave {
+		body, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		saveResp, err := remoteRequest(client, http.MethodPost, base+"/api/results", body)
+		if err != nil {
+			return fmt.Errorf("save result: %w", err)
+		}
+		err = json.NewDecoder(saveResp.Body).Decode(result)
+		saveResp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("save result: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Saved as %s\n", result.ID)
+	}
+
+	if remoteJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+	fmt.Printf("Download: %.2f Mbps\nUpload:   %.2f Mbps\nPing:     %.2f ms\n", result.DownloadMbps, result.UploadMbps, result.PingMs)
+	if result.ServerName != "" {
+		fmt.Printf("Server:   %s (%s)\n", result.ServerName, result.ServerCountry)
+	}
+	return nil
+}
+
+// remoteRequest sends a request to the remote API with the bearer token and
+// turns non-2xx responses into errors.
+func remoteRequest(client *http.Client, method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if remoteToken != "" {
+		req.Header.Set("Authorization", "Bearer "+remoteToken)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"speedplane"
+	"speedplane/config"
+	"speedplane/storage"
+
+	"github.com/spf13/cobra"
+)
+
+var resetYes bool
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Database management",
+	Long:  "Manage the speedplane results database.",
+}
+
+var dbResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Delete all recorded data",
+	Long: "Delete all results, probe rounds, failures, rollups and annotations, the archive files and when schedules last ran, e.g. before handing the install to someone else. " +
+		"The configuration, including schedules, and keys are kept. Stop the server first.",
+	Args: cobra.NoArgs,
+	RunE: runDBReset,
+	// main prints the error
+	SilenceErrors: true,
+}
+
+func init() {
+	dbCmd.PersistentFlags().StringVar(&configPath, "config", "", "Config file path (full path with filename, or directory to use default filename 'speedplane.config', default: current directory)")
+	dbCmd.PersistentFlags().StringVar(&dbPath, "db", "", "Database path (full path with filename, or directory to use default filename 'speedplane.results')")
+	dbResetCmd.Flags().BoolVar(&resetYes, "yes", false, "Don't ask for confirmation")
+	dbCmd.AddCommand(dbResetCmd)
+	rootCmd.AddCommand(dbCmd)
+}
+
+func runDBReset(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	cfg, store, err := openStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if !resetYes {
+		n, err := store.CountResults(cmd.Context(), time.Time{}, time.Now().Add(24*time.Hour), storage.ResultFilter{})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("This permanently deletes %d results and all other data recorded in %s.\n", n, cfg.DataDir)
+		fmt.Print(`Type "reset" to continue: `)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != "reset" {
+			return fmt.Errorf("not confirmed, nothing deleted")
+		}
+	}
+
+	if err := speedplane.WipeData(cmd.Context(), store, cfg.DataDir); err != nil {
+		return err
+	}
+	if len(cfg.LastRun) > 0 {
+		cfg.LastRun = make(map[string]time.Time)
+		if err := config.Save(cfg); err != nil {
+			return fmt.Errorf("save config: %w", err)
+		}
+	}
+	fmt.Println("All data deleted")
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"speedplane/config"
+	"speedplane/signing"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyKeyPath string
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify FILE...",
+	Short: "Verify the signatures of exported results",
+	Long: "Check that results in exports (/api/export/history.json, single results or archive files) are unchanged since they were captured and signed. " +
+		"The key is read from --key, a public key from /api/signing-key, or else the private key in the data directory. " +
+		"Exits with an error unless every result has a valid signature.",
+	Args: cobra.MinimumNArgs(1),
+	RunE: runVerify,
+	// main prints the error
+	SilenceErrors: true,
+}
+
+func init() {
+	verifyCmd.Flags().StringVar(&configPath, "config", "", "Config file path, to find the data directory's signing key (full path with filename, or directory to use default filename 'speedplane.config', default: current directory)")
+	verifyCmd.Flags().StringVar(&verifyKeyPath, "key", "", "PEM public key to verify with, as served by /api/signing-key")
+	rootCmd.AddCommand(verifyCmd)
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	keyPath := verifyKeyPath
+	if keyPath == "" {
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			return fmt.Errorf("load config: %w", err)
+		}
+		keyPath = filepath.Join(cfg.DataDir, signing.KeyFile)
+	}
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("read key: %w", err)
+	}
+	key, err := signing.ParsePublicKey(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", keyPath, err)
+	}
+
+	var valid, failed int
+	for _, path := range args {
+		v, f, err := verifyFile(key, path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		valid += v
+		failed += f
+	}
+	fmt.Printf("%d valid, %d not verified\n", valid, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d results failed verification", failed)
+	}
+	return nil
+}
+
+// verifyFile verifies the results in one export, printing those that fail,
+// and returns how many passed and failed.
+func verifyFile(key ed25519.PublicKey, path string) (valid, failed int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	results, err := signing.ReadResults(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, c := range signing.VerifyAll(key, results) {
+		if c.Status == signing.StatusValid {
+			valid++
+			continue
+		}
+		failed++
+		fmt.Printf("%s %s %s: %s\n", path, c.ID, c.Timestamp.Format(time.RFC3339), describeCheck(c))
+	}
+	return valid, failed, nil
+}
+
+func describeCheck(c signing.Check) string {
+	if c.Status == signing.StatusUnsigned {
+		return signing.ErrUnsigned.Error()
+	}
+	return c.Error
+}
@@ -16,12 +16,465 @@ type Config struct {
     DataDir         string                    `json:"data_dir"`
     DBPath          string                    `json:"db_path"`
     ListenAddr      string                    `json:"listen_addr"`
+    ListenAddrs     []string                  `json:"listen_addrs,omitempty"` // Extra addresses, "host:port" or "unix:/path/to.sock"
+    SocketMode      string                    `json:"socket_mode,omitempty"`  // Octal permissions for unix sockets, e.g. "0660"
+    AdminListenAddr string                    `json:"admin_listen_addr,omitempty"` // Separate listener for /metrics and /api/admin/*; empty serves them on the main listeners
+    AdminToken      string                    `json:"admin_token,omitempty"`       // Bearer token required for /api/admin/* and /debug/pprof
+    EnablePprof     bool                      `json:"enable_pprof,omitempty"`      // Expose /debug/pprof on the admin listener
+    DrainTimeout    string                    `json:"drain_timeout,omitempty"`     // Go duration to wait for in-flight tests on shutdown, e.g. "2m"
+    BatchInterval   string                    `json:"batch_interval,omitempty"`    // Go duration continuous probe rounds are buffered for before being written (default "10s")
+    QueryTimeout    string                    `json:"query_timeout,omitempty"`     // Go duration a database query may take before it is cancelled (default "30s")
     PublicDashboard bool                      `json:"public_dashboard"`
     SaveManualRuns  bool                      `json:"save_manual_runs"`
+    ManualResults   ManualResultsConfig       `json:"manual_results,omitempty"` // Unsaved manual runs held for saving later
+    Theme           ThemeConfig               `json:"theme,omitempty"`
+    ThemeDevMode    bool                      `json:"theme_dev_mode,omitempty"` // Watch {data_dir}/themes and reload on change
+    Locale          string                    `json:"locale,omitempty"` // Language and date format for server-rendered pages and exports, e.g. "de" or "en-US"
+    Units           UnitsConfig               `json:"units,omitempty"`
+    Timezone        string                    `json:"timezone,omitempty"` // IANA name, e.g. "Australia/Brisbane", for day boundaries and daily schedules; empty uses the server's timezone
     Schedules       []model.Schedule          `json:"schedules,omitempty"`
+    Alerts          AlertsConfig              `json:"alerts,omitempty"`
+    Probes          ProbesConfig              `json:"probes,omitempty"`
+    LANHealth       LANHealthConfig           `json:"lan_health,omitempty"`
+    PathMTU         PathMTUConfig             `json:"path_mtu,omitempty"`
+    ServerQuality   ServerQualityConfig       `json:"server_quality,omitempty"`
+    Starlink        StarlinkConfig            `json:"starlink,omitempty"`
+    WANCounters     []WANCountersConfig       `json:"wan_counters,omitempty"` // Routers to read WAN traffic counters from over SNMP, one per connection
+    Reachability    ReachabilityConfig        `json:"reachability,omitempty"`
+    WorkingLatency  WorkingLatencyConfig      `json:"working_latency,omitempty"`
+    Connections     []ConnectionConfig        `json:"connections,omitempty"` // Named WAN connections besides the default one
+    Triggers        []TriggerConfig           `json:"triggers,omitempty"` // Tokenized URLs that start a test, /api/triggers/{token}/run
+    Ingest          []IngestConfig            `json:"ingest,omitempty"` // External tools allowed to store results through /api/ingest
+    Exports         ExportsConfig             `json:"exports,omitempty"` // Limits on /api/export/* and /api/history.ndjson, by token
+    Downtime        []DowntimeConfig          `json:"downtime,omitempty"` // Recurring windows of expected downtime, e.g. ISP maintenance
+    Plans           []model.Plan              `json:"plans,omitempty"` // ISP plans over time, each in effect from its start date until the next
+    Reconnect       ReconnectConfig           `json:"reconnect,omitempty"`
+    Archive         ArchiveConfig             `json:"archive,omitempty"`
+    DiskSpace       DiskSpaceConfig           `json:"disk_space,omitempty"` // Stop saving results before the data directory's disk is full
+    SignResults     bool                      `json:"sign_results,omitempty"` // Sign results at capture with an Ed25519 key kept in {data_dir}/speedplane.key
+    Benchmark       BenchmarkConfig           `json:"benchmark,omitempty"` // Opt-in comparison against other users of the same ISP
+    Updates         UpdatesConfig             `json:"updates,omitempty"`
+    DisablePhoneHome bool                     `json:"disable_phone_home,omitempty"` // Never contact services besides speedtest servers and configured integrations; overrides updates, benchmark and the default reconnect IP lookup
+    Zabbix          ZabbixConfig              `json:"zabbix,omitempty"`
+    Nagios          NagiosConfig              `json:"nagios,omitempty"`
+    Graphite        MetricsSinkConfig         `json:"graphite,omitempty"`
+    StatsD          MetricsSinkConfig         `json:"statsd,omitempty"`
+    Syslog          SyslogConfig              `json:"syslog,omitempty"`
+    Events          EventsConfig              `json:"events,omitempty"`
+    Snapshots       SnapshotsConfig           `json:"snapshots,omitempty"`
+    GoogleSheets    *GoogleSheetsConfig       `json:"google_sheets,omitempty"`
+    Privacy         PrivacyConfig             `json:"privacy,omitempty"`
+    Plugins         []PluginConfig            `json:"plugins,omitempty"` // External programs providing engines and alert channels
+    Mock            MockConfig                `json:"mock,omitempty"` // Fake speedtests for integration testing; see also SPEEDPLANE_MOCK
     LastRun         map[string]time.Time      `json:"last_run,omitempty"`
 }
 
+// ThemeConfig selects the template and scheme shown to visitors who haven't chosen one.
+type ThemeConfig struct {
+    Template string `json:"template,omitempty"`
+    Scheme   string `json:"scheme,omitempty"`
+}
+
+// AlertsConfig holds alert rules and where their notifications are sent.
+// Webhooks and the other channels share one namespace of names.
+type AlertsConfig struct {
+    Rules     []model.AlertRule `json:"rules,omitempty"`
+    Webhooks  []WebhookConfig   `json:"webhooks,omitempty"`
+    Teams     []TeamsConfig     `json:"teams,omitempty"`
+    Matrix    []MatrixConfig    `json:"matrix,omitempty"`
+    PagerDuty []PagerDutyConfig `json:"pagerduty,omitempty"`
+    Opsgenie  []OpsgenieConfig  `json:"opsgenie,omitempty"`
+    Push      *PushConfig       `json:"push,omitempty"`
+}
+
+// WebhookConfig is an HTTP endpoint that receives alert events, as JSON or
+// in a format of its own rendered by Template.
+type WebhookConfig struct {
+    Name        string            `json:"name,omitempty"` // Lets schedules pick this webhook, see model.ScheduleAlerts
+    URL         string            `json:"url"`
+    Headers     map[string]string `json:"headers,omitempty"`      // Extra request headers, e.g. Authorization
+    Template    string            `json:"template,omitempty"`     // Go text/template for the body, executed on a notify.Payload; empty sends the payload as JSON
+    ContentType string            `json:"content_type,omitempty"` // Of the rendered body (default "application/json")
+}
+
+// TeamsConfig is a Microsoft Teams incoming webhook that receives alert
+// events as Adaptive Cards.
+type TeamsConfig struct {
+    Name string `json:"name,omitempty"` // Lets schedules pick this channel, like a webhook name
+    URL  string `json:"url"`            // Workflows or connector webhook URL
+}
+
+// MatrixConfig is a Matrix room that receives alert events as notices, sent
+// as the user the access token belongs to.
+type MatrixConfig struct {
+    Name        string `json:"name,omitempty"` // Lets schedules pick this channel, like a webhook name
+    Homeserver  string `json:"homeserver"`     // e.g. "https://matrix.example.org"
+    AccessToken string `json:"access_token"`
+    RoomID      string `json:"room_id"` // e.g. "!abcdef:example.org"; the user must have joined it
+}
+
+// PagerDutyConfig is a PagerDuty service, through an Events API v2
+// integration, in which degraded rules open incidents that their recovery
+// resolves.
+type PagerDutyConfig struct {
+    Name       string `json:"name,omitempty"` // Lets schedules pick this channel, like a webhook name
+    RoutingKey string `json:"routing_key"`    // Integration key
+    Source     string `json:"source,omitempty"` // Names this instance in incidents and their dedup keys (default: the hostname)
+}
+
+// OpsgenieConfig is an Opsgenie API integration in which degraded rules
+// create alerts that their recovery closes.
+type OpsgenieConfig struct {
+    Name   string `json:"name,omitempty"` // Lets schedules pick this channel, like a webhook name
+    APIKey string `json:"api_key"`
+    Region string `json:"region,omitempty"` // "us" (default) or "eu"
+    Source string `json:"source,omitempty"` // Names this instance in alerts and their aliases (default: the hostname)
+}
+
+// PushConfig enables Web Push notifications of alerts and outages to
+// browsers that subscribe in the dashboard. The VAPID key they are signed
+// with is created in the data directory on first use.
+type PushConfig struct {
+    Subject string `json:"subject"` // Contact for push services, e.g. "mailto:admin@example.com"
+}
+
+// PluginConfig is an external program started once per speedtest, alert or
+// saved result. Engines and notifiers speak the plugins package's JSON
+// protocol; scripts just print a measurement as JSON, and hooks amend
+// results before they are saved.
+type PluginConfig struct {
+    Name    string                       `json:"name"`              // Engine name for schedules, or channel name for schedule alerts
+    Kind    string                       `json:"kind"`              // "engine", "notifier", "script" or "hook"
+    Command []string                     `json:"command"`           // Program and arguments
+    Env     map[string]string            `json:"env,omitempty"`     // Extra environment variables
+    Timeout string                       `json:"timeout,omitempty"` // Go duration per call (default "5m" for engines and scripts, "30s" for notifiers and hooks)
+    Fields  map[string]IngestFieldConfig `json:"fields,omitempty"`  // Scripts only: maps the output to a result, like an ingest source's fields
+}
+
+// ZabbixConfig sends each scheduled result to a Zabbix server or proxy as
+// trapper item values, like zabbix_sender.
+type ZabbixConfig struct {
+    Server    string `json:"server,omitempty"`     // host:port of the server or proxy (default port 10051); empty disables sending
+    Host      string `json:"host,omitempty"`       // Host name of the monitored host in Zabbix
+    KeyPrefix string `json:"key_prefix,omitempty"` // Item keys are <key_prefix>.<metric> (default "speedplane")
+}
+
+// NagiosConfig submits each scheduled result to Nagios, Icinga or Naemon as
+// a passive service check result through its external command file.
+type NagiosConfig struct {
+    CommandFile string                     `json:"command_file,omitempty"` // e.g. "/var/lib/nagios4/rw/nagios.cmd"; empty disables submitting
+    Host        string                     `json:"host,omitempty"`
+    Service     string                     `json:"service,omitempty"`    // Default "speedtest"
+    Thresholds  map[string]ThresholdConfig `json:"thresholds,omitempty"` // By metric, as in alert rules, e.g. "download_mbps"
+}
+
+// MetricsSinkConfig sends each scheduled result's metrics to Graphite, with
+// the plaintext protocol, or to StatsD, as gauges.
+type MetricsSinkConfig struct {
+    Address string `json:"address,omitempty"` // host:port (default port 2003 for Graphite, 8125 for StatsD); empty disables sending
+    Prefix  string `json:"prefix,omitempty"`  // Metric names start with <prefix>. (default "speedplane")
+}
+
+// SyslogConfig sends an RFC 5424 message per scheduled result and per alert
+// event to a remote syslog collector.
+type SyslogConfig struct {
+    Address  string `json:"address,omitempty"`  // host:port (default port 514); empty disables sending
+    Network  string `json:"network,omitempty"`  // "udp" (default) or "tcp"
+    Facility string `json:"facility,omitempty"` // e.g. "daemon" or "local3" (default "local0")
+    AppName  string `json:"app_name,omitempty"` // Default "speedplane"
+}
+
+// EventsConfig publishes result-saved and outage events as JSON to
+// message brokers.
+type EventsConfig struct {
+    Kafka *KafkaConfig `json:"kafka,omitempty"`
+    NATS  *NATSConfig  `json:"nats,omitempty"`
+}
+
+// KafkaConfig publishes events to a Kafka topic partition.
+type KafkaConfig struct {
+    Brokers   []string `json:"brokers"`             // Bootstrap brokers as host:port (default port 9092)
+    Topic     string   `json:"topic,omitempty"`     // Default "speedplane"
+    Partition int32    `json:"partition,omitempty"` // Default 0
+}
+
+// NATSConfig publishes events to NATS subjects.
+type NATSConfig struct {
+    Server  string `json:"server"`            // host:port or nats://[user:password@|token@]host:port (default port 4222)
+    Subject string `json:"subject,omitempty"` // Events go to <subject>.<type> (default "speedplane")
+}
+
+// ThresholdConfig sets when a metric makes a passive check warn or go
+// critical: below the value for download and upload, above it for the rest.
+type ThresholdConfig struct {
+    Warning  *float64 `json:"warning,omitempty"`
+    Critical *float64 `json:"critical,omitempty"`
+}
+
+// ProbesConfig configures packet-loss probes. Each scheduled speedtest runs a
+// round alongside it, and rounds also run continuously every Interval.
+type ProbesConfig struct {
+    Targets  []ProbeTargetConfig `json:"targets,omitempty"`
+    Count    int                 `json:"count,omitempty"`    // Packets per target per round (default 10)
+    Interval string              `json:"interval,omitempty"` // Go duration between continuous rounds (default "1m"); "0" only probes alongside speedtests
+    Timeout  string              `json:"timeout,omitempty"`  // Go duration to wait for replies after the last packet (default "2s")
+}
+
+// ProbeTargetConfig is a host to probe.
+type ProbeTargetConfig struct {
+    Name    string `json:"name"`
+    Kind    string `json:"kind"`    // "icmp" or "udp"
+    Address string `json:"address"` // Host for icmp; host:port of a UDP echo responder for udp
+}
+
+// LANHealthConfig enables a gateway, DNS and interface check around each
+// speedtest. Gateway and DNS are detected when left empty.
+type LANHealthConfig struct {
+    Enabled bool   `json:"enabled"`
+    Gateway string `json:"gateway,omitempty"` // IPv4 address to ping instead of the default route's gateway
+    DNS     string `json:"dns,omitempty"`     // IPv4 address to ping instead of the first nameserver in /etc/resolv.conf
+}
+
+// PathMTUConfig enables a path MTU probe to the test server before each
+// speedtest.
+type PathMTUConfig struct {
+    Enabled bool `json:"enabled"`
+    Max     int  `json:"max,omitempty"` // Largest packet size tried in bytes (default 1500)
+}
+
+// ServerQualityConfig sets how test servers are scored from their history
+// and whether scheduled tests avoid Ookla servers whose results diverge from
+// the fleet median.
+type ServerQualityConfig struct {
+    Window          string  `json:"window,omitempty"`            // Go duration of history servers are scored on (default "720h")
+    MaxDeviationPct float64 `json:"max_deviation_pct,omitempty"` // How far a server's median download may be from the fleet median before it is flagged (default 50)
+    AutoExclude     bool    `json:"auto_exclude,omitempty"`      // Skip flagged Ookla servers when selecting the closest one
+}
+
+// StarlinkConfig enables reading a Starlink dish's status every Interval.
+type StarlinkConfig struct {
+    Enabled  bool   `json:"enabled"`
+    Address  string `json:"address,omitempty"`  // host:port of the dish's gRPC-web interface (default "192.168.100.1:9201")
+    Interval string `json:"interval,omitempty"` // Go duration between readings (default "1m")
+}
+
+// WANCountersConfig reads a connection's WAN interface counters from the
+// router over SNMPv2c every Interval, to record utilization and optionally
+// hold back scheduled tests while the link is busy.
+type WANCountersConfig struct {
+    Connection   string  `json:"connection,omitempty"`    // Empty for the default connection
+    Address      string  `json:"address"`                 // Router host, or host:port (default port 161)
+    Community    string  `json:"community,omitempty"`     // Default "public"
+    IfIndex      int     `json:"if_index"`                // ifIndex of the WAN interface
+    Interval     string  `json:"interval,omitempty"`      // Go duration between reads (default "30s")
+    DownloadMbps float64 `json:"download_mbps,omitempty"` // Capacity for utilization percentages; defaults to the ISP plan, then the interface speed
+    UploadMbps   float64 `json:"upload_mbps,omitempty"`
+    BusyPct      float64 `json:"busy_pct,omitempty"`      // Hold back scheduled tests while utilization is above this; 0 never does
+    BusyMaxWait  string  `json:"busy_max_wait,omitempty"` // Go duration a test is held back at most (default "30m")
+}
+
+// ReachabilityConfig enables a periodic check of how the connection looks
+// from the outside: the public IP address, carrier-grade NAT and whether the
+// dashboard port is reachable.
+type ReachabilityConfig struct {
+    Enabled    bool   `json:"enabled"`
+    Interval   string `json:"interval,omitempty"`    // Go duration between checks (default "15m")
+    Port       int    `json:"port,omitempty"`        // Port to check from outside (default: the first listen port); -1 skips the check
+    CheckURL   string `json:"check_url,omitempty"`   // Port check service, {port} is replaced (default "https://ifconfig.co/port/{port}")
+    STUNServer string `json:"stun_server,omitempty"` // host:port (default "stun.l.google.com:19302")
+    Gateway    string `json:"gateway,omitempty"`     // Router to ask over NAT-PMP (default: the default route's gateway)
+}
+
+// WorkingLatencyConfig configures working latency tests, which ping a host
+// such as a game server with the link idle and while it is saturated.
+type WorkingLatencyConfig struct {
+    Targets     []ProbeTargetConfig `json:"targets,omitempty"`
+    Count       int                 `json:"count,omitempty"`        // Packets per phase (default 20)
+    Streams     int                 `json:"streams,omitempty"`      // Parallel transfers loading the link (default 4)
+    Warmup      string              `json:"warmup,omitempty"`       // Go duration the link is loaded before probing (default "2s")
+    DownloadURL string              `json:"download_url,omitempty"` // Large file to download (default Cloudflare's speed test)
+    UploadURL   string              `json:"upload_url,omitempty"`   // URL accepting large POSTs (default Cloudflare's speed test)
+    Interval    string              `json:"interval,omitempty"`     // Go duration between automatic tests of every target; empty only runs them on request
+}
+
+// ConnectionConfig names a WAN connection, e.g. "fiber" or "lte-backup",
+// that schedules and manual runs can test separately from the default one.
+// Its results are stored with its name and can be filtered by it.
+type ConnectionConfig struct {
+    Name   string `json:"name"`
+    Source string `json:"source,omitempty"` // Local IP address to bind tests to, selecting the link; empty uses the default route
+}
+
+// TriggerConfig lets external systems start a test by POSTing to
+// /api/triggers/{token}/run, e.g. a router script on reconnect.
+type TriggerConfig struct {
+    Name  string   `json:"name"`
+    Token string   `json:"token"`          // Secret part of the URL, at least 16 characters
+    Tags  []string `json:"tags,omitempty"` // Attached to every result this trigger starts
+}
+
+// IngestConfig lets an external tool, e.g. a router speedtest script or a
+// Starlink exporter, store its measurements by POSTing them to /api/ingest.
+type IngestConfig struct {
+    Name       string                       `json:"name"`
+    Token      string                       `json:"token"`                // Sent as a bearer token or ?token=, at least 16 characters
+    Connection string                       `json:"connection,omitempty"` // Empty for the default connection
+    Tags       []string                     `json:"tags,omitempty"`       // Attached to every result from the tool
+    Fields     map[string]IngestFieldConfig `json:"fields,omitempty"`     // By result field; unmapped fields are read from the key of the same name
+}
+
+// IngestFieldConfig locates a result field in the tool's JSON.
+type IngestFieldConfig struct {
+    Path   string  `json:"path"`             // Dot-separated keys and array indexes, e.g. "download.bandwidth", or a CSV column name
+    Scale  float64 `json:"scale,omitempty"`  // Multiplier for numbers, e.g. 0.000001 for bps to Mbps
+    Unit   string  `json:"unit,omitempty"`   // Instead of scale: "bps", "kbps", "Mbps", "Gbps", "B/s", "kB/s", "MB/s" or "GB/s" for speeds, "s", "ms" or "us" for ping and jitter
+    Format string  `json:"format,omitempty"` // Go time layout of timestamps, e.g. "2006-01-02 15:04:05"; without a zone they're in the configured timezone
+}
+
+// ExportsConfig limits how much history can be downloaded through the export
+// endpoints and /api/history.ndjson, so a leaked token can't be used to dump
+// years of results over and over. Requests with the admin token aren't
+// limited.
+type ExportsConfig struct {
+    RequireToken bool                `json:"require_token,omitempty"` // Refuse exports without an export or admin token
+    ExportLimitConfig                                                  // For requests without a token
+    Tokens       []ExportTokenConfig `json:"tokens,omitempty"`        // Read-only tokens, each with its own limits
+}
+
+// ExportLimitConfig caps a single export. Zero values are unlimited.
+type ExportLimitConfig struct {
+    MaxDays   int `json:"max_days,omitempty"`   // Widest from/to range in days; "all" history is refused when set
+    MaxRows   int `json:"max_rows,omitempty"`   // Most results one export may contain
+    RateKiBps int `json:"rate_kib_s,omitempty"` // KiB per second exports are sent at, shared by concurrent exports
+}
+
+// ExportTokenConfig is a read-only token for exports, sent as a bearer token
+// or ?token=, e.g. for a spreadsheet or backup script.
+type ExportTokenConfig struct {
+    Name  string `json:"name"`
+    Token string `json:"token"` // At least 16 characters
+    ExportLimitConfig
+}
+
+// DowntimeConfig is a recurring window in which the connection is expected
+// to be down, evaluated in the configured timezone. Results recorded during
+// it are tagged "downtime", and it isn't counted as an outage or alerted on.
+type DowntimeConfig struct {
+    Name  string   `json:"name"`
+    Days  []string `json:"days,omitempty"` // Weekdays it starts on, e.g. ["sunday"]; empty means every day
+    Week  string   `json:"week,omitempty"` // "first" to "fourth" or "last" of those weekdays in the month; empty means every week
+    Start string   `json:"start"`          // "HH:MM"
+    End   string   `json:"end"`            // "HH:MM"; at or before start runs past midnight
+}
+
+// ReconnectConfig runs a test tagged "reconnect" whenever the WAN reconnects,
+// detected by polling the external IP address.
+type ReconnectConfig struct {
+    Enabled  bool   `json:"enabled"`
+    Interval string `json:"interval,omitempty"` // Go duration between lookups (default "1m")
+    IPURL    string `json:"ip_url,omitempty"`   // Returns the caller's IP as plain text (default "https://api.ipify.org")
+}
+
+// ArchiveConfig moves results older than the retention window out of the
+// database into compressed files under {data_dir}/archive, keeping daily
+// rollups.
+type ArchiveConfig struct {
+    Enabled          bool `json:"enabled"`
+    RetentionDays    int  `json:"retention_days,omitempty"`     // Days of results kept in the database (default 365)
+    RawRetentionDays int  `json:"raw_retention_days,omitempty"` // Days raw engine output is kept, archiving or not; older results keep their metrics. 0 keeps it with the result
+    KeepFailedRaw    bool `json:"keep_failed_raw,omitempty"`    // Keep raw output past raw_retention_days for results that failed or lost packets
+}
+
+// DefaultRetentionDays is how many days of results are kept in the database
+// when archiving is enabled without a retention window.
+const DefaultRetentionDays = 365
+
+// Retention returns the archive retention window, falling back to
+// DefaultRetentionDays when RetentionDays is not positive.
+func (a ArchiveConfig) Retention() time.Duration {
+	days := a.RetentionDays
+	if days <= 0 {
+		days = DefaultRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// RawRetention returns how long raw engine output is kept, or 0 to keep it
+// as long as its result.
+func (a ArchiveConfig) RawRetention() time.Duration {
+	return time.Duration(max(a.RawRetentionDays, 0)) * 24 * time.Hour
+}
+
+// DiskSpaceConfig sets when results stop being saved for lack of disk space.
+type DiskSpaceConfig struct {
+    Disabled  bool   `json:"disabled,omitempty"`
+    MinFreeMB int    `json:"min_free_mb,omitempty"` // Free MiB below which results aren't saved (default 100)
+    Interval  string `json:"interval,omitempty"`    // Go duration between checks (default "1m")
+}
+
+// ManualResultsConfig limits the unsaved manual runs held in memory, so one
+// can still be saved after its results dialog was closed.
+type ManualResultsConfig struct {
+    Max int    `json:"max,omitempty"` // Runs held at most (default 10)
+    TTL string `json:"ttl,omitempty"` // Go duration each run is held for (default "1h")
+}
+
+// SnapshotsConfig uploads snapshots of the whole history to S3-compatible
+// object storage, on request through /api/admin/snapshot and on a schedule.
+type SnapshotsConfig struct {
+    Interval string    `json:"interval,omitempty"` // Go duration between scheduled snapshots, e.g. "24h"; empty only takes them on request
+    S3       *S3Config `json:"s3,omitempty"`
+}
+
+// S3Config locates a bucket in Amazon S3 or an S3-compatible store such as
+// MinIO. Empty credentials are taken from AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY.
+type S3Config struct {
+    Endpoint        string `json:"endpoint,omitempty"` // e.g. "http://minio.lan:9000"; empty uses AWS
+    Region          string `json:"region,omitempty"`   // Default "us-east-1"
+    Bucket          string `json:"bucket"`
+    Prefix          string `json:"prefix,omitempty"`   // Folder objects are created in, e.g. "backups/speedplane"
+    AccessKeyID     string `json:"access_key_id,omitempty"`
+    SecretAccessKey string `json:"secret_access_key,omitempty"`
+    PathStyle       bool   `json:"path_style,omitempty"` // Address the bucket in the path, as MinIO needs
+}
+
+// GoogleSheetsConfig appends each scheduled result as a row to a Google
+// Sheet, authenticating as a service account.
+type GoogleSheetsConfig struct {
+    CredentialsFile string `json:"credentials_file"` // Service account JSON key
+    SpreadsheetID   string `json:"spreadsheet_id"`   // From the sheet's URL: docs.google.com/spreadsheets/d/<id>/edit
+    Sheet           string `json:"sheet,omitempty"`  // Tab name (default "Results")
+}
+
+// UpdatesConfig opts in to checking for new releases.
+type UpdatesConfig struct {
+    Check    bool   `json:"check"`
+    URL      string `json:"url,omitempty"`      // GitHub-style latest release endpoint (default: speedplane's GitHub releases)
+    Interval string `json:"interval,omitempty"` // Go duration between checks (default "24h")
+}
+
+// BenchmarkConfig opts in to comparing results against percentiles for the
+// same ISP and region from a benchmark service.
+type BenchmarkConfig struct {
+    Enabled bool   `json:"enabled"`
+    URL     string `json:"url,omitempty"`   // Base URL of the service
+    Share   bool   `json:"share,omitempty"` // Also contribute anonymized scheduled results: ISP, server country, metrics and hour, no IP address
+}
+
+// PrivacyConfig redacts the external IP address for publicly published
+// dashboards. When set, the address is also left out of exports and
+// WebSocket broadcasts.
+type PrivacyConfig struct {
+    ExternalIP string `json:"external_ip,omitempty"` // "truncate" to the network or "hash" before storing; empty stores the address as is
+}
+
+// UnitsConfig selects the units used in server-rendered pages and exports.
+type UnitsConfig struct {
+    Bandwidth string `json:"bandwidth,omitempty"` // "mbps" (default) or "MBps"
+    Clock     string `json:"clock,omitempty"`     // "24h" (default) or "12h"
+}
+
 // Default returns a Config with default values.
 func Default() Config {
     return Config{
@@ -35,6 +488,67 @@ func Default() Config {
     }
 }
 
+// DefaultDrainTimeout is how long shutdown waits for in-flight speedtests
+// when drain_timeout is not set. A full test usually takes under a minute.
+const DefaultDrainTimeout = 90 * time.Second
+
+// DrainDuration returns DrainTimeout parsed as a duration, falling back to
+// DefaultDrainTimeout when it is empty or invalid.
+func (c Config) DrainDuration() time.Duration {
+	if c.DrainTimeout == "" {
+		return DefaultDrainTimeout
+	}
+	d, err := time.ParseDuration(c.DrainTimeout)
+	if err != nil || d < 0 {
+		return DefaultDrainTimeout
+	}
+	return d
+}
+
+// BatchDuration returns BatchInterval parsed as a duration, or 0 when it is
+// empty or invalid, which leaves the storage default in place.
+func (c Config) BatchDuration() time.Duration {
+	d, err := time.ParseDuration(c.BatchInterval)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// QueryDuration returns QueryTimeout parsed as a duration, or 0 when it is
+// empty or invalid, which leaves the storage default in place.
+func (c Config) QueryDuration() time.Duration {
+	d, err := time.ParseDuration(c.QueryTimeout)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// Location returns the configured timezone, or time.Local when Timezone is empty.
+func (c Config) Location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(c.Timezone)
+}
+
+// ListenAddresses returns ListenAddr followed by ListenAddrs with empty
+// entries and duplicates removed.
+func (c Config) ListenAddresses() []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, addr := range append([]string{c.ListenAddr}, c.ListenAddrs...) {
+		addr = strings.TrimSpace(addr)
+		if addr == "" || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		out = append(out, addr)
+	}
+	return out
+}
+
 // ResolveConfigPath determines the final config file path based on the provided configPath.
 // If configPath is empty, uses current directory + "speedplane.config"
 // If configPath is a directory, appends "speedplane.config"
@@ -99,10 +613,15 @@ func Load(configPath string) (Config, error) {
     return cfg, nil
 }
 
+// Path returns the file Save writes a configuration with dataDir to.
+func Path(dataDir string) string {
+    return filepath.Join(dataDir, "speedplane.config")
+}
+
 // Save writes the configuration to disk in the data directory.
 // The file is written atomically using a temporary file.
 func Save(cfg Config) error {
-    cfgPath := filepath.Join(cfg.DataDir, "speedplane.config")
+    cfgPath := Path(cfg.DataDir)
 
     // Create directory if it doesn't exist
     if err := os.MkdirAll(cfg.DataDir, 0o755); err != nil {
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MockEnv names the environment variable that enables and configures
+// MockConfig without editing the config file, e.g. in CI or package tests.
+const MockEnv = "SPEEDPLANE_MOCK"
+
+// MockConfig replaces real speedtests with a mock runner that returns
+// configured results without contacting any speedtest server, so the
+// scheduler, storage and API can be exercised in integration tests.
+type MockConfig struct {
+	Enabled       bool    `json:"enabled"`
+	DownloadMbps  float64 `json:"download_mbps,omitempty"` // Default 100
+	UploadMbps    float64 `json:"upload_mbps,omitempty"`   // Default 20
+	PingMs        float64 `json:"ping_ms,omitempty"`       // Default 10
+	JitterMs      float64 `json:"jitter_ms,omitempty"`
+	PacketLossPct float64 `json:"packet_loss_pct,omitempty"`
+	Spread        float64 `json:"spread,omitempty"`     // Vary each value by up to ± this fraction (0-1) at random
+	Seed          int64   `json:"seed,omitempty"`       // Seeds the variation and random failures, so runs are repeatable
+	Delay         string  `json:"delay,omitempty"`      // Go duration each run takes (default "0s")
+	FailEvery     int     `json:"fail_every,omitempty"` // Fail every Nth run
+	FailRate      float64 `json:"fail_rate,omitempty"`  // Fail this share of runs (0-1) at random
+	FailPhase     string  `json:"fail_phase,omitempty"` // Phase failing runs fail in (ping, download or upload), keeping the others; default fails the whole run
+}
+
+// ApplyEnv applies the value of MockEnv: "1" or "true" enables the mock as
+// configured, "0" or "false" disables it, and a comma-separated list of
+// key=value pairs using the JSON field names, such as
+// "download_mbps=50,delay=2s,fail_every=3", enables it with those fields
+// overridden.
+func (m *MockConfig) ApplyEnv(value string) error {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true":
+		m.Enabled = true
+		return nil
+	case "0", "false":
+		m.Enabled = false
+		return nil
+	}
+
+	m.Enabled = true
+	for _, pair := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return fmt.Errorf("%s: %q is not key=value", MockEnv, pair)
+		}
+		var err error
+		switch key {
+		case "download_mbps":
+			m.DownloadMbps, err = strconv.ParseFloat(val, 64)
+		case "upload_mbps":
+			m.UploadMbps, err = strconv.ParseFloat(val, 64)
+		case "ping_ms":
+			m.PingMs, err = strconv.ParseFloat(val, 64)
+		case "jitter_ms":
+			m.JitterMs, err = strconv.ParseFloat(val, 64)
+		case "packet_loss_pct":
+			m.PacketLossPct, err = strconv.ParseFloat(val, 64)
+		case "spread":
+			m.Spread, err = strconv.ParseFloat(val, 64)
+		case "seed":
+			m.Seed, err = strconv.ParseInt(val, 10, 64)
+		case "delay":
+			m.Delay = val
+		case "fail_every":
+			m.FailEvery, err = strconv.Atoi(val)
+		case "fail_rate":
+			m.FailRate, err = strconv.ParseFloat(val, 64)
+		case "fail_phase":
+			m.FailPhase = val
+		default:
+			return fmt.Errorf("%s: unknown key %q", MockEnv, key)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: invalid %s %q", MockEnv, key, val)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Package demo generates synthetic speedtest results, so the dashboard can be
+// evaluated, and the frontend worked on, without running real tests.
+package demo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"speedplane/model"
+	"speedplane/storage"
+)
+
+// HistoryDays is how much history Seed generates.
+const HistoryDays = 30
+
+// Line speeds the generated results are centred on.
+const (
+	baseDownloadMbps = 300
+	baseUploadMbps   = 40
+	basePingMs       = 12
+)
+
+// Generator produces results that look like a home connection: slower in
+// the evening peak, with some noise and the occasional lossy test.
+type Generator struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewGenerator returns a Generator whose sequence of results is determined
+// by seed, so a seeded dashboard looks the same on every start.
+func NewGenerator(seed int64) *Generator {
+	return &Generator{rng: rand.New(rand.NewSource(seed))}
+}
+
+// Result returns a synthetic result for a test run at t.
+func (g *Generator) Result(t time.Time) *model.SpeedtestResult {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Congestion peaks around 21:00 local time
+	hour := float64(t.Hour()) + float64(t.Minute())/60
+	peak := math.Max(0, math.Cos((hour-21)/24*2*math.Pi))
+	load := math.Pow(peak, 4)
+
+	noise := func(spread float64) float64 {
+		return 1 + (g.rng.Float64()*2-1)*spread
+	}
+
+	res := &model.SpeedtestResult{
+		ID:            model.NewID(),
+		Timestamp:     t.UTC().Truncate(time.Second),
+		DownloadMbps:  round(baseDownloadMbps*(1-0.35*load)*noise(0.08), 2),
+		UploadMbps:    round(baseUploadMbps*(1-0.15*load)*noise(0.05), 2),
+		PingMs:        round(basePingMs*(1+0.8*load)*noise(0.15), 2),
+		JitterMs:      round(1+3*load*g.rng.Float64()+g.rng.Float64(), 2),
+		ISP:           "Demo ISP",
+		ExternalIP:    "203.0.113.42",
+		ServerID:      "demo",
+		ServerName:    "Demo City",
+		ServerCountry: "Demoland",
+		Link:          &model.LinkInfo{Interface: "eth0", Type: model.LinkWired, SpeedMbps: 1000},
+	}
+	if g.rng.Intn(20) == 0 {
+		res.PacketLossPct = round(0.5+g.rng.Float64()*2, 2)
+	}
+
+	raw, _ := json.Marshal(map[string]interface{}{"demo": true})
+	res.RawJSON = raw
+	return res
+}
+
+func round(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
+
+// Seed stores HistoryDays of hourly results up to now, with a three-hour
+// outage recorded as failed runs, unless the store already has results.
+// It returns the number of results stored.
+func Seed(ctx context.Context, store *storage.Store, g *Generator, now time.Time) (int, error) {
+	n, err := store.CountResults(ctx, time.Time{}, now, storage.ResultFilter{})
+	if err != nil || n > 0 {
+		return 0, err
+	}
+
+	start := now.Truncate(time.Hour).Add(-HistoryDays * 24 * time.Hour)
+	outage := start.Add(HistoryDays / 3 * 24 * time.Hour).Add(2 * time.Hour)
+	count := 0
+	for t := start; !t.After(now); t = t.Add(time.Hour) {
+		if !t.Before(outage) && t.Before(outage.Add(3*time.Hour)) {
+			failure := model.RunFailure{Timestamp: t.UTC(), Error: "demo: no route to speedtest servers"}
+			if err := store.SaveRunFailure(ctx, failure); err != nil {
+				return count, err
+			}
+			continue
+		}
+		if err := store.SaveResult(ctx, g.Result(t)); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// stages mirrors the progress a real test reports, with the time each stage
+// takes in a demo run.
+// Transfer stages also report their percentage, as verb... N%.
+var stages = []struct {
+	name, message, verb string
+	delay               time.Duration
+}{
+	{"init", "Starting speedtest...", "", 0},
+	{"user", "Fetching user info...", "", 200 * time.Millisecond},
+	{"servers", "Fetching server list...", "", 300 * time.Millisecond},
+	{"ping", "Testing ping and latency...", "", 500 * time.Millisecond},
+	{"download", "Testing download speed...", "Downloading", 1500 * time.Millisecond},
+	{"upload", "Testing upload speed...", "Uploading", 1500 * time.Millisecond},
+	{"processing", "Processing results...", "", 0},
+}
+
+// percentSteps is how many parts transfer stages are reported in.
+const percentSteps = 5
+
+// Runner returns synthetic results in place of speedtest.Runner, reporting
+// progress like a real test but without any network traffic.
+type Runner struct {
+	Generator *Generator
+}
+
+// RunFrom has the signature of speedtest.Runner.RunFrom; source is ignored.
+func (r *Runner) RunFrom(ctx context.Context, source string, progress func(stage string, message string)) (*model.SpeedtestResult, error) {
+	if progress == nil {
+		progress = func(_ string, _ string) {}
+	}
+	for _, s := range stages {
+		progress(s.name, s.message)
+		steps := 1
+		if s.verb != "" {
+			steps = percentSteps
+		}
+		for i := 1; i <= steps; i++ {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(s.delay / time.Duration(steps)):
+			}
+			if i < steps {
+				progress(s.name, fmt.Sprintf("%s... %d%%", s.verb, i*100/steps))
+			}
+		}
+	}
+
+	return r.Generator.Result(time.Now()), nil
+}
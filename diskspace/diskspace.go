@@ -0,0 +1,133 @@
+// Package diskspace watches the free space on the disk holding the
+// database, so results stop being written before SQLite starts failing on a
+// full disk, as happens to SD cards in small devices.
+package diskspace
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"speedplane/alert"
+)
+
+// DefaultMinFreeMB is the free space in MiB below which results are no
+// longer saved, unless configured otherwise.
+const DefaultMinFreeMB = 100
+
+// DefaultInterval is how often free space is checked.
+const DefaultInterval = time.Minute
+
+// ErrUnsupported is returned by Free on platforms where free space isn't
+// known. A Guard there never reports the disk as low.
+var ErrUnsupported = errors.New("free disk space is not supported on this platform")
+
+// Status is the outcome of a Guard's latest check.
+type Status struct {
+	Free    uint64    `json:"free_bytes"`
+	MinFree uint64    `json:"min_free_bytes"`
+	Low     bool      `json:"low"`
+	Since   time.Time `json:"since,omitempty"` // When Low last changed
+	Checked time.Time `json:"checked"`
+	Err     error     `json:"-"` // From Free; Low keeps its previous value
+}
+
+// Guard checks the free space in Dir, reporting it as low once it falls
+// below MinFree and again as fine once it is 10% above it, so a disk
+// hovering around the threshold doesn't flap.
+type Guard struct {
+	Dir      string
+	MinFree  uint64            // Bytes
+	OnChange func(alert.Event) // Called when the disk becomes low or recovers
+
+	mu     sync.Mutex
+	status Status
+}
+
+// Check measures the free space now and returns the new status.
+func (g *Guard) Check() Status {
+	free, err := Free(g.Dir)
+
+	g.mu.Lock()
+	st := g.status
+	st.MinFree, st.Checked, st.Err = g.MinFree, time.Now(), err
+	if err == nil {
+		st.Free = free
+		switch {
+		case !st.Low && free < g.MinFree:
+			st.Low = true
+		case st.Low && free >= g.MinFree+g.MinFree/10:
+			st.Low = false
+		}
+	}
+	changed := st.Low != g.status.Low
+	lowSince := g.status.Since
+	if changed {
+		st.Since = st.Checked
+		if st.Low {
+			lowSince = st.Since
+		}
+	}
+	g.status = st
+	g.mu.Unlock()
+
+	if err != nil && !errors.Is(err, ErrUnsupported) {
+		log.Printf("diskspace: %s: %v", g.Dir, err)
+	}
+	if changed {
+		log.Printf("diskspace: %s: %d MiB free, low: %t", g.Dir, st.Free>>20, st.Low)
+		if g.OnChange != nil {
+			g.OnChange(event(st, lowSince))
+		}
+	}
+	return st
+}
+
+// Status returns the outcome of the latest check.
+func (g *Guard) Status() Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.status
+}
+
+// Low reports whether the latest check found the disk nearly full.
+func (g *Guard) Low() bool {
+	return g.Status().Low
+}
+
+// event returns the alert for the disk becoming low, or recovering, as of
+// st, having been low since lowSince.
+func event(st Status, lowSince time.Time) alert.Event {
+	ev := alert.Event{
+		Kind:      alert.EventDegraded,
+		RuleID:    "disk_space",
+		RuleName:  "Low disk space",
+		Metric:    "disk_free_mb",
+		Operator:  "<",
+		Threshold: float64(st.MinFree >> 20),
+		Severity:  "critical",
+		Value:     float64(st.Free >> 20),
+		Since:     lowSince,
+		Time:      st.Checked,
+	}
+	if !st.Low {
+		ev.Kind = alert.EventRecovered
+	}
+	return ev
+}
+
+// Run checks every interval until ctx is cancelled.
+func (g *Guard) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.Check()
+		}
+	}
+}
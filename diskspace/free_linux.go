@@ -0,0 +1,15 @@
+//go:build linux
+
+package diskspace
+
+import "syscall"
+
+// Free returns the bytes available to unprivileged users on the filesystem
+// holding dir.
+func Free(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
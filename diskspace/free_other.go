@@ -0,0 +1,8 @@
+//go:build !linux
+
+package diskspace
+
+// Free returns ErrUnsupported where free space isn't known.
+func Free(_ string) (uint64, error) {
+	return 0, ErrUnsupported
+}
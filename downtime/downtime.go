@@ -0,0 +1,148 @@
+// Package downtime describes recurring windows in which the connection is
+// expected to be down, such as an ISP's monthly maintenance, so they aren't
+// reported as outages or alerted on.
+package downtime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tag is attached to results recorded during expected downtime.
+const Tag = "downtime"
+
+// Window is a recurring period of expected downtime, e.g. every first Sunday
+// of the month from 02:00 to 04:00. A window whose End is not after its Start
+// runs past midnight into the next day.
+type Window struct {
+	Name  string
+	Days  []string // Weekdays the window starts on, e.g. "sunday" or "sun"; empty means every day
+	Week  string   // "first" to "fourth" or "last" weekday of the month; empty means every week
+	Start string   // "HH:MM"
+	End   string   // "HH:MM"
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+var weeks = map[string]int{"first": 1, "second": 2, "third": 3, "fourth": 4, "last": -1}
+
+// Validate checks that every window has a name, known days and week, and
+// valid times.
+func Validate(windows []Window) error {
+	for _, w := range windows {
+		if w.Name == "" {
+			return fmt.Errorf("downtime window %s-%s: name is required", w.Start, w.End)
+		}
+		for _, d := range w.Days {
+			if _, ok := weekdays[strings.ToLower(d)]; !ok {
+				return fmt.Errorf("downtime window %q: unknown day %q", w.Name, d)
+			}
+		}
+		if _, ok := weeks[strings.ToLower(w.Week)]; w.Week != "" && !ok {
+			return fmt.Errorf("downtime window %q: week must be first, second, third, fourth or last", w.Name)
+		}
+		if _, err := clock(w.Start); err != nil {
+			return fmt.Errorf("downtime window %q: invalid start %q", w.Name, w.Start)
+		}
+		if _, err := clock(w.End); err != nil {
+			return fmt.Errorf("downtime window %q: invalid end %q", w.Name, w.End)
+		}
+	}
+	return nil
+}
+
+// Calendar is a set of validated windows, evaluated in Location (time.Local
+// when nil). A nil Calendar covers nothing.
+type Calendar struct {
+	Windows  []Window
+	Location *time.Location
+}
+
+// Covers reports whether t falls in one of the windows, and which.
+func (c *Calendar) Covers(t time.Time) (Window, bool) {
+	if c == nil {
+		return Window{}, false
+	}
+	loc := c.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	t = t.In(loc)
+	for _, w := range c.Windows {
+		// A window covering t started today or, past midnight, yesterday
+		for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+			if w.covers(day, t) {
+				return w, true
+			}
+		}
+	}
+	return Window{}, false
+}
+
+// covers reports whether the occurrence of w starting on day's date, if
+// there is one, contains t.
+func (w Window) covers(day, t time.Time) bool {
+	if !w.onDay(day) {
+		return false
+	}
+	start, err1 := clock(w.Start)
+	end, err2 := clock(w.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	from := midnight.Add(start)
+	to := midnight.Add(end)
+	if !to.After(from) {
+		to = to.AddDate(0, 0, 1)
+	}
+	return !t.Before(from) && t.Before(to)
+}
+
+// onDay reports whether the window starts on day's date.
+func (w Window) onDay(day time.Time) bool {
+	if len(w.Days) > 0 {
+		match := false
+		for _, d := range w.Days {
+			if weekdays[strings.ToLower(d)] == day.Weekday() {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	switch n := weeks[strings.ToLower(w.Week)]; {
+	case w.Week == "":
+		return true
+	case n < 0:
+		return day.AddDate(0, 0, 7).Month() != day.Month()
+	default:
+		return (day.Day()-1)/7+1 == n
+	}
+}
+
+// clock parses "HH:MM" as a time of day.
+func clock(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	hour, err1 := strconv.Atoi(parts[0])
+	min, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || hour < 0 || hour > 23 || min < 0 || min > 59 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute, nil
+}
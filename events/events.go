@@ -0,0 +1,163 @@
+// Package events publishes what happens to the connection, saved results
+// and the start and end of outages, as JSON to message brokers such as
+// Kafka and NATS, for stream processing in larger telemetry pipelines.
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"speedplane/downtime"
+	"speedplane/model"
+)
+
+// Event types.
+const (
+	TypeResultSaved   = "result.saved"
+	TypeOutageStarted = "outage.started"
+	TypeOutageEnded   = "outage.ended"
+)
+
+// queueSize is how many events may wait for slow brokers before new ones
+// are dropped.
+const queueSize = 256
+
+// Event is the JSON document published for each event.
+type Event struct {
+	Type       string                 `json:"type"`
+	Time       time.Time              `json:"time"`
+	Connection string                 `json:"connection,omitempty"` // Named connection; empty for the default connection
+	Result     *model.SpeedtestResult `json:"result,omitempty"`     // The saved result, for result.saved
+	Outage     *Outage                `json:"outage,omitempty"`     // For outage.started and outage.ended
+}
+
+// Outage describes an outage: a run of tests that failed or moved no data,
+// as on the status page. It ends with the next successful result.
+type Outage struct {
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end,omitempty"`        // Set when ended
+	DurationS float64    `json:"duration_s,omitempty"` // Set when ended
+	Error     string     `json:"error,omitempty"`      // Error of the failed run that started it, if any
+}
+
+// Publisher delivers events to a broker.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+	// Name identifies the publisher in logs, e.g. "kafka".
+	Name() string
+}
+
+// Emitter turns results and failed runs into events and hands them to the
+// publishers in order, in the background, so slow or unreachable brokers
+// don't hold up tests. Outages are tracked per connection; runs during
+// expected downtime in Downtime neither start nor end them.
+type Emitter struct {
+	Downtime *downtime.Calendar
+
+	publishers []Publisher
+	queue      chan Event
+	pending    sync.WaitGroup // Queued events that haven't been published yet
+
+	mu      sync.Mutex
+	outages map[string]*Outage // Ongoing outages by connection
+}
+
+// NewEmitter creates an Emitter for publishers. Call Run to publish.
+func NewEmitter(publishers ...Publisher) *Emitter {
+	return &Emitter{
+		publishers: publishers,
+		queue:      make(chan Event, queueSize),
+		outages:    make(map[string]*Outage),
+	}
+}
+
+// Run publishes queued events until ctx is cancelled. Give it a context
+// that outlives the tests, and call Wait before cancelling it, so the
+// events of the last run aren't lost on shutdown.
+func (em *Emitter) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-em.queue:
+			for _, p := range em.publishers {
+				pctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+				if err := p.Publish(pctx, e); err != nil {
+					log.Printf("%s: publish %s: %v", p.Name(), e.Type, err)
+				}
+				cancel()
+			}
+			em.pending.Done()
+		}
+	}
+}
+
+// Wait waits until the events emitted so far have been published, or ctx
+// is done.
+func (em *Emitter) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		em.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("events: %d left unpublished: %w", len(em.queue), ctx.Err())
+	}
+}
+
+// Result emits result.saved for a saved result, and starts or ends the
+// connection's outage depending on whether the result moved data.
+func (em *Emitter) Result(r model.SpeedtestResult) {
+	em.emit(Event{Type: TypeResultSaved, Time: r.Timestamp, Connection: r.Connection, Result: &r})
+	em.observe(r.Connection, r.Timestamp, resultFailed(r), "")
+}
+
+// Failure starts the connection's outage unless one is ongoing.
+func (em *Emitter) Failure(f model.RunFailure) {
+	em.observe(f.Connection, f.Timestamp, true, f.Error)
+}
+
+func (em *Emitter) observe(connection string, at time.Time, down bool, errMsg string) {
+	if _, expected := em.Downtime.Covers(at); expected {
+		return
+	}
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	current := em.outages[connection]
+	switch {
+	case down && current == nil:
+		o := &Outage{Start: at, Error: errMsg}
+		em.outages[connection] = o
+		started := *o
+		em.emit(Event{Type: TypeOutageStarted, Time: at, Connection: connection, Outage: &started})
+	case !down && current != nil:
+		delete(em.outages, connection)
+		end := at
+		current.End = &end
+		current.DurationS = end.Sub(current.Start).Seconds()
+		em.emit(Event{Type: TypeOutageEnded, Time: at, Connection: connection, Outage: current})
+	}
+}
+
+func (em *Emitter) emit(e Event) {
+	em.pending.Add(1)
+	select {
+	case em.queue <- e:
+	default:
+		em.pending.Done()
+		log.Printf("events: queue full, dropping %s", e.Type)
+	}
+}
+
+// resultFailed reports whether a result counts as down, as on the status
+// page.
+func resultFailed(r model.SpeedtestResult) bool {
+	return r.DownloadMbps <= 0 || r.UploadMbps <= 0 || r.PacketLossPct >= 100
+}
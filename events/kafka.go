@@ -0,0 +1,352 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Kafka defaults.
+const (
+	DefaultKafkaPort  = "9092"
+	DefaultKafkaTopic = "speedplane"
+	kafkaTimeout      = 10 * time.Second
+	kafkaMaxResponse  = 16 << 20
+
+	kafkaProduce  = 0
+	kafkaMetadata = 3
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Kafka publishes events to a Kafka topic partition, keyed by connection and
+// with the event type in a "type" header. It speaks just enough of the
+// protocol to produce: it asks a bootstrap broker for the partition's
+// leader, then sends it the event, waiting for the leader's acknowledgement.
+// Connections are made per event; TLS and SASL are not supported.
+type Kafka struct {
+	brokers   []string
+	topic     string
+	partition int32
+	clientID  string
+}
+
+// NewKafka creates a Kafka publisher for topic's partition, bootstrapping
+// from brokers given as host:port.
+func NewKafka(brokers []string, topic string, partition int32) (*Kafka, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("missing brokers")
+	}
+	if topic == "" {
+		topic = DefaultKafkaTopic
+	}
+	if partition < 0 {
+		return nil, fmt.Errorf("invalid partition %d", partition)
+	}
+	k := &Kafka{topic: topic, partition: partition, clientID: "speedplane"}
+	for _, b := range brokers {
+		k.brokers = append(k.brokers, withPort(b, DefaultKafkaPort))
+	}
+	return k, nil
+}
+
+// Name implements Publisher.
+func (k *Kafka) Name() string {
+	return "kafka"
+}
+
+// Publish implements Publisher.
+func (k *Kafka) Publish(ctx context.Context, e Event) error {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, kafkaTimeout)
+	defer cancel()
+
+	leader, err := k.leader(ctx)
+	if err != nil {
+		return err
+	}
+	conn, err := dialKafka(ctx, leader)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	batch := recordBatch(e.Time, []byte(e.Connection), value, [][2]string{{"type", e.Type}})
+	var req kafkaEncoder
+	req.int16(-1) // No transactional ID
+	req.int16(1)  // acks: the leader's
+	req.int32(int32(kafkaTimeout / time.Millisecond))
+	req.int32(1)
+	req.string(k.topic)
+	req.int32(1)
+	req.int32(k.partition)
+	req.bytes(batch)
+	resp, err := k.roundTrip(conn, kafkaProduce, 3, req.Bytes())
+	if err != nil {
+		return fmt.Errorf("produce: %w", err)
+	}
+
+	d := kafkaDecoder{buf: resp}
+	for topics := d.int32(); topics > 0; topics-- {
+		d.string()
+		for parts := d.int32(); parts > 0; parts-- {
+			d.int32()
+			if code := d.int16(); code != 0 {
+				return fmt.Errorf("produce: %s", kafkaError(code))
+			}
+			d.int64()
+			d.int64()
+		}
+	}
+	return d.err
+}
+
+// leader asks the bootstrap brokers in turn for the address of the
+// partition's leader.
+func (k *Kafka) leader(ctx context.Context) (string, error) {
+	var lastErr error
+	for _, addr := range k.brokers {
+		leader, err := k.metadata(ctx, addr)
+		if err == nil {
+			return leader, nil
+		}
+		lastErr = fmt.Errorf("%s: %w", addr, err)
+	}
+	return "", lastErr
+}
+
+func (k *Kafka) metadata(ctx context.Context, addr string) (string, error) {
+	conn, err := dialKafka(ctx, addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	var req kafkaEncoder
+	req.int32(1)
+	req.string(k.topic)
+	resp, err := k.roundTrip(conn, kafkaMetadata, 1, req.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("metadata: %w", err)
+	}
+
+	d := kafkaDecoder{buf: resp}
+	brokers := make(map[int32]string)
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		id, host, port := d.int32(), d.string(), d.int32()
+		d.string() // Rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // Controller
+	for topics := d.int32(); topics > 0 && d.err == nil; topics-- {
+		topicErr := d.int16()
+		name := d.string()
+		d.int8() // Internal
+		if name == k.topic && topicErr != 0 {
+			return "", fmt.Errorf("topic %s: %s", k.topic, kafkaError(topicErr))
+		}
+		for parts := d.int32(); parts > 0 && d.err == nil; parts-- {
+			partErr, index, leader := d.int16(), d.int32(), d.int32()
+			d.int32s() // Replicas
+			d.int32s() // In-sync replicas
+			if name != k.topic || index != k.partition {
+				continue
+			}
+			if partErr != 0 {
+				return "", fmt.Errorf("partition %d: %s", index, kafkaError(partErr))
+			}
+			if addr, ok := brokers[leader]; ok {
+				return addr, nil
+			}
+		}
+	}
+	if d.err != nil {
+		return "", fmt.Errorf("metadata: %w", d.err)
+	}
+	return "", fmt.Errorf("no leader for %s partition %d", k.topic, k.partition)
+}
+
+// roundTrip sends a request and returns the response body after the
+// correlation ID.
+func (k *Kafka) roundTrip(conn net.Conn, apiKey, version int16, body []byte) ([]byte, error) {
+	const correlationID = 1
+	var req kafkaEncoder
+	req.int16(apiKey)
+	req.int16(version)
+	req.int32(correlationID)
+	req.string(k.clientID)
+	req.buf.Write(body)
+
+	var frame kafkaEncoder
+	frame.bytes(req.Bytes())
+	if _, err := conn.Write(frame.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var size int32
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size < 4 || size > kafkaMaxResponse {
+		return nil, fmt.Errorf("invalid response size %d", size)
+	}
+	resp := make([]byte, size)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	if id := int32(binary.BigEndian.Uint32(resp)); id != correlationID {
+		return nil, fmt.Errorf("unexpected correlation ID %d", id)
+	}
+	return resp[4:], nil
+}
+
+func dialKafka(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+// recordBatch encodes a single record as a version 2 record batch.
+func recordBatch(t time.Time, key, value []byte, headers [][2]string) []byte {
+	var rec []byte
+	rec = append(rec, 0)              // Attributes
+	rec = binary.AppendVarint(rec, 0) // Timestamp delta
+	rec = binary.AppendVarint(rec, 0) // Offset delta
+	if len(key) == 0 {
+		rec = binary.AppendVarint(rec, -1)
+	} else {
+		rec = binary.AppendVarint(rec, int64(len(key)))
+		rec = append(rec, key...)
+	}
+	rec = binary.AppendVarint(rec, int64(len(value)))
+	rec = append(rec, value...)
+	rec = binary.AppendVarint(rec, int64(len(headers)))
+	for _, h := range headers {
+		rec = binary.AppendVarint(rec, int64(len(h[0])))
+		rec = append(rec, h[0]...)
+		rec = binary.AppendVarint(rec, int64(len(h[1])))
+		rec = append(rec, h[1]...)
+	}
+
+	// From the attributes on, the part covered by the CRC
+	var tail kafkaEncoder
+	ms := t.UnixMilli()
+	tail.int16(0) // Attributes: no compression, create time
+	tail.int32(0) // Last offset delta
+	tail.int64(ms)
+	tail.int64(ms)
+	tail.int64(-1) // Producer ID
+	tail.int16(-1) // Producer epoch
+	tail.int32(-1) // Base sequence
+	tail.int32(1)  // Records
+	tail.buf.Write(binary.AppendVarint(nil, int64(len(rec))))
+	tail.buf.Write(rec)
+
+	var batch kafkaEncoder
+	batch.int64(0)                                 // Base offset
+	batch.int32(int32(4 + 1 + 4 + tail.buf.Len())) // Length after this field
+	batch.int32(-1)                                // Partition leader epoch
+	batch.int8(2)                                  // Magic
+	batch.int32(int32(crc32.Checksum(tail.Bytes(), castagnoli)))
+	batch.buf.Write(tail.Bytes())
+	return batch.Bytes()
+}
+
+// kafkaError names the error codes a producer is likely to see.
+func kafkaError(code int16) string {
+	switch code {
+	case 3:
+		return "unknown topic or partition"
+	case 5:
+		return "leader not available"
+	case 6:
+		return "not leader for partition"
+	case 7:
+		return "request timed out"
+	case 10:
+		return "message too large"
+	case 29:
+		return "topic authorization failed"
+	case 31:
+		return "cluster authorization failed"
+	default:
+		return "error code " + strconv.Itoa(int(code))
+	}
+}
+
+// kafkaEncoder writes protocol primitives, big endian.
+type kafkaEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *kafkaEncoder) int8(v int8)   { e.buf.WriteByte(byte(v)) }
+func (e *kafkaEncoder) int16(v int16) { _ = binary.Write(&e.buf, binary.BigEndian, v) }
+func (e *kafkaEncoder) int32(v int32) { _ = binary.Write(&e.buf, binary.BigEndian, v) }
+func (e *kafkaEncoder) int64(v int64) { _ = binary.Write(&e.buf, binary.BigEndian, v) }
+func (e *kafkaEncoder) Bytes() []byte { return e.buf.Bytes() }
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *kafkaEncoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.buf.Write(b)
+}
+
+// kafkaDecoder reads protocol primitives, remembering the first error so
+// responses can be read without checking each field.
+type kafkaDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return make([]byte, n)
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = errors.New("truncated response")
+		return make([]byte, max(n, 0))
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *kafkaDecoder) int8() int8   { return int8(d.next(1)[0]) }
+func (d *kafkaDecoder) int16() int16 { return int16(binary.BigEndian.Uint16(d.next(2))) }
+func (d *kafkaDecoder) int32() int32 { return int32(binary.BigEndian.Uint32(d.next(4))) }
+func (d *kafkaDecoder) int64() int64 { return int64(binary.BigEndian.Uint64(d.next(8))) }
+
+// string reads a nullable string; null reads as empty.
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+func (d *kafkaDecoder) int32s() {
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		d.int32()
+	}
+}
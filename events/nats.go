@@ -0,0 +1,163 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NATS defaults.
+const (
+	DefaultNATSPort    = "4222"
+	DefaultNATSSubject = "speedplane"
+	natsTimeout        = 10 * time.Second
+)
+
+// NATS publishes events to a NATS server with the core protocol, to the
+// subject <Subject>.<type>, e.g. speedplane.outage.started. It connects for
+// each event, which suits the few events a connection produces; TLS is not
+// supported.
+type NATS struct {
+	server   string
+	subject  string
+	user     string
+	password string
+	token    string
+}
+
+// NewNATS creates a NATS publisher. server is host:port or a nats:// URL,
+// whose user info, if any, gives a user and password or a token.
+func NewNATS(server, subject string) (*NATS, error) {
+	n := &NATS{subject: subject}
+	if n.subject == "" {
+		n.subject = DefaultNATSSubject
+	}
+	if strings.Contains(server, "://") {
+		u, err := url.Parse(server)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server: %w", err)
+		}
+		if u.Scheme != "nats" {
+			return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+		}
+		server = u.Host
+		if u.User != nil {
+			if pw, ok := u.User.Password(); ok {
+				n.user, n.password = u.User.Username(), pw
+			} else {
+				n.token = u.User.Username()
+			}
+		}
+	}
+	if server == "" {
+		return nil, errors.New("missing server")
+	}
+	if strings.ContainsAny(n.subject, " \t\r\n*>") {
+		return nil, fmt.Errorf("invalid subject %q", n.subject)
+	}
+	n.server = withPort(server, DefaultNATSPort)
+	return n, nil
+}
+
+// Name implements Publisher.
+func (n *NATS) Name() string {
+	return "nats"
+}
+
+// Publish implements Publisher. It waits for the server to answer a PING
+// after the message, so an error means the message was not accepted.
+func (n *NATS) Publish(ctx context.Context, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, natsTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.server)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	rd := bufio.NewReader(conn)
+
+	// The server speaks first with INFO
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("read info: %w", err)
+	}
+	info, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+	var serverInfo struct {
+		TLSRequired bool `json:"tls_required"`
+		MaxPayload  int  `json:"max_payload"`
+	}
+	if err := json.Unmarshal([]byte(info), &serverInfo); err != nil {
+		return fmt.Errorf("invalid info: %w", err)
+	}
+	if serverInfo.TLSRequired {
+		return errors.New("server requires TLS, which is not supported")
+	}
+	if serverInfo.MaxPayload > 0 && len(data) > serverInfo.MaxPayload {
+		return fmt.Errorf("event of %d bytes exceeds the server's max payload", len(data))
+	}
+
+	opts := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "speedplane",
+		"lang":     "go",
+		"version":  "1",
+		"protocol": 0,
+	}
+	if n.user != "" {
+		opts["user"], opts["pass"] = n.user, n.password
+	}
+	if n.token != "" {
+		opts["auth_token"] = n.token
+	}
+	connect, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("CONNECT %s\r\nPUB %s.%s %d\r\n%s\r\nPING\r\n", connect, n.subject, e.Type, len(data), data)
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		return err
+	}
+
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("read reply: %w", err)
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// withPort adds port to addr unless it has one.
+func withPort(addr, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(addr, port)
+	}
+	return addr
+}
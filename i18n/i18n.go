@@ -0,0 +1,329 @@
+// Package i18n translates server-rendered strings and formats measurements
+// according to the configured locale and units.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultLocale is used when no locale is configured or a string has no
+// translation in the selected one.
+const DefaultLocale = "en"
+
+// catalogs maps a language to its translated strings. Keys missing from a
+// catalog fall back to DefaultLocale.
+var catalogs = map[string]map[string]string{
+	"en": {
+		"nav.dashboard":    "Dashboard",
+		"nav.results":      "Results",
+		"nav.preferences":  "Preferences",
+		"nav.about":        "About",
+		"nav.collapse":     "Collapse",
+		"action.run_now":   "Run speedtest now",
+		"action.custom":    "Advanced test",
+		"action.export":    "Export %s",
+		"panel.metrics":    "All Metrics",
+		"panel.results":    "Results",
+		"panel.appearance": "Appearance",
+		"panel.dashboard":  "Dashboard",
+		"panel.speedtest":  "Speedtest",
+		"panel.notify":     "Notifications",
+		"panel.unsaved":    "Unsaved Runs",
+		"action.save":      "Save",
+		"action.discard":   "Discard",
+		"label.theme":      "Theme",
+		"label.scheme":     "Color Scheme",
+		"label.per_page":   "Items per page",
+		"label.connection": "Connection",
+
+		"col.id":             "ID",
+		"col.timestamp":      "Timestamp",
+		"col.download":       "Download (%s)",
+		"col.upload":         "Upload (%s)",
+		"col.ping":           "Ping (ms)",
+		"col.jitter":         "Jitter (ms)",
+		"col.packet_loss":    "Packet Loss (%)",
+		"col.isp":            "ISP",
+		"col.external_ip":    "External IP",
+		"col.server_id":      "Server ID",
+		"col.server_name":    "Server Name",
+		"col.server_country": "Server Country",
+		"col.link_interface": "Interface",
+		"col.link_type":      "Link",
+		"col.link_speed":     "Link Speed (Mbps)",
+		"col.ssid":           "SSID",
+		"col.signal":         "Signal (dBm)",
+		"col.tags":           "Tags",
+		"col.connection":     "Connection",
+		"col.note":           "Note",
+
+		"status.title":      "Connection status",
+		"status.up":         "Online",
+		"status.down":       "Down",
+		"status.unknown":    "No data yet",
+		"status.latest":     "Latest test",
+		"status.averages":   "30-day averages",
+		"status.tests":      "%d tests",
+		"status.outages":    "Recent outages",
+		"status.no_outages": "No outages in the last 30 days",
+		"status.ongoing":    "ongoing",
+		"kiosk.next_run":    "Next test in",
+		"share.expires":     "Link expires",
+		"label.download":    "Download",
+		"label.upload":      "Upload",
+		"label.ping":        "Ping",
+		"label.jitter":      "Jitter",
+		"label.packet_loss": "Packet loss",
+	},
+	"de": {
+		"nav.dashboard":    "Übersicht",
+		"nav.results":      "Ergebnisse",
+		"nav.preferences":  "Einstellungen",
+		"nav.about":        "Info",
+		"nav.collapse":     "Einklappen",
+		"action.run_now":   "Speedtest jetzt starten",
+		"action.custom":    "Erweiterter Test",
+		"action.export":    "%s exportieren",
+		"panel.metrics":    "Alle Messwerte",
+		"panel.results":    "Ergebnisse",
+		"panel.appearance": "Darstellung",
+		"panel.dashboard":  "Übersicht",
+		"panel.speedtest":  "Speedtest",
+		"panel.notify":     "Benachrichtigungen",
+		"panel.unsaved":    "Nicht gespeicherte Tests",
+		"action.save":      "Speichern",
+		"action.discard":   "Verwerfen",
+		"label.theme":      "Design",
+		"label.scheme":     "Farbschema",
+		"label.per_page":   "Einträge pro Seite",
+		"label.connection": "Verbindung",
+
+		"col.timestamp":      "Zeitpunkt",
+		"col.upload":         "Upload (%s)",
+		"col.download":       "Download (%s)",
+		"col.packet_loss":    "Paketverlust (%)",
+		"col.isp":            "Anbieter",
+		"col.external_ip":    "Externe IP",
+		"col.server_id":      "Server-ID",
+		"col.server_name":    "Servername",
+		"col.server_country": "Serverland",
+		"col.link_interface": "Schnittstelle",
+		"col.link_type":      "Verbindung",
+		"col.link_speed":     "Linkgeschwindigkeit (Mbit/s)",
+		"col.ssid":           "SSID",
+		"col.signal":         "Signal (dBm)",
+		"col.tags":           "Tags",
+		"col.connection":     "Verbindung",
+		"col.note":           "Notiz",
+
+		"status.title":      "Verbindungsstatus",
+		"status.up":         "Online",
+		"status.down":       "Gestört",
+		"status.unknown":    "Noch keine Daten",
+		"status.latest":     "Letzter Test",
+		"status.averages":   "30-Tage-Durchschnitt",
+		"status.tests":      "%d Tests",
+		"status.outages":    "Letzte Ausfälle",
+		"status.no_outages": "Keine Ausfälle in den letzten 30 Tagen",
+		"status.ongoing":    "andauernd",
+		"kiosk.next_run":    "Nächster Test in",
+		"share.expires":     "Link gültig bis",
+		"label.packet_loss": "Paketverlust",
+	},
+	"fr": {
+		"nav.dashboard":    "Tableau de bord",
+		"nav.results":      "Résultats",
+		"nav.preferences":  "Préférences",
+		"nav.about":        "À propos",
+		"nav.collapse":     "Réduire",
+		"action.run_now":   "Lancer un test maintenant",
+		"action.custom":    "Test avancé",
+		"action.export":    "Exporter en %s",
+		"panel.metrics":    "Toutes les mesures",
+		"panel.results":    "Résultats",
+		"panel.appearance": "Apparence",
+		"panel.dashboard":  "Tableau de bord",
+		"panel.speedtest":  "Test de débit",
+		"panel.notify":     "Notifications",
+		"panel.unsaved":    "Tests non enregistrés",
+		"action.save":      "Enregistrer",
+		"action.discard":   "Ignorer",
+		"label.theme":      "Thème",
+		"label.scheme":     "Palette de couleurs",
+		"label.per_page":   "Éléments par page",
+		"label.connection": "Connexion",
+
+		"col.timestamp":      "Horodatage",
+		"col.download":       "Réception (%s)",
+		"col.upload":         "Envoi (%s)",
+		"col.packet_loss":    "Perte de paquets (%)",
+		"col.isp":            "FAI",
+		"col.external_ip":    "IP externe",
+		"col.server_id":      "ID du serveur",
+		"col.server_name":    "Nom du serveur",
+		"col.server_country": "Pays du serveur",
+		"col.link_interface": "Interface",
+		"col.link_type":      "Liaison",
+		"col.link_speed":     "Débit de liaison (Mbit/s)",
+		"col.ssid":           "SSID",
+		"col.signal":         "Signal (dBm)",
+		"col.tags":           "Étiquettes",
+		"col.connection":     "Connexion",
+		"col.note":           "Note",
+
+		"status.title":      "État de la connexion",
+		"status.up":         "En ligne",
+		"status.down":       "Hors service",
+		"status.unknown":    "Pas encore de données",
+		"status.latest":     "Dernier test",
+		"status.averages":   "Moyennes sur 30 jours",
+		"status.tests":      "%d tests",
+		"status.outages":    "Pannes récentes",
+		"status.no_outages": "Aucune panne ces 30 derniers jours",
+		"status.ongoing":    "en cours",
+		"kiosk.next_run":    "Prochain test dans",
+		"share.expires":     "Lien valable jusqu’au",
+		"label.download":    "Réception",
+		"label.upload":      "Envoi",
+		"label.jitter":      "Gigue",
+		"label.packet_loss": "Perte de paquets",
+	},
+	"es": {
+		"nav.dashboard":    "Panel",
+		"nav.results":      "Resultados",
+		"nav.preferences":  "Preferencias",
+		"nav.about":        "Acerca de",
+		"nav.collapse":     "Contraer",
+		"action.run_now":   "Ejecutar prueba ahora",
+		"action.custom":    "Prueba avanzada",
+		"action.export":    "Exportar %s",
+		"panel.metrics":    "Todas las métricas",
+		"panel.results":    "Resultados",
+		"panel.appearance": "Apariencia",
+		"panel.dashboard":  "Panel",
+		"panel.speedtest":  "Prueba de velocidad",
+		"panel.notify":     "Notificaciones",
+		"panel.unsaved":    "Pruebas sin guardar",
+		"action.save":      "Guardar",
+		"action.discard":   "Descartar",
+		"label.theme":      "Tema",
+		"label.scheme":     "Esquema de color",
+		"label.per_page":   "Elementos por página",
+		"label.connection": "Conexión",
+
+		"col.timestamp":      "Fecha y hora",
+		"col.download":       "Descarga (%s)",
+		"col.upload":         "Subida (%s)",
+		"col.packet_loss":    "Pérdida de paquetes (%)",
+		"col.isp":            "Proveedor",
+		"col.external_ip":    "IP externa",
+		"col.server_id":      "ID del servidor",
+		"col.server_name":    "Nombre del servidor",
+		"col.server_country": "País del servidor",
+		"col.link_interface": "Interfaz",
+		"col.link_type":      "Enlace",
+		"col.link_speed":     "Velocidad del enlace (Mbps)",
+		"col.ssid":           "SSID",
+		"col.signal":         "Señal (dBm)",
+		"col.tags":           "Etiquetas",
+		"col.connection":     "Conexión",
+		"col.note":           "Nota",
+
+		"status.title":      "Estado de la conexión",
+		"status.up":         "En línea",
+		"status.down":       "Caída",
+		"status.unknown":    "Aún no hay datos",
+		"status.latest":     "Última prueba",
+		"status.averages":   "Promedios de 30 días",
+		"status.tests":      "%d pruebas",
+		"status.outages":    "Cortes recientes",
+		"status.no_outages": "Sin cortes en los últimos 30 días",
+		"status.ongoing":    "en curso",
+		"kiosk.next_run":    "Próxima prueba en",
+		"share.expires":     "Enlace válido hasta",
+		"label.download":    "Descarga",
+		"label.upload":      "Subida",
+		"label.packet_loss": "Pérdida de paquetes",
+	},
+}
+
+// localeFormats holds the date layout and decimal separator for each locale.
+// Regional variants ("en-US") fall back to their language ("en").
+var localeFormats = map[string]struct {
+	date    string
+	decimal byte
+}{
+	"en":    {date: "2006-01-02", decimal: '.'},
+	"en-US": {date: "01/02/2006", decimal: '.'},
+	"en-GB": {date: "02/01/2006", decimal: '.'},
+	"de":    {date: "02.01.2006", decimal: ','},
+	"fr":    {date: "02/01/2006", decimal: ','},
+	"es":    {date: "02/01/2006", decimal: ','},
+}
+
+// Locales returns the supported locale identifiers, sorted.
+func Locales() []string {
+	out := make([]string, 0, len(localeFormats))
+	for locale := range localeFormats {
+		out = append(out, locale)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Normalize returns the supported locale matching locale, accepting either
+// "-" or "_" as separator and ignoring case, e.g. "de_DE" -> "de" and
+// "en-us" -> "en-US". Unknown locales return DefaultLocale.
+func Normalize(locale string) string {
+	locale = strings.ReplaceAll(strings.TrimSpace(locale), "_", "-")
+	if locale == "" {
+		return DefaultLocale
+	}
+	lang, region, _ := strings.Cut(locale, "-")
+	lang = strings.ToLower(lang)
+	if region != "" {
+		if full := lang + "-" + strings.ToUpper(region); hasLocale(full) {
+			return full
+		}
+	}
+	if hasLocale(lang) {
+		return lang
+	}
+	return DefaultLocale
+}
+
+// ValidateLocale returns an error if locale is set but not supported.
+func ValidateLocale(locale string) error {
+	if locale == "" {
+		return nil
+	}
+	lang, _, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+	if !hasLocale(strings.ToLower(lang)) {
+		return fmt.Errorf("unsupported locale %q (supported: %s)", locale, strings.Join(Locales(), ", "))
+	}
+	return nil
+}
+
+func hasLocale(locale string) bool {
+	_, ok := localeFormats[locale]
+	return ok
+}
+
+// T returns the translation of key in locale, falling back to DefaultLocale
+// and then to the key itself. Extra args are applied with fmt.Sprintf.
+func T(locale, key string, args ...interface{}) string {
+	lang, _, _ := strings.Cut(Normalize(locale), "-")
+	s, ok := catalogs[lang][key]
+	if !ok {
+		s, ok = catalogs[DefaultLocale][key]
+	}
+	if !ok {
+		s = key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(s, args...)
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+package i18n
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bandwidth units.
+const (
+	BandwidthMbps = "mbps" // megabits per second (default)
+	BandwidthMBps = "MBps" // megabytes per second
+)
+
+// Clock formats.
+const (
+	Clock24h = "24h" // default
+	Clock12h = "12h"
+)
+
+// ValidateUnits returns an error if bandwidth or clock is set to an unknown value.
+func ValidateUnits(bandwidth, clock string) error {
+	switch bandwidth {
+	case "", BandwidthMbps, BandwidthMBps:
+	default:
+		return fmt.Errorf("unsupported bandwidth unit %q (use %q or %q)", bandwidth, BandwidthMbps, BandwidthMBps)
+	}
+	switch clock {
+	case "", Clock24h, Clock12h:
+	default:
+		return fmt.Errorf("unsupported clock %q (use %q or %q)", clock, Clock24h, Clock12h)
+	}
+	return nil
+}
+
+// Formatter renders strings and measurements for one locale and set of units.
+// The zero value formats in English with Mbps and a 24-hour clock.
+type Formatter struct {
+	Locale    string
+	Bandwidth string
+	Clock     string
+}
+
+// NewFormatter returns a Formatter with locale normalized and unknown units
+// replaced by their defaults.
+func NewFormatter(locale, bandwidth, clock string) Formatter {
+	if bandwidth != BandwidthMBps {
+		bandwidth = BandwidthMbps
+	}
+	if clock != Clock12h {
+		clock = Clock24h
+	}
+	return Formatter{Locale: Normalize(locale), Bandwidth: bandwidth, Clock: clock}
+}
+
+// T translates key in the formatter's locale.
+func (f Formatter) T(key string, args ...interface{}) string {
+	return T(f.Locale, key, args...)
+}
+
+// Lang returns the language part of the locale, for <html lang>.
+func (f Formatter) Lang() string {
+	lang, _, _ := strings.Cut(Normalize(f.Locale), "-")
+	return lang
+}
+
+// BandwidthUnit returns the display label for the bandwidth unit.
+func (f Formatter) BandwidthUnit() string {
+	if f.Bandwidth == BandwidthMBps {
+		return "MB/s"
+	}
+	return "Mbps"
+}
+
+// ConvertBandwidth converts a value in Mbps to the configured unit.
+func (f Formatter) ConvertBandwidth(mbps float64) float64 {
+	if f.Bandwidth == BandwidthMBps {
+		return mbps / 8
+	}
+	return mbps
+}
+
+// FormatBandwidth formats a value in Mbps in the configured unit, without the unit label.
+func (f Formatter) FormatBandwidth(mbps float64) string {
+	return f.FormatNumber(f.ConvertBandwidth(mbps), 2)
+}
+
+// FormatNumber formats v with the given number of decimals using the
+// locale's decimal separator.
+func (f Formatter) FormatNumber(v float64, decimals int) string {
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	if sep := f.DecimalSeparator(); sep != '.' {
+		s = strings.Replace(s, ".", string(sep), 1)
+	}
+	return s
+}
+
+// DecimalSeparator returns the locale's decimal separator.
+func (f Formatter) DecimalSeparator() byte {
+	return localeFormats[Normalize(f.Locale)].decimal
+}
+
+// CSVDelimiter returns the field separator spreadsheets expect for the
+// locale: ';' where ',' is the decimal separator.
+func (f Formatter) CSVDelimiter() rune {
+	if f.DecimalSeparator() == ',' {
+		return ';'
+	}
+	return ','
+}
+
+// FormatDateTime formats t with the locale's date layout and the configured clock.
+func (f Formatter) FormatDateTime(t time.Time) string {
+	return f.FormatDate(t) + " " + f.FormatTime(t)
+}
+
+// FormatDate formats t with the locale's date layout.
+func (f Formatter) FormatDate(t time.Time) string {
+	return t.Format(localeFormats[Normalize(f.Locale)].date)
+}
+
+// FormatTime formats the time of day of t with the configured clock.
+func (f Formatter) FormatTime(t time.Time) string {
+	if f.Clock == Clock12h {
+		return t.Format("3:04:05 PM")
+	}
+	return t.Format("15:04:05")
+}
@@ -0,0 +1,371 @@
+// Package ingest maps measurements reported by external tools, such as
+// router speedtest scripts or Starlink exporters, to results.
+package ingest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"speedplane/model"
+)
+
+// Field maps a result field to a value in the tool's JSON.
+type Field struct {
+	// Path is a dot-separated list of object keys and array indexes, e.g.
+	// "download.bandwidth" or "servers.0.name".
+	Path string
+	// Scale multiplies numeric values, e.g. 0.000008 to convert bytes per
+	// second to Mbps, or 0.001 for timestamps in Unix milliseconds. Zero
+	// means 1.
+	Scale float64
+	// Unit names the unit of a speed ("bps", "kbps", "Mbps", "Gbps", "B/s",
+	// "kB/s", "MB/s" or "GB/s") or of ping and jitter ("s", "ms" or "us"),
+	// as an alternative to Scale.
+	Unit string
+	// Format is the Go time layout of timestamps that are neither RFC 3339
+	// nor Unix seconds, e.g. "2006-01-02 15:04:05". Timestamps without a
+	// zone are read in the mapping's location.
+	Format string
+}
+
+// speedUnits and durationUnits are the units Field.Unit accepts, by lower
+// case name, with the scale to Mbps and milliseconds.
+var (
+	speedUnits = map[string]float64{
+		"bps":  0.000001,
+		"kbps": 0.001,
+		"mbps": 1,
+		"gbps": 1000,
+		"b/s":  0.000008,
+		"kb/s": 0.008,
+		"mb/s": 8,
+		"gb/s": 8000,
+	}
+	durationUnits = map[string]float64{
+		"s":  1000,
+		"ms": 1,
+		"us": 0.001,
+		"µs": 0.001,
+	}
+)
+
+type kind int
+
+const (
+	kindText kind = iota
+	kindNumber
+	kindTime
+)
+
+// targets are the result fields that can be mapped.
+var targets = map[string]kind{
+	"id":              kindText,
+	"timestamp":       kindTime,
+	"download_mbps":   kindNumber,
+	"upload_mbps":     kindNumber,
+	"ping_ms":         kindNumber,
+	"jitter_ms":       kindNumber,
+	"packet_loss_pct": kindNumber,
+	"isp":             kindText,
+	"external_ip":     kindText,
+	"server_id":       kindText,
+	"server_name":     kindText,
+	"server_country":  kindText,
+}
+
+// Mapping converts a tool's JSON to results. Fields that aren't mapped are
+// read from the key of the same name, so results in speedplane's own format
+// need no mapping.
+type Mapping struct {
+	fields map[string]Field
+	loc    *time.Location
+}
+
+// NewMapping creates a Mapping, checking that fields only name result
+// fields and that their units and formats fit them. Timestamps with a
+// Format but no zone are read in loc, or UTC if it is nil.
+func NewMapping(fields map[string]Field, loc *time.Location) (*Mapping, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	m := &Mapping{fields: make(map[string]Field, len(targets)), loc: loc}
+	for name := range targets {
+		m.fields[name] = Field{Path: name}
+	}
+	for name, f := range fields {
+		if _, ok := targets[name]; !ok {
+			return nil, fmt.Errorf("unknown field %q (want one of %s)", name, strings.Join(TargetNames(), ", "))
+		}
+		if f.Path == "" {
+			return nil, fmt.Errorf("field %q: path is empty", name)
+		}
+		if f.Unit != "" {
+			if f.Scale != 0 {
+				return nil, fmt.Errorf("field %q: set unit or scale, not both", name)
+			}
+			units := speedUnits
+			switch name {
+			case "download_mbps", "upload_mbps":
+			case "ping_ms", "jitter_ms":
+				units = durationUnits
+			default:
+				return nil, fmt.Errorf("field %q: has no unit", name)
+			}
+			scale, ok := units[strings.ToLower(f.Unit)]
+			if !ok {
+				return nil, fmt.Errorf("field %q: unknown unit %q", name, f.Unit)
+			}
+			f.Scale, f.Unit = scale, ""
+		}
+		if f.Format != "" && targets[name] != kindTime {
+			return nil, fmt.Errorf("field %q: format is only for timestamps", name)
+		}
+		m.fields[name] = f
+	}
+	return m, nil
+}
+
+// TargetNames returns the result fields that can be mapped, sorted.
+func TargetNames() []string {
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Result maps one measurement. download_mbps is required; the timestamp
+// defaults to now. The measurement is kept as the result's raw output.
+func (m *Mapping) Result(raw json.RawMessage) (model.SpeedtestResult, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return model.SpeedtestResult{}, err
+	}
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return model.SpeedtestResult{}, fmt.Errorf("measurement is not a JSON object")
+	}
+
+	res := model.SpeedtestResult{RawJSON: append(json.RawMessage(nil), raw...)}
+	numbers := map[string]*float64{
+		"download_mbps":   &res.DownloadMbps,
+		"upload_mbps":     &res.UploadMbps,
+		"ping_ms":         &res.PingMs,
+		"jitter_ms":       &res.JitterMs,
+		"packet_loss_pct": &res.PacketLossPct,
+	}
+	texts := map[string]*string{
+		"id":             &res.ID,
+		"isp":            &res.ISP,
+		"external_ip":    &res.ExternalIP,
+		"server_id":      &res.ServerID,
+		"server_name":    &res.ServerName,
+		"server_country": &res.ServerCountry,
+	}
+
+	for _, name := range TargetNames() {
+		f := m.fields[name]
+		v, ok := lookup(doc, f.Path)
+		if !ok || v == nil {
+			if name == "download_mbps" {
+				return model.SpeedtestResult{}, fmt.Errorf("download_mbps: %q not found", f.Path)
+			}
+			continue
+		}
+		switch targets[name] {
+		case kindNumber:
+			n, err := number(v, f.Scale)
+			if err != nil {
+				return model.SpeedtestResult{}, fmt.Errorf("%s: %q: %w", name, f.Path, err)
+			}
+			if n < 0 {
+				return model.SpeedtestResult{}, fmt.Errorf("%s: %q is negative", name, f.Path)
+			}
+			*numbers[name] = n
+		case kindText:
+			*texts[name] = text(v)
+		case kindTime:
+			t, err := timestamp(v, f.Scale, f.Format, m.loc)
+			if err != nil {
+				return model.SpeedtestResult{}, fmt.Errorf("timestamp: %q: %w", f.Path, err)
+			}
+			res.Timestamp = t
+		}
+	}
+	if res.Timestamp.IsZero() {
+		res.Timestamp = time.Now()
+	}
+	res.Timestamp = res.Timestamp.UTC()
+	return res, nil
+}
+
+// lookup follows a dot-separated path of keys and array indexes. A key
+// holding the whole path, such as a CSV column named "speed.down", is
+// preferred.
+func lookup(doc interface{}, path string) (interface{}, bool) {
+	if obj, ok := doc.(map[string]interface{}); ok {
+		if v, ok := obj[path]; ok {
+			return v, true
+		}
+	}
+	v := doc
+	for _, part := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			next, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// number reads a JSON number, or a string holding one, times scale.
+func number(v interface{}, scale float64) (float64, error) {
+	var n float64
+	var err error
+	switch v := v.(type) {
+	case json.Number:
+		n, err = v.Float64()
+	case string:
+		n, err = strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case bool:
+		return 0, fmt.Errorf("is a boolean, not a number")
+	default:
+		return 0, fmt.Errorf("is not a number")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("is not a number")
+	}
+	if scale != 0 {
+		n *= scale
+	}
+	return n, nil
+}
+
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// timestamp reads a string in the given layout, an RFC 3339 string, or a
+// number of Unix seconds times scale.
+func timestamp(v interface{}, scale float64, layout string, loc *time.Location) (time.Time, error) {
+	if s, ok := v.(string); ok {
+		s = strings.TrimSpace(s)
+		if layout != "" {
+			t, err := time.ParseInLocation(layout, s, loc)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("doesn't match format %q", layout)
+			}
+			return t, nil
+		}
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t, nil
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return time.Time{}, fmt.Errorf("is neither RFC 3339 nor Unix seconds")
+		}
+	}
+	sec, err := number(v, scale)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(sec*float64(time.Second))), nil
+}
+
+// Split reads a request body holding one measurement, a JSON array of them,
+// or JSON Lines, and returns each measurement.
+func Split(r io.Reader) ([]json.RawMessage, error) {
+	dec := json.NewDecoder(r)
+	var out []json.RawMessage
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return out, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if t := bytes.TrimSpace(raw); len(t) > 0 && t[0] == '[' {
+			var list []json.RawMessage
+			if err := json.Unmarshal(raw, &list); err != nil {
+				return nil, err
+			}
+			out = append(out, list...)
+			continue
+		}
+		out = append(out, raw)
+	}
+}
+
+// SplitCSV reads a CSV export with a header row, such as a router's or
+// another app's history, and returns its header and each row as a JSON
+// object keyed by column name, so a Mapping's paths name columns. Empty
+// cells are left out, so they read as missing.
+func SplitCSV(r io.Reader, comma rune) ([]string, []json.RawMessage, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1 // Cells past the header, e.g. from trailing commas, are ignored
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("no header row")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// Spreadsheet apps often start UTF-8 files with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	var rows []json.RawMessage
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return header, rows, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		row := make(map[string]string, len(record))
+		for i, cell := range record[:min(len(record), len(header))] {
+			if cell = strings.TrimSpace(cell); cell != "" && header[i] != "" {
+				row[header[i]] = cell
+			}
+		}
+		raw, err := json.Marshal(row)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows = append(rows, raw)
+	}
+}
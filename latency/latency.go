@@ -0,0 +1,279 @@
+// Package latency measures working latency: the round-trip time to a host,
+// such as a game server, with the link idle and then while a download and
+// an upload saturate it. The difference is the lag players and callers
+// notice when someone else on the network is streaming or uploading.
+package latency
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"speedplane/model"
+	"speedplane/probe"
+)
+
+// Defaults used when a Tester option is zero.
+const (
+	DefaultDownloadURL = "https://speed.cloudflare.com/__down?bytes=250000000"
+	DefaultUploadURL   = "https://speed.cloudflare.com/__up"
+	DefaultStreams     = 4
+	DefaultCount       = 20
+	DefaultWarmup      = 2 * time.Second
+
+	uploadChunk = 25 << 20 // Bytes per upload request
+)
+
+var (
+	// ErrBusy is returned by Test while another test is running.
+	ErrBusy = errors.New("a working latency test is already running")
+	// ErrUnknownTarget is returned by Test for a target name that isn't configured.
+	ErrUnknownTarget = errors.New("unknown target")
+)
+
+// Tester runs working latency tests against configured targets, one at a
+// time so tests don't load the link for each other.
+type Tester struct {
+	Targets     []probe.Target
+	Count       int           // Packets per phase
+	Streams     int           // Parallel transfers loading the link
+	Warmup      time.Duration // How long the link is loaded before probing starts
+	DownloadURL string
+	UploadURL   string
+
+	mu     sync.Mutex
+	client *http.Client
+}
+
+// Test runs a test against the named target, or the first one when name is
+// empty. A load phase that fails is recorded in the result's Error rather
+// than failing the test.
+func (t *Tester) Test(ctx context.Context, name string) (model.WorkingLatency, error) {
+	target, ok := t.target(name)
+	if !ok {
+		return model.WorkingLatency{}, ErrUnknownTarget
+	}
+	if !t.mu.TryLock() {
+		return model.WorkingLatency{}, ErrBusy
+	}
+	defer t.mu.Unlock()
+	if t.client == nil {
+		t.client = newClient()
+	}
+
+	res := model.WorkingLatency{
+		Timestamp: time.Now().UTC(),
+		Target:    target.Name,
+		Kind:      target.Kind,
+		Address:   target.Address,
+	}
+	count := t.Count
+	if count <= 0 {
+		count = DefaultCount
+	}
+	prober := &probe.Prober{Targets: []probe.Target{target}, Count: count}
+
+	idle := prober.Round(ctx)[0]
+	if ctx.Err() != nil {
+		return model.WorkingLatency{}, ctx.Err()
+	}
+	if idle.Error != "" {
+		res.Error = "idle: " + idle.Error
+		return res, nil
+	}
+	res.IdleMs, res.IdleLossPct = idle.RTTAvgMs, idle.LossPct
+
+	var errs []string
+	down, mbps, err := t.loaded(ctx, prober, t.download)
+	res.DownloadMs, res.DownloadLossPct, res.DownloadMbps = down.RTTAvgMs, down.LossPct, mbps
+	if err != nil {
+		errs = append(errs, "download: "+err.Error())
+	}
+	up, mbps, err := t.loaded(ctx, prober, t.upload)
+	res.UploadMs, res.UploadLossPct, res.UploadMbps = up.RTTAvgMs, up.LossPct, mbps
+	if err != nil {
+		errs = append(errs, "upload: "+err.Error())
+	}
+	if ctx.Err() != nil {
+		return model.WorkingLatency{}, ctx.Err()
+	}
+
+	res.Error = strings.Join(errs, "; ")
+	return res, nil
+}
+
+// Run tests every target every interval until ctx is cancelled, passing
+// each result to save. Targets are skipped while another test is running.
+func (t *Tester) Run(ctx context.Context, interval time.Duration, save func(model.WorkingLatency)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, target := range t.Targets {
+			res, err := t.Test(ctx, target.Name)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Printf("[latency] %s: %v", target.Name, err)
+				continue
+			}
+			save(res)
+		}
+	}
+}
+
+func (t *Tester) target(name string) (probe.Target, bool) {
+	if name == "" && len(t.Targets) > 0 {
+		return t.Targets[0], true
+	}
+	for _, target := range t.Targets {
+		if target.Name == name {
+			return target, true
+		}
+	}
+	return probe.Target{}, false
+}
+
+// loaded starts Streams transfers with load, waits Warmup for them to ramp
+// up, and probes while they run. It returns the probe round and the
+// throughput the transfers reached while probing.
+func (t *Tester) loaded(ctx context.Context, prober *probe.Prober, load func(ctx context.Context, n *atomic.Int64) error) (model.ProbeResult, float64, error) {
+	streams := t.Streams
+	if streams <= 0 {
+		streams = DefaultStreams
+	}
+	warmup := t.Warmup
+	if warmup <= 0 {
+		warmup = DefaultWarmup
+	}
+
+	loadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var transferred atomic.Int64
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var loadErr error
+	for i := 0; i < streams; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for loadCtx.Err() == nil {
+				if err := load(loadCtx, &transferred); err != nil {
+					if loadCtx.Err() == nil {
+						errOnce.Do(func() { loadErr = err })
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(warmup):
+	}
+	start, before := time.Now(), transferred.Load()
+	res := prober.Round(loadCtx)[0]
+	elapsed, n := time.Since(start), transferred.Load()-before
+	cancel()
+	wg.Wait()
+
+	if n == 0 {
+		if loadErr == nil {
+			loadErr = errors.New("no data transferred")
+		}
+		return res, 0, loadErr
+	}
+	mbps := float64(n) * 8 / elapsed.Seconds() / 1e6
+	if res.Error != "" {
+		return res, mbps, errors.New(res.Error)
+	}
+	return res, mbps, nil
+}
+
+func (t *Tester) download(ctx context.Context, n *atomic.Int64) error {
+	url := t.DownloadURL
+	if url == "" {
+		url = DefaultDownloadURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	_, err = io.Copy(io.Discard, &countingReader{r: resp.Body, n: n})
+	return err
+}
+
+func (t *Tester) upload(ctx context.Context, n *atomic.Int64) error {
+	url := t.UploadURL
+	if url == "" {
+		url = DefaultUploadURL
+	}
+	body := &countingReader{r: io.LimitReader(zeros{}, uploadChunk), n: n}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = uploadChunk
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+// newClient returns a client that doesn't negotiate HTTP/2, so each stream
+// gets its own TCP connection like a browser's parallel downloads rather
+// than sharing one.
+func newClient() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		Proxy:              http.ProxyFromEnvironment,
+		DisableCompression: true,
+		TLSNextProto:       map[string]func(string, *tls.Conn) http.RoundTripper{},
+	}}
+}
+
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
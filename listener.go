@@ -0,0 +1,130 @@
+package speedplane
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// unixPrefix marks a listen address as a Unix domain socket path.
+const unixPrefix = "unix:"
+
+// listenAll opens a listener for every address. Addresses prefixed with
+// "unix:" are bound as Unix domain sockets and chmod'ed to socketMode
+// (octal, e.g. "0660"); everything else is treated as a TCP host:port.
+// If any listener fails, the ones already opened are closed.
+func listenAll(addrs []string, socketMode string) ([]net.Listener, error) {
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+	}
+
+	for _, addr := range addrs {
+		l, err := openListener(addr, socketMode)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("listen on %s: %w", addr, err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+func openListener(addr, socketMode string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, unixPrefix) {
+		return net.Listen("tcp", addr)
+	}
+
+	path := strings.TrimPrefix(addr, unixPrefix)
+	if path == "" {
+		return nil, fmt.Errorf("empty socket path")
+	}
+
+	// Remove a stale socket left behind by an unclean shutdown
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if socketMode != "" {
+		mode, err := strconv.ParseUint(socketMode, 8, 32)
+		if err != nil {
+			_ = l.Close()
+			return nil, fmt.Errorf("invalid socket mode %q: %w", socketMode, err)
+		}
+		if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+			_ = l.Close()
+			return nil, fmt.Errorf("chmod socket: %w", err)
+		}
+	}
+
+	return l, nil
+}
+
+// printListeningAddresses logs where the server can be reached for each address.
+func printListeningAddresses(addrs []string) {
+	for _, addr := range addrs {
+		if strings.HasPrefix(addr, unixPrefix) {
+			log.Printf("listening on %s", addr)
+			continue
+		}
+		printTCPAddress(addr)
+	}
+}
+
+// tcpPort returns the port of the first TCP address, or 0 if there is none.
+func tcpPort(addrs []string) int {
+	for _, addr := range addrs {
+		if strings.HasPrefix(addr, unixPrefix) {
+			continue
+		}
+		if _, port, err := net.SplitHostPort(addr); err == nil {
+			if n, err := strconv.Atoi(port); err == nil {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+func printTCPAddress(addr string) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		log.Printf("listening on http://%s", addr)
+		return
+	}
+
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		// Listening on all interfaces
+		addrs, err := net.InterfaceAddrs()
+		if err == nil {
+			log.Println("listening on:")
+			for _, a := range addrs {
+				if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+					if ipnet.IP.To4() != nil {
+						log.Printf("  http://%s:%s", ipnet.IP.String(), port)
+					}
+				}
+			}
+			// Also show localhost
+			log.Printf("  http://localhost:%s", port)
+			log.Printf("  http://127.0.0.1:%s", port)
+		} else {
+			log.Printf("listening on http://0.0.0.0:%s", port)
+		}
+	} else {
+		log.Printf("listening on http://%s:%s", host, port)
+	}
+}
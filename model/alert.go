@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// AlertRecord is an alert event kept in the alert history: a rule becoming
+// degraded or recovering, a reminder, or an event raised outside the rules
+// such as the disk filling up.
+type AlertRecord struct {
+	ID             int64      `json:"id"`
+	Time           time.Time  `json:"time"`
+	Kind           string     `json:"kind"` // degraded, recovered or reminder
+	RuleID         string     `json:"rule_id"`
+	RuleName       string     `json:"rule_name"`
+	Metric         string     `json:"metric"`
+	Operator       string     `json:"operator"`
+	Threshold      float64    `json:"threshold"`
+	Value          float64    `json:"value"`
+	Severity       string     `json:"severity"`
+	Since          time.Time  `json:"since"`              // When the incident started; shared by its events
+	Schedule       string     `json:"schedule,omitempty"` // ID of the schedule whose alert overrides raised it
+	ResultID       string     `json:"result_id,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	Snoozed        bool       `json:"snoozed,omitempty"` // Recorded while the rule was snoozed, so not sent
+}
+
+// AlertSnooze holds back the notifications of a rule until Until, see
+// alert.Engine.Snooze. It is kept so snoozes outlast restarts.
+type AlertSnooze struct {
+	Schedule string    `json:"schedule,omitempty"` // ID of the schedule with the alert overrides the rule belongs to; empty for the global rules
+	RuleID   string    `json:"rule_id"`
+	Until    time.Time `json:"until"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Annotation kinds.
+const (
+	AnnotationMaintenance = "maintenance" // Planned downtime; no tests or probes ran
+	AnnotationClockJump   = "clock_jump"  // The system clock jumped from Start to End, or back
+)
+
+// Annotation marks a period on the history, such as a maintenance window,
+// with a note explaining it.
+type Annotation struct {
+	ID    int64     `json:"id"`
+	Kind  string    `json:"kind"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Text  string    `json:"text,omitempty"`
+}
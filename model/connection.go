@@ -0,0 +1,11 @@
+package model
+
+// DefaultConnection names the connection tests run over when no named
+// connection is selected. Results stored without a connection belong to it.
+const DefaultConnection = "default"
+
+// ValidateConnection checks that a connection name follows the same rules as
+// tags, so names stay safe to use in URLs, filters and CSV.
+func ValidateConnection(name string) error {
+	return validateLabel("connection", name)
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"math"
+	"sort"
+)
+
+// MinConsistencyResults is how many measurements of a metric a period needs
+// before its consistency is scored; a tail percentile of fewer says nothing.
+const MinConsistencyResults = 5
+
+// Consistency describes how steady a period's results were, as opposed to
+// how fast they were on average. A line that averages its plan speed but
+// dips every few tests drops video calls all the same; its averages look
+// fine while its consistency doesn't.
+type Consistency struct {
+	Download *MetricConsistency `json:"download,omitempty"` // Unset with fewer than MinConsistencyResults measurements
+	Upload   *MetricConsistency `json:"upload,omitempty"`
+	Ping     *MetricConsistency `json:"ping,omitempty"`
+	Score    float64            `json:"score"` // 0 to 100, the average of the metrics' scores times 100
+}
+
+// MetricConsistency compares one metric's tail, the value one test in twenty
+// does worse than, with its median. For speeds the tail is the 5th
+// percentile and the ratio is P5/median; for ping, where higher is worse,
+// it is the 95th percentile and the ratio is median/P95. Either way a ratio
+// of 1 means the worst tests were as good as a typical one.
+type MetricConsistency struct {
+	Median float64 `json:"median"`
+	P5     float64 `json:"p5,omitempty"`  // Download and upload
+	P95    float64 `json:"p95,omitempty"` // Ping
+	Ratio  float64 `json:"ratio"`
+	CVPct  float64 `json:"cv_pct"` // Standard deviation in percent of the mean
+	Score  float64 `json:"score"`  // Ratio scaled down by the variation, capped at 100%; 0 to 1
+}
+
+// ComputeConsistency scores the consistency of results. Negative (missing)
+// values and phases that failed in partial results are left out. It returns
+// nil when no metric has MinConsistencyResults measurements.
+func ComputeConsistency(results []SpeedtestResult) *Consistency {
+	var down, up, ping []float64
+	for _, r := range results {
+		if r.DownloadMbps >= 0 && !r.PhaseFailed("download") {
+			down = append(down, r.DownloadMbps)
+		}
+		if r.UploadMbps >= 0 && !r.PhaseFailed("upload") {
+			up = append(up, r.UploadMbps)
+		}
+		if r.PingMs >= 0 && !r.PhaseFailed("ping") {
+			ping = append(ping, r.PingMs)
+		}
+	}
+
+	c := &Consistency{
+		Download: metricConsistency(down, false),
+		Upload:   metricConsistency(up, false),
+		Ping:     metricConsistency(ping, true),
+	}
+	var sum float64
+	n := 0
+	for _, m := range []*MetricConsistency{c.Download, c.Upload, c.Ping} {
+		if m != nil {
+			sum += m.Score
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	c.Score = sum / float64(n) * 100
+	return c
+}
+
+// metricConsistency scores values, of a metric where lower values are
+// better when lowerIsBetter is set.
+func metricConsistency(values []float64, lowerIsBetter bool) *MetricConsistency {
+	if len(values) < MinConsistencyResults {
+		return nil
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	m := &MetricConsistency{
+		Median: median(sorted),
+		CVPct:  coefficientOfVariation(sorted) * 100,
+	}
+	if lowerIsBetter {
+		m.P95 = percentile(sorted, 0.95)
+		if m.P95 > 0 {
+			m.Ratio = m.Median / m.P95
+		}
+	} else {
+		m.P5 = percentile(sorted, 0.05)
+		if m.Median > 0 {
+			m.Ratio = m.P5 / m.Median
+		}
+	}
+	m.Score = m.Ratio * (1 - math.Min(m.CVPct, 100)/100)
+	return m
+}
+
+// percentile interpolates the p quantile (0 to 1) of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := float64(len(sorted)-1) * p
+	lower := int(index)
+	upper := min(lower+1, len(sorted)-1)
+	weight := index - float64(lower)
+	return sorted[lower]*(1-weight) + sorted[upper]*weight
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Speedtest engines.
+const (
+	// EngineOokla tests against the Ookla server network with speedtest-go.
+	EngineOokla = "ookla"
+	// EngineCloudflare tests against speed.cloudflare.com.
+	EngineCloudflare = "cloudflare"
+)
+
+// Engines lists the supported engines, the default first, followed by those
+// added with RegisterEngine.
+var Engines = []string{EngineOokla, EngineCloudflare}
+
+// RegisterEngine adds an engine provided by a plugin to Engines, after the
+// built-in ones. It is called at startup, before schedules are validated.
+func RegisterEngine(name string) error {
+	if name == "" {
+		return fmt.Errorf("missing engine name")
+	}
+	if slices.Contains(Engines, name) {
+		return fmt.Errorf("engine %q already exists", name)
+	}
+	Engines = append(Engines, name)
+	return nil
+}
+
+// ValidateEngines checks that every engine is supported and listed once.
+func ValidateEngines(engines []string) error {
+	for i, e := range engines {
+		if !slices.Contains(Engines, e) {
+			return fmt.Errorf("unknown engine %q", e)
+		}
+		if slices.Contains(engines[:i], e) {
+			return fmt.Errorf("engine %q is listed twice", e)
+		}
+	}
+	return nil
+}
+
+// EngineComparison compares the results of engines run back to back in one
+// scheduled slot. A test can be held back by its server but can't be faster
+// than the line, so the consensus is the best result of any engine, and a
+// large divergence points at a test server rather than the line as the
+// bottleneck of the slower result.
+type EngineComparison struct {
+	ID                    int64     `json:"id"`
+	Timestamp             time.Time `json:"timestamp"` // Of the first result
+	Connection            string    `json:"connection,omitempty"`
+	ResultIDs             []string  `json:"result_ids"`
+	Engines               []string  `json:"engines"`       // In the order of ResultIDs
+	DownloadMbps          float64   `json:"download_mbps"` // Highest download of any engine
+	UploadMbps            float64   `json:"upload_mbps"`
+	PingMs                float64   `json:"ping_ms"`                 // Lowest ping of any engine
+	DownloadDivergencePct float64   `json:"download_divergence_pct"` // How far the lowest download is below the highest, in percent of the highest
+	UploadDivergencePct   float64   `json:"upload_divergence_pct"`
+}
+
+// CompareEngines compares results of one slot, which need at least two.
+func CompareEngines(results []*SpeedtestResult) EngineComparison {
+	c := EngineComparison{Timestamp: results[0].Timestamp, Connection: results[0].Connection}
+	minDown, minUp := results[0].DownloadMbps, results[0].UploadMbps
+	c.PingMs = results[0].PingMs
+	for _, r := range results {
+		c.ResultIDs = append(c.ResultIDs, r.ID)
+		c.Engines = append(c.Engines, r.Engine)
+		c.DownloadMbps = max(c.DownloadMbps, r.DownloadMbps)
+		c.UploadMbps = max(c.UploadMbps, r.UploadMbps)
+		c.PingMs = min(c.PingMs, r.PingMs)
+		minDown = min(minDown, r.DownloadMbps)
+		minUp = min(minUp, r.UploadMbps)
+	}
+	c.DownloadDivergencePct = divergencePct(minDown, c.DownloadMbps)
+	c.UploadDivergencePct = divergencePct(minUp, c.UploadMbps)
+	return c
+}
+
+func divergencePct(low, high float64) float64 {
+	if high <= 0 {
+		return 0
+	}
+	return (high - low) / high * 100
+}
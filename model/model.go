@@ -20,8 +20,88 @@ type SpeedtestResult struct {
     ServerID      string          `json:"server_id,omitempty"`
     ServerName    string          `json:"server_name,omitempty"`
     ServerCountry string          `json:"server_country,omitempty"`
+    Engine        string          `json:"engine,omitempty"` // EngineOokla or EngineCloudflare; empty for results from before engines could be chosen, or from other tools
+
+    Link          *LinkInfo       `json:"link,omitempty"` // Egress interface the test ran over, when detectable
+    LAN           *LANHealth      `json:"lan,omitempty"`  // Gateway, DNS and interface health at test time, when enabled
+    PathMTU       *PathMTU        `json:"path_mtu,omitempty"` // Path MTU to the test server, when enabled
+    Tags          []string        `json:"tags,omitempty"` // Labels such as why the test ran, e.g. "reconnect"
+    Connection    string          `json:"connection,omitempty"` // Named connection the test ran over; empty for the default connection
+    Note          string          `json:"note,omitempty"` // Free text, e.g. added by a post-processing hook
+    Phases        map[string]PhaseStatus `json:"phases,omitempty"` // By phase name; only set when a phase failed and the others were kept
+    Timings       *PhaseTimings   `json:"timings,omitempty"` // How long each phase took, for tests run by speedplane
 
     RawJSON json.RawMessage `json:"raw_json,omitempty"`
+    Signature string        `json:"signature,omitempty"` // Base64 Ed25519 signature made at capture, see package signing
+}
+
+// LinkType classifies the interface a test ran over.
+type LinkType string
+
+const (
+    // LinkWired is an Ethernet interface, or a bridge without wireless members.
+    LinkWired LinkType = "wired"
+    // LinkWiFi is a wireless interface.
+    LinkWiFi LinkType = "wifi"
+    // LinkVirtual is a tunnel, VPN or PPP interface.
+    LinkVirtual LinkType = "virtual"
+    // LinkUnknown is used when the interface was found but can't be classified.
+    LinkUnknown LinkType = "unknown"
+)
+
+// LinkInfo describes the local network link a test ran over.
+type LinkInfo struct {
+    Interface string   `json:"interface"`
+    Type      LinkType `json:"type"`
+    SpeedMbps int      `json:"speed_mbps,omitempty"` // Negotiated link rate; the current TX bitrate for Wi-Fi
+    SSID      string   `json:"ssid,omitempty"`
+    SignalDBm int      `json:"signal_dbm,omitempty"`
+}
+
+// LANHealth is a snapshot of the local network taken around a test, to tell
+// a slow ISP apart from a struggling router or interface.
+type LANHealth struct {
+    Gateway   *PingStats         `json:"gateway,omitempty"`
+    DNS       *PingStats         `json:"dns,omitempty"`
+    Interface *InterfaceCounters `json:"interface,omitempty"` // Counter increases over the test
+}
+
+// PathMTU is the largest packet that reached the test server without being
+// fragmented, found before a test. An MTU below the link's, e.g. after a
+// switch to PPPoE, stalls connections whose large packets are dropped.
+type PathMTU struct {
+    Address string `json:"address"`
+    MTU     int    `json:"mtu,omitempty"`
+    Error   string `json:"error,omitempty"`
+}
+
+// PingStats is the outcome of a short ICMP ping to a LAN or DNS host.
+type PingStats struct {
+    Address  string  `json:"address"`
+    RTTAvgMs float64 `json:"rtt_avg_ms,omitempty"`
+    LossPct  float64 `json:"loss_pct"`
+    Error    string  `json:"error,omitempty"`
+}
+
+// InterfaceCounters holds network interface error and drop counts.
+type InterfaceCounters struct {
+    RxErrors  uint64 `json:"rx_errors"`
+    TxErrors  uint64 `json:"tx_errors"`
+    RxDropped uint64 `json:"rx_dropped"`
+    TxDropped uint64 `json:"tx_dropped"`
+}
+
+// RunFailure records a speedtest that failed with an error instead of
+// producing a result, e.g. because the connection was down. Runs that failed
+// after selecting a test server record it, for server quality scores.
+type RunFailure struct {
+    ID        int64     `json:"id"`
+    Timestamp time.Time `json:"timestamp"`
+    Error     string    `json:"error"`
+    Connection string   `json:"connection,omitempty"`
+    Engine    string    `json:"engine,omitempty"`
+    ServerID  string    `json:"server_id,omitempty"`
+    ServerName string   `json:"server_name,omitempty"`
 }
 
 // ScheduleType represents the type of schedule for speed tests.
@@ -32,6 +112,8 @@ const (
     ScheduleInterval ScheduleType = "interval"
     // ScheduleDaily represents a daily schedule at a specific time.
     ScheduleDaily ScheduleType = "daily"
+    // ScheduleCron represents a schedule given by a cron expression.
+    ScheduleCron ScheduleType = "cron"
 )
 
 // Schedule defines a scheduled speed test with its configuration.
@@ -42,4 +124,137 @@ type Schedule struct {
     Type      ScheduleType `json:"type"`
     Every     string       `json:"every,omitempty"`       // Go duration, e.g. "1h"
     TimeOfDay string       `json:"time_of_day,omitempty"` // "HH:MM" local time
+    Cron      string       `json:"cron,omitempty"`        // Five-field cron expression in local time, e.g. "*/15 8-22 * * 1-5"
+    Connection string      `json:"connection,omitempty"`  // Named connection to test; empty for the default connection
+    Engines   []string     `json:"engines,omitempty"`     // Engines to run back to back in each slot, see EngineComparison; empty runs the default engine
+    Alerts    *ScheduleAlerts `json:"alerts,omitempty"`    // Overrides the global alerting config for this schedule's results
+}
+
+// ScheduleAlerts layers one schedule's notification settings over the global
+// alerting config, e.g. so only a nightly measurement sends notifications.
+type ScheduleAlerts struct {
+    Silent   bool        `json:"silent,omitempty"`   // Don't evaluate alert rules against this schedule's results
+    Webhooks []string    `json:"webhooks,omitempty"` // Names of the webhooks to notify; empty notifies all of them
+    Rules    []AlertRule `json:"rules,omitempty"`    // Replace the global rules with the same ID, or add to them
+}
+
+// AlertRule raises an incident when a metric crosses a threshold and
+// resolves it once the metric is back past the recovery threshold.
+type AlertRule struct {
+    ID            string  `json:"id"`
+    Name          string  `json:"name"`
+    Enabled       bool    `json:"enabled"`
+    Metric        string  `json:"metric"`                   // download_mbps, upload_mbps, ping_ms, jitter_ms or packet_loss_pct
+    Operator      string  `json:"operator"`                 // "<" or ">": breach when the value is below/above Threshold
+    Threshold     float64 `json:"threshold"`
+    Recover       *float64 `json:"recover,omitempty"`       // Value the metric must get back past to recover; defaults to Threshold
+    For           int     `json:"for,omitempty"`            // Consecutive breaching results before alerting (default 1)
+    RecoverFor    int     `json:"recover_for,omitempty"`    // Consecutive healthy results before recovering (default 1)
+    RenotifyEvery string  `json:"renotify_every,omitempty"` // Go duration to repeat notifications while degraded; empty never repeats
+    Severity      string  `json:"severity,omitempty"`       // One of AlertSeverities, for incident tools; empty means "warning"
+}
+
+// AlertSeverities are the severities a rule can have, most severe first.
+// They match the PagerDuty Events API's.
+var AlertSeverities = []string{"critical", "error", "warning", "info"}
+
+// DefaultAlertSeverity is the severity of rules that don't set one.
+const DefaultAlertSeverity = "warning"
+
+// ProbeResult is one round of packet-loss probes against a single target.
+type ProbeResult struct {
+    ID        int64     `json:"id"`
+    Timestamp time.Time `json:"timestamp"`
+    Target    string    `json:"target"`            // Target name
+    Kind      string    `json:"kind"`              // "icmp" or "udp"
+    Address   string    `json:"address"`
+    Sent      int       `json:"sent"`
+    Received  int       `json:"received"`
+    LossPct   float64   `json:"loss_pct"`
+    RTTMinMs  float64   `json:"rtt_min_ms,omitempty"`
+    RTTAvgMs  float64   `json:"rtt_avg_ms,omitempty"`
+    RTTMaxMs  float64   `json:"rtt_max_ms,omitempty"`
+    ResultID  string    `json:"result_id,omitempty"` // Speedtest result the round ran alongside; empty for continuous probes
+    Error     string    `json:"error,omitempty"`
+}
+
+// WANUtilization is the traffic on a connection's WAN interface between two
+// reads of the router's counters.
+type WANUtilization struct {
+    ID           int64     `json:"id"`
+    Timestamp    time.Time `json:"timestamp"`            // End of the interval
+    Connection   string    `json:"connection,omitempty"` // Empty for the default connection
+    DownloadMbps float64   `json:"download_mbps"`        // Average over the interval
+    UploadMbps   float64   `json:"upload_mbps"`
+    DownloadPct  *float64  `json:"download_pct,omitempty"` // Of the connection's capacity, when known
+    UploadPct    *float64  `json:"upload_pct,omitempty"`
+    Error        string    `json:"error,omitempty"` // Why the counters couldn't be read; the other fields are empty
+}
+
+// BusyPct returns how busy the link was: the higher of DownloadPct and
+// UploadPct, or 0 when the capacity isn't known.
+func (u WANUtilization) BusyPct() float64 {
+    busy := 0.0
+    if u.DownloadPct != nil {
+        busy = *u.DownloadPct
+    }
+    if u.UploadPct != nil && *u.UploadPct > busy {
+        busy = *u.UploadPct
+    }
+    return busy
+}
+
+// ReachabilityCheck records how the connection looks from the outside: the
+// public address, whether it is the router's own WAN address, and whether
+// the dashboard port can be reached.
+type ReachabilityCheck struct {
+    ID           int64     `json:"id"`
+    Timestamp    time.Time `json:"timestamp"`
+    PublicIP     string    `json:"public_ip,omitempty"`     // As seen by the STUN server
+    RouterIP     string    `json:"router_ip,omitempty"`     // WAN address the router reports
+    RouterSource string    `json:"router_source,omitempty"` // How RouterIP was found: "nat-pmp" or "upnp"
+    CGNAT        bool      `json:"cgnat"`                   // RouterIP is not the public address, so inbound connections can't reach it
+    Port         int       `json:"port,omitempty"`
+    Reachable    *bool     `json:"reachable,omitempty"` // Whether Port accepted a connection from outside; nil if it couldn't be checked
+    Error        string    `json:"error,omitempty"`     // Steps that failed, separated by "; "
+}
+
+// WorkingLatency is the round-trip time to a host, such as a game server,
+// with the link idle and while a download and then an upload saturate it.
+// Round-trip times are averages and are 0 when every packet was lost.
+type WorkingLatency struct {
+    ID              int64     `json:"id"`
+    Timestamp       time.Time `json:"timestamp"`
+    Target          string    `json:"target"` // Target name
+    Kind            string    `json:"kind"`   // "icmp" or "udp"
+    Address         string    `json:"address"`
+    IdleMs          float64   `json:"idle_ms"`
+    IdleLossPct     float64   `json:"idle_loss_pct"`
+    DownloadMs      float64   `json:"download_ms"`
+    DownloadLossPct float64   `json:"download_loss_pct"`
+    DownloadMbps    float64   `json:"download_mbps"` // Throughput of the load while probing
+    UploadMs        float64   `json:"upload_ms"`
+    UploadLossPct   float64   `json:"upload_loss_pct"`
+    UploadMbps      float64   `json:"upload_mbps"`
+    Error           string    `json:"error,omitempty"` // Phases that failed, separated by "; "
+}
+
+// StarlinkStatus is a reading of a Starlink dish's status. Throughput is the
+// traffic the dish was carrying at the time, not its capacity, so readings
+// are kept apart from speedtest results.
+type StarlinkStatus struct {
+    ID                  int64     `json:"id"`
+    Timestamp           time.Time `json:"timestamp"`
+    DishID              string    `json:"dish_id,omitempty"`
+    SoftwareVersion     string    `json:"software_version,omitempty"`
+    UptimeS             int64     `json:"uptime_s,omitempty"`
+    DownlinkMbps        float64   `json:"downlink_mbps"`
+    UplinkMbps          float64   `json:"uplink_mbps"`
+    PingMs              float64   `json:"ping_ms,omitempty"` // Latency to the Starlink point of presence
+    PingDropPct         float64   `json:"ping_drop_pct"`
+    ObstructedPct       float64   `json:"obstructed_pct"` // Share of the sky view that is obstructed
+    CurrentlyObstructed bool      `json:"currently_obstructed,omitempty"`
+    OutageCause         string    `json:"outage_cause,omitempty"` // Why the dish is offline, e.g. "obstructed"; empty while connected
+    OutageS             float64   `json:"outage_s,omitempty"`     // How long the current outage has lasted
+    Error               string    `json:"error,omitempty"`        // Why the dish couldn't be read; the other fields are empty
 }
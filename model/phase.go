@@ -0,0 +1,42 @@
+package model
+
+// Outcomes of a test phase, see PhaseStatus.
+const (
+	PhaseOK      = "ok"
+	PhaseFailed  = "failed"
+	PhaseSkipped = "skipped" // Not selected for the run, or not reached
+)
+
+// PhaseStatus is how one phase (ping, download or upload) of a test went.
+type PhaseStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"` // Why a failed phase failed
+}
+
+// Partial reports whether some phase of the test failed while others
+// measured something. The measurements of failed phases are zero.
+func (r SpeedtestResult) Partial() bool {
+	for _, p := range r.Phases {
+		if p.Status == PhaseFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// PhaseFailed reports whether phase failed, so its measurements are zero
+// rather than measured.
+func (r SpeedtestResult) PhaseFailed(phase string) bool {
+	return r.Phases[phase].Status == PhaseFailed
+}
+
+// PhaseTimings is how long the steps of a test took, in milliseconds. A slow
+// server selection or ping phase points at a struggling test server rather
+// than the line.
+type PhaseTimings struct {
+	ServerSelectionMs int64 `json:"server_selection_ms"` // Fetching the client's details and server list and picking a server
+	PingMs            int64 `json:"ping_ms,omitempty"`
+	DownloadMs        int64 `json:"download_ms,omitempty"`
+	UploadMs          int64 `json:"upload_ms,omitempty"`
+	TotalMs           int64 `json:"total_ms"` // The whole test, including local checks and processing
+}
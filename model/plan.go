@@ -0,0 +1,103 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PlanDateLayout is the format of Plan.Start.
+const PlanDateLayout = "2006-01-02"
+
+// Plan is an ISP plan, in effect for its connection from Start until the
+// next plan of that connection starts. Results are compared against the plan
+// that was in effect when they were recorded.
+type Plan struct {
+	Provider     string  `json:"provider"`
+	DownloadMbps float64 `json:"download_mbps"`
+	UploadMbps   float64 `json:"upload_mbps"`
+	Price        float64 `json:"price,omitempty"`      // Per month
+	Currency     string  `json:"currency,omitempty"`   // e.g. "EUR"
+	Start        string  `json:"start"`                // "YYYY-MM-DD", from midnight in the configured timezone
+	Connection   string  `json:"connection,omitempty"` // Empty for the default connection
+}
+
+// StartTime returns when the plan takes effect in loc.
+func (p Plan) StartTime(loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation(PlanDateLayout, p.Start, loc)
+}
+
+// ValidatePlans checks each plan and that no two plans of a connection start
+// on the same day.
+func ValidatePlans(plans []Plan) error {
+	seen := make(map[string]bool, len(plans))
+	for _, p := range plans {
+		if _, err := p.StartTime(time.UTC); err != nil {
+			return fmt.Errorf("plan %q: start %q is not a YYYY-MM-DD date", p.Provider, p.Start)
+		}
+		if p.DownloadMbps <= 0 || p.UploadMbps <= 0 {
+			return fmt.Errorf("plan %q from %s: download_mbps and upload_mbps must be positive", p.Provider, p.Start)
+		}
+		if p.Price < 0 {
+			return fmt.Errorf("plan %q from %s: price is negative", p.Provider, p.Start)
+		}
+		if p.Connection != "" {
+			if err := ValidateConnection(p.Connection); err != nil {
+				return fmt.Errorf("plan %q from %s: %w", p.Provider, p.Start, err)
+			}
+		}
+		key := p.Connection + "\x00" + p.Start
+		if seen[key] {
+			return fmt.Errorf("two plans start on %s", p.Start)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// PlanPeriod is a plan with the time it was in effect, in the order the
+// connection's plans followed each other.
+type PlanPeriod struct {
+	Plan
+	From time.Time  `json:"from"`
+	To   *time.Time `json:"to,omitempty"` // Start of the next plan; nil for the current one
+}
+
+// PlanHistory returns the plans of a connection ("" or DefaultConnection for
+// the default one) in the order they took effect, with day boundaries in
+// loc. Plans that don't validate are skipped.
+func PlanHistory(plans []Plan, connection string, loc *time.Location) []PlanPeriod {
+	if connection == DefaultConnection {
+		connection = ""
+	}
+	var out []PlanPeriod
+	for _, p := range plans {
+		if p.Connection == DefaultConnection {
+			p.Connection = ""
+		}
+		if p.Connection != connection {
+			continue
+		}
+		from, err := p.StartTime(loc)
+		if err != nil {
+			continue
+		}
+		out = append(out, PlanPeriod{Plan: p, From: from})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].From.Before(out[j].From) })
+	for i := 0; i+1 < len(out); i++ {
+		to := out[i+1].From
+		out[i].To = &to
+	}
+	return out
+}
+
+// PlanAt returns the period of history in effect at t, or nil before the
+// first plan.
+func PlanAt(history []PlanPeriod, t time.Time) *PlanPeriod {
+	i := sort.Search(len(history), func(i int) bool { return history[i].From.After(t) })
+	if i == 0 {
+		return nil
+	}
+	return &history[i-1]
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// PushSubscription is a browser's Web Push subscription, as returned by
+// PushManager.subscribe() in the dashboard: where to send notifications and
+// the keys to encrypt them for that browser with.
+type PushSubscription struct {
+	Endpoint string    `json:"endpoint"`
+	Keys     PushKeys  `json:"keys"`
+	Created  time.Time `json:"created"`
+}
+
+// PushKeys are a subscription's keys, base64url encoded.
+type PushKeys struct {
+	P256DH string `json:"p256dh"` // The browser's P-256 public key
+	Auth   string `json:"auth"`   // Authentication secret
+}
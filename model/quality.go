@@ -0,0 +1,157 @@
+package model
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Server quality defaults.
+const (
+	// MinQualityResults is how many results a server needs before it can
+	// be flagged as diverging; fewer say too little about it.
+	MinQualityResults = 5
+	// DefaultQualityWindow is how much history servers are scored on.
+	DefaultQualityWindow = 30 * 24 * time.Hour
+	// DefaultMaxDeviationPct is how far from the fleet median a server's
+	// median download may be before it is flagged as diverging.
+	DefaultMaxDeviationPct = 50
+)
+
+// ServerQuality summarises how consistent a test server's results have
+// been. Servers are compared by their download speeds: a good server gives
+// steady results close to the fleet median, the median of every result on
+// the connection, while a poor one fails often, varies a lot, or reports
+// speeds far from what other servers see on the same line.
+type ServerQuality struct {
+	Engine             string  `json:"engine"`
+	ServerID           string  `json:"server_id"`
+	ServerName         string  `json:"server_name,omitempty"`
+	ServerCountry      string  `json:"server_country,omitempty"`
+	Results            int     `json:"results"`
+	Failures           int     `json:"failures"`         // Runs that failed after selecting the server, plus results that moved no data
+	FailureRatePct     float64 `json:"failure_rate_pct"` // Of results plus failed runs
+	DownloadMedianMbps float64 `json:"download_median_mbps"`
+	DownloadCVPct      float64 `json:"download_cv_pct"` // Standard deviation of downloads in percent of their mean
+	DeviationPct       float64 `json:"deviation_pct"`   // How far the server's median is from the fleet median, in percent of the fleet median; negative when slower
+	Score              float64 `json:"score"`           // 0 to 100, higher is better
+	Diverging          bool    `json:"diverging"`       // Has MinQualityResults results and deviates more than the limit given to ScoreServers
+}
+
+// ScoreServers scores each server that produced results or failed runs.
+// Failures without a server, such as runs that couldn't reach the server
+// list, count for none. The score starts at 100 and is scaled down by the
+// failure rate, the variation of downloads and the deviation from the fleet
+// median, each capped at 100%. Servers deviating more than maxDeviationPct
+// are flagged as diverging. Servers are returned best first.
+func ScoreServers(results []SpeedtestResult, failures []RunFailure, maxDeviationPct float64) []ServerQuality {
+	type key struct{ engine, id string }
+	byServer := make(map[key]*ServerQuality)
+	downloads := make(map[key][]float64)
+	failedRuns := make(map[key]int)
+	var fleet []float64
+
+	server := func(engine, id string) *ServerQuality {
+		if engine == "" {
+			engine = EngineOokla
+		}
+		k := key{engine, id}
+		q, ok := byServer[k]
+		if !ok {
+			q = &ServerQuality{Engine: engine, ServerID: id}
+			byServer[k] = q
+		}
+		return q
+	}
+
+	for _, r := range results {
+		if r.ServerID == "" {
+			continue
+		}
+		q := server(r.Engine, r.ServerID)
+		q.Results++
+		q.ServerName, q.ServerCountry = r.ServerName, r.ServerCountry
+		if r.DownloadMbps <= 0 || r.UploadMbps <= 0 {
+			q.Failures++
+			continue
+		}
+		k := key{q.Engine, q.ServerID}
+		downloads[k] = append(downloads[k], r.DownloadMbps)
+		fleet = append(fleet, r.DownloadMbps)
+	}
+	for _, f := range failures {
+		if f.ServerID == "" {
+			continue
+		}
+		q := server(f.Engine, f.ServerID)
+		q.Failures++
+		failedRuns[key{q.Engine, q.ServerID}]++
+		if q.ServerName == "" {
+			q.ServerName = f.ServerName
+		}
+	}
+
+	fleetMedian := median(fleet)
+	out := make([]ServerQuality, 0, len(byServer))
+	for k, q := range byServer {
+		attempts := q.Results + failedRuns[k]
+		if attempts > 0 {
+			q.FailureRatePct = float64(q.Failures) / float64(attempts) * 100
+		}
+		if d := downloads[k]; len(d) > 0 {
+			q.DownloadMedianMbps = median(d)
+			q.DownloadCVPct = coefficientOfVariation(d) * 100
+			if fleetMedian > 0 {
+				q.DeviationPct = (q.DownloadMedianMbps - fleetMedian) / fleetMedian * 100
+			}
+		}
+
+		score := 100.0
+		score *= 1 - math.Min(q.FailureRatePct, 100)/100
+		score *= 1 - math.Min(q.DownloadCVPct, 100)/100
+		score *= 1 - math.Min(math.Abs(q.DeviationPct), 100)/100
+		q.Score = score
+		q.Diverging = q.Results >= MinQualityResults && math.Abs(q.DeviationPct) > maxDeviationPct
+		out = append(out, *q)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].ServerID < out[j].ServerID
+	})
+	return out
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func coefficientOfVariation(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if mean <= 0 {
+		return 0
+	}
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sq/float64(len(values)-1)) / mean
+}
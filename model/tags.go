@@ -0,0 +1,31 @@
+package model
+
+import "fmt"
+
+// MaxTagLength is the longest tag a result may carry.
+const MaxTagLength = 32
+
+// ValidateTag checks that a result tag is short and made of letters, digits,
+// '-', '_', '.' or ':', so tags stay safe to use in URLs, filters and CSV.
+func ValidateTag(tag string) error {
+	return validateLabel("tag", tag)
+}
+
+// validateLabel checks a tag-like label, naming it kind in errors.
+func validateLabel(kind, s string) error {
+	if s == "" {
+		return fmt.Errorf("%s is empty", kind)
+	}
+	if len(s) > MaxTagLength {
+		return fmt.Errorf("%s %q is longer than %d characters", kind, s, MaxTagLength)
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return fmt.Errorf("%s %q contains %q; use letters, digits, '-', '_', '.' or ':'", kind, s, c)
+		}
+	}
+	return nil
+}
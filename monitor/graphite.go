@@ -0,0 +1,132 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"speedplane/model"
+)
+
+// Graphite and StatsD defaults.
+const (
+	DefaultGraphitePort   = "2003"
+	DefaultStatsDPort     = "8125"
+	DefaultMetricPrefix   = "speedplane"
+	graphiteTimeout       = 10 * time.Second
+	statsDMaxDatagramSize = 1432
+)
+
+// Graphite sends results to Carbon with the plaintext protocol, one line
+// per metric stamped with the result's time. Metrics are named
+// <Prefix>.<metric>, e.g. speedplane.download_mbps, with the connection
+// inserted for named connections, e.g. speedplane.fiber.download_mbps.
+type Graphite struct {
+	Address string // host:port of Carbon; the port defaults to 2003
+	Prefix  string // Defaults to DefaultMetricPrefix
+}
+
+// Send sends the result's metrics.
+func (g *Graphite) Send(ctx context.Context, r *model.SpeedtestResult) error {
+	var buf bytes.Buffer
+	ts := r.Timestamp.Unix()
+	for _, m := range metrics {
+		fmt.Fprintf(&buf, "%s %s %d\n", metricPath(g.Prefix, r, m), formatValue(m.Value(r)), ts)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, graphiteTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", withPort(g.Address, DefaultGraphitePort))
+	if err != nil {
+		return fmt.Errorf("graphite %s: %w", g.Address, err)
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("graphite %s: %w", g.Address, err)
+	}
+	return nil
+}
+
+// StatsD sends results to a StatsD daemon as gauges over UDP, named like
+// Graphite metrics. StatsD stamps them with the time they arrive.
+type StatsD struct {
+	Address string // host:port of the daemon; the port defaults to 8125
+	Prefix  string // Defaults to DefaultMetricPrefix
+}
+
+// Send sends the result's metrics. Being UDP, it only fails if the packets
+// can't be sent, not if nothing receives them.
+func (s *StatsD) Send(ctx context.Context, r *model.SpeedtestResult) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", withPort(s.Address, DefaultStatsDPort))
+	if err != nil {
+		return fmt.Errorf("statsd %s: %w", s.Address, err)
+	}
+	defer conn.Close()
+
+	// Batch lines into datagrams that fit a typical MTU
+	var buf bytes.Buffer
+	flush := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+		_, err := conn.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+		buf.Reset()
+		return err
+	}
+	for _, m := range metrics {
+		line := metricPath(s.Prefix, r, m) + ":" + formatValue(m.Value(r)) + "|g\n"
+		if buf.Len()+len(line) > statsDMaxDatagramSize {
+			if err := flush(); err != nil {
+				return fmt.Errorf("statsd %s: %w", s.Address, err)
+			}
+		}
+		buf.WriteString(line)
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("statsd %s: %w", s.Address, err)
+	}
+	return nil
+}
+
+// metricPath names a metric of r in Graphite's dotted hierarchy.
+func metricPath(prefix string, r *model.SpeedtestResult, m metric) string {
+	if prefix == "" {
+		prefix = DefaultMetricPrefix
+	}
+	path := strings.TrimSuffix(prefix, ".")
+	if r.Connection != "" {
+		path += "." + pathComponent(r.Connection)
+	}
+	return path + "." + m.Name
+}
+
+// pathComponent replaces characters that would split or break a metric
+// path, such as dots, spaces and colons, with underscores.
+func pathComponent(s string) string {
+	return strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' {
+			return c
+		}
+		return '_'
+	}, s)
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// withPort adds port to addr unless it has one.
+func withPort(addr, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(addr, port)
+	}
+	return addr
+}
@@ -0,0 +1,33 @@
+// Package monitor pushes speedtest results into existing monitoring
+// systems: Zabbix, through the sender protocol, Nagios or Icinga, as
+// passive check results, Graphite or StatsD, as metrics, and syslog
+// collectors, which also receive alerts.
+package monitor
+
+import "speedplane/model"
+
+// metric is a result value pushed to monitoring systems.
+type metric struct {
+	Name         string // As in alert rules, e.g. "download_mbps"
+	Unit         string // Nagios performance data unit
+	LowerIsWorse bool
+	Value        func(r *model.SpeedtestResult) float64
+}
+
+// metrics are pushed in this order.
+var metrics = []metric{
+	{"download_mbps", "", true, func(r *model.SpeedtestResult) float64 { return r.DownloadMbps }},
+	{"upload_mbps", "", true, func(r *model.SpeedtestResult) float64 { return r.UploadMbps }},
+	{"ping_ms", "ms", false, func(r *model.SpeedtestResult) float64 { return r.PingMs }},
+	{"jitter_ms", "ms", false, func(r *model.SpeedtestResult) float64 { return r.JitterMs }},
+	{"packet_loss_pct", "%", false, func(r *model.SpeedtestResult) float64 { return r.PacketLossPct }},
+}
+
+func findMetric(name string) (metric, bool) {
+	for _, m := range metrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return metric{}, false
+}
@@ -0,0 +1,150 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+
+	"speedplane/model"
+)
+
+// Nagios plugin states.
+const (
+	StateOK       = 0
+	StateWarning  = 1
+	StateCritical = 2
+)
+
+// DefaultNagiosService is the service passive results are submitted for.
+const DefaultNagiosService = "speedtest"
+
+var stateNames = []string{"OK", "WARNING", "CRITICAL"}
+
+// Threshold sets when a metric makes a check warn or go critical. For
+// download and upload speeds the state applies below the value, for the
+// other metrics above it. Nil leaves that state out.
+type Threshold struct {
+	Warning  *float64
+	Critical *float64
+}
+
+// Nagios submits each result as a passive service check result to Nagios,
+// Icinga or Naemon by writing PROCESS_SERVICE_CHECK_RESULT external commands
+// to their command file.
+type Nagios struct {
+	CommandFile string // e.g. /var/lib/nagios3/rw/nagios.cmd or /var/run/icinga2/cmd/icinga2.cmd
+	Host        string // Host name of the service's host
+	Service     string // Defaults to DefaultNagiosService
+
+	// Thresholds by metric name, as in alert rules: download_mbps,
+	// upload_mbps, ping_ms, jitter_ms or packet_loss_pct
+	Thresholds map[string]Threshold
+}
+
+// Validate checks that the thresholds are for known metrics and that their
+// critical values are worse than their warning values.
+func (n *Nagios) Validate() error {
+	if n.CommandFile == "" || n.Host == "" {
+		return errors.New("command_file and host are required")
+	}
+	for name, t := range n.Thresholds {
+		m, ok := findMetric(name)
+		if !ok {
+			return fmt.Errorf("threshold for unknown metric %q", name)
+		}
+		if t.Warning == nil || t.Critical == nil {
+			continue
+		}
+		if m.LowerIsWorse && *t.Critical > *t.Warning {
+			return fmt.Errorf("%s: critical must be at most warning", name)
+		}
+		if !m.LowerIsWorse && *t.Critical < *t.Warning {
+			return fmt.Errorf("%s: critical must be at least warning", name)
+		}
+	}
+	return nil
+}
+
+// Check returns the state of a result against the thresholds and the plugin
+// output for it, with performance data for every metric, e.g.
+// "SPEEDTEST WARNING - download_mbps 80.00 < 100 | download_mbps=80.00;100:;50:;0; ...".
+func (n *Nagios) Check(r *model.SpeedtestResult) (int, string) {
+	state := StateOK
+	var problems, perf []string
+	for _, m := range metrics {
+		v := m.Value(r)
+		t := n.Thresholds[m.Name]
+		op := ">"
+		if m.LowerIsWorse {
+			op = "<"
+		}
+		breaches := func(limit *float64) bool {
+			if limit == nil {
+				return false
+			}
+			if m.LowerIsWorse {
+				return v < *limit
+			}
+			return v > *limit
+		}
+		switch {
+		case breaches(t.Critical):
+			state = max(state, StateCritical)
+			problems = append(problems, fmt.Sprintf("%s %.2f %s %s", m.Name, v, op, formatLimit(t.Critical)))
+		case breaches(t.Warning):
+			state = max(state, StateWarning)
+			problems = append(problems, fmt.Sprintf("%s %.2f %s %s", m.Name, v, op, formatLimit(t.Warning)))
+		}
+		perf = append(perf, fmt.Sprintf("%s=%.2f%s;%s;%s;0;", m.Name, v, m.Unit, perfRange(m, t.Warning), perfRange(m, t.Critical)))
+	}
+
+	summary := fmt.Sprintf("%.2f/%.2f Mbps, %.1f ms", r.DownloadMbps, r.UploadMbps, r.PingMs)
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		summary = strings.Join(problems, ", ")
+	}
+	return state, fmt.Sprintf("SPEEDTEST %s - %s | %s", stateNames[state], summary, strings.Join(perf, " "))
+}
+
+// Submit writes the result's check result to the command file. The command
+// file is a named pipe the monitoring system reads, so Submit fails rather
+// than blocks when the system isn't running.
+func (n *Nagios) Submit(r *model.SpeedtestResult) error {
+	service := n.Service
+	if service == "" {
+		service = DefaultNagiosService
+	}
+	state, output := n.Check(r)
+	// A newline would end the command; semicolons are fine in the last field
+	output = strings.ReplaceAll(output, "\n", " ")
+	line := fmt.Sprintf("[%d] PROCESS_SERVICE_CHECK_RESULT;%s;%s;%d;%s\n", r.Timestamp.Unix(), n.Host, service, state, output)
+
+	f, err := os.OpenFile(n.CommandFile, os.O_WRONLY|os.O_APPEND|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return fmt.Errorf("nagios: open command file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(line); err != nil {
+		return fmt.Errorf("nagios: write command file: %w", err)
+	}
+	return nil
+}
+
+// perfRange formats a threshold as a performance data range, which alerts
+// above a plain value and below one followed by a colon.
+func perfRange(m metric, v *float64) string {
+	if v == nil || !m.LowerIsWorse {
+		return formatLimit(v)
+	}
+	return formatLimit(v) + ":"
+}
+
+func formatLimit(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%g", *v)
+}
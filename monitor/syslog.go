@@ -0,0 +1,217 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"speedplane/alert"
+	"speedplane/model"
+)
+
+// Syslog defaults.
+const (
+	DefaultSyslogPort     = "514"
+	DefaultSyslogFacility = "local0"
+	DefaultSyslogAppName  = "speedplane"
+	syslogTimeout         = 10 * time.Second
+
+	// syslogSDID qualifies structured data element names. 32473 is the
+	// enterprise number reserved for examples, as is common for software
+	// without a registered one.
+	syslogSDID = "@32473"
+)
+
+// Syslog severities used for messages.
+const (
+	syslogCritical = 2
+	syslogError    = 3
+	syslogWarning  = 4
+	syslogNotice   = 5
+	syslogInfo     = 6
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Syslog sends RFC 5424 messages to a remote collector, one per result and
+// per alert event, with the values as structured data so collectors can
+// index them without parsing the message. Messages go over UDP, one per
+// datagram, or TCP with octet counting as in RFC 6587.
+type Syslog struct {
+	network  string
+	address  string
+	facility int
+	appName  string
+	hostname string
+}
+
+// NewSyslog creates a Syslog sending to address over network, "udp" or
+// "tcp", with facility given by name, e.g. "local0" or "daemon". Empty
+// values take the defaults; the port defaults to 514.
+func NewSyslog(network, address, facility, appName string) (*Syslog, error) {
+	if address == "" {
+		return nil, fmt.Errorf("missing address")
+	}
+	switch network {
+	case "":
+		network = "udp"
+	case "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("unknown network %q, must be udp or tcp", network)
+	}
+	if facility == "" {
+		facility = DefaultSyslogFacility
+	}
+	code, ok := syslogFacilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown facility %q", facility)
+	}
+	if appName == "" {
+		appName = DefaultSyslogAppName
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &Syslog{
+		network:  network,
+		address:  withPort(address, DefaultSyslogPort),
+		facility: code,
+		appName:  headerField(appName, 48),
+		hostname: headerField(hostname, 255),
+	}, nil
+}
+
+// SendResult logs a result at informational severity with message ID
+// "result".
+func (s *Syslog) SendResult(ctx context.Context, r *model.SpeedtestResult) error {
+	params := [][2]string{{"id", r.ID}}
+	for _, m := range metrics {
+		params = append(params, [2]string{m.Name, formatValue(m.Value(r))})
+	}
+	for _, p := range [][2]string{
+		{"engine", r.Engine},
+		{"server_id", r.ServerID},
+		{"server_name", r.ServerName},
+		{"isp", r.ISP},
+		{"connection", r.Connection},
+	} {
+		if p[1] != "" {
+			params = append(params, p)
+		}
+	}
+	msg := fmt.Sprintf("speedtest %.2f/%.2f Mbps, %.1f ms", r.DownloadMbps, r.UploadMbps, r.PingMs)
+	if err := s.send(ctx, syslogInfo, r.Timestamp, "result", params, msg); err != nil {
+		return fmt.Errorf("syslog %s: %w", s.address, err)
+	}
+	return nil
+}
+
+// Notify implements alert.Notifier, logging events at the rule's severity
+// with message ID "alert". Recoveries are logged as notices.
+func (s *Syslog) Notify(ctx context.Context, e alert.Event) error {
+	severity := syslogWarning
+	switch {
+	case e.Kind == alert.EventRecovered:
+		severity = syslogNotice
+	case e.Severity == "critical":
+		severity = syslogCritical
+	case e.Severity == "error":
+		severity = syslogError
+	case e.Severity == "info":
+		severity = syslogInfo
+	}
+	params := [][2]string{
+		{"kind", e.Kind},
+		{"rule_id", e.RuleID},
+		{"rule_name", e.RuleName},
+		{"severity", e.Severity},
+		{"metric", e.Metric},
+		{"operator", e.Operator},
+		{"threshold", formatValue(e.Threshold)},
+		{"value", formatValue(e.Value)},
+		{"since", e.Since.UTC().Format(time.RFC3339)},
+	}
+	if e.Schedule != "" {
+		params = append(params, [2]string{"schedule", e.Schedule})
+	}
+	if e.Result != nil {
+		params = append(params, [2]string{"result_id", e.Result.ID})
+		if e.Result.Connection != "" {
+			params = append(params, [2]string{"connection", e.Result.Connection})
+		}
+	}
+	if err := s.send(ctx, severity, e.Time, "alert", params, e.Summary()); err != nil {
+		return fmt.Errorf("syslog %s: %w", s.address, err)
+	}
+	return nil
+}
+
+// send formats and sends one message, with params as a structured data
+// element named after msgID.
+func (s *Syslog) send(ctx context.Context, severity int, t time.Time, msgID string, params [][2]string, msg string) error {
+	var sd strings.Builder
+	sd.WriteString("[" + msgID + syslogSDID)
+	for _, p := range params {
+		fmt.Fprintf(&sd, " %s=\"%s\"", p[0], sdValue(p[1]))
+	}
+	sd.WriteString("]")
+
+	if t.IsZero() {
+		t = time.Now()
+	}
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+	line := fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		s.facility*8+severity,
+		t.Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname, s.appName, os.Getpid(), msgID, sd.String(),
+		strings.ReplaceAll(msg, "\n", " "))
+
+	ctx, cancel := context.WithTimeout(ctx, syslogTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	if s.network == "tcp" {
+		line = strconv.Itoa(len(line)) + " " + line
+	}
+	_, err = conn.Write([]byte(line))
+	return err
+}
+
+// sdValue escapes the characters RFC 5424 reserves in parameter values.
+func sdValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(v)
+}
+
+// headerField makes v a valid header field: printable ASCII without spaces,
+// at most n characters, or "-" when empty.
+func headerField(v string, n int) string {
+	v = strings.Map(func(c rune) rune {
+		if c <= ' ' || c > '~' {
+			return '_'
+		}
+		return c
+	}, v)
+	if len(v) > n {
+		v = v[:n]
+	}
+	if v == "" {
+		return "-"
+	}
+	return v
+}
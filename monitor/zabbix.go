@@ -0,0 +1,139 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"speedplane/model"
+)
+
+// Zabbix defaults.
+const (
+	DefaultZabbixPort      = "10051"
+	DefaultZabbixKeyPrefix = "speedplane"
+
+	zabbixTimeout  = 10 * time.Second
+	zabbixMaxReply = 1 << 20
+)
+
+var zabbixHeader = []byte("ZBXD\x01")
+
+// Zabbix sends results to a Zabbix server or proxy with the sender
+// protocol, as zabbix_sender does, one trapper item per metric. Items are
+// keyed <KeyPrefix>.<metric>, e.g. speedplane.download_mbps, with the
+// connection as a parameter for named connections, e.g.
+// speedplane.download_mbps[fiber].
+type Zabbix struct {
+	Server    string // host:port of the server or proxy; the port defaults to 10051
+	Host      string // Host name of the monitored host in Zabbix
+	KeyPrefix string // Defaults to DefaultZabbixKeyPrefix
+}
+
+type zabbixItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+}
+
+type zabbixReply struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+// Send sends the result's metrics. It fails if the server rejects any of
+// them, usually because the host or a trapper item doesn't exist.
+func (z *Zabbix) Send(ctx context.Context, r *model.SpeedtestResult) error {
+	prefix := z.KeyPrefix
+	if prefix == "" {
+		prefix = DefaultZabbixKeyPrefix
+	}
+	items := make([]zabbixItem, 0, len(metrics))
+	for _, m := range metrics {
+		key := prefix + "." + m.Name
+		if r.Connection != "" {
+			key += "[" + r.Connection + "]"
+		}
+		items = append(items, zabbixItem{
+			Host:  z.Host,
+			Key:   key,
+			Value: formatValue(m.Value(r)),
+			Clock: r.Timestamp.Unix(),
+		})
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"request": "sender data",
+		"data":    items,
+		"clock":   time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	reply, err := z.exchange(ctx, data)
+	if err != nil {
+		return fmt.Errorf("zabbix %s: %w", z.Server, err)
+	}
+	var res zabbixReply
+	if err := json.Unmarshal(reply, &res); err != nil {
+		return fmt.Errorf("zabbix %s: invalid reply: %w", z.Server, err)
+	}
+	if res.Response != "success" {
+		return fmt.Errorf("zabbix %s: %s %s", z.Server, res.Response, res.Info)
+	}
+	// e.g. "processed: 3; failed: 2; total: 5; seconds spent: 0.000055"
+	if !strings.Contains(res.Info, "failed: 0;") {
+		return fmt.Errorf("zabbix %s: not all items were accepted, check that the host and trapper items exist: %s", z.Server, res.Info)
+	}
+	return nil
+}
+
+// exchange sends a request in a sender protocol packet and returns the
+// reply's data.
+func (z *Zabbix) exchange(ctx context.Context, data []byte) ([]byte, error) {
+	addr := withPort(z.Server, DefaultZabbixPort)
+	ctx, cancel := context.WithTimeout(ctx, zabbixTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	// Header, then the data length as 4 bytes plus 4 reserved, little endian
+	var packet bytes.Buffer
+	packet.Write(zabbixHeader)
+	_ = binary.Write(&packet, binary.LittleEndian, uint64(len(data)))
+	packet.Write(data)
+	if _, err := conn.Write(packet.Bytes()); err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, len(zabbixHeader)+8)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return nil, fmt.Errorf("read reply: %w", err)
+	}
+	if !bytes.Equal(head[:len(zabbixHeader)], zabbixHeader) {
+		return nil, errors.New("reply is not a sender protocol packet")
+	}
+	n := binary.LittleEndian.Uint32(head[len(zabbixHeader):])
+	if n > zabbixMaxReply {
+		return nil, fmt.Errorf("reply of %d bytes is too large", n)
+	}
+	reply := make([]byte, n)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, fmt.Errorf("read reply: %w", err)
+	}
+	return reply, nil
+}
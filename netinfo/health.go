@@ -0,0 +1,136 @@
+package netinfo
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"speedplane/model"
+	"speedplane/probe"
+)
+
+// Ping settings for the gateway and DNS checks: short enough not to delay
+// the test noticeably.
+const (
+	healthPings   = 5
+	healthSpacing = 100 * time.Millisecond
+	healthTimeout = time.Second
+)
+
+// HealthCheck pings the gateway and DNS server before a test and compares
+// the interface's error counters across it.
+type HealthCheck struct {
+	Gateway string // Ping this instead of the default route's gateway
+	DNS     string // Ping this instead of the first nameserver in /etc/resolv.conf
+}
+
+// HealthSnapshot holds what Begin captured until End is called.
+type HealthSnapshot struct {
+	iface  string
+	health model.LANHealth
+	before *model.InterfaceCounters
+}
+
+// Begin pings the gateway and DNS server and records iface's counters. Hosts
+// that can't be determined are reported with an error rather than skipped.
+func (h *HealthCheck) Begin(ctx context.Context, iface string) *HealthSnapshot {
+	snap := &HealthSnapshot{iface: iface}
+
+	var targets []probe.Target
+	stats := make(map[string]*model.PingStats)
+	add := func(name, addr string, err error) *model.PingStats {
+		ps := &model.PingStats{Address: addr}
+		if err != nil {
+			ps.Error = err.Error()
+			return ps
+		}
+		targets = append(targets, probe.Target{Name: name, Kind: probe.KindICMP, Address: addr})
+		stats[name] = ps
+		return ps
+	}
+
+	gateway, err := h.Gateway, error(nil)
+	if gateway == "" {
+		gateway, err = defaultGateway(iface)
+	}
+	snap.health.Gateway = add("gateway", gateway, err)
+
+	dns, err := h.DNS, error(nil)
+	if dns == "" {
+		dns, err = systemNameserver()
+	}
+	snap.health.DNS = add("dns", dns, err)
+
+	if len(targets) > 0 {
+		p := probe.Prober{Targets: targets, Count: healthPings, Spacing: healthSpacing, Timeout: healthTimeout}
+		for _, r := range p.Round(ctx) {
+			ps := stats[r.Target]
+			ps.RTTAvgMs = r.RTTAvgMs
+			ps.LossPct = r.LossPct
+			ps.Error = r.Error
+		}
+	}
+
+	if iface != "" {
+		snap.before, _ = interfaceCounters(iface)
+	}
+	return snap
+}
+
+// End returns the health snapshot with the interface counters' increase
+// since Begin.
+func (s *HealthSnapshot) End() *model.LANHealth {
+	if s.before != nil {
+		if after, err := interfaceCounters(s.iface); err == nil {
+			s.health.Interface = &model.InterfaceCounters{
+				RxErrors:  counterDelta(s.before.RxErrors, after.RxErrors),
+				TxErrors:  counterDelta(s.before.TxErrors, after.TxErrors),
+				RxDropped: counterDelta(s.before.RxDropped, after.RxDropped),
+				TxDropped: counterDelta(s.before.TxDropped, after.TxDropped),
+			}
+		}
+	}
+	health := s.health
+	return &health
+}
+
+// counterDelta treats a counter that went backwards (interface reset) as
+// unchanged.
+func counterDelta(before, after uint64) uint64 {
+	if after < before {
+		return 0
+	}
+	return after - before
+}
+
+// systemNameserver returns the first IPv4, non-loopback nameserver in
+// /etc/resolv.conf. Local stub resolvers such as systemd-resolved's
+// 127.0.0.53 are skipped since pinging them says nothing about the network.
+func systemNameserver() (string, error) {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		ip := net.ParseIP(fields[1])
+		if ip == nil || ip.To4() == nil || ip.IsLoopback() {
+			continue
+		}
+		return ip.String(), nil
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("no IPv4 nameserver in /etc/resolv.conf; set lan_health.dns")
+}
@@ -0,0 +1,85 @@
+// Package netinfo inspects the local network around a speedtest: which link
+// traffic leaves through, so Wi-Fi and wired runs can be told apart, and the
+// health of the gateway, DNS server and interface.
+package netinfo
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"speedplane/model"
+)
+
+// fallbackAddr is used to find the default route when no host is given.
+const fallbackAddr = "1.1.1.1:443"
+
+// Detect returns the link used to reach addr (host:port). Connecting a UDP
+// socket only consults the routing table, so no packets are sent. Details
+// such as link speed and Wi-Fi SSID/signal are filled in where the platform
+// exposes them.
+func Detect(ctx context.Context, addr string) (*model.LinkInfo, error) {
+	if addr == "" {
+		addr = fallbackAddr
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("route to %s: %w", addr, err)
+	}
+	local := conn.LocalAddr().(*net.UDPAddr).IP
+	conn.Close()
+
+	name, err := interfaceFor(local)
+	if err != nil {
+		return nil, err
+	}
+
+	link := &model.LinkInfo{Interface: name, Type: model.LinkUnknown}
+	details(ctx, link)
+	return link, nil
+}
+
+// DetectSource returns information about the interface that has the local
+// address source assigned, for tests bound to that address.
+func DetectSource(ctx context.Context, source string) (*model.LinkInfo, error) {
+	ip := net.ParseIP(source)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid source address %q", source)
+	}
+	name, err := interfaceFor(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	link := &model.LinkInfo{Interface: name, Type: model.LinkUnknown}
+	details(ctx, link)
+	return link, nil
+}
+
+// DefaultGateway returns the gateway of the IPv4 default route, where the
+// platform exposes it.
+func DefaultGateway() (string, error) {
+	return defaultGateway("")
+}
+
+// interfaceFor returns the name of the interface that has ip assigned.
+func interfaceFor(ip net.IP) (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", fmt.Errorf("list interfaces: %w", err)
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+				return iface.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no interface has address %s", ip)
+}
@@ -0,0 +1,226 @@
+//go:build linux
+
+package netinfo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"speedplane/model"
+)
+
+// sysNet is where the kernel exposes per-interface attributes.
+const sysNet = "/sys/class/net"
+
+// ARPHRD_* hardware types from /sys/class/net/<iface>/type.
+const (
+	arphrdEther = 1
+	arphrdPPP   = 512
+	arphrdNone  = 65534 // tun and WireGuard
+)
+
+// iwTimeout bounds the optional `iw` call used for SSID and signal.
+const iwTimeout = 2 * time.Second
+
+// details classifies the interface from sysfs and, for wireless links,
+// reads SSID, signal and bitrate from `iw` when it is installed, falling
+// back to /proc/net/wireless for the signal level.
+func details(ctx context.Context, link *model.LinkInfo) {
+	name := link.Interface
+	link.Type = linkType(name)
+
+	switch link.Type {
+	case model.LinkWired:
+		// speed is -1 (or unreadable) while the link is down or for
+		// drivers that don't report it.
+		if speed, err := readInt(filepath.Join(sysNet, name, "speed")); err == nil && speed > 0 {
+			link.SpeedMbps = speed
+		}
+	case model.LinkWiFi:
+		iwLink(ctx, link)
+		if link.SignalDBm == 0 {
+			link.SignalDBm = procWirelessSignal(name)
+		}
+	}
+}
+
+func linkType(name string) model.LinkType {
+	dir := filepath.Join(sysNet, name)
+	if isWireless(name) {
+		return model.LinkWiFi
+	}
+
+	// A bridge takes the type of its ports: a Wi-Fi client bridged into
+	// br0 still runs the test over the air.
+	if ports, err := os.ReadDir(filepath.Join(dir, "brif")); err == nil {
+		for _, p := range ports {
+			if isWireless(p.Name()) {
+				return model.LinkWiFi
+			}
+		}
+		return model.LinkWired
+	}
+
+	hwType, err := readInt(filepath.Join(dir, "type"))
+	if err != nil {
+		return model.LinkUnknown
+	}
+	switch hwType {
+	case arphrdEther:
+		return model.LinkWired
+	case arphrdPPP, arphrdNone:
+		return model.LinkVirtual
+	}
+	return model.LinkUnknown
+}
+
+func isWireless(name string) bool {
+	for _, sub := range []string{"wireless", "phy80211"} {
+		if _, err := os.Stat(filepath.Join(sysNet, name, sub)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// iwLink parses `iw dev <iface> link`, e.g.
+//
+//	Connected to aa:bb:cc:dd:ee:ff (on wlan0)
+//		SSID: home
+//		signal: -52 dBm
+//		tx bitrate: 866.7 MBit/s VHT-MCS 9 80MHz short GI VHT-NSS 2
+func iwLink(ctx context.Context, link *model.LinkInfo) {
+	iw, err := exec.LookPath("iw")
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, iwTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, iw, "dev", link.Interface, "link").Output()
+	if err != nil {
+		return
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(sc.Text()), ": ")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		switch key {
+		case "SSID":
+			link.SSID = value
+		case "signal":
+			if len(fields) > 0 {
+				if v, err := strconv.Atoi(fields[0]); err == nil {
+					link.SignalDBm = v
+				}
+			}
+		case "tx bitrate":
+			if len(fields) > 0 {
+				if v, err := strconv.ParseFloat(fields[0], 64); err == nil {
+					link.SpeedMbps = int(v)
+				}
+			}
+		}
+	}
+}
+
+// procWirelessSignal returns the signal level in dBm from /proc/net/wireless,
+// or 0 if it isn't listed.
+func procWirelessSignal(name string) int {
+	data, err := os.ReadFile("/proc/net/wireless")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		iface, rest, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || iface != name {
+			continue
+		}
+		// status, link quality, signal level, noise, ...
+		fields := strings.Fields(rest)
+		if len(fields) < 3 {
+			return 0
+		}
+		v, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], "."), 64)
+		if err != nil || v >= 0 {
+			return 0
+		}
+		return int(v)
+	}
+	return 0
+}
+
+func readInt(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// defaultGateway returns the gateway of the IPv4 default route from
+// /proc/net/route, preferring a route via iface when there are several.
+func defaultGateway(iface string) (string, error) {
+	data, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return "", err
+	}
+
+	var gateway string
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		// Iface Destination Gateway Flags ...
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		gw, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil || gw == 0 {
+			continue
+		}
+		// The address is in host (little-endian) byte order
+		ip := net.IPv4(byte(gw), byte(gw>>8), byte(gw>>16), byte(gw>>24)).String()
+		if fields[0] == iface {
+			return ip, nil
+		}
+		if gateway == "" {
+			gateway = ip
+		}
+	}
+	if gateway == "" {
+		return "", errors.New("no IPv4 default route")
+	}
+	return gateway, nil
+}
+
+// interfaceCounters reads iface's error and drop counters from sysfs.
+func interfaceCounters(iface string) (*model.InterfaceCounters, error) {
+	dir := filepath.Join(sysNet, iface, "statistics")
+	var c model.InterfaceCounters
+	for name, dst := range map[string]*uint64{
+		"rx_errors":  &c.RxErrors,
+		"tx_errors":  &c.TxErrors,
+		"rx_dropped": &c.RxDropped,
+		"tx_dropped": &c.TxDropped,
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if *dst, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
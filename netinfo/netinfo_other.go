@@ -0,0 +1,22 @@
+//go:build !linux
+
+package netinfo
+
+import (
+	"context"
+	"errors"
+
+	"speedplane/model"
+)
+
+// details is a no-op where link type and speed aren't exposed; the link is
+// reported with its interface name and an unknown type.
+func details(_ context.Context, _ *model.LinkInfo) {}
+
+func defaultGateway(_ string) (string, error) {
+	return "", errors.New("gateway detection is not supported on this platform; set lan_health.gateway")
+}
+
+func interfaceCounters(_ string) (*model.InterfaceCounters, error) {
+	return nil, errors.New("interface counters are not supported on this platform")
+}
@@ -0,0 +1,107 @@
+package netinfo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Defaults used when a WANWatcher option is zero.
+const (
+	DefaultIPURL         = "https://api.ipify.org"
+	DefaultWANInterval   = time.Minute
+	defaultLookupTimeout = 10 * time.Second
+)
+
+// WANWatcher polls the external IP address to notice WAN reconnects: the
+// address changing, or lookups succeeding again after the line was down.
+type WANWatcher struct {
+	URL      string        // Returns the caller's IP as plain text
+	Interval time.Duration // Time between lookups
+	Client   *http.Client
+
+	// OnReconnect is called with the previous and current address. Both are
+	// the same when the line came back with the address it had.
+	OnReconnect func(oldIP, newIP string)
+}
+
+// Run polls until ctx is cancelled. The first successful lookup only sets
+// the baseline, so a restart isn't mistaken for a reconnect.
+func (w *WANWatcher) Run(ctx context.Context) {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultWANInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastIP string
+	down := false
+	for {
+		ip, err := w.lookup(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			if !down && lastIP != "" {
+				log.Printf("[wan] external IP lookup failed, treating line as down: %v", err)
+			}
+			down = true
+		case lastIP == "":
+			lastIP, down = ip, false
+		case ip != lastIP || down:
+			log.Printf("[wan] reconnect detected: %s -> %s", lastIP, ip)
+			old := lastIP
+			lastIP, down = ip, false
+			if w.OnReconnect != nil {
+				w.OnReconnect(old, ip)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lookup fetches the external IP address from w.URL.
+func (w *WANWatcher) lookup(ctx context.Context) (string, error) {
+	url := w.URL
+	if url == "" {
+		url = DefaultIPURL
+	}
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultLookupTimeout}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return "", fmt.Errorf("%s did not return an IP address", url)
+	}
+	return ip.String(), nil
+}
@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"speedplane/alert"
+)
+
+// Matrix sends alert events as notices to a Matrix room, as the user whose
+// access token it holds. The user must already have joined the room.
+type Matrix struct {
+	Homeserver  string // Base URL, e.g. https://matrix.example.org
+	AccessToken string
+	RoomID      string // e.g. !abcdef:example.org; aliases aren't resolved
+	Client      *http.Client
+}
+
+// NewMatrix creates a Matrix notifier with a 15 second request timeout.
+func NewMatrix(homeserver, accessToken, roomID string) (*Matrix, error) {
+	u, err := url.Parse(homeserver)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid homeserver %q", homeserver)
+	}
+	if accessToken == "" {
+		return nil, errors.New("missing access token")
+	}
+	if !strings.HasPrefix(roomID, "!") || !strings.Contains(roomID, ":") {
+		return nil, fmt.Errorf("invalid room id %q, must look like !abcdef:example.org", roomID)
+	}
+	return &Matrix{
+		Homeserver:  strings.TrimRight(homeserver, "/"),
+		AccessToken: accessToken,
+		RoomID:      roomID,
+		Client:      &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+// Endpoint implements Channel.
+func (m *Matrix) Endpoint() string {
+	return m.Homeserver + " " + m.RoomID
+}
+
+// Render implements Channel.
+func (m *Matrix) Render(e alert.Event) ([]byte, string, error) {
+	var plain, formatted strings.Builder
+	plain.WriteString(e.Summary())
+	formatted.WriteString("<strong>" + html.EscapeString(e.Summary()) + "</strong><ul>")
+	for _, f := range facts(e) {
+		fmt.Fprintf(&plain, "\n%s: %s", f[0], f[1])
+		fmt.Fprintf(&formatted, "<li>%s: %s</li>", html.EscapeString(f[0]), html.EscapeString(f[1]))
+	}
+	formatted.WriteString("</ul>")
+
+	body, err := json.Marshal(map[string]string{
+		"msgtype":        "m.notice",
+		"body":           plain.String(),
+		"format":         "org.matrix.custom.html",
+		"formatted_body": formatted.String(),
+	})
+	return body, "application/json", err
+}
+
+// Notify implements alert.Notifier.
+func (m *Matrix) Notify(ctx context.Context, e alert.Event) error {
+	body, contentType, err := m.Render(e)
+	if err != nil {
+		return err
+	}
+	// The transaction ID makes retries of the same request idempotent
+	var txn [12]byte
+	_, _ = rand.Read(txn[:])
+	u := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		m.Homeserver, url.PathEscape(m.RoomID), hex.EncodeToString(txn[:]))
+	headers := map[string]string{"Authorization": "Bearer " + m.AccessToken}
+	if err := send(ctx, m.Client, http.MethodPut, u, contentType, headers, body); err != nil {
+		return fmt.Errorf("matrix %s: %w", m.RoomID, err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"speedplane/alert"
+)
+
+// Opsgenie API endpoints by region.
+const (
+	OpsgenieURL   = "https://api.opsgenie.com"
+	OpsgenieEUURL = "https://api.eu.opsgenie.com"
+)
+
+// opsgeniePriorities maps rule severities to Opsgenie priorities.
+var opsgeniePriorities = map[string]string{
+	"critical": "P1",
+	"error":    "P2",
+	"warning":  "P3",
+	"info":     "P5",
+}
+
+// Opsgenie creates an Opsgenie alert when a rule degrades and closes it when
+// the rule recovers. Alerts are identified by an alias per rule, so
+// reminders add to the open alert's count instead of opening new ones.
+type Opsgenie struct {
+	APIKey string // Key of an API integration
+	Source string // Names this instance in alerts; defaults to the hostname
+	URL    string // OpsgenieURL or OpsgenieEUURL
+	Client *http.Client
+}
+
+// NewOpsgenie creates an Opsgenie notifier for region "us" (or "") or "eu"
+// with a 15 second request timeout.
+func NewOpsgenie(apiKey, region, source string) (*Opsgenie, error) {
+	if apiKey == "" {
+		return nil, errors.New("missing api key")
+	}
+	var base string
+	switch region {
+	case "", "us":
+		base = OpsgenieURL
+	case "eu":
+		base = OpsgenieEUURL
+	default:
+		return nil, fmt.Errorf("invalid region %q, must be us or eu", region)
+	}
+	if source == "" {
+		source = defaultSource()
+	}
+	return &Opsgenie{
+		APIKey: apiKey,
+		Source: source,
+		URL:    base,
+		Client: &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+// Endpoint implements Channel.
+func (o *Opsgenie) Endpoint() string {
+	return o.URL
+}
+
+// Render implements Channel.
+func (o *Opsgenie) Render(e alert.Event) ([]byte, string, error) {
+	var req interface{}
+	if e.Kind == alert.EventRecovered {
+		req = map[string]string{
+			"source": o.Source,
+			"note":   e.Summary(),
+		}
+	} else {
+		details := make(map[string]string)
+		var description strings.Builder
+		for _, f := range facts(e) {
+			details[f[0]] = f[1]
+			fmt.Fprintf(&description, "%s: %s\n", f[0], f[1])
+		}
+		req = map[string]interface{}{
+			"message":     truncate(e.Summary(), 130),
+			"alias":       incidentKey(o.Source, e),
+			"description": description.String(),
+			"priority":    opsgeniePriorities[e.Severity],
+			"source":      o.Source,
+			"tags":        []string{"speedplane", e.Metric},
+			"details":     details,
+		}
+	}
+	body, err := json.Marshal(req)
+	return body, "application/json", err
+}
+
+// Notify implements alert.Notifier.
+func (o *Opsgenie) Notify(ctx context.Context, e alert.Event) error {
+	body, contentType, err := o.Render(e)
+	if err != nil {
+		return err
+	}
+	u := o.URL + "/v2/alerts"
+	if e.Kind == alert.EventRecovered {
+		u += "/" + url.PathEscape(incidentKey(o.Source, e)) + "/close?identifierType=alias"
+	}
+	headers := map[string]string{"Authorization": "GenieKey " + o.APIKey}
+	if err := send(ctx, o.Client, http.MethodPost, u, contentType, headers, body); err != nil {
+		return fmt.Errorf("opsgenie: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"speedplane/alert"
+)
+
+// PagerDutyEventsURL is the PagerDuty Events API v2 endpoint.
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDuty triggers a PagerDuty incident when a rule degrades and resolves
+// it when the rule recovers, through the Events API v2. Reminders trigger
+// again with the same dedup key, which PagerDuty folds into the open
+// incident.
+type PagerDuty struct {
+	RoutingKey string // Integration key of an Events API v2 integration
+	Source     string // Names this instance in incidents; defaults to the hostname
+	URL        string // Defaults to PagerDutyEventsURL
+	Client     *http.Client
+}
+
+// NewPagerDuty creates a PagerDuty notifier with a 15 second request timeout.
+func NewPagerDuty(routingKey, source string) (*PagerDuty, error) {
+	if routingKey == "" {
+		return nil, errors.New("missing routing key")
+	}
+	if source == "" {
+		source = defaultSource()
+	}
+	return &PagerDuty{
+		RoutingKey: routingKey,
+		Source:     source,
+		URL:        PagerDutyEventsURL,
+		Client:     &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+// Endpoint implements Channel.
+func (p *PagerDuty) Endpoint() string {
+	return p.URL
+}
+
+// Render implements Channel.
+func (p *PagerDuty) Render(e alert.Event) ([]byte, string, error) {
+	event := map[string]interface{}{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    incidentKey(p.Source, e),
+	}
+	if e.Kind == alert.EventRecovered {
+		event["event_action"] = "resolve"
+	} else {
+		details := make(map[string]string)
+		for _, f := range facts(e) {
+			details[f[0]] = f[1]
+		}
+		event["payload"] = map[string]interface{}{
+			"summary":        truncate(e.Summary(), 1024),
+			"source":         p.Source,
+			"severity":       e.Severity,
+			"timestamp":      e.Time.UTC().Format(time.RFC3339),
+			"component":      e.Metric,
+			"class":          "speedtest",
+			"custom_details": details,
+		}
+	}
+	body, err := json.Marshal(event)
+	return body, "application/json", err
+}
+
+// Notify implements alert.Notifier.
+func (p *PagerDuty) Notify(ctx context.Context, e alert.Event) error {
+	body, contentType, err := p.Render(e)
+	if err != nil {
+		return err
+	}
+	if err := send(ctx, p.Client, http.MethodPost, p.URL, contentType, nil, body); err != nil {
+		return fmt.Errorf("pagerduty: %w", err)
+	}
+	return nil
+}
+
+// truncate shortens s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"speedplane/alert"
+)
+
+// Teams posts alert events as Adaptive Cards to a Microsoft Teams incoming
+// webhook, either a Workflows webhook or a legacy connector.
+type Teams struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewTeams creates a Teams notifier with a 15 second request timeout.
+func NewTeams(url string) *Teams {
+	return &Teams{URL: url, Client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// Endpoint implements Channel.
+func (t *Teams) Endpoint() string {
+	return t.URL
+}
+
+// Render implements Channel.
+func (t *Teams) Render(e alert.Event) ([]byte, string, error) {
+	color := "Attention"
+	if e.Kind == alert.EventRecovered {
+		color = "Good"
+	}
+	var factSet []map[string]string
+	for _, f := range facts(e) {
+		factSet = append(factSet, map[string]string{"title": f[0], "value": f[1]})
+	}
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []interface{}{
+			map[string]interface{}{
+				"type":   "TextBlock",
+				"text":   e.Summary(),
+				"weight": "Bolder",
+				"color":  color,
+				"wrap":   true,
+			},
+			map[string]interface{}{
+				"type":  "FactSet",
+				"facts": factSet,
+			},
+		},
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content":     card,
+			},
+		},
+	})
+	return body, "application/json", err
+}
+
+// Notify implements alert.Notifier.
+func (t *Teams) Notify(ctx context.Context, e alert.Event) error {
+	body, contentType, err := t.Render(e)
+	if err != nil {
+		return err
+	}
+	if err := send(ctx, t.Client, http.MethodPost, t.URL, contentType, nil, body); err != nil {
+		return fmt.Errorf("teams: %w", err)
+	}
+	return nil
+}
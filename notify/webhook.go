@@ -0,0 +1,210 @@
+// Package notify delivers alert events to external services.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"speedplane/alert"
+	"speedplane/model"
+)
+
+// Channel is a notifier whose messages can be rendered without sending
+// them, to preview what a service will receive.
+type Channel interface {
+	alert.Notifier
+	// Render returns the request body and content type e is sent with.
+	Render(e alert.Event) (body []byte, contentType string, err error)
+	// Endpoint describes where messages go, e.g. a URL, for display.
+	Endpoint() string
+}
+
+// Webhook POSTs alert events to a URL, as JSON unless it has a template.
+type Webhook struct {
+	Name        string
+	URL         string
+	Headers     map[string]string
+	ContentType string             // Defaults to application/json
+	Template    *template.Template // Renders the body from a Payload; nil sends the Payload as JSON
+	Client      *http.Client
+}
+
+// NewWebhook creates a Webhook with a 15 second request timeout.
+func NewWebhook(url string, headers map[string]string) *Webhook {
+	return &Webhook{
+		URL:     url,
+		Headers: headers,
+		Client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Payload is what a webhook is sent, and what its template renders: the
+// event's fields plus a one-line summary.
+type Payload struct {
+	alert.Event
+	Summary string `json:"summary"`
+}
+
+// templateFuncs are available to webhook templates besides Go's built-ins.
+var templateFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. {{json .Summary}} for a quoted,
+	// escaped string
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// time formats a time in RFC3339, the format most APIs expect
+	"time": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// SetTemplate parses text as a text/template rendering the request body from
+// a Payload, e.g. into a chat service's message format. An empty text sends
+// the Payload as JSON.
+func (w *Webhook) SetTemplate(text string) error {
+	if text == "" {
+		w.Template = nil
+		return nil
+	}
+	t, err := template.New(w.Name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return fmt.Errorf("parse template: %w", err)
+	}
+	w.Template = t
+	return nil
+}
+
+// Render returns the request body and content type e is sent with.
+func (w *Webhook) Render(e alert.Event) ([]byte, string, error) {
+	contentType := w.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	payload := Payload{Event: e, Summary: e.Summary()}
+	if w.Template == nil {
+		body, err := json.Marshal(payload)
+		return body, contentType, err
+	}
+	var buf bytes.Buffer
+	if err := w.Template.Execute(&buf, payload); err != nil {
+		return nil, "", fmt.Errorf("render template: %w", err)
+	}
+	return buf.Bytes(), contentType, nil
+}
+
+// Endpoint implements Channel.
+func (w *Webhook) Endpoint() string {
+	return w.URL
+}
+
+// Notify implements alert.Notifier.
+func (w *Webhook) Notify(ctx context.Context, e alert.Event) error {
+	body, contentType, err := w.Render(e)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", w.URL, err)
+	}
+	if err := send(ctx, w.Client, http.MethodPost, w.URL, contentType, w.Headers, body); err != nil {
+		return fmt.Errorf("webhook %s: %w", w.URL, err)
+	}
+	return nil
+}
+
+// SampleEvent returns a degraded event for a made-up rule, for trying out
+// channels. It carries result, which may be nil, as the triggering result.
+func SampleEvent(result *model.SpeedtestResult, now time.Time) alert.Event {
+	e := alert.Event{
+		Kind:      alert.EventDegraded,
+		RuleID:    "test",
+		RuleName:  "Test alert",
+		Metric:    "download_mbps",
+		Operator:  "<",
+		Threshold: 50,
+		Severity:  model.DefaultAlertSeverity,
+		Value:     42.5,
+		Since:     now,
+		Time:      now,
+		Result:    result,
+	}
+	if result != nil {
+		e.Value = result.DownloadMbps
+		e.Threshold = result.DownloadMbps + 10
+	}
+	return e
+}
+
+// send makes a request with body and fails unless it gets a 2xx response.
+func send(ctx context.Context, client *http.Client, method, url, contentType string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "speedplane")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// incidentKey identifies the incident an event belongs to in incident tools,
+// so a recovery resolves the incident its breach opened and reminders don't
+// open new ones. Schedules with their own rule states get their own
+// incidents, and source keeps instances reporting to one service apart.
+func incidentKey(source string, e alert.Event) string {
+	key := "speedplane/" + source + "/" + e.RuleID
+	if e.Schedule != "" {
+		key += "/" + e.Schedule
+	}
+	return key
+}
+
+// defaultSource names this instance in incident tools when no source is
+// configured.
+func defaultSource() string {
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return "speedplane"
+}
+
+// facts lists the details of an event worth showing in a chat message, as
+// label and value pairs.
+func facts(e alert.Event) [][2]string {
+	out := [][2]string{
+		{"Rule", e.RuleName},
+		{"Value", fmt.Sprintf("%s %.2f (threshold %s %.2f)", e.Metric, e.Value, e.Operator, e.Threshold)},
+		{"Since", e.Since.UTC().Format(time.RFC3339)},
+	}
+	if r := e.Result; r != nil {
+		out = append(out,
+			[2]string{"Result", fmt.Sprintf("%.2f / %.2f Mbps, %.1f ms", r.DownloadMbps, r.UploadMbps, r.PingMs)},
+			[2]string{"Server", fmt.Sprintf("%s (%s)", r.ServerName, r.ServerID)},
+		)
+		if r.Connection != "" {
+			out = append(out, [2]string{"Connection", r.Connection})
+		}
+	}
+	return out
+}
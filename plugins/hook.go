@@ -0,0 +1,113 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"speedplane/model"
+)
+
+// DefaultHookTimeout is how long a hook may take without a timeout of its
+// own.
+const DefaultHookTimeout = 30 * time.Second
+
+// maxNoteLength limits the note a hook can add to a result.
+const maxNoteLength = 1024
+
+// ErrVetoed is returned, wrapped, by Hook.Process when a hook rejects a
+// result, which then isn't saved.
+var ErrVetoed = errors.New("vetoed")
+
+// HookResponse is what a hook may print on standard output. Printing
+// nothing keeps the result as it is.
+type HookResponse struct {
+	Tags   []string `json:"tags,omitempty"`   // Added to the result's tags
+	Note   string   `json:"note,omitempty"`   // Added to the result's note
+	Veto   bool     `json:"veto,omitempty"`   // Don't save the result
+	Reason string   `json:"reason,omitempty"` // Why, for the log
+}
+
+// Hook is a program that post-processes each measured result before it is
+// saved. It gets the result as JSON on standard input and can add tags and a
+// note to it, or veto saving it, by printing a HookResponse.
+type Hook struct {
+	Command
+}
+
+// NewHook creates a hook running args; timeout 0 uses DefaultHookTimeout.
+func NewHook(name string, args []string, env map[string]string, timeout time.Duration) (*Hook, error) {
+	if timeout == 0 {
+		timeout = DefaultHookTimeout
+	}
+	c, err := newCommand(name, args, env, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Hook{Command: c}, nil
+}
+
+// Process runs the hook on res and applies its response. It returns an error
+// wrapping ErrVetoed if the hook vetoed the result, and leaves res unchanged
+// if the hook failed.
+func (h *Hook) Process(ctx context.Context, res *model.SpeedtestResult) error {
+	resp, err := h.run(ctx, res)
+	if err != nil {
+		return fmt.Errorf("hook %s: %w", h.Name, err)
+	}
+	if resp.Veto {
+		if resp.Reason != "" {
+			return fmt.Errorf("hook %s: %w: %s", h.Name, ErrVetoed, resp.Reason)
+		}
+		return fmt.Errorf("hook %s: %w", h.Name, ErrVetoed)
+	}
+	for _, tag := range resp.Tags {
+		if err := model.ValidateTag(tag); err != nil {
+			return fmt.Errorf("hook %s: %w", h.Name, err)
+		}
+	}
+	note := strings.TrimSpace(resp.Note)
+	if len(note) > maxNoteLength {
+		return fmt.Errorf("hook %s: note is longer than %d bytes", h.Name, maxNoteLength)
+	}
+
+	for _, tag := range resp.Tags {
+		if !slices.Contains(res.Tags, tag) {
+			res.Tags = append(res.Tags, tag)
+		}
+	}
+	switch {
+	case note == "":
+	case res.Note == "":
+		res.Note = note
+	default:
+		res.Note += "; " + note
+	}
+	return nil
+}
+
+func (h *Hook) run(ctx context.Context, res *model.SpeedtestResult) (HookResponse, error) {
+	var resp HookResponse
+	in, err := json.Marshal(res)
+	if err != nil {
+		return resp, err
+	}
+
+	out, err := h.output(ctx, in)
+	if err != nil {
+		return resp, err
+	}
+	out = bytes.TrimSpace(out)
+	if len(out) == 0 {
+		return resp, nil
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return resp, fmt.Errorf("invalid response: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,362 @@
+// Package plugins runs speedtest engines and alert channels provided by
+// external programs, so they can be added without changing speedplane.
+//
+// A plugin is an executable started once per call. speedplane writes a
+// Request as one line of JSON to its standard input and closes it, then reads
+// Messages, one JSON object per line, from its standard output until it
+// exits. An engine reports "progress" messages and ends with a "result"; a
+// notifier only needs to exit with status 0. Either can fail with an "error"
+// message, or by exiting with another status, in which case the last line it
+// wrote to standard error is reported. Lines that aren't JSON objects are
+// ignored, so a plugin's own output doesn't break the protocol.
+//
+// Programs that don't speak the protocol can be run as engines with Script.
+// Hooks get each result before it is saved and can amend or veto it.
+package plugins
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"speedplane/alert"
+	"speedplane/model"
+)
+
+// Protocol is the version of the protocol spoken with plugins, sent in each
+// Request. Fields are only ever added to it; anything else bumps it.
+const Protocol = 1
+
+// Plugin kinds.
+const (
+	KindEngine   = "engine"
+	KindNotifier = "notifier"
+	KindScript   = "script" // An engine that doesn't speak the protocol, see Script
+	KindHook     = "hook"   // Post-processes results before they are saved, see Hook
+)
+
+// Request and message types.
+const (
+	TypeRun      = "run"      // Request: run a speedtest
+	TypeNotify   = "notify"   // Request: deliver an alert event
+	TypeProgress = "progress" // Message: a speedtest stage
+	TypeResult   = "result"   // Message: the speedtest result
+	TypeError    = "error"    // Message: the call failed
+)
+
+// Defaults for calls without a timeout of their own.
+const (
+	DefaultEngineTimeout   = 5 * time.Minute
+	DefaultNotifierTimeout = 30 * time.Second
+)
+
+// validName matches plugin names, which are used as engine names in
+// schedules and results.
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Request is what a plugin is sent on standard input.
+type Request struct {
+	Protocol int          `json:"protocol"`
+	Type     string       `json:"type"`
+	Name     string       `json:"name"`             // Of the plugin, as configured
+	Source   string       `json:"source,omitempty"` // run: local address to test from; empty for the default route
+	Event    *alert.Event `json:"event,omitempty"`  // notify: the event to deliver
+	Summary  string       `json:"summary,omitempty"`
+}
+
+// Message is what a plugin writes to standard output, one per line.
+type Message struct {
+	Type    string                 `json:"type"`
+	Stage   string                 `json:"stage,omitempty"` // progress: e.g. "ping", "download" or "upload"
+	Message string                 `json:"message,omitempty"`
+	Result  *model.SpeedtestResult `json:"result,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// Command is a configured plugin program.
+type Command struct {
+	Name    string
+	Args    []string          // The program and its arguments
+	Env     map[string]string // Added to speedplane's environment
+	Timeout time.Duration     // Per call; the program is killed when it runs out
+}
+
+// newCommand checks a plugin's name and program.
+func newCommand(name string, args []string, env map[string]string, timeout time.Duration) (Command, error) {
+	if !validName.MatchString(name) {
+		return Command{}, fmt.Errorf("invalid name %q, must be lowercase letters, digits, - and _", name)
+	}
+	if len(args) == 0 || args[0] == "" {
+		return Command{}, fmt.Errorf("plugin %s: missing command", name)
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return Command{}, fmt.Errorf("plugin %s: %w", name, err)
+	}
+	if timeout < 0 {
+		return Command{}, fmt.Errorf("plugin %s: negative timeout", name)
+	}
+	return Command{Name: name, Args: args, Env: env, Timeout: timeout}, nil
+}
+
+// call runs the program with req and passes each message it writes to
+// handle. It fails on an error message, a failing exit status or an error
+// returned by handle.
+func (c Command) call(ctx context.Context, req Request, handle func(Message) error) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	req.Protocol, req.Name = Protocol, c.Name
+	in, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	cmd.Stdin = bytes.NewReader(append(in, '\n'))
+	cmd.Env = os.Environ()
+	for k, v := range c.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	var stderr lastLine
+	cmd.Stderr = &stderr
+	// Don't wait for children that inherited the pipes once the program is killed
+	cmd.WaitDelay = 5 * time.Second
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var failed error
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(make([]byte, 64<<10), 4<<20)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var m Message
+		if err := json.Unmarshal(line, &m); err != nil {
+			continue
+		}
+		if failed != nil {
+			continue
+		}
+		if m.Type == TypeError {
+			failed = errors.New(m.Error)
+			continue
+		}
+		failed = handle(m)
+	}
+	// Let the program finish after a failure rather than blocking on its output
+	_, _ = io.Copy(io.Discard, stdout)
+	err = cmd.Wait()
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("timed out after %s", c.Timeout)
+	case failed != nil:
+		return failed
+	case err != nil:
+		if msg := stderr.String(); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// output runs the program with stdin and the extra environment variables
+// env, and returns what it printed. It fails on a failing exit status.
+func (c Command) output(ctx context.Context, stdin []byte, env ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(append(stdin, '\n'))
+	}
+	cmd.Env = append(os.Environ(), env...)
+	for k, v := range c.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	var stdout limitedBuffer
+	var stderr lastLine
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.WaitDelay = 5 * time.Second
+	err := cmd.Run()
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, fmt.Errorf("timed out after %s", c.Timeout)
+	case err != nil:
+		if msg := stderr.String(); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	case stdout.truncated:
+		return nil, fmt.Errorf("output is larger than %d bytes", maxOutput)
+	}
+	return stdout.Bytes(), nil
+}
+
+// maxOutput limits how much of a program's output is read.
+const maxOutput = 16 << 20
+
+// limitedBuffer keeps the first maxOutput bytes written to it.
+type limitedBuffer struct {
+	bytes.Buffer
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxOutput - b.Len(); len(p) > room {
+		b.truncated = true
+		b.Buffer.Write(p[:room])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// lastLine keeps the last non-empty line written to it, for error messages.
+type lastLine struct {
+	buf  []byte
+	last string
+}
+
+func (l *lastLine) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(l.buf[:i])); line != "" {
+			l.last = line
+		}
+		l.buf = l.buf[i+1:]
+	}
+	// Bound a line that never ends
+	if len(l.buf) > 4<<10 {
+		l.buf = l.buf[len(l.buf)-4<<10:]
+	}
+	return len(p), nil
+}
+
+func (l *lastLine) String() string {
+	if line := strings.TrimSpace(string(l.buf)); line != "" {
+		return line
+	}
+	return l.last
+}
+
+// Engine is a speedtest engine provided by a plugin. It implements
+// speedtest.Engine.
+type Engine struct {
+	Command
+}
+
+// NewEngine creates an engine plugin running args; timeout 0 uses
+// DefaultEngineTimeout.
+func NewEngine(name string, args []string, env map[string]string, timeout time.Duration) (*Engine, error) {
+	if timeout == 0 {
+		timeout = DefaultEngineTimeout
+	}
+	c, err := newCommand(name, args, env, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{Command: c}, nil
+}
+
+// RunFrom runs a speedtest with the plugin. The result's engine defaults to
+// the plugin's name, its time to when the plugin finished, and it gets an ID
+// unless the plugin gave it one.
+func (e *Engine) RunFrom(ctx context.Context, source string, progress func(stage string, message string)) (*model.SpeedtestResult, error) {
+	if progress == nil {
+		progress = func(_ string, _ string) {}
+	}
+	var res *model.SpeedtestResult
+	err := e.call(ctx, Request{Type: TypeRun, Source: source}, func(m Message) error {
+		switch m.Type {
+		case TypeProgress:
+			progress(m.Stage, m.Message)
+		case TypeResult:
+			if m.Result == nil {
+				return errors.New("result message without a result")
+			}
+			res = m.Result
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", e.Name, err)
+	}
+	if res == nil {
+		return nil, fmt.Errorf("plugin %s: exited without a result", e.Name)
+	}
+	if res.Engine == "" {
+		res.Engine = e.Name
+	}
+	if res.ID == "" {
+		res.ID = model.NewID()
+	}
+	if res.Timestamp.IsZero() {
+		res.Timestamp = time.Now().UTC()
+	}
+	return res, nil
+}
+
+// Notifier is an alert channel provided by a plugin. It implements
+// notify.Channel, so it can be picked by schedules and tested like any other
+// channel.
+type Notifier struct {
+	Command
+}
+
+// NewNotifier creates a notifier plugin running args; timeout 0 uses
+// DefaultNotifierTimeout.
+func NewNotifier(name string, args []string, env map[string]string, timeout time.Duration) (*Notifier, error) {
+	if timeout == 0 {
+		timeout = DefaultNotifierTimeout
+	}
+	c, err := newCommand(name, args, env, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Notifier{Command: c}, nil
+}
+
+func (n *Notifier) request(e alert.Event) Request {
+	return Request{Type: TypeNotify, Event: &e, Summary: e.Summary()}
+}
+
+// Notify implements alert.Notifier.
+func (n *Notifier) Notify(ctx context.Context, e alert.Event) error {
+	if err := n.call(ctx, n.request(e), func(Message) error { return nil }); err != nil {
+		return fmt.Errorf("plugin %s: %w", n.Name, err)
+	}
+	return nil
+}
+
+// Render returns the request the plugin is sent for e.
+func (n *Notifier) Render(e alert.Event) ([]byte, string, error) {
+	req := n.request(e)
+	req.Protocol, req.Name = Protocol, n.Name
+	body, err := json.Marshal(req)
+	return body, "application/json", err
+}
+
+// Endpoint returns the plugin's command line.
+func (n *Notifier) Endpoint() string {
+	return strings.Join(n.Args, " ")
+}
@@ -0,0 +1,79 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"speedplane/ingest"
+	"speedplane/model"
+)
+
+// SourceEnv tells a script the local address to test from, empty for the
+// default route.
+const SourceEnv = "SPEEDPLANE_SOURCE"
+
+// Script is a speedtest engine running a program that prints its
+// measurement as JSON, mapped to a result like an ingested measurement. The
+// program gets nothing on standard input. Its output may hold more than one
+// measurement, as a JSON array or JSON Lines, in which case the last one is
+// used, e.g. the summary after a tool's interim reports. It implements
+// speedtest.Engine.
+type Script struct {
+	Command
+	Mapping *ingest.Mapping
+}
+
+// NewScript creates a script engine running args; timeout 0 uses
+// DefaultEngineTimeout.
+func NewScript(name string, args []string, env map[string]string, timeout time.Duration, mapping *ingest.Mapping) (*Script, error) {
+	if timeout == 0 {
+		timeout = DefaultEngineTimeout
+	}
+	c, err := newCommand(name, args, env, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Script{Command: c, Mapping: mapping}, nil
+}
+
+// RunFrom runs the script and maps its output. The result's engine is the
+// script's name, and it gets an ID unless the mapping gave it one.
+func (s *Script) RunFrom(ctx context.Context, source string, progress func(stage string, message string)) (*model.SpeedtestResult, error) {
+	if progress != nil {
+		progress("init", fmt.Sprintf("Running %s...", s.Name))
+	}
+	res, err := s.run(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", s.Name, err)
+	}
+	if progress != nil {
+		progress("processing", "Processing results...")
+	}
+	res.Engine = s.Name
+	if res.ID == "" {
+		res.ID = model.NewID()
+	}
+	return res, nil
+}
+
+func (s *Script) run(ctx context.Context, source string) (*model.SpeedtestResult, error) {
+	out, err := s.output(ctx, nil, SourceEnv+"="+source)
+	if err != nil {
+		return nil, err
+	}
+	items, err := ingest.Split(bytes.NewReader(out))
+	if err != nil {
+		return nil, fmt.Errorf("output is not JSON: %w", err)
+	}
+	if len(items) == 0 {
+		return nil, errors.New("no output")
+	}
+	res, err := s.Mapping.Result(items[len(items)-1])
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
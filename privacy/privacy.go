@@ -0,0 +1,167 @@
+// Package privacy redacts the external IP address recorded with results, for
+// users who publish their dashboards.
+package privacy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"speedplane/model"
+)
+
+// SaltFile is the name of the file in the data directory holding the key
+// addresses are hashed with.
+const SaltFile = "speedplane.salt"
+
+// Ways of redacting an address before it is stored.
+const (
+	ModeTruncate = "truncate" // Keep the network: /24 for IPv4, /48 for IPv6
+	ModeHash     = "hash"     // Keep a keyed hash, which still shows when the address changes
+)
+
+// Redactor redacts addresses in results before they are stored.
+type Redactor struct {
+	mode string
+	salt []byte
+}
+
+// New creates a Redactor for mode. salt is only used, and then required, by
+// ModeHash.
+func New(mode string, salt []byte) (*Redactor, error) {
+	switch mode {
+	case ModeTruncate:
+	case ModeHash:
+		if len(salt) == 0 {
+			return nil, errors.New("hash requires a salt")
+		}
+	default:
+		return nil, fmt.Errorf("unknown mode %q (want %q or %q)", mode, ModeTruncate, ModeHash)
+	}
+	return &Redactor{mode: mode, salt: salt}, nil
+}
+
+// IP returns the redacted form of ip. Values that aren't an IP address are
+// hashed, or cleared when truncating.
+func (r *Redactor) IP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	if r.mode == ModeHash {
+		mac := hmac.New(sha256.New, r.salt)
+		mac.Write([]byte(ip))
+		return hex.EncodeToString(mac.Sum(nil)[:8])
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// Result redacts the result's external IP address, also where it appears
+// in the engine's raw output.
+func (r *Redactor) Result(res *model.SpeedtestResult) {
+	if res.ExternalIP == "" {
+		return
+	}
+	redacted := r.IP(res.ExternalIP)
+	res.RawJSON = replaceInJSON(res.RawJSON, res.ExternalIP, redacted)
+	res.ExternalIP = redacted
+}
+
+// Strip removes the result's external IP address, also where it appears in
+// the engine's raw output, e.g. before the result is exported.
+func Strip(res *model.SpeedtestResult) {
+	if res.ExternalIP == "" {
+		return
+	}
+	res.RawJSON = replaceInJSON(res.RawJSON, res.ExternalIP, "")
+	res.ExternalIP = ""
+}
+
+// replaceInJSON replaces string values equal to old anywhere in raw. raw is
+// returned unchanged if it isn't valid JSON or doesn't contain old.
+func replaceInJSON(raw json.RawMessage, old, repl string) json.RawMessage {
+	if len(raw) == 0 || !bytes.Contains(raw, []byte(old)) {
+		return raw
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return raw
+	}
+	out, err := json.Marshal(replaceValue(v, old, repl))
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+func replaceValue(v interface{}, old, repl string) interface{} {
+	switch v := v.(type) {
+	case string:
+		if v == old {
+			return repl
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = replaceValue(e, old, repl)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = replaceValue(e, old, repl)
+		}
+	}
+	return v
+}
+
+// LoadOrCreateSalt reads the hashing key at path, generating and saving a
+// new one, readable only by the owner, if the file doesn't exist yet. It
+// must be kept for hashes of the same address to stay the same.
+func LoadOrCreateSalt(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		salt, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+		if err != nil || len(salt) == 0 {
+			return nil, fmt.Errorf("%s: invalid salt", path)
+		}
+		return salt, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	// O_EXCL so a salt created concurrently is never overwritten
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write([]byte(hex.EncodeToString(salt) + "\n")); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
@@ -0,0 +1,125 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	icmpEchoRequest = 8
+	icmpEchoReply   = 0
+)
+
+// pingICMP sends count ICMP echo requests to host (IPv4) and returns the
+// round-trip times of the replies.
+func pingICMP(ctx context.Context, host string, count int, spacing, timeout time.Duration) ([]time.Duration, error) {
+	dst, err := net.ResolveIPAddr("ip4", host)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", host, err)
+	}
+
+	conn, raw, err := listenICMP()
+	if err != nil {
+		return nil, fmt.Errorf("open icmp socket: %w", err)
+	}
+	defer conn.Close()
+
+	// Datagram ICMP sockets get their echo ID assigned by the kernel, so
+	// replies are matched on a random token in the payload instead.
+	var token [8]byte
+	_, _ = rand.Read(token[:])
+	id := int(binary.BigEndian.Uint16(token[:2]))
+
+	var addr net.Addr = dst
+	if !raw {
+		addr = &net.UDPAddr{IP: dst.IP}
+	}
+
+	send := func(seq int) error {
+		_, err := conn.WriteTo(icmpEcho(id, seq, token[:]), addr)
+		return err
+	}
+	recv := func(deadline time.Time) (int, error) {
+		buf := make([]byte, 1500)
+		for {
+			if err := conn.SetReadDeadline(deadline); err != nil {
+				return -1, err
+			}
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return -1, err
+			}
+			if !sameIP(from, dst.IP) {
+				continue
+			}
+			seq, err := parseEchoReply(buf[:n], token[:])
+			if err != nil {
+				continue
+			}
+			return seq, nil
+		}
+	}
+
+	return collect(ctx, count, spacing, timeout, send, recv)
+}
+
+// icmpEcho builds an echo request with the token and send time as payload.
+func icmpEcho(id, seq int, token []byte) []byte {
+	msg := make([]byte, 8, 8+len(token)+8)
+	msg[0] = icmpEchoRequest
+	binary.BigEndian.PutUint16(msg[4:], uint16(id))
+	binary.BigEndian.PutUint16(msg[6:], uint16(seq))
+	msg = append(msg, token...)
+	msg = binary.BigEndian.AppendUint64(msg, uint64(time.Now().UnixNano()))
+	binary.BigEndian.PutUint16(msg[2:], checksum(msg))
+	return msg
+}
+
+// parseEchoReply returns the sequence number of an echo reply carrying token.
+// A leading IPv4 header, as delivered by some raw sockets, is skipped.
+func parseEchoReply(b, token []byte) (int, error) {
+	if len(b) >= 20 && b[0]>>4 == 4 {
+		hdrLen := int(b[0]&0x0f) * 4
+		if hdrLen >= 20 && len(b) > hdrLen {
+			b = b[hdrLen:]
+		}
+	}
+	if len(b) < 8+len(token) || b[0] != icmpEchoReply || b[1] != 0 {
+		return 0, errors.New("not an echo reply")
+	}
+	if !bytes.Equal(b[8:8+len(token)], token) {
+		return 0, errors.New("reply for another probe")
+	}
+	return int(binary.BigEndian.Uint16(b[6:8])), nil
+}
+
+// checksum is the Internet checksum (RFC 1071).
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+func sameIP(addr net.Addr, ip net.IP) bool {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP.Equal(ip)
+	case *net.UDPAddr:
+		return a.IP.Equal(ip)
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+//go:build linux
+
+package probe
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenICMP opens a raw ICMP socket, falling back to an unprivileged ICMP
+// datagram socket (allowed for groups in net.ipv4.ping_group_range) when the
+// process lacks CAP_NET_RAW. It reports whether the socket is raw.
+func listenICMP() (net.PacketConn, bool, error) {
+	conn, rawErr := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if rawErr == nil {
+		return conn, true, nil
+	}
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, syscall.IPPROTO_ICMP)
+	if err != nil {
+		// Report the raw socket error; it is the more actionable of the two
+		return nil, false, rawErr
+	}
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+
+	conn, err = net.FilePacketConn(f)
+	if err != nil {
+		return nil, false, err
+	}
+	return conn, false, nil
+}
+
+// setDontFragment sets the don't-fragment bit on conn's packets and makes
+// the kernel refuse packets larger than the path MTU it knows of.
+func setDontFragment(conn net.PacketConn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return errors.New("socket has no file descriptor")
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = rc.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_DO)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
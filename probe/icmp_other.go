@@ -0,0 +1,23 @@
+//go:build !linux
+
+package probe
+
+import (
+	"errors"
+	"net"
+)
+
+// listenICMP opens a raw ICMP socket, which usually requires root. It
+// reports whether the socket is raw.
+func listenICMP() (net.PacketConn, bool, error) {
+	conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return nil, false, err
+	}
+	return conn, true, nil
+}
+
+// setDontFragment is only implemented on Linux.
+func setDontFragment(conn net.PacketConn) error {
+	return errors.New("path MTU discovery is only supported on Linux")
+}
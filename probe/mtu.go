@@ -0,0 +1,134 @@
+package probe
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Path MTU discovery limits.
+const (
+	MinMTU        = 576 // Every IPv4 host must accept datagrams this large
+	DefaultMaxMTU = 1500
+
+	mtuTries   = 2
+	mtuTimeout = 700 * time.Millisecond
+	ipv4Header = 20
+	icmpHeader = 8
+)
+
+// PathMTU returns the largest IPv4 packet, up to maxMTU bytes, that reaches
+// host without being fragmented. It pings host with the don't-fragment bit
+// set and searches for the largest size that is answered, so hosts that
+// drop large pings report a smaller MTU than the path has.
+func PathMTU(ctx context.Context, host string, maxMTU int) (int, error) {
+	if maxMTU <= 0 {
+		maxMTU = DefaultMaxMTU
+	}
+	if maxMTU < MinMTU {
+		return 0, fmt.Errorf("max MTU %d is below the minimum of %d", maxMTU, MinMTU)
+	}
+	dst, err := net.ResolveIPAddr("ip4", host)
+	if err != nil {
+		return 0, fmt.Errorf("resolve %s: %w", host, err)
+	}
+
+	conn, raw, err := listenICMP()
+	if err != nil {
+		return 0, fmt.Errorf("open icmp socket: %w", err)
+	}
+	defer conn.Close()
+	if err := setDontFragment(conn); err != nil {
+		return 0, fmt.Errorf("set don't fragment: %w", err)
+	}
+
+	var token [8]byte
+	_, _ = rand.Read(token[:])
+	id := int(binary.BigEndian.Uint16(token[:2]))
+	var addr net.Addr = dst
+	if !raw {
+		addr = &net.UDPAddr{IP: dst.IP}
+	}
+
+	seq := 0
+	buf := make([]byte, maxMTU+ipv4Header)
+	fits := func(size int) (bool, error) {
+		for try := 0; try < mtuTries; try++ {
+			seq++
+			if _, err := conn.WriteTo(paddedEcho(id, seq, token[:], size-ipv4Header), addr); err != nil {
+				// The kernel refuses packets larger than the interface
+				// or a path MTU it has already learned
+				if errors.Is(err, syscall.EMSGSIZE) {
+					return false, nil
+				}
+				return false, err
+			}
+			deadline := time.Now().Add(mtuTimeout)
+			for {
+				if err := ctx.Err(); err != nil {
+					return false, err
+				}
+				if err := conn.SetReadDeadline(deadline); err != nil {
+					return false, err
+				}
+				n, from, err := conn.ReadFrom(buf)
+				if err != nil {
+					break
+				}
+				if !sameIP(from, dst.IP) {
+					continue
+				}
+				if got, err := parseEchoReply(buf[:n], token[:]); err == nil && got == seq&0xffff {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+
+	ok, err := fits(maxMTU)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return maxMTU, nil
+	}
+	if ok, err = fits(MinMTU); err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("%s does not answer pings", host)
+	}
+	// lo is answered and hi is not
+	lo, hi := MinMTU, maxMTU
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		ok, err := fits(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// paddedEcho builds an echo request of size bytes, without the IP header,
+// carrying token followed by zeros.
+func paddedEcho(id, seq int, token []byte, size int) []byte {
+	msg := make([]byte, max(size, icmpHeader+len(token)))
+	msg[0] = icmpEchoRequest
+	binary.BigEndian.PutUint16(msg[4:], uint16(id))
+	binary.BigEndian.PutUint16(msg[6:], uint16(seq))
+	copy(msg[icmpHeader:], token)
+	binary.BigEndian.PutUint16(msg[2:], checksum(msg))
+	return msg
+}
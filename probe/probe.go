@@ -0,0 +1,215 @@
+// Package probe measures packet loss and round-trip time to configured
+// targets with ICMP echo or UDP echo requests, independently of the
+// speedtest engine.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"speedplane/model"
+)
+
+// Probe kinds.
+const (
+	KindICMP = "icmp"
+	KindUDP  = "udp"
+)
+
+// Defaults used when a Prober option is zero.
+const (
+	DefaultCount    = 10
+	DefaultSpacing  = 200 * time.Millisecond
+	DefaultTimeout  = 2 * time.Second
+	DefaultInterval = time.Minute
+)
+
+// Target is a host to probe.
+type Target struct {
+	Name    string
+	Kind    string // KindICMP or KindUDP
+	Address string // Host for ICMP; host:port of a UDP echo responder for UDP
+}
+
+// Prober runs rounds of probes against all targets.
+type Prober struct {
+	Targets []Target
+	Count   int           // Packets per target per round
+	Spacing time.Duration // Delay between packets
+	Timeout time.Duration // How long to wait for replies after the last packet
+}
+
+// Validate checks that every target has a supported kind and an address.
+func Validate(targets []Target) error {
+	seen := make(map[string]bool)
+	for _, t := range targets {
+		if t.Name == "" {
+			return fmt.Errorf("probe target %q: name is required", t.Address)
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("probe target %q: duplicate name", t.Name)
+		}
+		seen[t.Name] = true
+		switch t.Kind {
+		case KindICMP, KindUDP:
+		default:
+			return fmt.Errorf("probe target %q: kind must be %q or %q", t.Name, KindICMP, KindUDP)
+		}
+		if t.Address == "" {
+			return fmt.Errorf("probe target %q: address is required", t.Name)
+		}
+	}
+	return nil
+}
+
+// Round probes every target concurrently and returns one result per target.
+// Targets that can't be probed at all get a result with Error set and 100% loss.
+func (p *Prober) Round(ctx context.Context) []model.ProbeResult {
+	results := make([]model.ProbeResult, len(p.Targets))
+	var wg sync.WaitGroup
+	for i, t := range p.Targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			results[i] = p.probe(ctx, t)
+		}(i, t)
+	}
+	wg.Wait()
+	return results
+}
+
+// Run calls Round every interval until ctx is cancelled, passing each
+// round's results to save.
+func (p *Prober) Run(ctx context.Context, interval time.Duration, save func([]model.ProbeResult)) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		save(p.Round(ctx))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Prober) probe(ctx context.Context, t Target) model.ProbeResult {
+	res := model.ProbeResult{
+		Timestamp: time.Now().UTC(),
+		Target:    t.Name,
+		Kind:      t.Kind,
+		Address:   t.Address,
+	}
+
+	count := p.Count
+	if count <= 0 {
+		count = DefaultCount
+	}
+	spacing := p.Spacing
+	if spacing <= 0 {
+		spacing = DefaultSpacing
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	var rtts []time.Duration
+	var err error
+	switch t.Kind {
+	case KindICMP:
+		rtts, err = pingICMP(ctx, t.Address, count, spacing, timeout)
+	case KindUDP:
+		rtts, err = pingUDP(ctx, t.Address, count, spacing, timeout)
+	default:
+		err = fmt.Errorf("unsupported kind %q", t.Kind)
+	}
+
+	res.Sent = count
+	if err != nil {
+		res.Error = err.Error()
+		res.LossPct = 100
+		log.Printf("[probe] %s: %v", t.Name, err)
+		return res
+	}
+
+	res.Received = len(rtts)
+	res.LossPct = float64(count-len(rtts)) / float64(count) * 100
+	if len(rtts) > 0 {
+		minRTT, maxRTT, sum := rtts[0], rtts[0], time.Duration(0)
+		for _, d := range rtts {
+			minRTT = min(minRTT, d)
+			maxRTT = max(maxRTT, d)
+			sum += d
+		}
+		res.RTTMinMs = durationMs(minRTT)
+		res.RTTMaxMs = durationMs(maxRTT)
+		res.RTTAvgMs = durationMs(sum / time.Duration(len(rtts)))
+	}
+	return res
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// collect sends count packets spaced apart with send(seq) while recv
+// reports replies by sequence number, and returns the round-trip times of
+// the packets that were answered before timeout after the last send.
+func collect(ctx context.Context, count int, spacing, timeout time.Duration, send func(seq int) error, recv func(deadline time.Time) (int, error)) ([]time.Duration, error) {
+	sentAt := make([]time.Time, count)
+	rtts := make([]time.Duration, 0, count)
+	answered := make([]bool, count)
+
+	var mu sync.Mutex
+	done := make(chan struct{})
+	deadline := time.Now().Add(time.Duration(count-1)*spacing + timeout)
+
+	go func() {
+		defer close(done)
+		for {
+			seq, err := recv(deadline)
+			if err != nil {
+				return
+			}
+			now := time.Now()
+			mu.Lock()
+			if seq >= 0 && seq < count && !sentAt[seq].IsZero() && !answered[seq] {
+				answered[seq] = true
+				rtts = append(rtts, now.Sub(sentAt[seq]))
+			}
+			all := len(rtts) == count
+			mu.Unlock()
+			if all {
+				return
+			}
+		}
+	}()
+
+	for seq := 0; seq < count; seq++ {
+		if seq > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(spacing):
+			}
+		}
+		mu.Lock()
+		sentAt[seq] = time.Now()
+		mu.Unlock()
+		if err := send(seq); err != nil {
+			return nil, err
+		}
+	}
+
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	return rtts, nil
+}
@@ -0,0 +1,63 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"time"
+)
+
+// udpMagic prefixes UDP probe payloads so replies can be told apart from
+// unrelated traffic.
+const udpMagic = "speedplane-probe "
+
+// pingUDP sends count datagrams to a UDP echo responder at addr (host:port)
+// and returns the round-trip times of the echoed replies.
+func pingUDP(ctx context.Context, addr string, count int, spacing, timeout time.Duration) ([]time.Duration, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	var raw [8]byte
+	_, _ = rand.Read(raw[:])
+	prefix := []byte(udpMagic + hex.EncodeToString(raw[:]) + " ")
+
+	send := func(seq int) error {
+		msg := binary.BigEndian.AppendUint32(append([]byte(nil), prefix...), uint32(seq))
+		_, err := conn.Write(msg)
+		return err
+	}
+	recv := func(deadline time.Time) (int, error) {
+		buf := make([]byte, 1500)
+		for {
+			if err := conn.SetReadDeadline(deadline); err != nil {
+				return -1, err
+			}
+			n, err := conn.Read(buf)
+			if err != nil {
+				// ICMP port unreachable surfaces as a read error on a
+				// connected socket; keep waiting for the remaining replies.
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					return -1, err
+				}
+				if time.Now().After(deadline) {
+					return -1, err
+				}
+				continue
+			}
+			if n != len(prefix)+4 || !bytes.HasPrefix(buf[:n], prefix) {
+				continue
+			}
+			return int(binary.BigEndian.Uint32(buf[len(prefix):n])), nil
+		}
+	}
+
+	return collect(ctx, count, spacing, timeout, send, recv)
+}
@@ -0,0 +1,132 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"speedplane/alert"
+	"speedplane/events"
+	"speedplane/model"
+)
+
+// messageTTL is how long push services hold notifications for browsers
+// that are offline. Older news about the connection isn't worth showing.
+const messageTTL = 6 * time.Hour
+
+// maxBodyRunes limits the length of notification bodies.
+const maxBodyRunes = 400
+
+// Message is the JSON sent to browsers, shown as a notification by the
+// dashboard's service worker.
+type Message struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Tag   string `json:"tag,omitempty"` // Notifications with the same tag replace each other
+	URL   string `json:"url,omitempty"` // Opened when the notification is clicked, relative to the dashboard
+}
+
+// Subscriptions stores the browsers' push subscriptions.
+type Subscriptions interface {
+	ListPushSubscriptions(ctx context.Context) ([]model.PushSubscription, error)
+	DeletePushSubscription(ctx context.Context, endpoint string) (bool, error)
+}
+
+// Notifier sends alert events, and the start and end of outages, to every
+// subscribed browser. Subscriptions the push service reports gone are
+// deleted.
+type Notifier struct {
+	Sender        *Sender
+	Subscriptions Subscriptions
+	Location      *time.Location // Of times in messages; nil for UTC
+}
+
+// Notify implements alert.Notifier.
+func (n *Notifier) Notify(ctx context.Context, e alert.Event) error {
+	title := "Connection degraded"
+	switch e.Kind {
+	case alert.EventRecovered:
+		title = "Connection recovered"
+	case alert.EventReminder:
+		title = "Connection still degraded"
+	}
+	tag := "alert-" + e.RuleID
+	if e.Schedule != "" {
+		tag += "-" + e.Schedule
+	}
+	return n.Send(ctx, Message{Title: title, Body: e.Summary(), Tag: tag, URL: "./"})
+}
+
+func (n *Notifier) location() *time.Location {
+	if n.Location == nil {
+		return time.UTC
+	}
+	return n.Location
+}
+
+// Name implements events.Publisher.
+func (n *Notifier) Name() string {
+	return "push"
+}
+
+// Publish implements events.Publisher, notifying of outages. Other events
+// are ignored.
+func (n *Notifier) Publish(ctx context.Context, e events.Event) error {
+	if e.Outage == nil {
+		return nil
+	}
+	conn := e.Connection
+	if conn == "" {
+		conn = model.DefaultConnection
+	}
+	msg := Message{Tag: "outage-" + conn, URL: "./"}
+	switch e.Type {
+	case events.TypeOutageStarted:
+		msg.Title = "Connection down"
+		msg.Body = fmt.Sprintf("Tests on %s have failed since %s", conn, e.Outage.Start.In(n.location()).Format("15:04"))
+		if e.Outage.Error != "" {
+			msg.Body += ": " + e.Outage.Error
+		}
+	case events.TypeOutageEnded:
+		msg.Title = "Connection back up"
+		msg.Body = fmt.Sprintf("%s was down for %s", conn, (time.Duration(e.Outage.DurationS) * time.Second).Round(time.Second))
+	default:
+		return nil
+	}
+	return n.Send(ctx, msg)
+}
+
+// Send sends msg to every subscription. It returns the first error other
+// than a subscription being gone, after trying them all.
+func (n *Notifier) Send(ctx context.Context, msg Message) error {
+	// Summaries are short, but errors in them may not be. Even escaped, a
+	// body this long leaves the message under MaxPayload.
+	if r := []rune(msg.Body); len(r) > maxBodyRunes {
+		msg.Body = string(r[:maxBodyRunes]) + "…"
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	subs, err := n.Subscriptions.ListPushSubscriptions(ctx)
+	if err != nil {
+		return fmt.Errorf("push: list subscriptions: %w", err)
+	}
+	var firstErr error
+	for _, sub := range subs {
+		err := n.Sender.Send(ctx, sub, body, messageTTL)
+		switch {
+		case errors.Is(err, ErrGone):
+			if _, err := n.Subscriptions.DeletePushSubscription(ctx, sub.Endpoint); err != nil {
+				log.Printf("push: delete expired subscription: %v", err)
+			}
+		case err != nil && firstErr == nil:
+			firstErr = fmt.Errorf("push: %w", err)
+		}
+	}
+	return firstErr
+}
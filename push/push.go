@@ -0,0 +1,302 @@
+// Package push sends Web Push notifications to browsers that subscribed to
+// them in the dashboard, so phones are told about alerts and outages with
+// the dashboard closed. Messages are encrypted for each browser (RFC 8291)
+// and signed with the server's VAPID key (RFC 8292), which push services
+// use to tell senders apart.
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"speedplane/model"
+)
+
+// KeyFile is the name of the VAPID private key file in the data directory.
+const KeyFile = "speedplane-vapid.key"
+
+// recordSize is the record size declared in encrypted messages. Messages
+// are sent as a single record, so it only needs to exceed their length.
+const recordSize = 4096
+
+// MaxPayload is the largest message push services must accept, less the
+// encryption overhead.
+const MaxPayload = 4096 - 16 - 4 - 1 - 65 - 16 - 1
+
+// ErrGone is returned by Send when the push service no longer knows the
+// subscription, e.g. because the user revoked the permission or
+// uninstalled the app. It should be deleted.
+var ErrGone = errors.New("push subscription expired")
+
+// b64 is the unpadded base64url encoding of keys and tokens.
+var b64 = base64.RawURLEncoding
+
+// Keys is the server's VAPID key pair.
+type Keys struct {
+	key *ecdsa.PrivateKey
+}
+
+// LoadOrCreate reads the VAPID private key at path, generating and saving a
+// new one, readable only by the owner, if the file doesn't exist yet.
+// Browsers subscribe for a particular key, so replacing it ends all
+// subscriptions.
+func LoadOrCreate(path string) (*Keys, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return create(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no PEM private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok || ecKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%s: not a P-256 key", path)
+	}
+	return &Keys{key: ecKey}, nil
+}
+
+func create(path string) (*Keys, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	// O_EXCL so a key created concurrently is never overwritten
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return &Keys{key: key}, nil
+}
+
+// PublicKey returns the public key, base64url encoded, which browsers take
+// as the applicationServerKey when subscribing.
+func (k *Keys) PublicKey() string {
+	pub, err := k.key.PublicKey.Bytes()
+	if err != nil {
+		// A P-256 key read by LoadOrCreate always encodes
+		panic(err)
+	}
+	return b64.EncodeToString(pub)
+}
+
+// authorization returns the VAPID Authorization header for a push service:
+// a JWT for its origin, valid for 12 hours, naming subject as the contact.
+func (k *Keys) authorization(endpoint, subject string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	header := b64.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(12 * time.Hour).Unix(),
+		"sub": subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + b64.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, k.key, sum[:])
+	if err != nil {
+		return "", err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return "vapid t=" + signed + "." + b64.EncodeToString(sig) + ", k=" + k.PublicKey(), nil
+}
+
+// ValidateSubscription checks that a subscription's endpoint is an HTTPS
+// URL and that its keys decode to a P-256 public key and a 16 byte secret.
+func ValidateSubscription(sub model.PushSubscription) error {
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("endpoint must be an https URL")
+	}
+	if _, _, err := subscriptionKeys(sub.Keys); err != nil {
+		return err
+	}
+	return nil
+}
+
+func subscriptionKeys(keys model.PushKeys) (*ecdh.PublicKey, []byte, error) {
+	raw, err := b64.DecodeString(strings.TrimRight(keys.P256DH, "="))
+	if err != nil {
+		return nil, nil, errors.New("keys.p256dh is not base64url")
+	}
+	pub, err := ecdh.P256().NewPublicKey(raw)
+	if err != nil {
+		return nil, nil, errors.New("keys.p256dh is not a P-256 public key")
+	}
+	auth, err := b64.DecodeString(strings.TrimRight(keys.Auth, "="))
+	if err != nil || len(auth) != 16 {
+		return nil, nil, errors.New("keys.auth must be 16 bytes, base64url encoded")
+	}
+	return pub, auth, nil
+}
+
+// encrypt encrypts a message for a subscription as a single aes128gcm
+// record (RFC 8188), with a key agreed between a fresh key pair and the
+// browser's (RFC 8291).
+func encrypt(keys model.PushKeys, message []byte) ([]byte, error) {
+	uaPublic, authSecret, err := subscriptionKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	prkKey, err := hkdf.Extract(sha256.New, secret, authSecret)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo := "WebPush: info\x00" + string(uaPublic.Bytes()) + string(asPublic)
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Write(salt)
+	_ = binary.Write(&out, binary.BigEndian, uint32(recordSize))
+	out.WriteByte(byte(len(asPublic)))
+	out.Write(asPublic)
+	// 0x02 marks the last, and only, record
+	plain := append(append([]byte(nil), message...), 0x02)
+	out.Write(gcm.Seal(nil, nonce, plain, nil))
+	return out.Bytes(), nil
+}
+
+// Sender sends encrypted messages to push services.
+type Sender struct {
+	Keys    *Keys
+	Subject string // Contact for push services, a mailto: or https: URL
+	Client  *http.Client
+}
+
+// NewSender creates a Sender with a 15 second request timeout.
+func NewSender(keys *Keys, subject string) *Sender {
+	return &Sender{Keys: keys, Subject: subject, Client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// Send delivers message to a subscription, to be held by the push service
+// for up to ttl while the browser is offline. It returns ErrGone when the
+// subscription no longer exists.
+func (s *Sender) Send(ctx context.Context, sub model.PushSubscription, message []byte, ttl time.Duration) error {
+	if len(message) > MaxPayload {
+		return fmt.Errorf("message of %d bytes is over %d", len(message), MaxPayload)
+	}
+	body, err := encrypt(sub.Keys, message)
+	if err != nil {
+		return err
+	}
+	auth, err := s.Keys.authorization(sub.Endpoint, s.Subject, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("User-Agent", "speedplane")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package speedplane
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"math"
+	"net/http"
+)
+
+// Colours of the app icon and the installed app's window: the dashboard's
+// accent dot on its dark background.
+var (
+	iconBackground = color.RGBA{0x0a, 0x0a, 0x0f, 0xff}
+	iconAccent     = color.RGBA{0xff, 0x6b, 0x9d, 0xff}
+)
+
+// faviconSVG is the icon for browsers that take SVG favicons.
+const faviconSVG = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 64 64">` +
+	`<rect width="64" height="64" rx="14" fill="#0a0a0f"/>` +
+	`<circle cx="32" cy="32" r="21.76" fill="#ff6b9d" fill-opacity=".25"/>` +
+	`<circle cx="32" cy="32" r="14.08" fill="#ff6b9d"/>` +
+	`</svg>`
+
+// webManifest describes the dashboard as an installable app. Icon URLs are
+// relative to the manifest.
+type webManifest struct {
+	Name            string         `json:"name"`
+	ShortName       string         `json:"short_name"`
+	Description     string         `json:"description"`
+	StartURL        string         `json:"start_url"`
+	Scope           string         `json:"scope"`
+	Display         string         `json:"display"`
+	BackgroundColor string         `json:"background_color"`
+	ThemeColor      string         `json:"theme_color"`
+	Icons           []manifestIcon `json:"icons"`
+}
+
+type manifestIcon struct {
+	Src     string `json:"src"`
+	Sizes   string `json:"sizes"`
+	Type    string `json:"type"`
+	Purpose string `json:"purpose,omitempty"`
+}
+
+// registerPWA serves the favicon, app icons, web manifest and service worker
+// that let browsers show an icon for the dashboard and install it as an app.
+func registerPWA(mux *http.ServeMux, static fs.FS) error {
+	favicon, err := encodePNG(drawIcon(32))
+	if err != nil {
+		return err
+	}
+	mux.Handle("/favicon.ico", newAsset(icoFile(favicon, 32), "image/x-icon"))
+	mux.Handle("/favicon.svg", newAsset([]byte(faviconSVG), "image/svg+xml"))
+
+	manifest := webManifest{
+		Name:            "speedplane",
+		ShortName:       "speedplane",
+		Description:     "Internet speed monitoring",
+		StartURL:        ".",
+		Scope:           ".",
+		Display:         "standalone",
+		BackgroundColor: hexColor(iconBackground),
+		ThemeColor:      hexColor(iconBackground),
+		Icons: []manifestIcon{
+			{Src: "favicon.svg", Sizes: "any", Type: "image/svg+xml"},
+		},
+	}
+	icons := []struct {
+		path string
+		size int
+	}{
+		{"/apple-touch-icon.png", 180},
+		{"/icons/icon-192.png", 192},
+		{"/icons/icon-512.png", 512},
+	}
+	for _, icon := range icons {
+		body, err := encodePNG(drawIcon(icon.size))
+		if err != nil {
+			return err
+		}
+		mux.Handle(icon.path, newAsset(body, "image/png"))
+		if icon.size != 180 {
+			manifest.Icons = append(manifest.Icons, manifestIcon{
+				Src:     icon.path[1:],
+				Sizes:   fmt.Sprintf("%dx%d", icon.size, icon.size),
+				Type:    "image/png",
+				Purpose: "any maskable",
+			})
+		}
+	}
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	mux.Handle("/manifest.webmanifest", newAsset(body, "application/manifest+json"))
+
+	// Served from the root so it controls the whole dashboard
+	sw, err := loadAsset(static, "sw.js", "application/javascript; charset=utf-8")
+	if err != nil {
+		return fmt.Errorf("read sw.js: %w", err)
+	}
+	mux.Handle("/sw.js", sw)
+	return nil
+}
+
+// drawIcon draws the app icon size pixels across. The dot and its glow stay
+// within the middle 80%, the safe zone of maskable icons.
+func drawIcon(size int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	s := float64(size)
+	center := s / 2
+	glow, dot := 0.34*s, 0.22*s
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			d := math.Hypot(float64(x)+0.5-center, float64(y)+0.5-center)
+			c := blend(iconBackground, iconAccent, 0.25*coverage(glow, d))
+			img.SetRGBA(x, y, blend(c, iconAccent, coverage(dot, d)))
+		}
+	}
+	return img
+}
+
+// coverage approximates how much of a pixel at distance d from the centre a
+// circle of radius r covers, for anti-aliased edges.
+func coverage(r, d float64) float64 {
+	return math.Max(0, math.Min(1, r-d+0.5))
+}
+
+// blend mixes t of fg into bg.
+func blend(bg, fg color.RGBA, t float64) color.RGBA {
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a)*(1-t) + float64(b)*t))
+	}
+	return color.RGBA{mix(bg.R, fg.R), mix(bg.G, fg.G), mix(bg.B, fg.B), 0xff}
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode icon: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// icoFile wraps a PNG image size pixels across in an ICO container, which
+// has held PNG images since Windows Vista.
+func icoFile(pngData []byte, size int) []byte {
+	var buf bytes.Buffer
+	header := struct {
+		Reserved, Type, Count uint16
+	}{0, 1, 1}
+	entry := struct {
+		Width, Height, Colors, Reserved uint8
+		Planes, BitCount                uint16
+		Size, Offset                    uint32
+	}{uint8(size), uint8(size), 0, 0, 1, 32, uint32(len(pngData)), 6 + 16}
+	_ = binary.Write(&buf, binary.LittleEndian, header)
+	_ = binary.Write(&buf, binary.LittleEndian, entry)
+	buf.Write(pngData)
+	return buf.Bytes()
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
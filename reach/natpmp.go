@@ -0,0 +1,48 @@
+package reach
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	natpmpPort           = "5351"
+	natpmpOpExternalAddr = 0
+	natpmpResponseFlag   = 128
+	natpmpTimeout        = 2 * time.Second
+)
+
+// natpmpExternalIP asks the gateway for its external address with NAT-PMP
+// (RFC 6886), which routers with PCP also answer.
+func natpmpExternalIP(ctx context.Context, gateway string) (net.IP, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp4", net.JoinHostPort(gateway, natpmpPort))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(natpmpTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+	if _, err := conn.Write([]byte{0, natpmpOpExternalAddr}); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 16)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	if n < 12 || buf[1] != natpmpResponseFlag|natpmpOpExternalAddr {
+		return nil, fmt.Errorf("unexpected NAT-PMP response")
+	}
+	if code := binary.BigEndian.Uint16(buf[2:]); code != 0 {
+		return nil, fmt.Errorf("NAT-PMP result code %d", code)
+	}
+	return net.IPv4(buf[8], buf[9], buf[10], buf[11]), nil
+}
@@ -0,0 +1,169 @@
+// Package reach checks how the connection looks from the outside: the public
+// IP address, the WAN address the router reports over NAT-PMP or UPnP, which
+// tells carrier-grade NAT apart from a public address, and whether a local
+// port can be reached from the internet.
+package reach
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"speedplane/model"
+	"speedplane/netinfo"
+)
+
+// Defaults used when a Checker option is zero.
+const (
+	DefaultSTUNServer = "stun.l.google.com:19302"
+	DefaultCheckURL   = "https://ifconfig.co/port/{port}"
+	DefaultInterval   = 15 * time.Minute
+	DefaultTimeout    = 10 * time.Second
+)
+
+// Checker runs reachability checks.
+type Checker struct {
+	Port       int    // Local port to check from outside; 0 skips the check
+	CheckURL   string // Service checking Port, with {port} replaced; see checkPort
+	STUNServer string // host:port
+	Gateway    string // Router to ask over NAT-PMP; detected when empty
+	Timeout    time.Duration
+}
+
+// Check runs one check. Steps that fail are recorded in the result's Error
+// rather than failing the check.
+func (c *Checker) Check(ctx context.Context) model.ReachabilityCheck {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	res := model.ReachabilityCheck{Timestamp: time.Now().UTC(), Port: c.Port}
+	var errs []string
+
+	stunCtx, cancel := context.WithTimeout(ctx, timeout)
+	server := c.STUNServer
+	if server == "" {
+		server = DefaultSTUNServer
+	}
+	if ip, err := stunMappedIP(stunCtx, server); err != nil {
+		errs = append(errs, "stun: "+err.Error())
+	} else {
+		res.PublicIP = ip.String()
+	}
+	cancel()
+
+	routerCtx, cancel := context.WithTimeout(ctx, timeout)
+	res.RouterIP, res.RouterSource = c.routerIP(routerCtx)
+	cancel()
+	if res.RouterIP != "" {
+		res.CGNAT = isShared(net.ParseIP(res.RouterIP)) || (res.PublicIP != "" && res.RouterIP != res.PublicIP)
+	}
+
+	if c.Port > 0 {
+		portCtx, cancel := context.WithTimeout(ctx, timeout)
+		if ok, err := c.checkPort(portCtx); err != nil {
+			errs = append(errs, "port check: "+err.Error())
+		} else {
+			res.Reachable = &ok
+		}
+		cancel()
+	}
+
+	res.Error = strings.Join(errs, "; ")
+	return res
+}
+
+// Run checks every interval until ctx is cancelled, passing each result to
+// save.
+func (c *Checker) Run(ctx context.Context, interval time.Duration, save func(model.ReachabilityCheck)) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		res := c.Check(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		save(res)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// routerIP asks the router for its WAN address over NAT-PMP, then UPnP. It
+// returns empty strings when the router supports neither, which is common
+// and not an error.
+func (c *Checker) routerIP(ctx context.Context) (ip, source string) {
+	gateway := c.Gateway
+	if gateway == "" {
+		gateway, _ = netinfo.DefaultGateway()
+	}
+	if gateway != "" {
+		if addr, err := natpmpExternalIP(ctx, gateway); err == nil {
+			return addr.String(), "nat-pmp"
+		}
+	}
+	if addr, err := upnpExternalIP(ctx); err == nil {
+		return addr.String(), "upnp"
+	}
+	return "", ""
+}
+
+// isShared reports whether ip can't be reached from the internet: private,
+// or in the 100.64.0.0/10 range carriers use for CGNAT.
+func isShared(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return true
+	}
+	ip4 := ip.To4()
+	return ip4 != nil && ip4[0] == 100 && ip4[1]&0xc0 == 64
+}
+
+// checkPort asks the check service whether Port is reachable. The service
+// must answer with a JSON object with a boolean "reachable", like
+// ifconfig.co's /port/{port}.
+func (c *Checker) checkPort(ctx context.Context) (bool, error) {
+	url := c.CheckURL
+	if url == "" {
+		url = DefaultCheckURL
+	}
+	url = strings.ReplaceAll(url, "{port}", strconv.Itoa(c.Port))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	var body struct {
+		Reachable *bool `json:"reachable"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body); err != nil {
+		return false, fmt.Errorf("%s: %w", url, err)
+	}
+	if body.Reachable == nil {
+		return false, fmt.Errorf("%s did not say whether the port is reachable", url)
+	}
+	return *body.Reachable, nil
+}
@@ -0,0 +1,122 @@
+package reach
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+// STUN (RFC 5389) message values.
+const (
+	stunBindingRequest  = 0x0001
+	stunBindingSuccess  = 0x0101
+	stunMagicCookie     = 0x2112a442
+	stunMappedAddress   = 0x0001
+	stunXORMappedAddr   = 0x0020
+	stunHeaderSize      = 20
+	stunFamilyIPv4      = 0x01
+	stunFamilyIPv6      = 0x02
+	stunRetransmitAfter = 500 * time.Millisecond
+)
+
+// stunMappedIP sends a binding request to server and returns the address it
+// saw the request come from.
+func stunMappedIP(ctx context.Context, server string) (net.IP, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	req := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(req[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+	if _, err := rand.Read(req[8:20]); err != nil {
+		return nil, err
+	}
+	txID := req[8:20]
+
+	buf := make([]byte, 1500)
+	wait := stunRetransmitAfter
+	for {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(wait)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		_ = conn.SetReadDeadline(deadline)
+		n, err := conn.Read(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() && ctx.Err() == nil {
+				wait *= 2 // Retransmit, backing off as RFC 5389 suggests
+				continue
+			}
+			if ctx.Err() != nil {
+				return nil, errors.New("no response")
+			}
+			return nil, err
+		}
+		resp := buf[:n]
+		if len(resp) < stunHeaderSize || !bytes.Equal(resp[8:20], txID) {
+			continue
+		}
+		if binary.BigEndian.Uint16(resp[0:]) != stunBindingSuccess {
+			return nil, errors.New("binding request failed")
+		}
+		return parseMappedAddress(resp)
+	}
+}
+
+// parseMappedAddress returns the XOR-MAPPED-ADDRESS of a binding response,
+// or its MAPPED-ADDRESS for servers that only send that.
+func parseMappedAddress(resp []byte) (net.IP, error) {
+	var mapped net.IP
+	attrs := resp[stunHeaderSize:]
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		size := int(binary.BigEndian.Uint16(attrs[2:]))
+		if len(attrs) < 4+size {
+			break
+		}
+		value := attrs[4 : 4+size]
+		attrs = attrs[4+(size+3)&^3:]
+		if size < 8 {
+			continue
+		}
+		var ip net.IP
+		switch value[1] {
+		case stunFamilyIPv4:
+			ip = append(net.IP(nil), value[4:8]...)
+		case stunFamilyIPv6:
+			if size < 20 {
+				continue
+			}
+			ip = append(net.IP(nil), value[4:20]...)
+		default:
+			continue
+		}
+		switch typ {
+		case stunXORMappedAddr:
+			// The address is XORed with the magic cookie and transaction ID
+			key := resp[4:20]
+			for i := range ip {
+				ip[i] ^= key[i]
+			}
+			return ip, nil
+		case stunMappedAddress:
+			mapped = ip
+		}
+	}
+	if mapped == nil {
+		return nil, errors.New("response has no mapped address")
+	}
+	return mapped, nil
+}
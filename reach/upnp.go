@@ -0,0 +1,187 @@
+package reach
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ssdpAddr     = "239.255.255.250:1900"
+	ssdpWait     = 2 * time.Second
+	igdSearch    = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+	maxUPnPReply = 256 << 10
+)
+
+// upnpExternalIP finds an Internet Gateway Device with SSDP and calls
+// GetExternalIPAddress on its WAN connection service.
+func upnpExternalIP(ctx context.Context) (net.IP, error) {
+	location, err := ssdpDiscover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	controlURL, serviceType, err := wanService(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	return getExternalIP(ctx, controlURL, serviceType)
+}
+
+// ssdpDiscover returns the description URL of the first gateway that answers
+// an M-SEARCH.
+func ssdpDiscover(ctx context.Context) (string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	dst, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return "", err
+	}
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddr + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: " + igdSearch + "\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(search), dst); err != nil {
+		return "", err
+	}
+
+	deadline := time.Now().Add(ssdpWait)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetReadDeadline(deadline)
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return "", errors.New("no UPnP gateway answered")
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if location := resp.Header.Get("Location"); location != "" {
+			return location, nil
+		}
+	}
+}
+
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// wanService returns the control URL and type of the WANIPConnection or
+// WANPPPConnection service in a device description.
+func wanService(ctx context.Context, location string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("device description returned %s", resp.Status)
+	}
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxUPnPReply)).Decode(&root); err != nil {
+		return "", "", fmt.Errorf("device description: %w", err)
+	}
+
+	base, err := url.Parse(location)
+	if err != nil {
+		return "", "", err
+	}
+	if root.URLBase != "" {
+		if b, err := url.Parse(root.URLBase); err == nil {
+			base = b
+		}
+	}
+	var find func(d upnpDevice) (string, string)
+	find = func(d upnpDevice) (string, string) {
+		for _, s := range d.Services {
+			if strings.Contains(s.ServiceType, ":WANIPConnection:") || strings.Contains(s.ServiceType, ":WANPPPConnection:") {
+				return s.ControlURL, s.ServiceType
+			}
+		}
+		for _, child := range d.Devices {
+			if u, t := find(child); u != "" {
+				return u, t
+			}
+		}
+		return "", ""
+	}
+	control, serviceType := find(root.Device)
+	if control == "" {
+		return "", "", errors.New("gateway has no WAN connection service")
+	}
+	ref, err := url.Parse(control)
+	if err != nil {
+		return "", "", err
+	}
+	return base.ResolveReference(ref).String(), serviceType, nil
+}
+
+func getExternalIP(ctx context.Context, controlURL, serviceType string) (net.IP, error) {
+	body := `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:GetExternalIPAddress xmlns:u="` + serviceType + `"/></s:Body></s:Envelope>`
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, controlURL, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+serviceType+`#GetExternalIPAddress"`)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GetExternalIPAddress returned %s", resp.Status)
+	}
+
+	dec := xml.NewDecoder(io.LimitReader(resp.Body, maxUPnPReply))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, errors.New("GetExternalIPAddress returned no address")
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "NewExternalIPAddress" {
+			continue
+		}
+		var addr string
+		if err := dec.DecodeElement(&addr, &start); err != nil {
+			return nil, err
+		}
+		ip := net.ParseIP(strings.TrimSpace(addr))
+		if ip == nil || ip.IsUnspecified() {
+			return nil, errors.New("gateway has no external address")
+		}
+		return ip, nil
+	}
+}
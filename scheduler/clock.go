@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"speedplane/model"
+)
+
+// ClockJumpThreshold is how far the wall clock must move against the
+// monotonic clock to count as a jump. NTP slews small offsets gradually;
+// steps this large come from NTP corrections, manual changes, or suspend,
+// during which the monotonic clock stands still.
+const ClockJumpThreshold = time.Minute
+
+// ClockJumpTag is attached to results measured while the clock jumped, so
+// their timestamps and durations can't be trusted.
+const ClockJumpTag = "clock-jump"
+
+// ClockJump is a step of the system clock.
+type ClockJump struct {
+	Before time.Time // What the clock would have read without the jump
+	After  time.Time // What it read instead
+}
+
+// Offset returns how far the clock jumped: positive when forward.
+func (j ClockJump) Offset() time.Duration {
+	return j.After.Sub(j.Before)
+}
+
+// String describes the jump, e.g. "forward by 8h12m3s".
+func (j ClockJump) String() string {
+	if off := j.Offset(); off < 0 {
+		return "backward by " + (-off).Round(time.Second).String()
+	}
+	return "forward by " + j.Offset().Round(time.Second).String()
+}
+
+// ClockSkew returns how far the wall clock moved against the monotonic
+// clock between start and end, both read with time.Now.
+func ClockSkew(start, end time.Time) time.Duration {
+	return end.Round(0).Sub(start.Round(0)) - end.Sub(start)
+}
+
+// ClockJumped reports whether the clock jumped between start and end, both
+// read with time.Now.
+func ClockJumped(start, end time.Time) bool {
+	skew := ClockSkew(start, end)
+	return skew >= ClockJumpThreshold || skew <= -ClockJumpThreshold
+}
+
+// SetOnClockJump sets a callback function that is called when the scheduler
+// notices the clock jumped.
+func (s *Scheduler) SetOnClockJump(fn func(ClockJump)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onClockJump = fn
+}
+
+// clockJumped moves the last runs along with the clock, so interval
+// schedules keep their spacing in time that actually passed: after a
+// forward jump they don't all come due at once, and after a backward one
+// they don't wait for the clock to catch up. Daily and cron schedules follow
+// the wall clock anyway and only lose last runs in the future.
+func (s *Scheduler) clockJumped(j ClockJump) {
+	offset := j.Offset()
+	log.Printf("[scheduler] clock jumped %s", j)
+
+	s.mu.Lock()
+	wallClock := make(map[string]bool)
+	for _, sc := range s.schedules {
+		wallClock[sc.ID] = sc.Type == model.ScheduleDaily || sc.Type == model.ScheduleCron
+	}
+	for id, last := range s.lastRun {
+		if !wallClock[id] {
+			last = last.Add(offset)
+		}
+		if last.After(j.After) {
+			last = j.After
+		}
+		s.lastRun[id] = last
+	}
+	for id, since := range s.heldSince {
+		s.heldSince[id] = since.Add(offset)
+	}
+	if !s.started.IsZero() {
+		s.started = s.started.Add(offset)
+	}
+	onUpdate := s.onUpdate
+	onClockJump := s.onClockJump
+	s.mu.Unlock()
+
+	if onUpdate != nil {
+		onUpdate()
+	}
+	if onClockJump != nil {
+		onClockJump(j)
+	}
+}
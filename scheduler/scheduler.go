@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"log"
 	"strconv"
 	"strings"
@@ -15,7 +16,105 @@ import (
 type Runner func(ctx context.Context) (*model.SpeedtestResult, error)
 
 // OnComplete is a callback function called when a speedtest completes.
-type OnComplete func(result *model.SpeedtestResult)
+// id is the schedule's ID, or "trigger" for RunNow runs.
+type OnComplete func(id string, result *model.SpeedtestResult)
+
+// OnProgress is called with the progress of a run started by the scheduler.
+// id is the schedule's ID, or "trigger" for RunNow runs. A run that fails
+// ends with stage "error" and the error as message.
+type OnProgress func(id string, stage string, message string)
+
+// BusyCheck reports why a connection is too busy to test right now, or ""
+// if it isn't, and how long a scheduled run may be held back for it.
+type BusyCheck func(connection string) (reason string, maxWait time.Duration)
+
+var (
+	// ErrDraining is returned by RunNow once Drain has been called.
+	ErrDraining = errors.New("scheduler is shutting down")
+	// ErrRunInProgress is returned by RunNow while its previous run hasn't finished.
+	ErrRunInProgress = errors.New("a triggered run is already in progress")
+	// ErrPaused is returned by RunNow while the scheduler is paused, see Pause.
+	ErrPaused = errors.New("scheduler is paused for maintenance")
+	// ErrDrainTimeout is returned by Drain when in-flight runs were cancelled.
+	ErrDrainTimeout = errors.New("drain timeout reached, in-flight speedtests were cancelled")
+	// ErrRunsStuck is returned by Drain when in-flight runs ignored being
+	// cancelled, e.g. a hung speedtest binary.
+	ErrRunsStuck = errors.New("in-flight speedtests didn't stop when cancelled")
+)
+
+// DrainCancelWait is how long Drain waits for in-flight runs to stop once it
+// has cancelled them.
+const DrainCancelWait = 5 * time.Second
+
+type tagsKey struct{}
+
+// WithTags returns a copy of ctx whose run attaches tags to its result.
+func WithTags(ctx context.Context, tags []string) context.Context {
+	if len(tags) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, tagsKey{}, append([]string(nil), tags...))
+}
+
+// Tags returns the tags passed to RunNow or WithTags for the run ctx belongs
+// to, so the runner can attach them to its result. Scheduled runs have none.
+func Tags(ctx context.Context) []string {
+	tags, _ := ctx.Value(tagsKey{}).([]string)
+	return tags
+}
+
+type connectionKey struct{}
+
+// WithConnection returns a copy of ctx that selects the named connection for
+// the run, or the default connection if name is empty.
+func WithConnection(ctx context.Context, name string) context.Context {
+	if name == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, connectionKey{}, name)
+}
+
+// Connection returns the connection selected for the run ctx belongs to by
+// its schedule, RunNow or WithConnection; empty means the default connection.
+func Connection(ctx context.Context) string {
+	name, _ := ctx.Value(connectionKey{}).(string)
+	return name
+}
+
+type enginesKey struct{}
+
+// WithEngines returns a copy of ctx that selects the engines the run tests
+// with, back to back, or the default engine if engines is empty.
+func WithEngines(ctx context.Context, engines []string) context.Context {
+	if len(engines) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, enginesKey{}, engines)
+}
+
+// Engines returns the engines selected for the run ctx belongs to by its
+// schedule or WithEngines; empty means the default engine.
+func Engines(ctx context.Context) []string {
+	engines, _ := ctx.Value(enginesKey{}).([]string)
+	return engines
+}
+
+type progressKey struct{}
+
+// WithProgress returns a copy of ctx whose run reports its progress to fn.
+func WithProgress(ctx context.Context, fn func(stage string, message string)) context.Context {
+	if fn == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// Progress returns the function that receives the progress of the run ctx
+// belongs to, for the runner to report to, or nil if nobody is listening.
+func Progress(ctx context.Context) func(stage string, message string) {
+	fn, _ := ctx.Value(progressKey{}).(func(stage string, message string))
+	return fn
+}
 
 // Scheduler manages scheduled speedtest executions.
 type Scheduler struct {
@@ -25,6 +124,22 @@ type Scheduler struct {
 	runner    Runner
 	onUpdate  func() // Called when lastRun changes
 	onComplete OnComplete
+	onProgress OnProgress
+	onClockJump func(ClockJump)
+	busyCheck BusyCheck
+	heldSince map[string]time.Time // Schedules held back by busyCheck, by ID
+	loc       *time.Location // Timezone for daily and cron schedules
+
+	// Runs get their own context so a shutdown signal doesn't abort a test
+	// halfway through; Drain decides how long they may take to finish.
+	runCtx    context.Context
+	cancelRun context.CancelFunc
+	inFlight  sync.WaitGroup
+	draining  bool
+	running   bool // Between Start and its context being cancelled
+	started   time.Time // When Start was called, for Stagger
+	triggered bool // A RunNow run is in progress
+	pausedUntil time.Time // No runs start before this time, see Pause
 }
 
 // New creates a new Scheduler with the given runner, schedules, and last run times.
@@ -32,12 +147,17 @@ func New(runner Runner, initial []model.Schedule, lastRun map[string]time.Time)
 	if lastRun == nil {
 		lastRun = make(map[string]time.Time)
 	}
+	runCtx, cancelRun := context.WithCancel(context.Background())
 	s := &Scheduler{
 		schedules: append([]model.Schedule(nil), initial...),
 		lastRun:   lastRun,
 		runner:    runner,
 		onUpdate:  nil,
 		onComplete: nil,
+		loc:       time.Local,
+		heldSince: make(map[string]time.Time),
+		runCtx:    runCtx,
+		cancelRun: cancelRun,
 	}
 	return s
 }
@@ -56,13 +176,53 @@ func (s *Scheduler) SetOnComplete(fn OnComplete) {
 	s.onComplete = fn
 }
 
+// SetOnProgress sets a callback function that receives the progress of
+// scheduled and triggered runs while they run.
+func (s *Scheduler) SetOnProgress(fn OnProgress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onProgress = fn
+}
+
+// SetBusyCheck sets a check that holds back scheduled runs while their
+// connection is busy, e.g. with other traffic that would skew the result. A
+// held run starts at the first check the connection isn't busy, or once it
+// has waited the check's maxWait. RunNow runs aren't held back.
+func (s *Scheduler) SetBusyCheck(fn BusyCheck) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.busyCheck = fn
+}
+
+// SetLocation sets the timezone daily schedules are evaluated in. It defaults to the server's local time.
+func (s *Scheduler) SetLocation(loc *time.Location) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if loc == nil {
+		loc = time.Local
+	}
+	s.loc = loc
+}
+
 // Start begins the scheduler, checking for scheduled speedtests every 30 seconds.
-// It runs until the context is cancelled.
+// It runs until the context is cancelled. Runs already in progress are not
+// cancelled with it; use Drain to wait for them. Jumps of the clock between
+// checks are handled as described at clockJumped.
 func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.running = true
+	s.started = time.Now()
+	s.mu.Unlock()
 	go func() {
 		log.Println("[scheduler] started")
 		ticker := time.NewTicker(30 * time.Second)
 		defer ticker.Stop()
+		defer func() {
+			s.mu.Lock()
+			s.running = false
+			s.mu.Unlock()
+		}()
+		prev := time.Now()
 
 		for {
 			select {
@@ -70,54 +230,217 @@ func (s *Scheduler) Start(ctx context.Context) {
 				log.Println("[scheduler] stopped")
 				return
 			case now := <-ticker.C:
-				s.check(ctx, now)
+				if ClockJumped(prev, now) {
+					s.clockJumped(ClockJump{Before: now.Round(0).Add(-ClockSkew(prev, now)), After: now.Round(0)})
+				}
+				prev = now
+				s.check(now)
 			}
 		}
 	}()
 }
 
-func (s *Scheduler) check(ctx context.Context, now time.Time) {
+// Running reports whether the scheduler was started and is still checking
+// schedules, and not draining for shutdown.
+func (s *Scheduler) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running && !s.draining
+}
+
+// Pause stops schedules and RunNow from starting runs until the given time,
+// e.g. during planned maintenance. Runs in progress are not affected, and
+// schedules that came due during the pause run at the next check after it.
+func (s *Scheduler) Pause(until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pausedUntil = until
+}
+
+// Resume ends a pause early.
+func (s *Scheduler) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pausedUntil = time.Time{}
+}
+
+// PausedUntil returns when the current pause ends, or the zero time if the
+// scheduler isn't paused.
+func (s *Scheduler) PausedUntil() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !time.Now().Before(s.pausedUntil) {
+		return time.Time{}
+	}
+	return s.pausedUntil
+}
+
+// Drain stops new runs from starting and waits up to timeout for in-flight
+// runs to finish (and save). Runs still going after the timeout are cancelled
+// and ErrDrainTimeout is returned, or ErrRunsStuck if they haven't stopped
+// DrainCancelWait later; they are left behind then.
+func (s *Scheduler) Drain(timeout time.Duration) error {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.cancelRun()
+		return nil
+	case <-time.After(timeout):
+		s.cancelRun()
+	}
+	select {
+	case <-done:
+		return ErrDrainTimeout
+	case <-time.After(DrainCancelWait):
+		return ErrRunsStuck
+	}
+}
+
+func (s *Scheduler) check(now time.Time) {
 	s.mu.Lock()
+	if s.draining || now.Before(s.pausedUntil) {
+		s.mu.Unlock()
+		return
+	}
 	scheds := make([]model.Schedule, len(s.schedules))
 	copy(scheds, s.schedules)
 	last := make(map[string]time.Time, len(s.lastRun))
 	for k, v := range s.lastRun {
 		last[k] = v
 	}
+	held := make(map[string]bool, len(s.heldSince))
+	for k := range s.heldSince {
+		held[k] = true
+	}
+	loc := s.loc
+	busyCheck := s.busyCheck
+	started := s.started
 	s.mu.Unlock()
 
 	for _, sc := range scheds {
 		if !sc.Enabled || sc.ID == "" {
 			continue
 		}
-		if !shouldRun(sc, last[sc.ID], now) {
+		// A held back cron slot stays due after CronCatchUp
+		if !shouldRun(sc, last[sc.ID], now.In(loc)) && !held[sc.ID] {
+			continue
+		}
+		// Interval schedules due at startup wait for their stagger
+		if sc.Type == model.ScheduleInterval && now.Before(started.Add(Stagger(sc))) {
 			continue
 		}
 
 		id := sc.ID
+		if busyCheck != nil && s.holdBack(busyCheck, sc, now) {
+			continue
+		}
 		// Update lastRun immediately to prevent duplicate runs
 		s.mu.Lock()
+		if s.draining {
+			s.mu.Unlock()
+			return
+		}
 		s.lastRun[id] = now
+		delete(s.heldSince, id)
 		onUpdate := s.onUpdate
+		s.inFlight.Add(1)
 		s.mu.Unlock()
 		if onUpdate != nil {
 			onUpdate()
 		}
-		go s.runOnce(ctx, id, now)
+		go s.runOnce(WithEngines(WithConnection(s.runCtx, sc.Connection), sc.Engines), id, now)
+	}
+}
+
+// holdBack reports whether a due schedule should wait for its connection to
+// be less busy.
+func (s *Scheduler) holdBack(busyCheck BusyCheck, sc model.Schedule, now time.Time) bool {
+	reason, maxWait := busyCheck(sc.Connection)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reason == "" {
+		return false
+	}
+	since, held := s.heldSince[sc.ID]
+	if !held {
+		since = now
+		s.heldSince[sc.ID] = now
+		log.Printf("[scheduler] holding back %s: %s", sc.ID, reason)
+	}
+	if now.Sub(since) < maxWait {
+		return true
+	}
+	log.Printf("[scheduler] running %s after waiting %s: %s", sc.ID, now.Sub(since).Round(time.Second), reason)
+	return false
+}
+
+// RunNow starts a run outside the schedules in the background, e.g. for an
+// external trigger, over the named connection (empty for the default one),
+// passing tags to the runner (see Tags). Like scheduled runs it is waited
+// for by Drain and reported to OnComplete. Only one RunNow run may be in
+// progress at a time, so a burst of triggers runs one test.
+func (s *Scheduler) RunNow(connection string, tags []string) error {
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return ErrDraining
+	}
+	if time.Now().Before(s.pausedUntil) {
+		s.mu.Unlock()
+		return ErrPaused
 	}
+	if s.triggered {
+		s.mu.Unlock()
+		return ErrRunInProgress
+	}
+	s.triggered = true
+	s.inFlight.Add(1)
+	s.mu.Unlock()
+
+	ctx := context.WithValue(s.runCtx, tagsKey{}, append([]string(nil), tags...))
+	ctx = WithConnection(ctx, connection)
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			s.triggered = false
+			s.mu.Unlock()
+		}()
+		s.runOnce(ctx, "trigger", time.Now())
+	}()
+	return nil
 }
 
 func (s *Scheduler) runOnce(ctx context.Context, id string, now time.Time) {
+	defer s.inFlight.Done()
+	s.mu.Lock()
+	onComplete := s.onComplete
+	onProgress := s.onProgress
+	s.mu.Unlock()
+
+	if onProgress != nil {
+		ctx = context.WithValue(ctx, progressKey{}, func(stage string, message string) {
+			onProgress(id, stage, message)
+		})
+	}
 	result, err := s.runner(ctx)
 	if err != nil {
 		log.Printf("[scheduler] run %s failed: %v", id, err)
+		if onProgress != nil {
+			onProgress(id, "error", err.Error())
+		}
 		return
 	}
-	s.mu.Lock()
-	onComplete := s.onComplete
-	s.mu.Unlock()
 	if onComplete != nil && result != nil {
-		onComplete(result)
+		onComplete(id, result)
 	}
 }
 
@@ -161,11 +484,29 @@ func shouldRun(sc model.Schedule, lastRun time.Time, now time.Time) bool {
 		}
 		return true
 
+	case model.ScheduleCron:
+		c, err := ParseCron(sc.Cron)
+		if err != nil {
+			return false
+		}
+		slot := c.Next(cronFrom(lastRun, now))
+		return !slot.IsZero() && !slot.After(now)
+
 	default:
 		return false
 	}
 }
 
+// cronFrom returns the time a cron schedule's next slot follows: its last
+// run, or CronCatchUp ago when it last ran longer ago than that.
+func cronFrom(lastRun, now time.Time) time.Time {
+	from := now.Add(-CronCatchUp)
+	if lastRun.After(from) {
+		from = lastRun.In(now.Location())
+	}
+	return from
+}
+
 func sameDay(a, b time.Time) bool {
 	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
 }
@@ -201,6 +542,18 @@ func (s *Scheduler) LastRun() map[string]time.Time {
 	return result
 }
 
+// ResetLastRun forgets when each schedule last ran, as on a fresh install,
+// so interval schedules run at the next check.
+func (s *Scheduler) ResetLastRun() {
+	s.mu.Lock()
+	s.lastRun = make(map[string]time.Time)
+	onUpdate := s.onUpdate
+	s.mu.Unlock()
+	if onUpdate != nil {
+		onUpdate()
+	}
+}
+
 // NextRunInfo contains information about the next scheduled run
 type NextRunInfo struct {
 	NextRun        *time.Time
@@ -222,9 +575,12 @@ func (s *Scheduler) NextRunInfo() NextRunInfo {
 	for k, v := range s.lastRun {
 		last[k] = v
 	}
+	loc := s.loc
+	pausedUntil := s.pausedUntil
+	started := s.started
 	s.mu.Unlock()
 
-	now := time.Now()
+	now := time.Now().In(loc)
 	var nextTime *time.Time
 	var intervalDur time.Duration
 
@@ -233,60 +589,8 @@ func (s *Scheduler) NextRunInfo() NextRunInfo {
 			continue
 		}
 
-		var candidate time.Time
-		var candidateDur time.Duration
-		switch sc.Type {
-		case model.ScheduleInterval:
-			if sc.Every == "" {
-				continue
-			}
-			dur, err := time.ParseDuration(sc.Every)
-			if err != nil || dur <= 0 {
-				continue
-			}
-			candidateDur = dur
-			lastRun := last[sc.ID]
-			if lastRun.IsZero() {
-				candidate = now
-			} else {
-				candidate = lastRun.Add(dur)
-				if candidate.Before(now) {
-					candidate = now
-				}
-			}
-
-		case model.ScheduleDaily:
-			if sc.TimeOfDay == "" {
-				continue
-			}
-			parts := strings.Split(sc.TimeOfDay, ":")
-			if len(parts) < 2 {
-				continue
-			}
-			hour, err1 := strconv.Atoi(parts[0])
-			min, err2 := strconv.Atoi(parts[1])
-			if err1 != nil || err2 != nil || hour < 0 || hour > 23 || min < 0 || min > 59 {
-				continue
-			}
-
-			loc := now.Location()
-			today := time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, loc)
-			lastRun := last[sc.ID]
-
-			if now.Before(today) {
-				candidate = today
-			} else {
-				// If already passed today or already ran today, schedule for tomorrow
-				if !lastRun.IsZero() && sameDay(lastRun.In(loc), now) {
-					candidate = today.AddDate(0, 0, 1)
-				} else {
-					candidate = today.AddDate(0, 0, 1)
-				}
-			}
-			// For daily schedules, interval is 24 hours
-			candidateDur = 24 * time.Hour
-
-		default:
+		candidate, candidateDur, ok := nextRunOf(sc, last[sc.ID], started, now)
+		if !ok {
 			continue
 		}
 
@@ -296,8 +600,98 @@ func (s *Scheduler) NextRunInfo() NextRunInfo {
 		}
 	}
 
+	// Runs due during a pause start once it ends
+	if nextTime != nil && nextTime.Before(pausedUntil) {
+		until := pausedUntil.In(loc)
+		nextTime = &until
+	}
+
 	return NextRunInfo{
 		NextRun:         nextTime,
 		IntervalDuration: intervalDur,
 	}
 }
+
+// nextRunOf returns when an enabled schedule runs next given its last run,
+// when the scheduler started (zero if it hasn't) and the current time, and
+// its interval for progress displays. It reports false for invalid
+// schedules.
+func nextRunOf(sc model.Schedule, lastRun, started, now time.Time) (time.Time, time.Duration, bool) {
+	var candidate time.Time
+	var candidateDur time.Duration
+	switch sc.Type {
+	case model.ScheduleInterval:
+		if sc.Every == "" {
+			return time.Time{}, 0, false
+		}
+		dur, err := time.ParseDuration(sc.Every)
+		if err != nil || dur <= 0 {
+			return time.Time{}, 0, false
+		}
+		candidateDur = dur
+		if lastRun.IsZero() {
+			candidate = now
+		} else {
+			candidate = lastRun.Add(dur)
+			if candidate.Before(now) {
+				candidate = now
+			}
+		}
+		// Not before its stagger after startup
+		if first := started.Add(Stagger(sc)); candidate.Before(first) {
+			candidate = first.In(now.Location())
+		}
+
+	case model.ScheduleDaily:
+		if sc.TimeOfDay == "" {
+			return time.Time{}, 0, false
+		}
+		parts := strings.Split(sc.TimeOfDay, ":")
+		if len(parts) < 2 {
+			return time.Time{}, 0, false
+		}
+		hour, err1 := strconv.Atoi(parts[0])
+		min, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil || hour < 0 || hour > 23 || min < 0 || min > 59 {
+			return time.Time{}, 0, false
+		}
+
+		loc := now.Location()
+		today := time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, loc)
+
+		if now.Before(today) {
+			candidate = today
+		} else {
+			// If already passed today or already ran today, schedule for tomorrow
+			if !lastRun.IsZero() && sameDay(lastRun.In(loc), now) {
+				candidate = today.AddDate(0, 0, 1)
+			} else {
+				candidate = today.AddDate(0, 0, 1)
+			}
+		}
+		// For daily schedules, interval is 24 hours
+		candidateDur = 24 * time.Hour
+
+	case model.ScheduleCron:
+		c, err := ParseCron(sc.Cron)
+		if err != nil {
+			return time.Time{}, 0, false
+		}
+		slot := c.Next(cronFrom(lastRun, now))
+		if slot.IsZero() {
+			return time.Time{}, 0, false
+		}
+		candidate = slot
+		if candidate.Before(now) {
+			candidate = now
+		}
+		// The interval is the gap to the slot after it
+		if after := c.Next(slot); !after.IsZero() {
+			candidateDur = after.Sub(slot)
+		}
+
+	default:
+		return time.Time{}, 0, false
+	}
+	return candidate, candidateDur, true
+}
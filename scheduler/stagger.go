@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"hash/fnv"
+	"time"
+
+	"speedplane/model"
+)
+
+// MaxStagger bounds how long after the scheduler starts an interval schedule
+// waits for its first run, see Stagger.
+const MaxStagger = 5 * time.Minute
+
+// Stagger returns how long after the scheduler starts an interval schedule
+// may first run: an offset derived from a hash of its ID, below both its
+// interval and MaxStagger. Schedules that are all due at startup, because
+// they never ran or the process was down, then run spread out instead of
+// back to back, and each keeps its offset across restarts. Daily and cron
+// schedules run at their times and aren't staggered.
+func Stagger(sc model.Schedule) time.Duration {
+	if sc.Type != model.ScheduleInterval {
+		return 0
+	}
+	dur, err := time.ParseDuration(sc.Every)
+	if err != nil || dur <= 0 {
+		return 0
+	}
+	span := int64(min(dur, MaxStagger) / time.Second)
+	if span <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(sc.ID))
+	return time.Duration(h.Sum64()%uint64(span)) * time.Second
+}
+
+// ScheduleStatus is the scheduler's view of one schedule.
+type ScheduleStatus struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name,omitempty"`
+	Type      string     `json:"type"`
+	Enabled   bool       `json:"enabled"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	NextRun   *time.Time `json:"next_run,omitempty"`   // Unset for disabled or invalid schedules
+	Stagger   int64      `json:"stagger_seconds"`      // See Stagger
+	HeldSince *time.Time `json:"held_since,omitempty"` // When a busy connection started holding back the due run
+}
+
+// Status returns the state of each schedule, in the order they're
+// configured.
+func (s *Scheduler) Status() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().In(s.loc)
+	out := make([]ScheduleStatus, 0, len(s.schedules))
+	for _, sc := range s.schedules {
+		st := ScheduleStatus{
+			ID:      sc.ID,
+			Name:    sc.Name,
+			Type:    string(sc.Type),
+			Enabled: sc.Enabled,
+			Stagger: int64(Stagger(sc) / time.Second),
+		}
+		last := s.lastRun[sc.ID]
+		if !last.IsZero() {
+			st.LastRun = &last
+		}
+		if since, ok := s.heldSince[sc.ID]; ok {
+			st.HeldSince = &since
+		}
+		if sc.Enabled && sc.ID != "" {
+			if next, _, ok := nextRunOf(sc, last, s.started, now); ok {
+				if next.Before(s.pausedUntil) {
+					next = s.pausedUntil.In(s.loc)
+				}
+				st.NextRun = &next
+			}
+		}
+		out = append(out, st)
+	}
+	return out
+}
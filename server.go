@@ -0,0 +1,1680 @@
+package speedplane
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"speedplane/alert"
+	"speedplane/api"
+	"speedplane/benchmark"
+	"speedplane/config"
+	"speedplane/demo"
+	"speedplane/diskspace"
+	"speedplane/downtime"
+	"speedplane/events"
+	"speedplane/i18n"
+	"speedplane/ingest"
+	"speedplane/latency"
+	"speedplane/model"
+	"speedplane/monitor"
+	"speedplane/netinfo"
+	"speedplane/notify"
+	"speedplane/plugins"
+	"speedplane/privacy"
+	"speedplane/probe"
+	"speedplane/push"
+	"speedplane/reach"
+	"speedplane/s3"
+	"speedplane/scheduler"
+	"speedplane/share"
+	"speedplane/sheets"
+	"speedplane/signing"
+	"speedplane/snapshot"
+	"speedplane/snmp"
+	"speedplane/speedtest"
+	"speedplane/starlink"
+	"speedplane/storage"
+	"speedplane/theme"
+	"speedplane/update"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // timezone config works without system zoneinfo
+)
+
+// New sets up a server from cfg: it opens the database, checks the config
+// and wires up the engines, monitors and integrations it enables, and
+// registers the dashboard and API handlers. Nothing runs until Start or
+// Serve is called.
+func New(cfg config.Config, opts Options) (_ *Server, err error) {
+	demoMode := opts.Demo
+	s := &Server{cfg: &cfg}
+	// onStart queues background work for Start; it all stops when Start's
+	// context is done
+	onStart := func(f func(ctx context.Context)) {
+		s.start = append(s.start, f)
+	}
+	// onShutdown queues work for Shutdown once in-flight tests are saved,
+	// such as sending what they reported; ctx ends with the drain timeout
+	onShutdown := func(f func(ctx context.Context) error) {
+		s.flush = append(s.flush, f)
+	}
+
+	loc, err := cfg.Location()
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", cfg.Timezone, err)
+	}
+
+	// Ensure data directory exists and is absolute
+	dataDirAbs, err := filepath.Abs(cfg.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve data dir: %w", err)
+	}
+	cfg.DataDir = dataDirAbs
+
+	resultsPath := cfg.DBPath
+	if opts.DBPath != "" {
+		resultsPath = opts.DBPath
+	}
+
+	store, err := storage.New(resultsPath, cfg.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("initialize storage: %w", err)
+	}
+	store.SetQueryTimeout(cfg.QueryDuration())
+	defer func() {
+		if err != nil {
+			_ = store.Close()
+		}
+	}()
+
+	var demoRunner *demo.Runner
+	if demoMode {
+		gen := demo.NewGenerator(1)
+		n, err := demo.Seed(context.Background(), store, gen, time.Now().In(loc))
+		if err != nil {
+			return nil, fmt.Errorf("seed demo history: %w", err)
+		}
+		log.Printf("demo mode: seeded %d results; tests return synthetic results", n)
+		demoRunner = &demo.Runner{Generator: gen}
+	}
+
+	// Load schedules and lastRun from config
+	if cfg.Schedules == nil {
+		cfg.Schedules = []model.Schedule{}
+	}
+	if cfg.LastRun == nil {
+		cfg.LastRun = make(map[string]time.Time)
+	}
+
+	runner := speedtest.NewRunner()
+	if cfg.LANHealth.Enabled {
+		runner.SetHealthCheck(&netinfo.HealthCheck{Gateway: cfg.LANHealth.Gateway, DNS: cfg.LANHealth.DNS})
+	}
+	if cfg.PathMTU.Enabled {
+		max := cfg.PathMTU.Max
+		if max == 0 {
+			max = probe.DefaultMaxMTU
+		}
+		if max < probe.MinMTU {
+			return nil, fmt.Errorf("path_mtu: max must be at least %d", probe.MinMTU)
+		}
+		runner.SetPathMTU(max)
+	}
+
+	// Server quality scores, and avoiding Ookla servers that diverge
+	qualityWindow := model.DefaultQualityWindow
+	if cfg.ServerQuality.Window != "" {
+		if qualityWindow, err = time.ParseDuration(cfg.ServerQuality.Window); err != nil || qualityWindow <= 0 {
+			return nil, fmt.Errorf("server_quality: invalid window %q", cfg.ServerQuality.Window)
+		}
+	}
+	maxDeviationPct := cfg.ServerQuality.MaxDeviationPct
+	if maxDeviationPct == 0 {
+		maxDeviationPct = model.DefaultMaxDeviationPct
+	}
+	if maxDeviationPct < 0 {
+		return nil, fmt.Errorf("server_quality: max_deviation_pct must be positive")
+	}
+	if cfg.ServerQuality.AutoExclude {
+		runner.SetExcludedServers(func(ctx context.Context) []string {
+			conn := scheduler.Connection(ctx)
+			if conn == "" {
+				conn = model.DefaultConnection
+			}
+			now := time.Now()
+			scores, err := store.ScoreServers(ctx, now.Add(-qualityWindow), now, conn, maxDeviationPct)
+			if err != nil {
+				log.Printf("score servers: %v", err)
+				return nil
+			}
+			var ids []string
+			for _, q := range scores {
+				if q.Diverging && q.Engine == model.EngineOokla {
+					ids = append(ids, q.ServerID)
+				}
+			}
+			return ids
+		})
+	}
+
+	// Named connections and the source address their tests are bound to
+	sources := make(map[string]string, len(cfg.Connections))
+	var connections []string
+	for _, c := range cfg.Connections {
+		if c.Source != "" && net.ParseIP(c.Source) == nil {
+			return nil, fmt.Errorf("connections: %q: invalid source address %q", c.Name, c.Source)
+		}
+		sources[c.Name] = c.Source
+		connections = append(connections, c.Name)
+	}
+
+	// Expected downtime, e.g. the ISP's monthly maintenance
+	cal := &downtime.Calendar{Location: loc}
+	for _, d := range cfg.Downtime {
+		cal.Windows = append(cal.Windows, downtime.Window{Name: d.Name, Days: d.Days, Week: d.Week, Start: d.Start, End: d.End})
+	}
+	if err := downtime.Validate(cal.Windows); err != nil {
+		return nil, fmt.Errorf("downtime: %w", err)
+	}
+	// ISP plans, which must belong to a configured connection
+	validatePlans := func(plans []model.Plan) error {
+		if err := model.ValidatePlans(plans); err != nil {
+			return err
+		}
+		for _, p := range plans {
+			if _, ok := sources[p.Connection]; p.Connection != "" && p.Connection != model.DefaultConnection && !ok {
+				return fmt.Errorf("plan %q from %s: unknown connection %q", p.Provider, p.Start, p.Connection)
+			}
+		}
+		return nil
+	}
+	if err := validatePlans(cfg.Plans); err != nil {
+		return nil, fmt.Errorf("plans: %w", err)
+	}
+
+	// Mock runner for integration tests, from the config or SPEEDPLANE_MOCK
+	mockCfg := cfg.Mock
+	if v := os.Getenv(config.MockEnv); v != "" {
+		if err := mockCfg.ApplyEnv(v); err != nil {
+			return nil, fmt.Errorf("mock: %w", err)
+		}
+	}
+
+	// Plugins, external programs providing engines and alert channels
+	pluginEngines := make(map[string]speedtest.Engine)
+	var pluginNotifiers []*plugins.Notifier
+	var hooks []*plugins.Hook
+	for i, pc := range cfg.Plugins {
+		var timeout time.Duration
+		if pc.Timeout != "" {
+			if timeout, err = time.ParseDuration(pc.Timeout); err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("plugins: plugin %d: invalid timeout %q", i, pc.Timeout)
+			}
+		}
+		if len(pc.Fields) > 0 && pc.Kind != plugins.KindScript {
+			return nil, fmt.Errorf("plugins: plugin %d: fields are only used by scripts", i)
+		}
+		switch pc.Kind {
+		case plugins.KindScript:
+			mapping, err := ingestMapping(pc.Fields, loc)
+			if err != nil {
+				return nil, fmt.Errorf("plugins: plugin %d: %w", i, err)
+			}
+			sc, err := plugins.NewScript(pc.Name, pc.Command, pc.Env, timeout, mapping)
+			if err == nil {
+				err = model.RegisterEngine(pc.Name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("plugins: plugin %d: %w", i, err)
+			}
+			pluginEngines[pc.Name] = sc
+		case plugins.KindEngine:
+			e, err := plugins.NewEngine(pc.Name, pc.Command, pc.Env, timeout)
+			if err == nil {
+				err = model.RegisterEngine(pc.Name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("plugins: plugin %d: %w", i, err)
+			}
+			pluginEngines[pc.Name] = e
+		case plugins.KindHook:
+			h, err := plugins.NewHook(pc.Name, pc.Command, pc.Env, timeout)
+			if err != nil {
+				return nil, fmt.Errorf("plugins: plugin %d: %w", i, err)
+			}
+			hooks = append(hooks, h)
+		case plugins.KindNotifier:
+			n, err := plugins.NewNotifier(pc.Name, pc.Command, pc.Env, timeout)
+			if err != nil {
+				return nil, fmt.Errorf("plugins: plugin %d: %w", i, err)
+			}
+			pluginNotifiers = append(pluginNotifiers, n)
+		default:
+			return nil, fmt.Errorf("plugins: plugin %d: invalid kind %q, must be %s, %s, %s or %s", i, pc.Kind, plugins.KindEngine, plugins.KindNotifier, plugins.KindScript, plugins.KindHook)
+		}
+		log.Printf("plugins: %s %s: %s", pc.Kind, pc.Name, strings.Join(pc.Command, " "))
+	}
+
+	// Engines by name; demo and mock runs stand in for all of them
+	engines := map[string]speedtest.Engine{
+		model.EngineOokla:      runner,
+		model.EngineCloudflare: speedtest.EngineFunc(runner.RunCloudflareFrom),
+	}
+	for name, e := range pluginEngines {
+		engines[name] = e
+	}
+	switch {
+	case demoRunner != nil:
+		for name := range engines {
+			engines[name] = demoRunner
+		}
+	case mockCfg.Enabled:
+		mock, err := newMockRunner(mockCfg)
+		if err != nil {
+			return nil, fmt.Errorf("mock: %w", err)
+		}
+		log.Printf("mock runner enabled: speedtests return mock results")
+		for name := range engines {
+			engines[name] = mock
+		}
+	}
+	for _, sc := range cfg.Schedules {
+		if err := model.ValidateEngines(sc.Engines); err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", sc.Name, err)
+		}
+	}
+
+	// Evidence signatures, made as results are captured
+	var signer *signing.Signer
+	if cfg.SignResults {
+		keyPath := filepath.Join(cfg.DataDir, signing.KeyFile)
+		if signer, err = signing.LoadOrCreate(keyPath); err != nil {
+			return nil, fmt.Errorf("signing key: %w", err)
+		}
+		log.Printf("signing results with %s", keyPath)
+	}
+
+	// Redaction of the external IP address, for publicly published dashboards
+	var redactor *privacy.Redactor
+	if mode := cfg.Privacy.ExternalIP; mode != "" {
+		var salt []byte
+		if mode == privacy.ModeHash {
+			if salt, err = privacy.LoadOrCreateSalt(filepath.Join(cfg.DataDir, privacy.SaltFile)); err != nil {
+				return nil, fmt.Errorf("privacy: %w", err)
+			}
+		}
+		if redactor, err = privacy.New(mode, salt); err != nil {
+			return nil, fmt.Errorf("privacy: external_ip: %w", err)
+		}
+	}
+
+	// runOn runs a test with the first engine selected for ctx (see
+	// scheduler.Engines) over the connection selected for it (see
+	// scheduler.Connection) and records both, and the run's tags, on the
+	// result. Results during expected downtime are tagged as such, and so
+	// are those measured while the clock jumped. The external IP address is
+	// redacted before the result is signed.
+	runOn := func(ctx context.Context, progress func(stage string, message string)) (*model.SpeedtestResult, error) {
+		conn := scheduler.Connection(ctx)
+		source, ok := sources[conn]
+		if conn != "" && !ok {
+			return nil, fmt.Errorf("unknown connection %q", conn)
+		}
+		engine := model.EngineOokla
+		if e := scheduler.Engines(ctx); len(e) > 0 {
+			engine = e[0]
+		}
+		run, ok := engines[engine]
+		if !ok {
+			return nil, fmt.Errorf("unknown engine %q", engine)
+		}
+		start := time.Now()
+		res, err := run.RunFrom(ctx, source, progress)
+		if err != nil {
+			return nil, err
+		}
+		jumped := scheduler.ClockJumped(start, time.Now())
+		res.Connection = conn
+		if res.Engine == "" {
+			res.Engine = engine
+		}
+		res.Tags = scheduler.Tags(ctx)
+		if _, expected := cal.Covers(res.Timestamp); expected {
+			res.Tags = append(res.Tags, downtime.Tag)
+		}
+		if jumped {
+			res.Tags = append(res.Tags, scheduler.ClockJumpTag)
+		}
+		if redactor != nil {
+			redactor.Result(res)
+		}
+		if signer != nil {
+			if res.ID == "" {
+				res.ID = model.NewID()
+			}
+			if err := signer.Sign(res); err != nil {
+				log.Printf("sign result: %v", err)
+			}
+		}
+		return res, nil
+	}
+
+	// Stop saving results before the disk fills up
+	var diskGuard *diskspace.Guard
+	diskInterval := diskspace.DefaultInterval
+	if dc := cfg.DiskSpace; !dc.Disabled && !demoMode {
+		minFree := dc.MinFreeMB
+		if minFree <= 0 {
+			minFree = diskspace.DefaultMinFreeMB
+		}
+		if dc.Interval != "" {
+			if diskInterval, err = time.ParseDuration(dc.Interval); err != nil || diskInterval <= 0 {
+				return nil, fmt.Errorf("disk_space: invalid interval %q", dc.Interval)
+			}
+		}
+		diskGuard = &diskspace.Guard{Dir: filepath.Dir(store.Path()), MinFree: uint64(minFree) << 20}
+		store.SetLowDiskSpace(diskGuard.Low)
+	}
+
+	// Packet-loss probes
+	var prober *probe.Prober
+	probeInterval := probe.DefaultInterval
+	if len(cfg.Probes.Targets) > 0 && !demoMode {
+		prober = &probe.Prober{Count: cfg.Probes.Count}
+		for _, t := range cfg.Probes.Targets {
+			prober.Targets = append(prober.Targets, probe.Target{Name: t.Name, Kind: t.Kind, Address: t.Address})
+		}
+		if err := probe.Validate(prober.Targets); err != nil {
+			return nil, fmt.Errorf("probes: %w", err)
+		}
+		if cfg.Probes.Timeout != "" {
+			if prober.Timeout, err = time.ParseDuration(cfg.Probes.Timeout); err != nil {
+				return nil, fmt.Errorf("probes: invalid timeout %q: %w", cfg.Probes.Timeout, err)
+			}
+		}
+		if cfg.Probes.Interval != "" {
+			if probeInterval, err = time.ParseDuration(cfg.Probes.Interval); err != nil {
+				return nil, fmt.Errorf("probes: invalid interval %q: %w", cfg.Probes.Interval, err)
+			}
+		}
+	}
+
+	// Web Push notifications of alerts and outages
+	var pushNotifier *push.Notifier
+	if pc := cfg.Alerts.Push; pc != nil && !demoMode {
+		if !strings.HasPrefix(pc.Subject, "mailto:") && !strings.HasPrefix(pc.Subject, "https://") {
+			return nil, fmt.Errorf("alerts: push: subject must be a mailto: or https:// URL")
+		}
+		keyPath := filepath.Join(cfg.DataDir, push.KeyFile)
+		keys, err := push.LoadOrCreate(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("alerts: push: %w", err)
+		}
+		pushNotifier = &push.Notifier{Sender: push.NewSender(keys, pc.Subject), Subscriptions: store, Location: loc}
+	}
+
+	// Result and outage events for message brokers, and push notifications
+	var emitter *events.Emitter
+	if !demoMode {
+		var publishers []events.Publisher
+		if pushNotifier != nil {
+			publishers = append(publishers, pushNotifier)
+		}
+		if k := cfg.Events.Kafka; k != nil {
+			p, err := events.NewKafka(k.Brokers, k.Topic, k.Partition)
+			if err != nil {
+				return nil, fmt.Errorf("events: kafka: %w", err)
+			}
+			publishers = append(publishers, p)
+		}
+		if n := cfg.Events.NATS; n != nil {
+			p, err := events.NewNATS(n.Server, n.Subject)
+			if err != nil {
+				return nil, fmt.Errorf("events: nats: %w", err)
+			}
+			publishers = append(publishers, p)
+		}
+		if len(publishers) > 0 {
+			emitter = events.NewEmitter(publishers...)
+			emitter.Downtime = cal
+		}
+	}
+
+	// runHooks runs the post-processing hooks on res, in order; one that
+	// fails is skipped. It returns the error of a hook that vetoed res.
+	runHooks := func(ctx context.Context, res *model.SpeedtestResult) error {
+		for _, h := range hooks {
+			if err := h.Process(ctx, res); errors.Is(err, plugins.ErrVetoed) {
+				return err
+			} else if err != nil {
+				log.Printf("%v", err)
+			}
+		}
+		return nil
+	}
+
+	runOneAndSave := func(ctx context.Context) (*model.SpeedtestResult, error) {
+		// There's no point testing when the result can't be saved
+		if diskGuard != nil && diskGuard.Low() {
+			return nil, storage.ErrLowDiskSpace
+		}
+		// Probe while the speedtest loads the link
+		var probeResults chan []model.ProbeResult
+		if prober != nil {
+			probeResults = make(chan []model.ProbeResult, 1)
+			go func() { probeResults <- prober.Round(ctx) }()
+		}
+
+		res, err := runOn(ctx, scheduler.Progress(ctx))
+		if err == nil {
+			err = runHooks(ctx, res)
+		}
+		// Shutdown may cancel ctx once the test is done; save what it
+		// measured regardless
+		saveCtx := context.WithoutCancel(ctx)
+		if err != nil {
+			// Failed runs count against the success rate and uptime; runs
+			// cancelled by shutdown, vetoed by a hook or skipped for lack of
+			// disk space don't.
+			if ctx.Err() == nil && !errors.Is(err, plugins.ErrVetoed) && !errors.Is(err, storage.ErrLowDiskSpace) {
+				failure := model.RunFailure{Timestamp: time.Now().UTC(), Error: err.Error(), Connection: scheduler.Connection(ctx)}
+				var serverErr *speedtest.ServerError
+				if errors.As(err, &serverErr) {
+					failure.Engine, failure.ServerID, failure.ServerName = serverErr.Engine, serverErr.ServerID, serverErr.ServerName
+				}
+				if ferr := store.SaveRunFailure(saveCtx, failure); ferr != nil {
+					log.Printf("save run failure: %v", ferr)
+				}
+				if emitter != nil {
+					emitter.Failure(failure)
+				}
+			}
+			return nil, err
+		}
+		if err := store.SaveResult(saveCtx, res); err != nil {
+			return nil, err
+		}
+
+		if probeResults != nil {
+			round := <-probeResults
+			for i := range round {
+				round[i].ResultID = res.ID
+			}
+			if err := store.SaveProbeResults(saveCtx, round); err != nil {
+				log.Printf("save probe results: %v", err)
+			}
+		}
+		return res, nil
+	}
+
+	// runAndSave runs each engine selected for ctx in turn and saves their
+	// results. With more than one, it also saves how far they diverged, and
+	// the slot's result, for alerts and dashboards, is the first engine's
+	// that succeeded.
+	runAndSave := func(ctx context.Context) (*model.SpeedtestResult, error) {
+		selected := scheduler.Engines(ctx)
+		if len(selected) < 2 {
+			return runOneAndSave(ctx)
+		}
+		var results []*model.SpeedtestResult
+		var firstErr error
+		for _, engine := range selected {
+			res, err := runOneAndSave(scheduler.WithEngines(ctx, []string{engine}))
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, err
+				}
+				log.Printf("%s test failed: %v", engine, err)
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s: %w", engine, err)
+				}
+				continue
+			}
+			results = append(results, res)
+		}
+		if len(results) == 0 {
+			return nil, firstErr
+		}
+		if len(results) > 1 {
+			if err := store.SaveEngineComparison(context.WithoutCancel(ctx), model.CompareEngines(results)); err != nil {
+				log.Printf("save engine comparison: %v", err)
+			}
+		}
+		return results[0], nil
+	}
+
+	// Run without saving (for manual runs when SaveManualRuns is false)
+	runWithoutSave := func(ctx context.Context) (*model.SpeedtestResult, error) {
+		return runOn(ctx, nil)
+	}
+
+	sched := scheduler.New(runAndSave, cfg.Schedules, cfg.LastRun)
+	sched.SetLocation(loc)
+
+	// cfgMu guards cfg against concurrent updates from the scheduler and API handlers
+	var cfgMu sync.Mutex
+
+	// Save config when schedules or lastRun change
+	saveConfig := func() {
+		cfgMu.Lock()
+		defer cfgMu.Unlock()
+		cfg.Schedules = sched.Schedules()
+		cfg.LastRun = sched.LastRun()
+		if err := config.Save(cfg); err != nil {
+			log.Printf("failed to save config: %v", err)
+		}
+	}
+	sched.SetOnUpdate(saveConfig)
+
+	// Initialize theme manager
+	themeManager, err := theme.NewManager(templatesFS, filepath.Join(cfg.DataDir, "themes"))
+	if err != nil {
+		return nil, fmt.Errorf("initialize theme manager: %w", err)
+	}
+	themeHandler := theme.NewHandler(themeManager)
+	if cfg.ThemeDevMode {
+		themeHandler.SetDevMode(true)
+		onStart(func(ctx context.Context) { go themeManager.Watch(ctx, 2*time.Second) })
+	}
+
+	// Load index.html template from static files
+	indexHTML, err := staticFS.ReadFile("web/dist/index.html")
+	if err != nil {
+		return nil, fmt.Errorf("read index.html: %w", err)
+	}
+	indexTemplate := template.Must(template.New("index").Parse(string(indexHTML)))
+
+	statusHTML, err := staticFS.ReadFile("web/dist/status.html")
+	if err != nil {
+		return nil, fmt.Errorf("read status.html: %w", err)
+	}
+	statusTemplate := template.Must(template.New("status").Parse(string(statusHTML)))
+
+	kioskHTML, err := staticFS.ReadFile("web/dist/kiosk.html")
+	if err != nil {
+		return nil, fmt.Errorf("read kiosk.html: %w", err)
+	}
+	kioskTemplate := template.Must(template.New("kiosk").Parse(string(kioskHTML)))
+
+	shareHTML, err := staticFS.ReadFile("web/dist/share.html")
+	if err != nil {
+		return nil, fmt.Errorf("read share.html: %w", err)
+	}
+	shareTemplate := template.Must(template.New("share").Parse(string(shareHTML)))
+
+	// The bundle is loaded with its content hash, so browsers can keep it
+	// until it changes
+	mainJS, err := loadAsset(staticFS, "web/dist/main.js", "application/javascript; charset=utf-8")
+	if err != nil {
+		return nil, fmt.Errorf("read main.js: %w", err)
+	}
+	mainJSMap, err := loadAsset(staticFS, "web/dist/main.js.map", "application/json; charset=utf-8")
+	if err != nil {
+		return nil, fmt.Errorf("read main.js.map: %w", err)
+	}
+
+	mux := http.NewServeMux()
+
+	// Create progress-enabled runner that doesn't save (for manual runs when SaveManualRuns is false)
+	runWithProgressWithoutSave := func(ctx context.Context, progress func(stage string, message string)) (*model.SpeedtestResult, error) {
+		return runOn(ctx, progress)
+	}
+
+	// Getter function for SaveManualRuns preference
+	getSaveManualRuns := func() bool {
+		cfgMu.Lock()
+		defer cfgMu.Unlock()
+		return cfg.SaveManualRuns
+	}
+
+	// Setter function for SaveManualRuns preference
+	setSaveManualRuns := func(value bool) error {
+		cfgMu.Lock()
+		defer cfgMu.Unlock()
+		cfg.SaveManualRuns = value
+		return config.Save(cfg)
+	}
+
+	apiServer := api.NewServer(store, runWithoutSave, runWithProgressWithoutSave, sched, saveConfig, getSaveManualRuns, setSaveManualRuns)
+
+	apiServer.SetLocation(loc)
+	if mr := cfg.ManualResults; mr.Max != 0 || mr.TTL != "" {
+		var ttl time.Duration
+		if mr.TTL != "" {
+			if ttl, err = time.ParseDuration(mr.TTL); err != nil || ttl <= 0 {
+				return nil, fmt.Errorf("manual_results: invalid ttl %q", mr.TTL)
+			}
+		}
+		if mr.Max < 0 {
+			return nil, fmt.Errorf("manual_results: max must not be negative")
+		}
+		apiServer.SetManualResultLimits(mr.Max, ttl)
+	}
+	themeManager.SetDefault(cfg.Theme.Template, cfg.Theme.Scheme)
+	apiServer.SetSettingsHandlers(
+		func() api.Settings {
+			cfgMu.Lock()
+			defer cfgMu.Unlock()
+			return api.Settings{
+				SaveManualRuns: cfg.SaveManualRuns,
+				Theme:          cfg.Theme,
+				Locale:         cfg.Locale,
+				Units:          cfg.Units,
+				Plans:          append([]model.Plan(nil), cfg.Plans...),
+			}
+		},
+		func(settings api.Settings) error {
+			if settings.Theme.Template != "" {
+				if err := themeManager.Validate(settings.Theme.Template, settings.Theme.Scheme); err != nil {
+					return fmt.Errorf("%w: %v", api.ErrInvalidSetting, err)
+				}
+			}
+			if err := i18n.ValidateLocale(settings.Locale); err != nil {
+				return fmt.Errorf("%w: %v", api.ErrInvalidSetting, err)
+			}
+			if err := i18n.ValidateUnits(settings.Units.Bandwidth, settings.Units.Clock); err != nil {
+				return fmt.Errorf("%w: %v", api.ErrInvalidSetting, err)
+			}
+			if err := validatePlans(settings.Plans); err != nil {
+				return fmt.Errorf("%w: %v", api.ErrInvalidSetting, err)
+			}
+
+			cfgMu.Lock()
+			defer cfgMu.Unlock()
+			cfg.SaveManualRuns = settings.SaveManualRuns
+			cfg.Theme = settings.Theme
+			cfg.Locale = settings.Locale
+			cfg.Units = settings.Units
+			cfg.Plans = settings.Plans
+			themeManager.SetDefault(cfg.Theme.Template, cfg.Theme.Scheme)
+			return config.Save(cfg)
+		},
+	)
+
+	// First-run setup, offered until a config file is written
+	cfgFile := config.Path(cfg.DataDir)
+	apiServer.SetSetup(
+		func() bool {
+			if demoMode {
+				return false
+			}
+			_, err := os.Stat(cfgFile)
+			return errors.Is(err, os.ErrNotExist)
+		},
+		func(req api.SetupRequest) (bool, error) {
+			if req.Plan != nil {
+				if err := validatePlans([]model.Plan{*req.Plan}); err != nil {
+					return false, fmt.Errorf("%w: %v", api.ErrInvalidSetting, err)
+				}
+			}
+			sched.SetSchedules(append(sched.Schedules(), *req.Schedule))
+
+			cfgMu.Lock()
+			defer cfgMu.Unlock()
+			cfg.AdminToken = req.AdminToken
+			restart := false
+			if req.Timezone != "" {
+				cfg.Timezone = req.Timezone
+				// The timezone is read at startup
+				restart = req.Timezone != loc.String()
+			}
+			if req.Plan != nil {
+				cfg.Plans = append(cfg.Plans, *req.Plan)
+			}
+			cfg.Schedules = sched.Schedules()
+			cfg.LastRun = sched.LastRun()
+			return restart, config.Save(cfg)
+		},
+	)
+
+	// Alerting
+	for _, rule := range cfg.Alerts.Rules {
+		if err := alert.ValidateRule(rule); err != nil {
+			return nil, fmt.Errorf("alerts: %w", err)
+		}
+	}
+	var notifiers []alert.Notifier
+	named := make(map[string]alert.Notifier)
+	var channels []api.NotifyChannel
+	addChannel := func(name string, ch notify.Channel) error {
+		channels = append(channels, api.NotifyChannel{Name: name, Channel: ch})
+		notifiers = append(notifiers, ch)
+		if name == "" {
+			return nil
+		}
+		if _, dup := named[name]; dup {
+			return fmt.Errorf("alerts: duplicate webhook name %q", name)
+		}
+		named[name] = ch
+		return nil
+	}
+	for i, wh := range cfg.Alerts.Webhooks {
+		n := notify.NewWebhook(wh.URL, wh.Headers)
+		n.Name, n.ContentType = wh.Name, wh.ContentType
+		if err := n.SetTemplate(wh.Template); err != nil {
+			return nil, fmt.Errorf("alerts: webhook %d: %w", i, err)
+		}
+		// Catch fields that don't exist before an alert needs the template
+		if _, _, err := n.Render(notify.SampleEvent(&model.SpeedtestResult{}, time.Now())); err != nil {
+			return nil, fmt.Errorf("alerts: webhook %d: %w", i, err)
+		}
+		if err := addChannel(wh.Name, n); err != nil {
+			return nil, err
+		}
+	}
+	for i, t := range cfg.Alerts.Teams {
+		if t.URL == "" {
+			return nil, fmt.Errorf("alerts: teams %d: missing url", i)
+		}
+		if err := addChannel(t.Name, notify.NewTeams(t.URL)); err != nil {
+			return nil, err
+		}
+	}
+	for i, m := range cfg.Alerts.Matrix {
+		n, err := notify.NewMatrix(m.Homeserver, m.AccessToken, m.RoomID)
+		if err != nil {
+			return nil, fmt.Errorf("alerts: matrix %d: %w", i, err)
+		}
+		if err := addChannel(m.Name, n); err != nil {
+			return nil, err
+		}
+	}
+	for i, p := range cfg.Alerts.PagerDuty {
+		n, err := notify.NewPagerDuty(p.RoutingKey, p.Source)
+		if err != nil {
+			return nil, fmt.Errorf("alerts: pagerduty %d: %w", i, err)
+		}
+		if err := addChannel(p.Name, n); err != nil {
+			return nil, err
+		}
+	}
+	for i, o := range cfg.Alerts.Opsgenie {
+		n, err := notify.NewOpsgenie(o.APIKey, o.Region, o.Source)
+		if err != nil {
+			return nil, fmt.Errorf("alerts: opsgenie %d: %w", i, err)
+		}
+		if err := addChannel(o.Name, n); err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range pluginNotifiers {
+		if err := addChannel(n.Name, n); err != nil {
+			return nil, err
+		}
+	}
+	if pushNotifier != nil {
+		notifiers = append(notifiers, pushNotifier)
+		apiServer.SetPush(pushNotifier)
+	}
+	var syslog *monitor.Syslog
+	if sl := cfg.Syslog; sl.Address != "" && !demoMode {
+		var err error
+		if syslog, err = monitor.NewSyslog(sl.Network, sl.Address, sl.Facility, sl.AppName); err != nil {
+			return nil, fmt.Errorf("syslog: %w", err)
+		}
+		notifiers = append(notifiers, syslog)
+	}
+	alerts := alert.NewEngine(cfg.Alerts.Rules, notifiers...)
+	alertRouter := alert.NewRouter(alerts, named)
+	for _, sc := range cfg.Schedules {
+		if err := alertRouter.Validate(sc.Alerts); err != nil {
+			return nil, fmt.Errorf("schedule %q alerts: %w", sc.Name, err)
+		}
+	}
+	// Rule states outlast restarts, so an incident still open is resolved
+	// when it recovers and acknowledgements and snoozes are kept
+	if latest, err := store.LatestAlerts(context.Background()); err != nil {
+		log.Printf("restore alert states: %v", err)
+	} else if snoozes, err := store.ListAlertSnoozes(context.Background(), time.Now()); err != nil {
+		log.Printf("restore alert snoozes: %v", err)
+	} else {
+		alertRouter.Restore(latest, snoozes)
+	}
+	onStart(func(ctx context.Context) { alertRouter.Start(ctx) })
+	onShutdown(alertRouter.Wait)
+	alerts.SetRecorder(func(ev alert.Event) {
+		rec := model.AlertRecord{
+			Time:      ev.Time,
+			Kind:      ev.Kind,
+			RuleID:    ev.RuleID,
+			RuleName:  ev.RuleName,
+			Metric:    ev.Metric,
+			Operator:  ev.Operator,
+			Threshold: ev.Threshold,
+			Value:     ev.Value,
+			Severity:  ev.Severity,
+			Since:     ev.Since,
+			Schedule:  ev.Schedule,
+			Snoozed:   ev.Snoozed,
+		}
+		if ev.Result != nil {
+			rec.ResultID = ev.Result.ID
+		}
+		if err := store.SaveAlert(context.Background(), &rec); err != nil {
+			log.Printf("failed to record alert: %v", err)
+		}
+	})
+	apiServer.SetAlertEngine(alerts)
+	apiServer.SetAlertRulesSaver(func(rules []model.AlertRule) error {
+		cfgMu.Lock()
+		defer cfgMu.Unlock()
+		cfg.Alerts.Rules = rules
+		return config.Save(cfg)
+	})
+	if diskGuard != nil {
+		diskGuard.OnChange = alerts.Notify
+		diskGuard.Check()
+		onStart(func(ctx context.Context) { go diskGuard.Run(ctx, diskInterval) })
+		apiServer.SetDiskGuard(diskGuard)
+	}
+	apiServer.SetAlertRouter(alertRouter)
+	apiServer.SetNotifyChannels(channels)
+
+	// History snapshots to object storage
+	if sc := cfg.Snapshots; sc.S3 != nil && !demoMode {
+		client := &s3.Client{
+			Endpoint:        sc.S3.Endpoint,
+			Region:          sc.S3.Region,
+			Bucket:          sc.S3.Bucket,
+			AccessKeyID:     sc.S3.AccessKeyID,
+			SecretAccessKey: sc.S3.SecretAccessKey,
+			PathStyle:       sc.S3.PathStyle,
+			HTTPClient:      &http.Client{Timeout: 10 * time.Minute},
+		}
+		if client.AccessKeyID == "" && client.SecretAccessKey == "" {
+			client.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+			client.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+			client.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+		if err := client.Validate(); err != nil {
+			return nil, fmt.Errorf("snapshots: s3: %w", err)
+		}
+		exporter := &snapshot.Exporter{Store: store, Client: client, Prefix: sc.S3.Prefix}
+		apiServer.SetSnapshots(exporter)
+		if sc.Interval != "" {
+			interval, err := time.ParseDuration(sc.Interval)
+			if err != nil || interval < time.Minute {
+				return nil, fmt.Errorf("snapshots: invalid interval %q", sc.Interval)
+			}
+			log.Printf("snapshots: uploading to %s every %s", exporter.Describe(), interval)
+			onStart(func(ctx context.Context) { go exporter.Run(ctx, interval) })
+		}
+	}
+
+	apiServer.SetDowntime(cal)
+	apiServer.SetServerQuality(qualityWindow, maxDeviationPct, cfg.ServerQuality.AutoExclude)
+	apiServer.SetPrivacy(redactor)
+	apiServer.SetReset(func(ctx context.Context) error {
+		if err := WipeData(ctx, store, cfg.DataDir); err != nil {
+			return err
+		}
+		sched.ResetLastRun()
+		return nil
+	})
+	if signer != nil {
+		apiServer.SetSigningKey(signer.PublicKey())
+	}
+
+	// Links granting read access to one chart, see /api/admin/share
+	shareSigner, err := share.LoadOrCreate(filepath.Join(cfg.DataDir, share.KeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("share key: %w", err)
+	}
+	apiServer.SetShareSigner(shareSigner)
+
+	if cfg.DisablePhoneHome {
+		log.Printf("phoning home is disabled: no update checks, benchmark service or default IP lookups")
+	}
+
+	// Opt-in comparison against other users of the same ISP
+	var bench *benchmark.Client
+	if cfg.Benchmark.Enabled && !demoMode && !cfg.DisablePhoneHome {
+		u, err := url.Parse(cfg.Benchmark.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("benchmark: url must be an http(s) URL, got %q", cfg.Benchmark.URL)
+		}
+		bench = benchmark.NewClient(cfg.Benchmark.URL)
+		apiServer.SetBenchmark(bench)
+	}
+	if err := apiServer.SetConnections(connections); err != nil {
+		return nil, fmt.Errorf("connections: %w", err)
+	}
+	if err := apiServer.RestoreMaintenance(context.Background()); err != nil {
+		log.Printf("maintenance: %v", err)
+	}
+
+	// External triggers
+	var triggers []api.Trigger
+	for _, t := range cfg.Triggers {
+		triggers = append(triggers, api.Trigger{Name: t.Name, Token: t.Token, Tags: t.Tags})
+	}
+	if err := apiServer.SetTriggers(triggers); err != nil {
+		return nil, fmt.Errorf("triggers: %w", err)
+	}
+
+	// Results from external tools
+	var ingestSources []api.IngestSource
+	for _, in := range cfg.Ingest {
+		mapping, err := ingestMapping(in.Fields, loc)
+		if err != nil {
+			return nil, fmt.Errorf("ingest %q: %w", in.Name, err)
+		}
+		ingestSources = append(ingestSources, api.IngestSource{Name: in.Name, Token: in.Token, Connection: in.Connection, Tags: in.Tags, Mapping: mapping})
+	}
+	if err := apiServer.SetIngestSources(ingestSources); err != nil {
+		return nil, fmt.Errorf("ingest: %w", err)
+	}
+
+	// Limits on downloading history
+	var exportTokens []api.ExportToken
+	for _, t := range cfg.Exports.Tokens {
+		exportTokens = append(exportTokens, api.ExportToken{Name: t.Name, Token: t.Token, Limit: exportLimit(t.ExportLimitConfig)})
+	}
+	if err := apiServer.SetExportLimits(exportLimit(cfg.Exports.ExportLimitConfig), cfg.Exports.RequireToken, exportTokens); err != nil {
+		return nil, fmt.Errorf("exports: %w", err)
+	}
+
+	// Working latency tests against hosts such as game servers
+	var latencyTester *latency.Tester
+	latencyInterval := time.Duration(0)
+	if wl := cfg.WorkingLatency; len(wl.Targets) > 0 && !demoMode {
+		latencyTester = &latency.Tester{
+			Count:       wl.Count,
+			Streams:     wl.Streams,
+			DownloadURL: wl.DownloadURL,
+			UploadURL:   wl.UploadURL,
+		}
+		for _, t := range wl.Targets {
+			latencyTester.Targets = append(latencyTester.Targets, probe.Target{Name: t.Name, Kind: t.Kind, Address: t.Address})
+		}
+		if err := probe.Validate(latencyTester.Targets); err != nil {
+			return nil, fmt.Errorf("working latency: %w", err)
+		}
+		if wl.Warmup != "" {
+			if latencyTester.Warmup, err = time.ParseDuration(wl.Warmup); err != nil || latencyTester.Warmup <= 0 {
+				return nil, fmt.Errorf("working latency: invalid warmup %q", wl.Warmup)
+			}
+		}
+		if wl.Interval != "" {
+			if latencyInterval, err = time.ParseDuration(wl.Interval); err != nil || latencyInterval <= 0 {
+				return nil, fmt.Errorf("working latency: invalid interval %q", wl.Interval)
+			}
+		}
+		apiServer.SetWorkingLatency(latencyTester)
+	}
+
+	// Show scheduled tests in progress on dashboards, and push the next run
+	// to their countdowns whenever a run starts
+	sched.SetOnProgress(apiServer.BroadcastSpeedtestProgress)
+	sched.SetOnUpdate(func() {
+		saveConfig()
+		apiServer.BroadcastNextRun()
+	})
+	// Mark clock jumps on the history, as results around them may be out of
+	// order or spaced oddly
+	sched.SetOnClockJump(func(j scheduler.ClockJump) {
+		a := &model.Annotation{
+			Kind:  model.AnnotationClockJump,
+			Start: j.Before,
+			End:   j.After,
+			Text:  fmt.Sprintf("System clock jumped %s, e.g. after suspend or an NTP correction", j),
+		}
+		if j.Offset() < 0 {
+			a.Start, a.End = j.After, j.Before
+		}
+		if err := store.SaveAnnotation(context.Background(), a); err != nil {
+			log.Printf("save clock jump annotation: %v", err)
+		}
+	})
+
+	// Legacy monitoring systems fed with each scheduled result
+	var zabbix *monitor.Zabbix
+	if z := cfg.Zabbix; z.Server != "" && !demoMode {
+		if z.Host == "" {
+			return nil, fmt.Errorf("zabbix: host is required")
+		}
+		zabbix = &monitor.Zabbix{Server: z.Server, Host: z.Host, KeyPrefix: z.KeyPrefix}
+	}
+	var nagios *monitor.Nagios
+	if n := cfg.Nagios; n.CommandFile != "" && !demoMode {
+		nagios = &monitor.Nagios{CommandFile: n.CommandFile, Host: n.Host, Service: n.Service, Thresholds: make(map[string]monitor.Threshold)}
+		for name, t := range n.Thresholds {
+			nagios.Thresholds[name] = monitor.Threshold{Warning: t.Warning, Critical: t.Critical}
+		}
+		if err := nagios.Validate(); err != nil {
+			return nil, fmt.Errorf("nagios: %w", err)
+		}
+	}
+	var sheet *sheets.Sheet
+	if gs := cfg.GoogleSheets; gs != nil && !demoMode {
+		if sheet, err = sheets.New(gs.CredentialsFile, gs.SpreadsheetID, gs.Sheet); err != nil {
+			return nil, fmt.Errorf("google sheets: %w", err)
+		}
+		sheet.Location = loc
+	}
+	var graphite *monitor.Graphite
+	if g := cfg.Graphite; g.Address != "" && !demoMode {
+		graphite = &monitor.Graphite{Address: g.Address, Prefix: g.Prefix}
+	}
+	var statsd *monitor.StatsD
+	if sd := cfg.StatsD; sd.Address != "" && !demoMode {
+		statsd = &monitor.StatsD{Address: sd.Address, Prefix: sd.Prefix}
+	}
+
+	// Broadcast and evaluate alerts when scheduled speedtests complete,
+	// applying the schedule's alert overrides. Shutdown waits for sends to
+	// integrations.
+	var sends sync.WaitGroup
+	onShutdown(func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			sends.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("integrations: results still being sent: %w", ctx.Err())
+		}
+	})
+	reportResult := func(id string, result *model.SpeedtestResult) {
+		apiServer.BroadcastSpeedtestComplete(result)
+		apiServer.BroadcastNextRun()
+		var schedule *model.Schedule
+		for _, sc := range sched.Schedules() {
+			if sc.ID == id {
+				schedule = &sc
+				break
+			}
+		}
+		if zabbix != nil || nagios != nil || graphite != nil || statsd != nil || syslog != nil || sheet != nil {
+			sends.Add(1)
+			go func(res model.SpeedtestResult) {
+				defer sends.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				if zabbix != nil {
+					if err := zabbix.Send(ctx, &res); err != nil {
+						log.Printf("%v", err)
+					}
+				}
+				if graphite != nil {
+					if err := graphite.Send(ctx, &res); err != nil {
+						log.Printf("%v", err)
+					}
+				}
+				if statsd != nil {
+					if err := statsd.Send(ctx, &res); err != nil {
+						log.Printf("%v", err)
+					}
+				}
+				if syslog != nil {
+					if err := syslog.SendResult(ctx, &res); err != nil {
+						log.Printf("%v", err)
+					}
+				}
+				if sheet != nil {
+					if err := sheet.Append(ctx, &res); err != nil {
+						log.Printf("google sheets: %v", err)
+					}
+				}
+				if nagios != nil {
+					if err := nagios.Submit(&res); err != nil {
+						log.Printf("%v", err)
+					}
+				}
+			}(*result)
+		}
+		if emitter != nil {
+			emitter.Result(*result)
+		}
+		w, expected := cal.Covers(result.Timestamp)
+		if bench != nil && cfg.Benchmark.Share && !expected && result.DownloadMbps > 0 {
+			sends.Add(1)
+			go func(res model.SpeedtestResult) {
+				defer sends.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				if err := bench.Submit(ctx, res); err != nil {
+					log.Printf("benchmark: submit result: %v", err)
+				}
+			}(*result)
+		}
+		if expected {
+			log.Printf("[alert] not evaluated during expected downtime %q", w.Name)
+			return
+		}
+		alertRouter.Observe(schedule, result)
+	}
+	sched.SetOnComplete(reportResult)
+
+	// Manual runs that are saved, right away or later from the ones held
+	// unsaved, go through hooks and are reported like triggered runs
+	apiServer.SetManualSave(
+		func(ctx context.Context, progress func(stage string, message string)) (*model.SpeedtestResult, error) {
+			res, err := runAndSave(scheduler.WithProgress(ctx, progress))
+			if err != nil {
+				return nil, err
+			}
+			reportResult("", res)
+			return res, nil
+		},
+		func(ctx context.Context, res *model.SpeedtestResult) (bool, error) {
+			if err := runHooks(ctx, res); err != nil {
+				return false, err
+			}
+			created, err := store.SaveResultIfNew(ctx, res)
+			if err != nil || !created {
+				return created, err
+			}
+			reportResult("", res)
+			return true, nil
+		},
+	)
+
+	// Opt-in update checks; /api/version reports the running version either way
+	updates := update.NewChecker(cfg.Updates.URL, Version)
+	apiServer.SetUpdates(updates)
+	if cfg.Updates.Check && !demoMode && !cfg.DisablePhoneHome {
+		interval := update.DefaultInterval
+		if cfg.Updates.Interval != "" {
+			if interval, err = time.ParseDuration(cfg.Updates.Interval); err != nil || interval < time.Hour {
+				return nil, fmt.Errorf("updates: invalid interval %q, must be at least 1h", cfg.Updates.Interval)
+			}
+		}
+		onStart(func(ctx context.Context) { go updates.Run(ctx, interval, apiServer.BroadcastUpdateAvailable) })
+	}
+
+	apiServer.Register(mux)
+	onStart(func(ctx context.Context) { sched.Start(ctx) })
+	if emitter != nil {
+		// The emitter outlives Start's context, which is done before the
+		// last run is saved, and stops once its events are published
+		emitCtx, stopEmitter := context.WithCancel(context.Background())
+		onStart(func(ctx context.Context) { go emitter.Run(emitCtx) })
+		onShutdown(func(ctx context.Context) error {
+			defer stopEmitter()
+			return emitter.Wait(ctx)
+		})
+	}
+	// Without phoning home, reconnects are only watched through an IP lookup
+	// the user chose
+	if cfg.Reconnect.Enabled && !demoMode && (!cfg.DisablePhoneHome || cfg.Reconnect.IPURL != "") {
+		watcher := &netinfo.WANWatcher{
+			URL: cfg.Reconnect.IPURL,
+			OnReconnect: func(oldIP, newIP string) {
+				if err := sched.RunNow("", []string{"reconnect"}); err != nil {
+					log.Printf("reconnect test: %v", err)
+				}
+			},
+		}
+		if cfg.Reconnect.Interval != "" {
+			if watcher.Interval, err = time.ParseDuration(cfg.Reconnect.Interval); err != nil {
+				return nil, fmt.Errorf("reconnect: invalid interval %q: %w", cfg.Reconnect.Interval, err)
+			}
+		}
+		onStart(func(ctx context.Context) { go watcher.Run(ctx) })
+	}
+	if cfg.Archive.Enabled || cfg.Archive.RawRetention() > 0 {
+		onStart(func(ctx context.Context) {
+			go runArchiver(ctx, store, cfg.Archive, filepath.Join(cfg.DataDir, "archive"))
+		})
+	}
+	// Continuous probe rounds are written in batches; rounds alongside a
+	// speedtest are saved right away with their result.
+	batch := store.NewBatchWriter(cfg.BatchDuration(), 0)
+	if prober != nil && probeInterval > 0 {
+		onStart(func(ctx context.Context) {
+			go prober.Run(ctx, probeInterval, func(results []model.ProbeResult) {
+				// Rounds during maintenance would only record the planned downtime
+				if ctx.Err() != nil || !sched.PausedUntil().IsZero() {
+					return
+				}
+				batch.AddProbeResults(results)
+			})
+		})
+	}
+
+	// WAN utilization from the routers' interface counters
+	type busyLimit struct {
+		pct     float64
+		maxWait time.Duration
+		stale   time.Duration // Older samples don't hold tests back
+	}
+	busyLimits := make(map[string]busyLimit)
+	for _, w := range cfg.WANCounters {
+		conn := w.Connection
+		if conn == model.DefaultConnection {
+			conn = ""
+		}
+		if _, ok := sources[conn]; conn != "" && !ok {
+			return nil, fmt.Errorf("wan_counters: unknown connection %q", conn)
+		}
+		if _, ok := busyLimits[conn]; ok {
+			return nil, fmt.Errorf("wan_counters: connection %q is listed twice", w.Connection)
+		}
+		if w.Address == "" || w.IfIndex <= 0 {
+			return nil, fmt.Errorf("wan_counters: address and if_index are required")
+		}
+		if w.BusyPct < 0 || w.DownloadMbps < 0 || w.UploadMbps < 0 {
+			return nil, fmt.Errorf("wan_counters: busy_pct, download_mbps and upload_mbps must not be negative")
+		}
+		interval := snmp.DefaultInterval
+		if w.Interval != "" {
+			if interval, err = time.ParseDuration(w.Interval); err != nil || interval <= 0 {
+				return nil, fmt.Errorf("wan_counters: invalid interval %q", w.Interval)
+			}
+		}
+		maxWait := 30 * time.Minute
+		if w.BusyMaxWait != "" {
+			if maxWait, err = time.ParseDuration(w.BusyMaxWait); err != nil || maxWait < 0 {
+				return nil, fmt.Errorf("wan_counters: invalid busy_max_wait %q", w.BusyMaxWait)
+			}
+		}
+		busyLimits[conn] = busyLimit{pct: w.BusyPct, maxWait: maxWait, stale: 3 * interval}
+		if demoMode {
+			continue
+		}
+
+		w := w
+		monitor := &snmp.Monitor{
+			Client:     &snmp.Client{Address: w.Address, Community: w.Community},
+			IfIndex:    w.IfIndex,
+			Connection: conn,
+			Capacity: func(t time.Time) (float64, float64) {
+				down, up := w.DownloadMbps, w.UploadMbps
+				cfgMu.Lock()
+				plan := model.PlanAt(model.PlanHistory(cfg.Plans, conn, loc), t)
+				cfgMu.Unlock()
+				if plan != nil && down == 0 {
+					down = plan.DownloadMbps
+				}
+				if plan != nil && up == 0 {
+					up = plan.UploadMbps
+				}
+				return down, up
+			},
+		}
+		lastErr := ""
+		onStart(func(ctx context.Context) {
+			go monitor.Run(ctx, interval, func(u model.WANUtilization) {
+				// Log when the router becomes unreachable, not at every read
+				if u.Error != "" && u.Error != lastErr {
+					log.Printf("wan counters %s: %s", w.Address, u.Error)
+				}
+				lastErr = u.Error
+				if err := store.SaveWANUtilization(ctx, u); err != nil {
+					log.Printf("save wan utilization: %v", err)
+				}
+			})
+		})
+	}
+	sched.SetBusyCheck(func(connection string) (string, time.Duration) {
+		if connection == model.DefaultConnection {
+			connection = ""
+		}
+		limit, ok := busyLimits[connection]
+		if !ok || limit.pct == 0 {
+			return "", 0
+		}
+		u, err := store.LatestWANUtilization(context.Background(), connection)
+		if err != nil {
+			log.Printf("latest wan utilization: %v", err)
+			return "", 0
+		}
+		if u == nil || u.Error != "" || time.Since(u.Timestamp) > limit.stale || u.BusyPct() <= limit.pct {
+			return "", 0
+		}
+		return fmt.Sprintf("WAN link %.0f%% busy (%.1f Mbps down, %.1f Mbps up)", u.BusyPct(), u.DownloadMbps, u.UploadMbps), limit.maxWait
+	})
+
+	// External reachability
+	if cfg.Reachability.Enabled && !demoMode {
+		interval := reach.DefaultInterval
+		if cfg.Reachability.Interval != "" {
+			if interval, err = time.ParseDuration(cfg.Reachability.Interval); err != nil || interval <= 0 {
+				return nil, fmt.Errorf("reachability: invalid interval %q", cfg.Reachability.Interval)
+			}
+		}
+		checker := &reach.Checker{
+			Port:       cfg.Reachability.Port,
+			CheckURL:   cfg.Reachability.CheckURL,
+			STUNServer: cfg.Reachability.STUNServer,
+			Gateway:    cfg.Reachability.Gateway,
+		}
+		switch {
+		case checker.Port < 0:
+			checker.Port = 0
+		case checker.Port == 0:
+			checker.Port = tcpPort(cfg.ListenAddresses())
+		}
+		onStart(func(ctx context.Context) {
+			go checker.Run(ctx, interval, func(c model.ReachabilityCheck) {
+				if c.Error != "" {
+					log.Printf("reachability: %s", c.Error)
+				}
+				if redactor != nil {
+					c.PublicIP, c.RouterIP = redactor.IP(c.PublicIP), redactor.IP(c.RouterIP)
+				}
+				if err := store.SaveReachabilityCheck(ctx, c); err != nil {
+					log.Printf("save reachability check: %v", err)
+				}
+			})
+		})
+	}
+
+	// Scheduled working latency tests
+	if latencyTester != nil && latencyInterval > 0 {
+		onStart(func(ctx context.Context) {
+			go latencyTester.Run(ctx, latencyInterval, func(l model.WorkingLatency) {
+				if l.Error != "" {
+					log.Printf("working latency %s: %s", l.Target, l.Error)
+				}
+				if err := store.SaveWorkingLatency(ctx, l); err != nil {
+					log.Printf("save working latency test: %v", err)
+				}
+			})
+		})
+	}
+
+	// Starlink dish status
+	if cfg.Starlink.Enabled && !demoMode {
+		interval := starlink.DefaultInterval
+		if cfg.Starlink.Interval != "" {
+			if interval, err = time.ParseDuration(cfg.Starlink.Interval); err != nil || interval <= 0 {
+				return nil, fmt.Errorf("starlink: invalid interval %q", cfg.Starlink.Interval)
+			}
+		}
+		dish := &starlink.Client{Address: cfg.Starlink.Address}
+		lastErr := ""
+		onStart(func(ctx context.Context) {
+			go dish.Run(ctx, interval, func(st model.StarlinkStatus) {
+				// Log when the dish becomes unreachable, not at every reading
+				if st.Error != "" && st.Error != lastErr {
+					log.Printf("starlink: %s", st.Error)
+				}
+				lastErr = st.Error
+				if err := store.SaveStarlinkStatus(ctx, st); err != nil {
+					log.Printf("save starlink status: %v", err)
+				}
+			})
+		})
+	}
+
+	// Management endpoints go on their own mux when a separate admin listener is configured
+	adminMux := mux
+	if cfg.AdminListenAddr != "" {
+		adminMux = http.NewServeMux()
+	}
+	apiServer.ConfigureAdmin(cfg.AdminToken, cfg.EnablePprof)
+	themeHandler.SetAuthorizer(apiServer.RequireAdmin)
+	apiServer.RegisterAdmin(adminMux)
+	adminMux.HandleFunc("/api/admin/themes/reload", apiServer.RequireAdmin(themeHandler.HandleReload))
+
+	// Theme API endpoints
+	mux.HandleFunc("/api/theme", themeHandler.HandleTheme)
+	mux.HandleFunc("/api/schemes", themeHandler.HandleSchemes)
+	mux.HandleFunc("/api/themes", themeHandler.HandleThemes)
+	mux.HandleFunc("/api/themes/", themeHandler.HandleThemeByName)
+	mux.HandleFunc("/api/themes/validate", themeHandler.HandleValidate)
+
+	// Index page handler, also serving the dashboard views routed by the
+	// frontend (/history, /preferences, ...)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if !isClientRoute(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+
+		templatesList := themeManager.ListTemplates()
+		templateName, schemeName := themeManager.Default()
+
+		cfgMu.Lock()
+		f := i18n.NewFormatter(cfg.Locale, cfg.Units.Bandwidth, cfg.Units.Clock)
+		cfgMu.Unlock()
+
+		templateMenuHTML := themeHandler.GenerateTemplateMenuHTML(templateName)
+		schemeMenuHTML := themeHandler.GenerateSchemeMenuHTML(templateName)
+
+		// Without it the dashboard loads the same data from the API
+		var bootstrap *api.Bootstrap
+		if b, err := apiServer.Bootstrap(r.Context()); err != nil {
+			log.Printf("index page: %v", err)
+		} else {
+			if apiServer.ReadOnly(r) {
+				b = b.Public()
+			}
+			bootstrap = &b
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		_ = indexTemplate.Execute(w, map[string]any{
+			"Title":            "speedplane",
+			"TemplatesList":    templatesList,
+			"TemplateMenuHTML": template.HTML(templateMenuHTML),
+			"SchemeMenuHTML":   template.HTML(schemeMenuHTML),
+			"CurrentTemplate":  templateName,
+			"CurrentScheme":    schemeName,
+			"AppVersion":       Version,
+			"Year":             time.Now().Year(),
+			"Lang":             f.Lang(),
+			"Locale":           f.Locale,
+			"BandwidthUnit":    f.Bandwidth,
+			"Clock":            f.Clock,
+			"T":                f.T,
+			"Bootstrap":        bootstrap,
+			"AssetVersion":     mainJS.version(),
+		})
+	})
+
+	// Public status page, safe to share and cache
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		status, err := apiServer.Status(r.Context())
+		if err != nil {
+			http.Error(w, "failed to load status", http.StatusInternalServerError)
+			log.Printf("status page: %v", err)
+			return
+		}
+
+		templateName, schemeName := themeManager.Default()
+		cfgMu.Lock()
+		f := i18n.NewFormatter(cfg.Locale, cfg.Units.Bandwidth, cfg.Units.Clock)
+		cfgMu.Unlock()
+
+		var buf bytes.Buffer
+		if err := statusTemplate.Execute(&buf, map[string]any{
+			"Title":           "speedplane",
+			"CurrentTemplate": templateName,
+			"CurrentScheme":   schemeName,
+			"AppVersion":      Version,
+			"Lang":            f.Lang(),
+			"T":               f.T,
+			"F":               f,
+			"Location":        loc,
+			"Status":          status,
+		}); err != nil {
+			http.Error(w, "failed to render status", http.StatusInternalServerError)
+			log.Printf("status page: %v", err)
+			return
+		}
+		api.WriteCacheable(w, r, "text/html; charset=utf-8", time.Minute, buf.Bytes())
+	})
+
+	// Full-screen display for wall-mounted screens: /kiosk?template=&scheme=&refresh=&range=
+	mux.HandleFunc("/kiosk", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		templateName, schemeName := themeManager.Default()
+		if t := q.Get("template"); t != "" {
+			templateName, schemeName = themeManager.Resolve(t, q.Get("scheme"))
+		} else if sc := q.Get("scheme"); sc != "" {
+			templateName, schemeName = themeManager.Resolve(templateName, sc)
+		}
+
+		refresh := 60
+		if v, err := strconv.Atoi(q.Get("refresh")); err == nil {
+			refresh = min(max(v, 10), 3600)
+		}
+
+		window := 24 * time.Hour
+		switch q.Get("range") {
+		case "7d":
+			window = 7 * 24 * time.Hour
+		case "30d":
+			window = 30 * 24 * time.Hour
+		}
+
+		view, err := apiServer.Kiosk(r.Context(), window)
+		if err != nil {
+			http.Error(w, "failed to load results", http.StatusInternalServerError)
+			log.Printf("kiosk page: %v", err)
+			return
+		}
+
+		cfgMu.Lock()
+		f := i18n.NewFormatter(cfg.Locale, cfg.Units.Bandwidth, cfg.Units.Clock)
+		cfgMu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := kioskTemplate.Execute(w, map[string]any{
+			"Title":           "speedplane",
+			"CurrentTemplate": templateName,
+			"CurrentScheme":   schemeName,
+			"Lang":            f.Lang(),
+			"T":               f.T,
+			"F":               f,
+			"Location":        loc,
+			"Refresh":         refresh,
+			"View":            view,
+		}); err != nil {
+			log.Printf("kiosk page: %v", err)
+		}
+	})
+
+	// Charts shared with /api/admin/share, readable without an account
+	mux.Handle("/share/", apiServer.ShareHandler(func(w http.ResponseWriter, r *http.Request, chart api.SharedChart) {
+		templateName, schemeName := themeManager.Default()
+		cfgMu.Lock()
+		f := i18n.NewFormatter(cfg.Locale, cfg.Units.Bandwidth, cfg.Units.Clock)
+		cfgMu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := shareTemplate.Execute(w, map[string]any{
+			"Title":           "speedplane",
+			"CurrentTemplate": templateName,
+			"CurrentScheme":   schemeName,
+			"AppVersion":      Version,
+			"Lang":            f.Lang(),
+			"T":               f.T,
+			"F":               f,
+			"Location":        loc,
+			"Chart":           chart,
+			"Token":           strings.Trim(strings.TrimPrefix(r.URL.Path, "/share/"), "/"),
+		}); err != nil {
+			log.Printf("share page: %v", err)
+		}
+	}))
+
+	// Static files
+	staticContent, err := fs.Sub(staticFS, "web/dist")
+	if err != nil {
+		return nil, fmt.Errorf("static files: %w", err)
+	}
+
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticContent))))
+
+	// Icons, web manifest and service worker for installing the dashboard
+	if err := registerPWA(mux, staticContent); err != nil {
+		return nil, fmt.Errorf("app icons: %w", err)
+	}
+
+	// Serve JS/CSS files directly
+	mux.Handle("/main.js", mainJS)
+	mux.Handle("/main.js.map", mainJSMap)
+	mux.HandleFunc("/styles.css", func(w http.ResponseWriter, r *http.Request) {
+		// Styles are now loaded via theme API, but keep for backwards compatibility
+		http.NotFound(w, r)
+	})
+
+	s.store, s.sched, s.api, s.batch = store, sched, apiServer, batch
+	// A public dashboard only serves the read-only subset of the API to visitors
+	apiServer.SetPublic(cfg.PublicDashboard)
+	if cfg.PublicDashboard && cfg.AdminToken == "" {
+		log.Printf("public dashboard: no admin_token is set, so only the public endpoints of the API can be reached")
+	}
+	s.mux, s.adminMux = apiServer.Public(mux), adminMux
+	if adminMux == mux {
+		s.adminMux = s.mux
+	}
+	return s, nil
+}
+
+// exportLimit converts configured export limits to the API's.
+func exportLimit(c config.ExportLimitConfig) api.ExportLimit {
+	return api.ExportLimit{
+		MaxRange: time.Duration(c.MaxDays) * 24 * time.Hour,
+		MaxRows:  c.MaxRows,
+		Rate:     c.RateKiBps << 10,
+	}
+}
+
+// ingestMapping builds the mapping from a tool's JSON to results described by
+// fields, reading timestamps without a zone in loc.
+func ingestMapping(fields map[string]config.IngestFieldConfig, loc *time.Location) (*ingest.Mapping, error) {
+	out := make(map[string]ingest.Field, len(fields))
+	for name, f := range fields {
+		out[name] = ingest.Field{Path: f.Path, Scale: f.Scale, Unit: f.Unit, Format: f.Format}
+	}
+	return ingest.NewMapping(out, loc)
+}
+
+// newMockRunner builds the mock runner described by c.
+func newMockRunner(c config.MockConfig) (*speedtest.MockRunner, error) {
+	m := &speedtest.MockRunner{
+		DownloadMbps:  c.DownloadMbps,
+		UploadMbps:    c.UploadMbps,
+		PingMs:        c.PingMs,
+		JitterMs:      c.JitterMs,
+		PacketLossPct: c.PacketLossPct,
+		Spread:        c.Spread,
+		Seed:          c.Seed,
+		FailEvery:     c.FailEvery,
+		FailRate:      c.FailRate,
+		FailPhase:     c.FailPhase,
+	}
+	if c.Spread < 0 || c.Spread > 1 {
+		return nil, fmt.Errorf("spread must be between 0 and 1")
+	}
+	if c.FailRate < 0 || c.FailRate > 1 {
+		return nil, fmt.Errorf("fail_rate must be between 0 and 1")
+	}
+	if c.FailEvery < 0 {
+		return nil, fmt.Errorf("fail_every must not be negative")
+	}
+	if c.FailPhase != "" && !slices.Contains(speedtest.Phases, c.FailPhase) {
+		return nil, fmt.Errorf("fail_phase must be ping, download, or upload")
+	}
+	if c.Delay != "" {
+		d, err := time.ParseDuration(c.Delay)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid delay %q", c.Delay)
+		}
+		m.Delay = d
+	}
+	return m, nil
+}
@@ -0,0 +1,160 @@
+// Package share signs links that give read access to one chart over a fixed
+// time range, e.g. to paste into a support ticket with an ISP. Links carry
+// everything they grant and an expiry, signed with HMAC-SHA256, so the
+// server keeps no record of them and nobody needs an account to open one.
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// KeyFile is the name of the link signing key file in the data directory.
+const KeyFile = "speedplane-share.key"
+
+// keySize is the length of signing keys in bytes.
+const keySize = 32
+
+var (
+	// ErrInvalid is returned by Verify for tokens that are malformed or
+	// weren't signed with the key, including those signed with a key that
+	// has since been replaced.
+	ErrInvalid = errors.New("invalid share link")
+	// ErrExpired is returned by Verify for correctly signed tokens past
+	// their expiry.
+	ErrExpired = errors.New("share link expired")
+)
+
+// b64 is the unpadded base64url encoding of tokens, safe in URL paths.
+var b64 = base64.RawURLEncoding
+
+// Link is what a share link grants: one metric of one connection between
+// two times, until it expires.
+type Link struct {
+	Metric     string    `json:"metric"`
+	Connection string    `json:"connection,omitempty"` // Empty for all connections
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Expires    time.Time `json:"expires"`
+}
+
+// claims is the signed part of a token, with short names and Unix times to
+// keep links short.
+type claims struct {
+	Metric     string `json:"m"`
+	Connection string `json:"c,omitempty"`
+	From       int64  `json:"f"`
+	To         int64  `json:"t"`
+	Expires    int64  `json:"e"`
+}
+
+// Signer signs and verifies share links.
+type Signer struct {
+	key []byte
+}
+
+// LoadOrCreate reads the signing key at path, generating and saving a new
+// one, readable only by the owner, if the file doesn't exist yet. Deleting
+// the file revokes every link handed out so far.
+func LoadOrCreate(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return create(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := b64.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) < keySize {
+		return nil, fmt.Errorf("%s: not a %d byte base64url key", path, keySize)
+	}
+	return &Signer{key: key}, nil
+}
+
+func create(path string) (*Signer, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	// O_EXCL so a key created concurrently is never overwritten
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.WriteString(b64.EncodeToString(key) + "\n"); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return &Signer{key: key}, nil
+}
+
+// Sign returns the token for l: its claims and their signature, base64url
+// encoded and joined by a dot. Times are kept to the second.
+func (s *Signer) Sign(l Link) string {
+	body, err := json.Marshal(claims{
+		Metric:     l.Metric,
+		Connection: l.Connection,
+		From:       l.From.Unix(),
+		To:         l.To.Unix(),
+		Expires:    l.Expires.Unix(),
+	})
+	if err != nil {
+		// A struct of strings and integers always encodes
+		panic(err)
+	}
+	payload := b64.EncodeToString(body)
+	return payload + "." + b64.EncodeToString(s.mac(payload))
+}
+
+// Verify checks token's signature and expiry at now, and returns the link
+// it grants.
+func (s *Signer) Verify(token string, now time.Time) (Link, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return Link{}, ErrInvalid
+	}
+	got, err := b64.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.mac(payload)) {
+		return Link{}, ErrInvalid
+	}
+	body, err := b64.DecodeString(payload)
+	if err != nil {
+		return Link{}, ErrInvalid
+	}
+	var c claims
+	if err := json.Unmarshal(body, &c); err != nil {
+		return Link{}, ErrInvalid
+	}
+	l := Link{
+		Metric:     c.Metric,
+		Connection: c.Connection,
+		From:       time.Unix(c.From, 0).UTC(),
+		To:         time.Unix(c.To, 0).UTC(),
+		Expires:    time.Unix(c.Expires, 0).UTC(),
+	}
+	if !now.Before(l.Expires) {
+		return l, ErrExpired
+	}
+	return l, nil
+}
+
+func (s *Signer) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
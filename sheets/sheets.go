@@ -0,0 +1,316 @@
+// Package sheets appends results as rows to a Google Sheet, authenticating
+// as a service account.
+package sheets
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"speedplane/model"
+)
+
+const (
+	// DefaultSheet is the tab rows are appended to.
+	DefaultSheet = "Results"
+
+	apiURL = "https://sheets.googleapis.com/v4/spreadsheets"
+	scope  = "https://www.googleapis.com/auth/spreadsheets"
+)
+
+// header is written as the first row of an empty sheet.
+var header = []interface{}{
+	"Time", "Download (Mbps)", "Upload (Mbps)", "Ping (ms)", "Jitter (ms)", "Packet loss (%)",
+	"ISP", "Server", "Connection", "Tags", "Result ID",
+}
+
+// serviceAccount is the part of a service account's JSON key used to
+// authenticate.
+type serviceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// Sheet appends results to a tab of a spreadsheet. The spreadsheet must be
+// shared with the service account's email address as an editor.
+type Sheet struct {
+	SpreadsheetID string
+	Sheet         string         // Tab name; defaults to DefaultSheet, and must exist
+	Location      *time.Location // Time zone times are written in; defaults to local time
+	Client        *http.Client
+	BaseURL       string // Defaults to the Sheets API
+
+	account serviceAccount
+	key     *rsa.PrivateKey
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	hasHeader   bool
+}
+
+// New creates a Sheet for the service account whose JSON key file is at
+// credentialsFile.
+func New(credentialsFile, spreadsheetID, sheet string) (*Sheet, error) {
+	if spreadsheetID == "" {
+		return nil, errors.New("missing spreadsheet ID")
+	}
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read credentials: %w", err)
+	}
+	s := &Sheet{
+		SpreadsheetID: spreadsheetID,
+		Sheet:         sheet,
+		Client:        &http.Client{Timeout: 30 * time.Second},
+	}
+	if err := json.Unmarshal(data, &s.account); err != nil {
+		return nil, fmt.Errorf("parse credentials: %w", err)
+	}
+	if s.account.ClientEmail == "" || s.account.PrivateKey == "" {
+		return nil, errors.New("credentials are not a service account key")
+	}
+	if s.account.TokenURI == "" {
+		s.account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	block, _ := pem.Decode([]byte(s.account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("credentials: invalid private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("credentials: %w", err)
+	}
+	var ok bool
+	if s.key, ok = parsed.(*rsa.PrivateKey); !ok {
+		return nil, errors.New("credentials: private key is not RSA")
+	}
+	return s, nil
+}
+
+// Append adds a row for r, writing the header first if the sheet is empty.
+func (s *Sheet) Append(ctx context.Context, r *model.SpeedtestResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.hasHeader {
+		empty, err := s.isEmpty(ctx)
+		if err != nil {
+			return err
+		}
+		if empty {
+			if err := s.append(ctx, header); err != nil {
+				return err
+			}
+		}
+		s.hasHeader = true
+	}
+
+	loc := s.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	server := r.ServerName
+	if r.ServerCountry != "" {
+		server += " (" + r.ServerCountry + ")"
+	}
+	return s.append(ctx, []interface{}{
+		r.Timestamp.In(loc).Format("2006-01-02 15:04:05"),
+		r.DownloadMbps, r.UploadMbps, r.PingMs, r.JitterMs, r.PacketLossPct,
+		text(r.ISP), text(server), text(r.Connection), text(strings.Join(r.Tags, ", ")), r.ID,
+	})
+}
+
+// text keeps a value from a speedtest server or ISP from being entered as a
+// formula by prefixing the apostrophe the sheet takes as "plain text".
+func text(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func (s *Sheet) sheetName() string {
+	if s.Sheet == "" {
+		return DefaultSheet
+	}
+	return s.Sheet
+}
+
+// rangeURL returns the API URL of a range of the sheet, e.g. "A:K".
+func (s *Sheet) rangeURL(cells, suffix string) string {
+	base := s.BaseURL
+	if base == "" {
+		base = apiURL
+	}
+	// Quote the tab name, doubling quotes, so any name works in A1 notation
+	a1 := "'" + strings.ReplaceAll(s.sheetName(), "'", "''") + "'!" + cells
+	return base + "/" + url.PathEscape(s.SpreadsheetID) + "/values/" + url.PathEscape(a1) + suffix
+}
+
+func (s *Sheet) isEmpty(ctx context.Context) (bool, error) {
+	var resp struct {
+		Values [][]interface{} `json:"values"`
+	}
+	if err := s.call(ctx, http.MethodGet, s.rangeURL("A1:A1", ""), nil, &resp); err != nil {
+		return false, err
+	}
+	return len(resp.Values) == 0, nil
+}
+
+// append adds a row after the last row of the table in the sheet. Values
+// are entered as if typed, so times become dates the sheet can chart.
+func (s *Sheet) append(ctx context.Context, row []interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"values": [][]interface{}{row}})
+	if err != nil {
+		return err
+	}
+	u := s.rangeURL("A:K", ":append?valueInputOption=USER_ENTERED&insertDataOption=INSERT_ROWS")
+	return s.call(ctx, http.MethodPost, u, body, nil)
+}
+
+// call makes an authenticated API request, decoding the response into out
+// if it isn't nil.
+func (s *Sheet) call(ctx context.Context, method, u string, body []byte, out interface{}) error {
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return apiError(resp.Status, data)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// accessToken returns a cached OAuth access token, or gets a new one by
+// signing a JWT assertion with the service account's key.
+func (s *Sheet) accessToken(ctx context.Context) (string, error) {
+	if s.token != "" && time.Now().Before(s.tokenExpiry) {
+		return s.token, nil
+	}
+
+	now := time.Now()
+	assertion, err := s.signJWT(map[string]interface{}{
+		"iss":   s.account.ClientEmail,
+		"scope": scope,
+		"aud":   s.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("get access token: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("get access token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("get access token: %w", apiError(resp.Status, data))
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(data, &tok); err != nil || tok.AccessToken == "" {
+		return "", errors.New("get access token: invalid response")
+	}
+	s.token = tok.AccessToken
+	// Renew a minute early so a token doesn't expire mid-request
+	s.tokenExpiry = now.Add(time.Duration(tok.ExpiresIn)*time.Second - time.Minute)
+	return s.token, nil
+}
+
+// signJWT returns claims as a JWT signed with RS256.
+func (s *Sheet) signJWT(claims map[string]interface{}) (string, error) {
+	head, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.account.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(head) + "." + enc.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// apiError turns an error response into an error, using the message of
+// Google's error format when there is one.
+func apiError(status string, body []byte) error {
+	// The API nests a message in "error"; the token endpoint sets "error"
+	// to a code and describes it separately
+	var e struct {
+		Error       json.RawMessage `json:"error"`
+		Description string          `json:"error_description"`
+	}
+	if json.Unmarshal(body, &e) == nil {
+		var detail struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(e.Error, &detail) == nil && detail.Message != "" {
+			return fmt.Errorf("%s: %s", status, detail.Message)
+		}
+		if e.Description != "" {
+			return fmt.Errorf("%s: %s", status, e.Description)
+		}
+	}
+	return fmt.Errorf("unexpected status %s", status)
+}
@@ -0,0 +1,293 @@
+// Package signing signs results with an Ed25519 key when they are captured,
+// so exported data handed to an ISP or regulator can be shown to be
+// unchanged since.
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"speedplane/model"
+)
+
+// KeyFile is the name of the private key file in the data directory.
+const KeyFile = "speedplane.key"
+
+var (
+	// ErrUnsigned is returned by Verify for results without a signature.
+	ErrUnsigned = errors.New("result is not signed")
+	// ErrInvalidSignature is returned by Verify when a result was changed
+	// after it was signed, or signed with a different key.
+	ErrInvalidSignature = errors.New("signature does not match the result")
+)
+
+// payload is what a signature covers, in a fixed field order. Version it if
+// the fields ever change, so older signatures can still be checked.
+type payload struct {
+	Version       int     `json:"v"`
+	ID            string  `json:"id"`
+	Timestamp     string  `json:"timestamp"` // RFC 3339 in UTC, to the second as stored
+	DownloadMbps  float64 `json:"download_mbps"`
+	UploadMbps    float64 `json:"upload_mbps"`
+	PingMs        float64 `json:"ping_ms"`
+	JitterMs      float64 `json:"jitter_ms"`
+	PacketLossPct float64 `json:"packet_loss_pct"`
+	ISP           string  `json:"isp"`
+	ExternalIP    string  `json:"external_ip"`
+	ServerID      string  `json:"server_id"`
+	ServerName    string  `json:"server_name"`
+	ServerCountry string  `json:"server_country"`
+	Connection    string  `json:"connection"`
+	RawSHA256     string  `json:"raw_sha256"` // Of the engine output in canonical JSON form
+}
+
+// Payload returns the bytes a result's signature covers: its ID, time,
+// measurements, ISP, IP address, server, connection and the engine's raw
+// output.
+func Payload(r model.SpeedtestResult) ([]byte, error) {
+	raw, err := canonicalJSON(r.RawJSON)
+	if err != nil {
+		return nil, fmt.Errorf("raw_json: %w", err)
+	}
+	sum := sha256.Sum256(raw)
+	return json.Marshal(payload{
+		Version:       1,
+		ID:            r.ID,
+		Timestamp:     r.Timestamp.UTC().Truncate(time.Second).Format(time.RFC3339),
+		DownloadMbps:  r.DownloadMbps,
+		UploadMbps:    r.UploadMbps,
+		PingMs:        r.PingMs,
+		JitterMs:      r.JitterMs,
+		PacketLossPct: r.PacketLossPct,
+		ISP:           r.ISP,
+		ExternalIP:    r.ExternalIP,
+		ServerID:      r.ServerID,
+		ServerName:    r.ServerName,
+		ServerCountry: r.ServerCountry,
+		Connection:    r.Connection,
+		RawSHA256:     hex.EncodeToString(sum[:]),
+	})
+}
+
+// canonicalJSON re-encodes raw JSON with sorted keys and no whitespace, so
+// the engine output hashes the same after being stored and exported.
+func canonicalJSON(raw json.RawMessage) ([]byte, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// Signer signs results with a private key.
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// LoadOrCreate reads the private key at path, generating and saving a new
+// one, readable only by the owner, if the file doesn't exist yet.
+func LoadOrCreate(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return create(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no PEM private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return &Signer{key: edKey}, nil
+}
+
+func create(path string) (*Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	// O_EXCL so a key created concurrently is never overwritten
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return &Signer{key: key}, nil
+}
+
+// Sign sets the result's signature. It must be called once the result has
+// its final ID.
+func (s *Signer) Sign(r *model.SpeedtestResult) error {
+	p, err := Payload(*r)
+	if err != nil {
+		return err
+	}
+	r.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, p))
+	return nil
+}
+
+// PublicKey returns the key signatures are verified with.
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// EncodePublicKey returns key as a PEM "PUBLIC KEY" block, as read by
+// ParsePublicKey and tools such as openssl.
+func EncodePublicKey(key ed25519.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// ParsePublicKey reads a PEM public key written by EncodePublicKey, or the
+// public half of a PEM private key.
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM key found")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		var priv interface{}
+		if priv, err = x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+			if edPriv, ok := priv.(ed25519.PrivateKey); ok {
+				key = edPriv.Public()
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 key")
+	}
+	return edKey, nil
+}
+
+// Verify checks a result's signature against key.
+func Verify(key ed25519.PublicKey, r model.SpeedtestResult) error {
+	if r.Signature == "" {
+		return ErrUnsigned
+	}
+	sig, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	p, err := Payload(r)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, p, sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Verification outcomes reported by VerifyAll.
+const (
+	StatusValid    = "valid"
+	StatusInvalid  = "invalid"
+	StatusUnsigned = "unsigned"
+)
+
+// Check is the outcome of verifying one result.
+type Check struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Status    string    `json:"status"`          // StatusValid, StatusInvalid or StatusUnsigned
+	Error     string    `json:"error,omitempty"` // Why an invalid result failed
+}
+
+// VerifyAll verifies each result against key.
+func VerifyAll(key ed25519.PublicKey, results []model.SpeedtestResult) []Check {
+	checks := make([]Check, 0, len(results))
+	for _, r := range results {
+		c := Check{ID: r.ID, Timestamp: r.Timestamp, Status: StatusValid}
+		switch err := Verify(key, r); {
+		case errors.Is(err, ErrUnsigned):
+			c.Status = StatusUnsigned
+		case err != nil:
+			c.Status = StatusInvalid
+			c.Error = err.Error()
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// ReadResults reads results as exported: a JSON array such as
+// /api/export/history.json, a single result, or JSON Lines as in archives.
+func ReadResults(r io.Reader) ([]model.SpeedtestResult, error) {
+	dec := json.NewDecoder(r)
+	var out []model.SpeedtestResult
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return out, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if t := bytes.TrimSpace(raw); len(t) > 0 && t[0] == '[' {
+			var list []model.SpeedtestResult
+			if err := json.Unmarshal(raw, &list); err != nil {
+				return nil, err
+			}
+			out = append(out, list...)
+			continue
+		}
+		var res model.SpeedtestResult
+		if err := json.Unmarshal(raw, &res); err != nil {
+			return nil, err
+		}
+		out = append(out, res)
+	}
+}
@@ -0,0 +1,89 @@
+// Package snapshot exports history snapshots to S3-compatible object
+// storage, on request and on a schedule, so backups don't need an
+// intermediate file and a sync job.
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"speedplane/s3"
+	"speedplane/storage"
+)
+
+// Snapshot describes an uploaded snapshot.
+type Snapshot struct {
+	Key     string    `json:"key"`
+	Results int       `json:"results"`
+	Bytes   int       `json:"bytes"`
+	Time    time.Time `json:"time"`
+}
+
+// Exporter writes snapshots of the results in Store and uploads them to a
+// bucket as gzipped JSON Lines objects named
+// <Prefix>history-YYYYMMDDTHHMMSSZ.jsonl.gz.
+type Exporter struct {
+	Store  *storage.Store
+	Client *s3.Client
+	Prefix string // e.g. "backups/speedplane/"
+}
+
+// Export uploads a snapshot of the results within the time range. The
+// snapshot is built in memory, as uploads need its length and checksum.
+func (e *Exporter) Export(ctx context.Context, from, to time.Time) (Snapshot, error) {
+	now := time.Now().UTC()
+	var buf bytes.Buffer
+	n, err := e.Store.WriteSnapshot(ctx, &buf, from, to)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snap := Snapshot{
+		Key:     e.key(now),
+		Results: n,
+		Bytes:   buf.Len(),
+		Time:    now,
+	}
+	if err := e.Client.Put(ctx, snap.Key, "application/gzip", buf.Bytes()); err != nil {
+		return Snapshot{}, err
+	}
+	return snap, nil
+}
+
+func (e *Exporter) key(t time.Time) string {
+	prefix := e.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix + "history-" + t.Format("20060102T150405Z") + ".jsonl.gz"
+}
+
+// Run uploads a snapshot of the whole history every interval, the first
+// after one interval, until ctx is cancelled.
+func (e *Exporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		expCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+		snap, err := e.Export(expCtx, time.Time{}, time.Now().Add(time.Minute))
+		cancel()
+		if err != nil {
+			log.Printf("snapshot: %v", err)
+			continue
+		}
+		log.Printf("snapshot: uploaded %d results to %s", snap.Results, snap.Key)
+	}
+}
+
+// Describe names the bucket and prefix snapshots go to, for logs.
+func (e *Exporter) Describe() string {
+	return fmt.Sprintf("s3://%s/%s", e.Client.Bucket, e.Prefix)
+}
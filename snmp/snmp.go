@@ -0,0 +1,352 @@
+// Package snmp reads interface octet counters from a router with SNMPv2c
+// GET requests, to measure how busy the WAN link is between speedtests.
+package snmp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults used when a Client option is zero.
+const (
+	DefaultPort      = "161"
+	DefaultCommunity = "public"
+	DefaultTimeout   = 2 * time.Second
+	DefaultRetries   = 1
+)
+
+// BER tags used by SNMPv2c messages.
+const (
+	tagInteger        = 0x02
+	tagOctetString    = 0x04
+	tagNull           = 0x05
+	tagOID            = 0x06
+	tagSequence       = 0x30
+	tagCounter32      = 0x41
+	tagGauge32        = 0x42
+	tagTimeTicks      = 0x43
+	tagCounter64      = 0x46
+	tagNoSuchObject   = 0x80
+	tagNoSuchInstance = 0x81
+	tagEndOfMibView   = 0x82
+	tagGetRequest     = 0xa0
+	tagResponse       = 0xa2
+)
+
+const version2c = 1
+
+// Client sends SNMPv2c GET requests to an agent.
+type Client struct {
+	Address   string // host or host:port
+	Community string
+	Timeout   time.Duration // Per attempt
+	Retries   int           // Attempts after the first one times out
+}
+
+// Get reads the numeric values of oids, in dotted form such as
+// "1.3.6.1.2.1.31.1.1.1.6.2".
+func (c *Client) Get(ctx context.Context, oids []string) ([]uint64, error) {
+	address := c.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, DefaultPort)
+	}
+	community := c.Community
+	if community == "" {
+		community = DefaultCommunity
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	retries := c.Retries
+	if retries <= 0 {
+		retries = DefaultRetries
+	}
+
+	var idBytes [4]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return nil, err
+	}
+	requestID := int64(binary.BigEndian.Uint32(idBytes[:]) & 0x7fffffff)
+	req, err := encodeGet(community, requestID, oids)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 65535)
+	for attempt := 0; ; attempt++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(timeout)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		_ = conn.SetReadDeadline(deadline)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				var ne net.Error
+				if errors.As(err, &ne) && ne.Timeout() && attempt < retries && ctx.Err() == nil {
+					break // Send again
+				}
+				if errors.As(err, &ne) && ne.Timeout() {
+					return nil, fmt.Errorf("no response from %s", address)
+				}
+				return nil, err
+			}
+			id, values, err := decodeResponse(buf[:n], len(oids))
+			if err != nil {
+				return nil, err
+			}
+			if id != requestID {
+				continue // A late reply to an earlier attempt
+			}
+			for i, v := range values {
+				if v.err != "" {
+					return nil, fmt.Errorf("%s: %s", oids[i], v.err)
+				}
+			}
+			out := make([]uint64, len(values))
+			for i, v := range values {
+				out[i] = v.num
+			}
+			return out, nil
+		}
+	}
+}
+
+// encodeGet builds a GetRequest message.
+func encodeGet(community string, requestID int64, oids []string) ([]byte, error) {
+	var binds []byte
+	for _, oid := range oids {
+		name, err := encodeOID(oid)
+		if err != nil {
+			return nil, err
+		}
+		binds = append(binds, tlv(tagSequence, append(name, tagNull, 0))...)
+	}
+	pdu := append(encodeInt(requestID), encodeInt(0)...) // error-status
+	pdu = append(pdu, encodeInt(0)...)                   // error-index
+	pdu = append(pdu, tlv(tagSequence, binds)...)
+
+	msg := append(encodeInt(version2c), tlv(tagOctetString, []byte(community))...)
+	msg = append(msg, tlv(tagGetRequest, pdu)...)
+	return tlv(tagSequence, msg), nil
+}
+
+func tlv(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	n := len(content)
+	switch {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, content...)
+}
+
+func encodeInt(v int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+		if (v == 0 && b[0]&0x80 == 0) || (v == -1 && b[0]&0x80 != 0) {
+			break
+		}
+	}
+	return tlv(tagInteger, b)
+}
+
+func encodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid oid %q", oid)
+	}
+	nums := make([]uint64, len(parts))
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oid %q", oid)
+		}
+		nums[i] = n
+	}
+	if nums[0] > 2 || (nums[0] < 2 && nums[1] >= 40) {
+		return nil, fmt.Errorf("invalid oid %q", oid)
+	}
+	b := appendBase128(nil, nums[0]*40+nums[1])
+	for _, n := range nums[2:] {
+		b = appendBase128(b, n)
+	}
+	return tlv(tagOID, b), nil
+}
+
+func appendBase128(b []byte, n uint64) []byte {
+	var tmp []byte
+	for {
+		tmp = append([]byte{byte(n & 0x7f)}, tmp...)
+		n >>= 7
+		if n == 0 {
+			break
+		}
+	}
+	for i := 0; i < len(tmp)-1; i++ {
+		tmp[i] |= 0x80
+	}
+	return append(b, tmp...)
+}
+
+type value struct {
+	num uint64
+	err string // Why the agent had no value, e.g. "no such object"
+}
+
+var errMalformed = errors.New("malformed SNMP response")
+
+// decodeResponse returns the request ID and variable values of a Response
+// message, checking its error status.
+func decodeResponse(b []byte, want int) (int64, []value, error) {
+	msg, err := expect(b, tagSequence)
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, msg, err = next(msg, tagInteger); err != nil { // version
+		return 0, nil, err
+	}
+	if _, msg, err = next(msg, tagOctetString); err != nil { // community
+		return 0, nil, err
+	}
+	pdu, _, err := next(msg, tagResponse)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var fields [3]int64 // request-id, error-status, error-index
+	for i := range fields {
+		var content []byte
+		if content, pdu, err = next(pdu, tagInteger); err != nil {
+			return 0, nil, err
+		}
+		fields[i] = decodeInt(content)
+	}
+	if fields[1] != 0 {
+		return fields[0], nil, fmt.Errorf("agent returned %s for variable %d", errorStatus(fields[1]), fields[2])
+	}
+
+	binds, _, err := next(pdu, tagSequence)
+	if err != nil {
+		return 0, nil, err
+	}
+	var values []value
+	for len(binds) > 0 {
+		var bind []byte
+		if bind, binds, err = next(binds, tagSequence); err != nil {
+			return 0, nil, err
+		}
+		if _, bind, err = next(bind, tagOID); err != nil {
+			return 0, nil, err
+		}
+		if len(bind) < 2 {
+			return 0, nil, errMalformed
+		}
+		tag := bind[0]
+		content, _, err := next(bind, tag)
+		if err != nil {
+			return 0, nil, err
+		}
+		switch tag {
+		case tagInteger, tagCounter32, tagGauge32, tagTimeTicks, tagCounter64:
+			if len(content) > 9 {
+				return 0, nil, errMalformed
+			}
+			var n uint64
+			for _, c := range content {
+				n = n<<8 | uint64(c)
+			}
+			values = append(values, value{num: n})
+		case tagNoSuchObject:
+			values = append(values, value{err: "no such object"})
+		case tagNoSuchInstance:
+			values = append(values, value{err: "no such instance; check the interface index"})
+		case tagEndOfMibView:
+			values = append(values, value{err: "end of MIB view"})
+		default:
+			values = append(values, value{err: fmt.Sprintf("not a number (type 0x%02x)", tag)})
+		}
+	}
+	if len(values) != want {
+		return 0, nil, errMalformed
+	}
+	return fields[0], values, nil
+}
+
+func errorStatus(code int64) string {
+	switch code {
+	case 1:
+		return "tooBig"
+	case 2:
+		return "noSuchName"
+	case 5:
+		return "genErr"
+	case 6:
+		return "noAccess"
+	}
+	return "error " + strconv.FormatInt(code, 10)
+}
+
+// next reads one TLV with the given tag from b, returning its content and
+// the rest of b.
+func next(b []byte, tag byte) (content, rest []byte, err error) {
+	if len(b) < 2 || b[0] != tag {
+		return nil, nil, errMalformed
+	}
+	n, off := int(b[1]), 2
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 3 || len(b) < 2+size {
+			return nil, nil, errMalformed
+		}
+		n = 0
+		for _, c := range b[2 : 2+size] {
+			n = n<<8 | int(c)
+		}
+		off += size
+	}
+	if len(b)-off < n {
+		return nil, nil, errMalformed
+	}
+	return b[off : off+n], b[off+n:], nil
+}
+
+func expect(b []byte, tag byte) ([]byte, error) {
+	content, _, err := next(b, tag)
+	return content, err
+}
+
+func decodeInt(b []byte) int64 {
+	var n int64
+	for i, c := range b {
+		if i == 0 && c&0x80 != 0 {
+			n = -1
+		}
+		n = n<<8 | int64(c)
+	}
+	return n
+}
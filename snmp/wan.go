@@ -0,0 +1,116 @@
+package snmp
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"speedplane/model"
+)
+
+// DefaultInterval is how often a Monitor reads the counters unless told
+// otherwise.
+const DefaultInterval = 30 * time.Second
+
+// IF-MIB columns, indexed by interface.
+const (
+	oidIfHCInOctets  = "1.3.6.1.2.1.31.1.1.1.6."
+	oidIfHCOutOctets = "1.3.6.1.2.1.31.1.1.1.10."
+	oidIfHighSpeed   = "1.3.6.1.2.1.31.1.1.1.15."
+)
+
+// Monitor turns a router's WAN interface counters into utilization samples.
+type Monitor struct {
+	Client     *Client
+	IfIndex    int    // ifIndex of the WAN interface
+	Connection string // Set on every sample
+	// Capacity returns the connection's download and upload capacity in Mbps
+	// at t, e.g. from the ISP plan. Where it returns 0, the interface's
+	// ifHighSpeed is used.
+	Capacity func(t time.Time) (downloadMbps, uploadMbps float64)
+}
+
+// counters is one read of the interface.
+type counters struct {
+	at          time.Time
+	in, out     uint64
+	ifSpeedMbps float64
+	hasReading  bool
+}
+
+// Run reads the counters every interval until ctx is cancelled, passing a
+// sample covering each interval to save. Failed reads are passed on with
+// Error set, and the next interval starts after the next successful read.
+func (m *Monitor) Run(ctx context.Context, interval time.Duration, save func(model.WANUtilization)) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var prev counters
+	for {
+		cur, err := m.read(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		switch {
+		case err != nil:
+			save(model.WANUtilization{Timestamp: time.Now().UTC(), Connection: m.Connection, Error: err.Error()})
+			prev = counters{}
+		case prev.hasReading && cur.in >= prev.in && cur.out >= prev.out:
+			save(m.sample(prev, cur))
+			prev = cur
+		default:
+			// First read, or the counters were reset, e.g. by a router reboot
+			prev = cur
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Monitor) read(ctx context.Context) (counters, error) {
+	idx := strconv.Itoa(m.IfIndex)
+	v, err := m.Client.Get(ctx, []string{oidIfHCInOctets + idx, oidIfHCOutOctets + idx, oidIfHighSpeed + idx})
+	if err != nil {
+		return counters{}, err
+	}
+	return counters{at: time.Now(), in: v[0], out: v[1], ifSpeedMbps: float64(v[2]), hasReading: true}, nil
+}
+
+func (m *Monitor) sample(prev, cur counters) model.WANUtilization {
+	secs := cur.at.Sub(prev.at).Seconds()
+	u := model.WANUtilization{
+		Timestamp:    cur.at.UTC(),
+		Connection:   m.Connection,
+		DownloadMbps: round(float64(cur.in-prev.in) * 8 / secs / 1e6),
+		UploadMbps:   round(float64(cur.out-prev.out) * 8 / secs / 1e6),
+	}
+	var down, up float64
+	if m.Capacity != nil {
+		down, up = m.Capacity(cur.at)
+	}
+	if down <= 0 {
+		down = cur.ifSpeedMbps
+	}
+	if up <= 0 {
+		up = cur.ifSpeedMbps
+	}
+	if down > 0 {
+		pct := round(u.DownloadMbps / down * 100)
+		u.DownloadPct = &pct
+	}
+	if up > 0 {
+		pct := round(u.UploadMbps / up * 100)
+		u.UploadPct = &pct
+	}
+	return u
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
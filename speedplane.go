@@ -0,0 +1,225 @@
+// Package speedplane runs a speedplane server: the scheduler and speedtest
+// engines, the results database, the monitors and integrations fed by them,
+// and the dashboard and API. The speedplane command is a thin wrapper around
+// it, and other programs can embed a server the same way:
+//
+//	cfg, err := config.Load("/var/lib/speedplane")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	log.Fatal(speedplane.Run(ctx, cfg, speedplane.Options{}))
+//
+// To serve the dashboard from a program's own HTTP server instead, create
+// the server with New, call Start and mount Handler, e.g. under a prefix
+// with http.StripPrefix.
+package speedplane
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"speedplane/api"
+	"speedplane/config"
+	"speedplane/scheduler"
+	"speedplane/storage"
+)
+
+// Version is the speedplane release.
+const Version = "1.1.39"
+
+//go:embed templates
+var templatesFS embed.FS
+
+//go:embed web/dist
+var staticFS embed.FS
+
+// Options are a server's settings that don't come from its config file.
+type Options struct {
+	// Demo serves generated history and returns synthetic results instead
+	// of running real speedtests. Give it a database of its own with
+	// DBPath, as the history is added to whatever is there.
+	Demo bool
+	// DBPath overrides the config's db_path without it being saved to the
+	// config file.
+	DBPath string
+}
+
+// Server is a speedplane instance, created with New.
+type Server struct {
+	cfg      *config.Config
+	store    *storage.Store
+	sched    *scheduler.Scheduler
+	api      *api.Server
+	batch    *storage.BatchWriter
+	mux      http.Handler
+	adminMux http.Handler // mux unless admin endpoints have a listener of their own
+
+	start        []func(ctx context.Context)       // Background work, see Start
+	flush        []func(ctx context.Context) error // Sends of the last runs, see Shutdown
+	started      bool
+	startOnce    sync.Once
+	shutdownOnce sync.Once
+}
+
+// Run serves cfg on its configured listeners until ctx is done, then shuts
+// down gracefully.
+func Run(ctx context.Context, cfg config.Config, opts Options) error {
+	s, err := New(cfg, opts)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.Serve(ctx)
+}
+
+// Handler returns the dashboard and API. It includes the admin endpoints
+// unless the config gives them a listener of their own (admin_listen_addr).
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// AdminHandler returns the admin endpoints, /metrics and /api/admin/*. It is
+// the same as Handler unless the config gives them a listener of their own.
+func (s *Server) AdminHandler() http.Handler {
+	return s.adminMux
+}
+
+// Store returns the results database.
+func (s *Server) Store() *storage.Store {
+	return s.store
+}
+
+// Scheduler returns the scheduler running the server's speedtests.
+func (s *Server) Scheduler() *scheduler.Scheduler {
+	return s.sched
+}
+
+// Start starts the scheduler and the background monitors and jobs the config
+// enables. They run until ctx is done. Only the first call has an effect.
+func (s *Server) Start(ctx context.Context) {
+	s.startOnce.Do(func() {
+		for _, f := range s.start {
+			f(ctx)
+		}
+		s.started = true
+	})
+}
+
+// Serve starts the server and serves Handler and AdminHandler on the
+// configured listeners until ctx is done or a listener fails, then shuts
+// down gracefully. It doesn't close the database; see Close.
+func (s *Server) Serve(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	addrs := s.cfg.ListenAddresses()
+	listeners, err := listenAll(addrs, s.cfg.SocketMode)
+	if err != nil {
+		return fmt.Errorf("http server: %w", err)
+	}
+	var adminListener net.Listener
+	if s.cfg.AdminListenAddr != "" {
+		if adminListener, err = openListener(s.cfg.AdminListenAddr, s.cfg.SocketMode); err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return fmt.Errorf("admin server: listen on %s: %w", s.cfg.AdminListenAddr, err)
+		}
+	}
+
+	s.Start(ctx)
+
+	// Print listening addresses
+	printListeningAddresses(addrs)
+
+	// Requests still running when the graceful shutdown times out are
+	// cancelled, abandoning their database queries
+	reqCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	baseContext := func(net.Listener) context.Context { return reqCtx }
+
+	errc := make(chan error, len(listeners)+1)
+	srv := &http.Server{
+		Handler:     s.mux,
+		BaseContext: baseContext,
+	}
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+				errc <- fmt.Errorf("http server: %w", err)
+			}
+		}(l)
+	}
+
+	var adminSrv *http.Server
+	if adminListener != nil {
+		adminSrv = &http.Server{Handler: s.adminMux, BaseContext: baseContext}
+		log.Printf("admin endpoints on %s", s.cfg.AdminListenAddr)
+		go func() {
+			if err := adminSrv.Serve(adminListener); err != nil && err != http.ErrServerClosed {
+				errc <- fmt.Errorf("admin server: %w", err)
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+	case err = <-errc:
+		log.Printf("%v", err)
+	}
+	log.Println("shutting down...")
+	s.Shutdown()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown: %v", err)
+	}
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("admin server shutdown: %v", err)
+		}
+	}
+	return err
+}
+
+// Shutdown stops accepting runs, waits up to the configured drain timeout
+// for a scheduled speedtest that is already underway to finish and be
+// saved and, within what is left of it, for queued events, notifications
+// and integration sends to go out. It then disconnects WebSocket clients
+// and flushes buffered writes. Serve calls it; programs serving Handler
+// themselves call it before shutting their HTTP server down.
+func (s *Server) Shutdown() {
+	s.shutdownOnce.Do(func() {
+		s.api.BeginShutdown()
+		if s.started {
+			drainTimeout := s.cfg.DrainDuration()
+			ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+			defer cancel()
+			log.Printf("waiting up to %s for in-flight speedtests...", drainTimeout)
+			if err := s.sched.Drain(drainTimeout); err != nil {
+				log.Printf("%v", err)
+			}
+			for _, f := range s.flush {
+				if err := f(ctx); err != nil {
+					log.Printf("%v", err)
+				}
+			}
+		}
+		s.api.CloseWebSockets()
+		s.batch.Close()
+	})
+}
+
+// Close shuts the server down if that hasn't happened yet and closes the
+// database. Cancel Start's context first, so background jobs stop using it.
+func (s *Server) Close() error {
+	s.Shutdown()
+	return s.store.Close()
+}
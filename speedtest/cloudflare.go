@@ -0,0 +1,377 @@
+package speedtest
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"speedplane/model"
+)
+
+// Cloudflare test settings, close to what its browser test does.
+const (
+	cloudflareHost     = "speed.cloudflare.com"
+	cloudflareURL      = "https://" + cloudflareHost
+	cloudflareStreams  = 6
+	cloudflarePings    = 20
+	cloudflareRampUp   = 2 * time.Second // Left out of the throughput while TCP ramps up
+	cloudflareDownload = 25 << 20        // Bytes per download request
+	cloudflareUpload   = 10 << 20        // Bytes per upload request
+)
+
+// cloudflareMeta is what speed.cloudflare.com/meta reports about the client
+// and the data center serving it.
+type cloudflareMeta struct {
+	ClientIP       string `json:"clientIp"`
+	ASOrganization string `json:"asOrganization"`
+	Colo           string `json:"colo"`
+	City           string `json:"city"`
+	Country        string `json:"country"`
+}
+
+// RunCloudflareFrom is like RunFrom, but tests against speed.cloudflare.com,
+// the service behind Cloudflare's browser speed test, in the nearest
+// Cloudflare data center instead of an Ookla server.
+func (r *Runner) RunCloudflareFrom(ctx context.Context, source string, progress func(stage string, message string)) (*model.SpeedtestResult, error) {
+	if progress == nil {
+		progress = func(_ string, _ string) {}
+	}
+
+	progress("init", "Starting speedtest...")
+	// As with Ookla, a failed phase leaves its measurements at zero
+	var phases phaseLog
+	phases.begin()
+	client, err := cloudflareClient(source)
+	if err != nil {
+		return nil, err
+	}
+
+	progress("user", "Fetching user info...")
+	var meta cloudflareMeta
+	if err := getJSON(ctx, client, cloudflareURL+"/meta", &meta); err != nil {
+		return nil, fmt.Errorf("fetch user info: %w", err)
+	}
+	progress("user", fmt.Sprintf("Connected from %s (%s)", meta.ClientIP, meta.ASOrganization))
+	progress("servers", fmt.Sprintf("Selected server: Cloudflare %s (%s)", meta.City, meta.Colo))
+	phases.selected()
+	serverErr := func(err error) error {
+		return &ServerError{Engine: model.EngineCloudflare, ServerID: meta.Colo, ServerName: meta.City, Err: err}
+	}
+
+	link, health, mtu := r.localChecks(ctx, source, cloudflareHost+":443", progress)
+
+	var pingMs, jitterMs float64
+	if phases.run(ctx, PhasePing, func() error {
+		progress("ping", "Testing ping and latency...")
+		pingMs, jitterMs, err = cloudflarePing(ctx, client)
+		return err
+	}) {
+		progress("ping", fmt.Sprintf("Ping: %.1f ms, Jitter: %.1f ms", pingMs, jitterMs))
+	}
+
+	var downBytesPerSec float64
+	if phases.run(ctx, PhaseDownload, func() error {
+		progress("download", "Testing download speed...")
+		stop := reportPercent(progress, "download", "Downloading")
+		defer stop()
+		downBytesPerSec, err = cloudflareTransfer(ctx, func(ctx context.Context, n *atomic.Int64) error {
+			return cloudflareGet(ctx, client, n)
+		})
+		return err
+	}) {
+		progress("download", fmt.Sprintf("Download: %.2f Mbps", downBytesPerSec*8/1e6))
+	}
+	downloadMbps := downBytesPerSec * 8 / 1e6
+
+	var upBytesPerSec float64
+	if phases.run(ctx, PhaseUpload, func() error {
+		progress("upload", "Testing upload speed...")
+		stop := reportPercent(progress, "upload", "Uploading")
+		defer stop()
+		upBytesPerSec, err = cloudflareTransfer(ctx, func(ctx context.Context, n *atomic.Int64) error {
+			return cloudflarePost(ctx, client, n)
+		})
+		return err
+	}) {
+		progress("upload", fmt.Sprintf("Upload: %.2f Mbps", upBytesPerSec*8/1e6))
+	}
+	uploadMbps := upBytesPerSec * 8 / 1e6
+
+	partial, err := phases.result(ctx)
+	if err != nil {
+		return nil, serverErr(err)
+	}
+	if partial != nil {
+		log.Printf("[speedtest] Keeping partial result after %v", phases.err)
+	}
+
+	progress("processing", "Processing results...")
+
+	var lan *model.LANHealth
+	if health != nil {
+		lan = health.End()
+	}
+
+	log.Printf("[speedtest] Cloudflare %s (%s) - Download: %.2f Mbps, Upload: %.2f Mbps, Ping: %.2f ms, Jitter: %.2f ms",
+		meta.City, meta.Colo, downloadMbps, uploadMbps, pingMs, jitterMs)
+
+	// Same shape as the Ookla engine's raw output, so exports line up
+	rawJSON, err := json.Marshal(map[string]interface{}{
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"ping": map[string]interface{}{
+			"latency": pingMs,
+			"jitter":  jitterMs,
+		},
+		"download": map[string]interface{}{
+			"bandwidth": downBytesPerSec,
+		},
+		"upload": map[string]interface{}{
+			"bandwidth": upBytesPerSec,
+		},
+		"isp": meta.ASOrganization,
+		"interface": map[string]interface{}{
+			"externalIp": meta.ClientIP,
+		},
+		"server": map[string]interface{}{
+			"id":       meta.Colo,
+			"name":     meta.City,
+			"location": fmt.Sprintf("%s, %s", meta.City, meta.Country),
+			"country":  meta.Country,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal result json: %w", err)
+	}
+
+	return &model.SpeedtestResult{
+		ID:            model.NewID(),
+		Timestamp:     time.Now().UTC(),
+		DownloadMbps:  downloadMbps,
+		UploadMbps:    uploadMbps,
+		PingMs:        pingMs,
+		JitterMs:      jitterMs,
+		ISP:           meta.ASOrganization,
+		ExternalIP:    meta.ClientIP,
+		ServerID:      meta.Colo,
+		ServerName:    meta.City,
+		ServerCountry: meta.Country,
+		Engine:        model.EngineCloudflare,
+		Link:          link,
+		LAN:           lan,
+		PathMTU:       mtu,
+		Phases:        partial,
+		Timings:       phases.timings(),
+		RawJSON:       rawJSON,
+	}, nil
+}
+
+// cloudflareClient returns a client bound to source, when set, that opens a
+// TCP connection per stream instead of multiplexing them over HTTP/2.
+func cloudflareClient(source string) (*http.Client, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if source != "" {
+		ip := net.ParseIP(source)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source address %q", source)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	return &http.Client{Transport: &http.Transport{
+		DialContext:         dialer.DialContext,
+		DisableCompression:  true,
+		MaxIdleConnsPerHost: cloudflareStreams,
+		TLSNextProto:        map[string]func(string, *tls.Conn) http.RoundTripper{},
+	}}, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(v)
+}
+
+// cloudflarePing times empty downloads over one kept-alive connection and
+// returns the median round-trip time and the mean difference between
+// consecutive ones, in milliseconds. The time the server reports spending
+// on each request is subtracted.
+func cloudflarePing(ctx context.Context, client *http.Client) (pingMs, jitterMs float64, err error) {
+	var rtts []float64
+	for i := 0; i < cloudflarePings; i++ {
+		var wrote, firstByte time.Time
+		trace := &httptrace.ClientTrace{
+			WroteRequest:         func(httptrace.WroteRequestInfo) { wrote = time.Now() },
+			GotFirstResponseByte: func() { firstByte = time.Now() },
+		}
+		req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, cloudflareURL+"/__down?bytes=0", nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, 0, err
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return 0, 0, fmt.Errorf("server returned %s", resp.Status)
+		}
+		if wrote.IsZero() || firstByte.IsZero() {
+			continue
+		}
+		rtt := float64(firstByte.Sub(wrote).Microseconds())/1000 - serverTimingMs(resp.Header.Get("Server-Timing"))
+		rtts = append(rtts, max(rtt, 0))
+	}
+	if len(rtts) == 0 {
+		return 0, 0, errors.New("no round-trip times measured")
+	}
+
+	var diffs float64
+	for i := 1; i < len(rtts); i++ {
+		d := rtts[i] - rtts[i-1]
+		if d < 0 {
+			d = -d
+		}
+		diffs += d
+	}
+	if len(rtts) > 1 {
+		jitterMs = diffs / float64(len(rtts)-1)
+	}
+	sort.Float64s(rtts)
+	return rtts[len(rtts)/2], jitterMs, nil
+}
+
+// serverTimingMs returns the duration in a Server-Timing header such as
+// "cfRequestDuration;dur=12.3", or 0.
+func serverTimingMs(header string) float64 {
+	for _, part := range strings.Split(header, ";") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(part), "dur="); ok {
+			if ms, err := strconv.ParseFloat(v, 64); err == nil {
+				return ms
+			}
+		}
+	}
+	return 0
+}
+
+// cloudflareTransfer runs transfer in parallel streams for transferDuration
+// and returns the throughput in bytes per second after the ramp-up.
+func cloudflareTransfer(ctx context.Context, transfer func(ctx context.Context, n *atomic.Int64) error) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, transferDuration)
+	defer cancel()
+
+	var n atomic.Int64
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var streamErr error
+	for i := 0; i < cloudflareStreams; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if err := transfer(ctx, &n); err != nil {
+					if ctx.Err() == nil {
+						errOnce.Do(func() { streamErr = err })
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	var start time.Time
+	var before int64
+	select {
+	case <-ctx.Done():
+	case <-time.After(cloudflareRampUp):
+		start, before = time.Now(), n.Load()
+	}
+	wg.Wait()
+	if err := context.Cause(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return 0, err
+	}
+	if start.IsZero() || n.Load() == before {
+		if streamErr == nil {
+			streamErr = errors.New("no data transferred")
+		}
+		return 0, streamErr
+	}
+	return float64(n.Load()-before) / time.Since(start).Seconds(), nil
+}
+
+func cloudflareGet(ctx context.Context, client *http.Client, n *atomic.Int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cloudflareURL+"/__down?bytes="+strconv.Itoa(cloudflareDownload), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	_, err = io.Copy(io.Discard, &countingReader{r: resp.Body, n: n})
+	return err
+}
+
+func cloudflarePost(ctx context.Context, client *http.Client, n *atomic.Int64) error {
+	body := &countingReader{r: io.LimitReader(zeros{}, cloudflareUpload), n: n}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cloudflareURL+"/__up", body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = cloudflareUpload
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,186 @@
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+
+	"speedplane/model"
+)
+
+// ErrMockFailure is returned by MockRunner for runs it is configured to fail.
+var ErrMockFailure = errors.New("mock: simulated speedtest failure")
+
+// Values MockRunner reports when none are configured.
+const (
+	DefaultMockDownloadMbps = 100
+	DefaultMockUploadMbps   = 20
+	DefaultMockPingMs       = 10
+)
+
+// mockStages are the progress stages a MockRunner run reports, in order.
+var mockStages = []struct{ name, message string }{
+	{"init", "Starting speedtest..."},
+	{"user", "Fetching user info..."},
+	{"servers", "Fetching server list..."},
+	{"ping", "Testing ping and latency..."},
+	{"download", "Testing download speed..."},
+	{"upload", "Testing upload speed..."},
+	{"processing", "Processing results..."},
+}
+
+// MockRunner stands in for Runner without contacting any speedtest server,
+// so the scheduler, storage and API can be exercised in integration tests
+// and packaging checks. Its results are deterministic: fixed values, or
+// values varied by a random source seeded with Seed. Configure it before the
+// first run.
+type MockRunner struct {
+	DownloadMbps  float64 // Defaults to DefaultMockDownloadMbps
+	UploadMbps    float64 // Defaults to DefaultMockUploadMbps
+	PingMs        float64 // Defaults to DefaultMockPingMs
+	JitterMs      float64
+	PacketLossPct float64
+
+	Spread    float64       // Vary each value by up to ± this fraction (0-1); 0 reports the values as is
+	Seed      int64         // Seeds the variation and random failures
+	Delay     time.Duration // How long a run takes, spread over its progress stages
+	FailEvery int           // Fail every Nth run; 0 never fails on a count
+	FailRate  float64       // Fail this share of runs (0-1) at random
+	FailPhase string        // Phase failing runs fail in, keeping the others as a partial result; empty fails the whole run
+
+	mu   sync.Mutex
+	rng  *rand.Rand
+	runs int
+}
+
+// Run returns a mock result, or ErrMockFailure for a run set up to fail.
+func (m *MockRunner) Run(ctx context.Context) (*model.SpeedtestResult, error) {
+	return m.RunFrom(ctx, "", nil)
+}
+
+// RunWithProgress is like Run and reports the same progress stages as a real
+// test.
+func (m *MockRunner) RunWithProgress(ctx context.Context, progress func(stage string, message string)) (*model.SpeedtestResult, error) {
+	return m.RunFrom(ctx, "", progress)
+}
+
+// RunFrom is like RunWithProgress; source is ignored.
+func (m *MockRunner) RunFrom(ctx context.Context, source string, progress func(stage string, message string)) (*model.SpeedtestResult, error) {
+	if progress == nil {
+		progress = func(_ string, _ string) {}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Decide the outcome up front, so results don't depend on timing.
+	m.mu.Lock()
+	if m.rng == nil {
+		m.rng = rand.New(rand.NewSource(m.Seed))
+	}
+	m.runs++
+	fail := m.FailEvery > 0 && m.runs%m.FailEvery == 0
+	if m.FailRate > 0 && m.rng.Float64() < m.FailRate {
+		fail = true
+	}
+	vary := func(v float64) float64 {
+		if m.Spread <= 0 {
+			return v
+		}
+		return v * (1 + (m.rng.Float64()*2-1)*m.Spread)
+	}
+	res := &model.SpeedtestResult{
+		ID:            model.NewID(),
+		DownloadMbps:  vary(orDefault(m.DownloadMbps, DefaultMockDownloadMbps)),
+		UploadMbps:    vary(orDefault(m.UploadMbps, DefaultMockUploadMbps)),
+		PingMs:        vary(orDefault(m.PingMs, DefaultMockPingMs)),
+		JitterMs:      vary(m.JitterMs),
+		PacketLossPct: vary(m.PacketLossPct),
+		ISP:           "Mock ISP",
+		ExternalIP:    "192.0.2.1",
+		ServerID:      "mock",
+		ServerName:    "Mock Server",
+		ServerCountry: "Mockland",
+	}
+	m.mu.Unlock()
+
+	var phases phaseLog
+	phases.begin()
+	step := m.Delay / time.Duration(len(mockStages))
+	if !runsPhase(ctx, PhasePing) {
+		res.PingMs, res.JitterMs, res.PacketLossPct = 0, 0, 0
+	}
+	if !runsPhase(ctx, PhaseDownload) {
+		res.DownloadMbps = 0
+	}
+	if !runsPhase(ctx, PhaseUpload) {
+		res.UploadMbps = 0
+	}
+
+	for _, s := range mockStages {
+		if s.name == "ping" && fail && m.FailPhase == "" && runsPhase(ctx, PhasePing) {
+			progress(s.name, s.message)
+			return nil, fmt.Errorf("ping test: %w", ErrMockFailure)
+		}
+		if slices.Contains(Phases, s.name) {
+			if s.name == PhasePing {
+				phases.selected()
+			}
+			phases.run(ctx, s.name, func() error {
+				progress(s.name, s.message)
+				if fail && s.name == m.FailPhase {
+					return ErrMockFailure
+				}
+				return mockWait(ctx, step)
+			})
+			continue
+		}
+		progress(s.name, s.message)
+		if err := mockWait(ctx, step); err != nil {
+			return nil, err
+		}
+	}
+
+	partial, err := phases.result(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if partial[PhasePing].Status == model.PhaseFailed {
+		res.PingMs, res.JitterMs, res.PacketLossPct = 0, 0, 0
+	}
+	if partial[PhaseDownload].Status == model.PhaseFailed {
+		res.DownloadMbps = 0
+	}
+	if partial[PhaseUpload].Status == model.PhaseFailed {
+		res.UploadMbps = 0
+	}
+	res.Phases = partial
+	res.Timings = phases.timings()
+
+	res.Timestamp = time.Now().UTC()
+	return res, nil
+}
+
+func orDefault(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// mockWait waits for d, or until ctx is done.
+func mockWait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,50 @@
+package speedtest
+
+import (
+	"context"
+	"slices"
+)
+
+// Phases of a test, in the order they run.
+const (
+	PhasePing     = "ping"
+	PhaseDownload = "download"
+	PhaseUpload   = "upload"
+)
+
+// Phases lists every phase; a test runs all of them unless WithPhases
+// selects fewer.
+var Phases = []string{PhasePing, PhaseDownload, PhaseUpload}
+
+type serverKey struct{}
+
+// WithServer returns a copy of ctx that has the Ookla engine test against the
+// server with id instead of the closest one. Other engines ignore it.
+func WithServer(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, serverKey{}, id)
+}
+
+func serverOption(ctx context.Context) string {
+	id, _ := ctx.Value(serverKey{}).(string)
+	return id
+}
+
+type phasesKey struct{}
+
+// WithPhases returns a copy of ctx whose test only runs the given phases;
+// the measurements of the others are left at zero. Empty means all of them.
+func WithPhases(ctx context.Context, phases []string) context.Context {
+	if len(phases) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, phasesKey{}, phases)
+}
+
+// runsPhase reports whether the test ctx belongs to runs phase.
+func runsPhase(ctx context.Context, phase string) bool {
+	phases, _ := ctx.Value(phasesKey{}).([]string)
+	return len(phases) == 0 || slices.Contains(phases, phase)
+}
@@ -0,0 +1,82 @@
+package speedtest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"speedplane/model"
+)
+
+// phaseLog records how the phases of a test went, so that a test whose
+// upload fails still returns the ping and download it measured, and how
+// long they took.
+type phaseLog struct {
+	start     time.Time // When the test started, set by begin
+	selection time.Duration
+	statuses  map[string]model.PhaseStatus
+	durations map[string]time.Duration
+	err       error // Of the first phase that failed
+	ok        int
+}
+
+// begin marks the start of the test, before server selection.
+func (l *phaseLog) begin() {
+	l.start = time.Now()
+}
+
+// selected marks the end of server selection.
+func (l *phaseLog) selected() {
+	l.selection = time.Since(l.start)
+}
+
+// run runs phase with fn unless ctx skips it, and reports whether it ran
+// and succeeded.
+func (l *phaseLog) run(ctx context.Context, phase string, fn func() error) bool {
+	if l.statuses == nil {
+		l.statuses = make(map[string]model.PhaseStatus, len(Phases))
+		l.durations = make(map[string]time.Duration, len(Phases))
+	}
+	if !runsPhase(ctx, phase) {
+		l.statuses[phase] = model.PhaseStatus{Status: model.PhaseSkipped}
+		return false
+	}
+	start := time.Now()
+	err := fn()
+	l.durations[phase] = time.Since(start)
+	if err != nil {
+		l.statuses[phase] = model.PhaseStatus{Status: model.PhaseFailed, Error: err.Error()}
+		if l.err == nil {
+			l.err = fmt.Errorf("%s test: %w", phase, err)
+		}
+		return false
+	}
+	l.statuses[phase] = model.PhaseStatus{Status: model.PhaseOK}
+	l.ok++
+	return true
+}
+
+// result returns the statuses to store with a partial result, nil when no
+// phase failed. When nothing was measured or the test was canceled, it
+// returns the first phase's error instead.
+func (l *phaseLog) result(ctx context.Context) (map[string]model.PhaseStatus, error) {
+	if l.err == nil {
+		return nil, nil
+	}
+	if l.ok == 0 || ctx.Err() != nil {
+		return nil, l.err
+	}
+	return l.statuses, nil
+}
+
+// timings returns how long server selection, each phase and the whole test
+// so far took.
+func (l *phaseLog) timings() *model.PhaseTimings {
+	return &model.PhaseTimings{
+		ServerSelectionMs: l.selection.Milliseconds(),
+		PingMs:            l.durations[PhasePing].Milliseconds(),
+		DownloadMs:        l.durations[PhaseDownload].Milliseconds(),
+		UploadMs:          l.durations[PhaseUpload].Milliseconds(),
+		TotalMs:           time.Since(l.start).Milliseconds(),
+	}
+}
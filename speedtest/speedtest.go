@@ -7,23 +7,84 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
+	"slices"
 	"time"
 
 	st "github.com/showwin/speedtest-go/speedtest"
 
 	"speedplane/model"
+	"speedplane/netinfo"
+	"speedplane/probe"
 )
 
+// transferDuration is how long the download and upload tests each run.
+const transferDuration = 15 * time.Second
+
+// Engine runs a speed test from the local address source, empty for the
+// default route, reporting progress as it goes. Runner, MockRunner and
+// engine plugins implement it, and speedplane picks one by engine name for
+// each run.
+type Engine interface {
+	RunFrom(ctx context.Context, source string, progress func(stage string, message string)) (*model.SpeedtestResult, error)
+}
+
+// EngineFunc adapts a function to the Engine interface.
+type EngineFunc func(ctx context.Context, source string, progress func(stage string, message string)) (*model.SpeedtestResult, error)
+
+// RunFrom calls f(ctx, source, progress).
+func (f EngineFunc) RunFrom(ctx context.Context, source string, progress func(stage string, message string)) (*model.SpeedtestResult, error) {
+	return f(ctx, source, progress)
+}
+
 // Runner executes speed tests and returns results.
 // Note: A fresh speedtest client is created for each run to prevent memory leaks.
 // The speedtest-go library accumulates internal buffers when reusing clients.
-type Runner struct{}
+type Runner struct {
+	health  *netinfo.HealthCheck
+	mtuMax  int                                // Largest MTU tried by the path MTU probe; 0 disables it
+	exclude func(ctx context.Context) []string // IDs of Ookla servers to avoid
+}
+
+// ServerError is returned by a run that failed after selecting its test
+// server, so the failure can be held against the server.
+type ServerError struct {
+	Engine     string
+	ServerID   string
+	ServerName string
+	Err        error
+}
+
+func (e *ServerError) Error() string { return e.Err.Error() }
+
+func (e *ServerError) Unwrap() error { return e.Err }
 
 // NewRunner creates a new speedtest runner instance.
 func NewRunner() *Runner {
 	return &Runner{}
 }
 
+// SetHealthCheck enables a gateway, DNS and interface check around each test,
+// attached to results as LAN. Pass nil to disable it. Call before running tests.
+func (r *Runner) SetHealthCheck(h *netinfo.HealthCheck) {
+	r.health = h
+}
+
+// SetPathMTU enables a path MTU probe to the test server before each test,
+// trying packets of up to max bytes, attached to results as PathMTU. Pass 0
+// to disable it. Call before running tests.
+func (r *Runner) SetPathMTU(max int) {
+	r.mtuMax = max
+}
+
+// SetExcludedServers sets a function returning the IDs of Ookla servers to
+// skip when selecting the closest one, called before each run with its
+// context. When every server is excluded the closest is used anyway. Call
+// before running tests.
+func (r *Runner) SetExcludedServers(exclude func(ctx context.Context) []string) {
+	r.exclude = exclude
+}
+
 // Run executes a complete speed test including ping, download, and upload tests.
 // It returns a SpeedtestResult with all the test metrics.
 func (r *Runner) Run(ctx context.Context) (*model.SpeedtestResult, error) {
@@ -33,15 +94,32 @@ func (r *Runner) Run(ctx context.Context) (*model.SpeedtestResult, error) {
 // RunWithProgress executes a speed test with progress callbacks.
 // If progress is nil, it behaves like Run().
 func (r *Runner) RunWithProgress(ctx context.Context, progress func(stage string, message string)) (*model.SpeedtestResult, error) {
+	return r.RunFrom(ctx, "", progress)
+}
+
+// RunFrom is like RunWithProgress, but binds the test's connections to the
+// local source address, so it runs over the WAN link that address belongs
+// to. An empty source lets the routing table choose.
+func (r *Runner) RunFrom(ctx context.Context, source string, progress func(stage string, message string)) (*model.SpeedtestResult, error) {
 	if progress == nil {
 		progress = func(_ string, _ string) {}
 	}
 
 	progress("init", "Starting speedtest...")
 
+	// A failed phase doesn't end the test: its measurements stay at zero
+	// and the others are kept, marked as partial.
+	var phases phaseLog
+	phases.begin()
+
 	// Create a fresh client for each speedtest run to prevent memory leaks.
 	// The speedtest-go library accumulates buffers internally when clients are reused.
-	client := st.New()
+	var opts []st.Option
+	if source != "" {
+		opts = append(opts, st.WithUserConfig(&st.UserConfig{Source: source}))
+	}
+	client := st.New(opts...)
+	client.SetCaptureTime(transferDuration)
 
 	// Fetch user info
 	progress("user", "Fetching user info...")
@@ -62,44 +140,79 @@ func (r *Runner) RunWithProgress(ctx context.Context, progress func(stage string
 		return nil, fmt.Errorf("no servers available")
 	}
 
-	progress("servers", fmt.Sprintf("Found %d servers, selecting closest...", len(servers)))
-	// Select the first server (closest by default)
-	target := servers[0]
+	var target *st.Server
+	if id := serverOption(ctx); id != "" {
+		// A server asked for by ID may not be among the closest listed
+		progress("servers", fmt.Sprintf("Found %d servers, selecting %s...", len(servers), id))
+		if target, err = findServer(ctx, client, servers, id); err != nil {
+			return nil, err
+		}
+	} else {
+		progress("servers", fmt.Sprintf("Found %d servers, selecting closest...", len(servers)))
+		// Select the first server (closest by default) that isn't excluded
+		target = r.selectServer(ctx, servers)
+	}
 	progress("servers", fmt.Sprintf("Selected server: %s (%s)", target.Name, target.Country))
+	phases.selected()
+	serverErr := func(err error) error {
+		return &ServerError{Engine: model.EngineOokla, ServerID: target.ID, ServerName: target.Name, Err: err}
+	}
+
+	link, health, mtu := r.localChecks(ctx, source, target.Host, progress)
 
 	// Test ping/latency
-	progress("ping", "Testing ping and latency...")
-	err = target.PingTestContext(ctx, nil)
-	if err != nil {
-		return nil, fmt.Errorf("ping test: %w", err)
+	var pingMs, jitterMs float64
+	if phases.run(ctx, PhasePing, func() error {
+		progress("ping", "Testing ping and latency...")
+		return target.PingTestContext(ctx, nil)
+	}) {
+		// Convert latency from Duration to milliseconds
+		pingMs = target.Latency.Seconds() * 1000.0
+		jitterMs = target.Jitter.Seconds() * 1000.0
+		progress("ping", fmt.Sprintf("Ping: %.1f ms, Jitter: %.1f ms", pingMs, jitterMs))
 	}
-	// Convert latency from Duration to milliseconds
-	pingMs := target.Latency.Seconds() * 1000.0
-	jitterMs := target.Jitter.Seconds() * 1000.0
-	progress("ping", fmt.Sprintf("Ping: %.1f ms, Jitter: %.1f ms", pingMs, jitterMs))
 
 	// Test download
-	progress("download", "Testing download speed...")
-	err = target.DownloadTestContext(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("download test: %w", err)
+	var downloadMbps float64
+	if phases.run(ctx, PhaseDownload, func() error {
+		progress("download", "Testing download speed...")
+		stop := reportPercent(progress, "download", "Downloading")
+		defer stop()
+		return target.DownloadTestContext(ctx)
+	}) {
+		// Convert results using the library's Mbps() method
+		// ByteRate represents bits per second, and Mbps() converts to Mbps
+		downloadMbps = target.DLSpeed.Mbps()
+		progress("download", fmt.Sprintf("Download: %.2f Mbps", downloadMbps))
 	}
-	// Convert results using the library's Mbps() method
-	// ByteRate represents bits per second, and Mbps() converts to Mbps
-	downloadMbps := target.DLSpeed.Mbps()
-	progress("download", fmt.Sprintf("Download: %.2f Mbps", downloadMbps))
 
 	// Test upload
-	progress("upload", "Testing upload speed...")
-	err = target.UploadTestContext(ctx)
+	var uploadMbps float64
+	if phases.run(ctx, PhaseUpload, func() error {
+		progress("upload", "Testing upload speed...")
+		stop := reportPercent(progress, "upload", "Uploading")
+		defer stop()
+		return target.UploadTestContext(ctx)
+	}) {
+		uploadMbps = target.ULSpeed.Mbps()
+		progress("upload", fmt.Sprintf("Upload: %.2f Mbps", uploadMbps))
+	}
+
+	partial, err := phases.result(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("upload test: %w", err)
+		return nil, serverErr(err)
+	}
+	if partial != nil {
+		log.Printf("[speedtest] Keeping partial result after %v", phases.err)
 	}
-	uploadMbps := target.ULSpeed.Mbps()
-	progress("upload", fmt.Sprintf("Upload: %.2f Mbps", uploadMbps))
 
 	progress("processing", "Processing results...")
 
+	var lan *model.LANHealth
+	if health != nil {
+		lan = health.End()
+	}
+
 	// Debug output
 	log.Printf("[speedtest] Raw DLSpeed: %.2f (ByteRate), Mbps(): %.2f", float64(target.DLSpeed), target.DLSpeed.Mbps())
 	log.Printf("[speedtest] Raw ULSpeed: %.2f (ByteRate), Mbps(): %.2f", float64(target.ULSpeed), target.ULSpeed.Mbps())
@@ -145,7 +258,7 @@ func (r *Runner) RunWithProgress(ctx context.Context, progress func(stage string
 	}
 
 	res := &model.SpeedtestResult{
-		ID:            generateID(),
+		ID:            model.NewID(),
 		Timestamp:     time.Now().UTC(),
 		DownloadMbps:  downloadMbps,
 		UploadMbps:    uploadMbps,
@@ -157,12 +270,126 @@ func (r *Runner) RunWithProgress(ctx context.Context, progress func(stage string
 		ServerID:      target.ID,
 		ServerName:    target.Name,
 		ServerCountry: target.Country,
+		Engine:        model.EngineOokla,
+		Link:          link,
+		LAN:           lan,
+		PathMTU:       mtu,
+		Phases:        partial,
+		Timings:       phases.timings(),
 		RawJSON:       rawJSON,
 	}
 
 	return res, nil
 }
 
-func generateID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+// selectServer returns the closest server not excluded, or the closest one
+// when all are.
+func (r *Runner) selectServer(ctx context.Context, servers st.Servers) *st.Server {
+	if r.exclude == nil {
+		return servers[0]
+	}
+	excluded := r.exclude(ctx)
+	for _, s := range servers {
+		if !slices.Contains(excluded, s.ID) {
+			return s
+		}
+		log.Printf("[speedtest] skipping excluded server %s (%s)", s.Name, s.ID)
+	}
+	return servers[0]
+}
+
+// findServer returns the server with id from servers, or looks it up when
+// it isn't among them. Servers asked for by ID are never excluded.
+func findServer(ctx context.Context, client *st.Speedtest, servers st.Servers, id string) (*st.Server, error) {
+	for _, s := range servers {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	s, err := client.FetchServerByIDContext(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("fetch server %s: %w", id, err)
+	}
+	return s, nil
+}
+
+// localChecks records the link a test against addr (host:port) runs over,
+// so Wi-Fi runs can be told apart, and starts the LAN health check and path
+// MTU probe when they are enabled.
+func (r *Runner) localChecks(ctx context.Context, source, addr string, progress func(stage string, message string)) (*model.LinkInfo, *netinfo.HealthSnapshot, *model.PathMTU) {
+	var link *model.LinkInfo
+	var err error
+	if source != "" {
+		link, err = netinfo.DetectSource(ctx, source)
+	} else {
+		link, err = netinfo.Detect(ctx, addr)
+	}
+	if err != nil {
+		log.Printf("[speedtest] detect link: %v", err)
+	}
+
+	var health *netinfo.HealthSnapshot
+	if r.health != nil {
+		progress("lan", "Checking gateway and DNS...")
+		iface := ""
+		if link != nil {
+			iface = link.Interface
+		}
+		health = r.health.Begin(ctx, iface)
+	}
+
+	// Pings can't be bound to a source address, so the probe would measure
+	// the default route rather than the connection under test
+	var mtu *model.PathMTU
+	if r.mtuMax > 0 && source == "" {
+		progress("mtu", "Probing path MTU...")
+		mtu = pathMTU(ctx, addr, r.mtuMax)
+	}
+	return link, health, mtu
+}
+
+// pathMTU probes the path MTU to the host of a server's host:port address.
+func pathMTU(ctx context.Context, hostport string, max int) *model.PathMTU {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	res := &model.PathMTU{Address: host}
+	mtu, err := probe.PathMTU(ctx, host, max)
+	if err != nil {
+		log.Printf("[speedtest] path mtu: %v", err)
+		res.Error = err.Error()
+		return res
+	}
+	res.MTU = mtu
+	return res
+}
+
+// reportPercent reports every second how far a transfer test is through
+// transferDuration, as "<verb>... N%", until the returned function is called.
+func reportPercent(progress func(stage string, message string), stage, verb string) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		start := time.Now()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				pct := int(time.Since(start) * 100 / transferDuration)
+				if pct > 99 {
+					pct = 99
+				}
+				progress(stage, fmt.Sprintf("%s... %d%%", verb, pct))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
 }
@@ -0,0 +1,109 @@
+package starlink
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// message is a decoded protobuf message: the last value of each field by
+// number. Only what the dish's status needs is supported; repeated fields
+// keep their last value and groups are rejected.
+type message map[int]value
+
+type value struct {
+	wire  int
+	num   uint64 // Varint and fixed values
+	bytes []byte // Length-delimited values
+}
+
+var errTruncated = errors.New("truncated protobuf message")
+
+func decode(b []byte) (message, error) {
+	m := make(message)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errTruncated
+		}
+		b = b[n:]
+		field, wire := int(key>>3), int(key&7)
+		v := value{wire: wire}
+		switch wire {
+		case wireVarint:
+			v.num, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errTruncated
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return nil, errTruncated
+			}
+			v.num = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return nil, errTruncated
+			}
+			v.num = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, errTruncated
+			}
+			v.bytes = b[n : n+int(size)]
+			b = b[n+int(size):]
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d", wire)
+		}
+		m[field] = v
+	}
+	return m, nil
+}
+
+// message decodes a nested message field, returning an empty message if the
+// field is absent.
+func (m message) message(field int) (message, error) {
+	v, ok := m[field]
+	if !ok || v.wire != wireBytes {
+		return message{}, nil
+	}
+	return decode(v.bytes)
+}
+
+func (m message) float(field int) float64 {
+	v, ok := m[field]
+	if !ok || v.wire != wireFixed32 {
+		return 0
+	}
+	return float64(math.Float32frombits(uint32(v.num)))
+}
+
+func (m message) uint(field int) uint64 {
+	if v, ok := m[field]; ok && v.wire == wireVarint {
+		return v.num
+	}
+	return 0
+}
+
+func (m message) bool(field int) bool {
+	return m.uint(field) != 0
+}
+
+func (m message) string(field int) string {
+	if v, ok := m[field]; ok && v.wire == wireBytes {
+		return string(v.bytes)
+	}
+	return ""
+}
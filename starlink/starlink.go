@@ -0,0 +1,244 @@
+// Package starlink reads throughput, latency, obstruction and outage data
+// from a Starlink dish on the local network through the gRPC-web interface
+// its own app uses, independently of the speedtest engine.
+package starlink
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"speedplane/model"
+)
+
+// Defaults used when a Client option is zero.
+const (
+	DefaultAddress  = "192.168.100.1:9201"
+	DefaultInterval = time.Minute
+	DefaultTimeout  = 10 * time.Second
+)
+
+// Field numbers in SpaceX.API.Device messages.
+const (
+	requestGetStatus         = 1004 // Request.get_status
+	responseDishGetStatus    = 2004 // Response.dish_get_status
+	statusDeviceInfo         = 1
+	statusDeviceState        = 2
+	statusPopPingDropRate    = 1003
+	statusObstructionStats   = 1004
+	statusDownlinkBps        = 1007
+	statusUplinkBps          = 1008
+	statusPopPingLatencyMs   = 1009
+	statusOutage             = 1014
+	deviceInfoID             = 1
+	deviceInfoSoftware       = 3
+	deviceStateUptimeS       = 1
+	obstructionFraction      = 1
+	obstructionCurrently     = 5
+	outageCause              = 1
+	outageDurationNs         = 3
+	handleMethod             = "/SpaceX.API.Device.Device/Handle"
+	grpcWebContentType       = "application/grpc-web+proto"
+	grpcWebTrailerFrameFlags = 0x80
+)
+
+// outageCauses names DishOutage.Cause values.
+var outageCauses = map[uint64]string{
+	0:  "unknown",
+	1:  "booting",
+	2:  "stowed",
+	3:  "thermal_shutdown",
+	4:  "no_schedule",
+	5:  "no_sats",
+	6:  "obstructed",
+	7:  "no_downlink",
+	8:  "no_pings",
+	9:  "actuator_activity",
+	10: "cable_reset",
+	11: "sleeping",
+}
+
+// Client reads a dish's status.
+type Client struct {
+	Address string        // host:port of the dish's gRPC-web interface
+	Timeout time.Duration // Per request
+}
+
+// Status reads the dish's current status.
+func (c *Client) Status(ctx context.Context) (model.StarlinkStatus, error) {
+	address := c.Address
+	if address == "" {
+		address = DefaultAddress
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Request{get_status: GetStatusRequest{}} in a gRPC-web data frame
+	body := binary.AppendUvarint(nil, requestGetStatus<<3|wireBytes)
+	body = append(body, 0)
+	frame := make([]byte, 5, 5+len(body))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(body)))
+	frame = append(frame, body...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+address+handleMethod, bytes.NewReader(frame))
+	if err != nil {
+		return model.StarlinkStatus{}, err
+	}
+	req.Header.Set("Content-Type", grpcWebContentType)
+	req.Header.Set("Accept", grpcWebContentType)
+	req.Header.Set("X-Grpc-Web", "1")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return model.StarlinkStatus{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return model.StarlinkStatus{}, fmt.Errorf("dish returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return model.StarlinkStatus{}, err
+	}
+
+	msg, err := unframe(data, resp.Header)
+	if err != nil {
+		return model.StarlinkStatus{}, err
+	}
+	return parseStatus(msg)
+}
+
+// Run reads the dish's status every interval until ctx is cancelled, passing
+// each reading to save. Failed reads are passed on with Error set.
+func (c *Client) Run(ctx context.Context, interval time.Duration, save func(model.StarlinkStatus)) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		st, err := c.Status(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			st = model.StarlinkStatus{Error: err.Error()}
+		}
+		st.Timestamp = time.Now().UTC()
+		save(st)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// unframe returns the message of a gRPC-web response, checking the status in
+// its trailers (or headers, for responses without a message).
+func unframe(data []byte, header http.Header) ([]byte, error) {
+	var msg []byte
+	status, message := header.Get("Grpc-Status"), header.Get("Grpc-Message")
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, errTruncated
+		}
+		flags, size := data[0], binary.BigEndian.Uint32(data[1:5])
+		if uint64(len(data)-5) < uint64(size) {
+			return nil, errTruncated
+		}
+		payload := data[5 : 5+size]
+		data = data[5+size:]
+		if flags&grpcWebTrailerFrameFlags == 0 {
+			msg = payload
+			continue
+		}
+		// Trailers are HTTP header lines
+		for _, line := range strings.Split(string(payload), "\r\n") {
+			name, v, _ := strings.Cut(line, ":")
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "grpc-status":
+				status = strings.TrimSpace(v)
+			case "grpc-message":
+				message = strings.TrimSpace(v)
+			}
+		}
+	}
+	if status != "" && status != "0" {
+		code, _ := strconv.Atoi(status)
+		return nil, fmt.Errorf("dish returned gRPC status %d: %s", code, message)
+	}
+	if msg == nil {
+		return nil, fmt.Errorf("dish returned no status")
+	}
+	return msg, nil
+}
+
+// parseStatus converts a Response holding a DishGetStatusResponse.
+func parseStatus(data []byte) (model.StarlinkStatus, error) {
+	resp, err := decode(data)
+	if err != nil {
+		return model.StarlinkStatus{}, err
+	}
+	if _, ok := resp[responseDishGetStatus]; !ok {
+		return model.StarlinkStatus{}, fmt.Errorf("response is not a dish status; is the address a dish?")
+	}
+	status, err := resp.message(responseDishGetStatus)
+	if err != nil {
+		return model.StarlinkStatus{}, err
+	}
+	info, err := status.message(statusDeviceInfo)
+	if err != nil {
+		return model.StarlinkStatus{}, err
+	}
+	state, err := status.message(statusDeviceState)
+	if err != nil {
+		return model.StarlinkStatus{}, err
+	}
+	obstruction, err := status.message(statusObstructionStats)
+	if err != nil {
+		return model.StarlinkStatus{}, err
+	}
+
+	st := model.StarlinkStatus{
+		DishID:              info.string(deviceInfoID),
+		SoftwareVersion:     info.string(deviceInfoSoftware),
+		UptimeS:             int64(state.uint(deviceStateUptimeS)),
+		DownlinkMbps:        round(status.float(statusDownlinkBps) / 1e6),
+		UplinkMbps:          round(status.float(statusUplinkBps) / 1e6),
+		PingMs:              round(status.float(statusPopPingLatencyMs)),
+		PingDropPct:         round(status.float(statusPopPingDropRate) * 100),
+		ObstructedPct:       round(obstruction.float(obstructionFraction) * 100),
+		CurrentlyObstructed: obstruction.bool(obstructionCurrently),
+	}
+	if _, ok := status[statusOutage]; ok {
+		outage, err := status.message(statusOutage)
+		if err != nil {
+			return model.StarlinkStatus{}, err
+		}
+		cause := outage.uint(outageCause)
+		st.OutageCause = outageCauses[cause]
+		if st.OutageCause == "" {
+			st.OutageCause = "cause_" + strconv.FormatUint(cause, 10)
+		}
+		st.OutageS = round(float64(outage.uint(outageDurationNs)) / 1e9)
+	}
+	return st, nil
+}
+
+// round keeps two decimals, as float32 values from the dish carry noise
+// beyond that.
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
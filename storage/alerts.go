@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"speedplane/model"
+)
+
+// alertColumns lists the alert_events columns in the order scanAlert
+// expects.
+const alertColumns = `id, time, kind, rule_id, rule_name, metric, operator,
+	       threshold, value, severity, since, schedule, result_id, acknowledged_at,
+	       snoozed`
+
+// SaveAlert adds an event to the alert history and sets its ID.
+func (s *Store) SaveAlert(ctx context.Context, a *model.AlertRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `
+	INSERT INTO alert_events (time, kind, rule_id, rule_name, metric, operator,
+	                          threshold, value, severity, since, schedule, result_id, snoozed)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, a.Time.Unix(), a.Kind, a.RuleID, a.RuleName, a.Metric, a.Operator,
+		a.Threshold, a.Value, a.Severity, a.Since.Unix(),
+		sql.NullString{String: a.Schedule, Valid: a.Schedule != ""},
+		sql.NullString{String: a.ResultID, Valid: a.ResultID != ""}, a.Snoozed)
+	if err != nil {
+		return err
+	}
+	a.ID, err = res.LastInsertId()
+	return err
+}
+
+// ListAlerts returns up to limit events of the alert history within the
+// time range, newest first. A limit of 0 returns all of them.
+func (s *Store) ListAlerts(ctx context.Context, from, to time.Time, limit int) ([]model.AlertRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT ` + alertColumns + `
+	FROM alert_events
+	WHERE time >= ? AND time <= ?
+	ORDER BY time DESC, id DESC`
+	args := []interface{}{from.Unix(), to.Unix()}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.AlertRecord
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// AcknowledgeAlert marks the event with the given ID, and the other events
+// of its incident not acknowledged yet, as acknowledged at the given time.
+// It returns the event, or nil if there is none with that ID.
+func (s *Store) AcknowledgeAlert(ctx context.Context, id int64, at time.Time) (*model.AlertRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	a, err := scanAlert(tx.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM alert_events WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.AcknowledgedAt == nil {
+		if _, err := acknowledgeIncident(ctx, tx, a.Schedule, a.RuleID, a.Since, at); err != nil {
+			return nil, err
+		}
+		t := unixTime(at.Unix())
+		a.AcknowledgedAt = &t
+	}
+	return &a, tx.Commit()
+}
+
+// AcknowledgeIncident marks the events of an incident, the rule's events
+// since it degraded at since, as acknowledged at the given time and returns
+// how many it marked. schedule is empty for the global rules.
+func (s *Store) AcknowledgeIncident(ctx context.Context, schedule, ruleID string, since, at time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	n, err := acknowledgeIncident(ctx, tx, schedule, ruleID, since, at)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func acknowledgeIncident(ctx context.Context, tx *sql.Tx, schedule, ruleID string, since, at time.Time) (int64, error) {
+	res, err := tx.ExecContext(ctx, `
+	UPDATE alert_events SET acknowledged_at = ?
+	WHERE rule_id = ? AND since = ? AND IFNULL(schedule, '') = ? AND acknowledged_at IS NULL
+	`, at.Unix(), ruleID, since.Unix(), schedule)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanAlert(row interface{ Scan(...interface{}) error }) (model.AlertRecord, error) {
+	var a model.AlertRecord
+	var at, since int64
+	var schedule, resultID sql.NullString
+	var acked sql.NullInt64
+	err := row.Scan(&a.ID, &at, &a.Kind, &a.RuleID, &a.RuleName, &a.Metric, &a.Operator,
+		&a.Threshold, &a.Value, &a.Severity, &since, &schedule, &resultID, &acked, &a.Snoozed)
+	if err != nil {
+		return model.AlertRecord{}, err
+	}
+	a.Time = unixTime(at)
+	a.Since = unixTime(since)
+	a.Schedule = schedule.String
+	a.ResultID = resultID.String
+	if acked.Valid {
+		t := unixTime(acked.Int64)
+		a.AcknowledgedAt = &t
+	}
+	return a, nil
+}
+
+// LatestAlerts returns the latest event of each rule in the alert history,
+// the global rules' and each schedule's, which is what the rules' states are
+// restored from after a restart.
+func (s *Store) LatestAlerts(ctx context.Context) ([]model.AlertRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT `+alertColumns+`
+	FROM alert_events a
+	WHERE id = (SELECT id FROM alert_events b
+	            WHERE b.rule_id = a.rule_id AND IFNULL(b.schedule, '') = IFNULL(a.schedule, '')
+	            ORDER BY time DESC, id DESC LIMIT 1)
+	ORDER BY time, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.AlertRecord
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// SetAlertSnooze keeps the snooze of a rule, or removes it when until is
+// zero. schedule is empty for the global rules.
+func (s *Store) SetAlertSnooze(ctx context.Context, schedule, ruleID string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	if until.IsZero() {
+		_, err := s.db.ExecContext(ctx, `DELETE FROM alert_snoozes WHERE schedule = ? AND rule_id = ?`, schedule, ruleID)
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `
+	INSERT INTO alert_snoozes (schedule, rule_id, until) VALUES (?, ?, ?)
+	ON CONFLICT (schedule, rule_id) DO UPDATE SET until = excluded.until
+	`, schedule, ruleID, until.Unix())
+	return err
+}
+
+// ListAlertSnoozes returns the snoozes that haven't ended by now, dropping
+// the ones that have.
+func (s *Store) ListAlertSnoozes(ctx context.Context, now time.Time) ([]model.AlertSnooze, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM alert_snoozes WHERE until <= ?`, now.Unix()); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT schedule, rule_id, until FROM alert_snoozes ORDER BY schedule, rule_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.AlertSnooze
+	for rows.Next() {
+		var sn model.AlertSnooze
+		var until int64
+		if err := rows.Scan(&sn.Schedule, &sn.RuleID, &until); err != nil {
+			return nil, err
+		}
+		sn.Until = unixTime(until)
+		out = append(out, sn)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"speedplane/model"
+)
+
+// SaveAnnotation stores a new annotation and sets its ID.
+func (s *Store) SaveAnnotation(ctx context.Context, a *model.Annotation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `INSERT INTO annotations (kind, start_time, end_time, text) VALUES (?, ?, ?, ?)`,
+		a.Kind, a.Start.Unix(), a.End.Unix(), a.Text)
+	if err != nil {
+		return err
+	}
+	a.ID, err = res.LastInsertId()
+	return err
+}
+
+// EndAnnotation moves the end of an annotation, e.g. when maintenance
+// finishes early.
+func (s *Store) EndAnnotation(ctx context.Context, id int64, end time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `UPDATE annotations SET end_time = ? WHERE id = ?`, end.Unix(), id)
+	return err
+}
+
+// ListAnnotations returns annotations overlapping the time range, oldest
+// first.
+func (s *Store) ListAnnotations(ctx context.Context, from, to time.Time) ([]model.Annotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT id, kind, start_time, end_time, text
+	FROM annotations
+	WHERE end_time >= ? AND start_time <= ?
+	ORDER BY start_time ASC, id ASC
+	`, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.Annotation
+	for rows.Next() {
+		a, err := scanAnnotation(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// ActiveAnnotation returns the annotation of the given kind that covers at
+// and ends last, or nil if there is none.
+func (s *Store) ActiveAnnotation(ctx context.Context, kind string, at time.Time) (*model.Annotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	row := s.db.QueryRowContext(ctx, `
+	SELECT id, kind, start_time, end_time, text
+	FROM annotations
+	WHERE kind = ? AND start_time <= ? AND end_time > ?
+	ORDER BY end_time DESC, id DESC
+	LIMIT 1
+	`, kind, at.Unix(), at.Unix())
+	a, err := scanAnnotation(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func scanAnnotation(row interface{ Scan(...interface{}) error }) (model.Annotation, error) {
+	var a model.Annotation
+	var start, end int64
+	var text sql.NullString
+	if err := row.Scan(&a.ID, &a.Kind, &start, &end, &text); err != nil {
+		return model.Annotation{}, err
+	}
+	a.Start = unixTime(start)
+	a.End = unixTime(end)
+	a.Text = text.String
+	return a, nil
+}
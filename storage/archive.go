@@ -0,0 +1,433 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"speedplane/model"
+)
+
+// Rollup aggregates a UTC day of results. Rollups are kept when the results
+// themselves are archived, so long-term history stays queryable.
+type Rollup struct {
+	Day         time.Time `json:"day"` // Midnight UTC
+	Count       int       `json:"count"`
+	DownloadAvg float64   `json:"download_avg"`
+	DownloadMin float64   `json:"download_min"`
+	DownloadMax float64   `json:"download_max"`
+	UploadAvg   float64   `json:"upload_avg"`
+	UploadMin   float64   `json:"upload_min"`
+	UploadMax   float64   `json:"upload_max"`
+	PingAvg     float64   `json:"ping_avg"`
+	PingMin     float64   `json:"ping_min"`
+	PingMax     float64   `json:"ping_max"`
+	JitterAvg   float64   `json:"jitter_avg"`
+	LossAvg     float64   `json:"packet_loss_avg"`
+
+	// Consistency of the day's results, unset for days with too few of them
+	// and for rollups stored by older versions.
+	Consistency *model.Consistency `json:"consistency,omitempty"`
+
+	// Distributions of each metric, by chart metric name (download, upload,
+	// ping, jitter and packet_loss), for bucketed charts reaching back past
+	// the retention window. Unset for rollups stored by older versions.
+	Distributions map[string]Distribution `json:"distributions,omitempty"`
+}
+
+// Distribution describes a day's values of one metric, leaving out
+// negative (missing) values and failed phases of partial results as
+// BucketResults does. Percentiles use the nearest-rank method; P50 is the
+// median.
+type Distribution struct {
+	Count int     `json:"n"`
+	Mean  float64 `json:"mean"`
+	P10   float64 `json:"p10"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+}
+
+const rollupDay = 24 * time.Hour
+
+// ArchiveResults moves results older than before, rounded down to midnight
+// UTC so days are archived whole, into gzipped JSON Lines files under
+// dir/YYYY-MM/, one result per line. Daily rollups of the archived results
+// are stored first; a day that is archived again (after its results were
+// imported back) gets its rollup recomputed. Rows are only deleted once
+// their file is safely written. The query timeout applies to each month's
+// queries rather than the whole run. It returns the number of results
+// archived.
+func (s *Store) ArchiveResults(ctx context.Context, before time.Time, dir string) (int, error) {
+	before = before.UTC().Truncate(rollupDay)
+
+	var oldest *int64
+	s.mu.Lock()
+	qctx, cancel := s.queryContext(ctx)
+	err := s.db.QueryRowContext(qctx, `SELECT MIN(timestamp) FROM results WHERE timestamp < ?`, before.Unix()).Scan(&oldest)
+	cancel()
+	s.mu.Unlock()
+	if err != nil || oldest == nil {
+		return 0, err
+	}
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	total := 0
+	start := unixTime(*oldest)
+	for month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC); month.Before(before); month = month.AddDate(0, 1, 0) {
+		end := month.AddDate(0, 1, 0)
+		if end.After(before) {
+			end = before
+		}
+		results, err := s.ListResultsPage(ctx, month, end.Add(-time.Second), ResultFilter{}, 0, 0)
+		if err != nil {
+			return total, err
+		}
+		if len(results) == 0 {
+			continue
+		}
+
+		path, err := writeArchive(filepath.Join(dir, month.Format("2006-01")), "results-"+stamp, results)
+		if err != nil {
+			return total, err
+		}
+		if err := s.replaceWithRollups(ctx, results); err != nil {
+			return total, fmt.Errorf("%s written, but results were not removed: %w", path, err)
+		}
+		total += len(results)
+	}
+	return total, nil
+}
+
+// writeArchive writes results to a new gzipped JSON Lines file in dir named
+// after name, adding a counter if a file by that name exists, and returns
+// its path.
+func writeArchive(dir, name string, results []model.SpeedtestResult) (path string, err error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create archive directory: %w", err)
+	}
+	var f *os.File
+	for i := 1; ; i++ {
+		path = filepath.Join(dir, name+".jsonl.gz")
+		if i > 1 {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d.jsonl.gz", name, i))
+		}
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) || i == 100 {
+			return "", fmt.Errorf("create archive: %w", err)
+		}
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(path)
+		}
+	}()
+
+	zw := gzip.NewWriter(f)
+	enc := json.NewEncoder(zw)
+	for i := range results {
+		if err := enc.Encode(&results[i]); err != nil {
+			return "", fmt.Errorf("write archive: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("write archive: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return "", fmt.Errorf("write archive: %w", err)
+	}
+	return path, f.Close()
+}
+
+// WriteSnapshot writes the results within the time range to w in the
+// archive format, gzipped JSON Lines, so snapshots can be imported like
+// archives. It returns how many results were written.
+func (s *Store) WriteSnapshot(ctx context.Context, w io.Writer, from, to time.Time) (int, error) {
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+	n := 0
+	err := s.EachResult(ctx, from, to, ResultFilter{}, func(r model.SpeedtestResult) error {
+		n++
+		return enc.Encode(&r)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return 0, fmt.Errorf("write snapshot: %w", err)
+	}
+	return n, nil
+}
+
+// replaceWithRollups stores daily rollups of results and deletes them, in
+// one transaction.
+func (s *Store) replaceWithRollups(ctx context.Context, results []model.SpeedtestResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range rollupResults(results) {
+		var score sql.NullFloat64
+		var consistencyJSON, distributionsJSON sql.NullString
+		if r.Distributions != nil {
+			data, err := json.Marshal(r.Distributions)
+			if err != nil {
+				return err
+			}
+			distributionsJSON = sql.NullString{String: string(data), Valid: true}
+		}
+		if r.Consistency != nil {
+			data, err := json.Marshal(r.Consistency)
+			if err != nil {
+				return err
+			}
+			score = sql.NullFloat64{Float64: r.Consistency.Score, Valid: true}
+			consistencyJSON = sql.NullString{String: string(data), Valid: true}
+		}
+		_, err := tx.ExecContext(ctx, `
+		INSERT OR REPLACE INTO result_rollups (
+			day, count, download_avg, download_min, download_max,
+			upload_avg, upload_min, upload_max, ping_avg, ping_min, ping_max,
+			jitter_avg, packet_loss_avg, consistency_score, consistency_json,
+			distributions_json
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.Day.Unix(), r.Count, r.DownloadAvg, r.DownloadMin, r.DownloadMax,
+			r.UploadAvg, r.UploadMin, r.UploadMax, r.PingAvg, r.PingMin, r.PingMax,
+			r.JitterAvg, r.LossAvg, score, consistencyJSON, distributionsJSON)
+		if err != nil {
+			return err
+		}
+	}
+	for _, r := range results {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM results WHERE id = ?`, r.ID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.generation.Add(1)
+	return nil
+}
+
+// rollupResults aggregates results, which are sorted by timestamp, per UTC
+// day. Negative (missing) values are left out of the averages and
+// distributions, and the day's consistency is scored with
+// model.ComputeConsistency.
+func rollupResults(results []model.SpeedtestResult) []Rollup {
+	type stat struct {
+		sum, min, max float64
+		n             int
+	}
+	add := func(st *stat, v float64) {
+		if v < 0 {
+			return
+		}
+		if st.n == 0 || v < st.min {
+			st.min = v
+		}
+		if st.n == 0 || v > st.max {
+			st.max = v
+		}
+		st.sum += v
+		st.n++
+	}
+	avg := func(st stat) float64 {
+		if st.n == 0 {
+			return 0
+		}
+		return st.sum / float64(st.n)
+	}
+
+	var rollups []Rollup
+	for i := 0; i < len(results); {
+		d := results[i].Timestamp.UTC().Truncate(rollupDay)
+		var down, up, ping, jitter, loss stat
+		count := 0
+		start := i
+		for ; i < len(results) && results[i].Timestamp.UTC().Truncate(rollupDay).Equal(d); i++ {
+			r := results[i]
+			add(&down, r.DownloadMbps)
+			add(&up, r.UploadMbps)
+			add(&ping, r.PingMs)
+			add(&jitter, r.JitterMs)
+			add(&loss, r.PacketLossPct)
+			count++
+		}
+		rollups = append(rollups, Rollup{
+			Day:           d,
+			Count:         count,
+			DownloadAvg:   avg(down),
+			DownloadMin:   down.min,
+			DownloadMax:   down.max,
+			UploadAvg:     avg(up),
+			UploadMin:     up.min,
+			UploadMax:     up.max,
+			PingAvg:       avg(ping),
+			PingMin:       ping.min,
+			PingMax:       ping.max,
+			JitterAvg:     avg(jitter),
+			LossAvg:       avg(loss),
+			Consistency:   model.ComputeConsistency(results[start:i]),
+			Distributions: distributions(results[start:i]),
+		})
+	}
+	return rollups
+}
+
+// distributions describes the values of each chart metric in results.
+func distributions(results []model.SpeedtestResult) map[string]Distribution {
+	out := make(map[string]Distribution, len(bucketMetrics))
+	for metric := range bucketMetrics {
+		var values []float64
+		var sum float64
+		for _, r := range results {
+			v := metricValue(r, metric)
+			if v < 0 || r.PhaseFailed(bucketPhases[metric]) {
+				continue
+			}
+			values = append(values, v)
+			sum += v
+		}
+		n := len(values)
+		if n == 0 {
+			continue
+		}
+		sort.Float64s(values)
+		// As BucketResults: the nearest rank ceil(p * n), and the mean of
+		// the two middle values for the median
+		rank := func(pct int) float64 { return values[(pct*n+99)/100-1] }
+		out[metric] = Distribution{
+			Count: n,
+			Mean:  sum / float64(n),
+			P10:   rank(10),
+			P50:   (values[(n+1)/2-1] + values[(n+2)/2-1]) / 2,
+			P90:   rank(90),
+			P95:   rank(95),
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// metricValue returns a result's value of a chart metric, see bucketMetrics.
+func metricValue(r model.SpeedtestResult, metric string) float64 {
+	switch metric {
+	case "download":
+		return r.DownloadMbps
+	case "upload":
+		return r.UploadMbps
+	case "ping":
+		return r.PingMs
+	case "jitter":
+		return r.JitterMs
+	case "packet_loss":
+		return r.PacketLossPct
+	}
+	return -1
+}
+
+// ListRollups returns the daily rollups within the time range, oldest first.
+func (s *Store) ListRollups(ctx context.Context, from, to time.Time) ([]Rollup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT day, count, download_avg, download_min, download_max,
+	       upload_avg, upload_min, upload_max, ping_avg, ping_min, ping_max,
+	       jitter_avg, packet_loss_avg, consistency_json, distributions_json
+	FROM result_rollups
+	WHERE day >= ? AND day <= ?
+	ORDER BY day ASC
+	`, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rollups []Rollup
+	for rows.Next() {
+		var r Rollup
+		var d int64
+		var consistencyJSON, distributionsJSON sql.NullString
+		if err := rows.Scan(&d, &r.Count, &r.DownloadAvg, &r.DownloadMin, &r.DownloadMax,
+			&r.UploadAvg, &r.UploadMin, &r.UploadMax, &r.PingAvg, &r.PingMin, &r.PingMax,
+			&r.JitterAvg, &r.LossAvg, &consistencyJSON, &distributionsJSON); err != nil {
+			return nil, err
+		}
+		r.Day = unixTime(d)
+		if consistencyJSON.Valid {
+			if err := json.Unmarshal([]byte(consistencyJSON.String), &r.Consistency); err != nil {
+				return nil, fmt.Errorf("parse consistency: %w", err)
+			}
+		}
+		if distributionsJSON.Valid {
+			if err := json.Unmarshal([]byte(distributionsJSON.String), &r.Distributions); err != nil {
+				return nil, fmt.Errorf("parse distributions: %w", err)
+			}
+		}
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+// ImportArchive saves the results in an archive file written by
+// ArchiveResults, or any JSON Lines file of results, optionally gzipped.
+// Results that are already stored are skipped, so importing twice is
+// harmless. It returns the number of results read.
+func (s *Store) ImportArchive(ctx context.Context, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	n := 0
+	for {
+		var res model.SpeedtestResult
+		if err := dec.Decode(&res); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("%s: result %d: %w", path, n+1, err)
+		}
+		if err := s.SaveResult(ctx, &res); err != nil {
+			return n, fmt.Errorf("%s: result %d: %w", path, n+1, err)
+		}
+		n++
+	}
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"speedplane/model"
+)
+
+// Defaults used when NewBatchWriter is given zero values.
+const (
+	DefaultBatchInterval = 10 * time.Second
+	DefaultBatchSize     = 1000
+)
+
+// maxPendingBatches bounds how many batches' worth of records are kept while
+// writes keep failing, e.g. because the disk is full.
+const maxPendingBatches = 10
+
+// BatchWriter buffers high-frequency records, such as continuous probe
+// rounds, and writes them with multi-row inserts in one transaction per
+// flush, so hosts on SD cards don't pay an fsync for every sample. Records
+// are flushed every interval, as soon as size records are pending, and on
+// Close. Until then they aren't visible to queries, and they are lost if the
+// process crashes.
+type BatchWriter struct {
+	store    *Store
+	interval time.Duration
+	size     int
+
+	mu     sync.Mutex
+	probes []model.ProbeResult
+
+	full      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewBatchWriter starts a BatchWriter that flushes every interval or once
+// size records are pending. Call Close to flush and stop it.
+func (s *Store) NewBatchWriter(interval time.Duration, size int) *BatchWriter {
+	if interval <= 0 {
+		interval = DefaultBatchInterval
+	}
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	w := &BatchWriter{
+		store:    s,
+		interval: interval,
+		size:     size,
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// AddProbeResults queues probe results for the next flush.
+func (w *BatchWriter) AddProbeResults(results []model.ProbeResult) {
+	w.mu.Lock()
+	w.probes = append(w.probes, results...)
+	full := len(w.probes) >= w.size
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush writes all pending records now. Records that fail to write are kept
+// for the next flush.
+func (w *BatchWriter) Flush() error {
+	w.mu.Lock()
+	probes := w.probes
+	w.probes = nil
+	w.mu.Unlock()
+
+	if len(probes) == 0 {
+		return nil
+	}
+	// Flushes outlive any caller, down to the last one on Close during
+	// shutdown; the query timeout bounds them
+	err := w.store.SaveProbeResults(context.Background(), probes)
+	if err != nil {
+		w.requeue(probes)
+	}
+	return err
+}
+
+// requeue puts records that failed to write back in front of the ones queued
+// since, dropping the oldest beyond maxPendingBatches batches.
+func (w *BatchWriter) requeue(probes []model.ProbeResult) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.probes = append(probes, w.probes...)
+	if limit := maxPendingBatches * w.size; len(w.probes) > limit {
+		dropped := len(w.probes) - limit
+		w.probes = w.probes[dropped:]
+		log.Printf("batch writer: dropped %d probe results that could not be written", dropped)
+	}
+}
+
+// Close flushes pending records and stops the writer. It is safe to call
+// more than once.
+func (w *BatchWriter) Close() {
+	w.closeOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
+
+func (w *BatchWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		stopping := false
+		select {
+		case <-ticker.C:
+		case <-w.full:
+		case <-w.stop:
+			stopping = true
+		}
+		if err := w.Flush(); err != nil {
+			log.Printf("batch writer: flush: %v", err)
+		}
+		if stopping {
+			return
+		}
+	}
+}
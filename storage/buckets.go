@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Aggregations supported by BucketResults.
+const (
+	AggAvg    = "avg"
+	AggMedian = "median"
+	AggP95    = "p95"
+)
+
+// bucketMetrics maps chart metric names to result columns.
+var bucketMetrics = map[string]string{
+	"download":    "download_mbps",
+	"upload":      "upload_mbps",
+	"ping":        "ping_ms",
+	"jitter":      "jitter_ms",
+	"packet_loss": "packet_loss_pct",
+}
+
+// bucketPhases maps chart metrics to the test phase measuring them, whose
+// failure leaves the metric at zero rather than measured.
+var bucketPhases = map[string]string{
+	"download":    "download",
+	"upload":      "upload",
+	"ping":        "ping",
+	"jitter":      "ping",
+	"packet_loss": "ping",
+}
+
+// bucketOrigin aligns buckets: 1970-01-05 was a Monday, so weekly buckets
+// start on Mondays. Hourly and daily buckets are unaffected.
+const bucketOrigin = 4 * 24 * 60 * 60
+
+// Bucket is one aggregated point of a metric over a time interval, with
+// the band the metric's values fell in.
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Value float64   `json:"value"`
+	Count int       `json:"count"` // Results in the bucket
+	P10   float64   `json:"p10"`
+	P50   float64   `json:"p50"`
+	P90   float64   `json:"p90"`
+
+	// Archived is set for buckets computed, at least in part, from the
+	// rollups of archived days, whose values are approximate.
+	Archived bool `json:"archived,omitempty"`
+}
+
+// BucketQuery describes how BucketResults groups and aggregates results.
+type BucketQuery struct {
+	Metric   string        // download, upload, ping, jitter or packet_loss
+	Agg      string        // AggAvg, AggMedian or AggP95
+	Interval time.Duration // Bucket width, a whole number of seconds
+	Location *time.Location
+}
+
+// BucketResults groups results within from/to matching f into Interval-wide
+// buckets and aggregates the metric in each, entirely in SQL, along with its
+// 10th, 50th and 90th percentiles. Buckets start on local hour/day/week
+// boundaries using the location's UTC offset at to, so they shift by the DST
+// difference for results on the other side of a DST change. Empty buckets
+// are omitted; negative (missing) values and those of failed phases in
+// partial results are ignored. Percentiles use the nearest-rank method, and
+// the median and P50 the mean of the two middle values.
+//
+// Daily and weekly buckets without a filter also cover archived days, from
+// their rollups: see rollupBuckets.
+func (s *Store) BucketResults(ctx context.Context, from, to time.Time, f ResultFilter, q BucketQuery) ([]Bucket, error) {
+	column, ok := bucketMetrics[q.Metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q", q.Metric)
+	}
+	size := int64(q.Interval / time.Second)
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid interval %s", q.Interval)
+	}
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	_, offset := to.In(loc).Zone()
+
+	var value string
+	switch q.Agg {
+	case AggAvg:
+		value = `AVG(value)`
+	case AggMedian:
+		value = bucketP50
+	case AggP95:
+		value = `MAX(CASE WHEN rn = (95 * n + 99) / 100 THEN value END)`
+	default:
+		return nil, fmt.Errorf("unknown aggregation %q", q.Agg)
+	}
+
+	where, args := f.where(from, to)
+	query := `
+	WITH v AS (
+		SELECT (timestamp + ? - ?) / ? AS b, ` + column + ` AS value
+		FROM results
+		` + where + ` AND ` + column + ` >= 0
+		  AND (phases_json IS NULL OR json_extract(phases_json, ?) IS NOT 'failed')
+	),
+	r AS (
+		SELECT b, value,
+		       ROW_NUMBER() OVER (PARTITION BY b ORDER BY value) AS rn,
+		       COUNT(*) OVER (PARTITION BY b) AS n
+		FROM v
+	)
+	SELECT b, ` + value + `, MAX(n),
+	       MAX(CASE WHEN rn = (10 * n + 99) / 100 THEN value END),
+	       ` + bucketP50 + `,
+	       MAX(CASE WHEN rn = (90 * n + 99) / 100 THEN value END)
+	FROM r GROUP BY b ORDER BY b`
+	args = append([]interface{}{offset, bucketOrigin, size}, args...)
+	args = append(args, "$."+bucketPhases[q.Metric]+".status")
+
+	buckets, err := s.queryBuckets(ctx, query, args, size, offset, loc)
+	if err != nil {
+		return nil, err
+	}
+	if q.Interval < rollupDay || f != (ResultFilter{}) {
+		return buckets, nil
+	}
+	archived, err := s.rollupBuckets(ctx, from, to, q, size, offset, loc)
+	if err != nil {
+		return nil, fmt.Errorf("rollups: %w", err)
+	}
+	return mergeBuckets(buckets, archived), nil
+}
+
+// bucketP50 is the mean of the two middle values of a bucket, ranked by rn
+// among n.
+const bucketP50 = `AVG(CASE WHEN rn IN ((n + 1) / 2, (n + 2) / 2) THEN value END)`
+
+// rollupAggFields maps aggregations to the Distribution field rollupBuckets
+// aggregates.
+var rollupAggFields = map[string]string{
+	AggAvg:    "mean",
+	AggMedian: "p50",
+	AggP95:    "p95",
+}
+
+// rollupBuckets aggregates the rollups of archived days into buckets of
+// size seconds. A rollup covers a UTC day and lands in the bucket holding its
+// noon, so in other timezones daily buckets of archived days run from UTC
+// midnight rather than local midnight. The value and percentiles of buckets
+// spanning several days are the days' averages weighted by how many values
+// each had, which approximates rather than equals the percentiles of the
+// values themselves. Days whose archive was imported back are taken from
+// their results instead, and rollups stored by older versions, which have
+// no distributions, are left out. Whole numbers come out of the JSON as
+// integers, so the averages are forced to real division.
+func (s *Store) rollupBuckets(ctx context.Context, from, to time.Time, q BucketQuery, size int64, offset int, loc *time.Location) ([]Bucket, error) {
+	field := rollupAggFields[q.Agg]
+	path := "$." + q.Metric
+	query := `
+	WITH d AS (
+		SELECT (day + 43200 + ? - ?) / ? AS b, json_extract(distributions_json, ?) AS m
+		FROM result_rollups
+		WHERE day > ? AND day < ? AND distributions_json IS NOT NULL
+		  AND NOT EXISTS (SELECT 1 FROM results WHERE timestamp >= day AND timestamp < day + 86400)
+	),
+	w AS (
+		SELECT b, json_extract(m, '$.n') AS n, json_extract(m, '$.` + field + `') AS value,
+		       json_extract(m, '$.p10') AS p10, json_extract(m, '$.p50') AS p50,
+		       json_extract(m, '$.p90') AS p90
+		FROM d WHERE m IS NOT NULL
+	)
+	SELECT b, SUM(value * n) * 1.0 / SUM(n), SUM(n),
+	       SUM(p10 * n) * 1.0 / SUM(n), SUM(p50 * n) * 1.0 / SUM(n), SUM(p90 * n) * 1.0 / SUM(n)
+	FROM w GROUP BY b ORDER BY b`
+	args := []interface{}{offset, bucketOrigin, size, path, from.Unix() - int64(rollupDay/time.Second), to.Unix()}
+
+	buckets, err := s.queryBuckets(ctx, query, args, size, offset, loc)
+	if err != nil {
+		return nil, err
+	}
+	for i := range buckets {
+		buckets[i].Archived = true
+	}
+	return buckets, nil
+}
+
+// queryBuckets runs a bucket query returning the bucket index, value, count
+// and the 10th, 50th and 90th percentiles.
+func (s *Store) queryBuckets(ctx context.Context, query string, args []interface{}, size int64, offset int, loc *time.Location) ([]Bucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []Bucket
+	for rows.Next() {
+		var b int64
+		var bucket Bucket
+		if err := rows.Scan(&b, &bucket.Value, &bucket.Count, &bucket.P10, &bucket.P50, &bucket.P90); err != nil {
+			return nil, err
+		}
+		bucket.Start = time.Unix(b*size+bucketOrigin-int64(offset), 0).In(loc)
+		buckets = append(buckets, bucket)
+	}
+	return buckets, rows.Err()
+}
+
+// mergeBuckets merges the buckets of results and archived days, both
+// oldest first. A bucket in both, such as a week that was partly archived,
+// gets the average of the two weighted by their counts.
+func mergeBuckets(live, archived []Bucket) []Bucket {
+	if len(archived) == 0 {
+		return live
+	}
+	out := make([]Bucket, 0, len(live)+len(archived))
+	i := 0
+	for _, a := range archived {
+		for ; i < len(live) && live[i].Start.Before(a.Start); i++ {
+			out = append(out, live[i])
+		}
+		if i < len(live) && live[i].Start.Equal(a.Start) {
+			l := live[i]
+			n := float64(l.Count + a.Count)
+			weigh := func(x, y float64) float64 {
+				return (x*float64(l.Count) + y*float64(a.Count)) / n
+			}
+			a.Value = weigh(l.Value, a.Value)
+			a.P10 = weigh(l.P10, a.P10)
+			a.P50 = weigh(l.P50, a.P50)
+			a.P90 = weigh(l.P90, a.P90)
+			a.Count += l.Count
+			i++
+		}
+		out = append(out, a)
+	}
+	return append(out, live[i:]...)
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+)
+
+// Raw engine output is stored as a BLOB, gzip-compressed when that makes it
+// smaller, which for engine JSON it nearly always does. Databases created by
+// older versions stored it as TEXT; compressRawJSON converts those rows.
+
+// compressBatch is how many rows compressRawJSON converts per transaction,
+// so converting a large database can be interrupted without losing the
+// rows already done.
+const compressBatch = 500
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	gzipReaders sync.Pool
+)
+
+// packRaw returns raw output as it is stored: compressed unless that doesn't
+// save space, and nil when there is none. JSON never starts with the gzip
+// magic bytes, so unpackRaw tells the two apart.
+func packRaw(raw []byte) []byte {
+	if len(raw) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	zw := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(zw)
+	zw.Reset(&buf)
+	if _, err := zw.Write(raw); err != nil || zw.Close() != nil || buf.Len() >= len(raw) {
+		return raw
+	}
+	return buf.Bytes()
+}
+
+// unpackRaw returns the raw output stored as b.
+func unpackRaw(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, gzipMagic) {
+		return b, nil
+	}
+	zr, _ := gzipReaders.Get().(*gzip.Reader)
+	var err error
+	if zr == nil {
+		zr, err = gzip.NewReader(bytes.NewReader(b))
+	} else {
+		err = zr.Reset(bytes.NewReader(b))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReaders.Put(zr)
+	return io.ReadAll(zr)
+}
+
+// compressRawJSON converts raw output stored as TEXT by older versions to a
+// possibly compressed BLOB, then vacuums the database once so the file
+// shrinks. A failed vacuum, e.g. for lack of the temporary disk space it
+// needs, is only logged: the freed space is still reused by new rows.
+func (s *Store) compressRawJSON() error {
+	total := 0
+	for {
+		n, err := s.compressRawJSONBatch()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		if total == 0 {
+			log.Printf("storage: compressing the raw output of stored results, this may take a while")
+		}
+		total += n
+	}
+	if total == 0 {
+		return nil
+	}
+	log.Printf("storage: compressed the raw output of %d results", total)
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		log.Printf("storage: vacuum after compressing: %v", err)
+	}
+	return nil
+}
+
+func (s *Store) compressRawJSONBatch() (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT rowid, CAST(raw_json AS BLOB) FROM results WHERE typeof(raw_json) = 'text' LIMIT ?`, compressBatch)
+	if err != nil {
+		return 0, err
+	}
+	type pending struct {
+		rowid int64
+		raw   []byte
+	}
+	var todo []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.rowid, &p.raw); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		todo = append(todo, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range todo {
+		// An empty string packs to nil, which is how results without raw
+		// output are stored
+		if _, err := tx.Exec(`UPDATE results SET raw_json = ? WHERE rowid = ?`, packRaw(p.raw), p.rowid); err != nil {
+			return 0, fmt.Errorf("row %d: %w", p.rowid, err)
+		}
+	}
+	return len(todo), tx.Commit()
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"speedplane/model"
+)
+
+// ErrResultConflict is returned by SaveResult when a different result is
+// already stored under the same ID.
+var ErrResultConflict = errors.New("a different result with this id already exists")
+
+// fingerprintColumns are the columns a fingerprint is computed from, in the
+// order fingerprint takes them.
+const fingerprintColumns = `timestamp, download_mbps, upload_mbps, ping_ms,
+	       COALESCE(jitter_ms, 0), COALESCE(packet_loss_pct, 0), COALESCE(server_id, '')`
+
+// resultFingerprint identifies a measurement independently of its ID, so the
+// same result saved twice under different IDs (by a retried upload or a
+// repeated import) is recognised.
+func resultFingerprint(r *model.SpeedtestResult) string {
+	return fingerprint(r.Timestamp.Unix(), r.DownloadMbps, r.UploadMbps, r.PingMs, r.JitterMs, r.PacketLossPct, r.ServerID)
+}
+
+func fingerprint(timestamp int64, download, upload, ping, jitter, loss float64, serverID string) string {
+	// Timestamps are hashed in the RFC 3339 form they were once stored in,
+	// so fingerprints from before the switch to Unix seconds stay valid.
+	ts := unixTime(timestamp).Format(time.RFC3339)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%g|%g|%g|%g|%g|%s", ts, download, upload, ping, jitter, loss, serverID)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// scanFingerprint computes the fingerprint of a row selected with
+// fingerprintColumns.
+func scanFingerprint(row interface{ Scan(...interface{}) error }) (string, error) {
+	var timestamp int64
+	var serverID string
+	var download, upload, ping, jitter, loss float64
+	if err := row.Scan(&timestamp, &download, &upload, &ping, &jitter, &loss, &serverID); err != nil {
+		return "", err
+	}
+	return fingerprint(timestamp, download, upload, ping, jitter, loss, serverID), nil
+}
+
+// findDuplicate returns the ID of the stored result that a result with id and
+// fingerprint fp would duplicate, or "" if it is new. It returns
+// ErrResultConflict if id is taken by a different measurement.
+func findDuplicate(ctx context.Context, tx *sql.Tx, id, fp string) (string, error) {
+	// Compare against the stored values rather than the fingerprint column,
+	// which is empty for duplicates found while backfilling.
+	storedFP, err := scanFingerprint(tx.QueryRowContext(ctx, `SELECT `+fingerprintColumns+` FROM results WHERE id = ?`, id))
+	switch {
+	case err == nil:
+		if storedFP != fp {
+			return "", ErrResultConflict
+		}
+		return id, nil
+	case err != sql.ErrNoRows:
+		return "", err
+	}
+
+	var existing string
+	err = tx.QueryRowContext(ctx, `SELECT id FROM results WHERE fingerprint = ?`, fp).Scan(&existing)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return existing, err
+}
+
+// backfillFingerprints fills in the fingerprint of results saved before it
+// existed. Rows that duplicate an earlier result keep an empty fingerprint,
+// so the unique index can still be created; they are left in place rather
+// than deleted.
+func (s *Store) backfillFingerprints() error {
+	rows, err := s.db.Query(`SELECT id, ` + fingerprintColumns + ` FROM results WHERE fingerprint IS NULL ORDER BY timestamp, id`)
+	if err != nil {
+		return err
+	}
+	type pending struct{ id, fp string }
+	var todo []pending
+	for rows.Next() {
+		var p pending
+		var timestamp int64
+		var serverID string
+		var download, upload, ping, jitter, loss float64
+		if err := rows.Scan(&p.id, &timestamp, &download, &upload, &ping, &jitter, &loss, &serverID); err != nil {
+			rows.Close()
+			return err
+		}
+		p.fp = fingerprint(timestamp, download, upload, ping, jitter, loss, serverID)
+		todo = append(todo, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(todo) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range todo {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM results WHERE fingerprint = ?)`, p.fp).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE results SET fingerprint = ? WHERE id = ?`, p.fp, p.id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
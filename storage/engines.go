@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"speedplane/model"
+)
+
+// SaveEngineComparison saves the comparison of a slot's engine results.
+func (s *Store) SaveEngineComparison(ctx context.Context, c model.EngineComparison) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	ids, err := json.Marshal(c.ResultIDs)
+	if err != nil {
+		return err
+	}
+	engines, err := json.Marshal(c.Engines)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+	INSERT INTO engine_comparisons (
+		timestamp, connection, result_ids, engines, download_mbps,
+		upload_mbps, ping_ms, download_divergence_pct, upload_divergence_pct
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		c.Timestamp.Unix(),
+		connectionValue(c.Connection),
+		string(ids),
+		string(engines),
+		c.DownloadMbps,
+		c.UploadMbps,
+		c.PingMs,
+		c.DownloadDivergencePct,
+		c.UploadDivergencePct,
+	)
+	return err
+}
+
+// ListEngineComparisons returns engine comparisons within the time range,
+// oldest first. A non-empty connection limits them to that connection.
+func (s *Store) ListEngineComparisons(ctx context.Context, from, to time.Time, connection string) ([]model.EngineComparison, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	where := `WHERE timestamp >= ? AND timestamp <= ?`
+	args := []interface{}{from.Unix(), to.Unix()}
+	if connection != "" {
+		c, a := connectionClause(connection)
+		where += c
+		args = append(args, a...)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT `+comparisonColumns+`
+	FROM engine_comparisons
+	`+where+`
+	ORDER BY timestamp ASC, id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.EngineComparison
+	for rows.Next() {
+		c, err := scanEngineComparison(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// LatestEngineComparison returns the most recent engine comparison, or nil
+// if there is none.
+func (s *Store) LatestEngineComparison(ctx context.Context) (*model.EngineComparison, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	c, err := scanEngineComparison(s.db.QueryRowContext(ctx, `
+	SELECT `+comparisonColumns+`
+	FROM engine_comparisons
+	ORDER BY timestamp DESC, id DESC
+	LIMIT 1
+	`))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+const comparisonColumns = `id, timestamp, connection, result_ids, engines,
+	download_mbps, upload_mbps, ping_ms, download_divergence_pct,
+	upload_divergence_pct`
+
+func scanEngineComparison(row interface{ Scan(...interface{}) error }) (model.EngineComparison, error) {
+	var c model.EngineComparison
+	var timestamp int64
+	var conn sql.NullString
+	var ids, engines string
+
+	if err := row.Scan(
+		&c.ID,
+		&timestamp,
+		&conn,
+		&ids,
+		&engines,
+		&c.DownloadMbps,
+		&c.UploadMbps,
+		&c.PingMs,
+		&c.DownloadDivergencePct,
+		&c.UploadDivergencePct,
+	); err != nil {
+		return model.EngineComparison{}, err
+	}
+
+	c.Timestamp = unixTime(timestamp)
+	c.Connection = conn.String
+	if err := json.Unmarshal([]byte(ids), &c.ResultIDs); err != nil {
+		return model.EngineComparison{}, fmt.Errorf("parse result ids: %w", err)
+	}
+	if err := json.Unmarshal([]byte(engines), &c.Engines); err != nil {
+		return model.EngineComparison{}, fmt.Errorf("parse engines: %w", err)
+	}
+	return c, nil
+}
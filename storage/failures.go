@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"speedplane/model"
+)
+
+// SaveRunFailure records a speedtest that failed without producing a result.
+func (s *Store) SaveRunFailure(ctx context.Context, f model.RunFailure) error {
+	if s.lowDiskSpace() {
+		return ErrLowDiskSpace
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+	INSERT INTO run_failures (timestamp, error, connection, engine, server_id, server_name)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`,
+		f.Timestamp.Unix(),
+		f.Error,
+		connectionValue(f.Connection),
+		sql.NullString{String: f.Engine, Valid: f.Engine != ""},
+		sql.NullString{String: f.ServerID, Valid: f.ServerID != ""},
+		sql.NullString{String: f.ServerName, Valid: f.ServerName != ""})
+	if err != nil {
+		return err
+	}
+	s.generation.Add(1)
+	return nil
+}
+
+// ListRunFailures returns failed runs within the time range, oldest first.
+// A non-empty connection limits them to that connection.
+func (s *Store) ListRunFailures(ctx context.Context, from, to time.Time, connection string) ([]model.RunFailure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	where := `WHERE timestamp >= ? AND timestamp <= ?`
+	args := []interface{}{from.Unix(), to.Unix()}
+	if connection != "" {
+		c, a := connectionClause(connection)
+		where += c
+		args = append(args, a...)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT id, timestamp, error, connection, engine, server_id, server_name
+	FROM run_failures
+	`+where+`
+	ORDER BY timestamp ASC, id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []model.RunFailure
+	for rows.Next() {
+		var f model.RunFailure
+		var timestamp int64
+		var conn, engine, serverID, serverName sql.NullString
+		if err := rows.Scan(&f.ID, &timestamp, &f.Error, &conn, &engine, &serverID, &serverName); err != nil {
+			return nil, err
+		}
+		f.Timestamp = unixTime(timestamp)
+		f.Connection = conn.String
+		f.Engine = engine.String
+		f.ServerID = serverID.String
+		f.ServerName = serverName.String
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLowDiskSpace is returned instead of saving results and failed runs
+// while the disk holding the database is nearly full, see SetLowDiskSpace.
+var ErrLowDiskSpace = errors.New("disk space is low, results are not being saved")
+
+// WriteStatus is the outcome of the latest attempt to save a result.
+type WriteStatus struct {
+	Time  time.Time
+	Error error // Nil if it was saved
+}
+
+// Path returns the path of the database file.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Ping checks that the database can still be queried. Unlike other calls
+// it doesn't wait for writes in progress, and it isn't limited by the query
+// timeout; ctx bounds how long it may take.
+func (s *Store) Ping(ctx context.Context) error {
+	var one int
+	return s.db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
+// LastWrite returns the outcome of the latest attempt to save a result, or
+// nil if none was made since the store was opened.
+func (s *Store) LastWrite() *WriteStatus {
+	return s.lastWrite.Load()
+}
+
+// SetLowDiskSpace sets the function reporting whether the disk is nearly
+// full, in which case results and failed runs are refused with
+// ErrLowDiskSpace rather than risking a write failing halfway. It must be
+// called before the store is used.
+func (s *Store) SetLowDiskSpace(low func() bool) {
+	s.lowDisk = low
+}
+
+func (s *Store) lowDiskSpace() bool {
+	return s.lowDisk != nil && s.lowDisk()
+}
+
+// recordWrite records the outcome of saving a result for LastWrite. Saves
+// abandoned by their caller and conflicting results say nothing about the
+// database, so they aren't recorded.
+func (s *Store) recordWrite(ctx context.Context, err error) {
+	if ctx.Err() != nil || errors.Is(err, ErrResultConflict) {
+		return
+	}
+	s.lastWrite.Store(&WriteStatus{Time: time.Now(), Error: err})
+}
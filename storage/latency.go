@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"speedplane/model"
+)
+
+// SaveWorkingLatency saves the result of a working latency test.
+func (s *Store) SaveWorkingLatency(ctx context.Context, l model.WorkingLatency) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+	INSERT INTO working_latency (
+		timestamp, target, kind, address, idle_ms, idle_loss_pct,
+		download_ms, download_loss_pct, download_mbps, upload_ms,
+		upload_loss_pct, upload_mbps, error
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		l.Timestamp.Unix(),
+		l.Target,
+		l.Kind,
+		l.Address,
+		l.IdleMs,
+		l.IdleLossPct,
+		l.DownloadMs,
+		l.DownloadLossPct,
+		l.DownloadMbps,
+		l.UploadMs,
+		l.UploadLossPct,
+		l.UploadMbps,
+		l.Error,
+	)
+	return err
+}
+
+// ListWorkingLatency returns working latency tests within the time range,
+// oldest first. A non-empty target limits them to that target.
+func (s *Store) ListWorkingLatency(ctx context.Context, from, to time.Time, target string) ([]model.WorkingLatency, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	where := `WHERE timestamp >= ? AND timestamp <= ?`
+	args := []interface{}{from.Unix(), to.Unix()}
+	if target != "" {
+		where += ` AND target = ?`
+		args = append(args, target)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT `+latencyColumns+`
+	FROM working_latency
+	`+where+`
+	ORDER BY timestamp ASC, id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.WorkingLatency
+	for rows.Next() {
+		l, err := scanWorkingLatency(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+const latencyColumns = `id, timestamp, target, kind, address, idle_ms,
+	idle_loss_pct, download_ms, download_loss_pct, download_mbps, upload_ms,
+	upload_loss_pct, upload_mbps, error`
+
+func scanWorkingLatency(row interface{ Scan(...interface{}) error }) (model.WorkingLatency, error) {
+	var l model.WorkingLatency
+	var timestamp int64
+	var kind, address, errStr sql.NullString
+
+	if err := row.Scan(
+		&l.ID,
+		&timestamp,
+		&l.Target,
+		&kind,
+		&address,
+		&l.IdleMs,
+		&l.IdleLossPct,
+		&l.DownloadMs,
+		&l.DownloadLossPct,
+		&l.DownloadMbps,
+		&l.UploadMs,
+		&l.UploadLossPct,
+		&l.UploadMbps,
+		&errStr,
+	); err != nil {
+		return model.WorkingLatency{}, err
+	}
+
+	l.Timestamp = unixTime(timestamp)
+	l.Kind = kind.String
+	l.Address = address.String
+	l.Error = errStr.String
+	return l, nil
+}
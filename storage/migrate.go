@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timestampTables are the tables with a timestamp column. Timestamps are
+// stored as Unix seconds, so range queries and bucketing compare integers
+// instead of strings whose order depends on their exact formatting.
+var timestampTables = []string{"results", "probe_results", "run_failures"}
+
+// unixTime converts a stored timestamp back to a UTC time.
+func unixTime(sec int64) time.Time {
+	return time.Unix(sec, 0).UTC()
+}
+
+// migrateTimestamps converts tables created by older versions, which stored
+// RFC 3339 text, to integer timestamps. SQLite can't change a column's type
+// in place, so each table is recreated from its own definition with the
+// timestamp column changed and the rows copied across, all in one
+// transaction. Indexes are dropped with the old table; initSchema recreates
+// them.
+func (s *Store) migrateTimestamps() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	migrated := false
+	for _, table := range timestampTables {
+		var colType string
+		err := tx.QueryRow(`SELECT type FROM pragma_table_info(?) WHERE name = 'timestamp'`, table).Scan(&colType)
+		if err != nil {
+			return fmt.Errorf("%s: read timestamp column: %w", table, err)
+		}
+		if strings.EqualFold(colType, "INTEGER") {
+			continue
+		}
+
+		var ddl string
+		if err := tx.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&ddl); err != nil {
+			return fmt.Errorf("%s: read table definition: %w", table, err)
+		}
+		newDDL := strings.Replace(ddl, "timestamp TEXT NOT NULL", "timestamp INTEGER NOT NULL", 1)
+		if newDDL == ddl {
+			return fmt.Errorf("%s: unexpected timestamp column definition", table)
+		}
+
+		var columns []string
+		rows, err := tx.Query(`SELECT name FROM pragma_table_info(?) ORDER BY cid`, table)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			columns = append(columns, name)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		selects := make([]string, len(columns))
+		for i, c := range columns {
+			selects[i] = c
+			if c == "timestamp" {
+				// strftime accepts fractional seconds and UTC offsets, which
+				// older rows or other tools may have written.
+				selects[i] = `CAST(strftime('%s', timestamp) AS INTEGER)`
+			}
+		}
+
+		old := table + "_old"
+		stmts := []string{
+			fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, table, old),
+			newDDL,
+			fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM %s`, table, strings.Join(columns, ", "), strings.Join(selects, ", "), old),
+			fmt.Sprintf(`DROP TABLE %s`, old),
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return fmt.Errorf("%s: convert timestamps: %w", table, err)
+			}
+		}
+		migrated = true
+	}
+
+	if !migrated {
+		return nil
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// TimestampAudit sums up the signs of rows in a table having been stored
+// in local time rather than UTC. Such rows read as if the local time were
+// UTC: shifted by the zone's offset, later than they happened east of UTC
+// and earlier west of it.
+type TimestampAudit struct {
+	Table  string          `json:"table"`
+	Rows   int             `json:"rows"`
+	Future int             `json:"future"` // Rows timestamped after now
+	Steps  []TimestampStep `json:"steps"`  // Where timestamps go back in the order rows were stored
+}
+
+// TimestampStep is a row whose timestamp is earlier than that of the row
+// stored before it. A step back of up to the zone's UTC offset is where
+// rows stored in local time east of UTC give way to rows stored in UTC.
+type TimestampStep struct {
+	Row      int64     `json:"row"` // SQLite rowid, in the order rows were stored
+	Previous time.Time `json:"previous"`
+	At       time.Time `json:"at"`
+}
+
+// Back returns how far the timestamps step back.
+func (s TimestampStep) Back() time.Duration {
+	return s.Previous.Sub(s.At)
+}
+
+// TimestampTables returns the tables whose timestamps AuditTimestamps and
+// NormalizeTimestamps work on.
+func TimestampTables() []string {
+	return slices.Clone(timestampTables)
+}
+
+// AuditTimestamps looks for rows of table stored in local time, as of now.
+// Steps back of less than minStep are ignored, as results saved late, e.g.
+// ingested ones, make small ones.
+func (s *Store) AuditTimestamps(ctx context.Context, table string, now time.Time, minStep time.Duration) (TimestampAudit, error) {
+	if !slices.Contains(timestampTables, table) {
+		return TimestampAudit{}, fmt.Errorf("unknown table %q", table)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT rowid, timestamp FROM %s ORDER BY rowid`, table))
+	if err != nil {
+		return TimestampAudit{}, err
+	}
+	defer rows.Close()
+
+	audit := TimestampAudit{Table: table, Steps: []TimestampStep{}}
+	var prev int64
+	for rows.Next() {
+		var rowID, ts int64
+		if err := rows.Scan(&rowID, &ts); err != nil {
+			return TimestampAudit{}, err
+		}
+		if audit.Rows > 0 && time.Duration(prev-ts)*time.Second >= minStep {
+			audit.Steps = append(audit.Steps, TimestampStep{Row: rowID, Previous: unixTime(prev), At: unixTime(ts)})
+		}
+		if ts > now.Unix() {
+			audit.Future++
+		}
+		audit.Rows++
+		prev = ts
+	}
+	return audit, rows.Err()
+}
+
+// TimestampSelection picks the rows NormalizeTimestamps converts: those
+// stored before row BeforeRow, or timestamped before Before.
+type TimestampSelection struct {
+	BeforeRow int64
+	Before    time.Time
+}
+
+// NormalizeTimestamps converts the timestamps of the selected rows of table
+// from local time in zone, misread as UTC, to UTC, all in one transaction.
+// Each row gets the offset zone had at its time, so daylight saving time is
+// accounted for. It returns how many rows were converted.
+func (s *Store) NormalizeTimestamps(ctx context.Context, table string, zone *time.Location, sel TimestampSelection) (int, error) {
+	if !slices.Contains(timestampTables, table) {
+		return 0, fmt.Errorf("unknown table %q", table)
+	}
+	where, arg := `rowid < ?`, sel.BeforeRow
+	switch {
+	case sel.BeforeRow > 0 && !sel.Before.IsZero():
+		return 0, fmt.Errorf("select rows by row or by time, not both")
+	case !sel.Before.IsZero():
+		where, arg = `timestamp < ?`, sel.Before.Unix()
+	case sel.BeforeRow <= 0:
+		return 0, fmt.Errorf("no rows selected")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT rowid, timestamp FROM %s WHERE %s`, table, where), arg)
+	if err != nil {
+		return 0, err
+	}
+	converted := make(map[int64]int64)
+	for rows.Next() {
+		var rowID, ts int64
+		if err := rows.Scan(&rowID, &ts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		converted[rowID] = localToUTC(unixTime(ts), zone).Unix()
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(`UPDATE %s SET timestamp = ? WHERE rowid = ?`, table))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for rowID, ts := range converted {
+		if _, err := stmt.ExecContext(ctx, ts, rowID); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	s.generation.Add(1)
+	return len(converted), nil
+}
+
+// localToUTC returns the instant whose wall clock in zone reads what t's
+// does in UTC.
+func localToUTC(t time.Time, zone *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), zone).UTC()
+}
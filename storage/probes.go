@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"speedplane/model"
+)
+
+// probeInsertChunk is how many probe results go into one INSERT, keeping
+// multi-row inserts well under SQLite's bound-parameter limit.
+const probeInsertChunk = 500
+
+// SaveProbeResults saves probe results, such as a round or a batch from a
+// BatchWriter, in one transaction using multi-row inserts.
+func (s *Store) SaveProbeResults(ctx context.Context, results []model.ProbeResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `
+	INSERT INTO probe_results (
+		timestamp, target, kind, address, sent, received, loss_pct,
+		rtt_min_ms, rtt_avg_ms, rtt_max_ms, result_id, error
+	) VALUES `
+	for start := 0; start < len(results); start += probeInsertChunk {
+		chunk := results[start:min(start+probeInsertChunk, len(results))]
+		values := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?), ", len(chunk)), ", ")
+		args := make([]interface{}, 0, len(chunk)*12)
+		for _, p := range chunk {
+			args = append(args,
+				p.Timestamp.Unix(),
+				p.Target,
+				p.Kind,
+				p.Address,
+				p.Sent,
+				p.Received,
+				p.LossPct,
+				p.RTTMinMs,
+				p.RTTAvgMs,
+				p.RTTMaxMs,
+				p.ResultID,
+				p.Error,
+			)
+		}
+		if _, err := tx.ExecContext(ctx, query+values, args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListProbeResults returns probe results within the time range, oldest first.
+// An empty target returns results for all targets.
+func (s *Store) ListProbeResults(ctx context.Context, from, to time.Time, target string) ([]model.ProbeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT id, timestamp, target, kind, address, sent, received, loss_pct,
+	       rtt_min_ms, rtt_avg_ms, rtt_max_ms, result_id, error
+	FROM probe_results
+	WHERE timestamp >= ? AND timestamp <= ? AND (? = '' OR target = ?)
+	ORDER BY timestamp ASC, id ASC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, from.Unix(), to.Unix(), target, target)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanProbeResults(rows)
+}
+
+// ProbeResultsForRun returns the probe results recorded alongside a speedtest result.
+func (s *Store) ProbeResultsForRun(ctx context.Context, resultID string) ([]model.ProbeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT id, timestamp, target, kind, address, sent, received, loss_pct,
+	       rtt_min_ms, rtt_avg_ms, rtt_max_ms, result_id, error
+	FROM probe_results
+	WHERE result_id = ?
+	ORDER BY target ASC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, resultID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanProbeResults(rows)
+}
+
+// LatestProbeResults returns the most recent probe result for each target.
+func (s *Store) LatestProbeResults(ctx context.Context) ([]model.ProbeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT id, timestamp, target, kind, address, sent, received, loss_pct,
+	       rtt_min_ms, rtt_avg_ms, rtt_max_ms, result_id, error
+	FROM probe_results
+	WHERE id IN (SELECT MAX(id) FROM probe_results GROUP BY target)
+	ORDER BY target ASC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanProbeResults(rows)
+}
+
+func scanProbeResults(rows *sql.Rows) ([]model.ProbeResult, error) {
+	var results []model.ProbeResult
+	for rows.Next() {
+		var p model.ProbeResult
+		var timestamp int64
+		var rttMin, rttAvg, rttMax sql.NullFloat64
+		var resultID, errStr sql.NullString
+
+		if err := rows.Scan(
+			&p.ID,
+			&timestamp,
+			&p.Target,
+			&p.Kind,
+			&p.Address,
+			&p.Sent,
+			&p.Received,
+			&p.LossPct,
+			&rttMin,
+			&rttAvg,
+			&rttMax,
+			&resultID,
+			&errStr,
+		); err != nil {
+			return nil, err
+		}
+
+		p.Timestamp = unixTime(timestamp)
+		p.RTTMinMs = rttMin.Float64
+		p.RTTAvgMs = rttAvg.Float64
+		p.RTTMaxMs = rttMax.Float64
+		p.ResultID = resultID.String
+		p.Error = errStr.String
+
+		results = append(results, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
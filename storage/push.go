@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+
+	"speedplane/model"
+)
+
+// SavePushSubscription stores a browser's push subscription, replacing the
+// keys of an existing subscription to the same endpoint.
+func (s *Store) SavePushSubscription(ctx context.Context, sub model.PushSubscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+	INSERT INTO push_subscriptions (endpoint, p256dh, auth, created_at) VALUES (?, ?, ?, ?)
+	ON CONFLICT(endpoint) DO UPDATE SET p256dh = excluded.p256dh, auth = excluded.auth
+	`, sub.Endpoint, sub.Keys.P256DH, sub.Keys.Auth, sub.Created.Unix())
+	return err
+}
+
+// ListPushSubscriptions returns all push subscriptions, oldest first.
+func (s *Store) ListPushSubscriptions(ctx context.Context) ([]model.PushSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT endpoint, p256dh, auth, created_at
+	FROM push_subscriptions
+	ORDER BY created_at ASC, endpoint ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []model.PushSubscription
+	for rows.Next() {
+		var sub model.PushSubscription
+		var created int64
+		if err := rows.Scan(&sub.Endpoint, &sub.Keys.P256DH, &sub.Keys.Auth, &created); err != nil {
+			return nil, err
+		}
+		sub.Created = unixTime(created)
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// DeletePushSubscription removes the subscription to endpoint, reporting
+// whether there was one.
+func (s *Store) DeletePushSubscription(ctx context.Context, endpoint string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM push_subscriptions WHERE endpoint = ?`, endpoint)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"speedplane/model"
+)
+
+// ScoreServers scores the test servers used on a connection within the time
+// range from their results and failed runs (see model.ScoreServers). An
+// empty connection scores servers across all connections, which mixes lines
+// of different speeds into the fleet median.
+func (s *Store) ScoreServers(ctx context.Context, from, to time.Time, connection string, maxDeviationPct float64) ([]model.ServerQuality, error) {
+	results, err := s.ListResultsPage(ctx, from, to, ResultFilter{Connection: connection}, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	failures, err := s.ListRunFailures(ctx, from, to, connection)
+	if err != nil {
+		return nil, err
+	}
+	return model.ScoreServers(results, failures, maxDeviationPct), nil
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// hiddenTables can't be queried through Query: they hold secrets rather than
+// measurements.
+var hiddenTables = []string{"push_subscriptions"}
+
+// QueryResult is the outcome of an ad-hoc query.
+type QueryResult struct {
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Truncated bool            `json:"truncated"` // The query matched more rows than the limit
+}
+
+// CheckQuery reports whether query is a single SELECT statement (a WITH
+// clause may come first) that doesn't touch hiddenTables. Writes are also
+// refused by the read-only connection Query uses, so this is about clear
+// errors rather than the last line of defense.
+func CheckQuery(query string) error {
+	tokens, err := sqlTokens(query)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return errors.New("empty query")
+	}
+	if first := strings.ToUpper(tokens[0]); first != "SELECT" && first != "WITH" {
+		return errors.New("only SELECT queries are allowed")
+	}
+	for _, tok := range tokens {
+		for _, table := range hiddenTables {
+			if strings.EqualFold(tok, table) {
+				return fmt.Errorf("table %s can't be queried", table)
+			}
+		}
+	}
+	return nil
+}
+
+// sqlTokens splits a statement into its words and identifiers, with quoted
+// identifiers unquoted, leaving out literals, comments and punctuation. It
+// refuses more than one statement.
+func sqlTokens(query string) ([]string, error) {
+	var tokens []string
+	ended := false // After a ";"
+	for i := 0; i < len(query); {
+		r, size := utf8.DecodeRuneInString(query[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			continue
+		case strings.HasPrefix(query[i:], "--"):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(query)
+			}
+			continue
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+			i += 2 + end + 2
+			continue
+		}
+		if ended {
+			return nil, errors.New("only one statement is allowed")
+		}
+		switch {
+		case r == ';':
+			ended = true
+			i++
+		case r == '\'':
+			end, err := closingQuote(query, i, '\'')
+			if err != nil {
+				return nil, err
+			}
+			i = end + 1
+		case r == '"' || r == '`' || r == '[':
+			closing := r
+			if r == '[' {
+				closing = ']'
+			}
+			end, err := closingQuote(query, i, byte(closing))
+			if err != nil {
+				return nil, err
+			}
+			ident := query[i+1 : end]
+			if closing != ']' {
+				ident = strings.ReplaceAll(ident, string(closing)+string(closing), string(closing))
+			}
+			tokens = append(tokens, ident)
+			i = end + 1
+		case r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			start := i
+			for i < len(query) {
+				r, size := utf8.DecodeRuneInString(query[i:])
+				if r != '_' && r != '$' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, query[start:i])
+		default:
+			i += size
+		}
+	}
+	return tokens, nil
+}
+
+// closingQuote returns the index of the quote closing the one at start,
+// skipping doubled quotes, which escape it, except for "]".
+func closingQuote(query string, start int, quote byte) (int, error) {
+	for i := start + 1; i < len(query); i++ {
+		if query[i] != quote {
+			continue
+		}
+		if quote != ']' && i+1 < len(query) && query[i+1] == quote {
+			i++
+			continue
+		}
+		return i, nil
+	}
+	return 0, errors.New("unterminated quote")
+}
+
+// Query runs an ad-hoc query checked by CheckQuery on a separate read-only
+// connection, returning up to maxRows rows. ctx bounds how long it may
+// run. Text is returned as strings; compressed raw output as bytes.
+func (s *Store) Query(ctx context.Context, query string, maxRows int) (*QueryResult, error) {
+	if err := CheckQuery(query); err != nil {
+		return nil, err
+	}
+	db, err := s.readOnlyDB()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &QueryResult{Columns: cols, Rows: [][]interface{}{}}
+	for rows.Next() {
+		if len(res.Rows) == maxRows {
+			res.Truncated = true
+			break
+		}
+		row := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		for i, v := range row {
+			if b, ok := v.([]byte); ok && utf8.Valid(b) {
+				row[i] = string(b)
+			}
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// readOnlyDB returns the read-only connection to the database used by
+// Query, opening it on first use. SQLite refuses writes through it even if
+// a query got past CheckQuery.
+func (s *Store) readOnlyDB() (*sql.DB, error) {
+	s.roMu.Lock()
+	defer s.roMu.Unlock()
+	if s.ro != nil {
+		return s.ro, nil
+	}
+	dsn := "file:" + (&url.URL{Path: s.path}).EscapedPath() + "?mode=ro&_pragma=query_only(1)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open read-only database: %w", err)
+	}
+	// Ad-hoc queries shouldn't take every core from the scheduled tests
+	db.SetMaxOpenConns(2)
+	s.ro = db
+	return db, nil
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"speedplane/model"
+)
+
+// SaveReachabilityCheck saves the result of a reachability check.
+func (s *Store) SaveReachabilityCheck(ctx context.Context, c model.ReachabilityCheck) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	var reachable sql.NullBool
+	if c.Reachable != nil {
+		reachable = sql.NullBool{Bool: *c.Reachable, Valid: true}
+	}
+	_, err := s.db.ExecContext(ctx, `
+	INSERT INTO reachability_checks (
+		timestamp, public_ip, router_ip, router_source, cgnat, port,
+		reachable, error
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		c.Timestamp.Unix(),
+		c.PublicIP,
+		c.RouterIP,
+		c.RouterSource,
+		c.CGNAT,
+		c.Port,
+		reachable,
+		c.Error,
+	)
+	return err
+}
+
+// ListReachabilityChecks returns reachability checks within the time range,
+// oldest first.
+func (s *Store) ListReachabilityChecks(ctx context.Context, from, to time.Time) ([]model.ReachabilityCheck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT `+reachabilityColumns+`
+	FROM reachability_checks
+	WHERE timestamp >= ? AND timestamp <= ?
+	ORDER BY timestamp ASC, id ASC
+	`, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.ReachabilityCheck
+	for rows.Next() {
+		c, err := scanReachabilityCheck(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// LatestReachabilityCheck returns the most recent reachability check, or nil
+// if there is none.
+func (s *Store) LatestReachabilityCheck(ctx context.Context) (*model.ReachabilityCheck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	c, err := scanReachabilityCheck(s.db.QueryRowContext(ctx, `
+	SELECT `+reachabilityColumns+`
+	FROM reachability_checks
+	ORDER BY timestamp DESC, id DESC
+	LIMIT 1
+	`))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+const reachabilityColumns = `id, timestamp, public_ip, router_ip, router_source,
+	cgnat, port, reachable, error`
+
+func scanReachabilityCheck(row interface{ Scan(...interface{}) error }) (model.ReachabilityCheck, error) {
+	var c model.ReachabilityCheck
+	var timestamp int64
+	var publicIP, routerIP, source, errStr sql.NullString
+	var port sql.NullInt64
+	var reachable sql.NullBool
+
+	if err := row.Scan(
+		&c.ID,
+		&timestamp,
+		&publicIP,
+		&routerIP,
+		&source,
+		&c.CGNAT,
+		&port,
+		&reachable,
+		&errStr,
+	); err != nil {
+		return model.ReachabilityCheck{}, err
+	}
+
+	c.Timestamp = unixTime(timestamp)
+	c.PublicIP = publicIP.String
+	c.RouterIP = routerIP.String
+	c.RouterSource = source.String
+	c.Port = int(port.Int64)
+	if reachable.Valid {
+		c.Reachable = &reachable.Bool
+	}
+	c.Error = errStr.String
+	return c, nil
+}
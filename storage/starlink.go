@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"speedplane/model"
+)
+
+// SaveStarlinkStatus saves a reading of a Starlink dish's status.
+func (s *Store) SaveStarlinkStatus(ctx context.Context, st model.StarlinkStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	INSERT INTO starlink_status (
+		timestamp, dish_id, software_version, uptime_s, downlink_mbps,
+		uplink_mbps, ping_ms, ping_drop_pct, obstructed_pct,
+		currently_obstructed, outage_cause, outage_s, error
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.ExecContext(ctx, query,
+		st.Timestamp.Unix(),
+		st.DishID,
+		st.SoftwareVersion,
+		st.UptimeS,
+		st.DownlinkMbps,
+		st.UplinkMbps,
+		st.PingMs,
+		st.PingDropPct,
+		st.ObstructedPct,
+		st.CurrentlyObstructed,
+		st.OutageCause,
+		st.OutageS,
+		st.Error,
+	)
+	return err
+}
+
+// ListStarlinkStatus returns Starlink readings within the time range, oldest
+// first.
+func (s *Store) ListStarlinkStatus(ctx context.Context, from, to time.Time) ([]model.StarlinkStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT ` + starlinkColumns + `
+	FROM starlink_status
+	WHERE timestamp >= ? AND timestamp <= ?
+	ORDER BY timestamp ASC, id ASC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.StarlinkStatus
+	for rows.Next() {
+		st, err := scanStarlinkStatus(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
+
+// LatestStarlinkStatus returns the most recent Starlink reading, or nil if
+// there is none.
+func (s *Store) LatestStarlinkStatus(ctx context.Context) (*model.StarlinkStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT ` + starlinkColumns + `
+	FROM starlink_status
+	ORDER BY timestamp DESC, id DESC
+	LIMIT 1
+	`
+
+	st, err := scanStarlinkStatus(s.db.QueryRowContext(ctx, query))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+const starlinkColumns = `id, timestamp, dish_id, software_version, uptime_s,
+	downlink_mbps, uplink_mbps, ping_ms, ping_drop_pct, obstructed_pct,
+	currently_obstructed, outage_cause, outage_s, error`
+
+func scanStarlinkStatus(row interface{ Scan(...interface{}) error }) (model.StarlinkStatus, error) {
+	var st model.StarlinkStatus
+	var timestamp int64
+	var uptime sql.NullInt64
+	var ping, outageS sql.NullFloat64
+	var dishID, software, cause, errStr sql.NullString
+
+	if err := row.Scan(
+		&st.ID,
+		&timestamp,
+		&dishID,
+		&software,
+		&uptime,
+		&st.DownlinkMbps,
+		&st.UplinkMbps,
+		&ping,
+		&st.PingDropPct,
+		&st.ObstructedPct,
+		&st.CurrentlyObstructed,
+		&cause,
+		&outageS,
+		&errStr,
+	); err != nil {
+		return model.StarlinkStatus{}, err
+	}
+
+	st.Timestamp = unixTime(timestamp)
+	st.DishID = dishID.String
+	st.SoftwareVersion = software.String
+	st.UptimeS = uptime.Int64
+	st.PingMs = ping.Float64
+	st.OutageCause = cause.String
+	st.OutageS = outageS.Float64
+	st.Error = errStr.String
+	return st, nil
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -15,10 +17,26 @@ import (
 	"speedplane/model"
 )
 
+// DefaultQueryTimeout is how long a database call may take before it is
+// cancelled, unless SetQueryTimeout changes it.
+const DefaultQueryTimeout = 30 * time.Second
+
 // Store provides persistent storage for speedtest results using SQLite.
+// Its methods take a context: cancelling it, or the query timeout running
+// out, abandons the call with the context's error.
 type Store struct {
-	db *sql.DB
-	mu sync.Mutex
+	db      *sql.DB
+	mu      sync.Mutex
+	timeout time.Duration
+
+	generation atomic.Uint64 // See Generation
+
+	path      string                      // See Path
+	lastWrite atomic.Pointer[WriteStatus] // See LastWrite
+	lowDisk   func() bool                 // See SetLowDiskSpace
+
+	roMu sync.Mutex
+	ro   *sql.DB // Read-only connection for Query, opened on first use
 }
 
 // resolveDBPath determines the final database path based on the provided dbPath and dataDir.
@@ -61,7 +79,7 @@ func New(dbPath, dataDir string) (*Store, error) {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
 
-	store := &Store{db: db}
+	store := &Store{db: db, timeout: DefaultQueryTimeout, path: finalPath}
 
 	// Initialize the database schema
 	if err := store.initSchema(); err != nil {
@@ -72,12 +90,17 @@ func New(dbPath, dataDir string) (*Store, error) {
 	return store, nil
 }
 
-// initSchema creates the results table if it doesn't exist.
+// initSchema creates the results, probe_results, run_failures,
+// result_rollups, annotations, starlink_status, wan_utilization,
+// reachability_checks, working_latency, engine_comparisons, alert_events,
+// alert_snoozes and push_subscriptions tables if they don't exist and
+// migrates databases created by older versions: it adds new columns,
+// converts text timestamps to Unix seconds and compresses raw engine output.
 func (s *Store) initSchema() error {
-	query := `
+	tables := `
 	CREATE TABLE IF NOT EXISTS results (
 		id TEXT PRIMARY KEY,
-		timestamp TEXT NOT NULL,
+		timestamp INTEGER NOT NULL,
 		download_mbps REAL NOT NULL,
 		upload_mbps REAL NOT NULL,
 		ping_ms REAL NOT NULL,
@@ -92,44 +115,461 @@ func (s *Store) initSchema() error {
 		created_at TEXT NOT NULL DEFAULT (datetime('now'))
 	);
 
-	CREATE INDEX IF NOT EXISTS idx_results_timestamp ON results(timestamp);
+	CREATE TABLE IF NOT EXISTS probe_results (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		target TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		address TEXT NOT NULL,
+		sent INTEGER NOT NULL,
+		received INTEGER NOT NULL,
+		loss_pct REAL NOT NULL,
+		rtt_min_ms REAL,
+		rtt_avg_ms REAL,
+		rtt_max_ms REAL,
+		result_id TEXT,
+		error TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS run_failures (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		error TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS result_rollups (
+		day INTEGER PRIMARY KEY,
+		count INTEGER NOT NULL,
+		download_avg REAL NOT NULL,
+		download_min REAL NOT NULL,
+		download_max REAL NOT NULL,
+		upload_avg REAL NOT NULL,
+		upload_min REAL NOT NULL,
+		upload_max REAL NOT NULL,
+		ping_avg REAL NOT NULL,
+		ping_min REAL NOT NULL,
+		ping_max REAL NOT NULL,
+		jitter_avg REAL NOT NULL,
+		packet_loss_avg REAL NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS starlink_status (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		dish_id TEXT,
+		software_version TEXT,
+		uptime_s INTEGER,
+		downlink_mbps REAL NOT NULL,
+		uplink_mbps REAL NOT NULL,
+		ping_ms REAL,
+		ping_drop_pct REAL NOT NULL,
+		obstructed_pct REAL NOT NULL,
+		currently_obstructed INTEGER NOT NULL,
+		outage_cause TEXT,
+		outage_s REAL,
+		error TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS wan_utilization (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		connection TEXT,
+		download_mbps REAL NOT NULL,
+		upload_mbps REAL NOT NULL,
+		download_pct REAL,
+		upload_pct REAL,
+		error TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS reachability_checks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		public_ip TEXT,
+		router_ip TEXT,
+		router_source TEXT,
+		cgnat INTEGER NOT NULL,
+		port INTEGER,
+		reachable INTEGER,
+		error TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS engine_comparisons (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		connection TEXT,
+		result_ids TEXT NOT NULL,
+		engines TEXT NOT NULL,
+		download_mbps REAL NOT NULL,
+		upload_mbps REAL NOT NULL,
+		ping_ms REAL NOT NULL,
+		download_divergence_pct REAL NOT NULL,
+		upload_divergence_pct REAL NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS working_latency (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		target TEXT NOT NULL,
+		kind TEXT,
+		address TEXT,
+		idle_ms REAL NOT NULL,
+		idle_loss_pct REAL NOT NULL,
+		download_ms REAL NOT NULL,
+		download_loss_pct REAL NOT NULL,
+		download_mbps REAL NOT NULL,
+		upload_ms REAL NOT NULL,
+		upload_loss_pct REAL NOT NULL,
+		upload_mbps REAL NOT NULL,
+		error TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS annotations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		start_time INTEGER NOT NULL,
+		end_time INTEGER NOT NULL,
+		text TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS alert_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		rule_id TEXT NOT NULL,
+		rule_name TEXT NOT NULL,
+		metric TEXT NOT NULL,
+		operator TEXT NOT NULL,
+		threshold REAL NOT NULL,
+		value REAL NOT NULL,
+		severity TEXT NOT NULL,
+		since INTEGER NOT NULL,
+		schedule TEXT,
+		result_id TEXT,
+		acknowledged_at INTEGER
+	);
+	CREATE INDEX IF NOT EXISTS idx_alert_events_time ON alert_events(time);
+	CREATE INDEX IF NOT EXISTS idx_alert_events_rule ON alert_events(rule_id, time);
+
+	CREATE TABLE IF NOT EXISTS alert_snoozes (
+		schedule TEXT NOT NULL DEFAULT '',
+		rule_id TEXT NOT NULL,
+		until INTEGER NOT NULL,
+		PRIMARY KEY (schedule, rule_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS push_subscriptions (
+		endpoint TEXT PRIMARY KEY,
+		p256dh TEXT NOT NULL,
+		auth TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	);
 	`
 
-	_, err := s.db.Exec(query)
+	if _, err := s.db.Exec(tables); err != nil {
+		return err
+	}
+
+	err := s.addColumns("results", []column{
+		{"link_interface", "TEXT"},
+		{"link_type", "TEXT"},
+		{"link_speed_mbps", "INTEGER"},
+		{"link_ssid", "TEXT"},
+		{"link_signal_dbm", "INTEGER"},
+		{"lan_json", "TEXT"},
+		{"fingerprint", "TEXT"},
+		{"tags", "TEXT"},
+		{"connection", "TEXT"},
+		{"signature", "TEXT"},
+		{"path_mtu_json", "TEXT"},
+		{"engine", "TEXT"},
+		{"note", "TEXT"},
+		{"phases_json", "TEXT"},
+		{"timings_json", "TEXT"},
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.addColumns("result_rollups", []column{
+		{"consistency_score", "REAL"},
+		{"consistency_json", "TEXT"},
+		{"distributions_json", "TEXT"},
+	}); err != nil {
+		return err
+	}
+	if err := s.addColumns("alert_events", []column{
+		{"snoozed", "INTEGER NOT NULL DEFAULT 0"},
+	}); err != nil {
+		return err
+	}
+	if err := s.addColumns("run_failures", []column{
+		{"connection", "TEXT"},
+		{"engine", "TEXT"},
+		{"server_id", "TEXT"},
+		{"server_name", "TEXT"},
+	}); err != nil {
+		return err
+	}
+
+	if err := s.migrateTimestamps(); err != nil {
+		return fmt.Errorf("migrate timestamps: %w", err)
+	}
+
+	if err := s.backfillFingerprints(); err != nil {
+		return fmt.Errorf("backfill fingerprints: %w", err)
+	}
+
+	if err := s.compressRawJSON(); err != nil {
+		return fmt.Errorf("compress raw output: %w", err)
+	}
+
+	indexes := `
+	CREATE INDEX IF NOT EXISTS idx_results_timestamp ON results(timestamp);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_results_fingerprint ON results(fingerprint);
+	CREATE INDEX IF NOT EXISTS idx_probe_results_timestamp ON probe_results(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_probe_results_result_id ON probe_results(result_id);
+	CREATE INDEX IF NOT EXISTS idx_run_failures_timestamp ON run_failures(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_annotations_start_time ON annotations(start_time);
+	CREATE INDEX IF NOT EXISTS idx_starlink_status_timestamp ON starlink_status(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_wan_utilization_timestamp ON wan_utilization(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_reachability_checks_timestamp ON reachability_checks(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_working_latency_timestamp ON working_latency(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_engine_comparisons_timestamp ON engine_comparisons(timestamp);
+	`
+	_, err = s.db.Exec(indexes)
 	return err
 }
 
+type column struct {
+	name, decl string
+}
+
+// addColumns adds any of cols that table doesn't have yet. SQLite has no
+// ADD COLUMN IF NOT EXISTS, so existing columns are read from table_info.
+func (s *Store) addColumns(table string, cols []column) error {
+	rows, err := s.db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range cols {
+		if existing[c.name] {
+			continue
+		}
+		if _, err := s.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, c.name, c.decl)); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", table, c.name, err)
+		}
+	}
+	return nil
+}
+
+// SetQueryTimeout sets how long a database call may take, so a stalled disk
+// can't hang its callers indefinitely; 0 restores DefaultQueryTimeout. Calls
+// that run several queries, such as EachResult, apply it to each query.
+func (s *Store) SetQueryTimeout(d time.Duration) {
+	if d <= 0 {
+		d = DefaultQueryTimeout
+	}
+	s.mu.Lock()
+	s.timeout = d
+	s.mu.Unlock()
+}
+
+// Generation returns a number that changes whenever results or failed runs
+// are saved or deleted, for caching what is computed from them.
+func (s *Store) Generation() uint64 {
+	return s.generation.Load()
+}
+
+// queryContext limits ctx to the query timeout. Callers hold s.mu.
+func (s *Store) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.timeout)
+}
+
 // EnsureDirs is a no-op for SQLite storage (kept for compatibility).
 func (s *Store) EnsureDirs() error {
 	return nil
 }
 
-// SaveResult saves a speedtest result to the database.
-func (s *Store) SaveResult(res *model.SpeedtestResult) error {
+// resultColumns lists the results columns in the order scanResult expects.
+const resultColumns = `id, timestamp, download_mbps, upload_mbps, ping_ms, jitter_ms,
+	       packet_loss_pct, isp, external_ip, server_id, server_name,
+	       server_country, raw_json, link_interface, link_type,
+	       link_speed_mbps, link_ssid, link_signal_dbm, lan_json, tags,
+	       connection, signature, path_mtu_json, engine, note, phases_json,
+	       timings_json`
+
+// ResultFilter narrows result queries beyond the time range. The zero value
+// matches every result.
+type ResultFilter struct {
+	LinkType model.LinkType // Only results recorded over this kind of link
+	Tag      string         // Only results carrying this tag
+	ServerID string         // Only results measured against this test server
+	Engine   string         // Only results measured with this engine
+
+	// Connection limits results to one named connection; DefaultConnection
+	// matches results stored without a connection.
+	Connection string
+}
+
+// where returns the WHERE clause and arguments for results within from/to
+// that match f.
+func (f ResultFilter) where(from, to time.Time) (string, []interface{}) {
+	clause := `WHERE timestamp >= ? AND timestamp <= ?`
+	args := []interface{}{from.Unix(), to.Unix()}
+	if f.LinkType != "" {
+		clause += ` AND link_type = ?`
+		args = append(args, string(f.LinkType))
+	}
+	if f.Tag != "" {
+		clause += ` AND EXISTS (SELECT 1 FROM json_each(results.tags) WHERE value = ?)`
+		args = append(args, f.Tag)
+	}
+	if f.ServerID != "" {
+		clause += ` AND server_id = ?`
+		args = append(args, f.ServerID)
+	}
+	if f.Engine != "" {
+		c, a := engineClause(f.Engine)
+		clause += c
+		args = append(args, a...)
+	}
+	if f.Connection != "" {
+		c, a := connectionClause(f.Connection)
+		clause += c
+		args = append(args, a...)
+	}
+	return clause, args
+}
+
+// SaveResult saves a speedtest result to the database, assigning an ID if it
+// has none. Saving is idempotent: if the same measurement is already stored,
+// under this ID or another one, nothing is written and res.ID is set to the
+// stored result's ID. A different result with the same ID is never
+// overwritten; ErrResultConflict is returned instead.
+func (s *Store) SaveResult(ctx context.Context, res *model.SpeedtestResult) error {
+	_, err := s.SaveResultIfNew(ctx, res)
+	return err
+}
+
+// SaveResultIfNew is SaveResult, also reporting whether res was written:
+// false when the same measurement was already stored.
+func (s *Store) SaveResultIfNew(ctx context.Context, res *model.SpeedtestResult) (bool, error) {
+	if s.lowDiskSpace() {
+		return false, ErrLowDiskSpace
+	}
+	created, err := s.saveResultIfNew(ctx, res)
+	s.recordWrite(ctx, err)
+	return created, err
+}
+
+func (s *Store) saveResultIfNew(ctx context.Context, res *model.SpeedtestResult) (bool, error) {
 	if res == nil {
-		return fmt.Errorf("nil result")
+		return false, fmt.Errorf("nil result")
+	}
+	if res.ID == "" {
+		res.ID = model.NewID()
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	fp := resultFingerprint(res)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	existingID, err := findDuplicate(ctx, tx, res.ID, fp)
+	if err != nil {
+		return false, err
+	}
+	if existingID != "" {
+		res.ID = existingID
+		return false, nil
+	}
+
+	rawJSON := packRaw(res.RawJSON)
+
+	var linkInterface, linkType, linkSSID sql.NullString
+	var linkSpeed, linkSignal sql.NullInt64
+	if l := res.Link; l != nil {
+		linkInterface = sql.NullString{String: l.Interface, Valid: true}
+		linkType = sql.NullString{String: string(l.Type), Valid: true}
+		linkSSID = sql.NullString{String: l.SSID, Valid: l.SSID != ""}
+		linkSpeed = sql.NullInt64{Int64: int64(l.SpeedMbps), Valid: l.SpeedMbps != 0}
+		linkSignal = sql.NullInt64{Int64: int64(l.SignalDBm), Valid: l.SignalDBm != 0}
+	}
+
+	var lanJSON sql.NullString
+	if res.LAN != nil {
+		data, err := json.Marshal(res.LAN)
+		if err != nil {
+			return false, fmt.Errorf("marshal lan health: %w", err)
+		}
+		lanJSON = sql.NullString{String: string(data), Valid: true}
+	}
+
+	var mtuJSON sql.NullString
+	if res.PathMTU != nil {
+		data, err := json.Marshal(res.PathMTU)
+		if err != nil {
+			return false, fmt.Errorf("marshal path mtu: %w", err)
+		}
+		mtuJSON = sql.NullString{String: string(data), Valid: true}
+	}
 
-	timestamp := res.Timestamp.UTC().Format(time.RFC3339)
-	var rawJSON sql.NullString
-	if len(res.RawJSON) > 0 {
-		rawJSON = sql.NullString{String: string(res.RawJSON), Valid: true}
+	var phasesJSON sql.NullString
+	if len(res.Phases) > 0 {
+		data, err := json.Marshal(res.Phases)
+		if err != nil {
+			return false, fmt.Errorf("marshal phases: %w", err)
+		}
+		phasesJSON = sql.NullString{String: string(data), Valid: true}
+	}
+
+	var timingsJSON sql.NullString
+	if res.Timings != nil {
+		data, err := json.Marshal(res.Timings)
+		if err != nil {
+			return false, fmt.Errorf("marshal timings: %w", err)
+		}
+		timingsJSON = sql.NullString{String: string(data), Valid: true}
+	}
+
+	var tags sql.NullString
+	if len(res.Tags) > 0 {
+		data, err := json.Marshal(res.Tags)
+		if err != nil {
+			return false, fmt.Errorf("marshal tags: %w", err)
+		}
+		tags = sql.NullString{String: string(data), Valid: true}
 	}
 
 	query := `
-	INSERT OR REPLACE INTO results (
-		id, timestamp, download_mbps, upload_mbps, ping_ms, jitter_ms,
-		packet_loss_pct, isp, external_ip, server_id, server_name,
-		server_country, raw_json
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO results (` + resultColumns + `, fingerprint
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := s.db.Exec(query,
+	_, err = tx.ExecContext(ctx, query,
 		res.ID,
-		timestamp,
+		res.Timestamp.Unix(),
 		res.DownloadMbps,
 		res.UploadMbps,
 		res.PingMs,
@@ -141,48 +581,77 @@ func (s *Store) SaveResult(res *model.SpeedtestResult) error {
 		res.ServerName,
 		res.ServerCountry,
 		rawJSON,
+		linkInterface,
+		linkType,
+		linkSpeed,
+		linkSSID,
+		linkSignal,
+		lanJSON,
+		tags,
+		connectionValue(res.Connection),
+		sql.NullString{String: res.Signature, Valid: res.Signature != ""},
+		mtuJSON,
+		sql.NullString{String: res.Engine, Valid: res.Engine != ""},
+		sql.NullString{String: res.Note, Valid: res.Note != ""},
+		phasesJSON,
+		timingsJSON,
+		fp,
 	)
+	if err != nil {
+		return false, err
+	}
 
-	return err
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	s.generation.Add(1)
+	return true, nil
 }
 
-// CountResults returns the number of results within the specified time range.
-func (s *Store) CountResults(from, to time.Time) (int, error) {
+// CountResults returns the number of results within the specified time range
+// that match f.
+func (s *Store) CountResults(ctx context.Context, from, to time.Time, f ResultFilter) (int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
 
-	fromUTC := from.UTC().Format(time.RFC3339)
-	toUTC := to.UTC().Format(time.RFC3339)
+	where, args := f.where(from, to)
+	query := `SELECT COUNT(*) FROM results ` + where
 
-	query := `
-	SELECT COUNT(*)
-	FROM results
-	WHERE timestamp >= ? AND timestamp <= ?
-	`
 	var count int
-	err := s.db.QueryRow(query, fromUTC, toUTC).Scan(&count)
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&count)
 	return count, err
 }
 
 // ListResults retrieves all speedtest results within the specified time range.
 // Results are sorted by timestamp in ascending order.
-func (s *Store) ListResults(from, to time.Time) ([]model.SpeedtestResult, error) {
+func (s *Store) ListResults(ctx context.Context, from, to time.Time) ([]model.SpeedtestResult, error) {
+	return s.ListResultsPage(ctx, from, to, ResultFilter{}, 0, 0)
+}
+
+// ListResultsPage retrieves a page of speedtest results within the specified time range
+// that match f. Results are sorted by timestamp ascending. limit and offset are 0-based;
+// use 0 for no limit.
+func (s *Store) ListResultsPage(ctx context.Context, from, to time.Time, f ResultFilter, limit, offset int) ([]model.SpeedtestResult, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
 
-	fromUTC := from.UTC().Format(time.RFC3339)
-	toUTC := to.UTC().Format(time.RFC3339)
-
+	where, args := f.where(from, to)
 	query := `
-	SELECT id, timestamp, download_mbps, upload_mbps, ping_ms, jitter_ms,
-	       packet_loss_pct, isp, external_ip, server_id, server_name,
-	       server_country, raw_json
+	SELECT ` + resultColumns + `
 	FROM results
-	WHERE timestamp >= ? AND timestamp <= ?
+	` + where + `
 	ORDER BY timestamp ASC
 	`
+	if limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+	}
 
-	rows, err := s.db.Query(query, fromUTC, toUTC)
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -190,136 +659,281 @@ func (s *Store) ListResults(from, to time.Time) ([]model.SpeedtestResult, error)
 
 	var results []model.SpeedtestResult
 	for rows.Next() {
-		var r model.SpeedtestResult
-		var timestampStr string
-		var rawJSON sql.NullString
-
-		err := rows.Scan(
-			&r.ID,
-			&timestampStr,
-			&r.DownloadMbps,
-			&r.UploadMbps,
-			&r.PingMs,
-			&r.JitterMs,
-			&r.PacketLossPct,
-			&r.ISP,
-			&r.ExternalIP,
-			&r.ServerID,
-			&r.ServerName,
-			&r.ServerCountry,
-			&rawJSON,
-		)
+		r, err := scanResult(rows)
 		if err != nil {
 			return nil, err
 		}
+		results = append(results, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
 
-		// Parse timestamp
-		t, err := time.Parse(time.RFC3339, timestampStr)
+// eachResultPage is how many results EachResult reads per query.
+const eachResultPage = 500
+
+// EachResult calls fn with each result within the time range that matches f,
+// oldest first, stopping at the first error fn returns. Results are read a
+// page at a time and the store is unlocked while fn runs, so a slow consumer,
+// such as a client streaming years of history, doesn't hold up writes.
+func (s *Store) EachResult(ctx context.Context, from, to time.Time, f ResultFilter, fn func(model.SpeedtestResult) error) error {
+	var afterTimestamp int64
+	var afterID string
+	first := true
+	for {
+		page, err := s.resultPageAfter(ctx, from, to, f, first, afterTimestamp, afterID)
 		if err != nil {
-			return nil, fmt.Errorf("parse timestamp: %w", err)
+			return err
 		}
-		r.Timestamp = t.UTC()
-
-		// Handle raw JSON
-		if rawJSON.Valid {
-			r.RawJSON = json.RawMessage(rawJSON.String)
+		for _, r := range page {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		if len(page) < eachResultPage {
+			return nil
 		}
+		last := page[len(page)-1]
+		afterTimestamp, afterID, first = last.Timestamp.Unix(), last.ID, false
+	}
+}
+
+// resultPageAfter returns the next page of EachResult's results, those
+// after the (timestamp, id) of the previous page's last unless first is set.
+func (s *Store) resultPageAfter(ctx context.Context, from, to time.Time, f ResultFilter, first bool, timestamp int64, id string) ([]model.SpeedtestResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
 
+	where, args := f.where(from, to)
+	if !first {
+		where += ` AND (timestamp > ? OR (timestamp = ? AND id > ?))`
+		args = append(args, timestamp, timestamp, id)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT `+resultColumns+`
+	FROM results
+	`+where+`
+	ORDER BY timestamp ASC, id ASC
+	LIMIT ?
+	`, append(args, eachResultPage)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]model.SpeedtestResult, 0, eachResultPage)
+	for rows.Next() {
+		r, err := scanResult(rows)
+		if err != nil {
+			return nil, err
+		}
 		results = append(results, r)
 	}
+	return results, rows.Err()
+}
 
-	if err := rows.Err(); err != nil {
+// LatestResult returns the most recent speedtest result, or nil if there are none.
+func (s *Store) LatestResult(ctx context.Context) (*model.SpeedtestResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `
+	SELECT ` + resultColumns + `
+	FROM results
+	ORDER BY timestamp DESC
+	LIMIT 1
+	`
+
+	r, err := scanResult(s.db.QueryRowContext(ctx, query))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
 		return nil, err
 	}
 
-	return results, nil
+	return &r, nil
 }
 
-// ListResultsPage retrieves a page of speedtest results within the specified time range.
-// Results are sorted by timestamp ascending. limit and offset are 0-based; use 0 for no limit.
-func (s *Store) ListResultsPage(from, to time.Time, limit, offset int) ([]model.SpeedtestResult, error) {
+// GetResult returns the result with the given ID, or nil if there is none.
+func (s *Store) GetResult(ctx context.Context, id string) (*model.SpeedtestResult, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-
-	fromUTC := from.UTC().Format(time.RFC3339)
-	toUTC := to.UTC().Format(time.RFC3339)
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
 
 	query := `
-	SELECT id, timestamp, download_mbps, upload_mbps, ping_ms, jitter_ms,
-	       packet_loss_pct, isp, external_ip, server_id, server_name,
-	       server_country, raw_json
+	SELECT ` + resultColumns + `
 	FROM results
-	WHERE timestamp >= ? AND timestamp <= ?
-	ORDER BY timestamp ASC
+	WHERE id = ?
 	`
-	args := []interface{}{fromUTC, toUTC}
-	if limit > 0 {
-		query += ` LIMIT ? OFFSET ?`
-		args = append(args, limit, offset)
-	}
 
-	rows, err := s.db.Query(query, args...)
+	r, err := scanResult(s.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var results []model.SpeedtestResult
-	for rows.Next() {
-		var r model.SpeedtestResult
-		var timestampStr string
-		var rawJSON sql.NullString
-
-		err := rows.Scan(
-			&r.ID,
-			&timestampStr,
-			&r.DownloadMbps,
-			&r.UploadMbps,
-			&r.PingMs,
-			&r.JitterMs,
-			&r.PacketLossPct,
-			&r.ISP,
-			&r.ExternalIP,
-			&r.ServerID,
-			&r.ServerName,
-			&r.ServerCountry,
-			&rawJSON,
-		)
+	return &r, nil
+}
+
+// scanResult scans one row selected with resultColumns.
+func scanResult(row interface{ Scan(...interface{}) error }) (model.SpeedtestResult, error) {
+	var r model.SpeedtestResult
+	var timestamp int64
+	var rawJSON []byte
+	var linkInterface, linkType, linkSSID sql.NullString
+	var linkSpeed, linkSignal sql.NullInt64
+	var lanJSON, tags, connection, signature, mtuJSON, engine, note, phasesJSON, timingsJSON sql.NullString
+
+	err := row.Scan(
+		&r.ID,
+		&timestamp,
+		&r.DownloadMbps,
+		&r.UploadMbps,
+		&r.PingMs,
+		&r.JitterMs,
+		&r.PacketLossPct,
+		&r.ISP,
+		&r.ExternalIP,
+		&r.ServerID,
+		&r.ServerName,
+		&r.ServerCountry,
+		&rawJSON,
+		&linkInterface,
+		&linkType,
+		&linkSpeed,
+		&linkSSID,
+		&linkSignal,
+		&lanJSON,
+		&tags,
+		&connection,
+		&signature,
+		&mtuJSON,
+		&engine,
+		&note,
+		&phasesJSON,
+		&timingsJSON,
+	)
+	if err != nil {
+		return r, err
+	}
+
+	r.Timestamp = unixTime(timestamp)
+
+	if len(rawJSON) > 0 {
+		raw, err := unpackRaw(rawJSON)
 		if err != nil {
-			return nil, err
+			return r, fmt.Errorf("result %s: raw output: %w", r.ID, err)
 		}
+		r.RawJSON = json.RawMessage(raw)
+	}
 
-		t, err := time.Parse(time.RFC3339, timestampStr)
-		if err != nil {
-			return nil, fmt.Errorf("parse timestamp: %w", err)
+	if linkType.Valid {
+		r.Link = &model.LinkInfo{
+			Interface: linkInterface.String,
+			Type:      model.LinkType(linkType.String),
+			SpeedMbps: int(linkSpeed.Int64),
+			SSID:      linkSSID.String,
+			SignalDBm: int(linkSignal.Int64),
 		}
-		r.Timestamp = t.UTC()
+	}
 
-		if rawJSON.Valid {
-			r.RawJSON = json.RawMessage(rawJSON.String)
+	if lanJSON.Valid {
+		var lan model.LANHealth
+		if err := json.Unmarshal([]byte(lanJSON.String), &lan); err != nil {
+			return r, fmt.Errorf("parse lan health: %w", err)
 		}
+		r.LAN = &lan
+	}
 
-		results = append(results, r)
+	if tags.Valid {
+		if err := json.Unmarshal([]byte(tags.String), &r.Tags); err != nil {
+			return r, fmt.Errorf("parse tags: %w", err)
+		}
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+	r.Connection = connection.String
+	r.Signature = signature.String
+	r.Engine = engine.String
+	r.Note = note.String
+
+	if mtuJSON.Valid {
+		var mtu model.PathMTU
+		if err := json.Unmarshal([]byte(mtuJSON.String), &mtu); err != nil {
+			return r, fmt.Errorf("parse path mtu: %w", err)
+		}
+		r.PathMTU = &mtu
 	}
 
-	return results, nil
+	if phasesJSON.Valid {
+		if err := json.Unmarshal([]byte(phasesJSON.String), &r.Phases); err != nil {
+			return r, fmt.Errorf("parse phases: %w", err)
+		}
+	}
+
+	if timingsJSON.Valid {
+		var t model.PhaseTimings
+		if err := json.Unmarshal([]byte(timingsJSON.String), &t); err != nil {
+			return r, fmt.Errorf("parse timings: %w", err)
+		}
+		r.Timings = &t
+	}
+
+	return r, nil
+}
+
+// connectionValue stores the default connection as NULL, as results from
+// before connections existed are.
+func connectionValue(name string) sql.NullString {
+	if name == "" || name == model.DefaultConnection {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: name, Valid: true}
+}
+
+// connectionClause returns the condition, starting with AND, matching rows
+// recorded over the named connection.
+func connectionClause(name string) (string, []interface{}) {
+	if name == model.DefaultConnection {
+		return ` AND (connection IS NULL OR connection = '')`, nil
+	}
+	return ` AND connection = ?`, []interface{}{name}
+}
+
+// engineClause returns the condition, starting with AND, matching rows
+// measured with the named engine. Results from before engines could be
+// chosen have none and were measured with Ookla.
+func engineClause(name string) (string, []interface{}) {
+	if name == model.EngineOokla {
+		return ` AND (engine = ? OR engine IS NULL OR engine = '')`, []interface{}{name}
+	}
+	return ` AND engine = ?`, []interface{}{name}
 }
 
 // DeleteResult deletes a speedtest result by ID.
-func (s *Store) DeleteResult(id string) error {
+func (s *Store) DeleteResult(ctx context.Context, id string) error {
 	if id == "" {
 		return fmt.Errorf("empty id")
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
 
 	query := `DELETE FROM results WHERE id = ?`
-	result, err := s.db.Exec(query, id)
+	result, err := s.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -333,11 +947,22 @@ func (s *Store) DeleteResult(id string) error {
 		return fmt.Errorf("result not found")
 	}
 
+	s.generation.Add(1)
 	return nil
 }
 
-// Close closes the database connection.
+// DBStats returns connection pool statistics for the underlying database.
+func (s *Store) DBStats() sql.DBStats {
+	return s.db.Stats()
+}
+
+// Close closes the database connections.
 func (s *Store) Close() error {
+	s.roMu.Lock()
+	if s.ro != nil {
+		s.ro.Close()
+	}
+	s.roMu.Unlock()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return s.db.Close()
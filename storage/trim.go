@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// failedOrLossy matches results that show the connection down, with no
+// throughput in either direction or total packet loss, or that lost packets.
+const failedOrLossy = `(download_mbps <= 0 OR upload_mbps <= 0 OR COALESCE(packet_loss_pct, 0) > 0)`
+
+// TrimRawOutput clears the raw engine output of results recorded before
+// before, keeping their metrics. With keepFailed, results that failed or lost
+// packets keep it, as those are the ones worth digging into later. Signed
+// results always keep it, since their signatures cover it. It returns the
+// number of results trimmed.
+func (s *Store) TrimRawOutput(ctx context.Context, before time.Time, keepFailed bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `UPDATE results SET raw_json = NULL
+		WHERE timestamp < ? AND raw_json IS NOT NULL AND COALESCE(signature, '') = ''`
+	if keepFailed {
+		query += ` AND NOT ` + failedOrLossy
+	}
+	res, err := s.db.ExecContext(ctx, query, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		// Chart data includes the raw output
+		s.generation.Add(1)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"speedplane/model"
+)
+
+// SaveWANUtilization saves a WAN utilization sample.
+func (s *Store) SaveWANUtilization(ctx context.Context, u model.WANUtilization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+	INSERT INTO wan_utilization (
+		timestamp, connection, download_mbps, upload_mbps, download_pct,
+		upload_pct, error
+	) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+		u.Timestamp.Unix(),
+		connectionValue(u.Connection),
+		u.DownloadMbps,
+		u.UploadMbps,
+		nullFloat(u.DownloadPct),
+		nullFloat(u.UploadPct),
+		u.Error,
+	)
+	return err
+}
+
+// ListWANUtilization returns WAN utilization samples within the time range,
+// oldest first. A non-empty connection limits them to that connection.
+func (s *Store) ListWANUtilization(ctx context.Context, from, to time.Time, connection string) ([]model.WANUtilization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	where := `WHERE timestamp >= ? AND timestamp <= ?`
+	args := []interface{}{from.Unix(), to.Unix()}
+	if connection != "" {
+		c, a := connectionClause(connection)
+		where += c
+		args = append(args, a...)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT `+utilizationColumns+`
+	FROM wan_utilization
+	`+where+`
+	ORDER BY timestamp ASC, id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.WANUtilization
+	for rows.Next() {
+		u, err := scanWANUtilization(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// LatestWANUtilization returns the most recent WAN utilization sample of a
+// connection ("" or model.DefaultConnection for the default one), or nil if
+// there is none.
+func (s *Store) LatestWANUtilization(ctx context.Context, connection string) (*model.WANUtilization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	if connection == "" {
+		connection = model.DefaultConnection
+	}
+	c, args := connectionClause(connection)
+	u, err := scanWANUtilization(s.db.QueryRowContext(ctx, `
+	SELECT `+utilizationColumns+`
+	FROM wan_utilization
+	WHERE 1 = 1`+c+`
+	ORDER BY timestamp DESC, id DESC
+	LIMIT 1
+	`, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+const utilizationColumns = `id, timestamp, connection, download_mbps, upload_mbps,
+	download_pct, upload_pct, error`
+
+func scanWANUtilization(row interface{ Scan(...interface{}) error }) (model.WANUtilization, error) {
+	var u model.WANUtilization
+	var timestamp int64
+	var conn, errStr sql.NullString
+	var downPct, upPct sql.NullFloat64
+
+	if err := row.Scan(
+		&u.ID,
+		&timestamp,
+		&conn,
+		&u.DownloadMbps,
+		&u.UploadMbps,
+		&downPct,
+		&upPct,
+		&errStr,
+	); err != nil {
+		return model.WANUtilization{}, err
+	}
+
+	u.Timestamp = unixTime(timestamp)
+	u.Connection = conn.String
+	if downPct.Valid {
+		u.DownloadPct = &downPct.Float64
+	}
+	if upPct.Valid {
+		u.UploadPct = &upPct.Float64
+	}
+	u.Error = errStr.String
+	return u, nil
+}
+
+func nullFloat(v *float64) sql.NullFloat64 {
+	if v == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *v, Valid: true}
+}
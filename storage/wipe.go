@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// wipeTables are the tables Wipe empties: everything the server records.
+var wipeTables = []string{"results", "probe_results", "run_failures", "result_rollups", "annotations", "starlink_status", "wan_utilization", "reachability_checks", "working_latency", "engine_comparisons", "alert_events"}
+
+// Wipe deletes all results, probe rounds, failures, rollups, annotations,
+// Starlink readings, WAN utilization, reachability checks, working latency
+// tests, engine comparisons and the alert history, then vacuums the
+// database so the deleted data doesn't linger in free pages of the file.
+func (s *Store) Wipe(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	qctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(qctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range wipeTables {
+		if _, err := tx.ExecContext(qctx, `DELETE FROM `+table); err != nil {
+			return fmt.Errorf("delete %s: %w", table, err)
+		}
+	}
+	// Restart AUTOINCREMENT ids, as on a fresh install
+	if _, err := tx.ExecContext(qctx, `DELETE FROM sqlite_sequence`); err != nil {
+		return fmt.Errorf("reset ids: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.generation.Add(1)
+	// Rewriting a large database can take longer than the query timeout, so
+	// only ctx limits the vacuum
+	if _, err := s.db.ExecContext(ctx, `VACUUM`); err != nil {
+		return fmt.Errorf("vacuum: %w", err)
+	}
+	return nil
+}
+
+// RemoveArchives deletes the archive files written by ArchiveResults to dir.
+func RemoveArchives(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("remove archives: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package theme
+
+import (
+	"strings"
+)
+
+// AutoScheme is the pseudo-scheme that follows the browser's prefers-color-scheme
+// setting, switching between a template's paired light and dark schemes.
+const AutoScheme = "auto"
+
+// AutoSchemes returns the light and dark schemes used for AutoScheme.
+// Pairs are declared in scheme metadata with "Pair: <scheme>" and, on the
+// dark side, "Appearance: dark" (schemes are assumed light otherwise).
+func (m *Manager) AutoSchemes(templateName string) (string, string, bool) {
+	info := m.GetTemplate(templateName)
+	if info == nil {
+		return "", "", false
+	}
+
+	for _, scheme := range m.GetSchemes(templateName) {
+		if scheme.Pair == "" || scheme.Pair == scheme.Name {
+			continue
+		}
+		if _, ok := info.Schemes[scheme.Pair]; !ok {
+			continue
+		}
+		if scheme.Appearance == "dark" {
+			return scheme.Pair, scheme.Name, true
+		}
+		return scheme.Name, scheme.Pair, true
+	}
+
+	return "", "", false
+}
+
+// autoThemeCSS builds the CSS for AutoScheme: the light scheme applies by
+// default and the dark one inside a prefers-color-scheme: dark media query.
+// Scheme rules from the base CSS (e.g. [data-scheme="dark"] .card) are
+// carried over into the matching section.
+func (m *Manager) autoThemeCSS(info *TemplateInfo, light, dark string) string {
+	var lightRules, darkRules []string
+	lightRules = append(lightRules, rescopeScheme(info.Schemes[light].CSS, light))
+	darkRules = append(darkRules, rescopeScheme(info.Schemes[dark].CSS, dark))
+
+	for _, it := range tokenizeCSS(info.BaseCSS) {
+		if it.kind != cssRule {
+			continue
+		}
+		switch {
+		case strings.Contains(it.prelude, `[data-scheme="`+light+`"]`):
+			lightRules = append(lightRules, rescopeScheme(it.text(info.BaseCSS), light))
+		case strings.Contains(it.prelude, `[data-scheme="`+dark+`"]`):
+			darkRules = append(darkRules, rescopeScheme(it.text(info.BaseCSS), dark))
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(info.BaseCSS)
+	b.WriteString("\n")
+	b.WriteString(strings.Join(lightRules, "\n"))
+	b.WriteString("\n@media (prefers-color-scheme: dark) {\n")
+	b.WriteString(strings.Join(darkRules, "\n"))
+	b.WriteString("\n}\n")
+	return b.String()
+}
+
+// rescopeScheme points selectors for scheme at the auto scheme instead.
+func rescopeScheme(css, scheme string) string {
+	return strings.ReplaceAll(css, `[data-scheme="`+scheme+`"]`, `[data-scheme="`+AutoScheme+`"]`)
+}
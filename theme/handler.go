@@ -1,45 +1,80 @@
 package theme
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strings"
 )
 
+// MaxThemeSize is the largest CSS template accepted by the upload API.
+const MaxThemeSize = 512 << 10
+
 // Handler handles theme-related HTTP requests.
 type Handler struct {
-	manager *Manager
+	manager   *Manager
+	authorize func(http.HandlerFunc) http.HandlerFunc
+	devMode   bool
 }
 
 // NewHandler creates a new theme handler.
 func NewHandler(manager *Manager) *Handler {
 	return &Handler{
-		manager: manager,
+		manager:   manager,
+		authorize: func(next http.HandlerFunc) http.HandlerFunc { return next },
 	}
 }
 
+// SetDevMode disables browser caching of theme CSS so edits show up on reload.
+func (h *Handler) SetDevMode(enabled bool) {
+	h.devMode = enabled
+}
+
+// SetAuthorizer sets the wrapper applied to handlers that modify installed themes.
+func (h *Handler) SetAuthorizer(wrap func(http.HandlerFunc) http.HandlerFunc) {
+	h.authorize = wrap
+}
+
 // HandleTheme serves the CSS for a specific template and scheme.
 func (h *Handler) HandleTheme(w http.ResponseWriter, r *http.Request) {
-	templateName := "speedplane"
-	schemeName := "default"
+	templateName, schemeName := h.manager.Default()
 
 	if qTemplate := r.URL.Query().Get("template"); qTemplate != "" {
-		if h.manager.GetTemplate(qTemplate) != nil {
+		if h.manager.GetTemplate(qTemplate) != nil && qTemplate != templateName {
 			templateName = qTemplate
+			schemeName = "default"
 		}
 	}
 	if qScheme := r.URL.Query().Get("scheme"); qScheme != "" {
 		if templateInfo := h.manager.GetTemplate(templateName); templateInfo != nil {
 			if _, schemeExists := templateInfo.Schemes[qScheme]; schemeExists {
 				schemeName = qScheme
+			} else if _, _, ok := h.manager.AutoSchemes(templateName); ok && qScheme == AutoScheme {
+				schemeName = qScheme
 			}
 		}
 	}
 
 	themeCSS := h.manager.GetThemeCSS(templateName, schemeName)
 
+	// Templates can be reloaded, so the CSS is revalidated by ETag rather
+	// than cached for good
+	sum := sha256.Sum256([]byte(themeCSS))
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	if h.devMode {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	}
+	if inm := r.Header.Get("If-None-Match"); inm == etag || inm == "W/"+etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	w.Header().Set("Content-Type", "text/css; charset=utf-8")
-	w.Header().Set("Cache-Control", "public, max-age=3600")
 	_, _ = w.Write([]byte(themeCSS))
 }
 
@@ -57,28 +92,12 @@ func (h *Handler) HandleSchemes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	schemes := h.manager.GetSchemes(templateName)
-
-	type SchemeResponse struct {
-		Name    string `json:"name"`
-		Display string `json:"display"`
-		Accent  string `json:"accent"`
-		Border  bool   `json:"border"`
-	}
+	schemes := h.schemesWithAuto(templateName)
 
-	schemesResp := make([]SchemeResponse, 0, len(schemes))
+	schemesResp := make([]schemeResponse, 0, len(schemes))
 	for _, scheme := range schemes {
-		displayName := scheme.Display
-		if displayName == "" {
-			parts := strings.Split(scheme.Name, "-")
-			for i, part := range parts {
-				if len(part) > 0 {
-					parts[i] = strings.ToUpper(part[:1]) + part[1:]
-				}
-			}
-			displayName = strings.Join(parts, " ")
-		}
-		schemesResp = append(schemesResp, SchemeResponse{
+		displayName := schemeDisplayName(scheme)
+		schemesResp = append(schemesResp, schemeResponse{
 			Name:    scheme.Name,
 			Display: displayName,
 			Accent:  scheme.Accent,
@@ -94,6 +113,184 @@ func (h *Handler) HandleSchemes(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type schemeResponse struct {
+	Name    string `json:"name"`
+	Display string `json:"display"`
+	Accent  string `json:"accent"`
+	Border  bool   `json:"border"`
+}
+
+type templateResponse struct {
+	Name    string           `json:"name"`
+	Source  string           `json:"source"`
+	Schemes []schemeResponse `json:"schemes"`
+}
+
+func (h *Handler) templateResponse(info *TemplateInfo) templateResponse {
+	resp := templateResponse{
+		Name:    info.Name,
+		Source:  info.Source,
+		Schemes: []schemeResponse{},
+	}
+	for _, scheme := range h.schemesWithAuto(info.Name) {
+		resp.Schemes = append(resp.Schemes, schemeResponse{
+			Name:    scheme.Name,
+			Display: schemeDisplayName(scheme),
+			Accent:  scheme.Accent,
+			Border:  scheme.Border,
+		})
+	}
+	return resp
+}
+
+// HandleThemes lists installed templates (GET) or uploads a new one (POST).
+// Uploads accept either a multipart form with a "file" field or a raw CSS body.
+func (h *Handler) HandleThemes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		out := []templateResponse{}
+		for _, name := range h.manager.ListTemplates() {
+			if info := h.manager.GetTemplate(name); info != nil {
+				out = append(out, h.templateResponse(info))
+			}
+		}
+		writeJSON(w, http.StatusOK, out)
+
+	case http.MethodPost:
+		h.authorize(h.handleUpload)(w, r)
+
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) handleUpload(w http.ResponseWriter, r *http.Request) {
+	fileName, content, ok := readThemeUpload(w, r)
+	if !ok {
+		return
+	}
+
+	info, err := h.manager.Install(fileName, content)
+	if err != nil {
+		if errors.Is(err, ErrNoUserDir) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "invalid theme: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, h.templateResponse(info))
+}
+
+// HandleValidate runs the template parser on a submitted CSS file without
+// installing it and reports which schemes were found and why others weren't.
+func (h *Handler) HandleValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	fileName, content, ok := readThemeUpload(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ValidateTemplate(fileName, string(content)))
+}
+
+// readThemeUpload reads a CSS file from a multipart "file" field or the raw
+// request body, enforcing MaxThemeSize. On failure it writes the error response.
+func readThemeUpload(w http.ResponseWriter, r *http.Request) (string, []byte, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxThemeSize+64<<10)
+
+	fileName := r.URL.Query().Get("name")
+	var src io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "missing file field", http.StatusBadRequest)
+			return "", nil, false
+		}
+		defer file.Close()
+		src = file
+		fileName = header.Filename
+	}
+
+	content, err := io.ReadAll(io.LimitReader(src, MaxThemeSize+1))
+	if err != nil {
+		http.Error(w, "failed to read upload", http.StatusBadRequest)
+		return "", nil, false
+	}
+	if len(content) > MaxThemeSize {
+		http.Error(w, "theme too large", http.StatusRequestEntityTooLarge)
+		return "", nil, false
+	}
+	if fileName == "" {
+		fileName = "uploaded.css"
+	}
+
+	return fileName, content, true
+}
+
+// HandleThemeByName removes a user-installed template (DELETE /api/themes/{name}).
+func (h *Handler) HandleThemeByName(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/themes/")
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		info := h.manager.GetTemplate(name)
+		if info == nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, h.templateResponse(info))
+
+	case http.MethodDelete:
+		h.authorize(func(w http.ResponseWriter, r *http.Request) {
+			err := h.manager.Remove(name)
+			switch {
+			case err == nil:
+				w.WriteHeader(http.StatusNoContent)
+			case errors.Is(err, ErrNotFound):
+				http.NotFound(w, r)
+			case errors.Is(err, ErrBuiltIn):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			default:
+				http.Error(w, "failed to remove theme", http.StatusInternalServerError)
+			}
+		})(w, r)
+
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodDelete)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleReload re-scans the embedded templates and the user themes directory.
+func (h *Handler) HandleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := h.manager.Reload(); err != nil {
+		http.Error(w, "failed to reload themes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"templates": h.manager.ListTemplates(),
+	})
+}
+
 // GenerateTemplateMenuHTML generates HTML for the template selection menu.
 func (h *Handler) GenerateTemplateMenuHTML(currentTemplate string) string {
 	var builder strings.Builder
@@ -123,19 +320,10 @@ func (h *Handler) GenerateSchemeMenuHTML(templateName string) string {
 		return ""
 	}
 
-	schemes := h.manager.GetSchemes(templateName)
+	schemes := h.schemesWithAuto(templateName)
 
 	for _, scheme := range schemes {
-		displayName := scheme.Display
-		if displayName == "" {
-			parts := strings.Split(scheme.Name, "-")
-			for i, part := range parts {
-				if len(part) > 0 {
-					parts[i] = strings.ToUpper(part[:1]) + part[1:]
-				}
-			}
-			displayName = strings.Join(parts, " ")
-		}
+		displayName := schemeDisplayName(scheme)
 
 		builder.WriteString(`<button data-scheme="`)
 		builder.WriteString(scheme.Name)
@@ -151,3 +339,43 @@ func (h *Handler) GenerateSchemeMenuHTML(templateName string) string {
 
 	return builder.String()
 }
+
+// schemesWithAuto returns the template's schemes followed by the AutoScheme
+// pseudo-scheme when the template declares a light/dark pair.
+func (h *Handler) schemesWithAuto(templateName string) []SchemeInfo {
+	schemes := h.manager.GetSchemes(templateName)
+	if light, _, ok := h.manager.AutoSchemes(templateName); ok {
+		accent := ""
+		for _, scheme := range schemes {
+			if scheme.Name == light {
+				accent = scheme.Accent
+			}
+		}
+		schemes = append(schemes, SchemeInfo{
+			Name:    AutoScheme,
+			Display: "Auto (System)",
+			Accent:  accent,
+		})
+	}
+	return schemes
+}
+
+// schemeDisplayName returns the scheme's Display metadata, or its name title-cased.
+func schemeDisplayName(scheme SchemeInfo) string {
+	if scheme.Display != "" {
+		return scheme.Display
+	}
+	parts := strings.Split(scheme.Name, "-")
+	for i, part := range parts {
+		if len(part) > 0 {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
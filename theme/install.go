@@ -0,0 +1,87 @@
+package theme
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var (
+	// ErrNoUserDir is returned when installing or removing themes without a user themes directory.
+	ErrNoUserDir = errors.New("user themes directory not configured")
+	// ErrNotFound is returned when a template does not exist.
+	ErrNotFound = errors.New("template not found")
+	// ErrBuiltIn is returned when trying to remove an embedded template.
+	ErrBuiltIn = errors.New("built-in templates cannot be removed")
+)
+
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// Install validates a CSS template, writes it to the user themes directory
+// as {template}.css and reloads all templates.
+func (m *Manager) Install(fileName string, content []byte) (*TemplateInfo, error) {
+	if m.userDir == "" {
+		return nil, ErrNoUserDir
+	}
+
+	info, err := ParseTemplate(fileName, string(content))
+	if err != nil {
+		return nil, err
+	}
+	if !templateNamePattern.MatchString(info.Name) {
+		return nil, fmt.Errorf("invalid template name %q: use letters, digits, '-' and '_'", info.Name)
+	}
+
+	if err := os.MkdirAll(m.userDir, 0o755); err != nil {
+		return nil, fmt.Errorf("create themes directory: %w", err)
+	}
+
+	// Replace any user file that currently provides this template
+	if existing := m.GetTemplate(info.Name); existing != nil && existing.Source == SourceUser && existing.File != info.Name+".css" {
+		_ = os.Remove(filepath.Join(m.userDir, existing.File))
+	}
+
+	target := filepath.Join(m.userDir, info.Name+".css")
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return nil, fmt.Errorf("write template: %w", err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		_ = os.Remove(tmp)
+		return nil, fmt.Errorf("write template: %w", err)
+	}
+
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+
+	installed := m.GetTemplate(info.Name)
+	if installed == nil {
+		return nil, ErrNotFound
+	}
+	return installed, nil
+}
+
+// Remove deletes a user template and reloads all templates. If the user
+// template overrode a built-in one, the built-in template becomes active again.
+func (m *Manager) Remove(name string) error {
+	if m.userDir == "" {
+		return ErrNoUserDir
+	}
+
+	info := m.GetTemplate(name)
+	if info == nil {
+		return ErrNotFound
+	}
+	if info.Source != SourceUser {
+		return ErrBuiltIn
+	}
+
+	if err := os.Remove(filepath.Join(m.userDir, info.File)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove template: %w", err)
+	}
+
+	return m.Reload()
+}
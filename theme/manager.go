@@ -5,32 +5,95 @@ import (
 	"fmt"
 	"io/fs"
 	"log"
+	"os"
+	"path"
 	"sort"
 	"strings"
+	"sync"
 )
 
 // Manager manages theme templates and schemes.
+// Templates come from the embedded filesystem and, optionally, from a user
+// themes directory whose files take precedence over embedded ones of the same name.
 type Manager struct {
+	mu            sync.RWMutex
+	embedded      fs.FS
+	userDir       string
 	templatesMap  map[string]*TemplateInfo
 	templatesList []string
+
+	defaultTemplate string
+	defaultScheme   string
 }
 
-// NewManager creates a new theme manager and loads templates from the embedded filesystem.
-func NewManager(templatesFS embed.FS) (*Manager, error) {
+// NewManager creates a new theme manager and loads templates from the embedded filesystem
+// and from userDir (e.g. {data_dir}/themes). userDir may be empty or not exist yet.
+func NewManager(templatesFS embed.FS, userDir string) (*Manager, error) {
 	m := &Manager{
+		embedded:      templatesFS,
+		userDir:       userDir,
 		templatesMap:  make(map[string]*TemplateInfo),
 		templatesList: []string{},
 	}
 
-	if err := m.loadTemplates(templatesFS); err != nil {
+	if err := m.Reload(); err != nil {
 		return nil, fmt.Errorf("load templates: %w", err)
 	}
 
 	return m, nil
 }
 
-func (m *Manager) loadTemplates(templatesFS embed.FS) error {
-	entries, err := fs.ReadDir(templatesFS, "templates")
+// UserDir returns the directory user themes are loaded from.
+func (m *Manager) UserDir() string {
+	return m.userDir
+}
+
+// Reload re-reads the embedded templates and the user themes directory and
+// atomically replaces the loaded set.
+func (m *Manager) Reload() error {
+	templates := make(map[string]*TemplateInfo)
+
+	if err := loadTemplates(templates, m.embedded, "templates", SourceEmbedded); err != nil {
+		return err
+	}
+	if m.userDir != "" {
+		if _, err := os.Stat(m.userDir); err == nil {
+			if err := loadTemplates(templates, os.DirFS(m.userDir), ".", SourceUser); err != nil {
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("stat themes directory: %w", err)
+		}
+	}
+
+	list := make([]string, 0, len(templates))
+	for name := range templates {
+		list = append(list, name)
+	}
+	list = sortTemplates(list)
+
+	m.mu.Lock()
+	m.templatesMap = templates
+	m.templatesList = list
+	m.mu.Unlock()
+
+	log.Printf("Loaded %d theme templates:", len(templates))
+	for _, name := range list {
+		info := templates[name]
+		schemeNames := make([]string, 0, len(info.Schemes))
+		for schemeName := range info.Schemes {
+			schemeNames = append(schemeNames, schemeName)
+		}
+		log.Printf("  - %s (%s): %d schemes (%s)", name, info.Source, len(info.Schemes), strings.Join(schemeNames, ", "))
+	}
+
+	return nil
+}
+
+// loadTemplates parses every .css file in dir of fsys into templates.
+// Later sources override earlier ones with the same template name.
+func loadTemplates(templates map[string]*TemplateInfo, fsys fs.FS, dir string, source string) error {
+	entries, err := fs.ReadDir(fsys, dir)
 	if err != nil {
 		return fmt.Errorf("read templates directory: %w", err)
 	}
@@ -40,73 +103,54 @@ func (m *Manager) loadTemplates(templatesFS embed.FS) error {
 			continue
 		}
 
-		cssContent, err := templatesFS.ReadFile("templates/" + entry.Name())
+		cssContent, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
 		if err != nil {
 			log.Printf("Warning: failed to read template %s: %v", entry.Name(), err)
 			continue
 		}
 
-		schemes, baseCSS := ParseSchemesFromTemplate(string(cssContent))
-		if len(schemes) == 0 {
-			log.Printf("Warning: no schemes found in template %s", entry.Name())
+		templateInfo, err := ParseTemplate(entry.Name(), string(cssContent))
+		if err != nil {
+			log.Printf("Warning: %s template %s: %v", source, entry.Name(), err)
 			continue
 		}
+		templateInfo.Source = source
+		templateInfo.File = entry.Name()
 
-		// Get template name from metadata
-		templateName := ""
-		content := string(cssContent)
-		pos := 0
-		for pos < len(content) {
-			metaStart := strings.Index(content[pos:], "/*")
-			if metaStart == -1 {
-				break
-			}
-			metaStart += pos
-			metaEnd := strings.Index(content[metaStart:], "*/")
-			if metaEnd == -1 {
-				break
-			}
-			metaEnd += metaStart
-			metadataBlock := content[metaStart+2 : metaEnd]
-			if strings.Contains(metadataBlock, "Template:") {
-				meta := ParseThemeMetadata(content[metaStart : metaEnd+2])
-				if meta.Template != "" {
-					templateName = meta.Template
-					break
-				}
-			}
-			pos = metaEnd + 2
-		}
-		if templateName == "" {
-			templateName = strings.TrimSuffix(entry.Name(), ".css")
+		if existing, ok := templates[templateInfo.Name]; ok && existing.Source != source {
+			log.Printf("%s template %s overrides %s template", source, templateInfo.Name, existing.Source)
 		}
+		templates[templateInfo.Name] = templateInfo
+	}
 
-		templateInfo := &TemplateInfo{
-			Name:    templateName,
-			BaseCSS: baseCSS,
-			Schemes: make(map[string]SchemeInfo),
-		}
+	return nil
+}
 
-		for _, scheme := range schemes {
-			templateInfo.Schemes[scheme.Name] = scheme
-		}
+// ParseTemplate parses a CSS template file into a TemplateInfo. The template
+// name comes from the "Template:" metadata, falling back to the file name.
+// It returns an error if no schemes are found.
+func ParseTemplate(fileName string, content string) (*TemplateInfo, error) {
+	schemes, baseCSS := ParseSchemesFromTemplate(content)
+	if len(schemes) == 0 {
+		return nil, fmt.Errorf("no schemes found")
+	}
 
-		m.templatesMap[templateName] = templateInfo
-		m.templatesList = append(m.templatesList, templateName)
+	templateName := templateNameFromCSS(content, tokenizeCSS(content))
+	if templateName == "" {
+		templateName = strings.TrimSuffix(fileName, ".css")
 	}
 
-	m.templatesList = sortTemplates(m.templatesList)
+	templateInfo := &TemplateInfo{
+		Name:    templateName,
+		BaseCSS: baseCSS,
+		Schemes: make(map[string]SchemeInfo),
+	}
 
-	log.Printf("Loaded %d theme templates:", len(m.templatesMap))
-	for name, info := range m.templatesMap {
-		schemeNames := make([]string, 0, len(info.Schemes))
-		for schemeName := range info.Schemes {
-			schemeNames = append(schemeNames, schemeName)
-		}
-		log.Printf("  - %s: %d schemes (%s)", name, len(info.Schemes), strings.Join(schemeNames, ", "))
+	for _, scheme := range schemes {
+		templateInfo.Schemes[scheme.Name] = scheme
 	}
 
-	return nil
+	return templateInfo, nil
 }
 
 func sortTemplates(templates []string) []string {
@@ -141,38 +185,125 @@ func sortTemplates(templates []string) []string {
 	return append(sorted, others...)
 }
 
+// SetDefault sets the template and scheme served to visitors who haven't picked one.
+// Empty values fall back to the first template and its default scheme.
+func (m *Manager) SetDefault(templateName, schemeName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.defaultTemplate = templateName
+	m.defaultScheme = schemeName
+}
+
+// Default returns the default template and scheme, resolved against the
+// currently loaded templates so a removed theme never becomes the default.
+func (m *Manager) Default() (string, string) {
+	m.mu.RLock()
+	templateName, schemeName := m.defaultTemplate, m.defaultScheme
+	m.mu.RUnlock()
+
+	return m.Resolve(templateName, schemeName)
+}
+
+// Resolve returns templateName and schemeName if they exist, substituting
+// the first loaded template and that template's first scheme otherwise.
+func (m *Manager) Resolve(templateName, schemeName string) (string, string) {
+	m.mu.RLock()
+	list := m.templatesList
+	m.mu.RUnlock()
+
+	info := m.GetTemplate(templateName)
+	if info == nil {
+		if len(list) == 0 {
+			return "speedplane", "default"
+		}
+		templateName = list[0]
+		info = m.GetTemplate(templateName)
+		schemeName = ""
+	}
+	if info == nil {
+		return templateName, "default"
+	}
+
+	if schemeName == AutoScheme {
+		if _, _, ok := m.AutoSchemes(templateName); ok {
+			return templateName, schemeName
+		}
+	}
+	if _, ok := info.Schemes[schemeName]; !ok {
+		schemeName = "default"
+		if schemes := m.GetSchemes(templateName); len(schemes) > 0 {
+			schemeName = schemes[0].Name
+		}
+	}
+
+	return templateName, schemeName
+}
+
+// Validate reports whether templateName exists and, if schemeName is set, has that scheme.
+func (m *Manager) Validate(templateName, schemeName string) error {
+	info := m.GetTemplate(templateName)
+	if info == nil {
+		return fmt.Errorf("unknown template %q", templateName)
+	}
+	if schemeName == AutoScheme {
+		if _, _, ok := m.AutoSchemes(templateName); !ok {
+			return fmt.Errorf("template %q has no light/dark scheme pair for %q", templateName, AutoScheme)
+		}
+		return nil
+	}
+	if schemeName != "" {
+		if _, ok := info.Schemes[schemeName]; !ok {
+			return fmt.Errorf("template %q has no scheme %q", templateName, schemeName)
+		}
+	}
+	return nil
+}
+
 // GetTemplate returns a template by name, or nil if not found.
 func (m *Manager) GetTemplate(name string) *TemplateInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return m.templatesMap[name]
 }
 
 // ListTemplates returns a list of all template names.
 func (m *Manager) ListTemplates() []string {
-	return m.templatesList
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.templatesList...)
 }
 
 // GetThemeCSS returns the combined CSS for a template and scheme.
 func (m *Manager) GetThemeCSS(templateName, schemeName string) string {
-	templateInfo, exists := m.templatesMap[templateName]
+	templateInfo := m.GetTemplate(templateName)
+	exists := templateInfo != nil
 	if !exists {
 		return ""
 	}
 
+	if schemeName == AutoScheme {
+		if light, dark, ok := m.AutoSchemes(templateName); ok {
+			return m.autoThemeCSS(templateInfo, light, dark)
+		}
+	}
+
 	scheme, schemeExists := templateInfo.Schemes[schemeName]
 	if !schemeExists {
 		// Try default scheme
 		if defaultScheme, hasDefault := templateInfo.Schemes["default"]; hasDefault {
-			return defaultScheme.CSS + "\n" + templateInfo.BaseCSS
+			return templateInfo.BaseCSS + "\n" + defaultScheme.CSS
 		}
 		return ""
 	}
 
-	return scheme.CSS + "\n" + templateInfo.BaseCSS
+	// Scheme rules come last so they override default variables in the base CSS
+	return templateInfo.BaseCSS + "\n" + scheme.CSS
 }
 
 // GetSchemes returns all schemes for a template.
 func (m *Manager) GetSchemes(templateName string) []SchemeInfo {
-	templateInfo, exists := m.templatesMap[templateName]
+	templateInfo := m.GetTemplate(templateName)
+	exists := templateInfo != nil
 	if !exists {
 		return nil
 	}
@@ -4,31 +4,156 @@ import (
 	"strings"
 )
 
-// findBlockEnd finds the end of a CSS block (the matching closing brace)
-func findBlockEnd(content string, startPos int) int {
-	if startPos >= len(content) {
-		return len(content)
+type cssItemKind int
+
+const (
+	cssComment   cssItemKind = iota // /* ... */ at the top level
+	cssRule                         // prelude { ... }, including at-rules with nested blocks
+	cssStatement                    // prelude ; (e.g. @import, @charset)
+)
+
+// cssItem is a top-level piece of a stylesheet. start and end are byte
+// offsets into the source, so content[start:end] is the item's exact text.
+type cssItem struct {
+	kind         cssItemKind
+	start, end   int
+	prelude      string // selector or at-rule prelude, trimmed (rules and statements only)
+	unterminated bool   // comment or block ran into the end of the input
+}
+
+func (it cssItem) text(content string) string {
+	return content[it.start:it.end]
+}
+
+// tokenizeCSS splits a stylesheet into top-level comments, rules and
+// statements. Braces are matched by depth, so nested blocks such as @media
+// queries stay inside their parent rule, and comments and quoted strings
+// inside preludes and blocks never affect brace matching.
+func tokenizeCSS(content string) []cssItem {
+	var items []cssItem
+	pos := 0
+	n := len(content)
+
+	for pos < n {
+		// Skip whitespace between items
+		for pos < n && isCSSSpace(content[pos]) {
+			pos++
+		}
+		if pos >= n {
+			break
+		}
+
+		start := pos
+		if strings.HasPrefix(content[pos:], "/*") {
+			end, ok := skipComment(content, pos)
+			items = append(items, cssItem{kind: cssComment, start: start, end: end, unterminated: !ok})
+			pos = end
+			continue
+		}
+
+		// Read the prelude up to '{' or ';'
+		for pos < n && content[pos] != '{' && content[pos] != ';' {
+			pos = skipToken(content, pos)
+		}
+		prelude := strings.TrimSpace(stripComments(content[start:min(pos, n)]))
+
+		if pos >= n {
+			// Trailing text without a block or terminator
+			items = append(items, cssItem{kind: cssStatement, start: start, end: n, prelude: prelude, unterminated: true})
+			break
+		}
+
+		if content[pos] == ';' {
+			pos++
+			items = append(items, cssItem{kind: cssStatement, start: start, end: pos, prelude: prelude})
+			continue
+		}
+
+		// Matching closing brace
+		depth := 0
+		terminated := false
+		for pos < n {
+			switch content[pos] {
+			case '{':
+				depth++
+				pos++
+			case '}':
+				depth--
+				pos++
+			default:
+				pos = skipToken(content, pos)
+			}
+			if depth == 0 {
+				terminated = true
+				break
+			}
+		}
+		items = append(items, cssItem{kind: cssRule, start: start, end: pos, prelude: prelude, unterminated: !terminated})
 	}
 
-	openBrace := strings.Index(content[startPos:], "{")
-	if openBrace == -1 {
-		return len(content)
+	return items
+}
+
+// skipToken advances past one character, or a whole comment or quoted string
+// if one starts at pos.
+func skipToken(content string, pos int) int {
+	switch {
+	case strings.HasPrefix(content[pos:], "/*"):
+		end, _ := skipComment(content, pos)
+		return end
+	case content[pos] == '"' || content[pos] == '\'':
+		quote := content[pos]
+		pos++
+		for pos < len(content) && content[pos] != quote {
+			if content[pos] == '\\' {
+				pos++
+			}
+			pos++
+		}
+		if pos < len(content) {
+			pos++
+		}
+		return min(pos, len(content))
+	default:
+		return pos + 1
 	}
-	openBrace += startPos
+}
 
-	depth := 1
-	pos := openBrace + 1
-	for pos < len(content) && depth > 0 {
-		switch content[pos] {
-		case '{':
-			depth++
-		case '}':
-			depth--
+// skipComment returns the offset just past the comment starting at pos and
+// whether it was terminated.
+func skipComment(content string, pos int) (int, bool) {
+	end := strings.Index(content[pos+2:], "*/")
+	if end == -1 {
+		return len(content), false
+	}
+	return pos + 2 + end + 2, true
+}
+
+func stripComments(s string) string {
+	if !strings.Contains(s, "/*") {
+		return s
+	}
+	var b strings.Builder
+	pos := 0
+	for pos < len(s) {
+		if strings.HasPrefix(s[pos:], "/*") {
+			pos, _ = skipComment(s, pos)
+			b.WriteByte(' ')
+			continue
 		}
+		b.WriteByte(s[pos])
 		pos++
 	}
+	return b.String()
+}
+
+func isCSSSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f'
+}
 
-	return pos
+// isBaseCSSMarker reports whether a comment is the "/* Base CSS ... */" marker.
+func isBaseCSSMarker(comment string) bool {
+	return strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(comment, "/*")), "Base CSS")
 }
 
 // ParseThemeMetadata parses metadata from a CSS comment block.
@@ -67,138 +192,157 @@ func ParseThemeMetadata(cssContent string) ThemeMetadata {
 		} else if strings.HasPrefix(line, "Border:") {
 			borderVal := strings.TrimSpace(strings.TrimPrefix(line, "Border:"))
 			meta.Border = borderVal == "true" || borderVal == "1" || borderVal == "yes"
+		} else if strings.HasPrefix(line, "Appearance:") {
+			meta.Appearance = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(line, "Appearance:")))
+		} else if strings.HasPrefix(line, "Pair:") {
+			meta.Pair = strings.TrimSpace(strings.TrimPrefix(line, "Pair:"))
 		}
 	}
 
 	return meta
 }
 
-// ParseSchemesFromTemplate parses all schemes and base CSS from a template file.
-// This is the EXACT code from homepage/main.go parseSchemesFromTemplate
-func ParseSchemesFromTemplate(cssContent string) ([]SchemeInfo, string) {
-	var schemes []SchemeInfo
-	content := cssContent
-	pos := 0
-	lastSchemeEnd := 0
-
-	for pos < len(content) {
-		metaStart := strings.Index(content[pos:], "/*")
-		if metaStart == -1 {
-			break
+// templateNameFromCSS returns the first Template: value found in a top-level comment.
+func templateNameFromCSS(content string, items []cssItem) string {
+	for _, it := range items {
+		if it.kind != cssComment {
+			continue
+		}
+		if meta := ParseThemeMetadata(it.text(content)); meta.Template != "" {
+			return meta.Template
 		}
-		metaStart += pos
+	}
+	return ""
+}
+
+// schemeRules returns the indexes of the rules that make up the scheme whose
+// metadata comment is at items[metaIdx], and whether they use the wrapped
+// ([data-scheme="name"]) format.
+//
+// Wrapped format: every rule directly after the metadata whose selector
+// mentions [data-scheme="name"]. Plain format: a :root block, optionally
+// followed by a body block.
+func schemeRules(items []cssItem, metaIdx int, scheme string) ([]int, bool) {
+	selector := `[data-scheme="` + scheme + `"]`
 
-		metaEnd := strings.Index(content[metaStart:], "*/")
-		if metaEnd == -1 {
+	var idx []int
+	for j := metaIdx + 1; j < len(items); j++ {
+		if items[j].kind != cssRule || !strings.Contains(items[j].prelude, selector) {
 			break
 		}
-		metaEnd += metaStart
+		idx = append(idx, j)
+	}
+	if len(idx) > 0 {
+		return idx, true
+	}
 
-		metadataBlock := content[metaStart : metaEnd+2]
-		meta := ParseThemeMetadata(metadataBlock)
+	j := metaIdx + 1
+	if j >= len(items) || items[j].kind != cssRule || !strings.Contains(items[j].prelude, ":root") {
+		return nil, false
+	}
+	idx = append(idx, j)
+	if j+1 < len(items) && items[j+1].kind == cssRule && items[j+1].prelude == "body" {
+		idx = append(idx, j+1)
+	}
+	return idx, false
+}
 
-		if meta.Template == "" || meta.Scheme == "" {
-			pos = metaEnd + 2
-			continue
-		}
+// scopeRule rewrites a plain-format rule so it only applies to scheme.
+func scopeRule(content string, it cssItem, scheme string) string {
+	selector := `[data-scheme="` + scheme + `"]`
+	text := strings.TrimSpace(it.text(content))
+	brace := strings.Index(text, "{")
+	if brace == -1 {
+		return text
+	}
+	body := text[brace:]
 
-		schemeSelector := `[data-scheme="` + meta.Scheme + `"]`
-		schemeStart := strings.Index(content[metaEnd:], schemeSelector)
-		isWrappedFormat := true
-		if schemeStart == -1 {
-			rootStart := strings.Index(content[metaEnd:], ":root")
-			if rootStart == -1 {
-				pos = metaEnd + 2
-				continue
-			}
-			schemeStart = rootStart + metaEnd
-			isWrappedFormat = false
+	var scoped []string
+	for _, sel := range strings.Split(it.prelude, ",") {
+		sel = strings.TrimSpace(sel)
+		if strings.HasPrefix(sel, ":root") {
+			scoped = append(scoped, ":root"+selector+sel[len(":root"):])
 		} else {
-			schemeStart += metaEnd
-		}
-
-		var schemeEnd int
-		if isWrappedFormat {
-			nextMetaStart := strings.Index(content[schemeStart:], "/*")
-			if nextMetaStart == -1 {
-				baseCSSMarker := strings.Index(content[schemeStart:], "/* Base CSS")
-				if baseCSSMarker != -1 {
-					schemeEnd = schemeStart + baseCSSMarker
-				} else {
-					schemeEnd = len(content)
-				}
-			} else {
-				nextMetaPos := schemeStart + nextMetaStart
-				nextMetaEnd := strings.Index(content[nextMetaPos:], "*/")
-				if nextMetaEnd != -1 {
-					nextMetaBlock := content[nextMetaPos : nextMetaPos+nextMetaEnd+2]
-					nextMeta := ParseThemeMetadata(nextMetaBlock)
-					if nextMeta.Template != "" && nextMeta.Scheme != "" {
-						schemeEnd = nextMetaPos
-					} else {
-						schemeEnd = nextMetaPos
-					}
-				} else {
-					schemeEnd = schemeStart + nextMetaStart
-				}
-			}
-		} else {
-			rootBlockEnd := findBlockEnd(content, schemeStart)
-			schemeEnd = rootBlockEnd
-
-			bodyStart := strings.Index(content[schemeEnd:], "body{")
-			if bodyStart != -1 && bodyStart < 50 {
-				bodyBlockEnd := findBlockEnd(content, schemeEnd+bodyStart)
-				schemeEnd = bodyBlockEnd
-			}
+			scoped = append(scoped, selector+" "+sel)
 		}
+	}
+	return strings.Join(scoped, ", ") + body
+}
+
+// ParseSchemesFromTemplate parses all schemes and base CSS from a template file.
+//
+// A scheme is a comment containing "Template:" and "Scheme:" lines followed
+// directly by its rules, either wrapped in [data-scheme="name"] selectors or
+// as a plain :root block (optionally followed by a body block), which is
+// scoped to the scheme automatically. Base CSS is every other top-level item
+// after the "/* Base CSS" marker comment, or the whole file when there is no
+// marker. Comments inside blocks and nested blocks such as @media are kept
+// intact.
+func ParseSchemesFromTemplate(cssContent string) ([]SchemeInfo, string) {
+	items := tokenizeCSS(cssContent)
+	consumed := make([]bool, len(items))
 
-		schemeCSS := strings.TrimSpace(content[schemeStart:schemeEnd])
-		lastSchemeEnd = schemeEnd
+	var schemes []SchemeInfo
+	seen := make(map[string]bool)
 
-		if !strings.HasPrefix(schemeCSS, `[data-scheme="`) {
-			wrappedCSS := `[data-scheme="` + meta.Scheme + `"] ` + schemeCSS
-			schemeCSS = wrappedCSS
+	for i, it := range items {
+		if it.kind != cssComment || consumed[i] {
+			continue
+		}
+		meta := ParseThemeMetadata(it.text(cssContent))
+		if meta.Template == "" || meta.Scheme == "" {
+			continue
 		}
 
-		alreadyExists := false
-		for _, existingScheme := range schemes {
-			if existingScheme.Name == meta.Scheme {
-				alreadyExists = true
-				break
+		rules, wrapped := schemeRules(items, i, meta.Scheme)
+		if len(rules) == 0 {
+			continue
+		}
+
+		consumed[i] = true
+		parts := make([]string, 0, len(rules))
+		for _, j := range rules {
+			consumed[j] = true
+			if wrapped {
+				parts = append(parts, strings.TrimSpace(items[j].text(cssContent)))
+			} else {
+				parts = append(parts, scopeRule(cssContent, items[j], meta.Scheme))
 			}
 		}
 
-		if !alreadyExists {
-			schemes = append(schemes, SchemeInfo{
-				Name:    meta.Scheme,
-				Accent:  meta.Accent,
-				Display: meta.Display,
-				Border:  meta.Border,
-				CSS:     schemeCSS,
-			})
+		// First definition wins
+		if seen[meta.Scheme] {
+			continue
 		}
+		seen[meta.Scheme] = true
 
-		pos = schemeEnd
+		schemes = append(schemes, SchemeInfo{
+			Name:       meta.Scheme,
+			Accent:     meta.Accent,
+			Display:    meta.Display,
+			Border:     meta.Border,
+			Appearance: meta.Appearance,
+			Pair:       meta.Pair,
+			CSS:        strings.Join(parts, "\n"),
+		})
 	}
 
-	baseCSSStart := strings.Index(content, "/* Base CSS")
-	if baseCSSStart != -1 {
-		baseCSSEnd := strings.Index(content[baseCSSStart:], "*/")
-		if baseCSSEnd != -1 {
-			baseCSSStart = baseCSSStart + baseCSSEnd + 2
-			for baseCSSStart < len(content) && (content[baseCSSStart] == ' ' || content[baseCSSStart] == '\n' || content[baseCSSStart] == '\r' || content[baseCSSStart] == '\t') {
-				baseCSSStart++
-			}
-		}
-	} else {
-		baseCSSStart = lastSchemeEnd
-		for baseCSSStart < len(content) && (content[baseCSSStart] == ' ' || content[baseCSSStart] == '\n' || content[baseCSSStart] == '\r' || content[baseCSSStart] == '\t') {
-			baseCSSStart++
+	baseStart := 0
+	for i, it := range items {
+		if it.kind == cssComment && isBaseCSSMarker(it.text(cssContent)) {
+			consumed[i] = true
+			baseStart = i + 1
+			break
 		}
 	}
 
-	baseCSS := strings.TrimSpace(content[baseCSSStart:])
+	var base []string
+	for i := baseStart; i < len(items); i++ {
+		if consumed[i] {
+			continue
+		}
+		base = append(base, strings.TrimSpace(items[i].text(cssContent)))
+	}
 
-	return schemes, baseCSS
+	return schemes, strings.Join(base, "\n\n")
 }
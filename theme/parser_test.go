@@ -0,0 +1,277 @@
+package theme
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func schemeNames(schemes []SchemeInfo) []string {
+	names := make([]string, len(schemes))
+	for i, s := range schemes {
+		names[i] = s.Name
+	}
+	return names
+}
+
+func TestParseSchemesFromEmbeddedTemplates(t *testing.T) {
+	tests := []struct {
+		file    string
+		schemes []string
+		media   string // Part of an @media block expected in the base CSS
+	}{
+		{"alien.css", []string{"default", "dark", "amber", "industrial", "rust"}, "@media (max-width: 980px)"},
+		{"bladerunner.css", []string{"default", "dark", "neon", "cyberpunk", "purple"}, "@media (max-width: 980px)"},
+		{"forest.css", []string{"default", "dark", "light", "emerald", "moss"}, "@media (max-width: 980px)"},
+		{"matrix.css", []string{"default", "dark", "terminal", "neon", "emerald"}, "@media (max-width: 980px)"},
+		{"minimal.css", []string{"default", "dark", "green", "orange"}, "@media (max-width: 980px)"},
+		{"modern.css", []string{"default"}, "@media (max-width: 980px){\n    .brand{min-width:160px}"},
+		{"nordic.css", []string{"default", "dark"}, "@media (max-width: 980px)"},
+		{"ocean.css", []string{"default", "dark", "light", "teal", "cyan"}, "@media (max-width: 980px)"},
+		{"youtube.css", []string{"default", "dark"}, "@media (max-width: 980px)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			css := readFixture(t, filepath.Join("..", "templates", tt.file))
+			schemes, base := ParseSchemesFromTemplate(css)
+
+			if got := schemeNames(schemes); !sameNames(got, tt.schemes) {
+				t.Fatalf("schemes = %v, want %v", got, tt.schemes)
+			}
+			for _, s := range schemes {
+				if !strings.Contains(s.CSS, `[data-scheme="`+s.Name+`"]`) {
+					t.Errorf("scheme %s CSS is not scoped to it:\n%s", s.Name, s.CSS)
+				}
+				if strings.Contains(base, `[data-scheme="`+s.Name+`"]{`) {
+					t.Errorf("base CSS contains the rules of scheme %s", s.Name)
+				}
+			}
+			if strings.Contains(base, "Scheme:") || strings.HasPrefix(base, "/* Base CSS") {
+				t.Error("base CSS contains scheme metadata or the marker comment")
+			}
+			if !strings.HasPrefix(base, ":root{") {
+				t.Errorf("base CSS doesn't start with the default variables: %.40q", base)
+			}
+			if !strings.Contains(base, tt.media) {
+				t.Errorf("base CSS is missing %q", tt.media)
+			}
+			if templateNameFromCSS(css, tokenizeCSS(css)) != strings.TrimSuffix(tt.file, ".css") {
+				t.Errorf("template name = %q", templateNameFromCSS(css, tokenizeCSS(css)))
+			}
+		})
+	}
+}
+
+// sameNames compares scheme names regardless of the order the template
+// happens to define them in.
+func sameNames(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	seen := make(map[string]bool, len(got))
+	for _, n := range got {
+		seen[n] = true
+	}
+	for _, n := range want {
+		if !seen[n] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseSchemesYouTubeMetadata(t *testing.T) {
+	schemes, _ := ParseSchemesFromTemplate(readFixture(t, filepath.Join("..", "templates", "youtube.css")))
+	if len(schemes) != 2 {
+		t.Fatalf("got %d schemes, want 2", len(schemes))
+	}
+	want := SchemeInfo{Name: "default", Accent: "#FF0000", Display: "Default", Appearance: "light", Pair: "dark"}
+	got := schemes[0]
+	got.CSS = ""
+	if got != want {
+		t.Errorf("default scheme = %+v, want %+v", got, want)
+	}
+	if !strings.HasPrefix(schemes[0].CSS, `:root[data-scheme="default"]{`) {
+		t.Errorf("default scheme CSS = %.40q", schemes[0].CSS)
+	}
+}
+
+// synthwave.css uses plain :root/body scheme blocks, puts the Base CSS
+// marker after the schemes and has comments and strings with braces inside
+// blocks as well as nested @media and @supports rules.
+func TestParseSchemesPlainFormatMarkerLast(t *testing.T) {
+	schemes, base := ParseSchemesFromTemplate(readFixture(t, filepath.Join("testdata", "synthwave.css")))
+
+	if got := schemeNames(schemes); !reflect.DeepEqual(got, []string{"sunset", "daylight"}) {
+		t.Fatalf("schemes = %v", got)
+	}
+	sunset, daylight := schemes[0], schemes[1]
+	if sunset.Accent != "#ff6ec7" || sunset.Display != "Sunset" || sunset.Appearance != "dark" || sunset.Pair != "daylight" || sunset.Border {
+		t.Errorf("sunset metadata = %+v", sunset)
+	}
+	if daylight.Appearance != "light" || daylight.Pair != "sunset" || !daylight.Border {
+		t.Errorf("daylight metadata = %+v", daylight)
+	}
+
+	wantSunset := `:root[data-scheme="sunset"]{
+  --bg: #1a1033; /* deep purple, not } a brace */
+  --accent: #ff6ec7;
+}
+[data-scheme="sunset"] body{
+  background: linear-gradient(180deg, #1a1033, #3b1d60);
+}`
+	if sunset.CSS != wantSunset {
+		t.Errorf("sunset CSS =\n%s\nwant\n%s", sunset.CSS, wantSunset)
+	}
+	if !strings.HasPrefix(daylight.CSS, `:root[data-scheme="daylight"]{`) || strings.Contains(daylight.CSS, "body") {
+		t.Errorf("daylight CSS =\n%s", daylight.CSS)
+	}
+
+	for _, want := range []string{
+		".card {\n  /* a comment with { and } inside a block */\n  border-radius: 12px;\n  content: \"} {\";\n}",
+		"  @supports (display: grid) {\n    .cards { display: grid; }\n  }\n}",
+		"@media print {\n  @media (orientation: landscape) {\n    body { margin: 0; }\n  }\n}",
+	} {
+		if !strings.Contains(base, want) {
+			t.Errorf("base CSS is missing\n%s\ngot\n%s", want, base)
+		}
+	}
+	if strings.Contains(base, "--bg") {
+		t.Errorf("base CSS contains scheme variables:\n%s", base)
+	}
+}
+
+// wrapped-no-marker.css has no Base CSS marker, so everything but the
+// schemes, including the @import before them, is base CSS.
+func TestParseSchemesWithoutMarker(t *testing.T) {
+	schemes, base := ParseSchemesFromTemplate(readFixture(t, filepath.Join("testdata", "wrapped-no-marker.css")))
+
+	if got := schemeNames(schemes); !reflect.DeepEqual(got, []string{"cream", "ink"}) {
+		t.Fatalf("schemes = %v", got)
+	}
+	wantCream := `:root[data-scheme="cream"] {
+  --bg: #fffdf5;
+}
+[data-scheme="cream"] .card {
+  box-shadow: none;
+}`
+	if schemes[0].CSS != wantCream {
+		t.Errorf("cream CSS =\n%s\nwant\n%s", schemes[0].CSS, wantCream)
+	}
+	if schemes[1].Accent != "#222" || schemes[1].Appearance != "" {
+		t.Errorf("ink metadata = %+v", schemes[1])
+	}
+
+	wantBase := `@import url("https://fonts.example.com/inter.css");
+
+.header { letter-spacing: .02em; }
+
+@media (prefers-reduced-motion: reduce) {
+  * { animation: none !important; }
+}`
+	if base != wantBase {
+		t.Errorf("base CSS =\n%s\nwant\n%s", base, wantBase)
+	}
+}
+
+// marker-first.css defines a scheme twice and has a scheme without an
+// accent; a plain-format scheme takes only the body block directly after
+// its :root block.
+func TestParseSchemesDuplicateAndDefaults(t *testing.T) {
+	schemes, base := ParseSchemesFromTemplate(readFixture(t, filepath.Join("testdata", "marker-first.css")))
+
+	if got := schemeNames(schemes); !reflect.DeepEqual(got, []string{"default", "night"}) {
+		t.Fatalf("schemes = %v", got)
+	}
+	if schemes[0].Display != "Default" || !strings.Contains(schemes[0].CSS, "#f1faff") {
+		t.Errorf("the first definition of default didn't win: %+v", schemes[0])
+	}
+	if schemes[1].Accent != "rgba(136,192,208,.85)" {
+		t.Errorf("night accent = %q, want the default", schemes[1].Accent)
+	}
+	if strings.Contains(schemes[1].CSS, "after-body") {
+		t.Errorf("night CSS took a rule after its body block:\n%s", schemes[1].CSS)
+	}
+
+	wantBase := ":root {\n  --bg: #ffffff;\n}\n\n.footer { opacity: .7; }\n\n.after-body { color: red; }"
+	if base != wantBase {
+		t.Errorf("base CSS =\n%s\nwant\n%s", base, wantBase)
+	}
+}
+
+func TestParseSchemesIgnoresCSSBeforeMarker(t *testing.T) {
+	css := `.legacy { color: red; }
+/* Base CSS */
+.kept { color: blue; }`
+	schemes, base := ParseSchemesFromTemplate(css)
+	if len(schemes) != 0 {
+		t.Errorf("schemes = %v", schemeNames(schemes))
+	}
+	if base != ".kept { color: blue; }" {
+		t.Errorf("base CSS = %q", base)
+	}
+}
+
+func TestTokenizeCSS(t *testing.T) {
+	css := `@charset "utf-8";
+/* top */
+a[title="{"] /* } */ , b { color: red; /* { */ }
+@media screen { @media (min-width: 1px) { a { b: c } } }
+.open { x: y;`
+
+	type item struct {
+		kind         cssItemKind
+		prelude      string
+		unterminated bool
+	}
+	want := []item{
+		{cssStatement, `@charset "utf-8"`, false},
+		{cssComment, "", false},
+		{cssRule, `a[title="{"]   , b`, false},
+		{cssRule, "@media screen", false},
+		{cssRule, ".open", true},
+	}
+
+	items := tokenizeCSS(css)
+	got := make([]item, len(items))
+	for i, it := range items {
+		got[i] = item{it.kind, it.prelude, it.unterminated}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("items = %+v, want %+v", got, want)
+	}
+	if text := items[3].text(css); !strings.HasSuffix(text, "} } }") {
+		t.Errorf("@media rule = %q", text)
+	}
+}
+
+func TestParseThemeMetadata(t *testing.T) {
+	meta := ParseThemeMetadata(`/*
+  Template: Retro
+  Scheme: amber
+  Accent: #ffb000
+  Display: Amber CRT
+  Border: 1
+  Appearance: Dark
+  Pair: paper
+*/`)
+	want := ThemeMetadata{Template: "Retro", Scheme: "amber", Accent: "#ffb000", Display: "Amber CRT", Border: true, Appearance: "dark", Pair: "paper"}
+	if meta != want {
+		t.Errorf("metadata = %+v, want %+v", meta, want)
+	}
+
+	if meta := ParseThemeMetadata("/* unterminated\nTemplate: x"); meta.Template != "" || meta.Accent != "rgba(136,192,208,.85)" {
+		t.Errorf("unterminated comment metadata = %+v", meta)
+	}
+}
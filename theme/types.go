@@ -2,25 +2,37 @@ package theme
 
 // ThemeMetadata represents metadata parsed from CSS template files.
 type ThemeMetadata struct {
-	Template string
-	Scheme   string
-	Accent   string
-	Display  string
-	Border   bool
+	Template   string
+	Scheme     string
+	Accent     string
+	Display    string
+	Border     bool
+	Appearance string // "light" or "dark"
+	Pair       string // Scheme to pair with for the "auto" scheme
 }
 
+// Template sources.
+const (
+	SourceEmbedded = "embedded"
+	SourceUser     = "user"
+)
+
 // TemplateInfo contains information about a CSS template and its color schemes.
 type TemplateInfo struct {
 	Name    string
 	BaseCSS string
 	Schemes map[string]SchemeInfo
+	Source  string // SourceEmbedded or SourceUser
+	File    string // File name within its source directory
 }
 
 // SchemeInfo contains information about a color scheme within a template.
 type SchemeInfo struct {
-	Name    string
-	Accent  string
-	Display string
-	Border  bool
-	CSS     string
+	Name       string
+	Accent     string
+	Display    string
+	Border     bool
+	Appearance string
+	Pair       string
+	CSS        string
 }
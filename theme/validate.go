@@ -0,0 +1,140 @@
+package theme
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Issue severities reported by ValidateTemplate.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// ValidationIssue describes a problem found while parsing a template.
+type ValidationIssue struct {
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// ValidationReport is the result of running the template parser on a CSS file.
+type ValidationReport struct {
+	Valid        bool              `json:"valid"`
+	Template     string            `json:"template"`
+	Schemes      []string          `json:"schemes"`
+	BaseCSSBytes int               `json:"base_css_bytes"`
+	Issues       []ValidationIssue `json:"issues"`
+}
+
+// ValidateTemplate runs the template parser on content and explains why
+// metadata blocks did or did not turn into schemes.
+func ValidateTemplate(fileName string, content string) ValidationReport {
+	report := ValidationReport{
+		Schemes: []string{},
+		Issues:  []ValidationIssue{},
+	}
+	addIssue := func(offset int, severity, format string, args ...interface{}) {
+		report.Issues = append(report.Issues, ValidationIssue{
+			Line:     lineAt(content, offset),
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	schemes, baseCSS := ParseSchemesFromTemplate(content)
+	parsed := make(map[string]bool, len(schemes))
+	for _, scheme := range schemes {
+		parsed[scheme.Name] = true
+		report.Schemes = append(report.Schemes, scheme.Name)
+	}
+	report.BaseCSSBytes = len(baseCSS)
+
+	items := tokenizeCSS(content)
+	hasMarker := false
+	seen := make(map[string]int)
+	for i, it := range items {
+		if it.unterminated {
+			if it.kind == cssComment {
+				addIssue(it.start, SeverityError, "unterminated comment; everything after it is ignored")
+			} else {
+				addIssue(it.start, SeverityError, "unbalanced braces in %q; the block runs to the end of the file", it.prelude)
+			}
+			continue
+		}
+		if it.kind != cssComment {
+			continue
+		}
+
+		block := it.text(content)
+		if isBaseCSSMarker(block) {
+			hasMarker = true
+		}
+		hasTemplate := strings.Contains(block, "Template:")
+		hasScheme := strings.Contains(block, "Scheme:")
+		if !hasTemplate && !hasScheme {
+			continue
+		}
+
+		meta := ParseThemeMetadata(block)
+		switch {
+		case meta.Template == "" && meta.Scheme == "":
+			addIssue(it.start, SeverityError, "Template:/Scheme: must each start their own line inside the comment")
+			continue
+		case meta.Template == "":
+			addIssue(it.start, SeverityError, "scheme %q has no Template: line in its metadata block", meta.Scheme)
+			continue
+		case meta.Scheme == "":
+			addIssue(it.start, SeverityWarning, "metadata block for template %q has no Scheme: line and only names the template", meta.Template)
+			continue
+		}
+
+		if first, dup := seen[meta.Scheme]; dup {
+			addIssue(it.start, SeverityWarning, "scheme %q is already defined on line %d; this definition is ignored", meta.Scheme, first)
+			continue
+		}
+		seen[meta.Scheme] = lineAt(content, it.start)
+
+		if parsed[meta.Scheme] {
+			continue
+		}
+
+		next := "end of file"
+		if i+1 < len(items) {
+			switch items[i+1].kind {
+			case cssComment:
+				next = "another comment"
+			default:
+				next = fmt.Sprintf("%q", items[i+1].prelude)
+			}
+		}
+		addIssue(it.start, SeverityError, `scheme %q: expected a [data-scheme="%s"] rule or a :root block right after its metadata, found %s`, meta.Scheme, meta.Scheme, next)
+	}
+
+	if !hasMarker {
+		addIssue(0, SeverityWarning, "no /* Base CSS */ marker; every rule that isn't part of a scheme is used as base CSS")
+	}
+	if len(schemes) == 0 {
+		addIssue(0, SeverityError, "no schemes found; each scheme needs a comment with Template: and Scheme: lines followed by its CSS")
+	} else if _, ok := parsed["default"]; !ok {
+		names := append([]string(nil), report.Schemes...)
+		sort.Strings(names)
+		addIssue(0, SeverityWarning, "no \"default\" scheme; %q is used when none is selected", names[0])
+	}
+
+	if info, err := ParseTemplate(fileName, content); err == nil {
+		report.Template = info.Name
+		report.Valid = true
+	}
+
+	return report
+}
+
+// lineAt returns the 1-based line number of offset in content.
+func lineAt(content string, offset int) int {
+	if offset > len(content) {
+		offset = len(content)
+	}
+	return strings.Count(content[:offset], "\n") + 1
+}
@@ -0,0 +1,66 @@
+package theme
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Watch polls the user themes directory every interval and reloads all
+// templates when a file is added, removed or modified. It blocks until ctx
+// is cancelled. Polling is used so it works the same on every platform and
+// on network filesystems.
+func (m *Manager) Watch(ctx context.Context, interval time.Duration) {
+	if m.userDir == "" {
+		return
+	}
+
+	last := m.dirFingerprint()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("[themes] watching %s for changes", m.userDir)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := m.dirFingerprint()
+			if current == last {
+				continue
+			}
+			last = current
+			log.Printf("[themes] change detected in %s, reloading", m.userDir)
+			if err := m.Reload(); err != nil {
+				log.Printf("[themes] reload failed: %v", err)
+			}
+		}
+	}
+}
+
+// dirFingerprint summarizes the names, sizes and modification times of the
+// CSS files in the user themes directory.
+func (m *Manager) dirFingerprint() string {
+	entries, err := os.ReadDir(m.userDir)
+	if err != nil {
+		return ""
+	}
+
+	parts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".css") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", entry.Name(), info.Size(), info.ModTime().UnixNano()))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "|")
+}
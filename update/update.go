@@ -0,0 +1,171 @@
+// Package update checks a releases endpoint for newer versions of
+// speedplane.
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Update check defaults.
+const (
+	DefaultURL      = "https://api.github.com/repos/network-plane/speedplane/releases/latest"
+	DefaultInterval = 24 * time.Hour
+)
+
+// Release is the latest release the endpoint reports.
+type Release struct {
+	Version     string    `json:"version"`
+	URL         string    `json:"url,omitempty"` // Release notes
+	PublishedAt time.Time `json:"published_at,omitempty"`
+}
+
+// Status is what /api/version reports.
+type Status struct {
+	Version         string     `json:"version"`
+	Latest          string     `json:"latest,omitempty"` // Empty until a check succeeds
+	UpdateAvailable bool       `json:"update_available"`
+	ReleaseURL      string     `json:"release_url,omitempty"`
+	CheckedAt       *time.Time `json:"checked_at,omitempty"`
+}
+
+// Checker polls URL, a GitHub "latest release" endpoint or anything
+// returning the same tag_name, html_url and published_at fields.
+type Checker struct {
+	URL     string // Defaults to DefaultURL
+	Current string // Running version, e.g. "1.1.39"
+	Client  *http.Client
+
+	mu        sync.Mutex
+	latest    *Release
+	checkedAt time.Time
+}
+
+// NewChecker creates a Checker for the running version with a 15 second
+// request timeout.
+func NewChecker(url, current string) *Checker {
+	return &Checker{URL: url, Current: current, Client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// Check fetches the latest release and remembers it.
+func (c *Checker) Check(ctx context.Context) (Release, error) {
+	url := c.URL
+	if url == "" {
+		url = DefaultURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Release{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "speedplane/"+c.Current)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return Release{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return Release{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var body struct {
+		TagName     string    `json:"tag_name"`
+		HTMLURL     string    `json:"html_url"`
+		PublishedAt time.Time `json:"published_at"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return Release{}, fmt.Errorf("decode release: %w", err)
+	}
+	if body.TagName == "" {
+		return Release{}, fmt.Errorf("release has no tag_name")
+	}
+	rel := Release{Version: strings.TrimPrefix(body.TagName, "v"), URL: body.HTMLURL, PublishedAt: body.PublishedAt}
+
+	c.mu.Lock()
+	c.latest = &rel
+	c.checkedAt = time.Now().UTC()
+	c.mu.Unlock()
+	return rel, nil
+}
+
+// Status reports the running and latest versions.
+func (c *Checker) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := Status{Version: c.Current}
+	if c.latest != nil {
+		checked := c.checkedAt
+		st.Latest = c.latest.Version
+		st.ReleaseURL = c.latest.URL
+		st.CheckedAt = &checked
+		st.UpdateAvailable = Newer(c.latest.Version, c.Current)
+	}
+	return st
+}
+
+// Run checks now and then every interval until ctx is cancelled, calling
+// onUpdate once for each newer release found.
+func (c *Checker) Run(ctx context.Context, interval time.Duration, onUpdate func(Release)) {
+	announced := ""
+	for {
+		rel, err := c.Check(ctx)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				log.Printf("update check: %v", err)
+			}
+		case Newer(rel.Version, c.Current) && rel.Version != announced:
+			announced = rel.Version
+			log.Printf("update check: speedplane %s is available (running %s): %s", rel.Version, c.Current, rel.URL)
+			onUpdate(rel)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Newer reports whether version a is newer than b, comparing dotted numeric
+// versions such as "1.2.10" part by part, with an optional "v" prefix.
+// Pre-release suffixes such as "-rc1" count as older than the release.
+func Newer(a, b string) bool {
+	an, apre := parseVersion(a)
+	bn, bpre := parseVersion(b)
+	for i := 0; i < len(an) || i < len(bn); i++ {
+		var x, y int
+		if i < len(an) {
+			x = an[i]
+		}
+		if i < len(bn) {
+			y = bn[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return !apre && bpre
+}
+
+func parseVersion(v string) (parts []int, prerelease bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		prerelease = v[i] == '-'
+		v = v[:i]
+	}
+	for _, p := range strings.Split(v, ".") {
+		n, _ := strconv.Atoi(p)
+		parts = append(parts, n)
+	}
+	return parts, prerelease
+}
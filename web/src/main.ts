@@ -11,6 +11,28 @@ type SpeedtestResult = {
   server_id?: string;
   server_name?: string;
   server_country?: string;
+  engine?: string;
+  link?: LinkInfo;
+  lan?: LANHealth;
+  path_mtu?: { address: string; mtu?: number; error?: string };
+  phases?: Record<string, { status: string; error?: string }>; // Only for partial results
+  timings?: PhaseTimings;
+};
+
+type PhaseTimings = {
+  server_selection_ms: number;
+  ping_ms?: number;
+  download_ms?: number;
+  upload_ms?: number;
+  total_ms: number;
+};
+
+type LinkInfo = {
+  interface: string;
+  type: "wired" | "wifi" | "virtual" | "unknown";
+  speed_mbps?: number;
+  ssid?: string;
+  signal_dbm?: number;
 };
 
 type Aggregate = {
@@ -22,18 +44,107 @@ type Aggregate = {
   avg_packet_loss_pct: number;
 };
 
+// How steady a period's results were, see model.Consistency.
+type MetricConsistency = {
+  median: number;
+  p5?: number;
+  p95?: number;
+  ratio: number;
+  cv_pct: number;
+  score: number;
+};
+
+type Consistency = {
+  download?: MetricConsistency;
+  upload?: MetricConsistency;
+  ping?: MetricConsistency;
+  score: number;
+};
+
 type SummaryResponse = {
   latest?: SpeedtestResult;
   averages: Record<string, Aggregate>;
+  consistency?: Record<string, Consistency>;
+  plan?: {
+    current?: PlanPeriod;
+    latest?: PlanPct;
+    averages: Record<string, PlanPct>;
+  };
+};
+
+// An ISP plan with the time it was in effect, from /api/plans.
+type PlanPeriod = {
+  provider: string;
+  download_mbps: number;
+  upload_mbps: number;
+  from: string;
+  to?: string;
+};
+
+type PlanPct = {
+  download_pct: number;
+  upload_pct: number;
 };
 
 type Schedule = {
   id: string;
   name: string;
-  type: "interval" | "daily";
+  type: "interval" | "daily" | "cron";
   enabled: boolean;
   every?: string;
   time_of_day?: string;
+  cron?: string;
+  connection?: string;
+  engines?: string[]; // Run back to back in each slot; empty runs the default engine
+  alerts?: ScheduleAlerts;
+};
+
+// Per-schedule alert overrides; only editable in the config file, but kept
+// when a schedule is edited here.
+type ScheduleAlerts = {
+  silent?: boolean;
+  webhooks?: string[];
+  rules?: unknown[];
+};
+
+type AlertRule = {
+  id: string;
+  name: string;
+  enabled: boolean;
+  metric: string;
+  operator: "<" | ">";
+  threshold: number;
+  recover?: number;
+  for?: number;
+  recover_for?: number;
+  renotify_every?: string;
+  severity?: string;
+};
+
+type AlertState = {
+  rule: AlertRule;
+  state: "ok" | "degraded";
+  since: string;
+  acknowledged?: string;
+  snoozed_until?: string;
+};
+
+type AlertRecord = {
+  id: number;
+  time: string;
+  kind: "degraded" | "recovered" | "reminder";
+  rule_id: string;
+  rule_name: string;
+  metric: string;
+  operator: string;
+  threshold: number;
+  value: number;
+  severity: string;
+  since: string;
+  schedule?: string;
+  result_id?: string;
+  acknowledged_at?: string;
+  snoozed?: boolean;
 };
 
 type RangeKey = "24h" | "7d" | "30d";
@@ -60,11 +171,118 @@ async function fetchJSON<T>(url: string, options: RequestInit = {}): Promise<T>
   return (await res.json()) as T;
 }
 
+// Data the index page embeds so the dashboard renders without waiting for
+// the API, see /api/bootstrap. Each part is used once, by the first load.
+type Bootstrap = {
+  summary?: SummaryResponse;
+  schedules?: Schedule[];
+  next_run?: NextRunResponse;
+  read_only?: boolean;
+};
+
+const bootstrap: Bootstrap = readBootstrap();
+
+// A visitor of a public dashboard without the admin token only gets the
+// summary, charts and latest result; the rest of the API answers 401.
+const readOnly = bootstrap.read_only === true;
+
+function readBootstrap(): Bootstrap {
+  const el = document.getElementById("bootstrap-data");
+  if (!el?.textContent) return {};
+  try {
+    return (JSON.parse(el.textContent) as Bootstrap | null) ?? {};
+  } catch (err) {
+    console.error("Failed to read embedded dashboard data:", err);
+    return {};
+  }
+}
+
 function formatNumber(val: number | undefined | null, digits = 2): string {
   if (val == null || Number.isNaN(val)) return "–";
   return val.toFixed(digits);
 }
 
+type PingStats = {
+  address: string;
+  rtt_avg_ms?: number;
+  loss_pct: number;
+  error?: string;
+};
+
+type LANHealth = {
+  gateway?: PingStats;
+  dns?: PingStats;
+  interface?: { rx_errors: number; tx_errors: number; rx_dropped: number; tx_dropped: number };
+};
+
+// formatPing summarises a gateway or DNS ping, e.g. "192.168.1.1: 0.8 ms, 0% loss".
+function formatPing(p: PingStats | undefined): string {
+  if (!p) return "–";
+  if (p.error && p.loss_pct >= 100) return `${p.address || "?"}: ${p.error}`;
+  const rtt = p.rtt_avg_ms != null ? `${formatNumber(p.rtt_avg_ms, 1)} ms, ` : "";
+  return `${p.address}: ${rtt}${formatNumber(p.loss_pct, 0)}% loss`;
+}
+
+// metricPhases maps result metrics to the test phase measuring them.
+const metricPhases: Record<string, string> = {
+  download_mbps: "download",
+  upload_mbps: "upload",
+  ping_ms: "ping",
+  jitter_ms: "ping",
+};
+
+// failedPhase returns why the phase measuring key failed in a partial
+// result, whose value for key is then zero rather than measured.
+function failedPhase(r: SpeedtestResult, key: string): string | undefined {
+  const p = r.phases?.[metricPhases[key]];
+  return p?.status === "failed" ? p.error || "failed" : undefined;
+}
+
+// metricCell is a history table cell for key, marking a failed phase.
+function metricCell(r: SpeedtestResult, key: "download_mbps" | "upload_mbps" | "ping_ms" | "jitter_ms", digits = 2): string {
+  const failure = failedPhase(r, key);
+  if (failure) return `<td class="phase-failed" title="${failure.replace(/"/g, "&quot;")}">failed</td>`;
+  return `<td>${formatNumber(r[key] ?? 0, digits)}</td>`;
+}
+
+// formatTimings lists how long the steps of a test took, e.g.
+// "server 1.2 s, ping 0.8 s, download 15.1 s, upload 15.3 s (total 33.0 s)".
+function formatTimings(t: PhaseTimings): string {
+  const steps: [string, number | undefined][] = [
+    ["server", t.server_selection_ms],
+    ["ping", t.ping_ms],
+    ["download", t.download_ms],
+    ["upload", t.upload_ms],
+  ];
+  const parts = steps.filter(([, ms]) => ms).map(([name, ms]) => `${name} ${formatNumber(ms! / 1000, 1)} s`);
+  return `${parts.join(", ")} (total ${formatNumber(t.total_ms / 1000, 1)} s)`;
+}
+
+// formatLink describes the link a test ran over, e.g. "Wi-Fi (home, -58 dBm)"
+// or "Wired (1000 Mbps)".
+function formatLink(link: LinkInfo | undefined): string {
+  if (!link) return "–";
+  const details: string[] = [];
+  let label: string;
+  switch (link.type) {
+    case "wifi":
+      label = "Wi-Fi";
+      if (link.ssid) details.push(link.ssid);
+      if (link.signal_dbm) details.push(`${link.signal_dbm} dBm`);
+      break;
+    case "wired":
+      label = "Wired";
+      if (link.speed_mbps) details.push(`${link.speed_mbps} Mbps`);
+      break;
+    case "virtual":
+      label = "VPN/Tunnel";
+      break;
+    default:
+      label = link.interface;
+  }
+  return details.length ? `${label} (${details.join(", ")})` : label;
+}
+
 function formatDate(date: Date): string {
   const year = date.getFullYear();
   const month = String(date.getMonth() + 1).padStart(2, "0");
@@ -173,9 +391,242 @@ function updateComparison(
   compareEl.innerHTML = `<span class="arrow">${arrow}</span> ${formatNumber(absPercent, 2)}% ${text}`;
 }
 
+/* ---------- CONNECTIONS ---------- */
+
+// Named connection the dashboard shows; empty shows all connections.
+let selectedConnection = "";
+
+function connectionParam(): string {
+  return selectedConnection
+    ? "&connection=" + encodeURIComponent(selectedConnection)
+    : "";
+}
+
+// Plans of the selected connection, drawn on the download and upload charts
+let planHistory: PlanPeriod[] = [];
+
+async function loadPlans(): Promise<void> {
+  const data = await fetchJSON<{ plans: PlanPeriod[] }>(
+    "/api/plans?" + connectionParam().slice(1),
+  );
+  planHistory = data.plans ?? [];
+}
+
+// planSpeedAt returns the plan's speed for a chart key at time t, or NaN
+// when no plan was in effect.
+function planSpeedAt(t: number, key: string): number {
+  if (key !== "download_mbps" && key !== "upload_mbps") return NaN;
+  for (let i = planHistory.length - 1; i >= 0; i--) {
+    const p = planHistory[i];
+    if (new Date(p.from).getTime() <= t) {
+      return key === "download_mbps" ? p.download_mbps : p.upload_mbps;
+    }
+  }
+  return NaN;
+}
+
+// A WAN utilization sample from the router's counters, from /api/utilization.
+type UtilizationSample = {
+  timestamp: string;
+  download_mbps: number;
+  upload_mbps: number;
+  download_pct?: number;
+  upload_pct?: number;
+  error?: string;
+};
+
+// loadUtilization draws the last 24 hours of WAN traffic, with the speedtests
+// run meanwhile as dots on top. The panel stays hidden unless the router's
+// counters are being read.
+async function loadUtilization(): Promise<void> {
+  const [samples, results] = await Promise.all([
+    fetchJSON<UtilizationSample[]>("/api/utilization?" + connectionParam().slice(1)),
+    loadHistoryForRange("24h"),
+  ]);
+  const points = samples.filter((s) => !s.error);
+  const panel = $("utilization-panel");
+  if (!points.length) {
+    panel.style.display = "none";
+    return;
+  }
+  panel.style.display = "";
+
+  const container = $("utilization-chart");
+  container.innerHTML = "";
+  const svgNS = "http://www.w3.org/2000/svg";
+  const width = 300;
+  const height = 50;
+  const paddingX = 12;
+  const paddingY = 8;
+  const paddingBottom = 12;
+  const svg = document.createElementNS(svgNS, "svg");
+  svg.setAttribute("viewBox", `0 0 ${width} ${height}`);
+  svg.setAttribute("preserveAspectRatio", "xMidYMid meet");
+  svg.style.width = "100%";
+  svg.style.height = "100%";
+
+  const maxX = Date.now();
+  const minX = maxX - 24 * 3600 * 1000;
+  let maxY = 1;
+  for (const p of points) maxY = Math.max(maxY, p.download_mbps, p.upload_mbps);
+  const x = (t: number) => paddingX + ((t - minX) / (maxX - minX)) * (width - 2 * paddingX);
+  const y = (v: number) => height - paddingBottom - (v / maxY) * (height - paddingY - paddingBottom);
+
+  for (const [key, color] of [
+    ["download_mbps", "#1e90ff"],
+    ["upload_mbps", "#a55eea"],
+  ] as const) {
+    const d = points
+      .map((p, i) => `${i ? "L" : "M"}${x(new Date(p.timestamp).getTime()).toFixed(2)},${y(p[key]).toFixed(2)}`)
+      .join(" ");
+    const path = document.createElementNS(svgNS, "path");
+    path.setAttribute("d", d);
+    path.setAttribute("fill", "none");
+    path.setAttribute("stroke", color);
+    path.setAttribute("stroke-width", "0.4");
+    svg.appendChild(path);
+  }
+
+  for (const r of results) {
+    const t = new Date(r.timestamp).getTime();
+    if (t < minX) continue;
+    const dot = document.createElementNS(svgNS, "circle");
+    dot.setAttribute("cx", x(t).toFixed(2));
+    dot.setAttribute("cy", (height - paddingBottom).toFixed(2));
+    dot.setAttribute("r", "0.9");
+    dot.setAttribute("fill", "#ffb341");
+    const title = document.createElementNS(svgNS, "title");
+    title.textContent = `${formatDateTime(new Date(t))}: ${formatNumber(r.download_mbps, 1)} / ${formatNumber(r.upload_mbps, 1)} Mbps`;
+    dot.appendChild(title);
+    svg.appendChild(dot);
+  }
+
+  const label = document.createElementNS(svgNS, "text");
+  label.setAttribute("x", "1");
+  label.setAttribute("y", (paddingY + 1).toFixed(2));
+  label.setAttribute("fill", "#B0B0B0");
+  label.setAttribute("font-size", "2.2");
+  label.textContent = formatNumber(maxY, 0);
+  svg.appendChild(label);
+
+  container.appendChild(svg);
+}
+
+// Unsaved manual runs the server still holds, with when it lets go of them.
+interface ManualResult extends SpeedtestResult {
+  expires_at: string;
+}
+
+// loadManualResults lists the unsaved manual runs above the results, each
+// with actions to save or discard it. The panel is hidden while there are none.
+async function loadManualResults(): Promise<void> {
+  const panel = $("manual-results-panel");
+  const tbody = $("manual-results-table").querySelector("tbody");
+  if (!tbody) return;
+  const results = await fetchJSON<ManualResult[]>("/api/manual-results");
+  panel.style.display = results.length > 0 ? "" : "none";
+  tbody.innerHTML = "";
+  for (const r of results) {
+    const tr = document.createElement("tr");
+    tr.title = `Kept until ${formatDateTime(new Date(r.expires_at))}`;
+    tr.innerHTML = `
+      <td>${formatDateTime(new Date(r.timestamp))}</td>
+      <td>${formatNumber(r.download_mbps)}</td>
+      <td>${formatNumber(r.upload_mbps)}</td>
+      <td>${formatNumber(r.ping_ms, 1)}</td>
+      <td>${r.server_name || r.server_id || "–"}</td>
+      <td style="display: flex; gap: 6px;">
+        <button class="btn" data-manual-action="save" data-result-id="${r.id}" style="padding: 4px 8px; font-size: 12px;">${panel.dataset.saveLabel}</button>
+        <button class="btn" data-manual-action="discard" data-result-id="${r.id}" style="padding: 4px 8px; font-size: 12px;">${panel.dataset.discardLabel}</button>
+      </td>
+    `;
+    tbody.appendChild(tr);
+  }
+}
+
+function setupManualResults(): void {
+  const tbody = $("manual-results-table").querySelector("tbody");
+  tbody?.addEventListener("click", async (e) => {
+    const btn = (e.target as HTMLElement).closest("button[data-manual-action]") as HTMLButtonElement | null;
+    if (!btn) return;
+    const id = encodeURIComponent(btn.dataset.resultId ?? "");
+    const save = btn.dataset.manualAction === "save";
+    btn.disabled = true;
+    const res = await fetch(save ? `/api/manual-results/${id}/save` : `/api/manual-results/${id}`, {
+      method: save ? "POST" : "DELETE",
+    });
+    if (!res.ok && res.status !== 404) {
+      alert(`Failed to ${save ? "save" : "discard"} result: ${await res.text()}`);
+      btn.disabled = false;
+      return;
+    }
+    await (save ? refreshDashboard() : loadManualResults());
+  });
+}
+
+async function refreshDashboard(): Promise<void> {
+  if (!readOnly) {
+    await loadPlans().catch((err) => console.error("load plans failed", err));
+  }
+  const isCombinedGraph = localStorage.getItem("combined-graph") === "true";
+  const chartPromises = isCombinedGraph
+    ? [updateCombinedChart()]
+    : [
+        updateDownloadChart(),
+        updateUploadChart(),
+        updateLatencyChart(),
+        updateJitterChart(),
+      ];
+
+  if (readOnly) {
+    await Promise.all([loadSummary(), ...chartPromises]);
+    return;
+  }
+  await Promise.all([
+    loadSummary(),
+    loadHistoryTable(),
+    loadManualResults().catch((err) => console.error("load manual results failed", err)),
+    loadUtilization().catch((err) => console.error("load utilization failed", err)),
+    ...chartPromises,
+  ]);
+}
+
+// The selector is only shown when named connections are configured.
+async function setupConnectionSelect(): Promise<void> {
+  const select = $("connection-select") as HTMLSelectElement;
+  const connections = await fetchJSON<string[]>("/api/connections");
+  if (connections.length < 2) return;
+
+  const all = document.createElement("option");
+  all.value = "";
+  all.textContent = "all";
+  select.appendChild(all);
+  for (const name of connections) {
+    const opt = document.createElement("option");
+    opt.value = name;
+    opt.textContent = name;
+    select.appendChild(opt);
+  }
+  select.style.display = "";
+
+  select.addEventListener("change", () => {
+    selectedConnection = select.value;
+    historyCurrentPage = 1;
+    refreshDashboard().catch((err) => console.error(err));
+  });
+}
+
 async function loadSummary(): Promise<void> {
-  const data = await fetchJSON<SummaryResponse>("/api/summary");
+  // The embedded summary covers all connections
+  const data =
+    bootstrap.summary && !selectedConnection
+      ? bootstrap.summary
+      : await fetchJSON<SummaryResponse>(
+          "/api/summary?" + connectionParam().slice(1),
+        );
+  bootstrap.summary = undefined;
 
+  renderConsistency(data.consistency?.["last7days"]);
   if (data.latest) {
     $("latest-download-value").textContent = formatNumber(
       data.latest.download_mbps,
@@ -183,6 +634,13 @@ async function loadSummary(): Promise<void> {
     $("latest-upload-value").textContent = formatNumber(
       data.latest.upload_mbps,
     );
+    const planPct = data.plan?.latest;
+    $("latest-download-value").title = planPct
+      ? `${formatNumber(planPct.download_pct, 0)}% of plan`
+      : "";
+    $("latest-upload-value").title = planPct
+      ? `${formatNumber(planPct.upload_pct, 0)}% of plan`
+      : "";
     $("latest-ping-value").textContent = formatNumber(data.latest.ping_ms, 1);
     $("latest-jitter-value").textContent = formatNumber(
       data.latest.jitter_ms ?? 0,
@@ -242,6 +700,22 @@ async function loadSummary(): Promise<void> {
   }
 }
 
+// renderConsistency fills the consistency card: the score, and how the
+// worst download tests compare with a typical one.
+function renderConsistency(c: Consistency | undefined): void {
+  const value = $("consistency-value");
+  const detail = $("consistency-detail");
+  if (!c) {
+    value.textContent = "–";
+    detail.textContent = "Too few results";
+    return;
+  }
+  value.textContent = formatNumber(c.score, 0);
+  detail.textContent = c.download
+    ? `Download P5 ${formatNumber(c.download.ratio * 100, 0)}% of median, CV ${formatNumber(c.download.cv_pct, 0)}%`
+    : "";
+}
+
 /* ---------- HISTORY TABLE ---------- */
 
 type HistoryPageResponse = {
@@ -261,7 +735,7 @@ function getHistoryPageCount(): number {
 async function loadHistoryTable(): Promise<void> {
   const perPage = historyPerPage;
   const offset = (historyCurrentPage - 1) * perPage;
-  const url = `/api/history?range=all&limit=${perPage}&offset=${offset}`;
+  const url = `/api/history?range=all&limit=${perPage}&offset=${offset}${connectionParam()}`;
 
   const data = await fetchJSON<HistoryPageResponse>(url);
   const rows = data.results;
@@ -286,10 +760,10 @@ async function loadHistoryTable(): Promise<void> {
     tr.innerHTML = `
       <td style="font-family: monospace; font-size: 11px;">${r.id.substring(0, 8)}</td>
       <td>${formatDateTime(new Date(r.timestamp))}</td>
-      <td>${formatNumber(r.download_mbps)}</td>
-      <td>${formatNumber(r.upload_mbps)}</td>
-      <td>${formatNumber(r.ping_ms, 1)}</td>
-      <td>${formatNumber(r.jitter_ms ?? 0, 1)}</td>
+      ${metricCell(r, "download_mbps")}
+      ${metricCell(r, "upload_mbps")}
+      ${metricCell(r, "ping_ms", 1)}
+      ${metricCell(r, "jitter_ms", 1)}
       <td>${
         (r.packet_loss_pct ?? -1) < 0
           ? "—"
@@ -298,6 +772,7 @@ async function loadHistoryTable(): Promise<void> {
       <td style="font-family: monospace; font-size: 12px;">${r.external_ip || "–"}</td>
       <td>${r.isp || "–"}</td>
       <td>${serverInfo}</td>
+      <td title="${r.link?.interface ?? ""}">${formatLink(r.link)}</td>
       <td>
         <button class="btn delete-result-btn" data-result-id="${r.id}" style="padding: 4px 8px; font-size: 12px; background-color: #dc3545; color: white; border: none;">Delete</button>
       </td>
@@ -399,21 +874,7 @@ async function deleteResult(id: string): Promise<void> {
     }
 
     // Reload the history table and refresh charts
-    const isCombinedGraph = localStorage.getItem("combined-graph") === "true";
-    const chartPromises = isCombinedGraph
-      ? [updateCombinedChart()]
-      : [
-          updateDownloadChart(),
-          updateUploadChart(),
-          updateLatencyChart(),
-          updateJitterChart(),
-        ];
-
-    await Promise.all([
-      loadSummary(),
-      loadHistoryTable(),
-      ...chartPromises,
-    ]);
+    await refreshDashboard();
   } catch (err) {
     console.error("Delete result error:", err);
     alert("Failed to delete result");
@@ -423,7 +884,8 @@ async function deleteResult(id: string): Promise<void> {
 /* ---------- SIMPLE SVG LINE CHARTS ---------- */
 
 async function loadHistoryForRange(range: RangeKey): Promise<SpeedtestResult[]> {
-  const url = "/api/history?range=" + encodeURIComponent(range);
+  const url =
+    "/api/history?range=" + encodeURIComponent(range) + connectionParam();
   return await fetchJSON<SpeedtestResult[]>(url);
 }
 
@@ -450,7 +912,8 @@ async function loadChartData(
     "/api/chart-data?range=" +
     encodeURIComponent(range) +
     "&metric=" +
-    encodeURIComponent(metric);
+    encodeURIComponent(metric) +
+    connectionParam();
   return await fetchJSON<ChartDataResponse>(url);
 }
 
@@ -630,6 +1093,15 @@ function renderLineChart(
     return;
   }
 
+  // Keep the plan in effect at each test in view
+  const planValues = times.map((t) => planSpeedAt(t, key));
+  for (const v of planValues) {
+    if (Number.isFinite(v)) {
+      minY = Math.min(minY, v);
+      maxY = Math.max(maxY, v);
+    }
+  }
+
   if (minY === maxY) {
     const delta = minY === 0 ? 1 : minY * 0.1;
     minY -= delta;
@@ -708,7 +1180,9 @@ function renderLineChart(
   });
 
   // Calculate and draw average line
-  const avgValue = values.reduce((sum, val) => sum + val, 0) / values.length;
+  // Failed phases of partial results measured nothing, so leave them out
+  const measured = values.filter((_, i) => !failedPhase(drawRows[i], key));
+  const avgValue = measured.reduce((sum, val) => sum + val, 0) / measured.length;
   if (Number.isFinite(avgValue) && avgValue >= minY && avgValue <= maxY) {
     const avgYNorm = (avgValue - minY) / (maxY - minY);
     const avgY = paddingY + innerH - avgYNorm * innerH;
@@ -734,7 +1208,7 @@ function renderLineChart(
       tooltip.innerHTML = `
         <div style="font-weight: 600; margin-bottom: 2px;">Average ${metricInfo.name}</div>
         <div>${formatNumber(avgValue, 2)} ${metricInfo.unit}</div>
-        <div style="color: var(--muted, #B0B0B0); font-size: 10px; margin-top: 2px;">Based on ${drawRows.length} measurement${drawRows.length !== 1 ? "s" : ""}</div>
+        <div style="color: var(--muted, #B0B0B0); font-size: 10px; margin-top: 2px;">Based on ${measured.length} measurement${measured.length !== 1 ? "s" : ""}</div>
       `;
       tooltip.style.display = "block";
 
@@ -751,6 +1225,32 @@ function renderLineChart(
     svg.appendChild(avgLine);
   }
 
+  // Draw the plan as a step line, changing where a new plan took effect
+  let planD = "";
+  coords.forEach((coord, i) => {
+    const v = planValues[i];
+    if (!Number.isFinite(v)) return;
+    const y = paddingY + innerH - ((v - minY) / (maxY - minY)) * innerH;
+    const prev = i > 0 ? planValues[i - 1] : NaN;
+    if (!Number.isFinite(prev)) {
+      planD += `M${coord.x.toFixed(2)},${y.toFixed(2)} `;
+    } else {
+      planD += `H${coord.x.toFixed(2)} V${y.toFixed(2)} `;
+    }
+  });
+  if (planD) {
+    const planPath = document.createElementNS(svgNS, "path");
+    planPath.setAttribute("d", planD.trim());
+    planPath.setAttribute("fill", "none");
+    planPath.setAttribute("stroke", "rgba(46,213,115,0.7)");
+    planPath.setAttribute("stroke-width", "0.5");
+    planPath.setAttribute("stroke-dasharray", "1,1");
+    const title = document.createElementNS(svgNS, "title");
+    title.textContent = `Plan ${metricInfo.name.toLowerCase()} speed`;
+    planPath.appendChild(title);
+    svg.appendChild(planPath);
+  }
+
   // Draw the data line
   const path = document.createElementNS(svgNS, "path");
   const d = coords
@@ -767,17 +1267,30 @@ function renderLineChart(
 
   // Draw data points with tooltips
   coords.forEach((coord, index) => {
+    const row = drawRows[index];
+    const value = values[index];
+    const date = new Date(row.timestamp);
+    // A phase that failed in a partial result is drawn hollow and red
+    const failure = failedPhase(row, key);
+    const pointStyle = () => {
+      circle.setAttribute("r", "1.2");
+      circle.setAttribute("fill", failure ? "none" : "#ffb341");
+      if (failure) {
+        circle.setAttribute("stroke", "#ff4757");
+        circle.setAttribute("stroke-width", "0.4");
+      } else {
+        circle.removeAttribute("stroke");
+        circle.removeAttribute("stroke-width");
+      }
+    };
+
     const circle = document.createElementNS(svgNS, "circle");
     circle.setAttribute("cx", coord.x.toString());
     circle.setAttribute("cy", coord.y.toString());
-    circle.setAttribute("r", "1.2");
-    circle.setAttribute("fill", "#ffb341");
+    pointStyle();
     circle.style.cursor = "pointer";
 
     // Add hover events for tooltip
-    const row = drawRows[index];
-    const value = values[index];
-    const date = new Date(row.timestamp);
 
     circle.addEventListener("mouseenter", (e) => {
       const svgRect = svg.getBoundingClientRect();
@@ -792,7 +1305,7 @@ function renderLineChart(
 
       tooltip.innerHTML = `
         <div style="font-weight: 600; margin-bottom: 2px;">${metricInfo.name}</div>
-        <div>${formatNumber(value, 2)} ${metricInfo.unit}</div>
+        <div>${failure ? `Phase failed: ${failure}` : `${formatNumber(value, 2)} ${metricInfo.unit}`}</div>
         <div style="color: var(--muted, #B0B0B0); font-size: 10px; margin-top: 2px;">${formatDateTime(date)}</div>
       `;
       tooltip.style.display = "block";
@@ -809,10 +1322,7 @@ function renderLineChart(
 
     circle.addEventListener("mouseleave", () => {
       // Restore original circle size
-      circle.setAttribute("r", "1.2");
-      circle.setAttribute("fill", "#ffb341");
-      circle.removeAttribute("stroke");
-      circle.removeAttribute("stroke-width");
+      pointStyle();
       tooltip.style.display = "none";
     });
 
@@ -1543,9 +2053,12 @@ async function updateCombinedChart(): Promise<void> {
 /* ---------- SCHEDULES ---------- */
 
 let editingScheduleId: string | null = null;
+let editingScheduleAlerts: ScheduleAlerts | undefined;
 
 async function loadSchedules(): Promise<void> {
-  const scheds = await fetchJSON<Schedule[]>("/api/schedules");
+  const scheds =
+    bootstrap.schedules ?? (await fetchJSON<Schedule[]>("/api/schedules"));
+  bootstrap.schedules = undefined;
   const list = $("schedules-list");
   list.innerHTML = "";
 
@@ -1571,9 +2084,17 @@ async function loadSchedules(): Promise<void> {
 
     const detailsEl = document.createElement("div");
     detailsEl.className = "schedule-details";
-    const typeText = s.type === "interval" ? `Every ${s.every}` : `Daily at ${s.time_of_day}`;
+    const typeText =
+      s.type === "interval"
+        ? `Every ${s.every}`
+        : s.type === "cron"
+          ? `Cron ${s.cron}`
+          : `Daily at ${s.time_of_day}`;
     const statusText = s.enabled ? "Enabled" : "Disabled";
     detailsEl.textContent = `${typeText} • ${statusText}`;
+    if (s.alerts?.silent) {
+      detailsEl.textContent += " • Silent";
+    }
 
     scheduleInfo.appendChild(nameEl);
     scheduleInfo.appendChild(detailsEl);
@@ -1606,11 +2127,15 @@ async function loadSchedules(): Promise<void> {
     editBtn.title = "Edit";
     editBtn.addEventListener("click", () => {
       editingScheduleId = s.id;
+      editingScheduleAlerts = s.alerts;
       ($("schedule-form-id") as HTMLInputElement).value = s.id;
       ($("schedule-form-name") as HTMLInputElement).value = s.name || "";
       ($("schedule-form-type") as HTMLSelectElement).value = s.type;
       ($("schedule-form-every") as HTMLInputElement).value = s.every || "";
       ($("schedule-form-timeOfDay") as HTMLInputElement).value = s.time_of_day || "";
+      ($("schedule-form-cron") as HTMLInputElement).value = s.cron || "";
+      ($("schedule-form-connection") as HTMLInputElement).value = s.connection || "";
+      ($("schedule-form-engines") as HTMLInputElement).value = (s.engines || []).join(", ");
       ($("schedule-form-enabled") as HTMLInputElement).checked = s.enabled;
       ($("schedule-form-submit") as HTMLButtonElement).textContent = "Update";
       toggleScheduleFields(s.type);
@@ -1650,6 +2175,461 @@ async function loadSchedules(): Promise<void> {
   }
 }
 
+/* ---------- ALERTS ---------- */
+
+let editingAlertRule: AlertRule | null = null;
+
+// isSet reports whether a timestamp from the alert engine is set; unset ones
+// come as Go's zero time.
+function isSet(ts?: string): ts is string {
+  return !!ts && !ts.startsWith("0001-");
+}
+
+async function loadAlertRules(): Promise<void> {
+  const [rules, states] = await Promise.all([
+    fetchJSON<AlertRule[]>("/api/alerts/rules"),
+    fetchJSON<AlertState[]>("/api/alerts"),
+  ]);
+  const stateOf = new Map(states.map((st) => [st.rule.id, st]));
+  const list = $("alert-rules-list");
+  list.innerHTML = "";
+
+  if (!rules.length) {
+    list.textContent = "No alert rules configured yet.";
+    return;
+  }
+
+  for (const rule of rules) {
+    const card = document.createElement("div");
+    card.className = "schedule-card";
+
+    const info = document.createElement("div");
+    info.className = "schedule-info";
+    const nameEl = document.createElement("div");
+    nameEl.className = "schedule-name";
+    nameEl.textContent = rule.name;
+    const detailsEl = document.createElement("div");
+    detailsEl.className = "schedule-details";
+    const when = rule.operator === "<" ? "below" : "above";
+    detailsEl.textContent = `${rule.metric} ${when} ${rule.threshold} • ${rule.severity || "warning"} • ${rule.enabled ? "Enabled" : "Disabled"}`;
+    const st = stateOf.get(rule.id);
+    const degraded = st?.state === "degraded";
+    if (st && degraded) {
+      detailsEl.textContent += ` • Degraded since ${new Date(st.since).toLocaleString()}`;
+      if (isSet(st.acknowledged)) detailsEl.textContent += " (acknowledged)";
+    }
+    const snoozedUntil = isSet(st?.snoozed_until) ? new Date(st!.snoozed_until!) : null;
+    const snoozed = snoozedUntil !== null && snoozedUntil.getTime() > Date.now();
+    if (snoozed) {
+      detailsEl.textContent += ` • Snoozed until ${snoozedUntil.toLocaleString()}`;
+    }
+    info.appendChild(nameEl);
+    info.appendChild(detailsEl);
+
+    const actions = document.createElement("div");
+    actions.className = "schedule-actions";
+
+    const ruleAction = async (action: string, init: RequestInit) => {
+      try {
+        await fetchJSON(`/api/alerts/${encodeURIComponent(rule.id)}/${action}`, init);
+        await Promise.all([loadAlertRules(), loadAlertHistory()]);
+      } catch (err) {
+        console.error(`alert ${action} failed`, err);
+      }
+    };
+    if (st && degraded && !isSet(st.acknowledged)) {
+      const ackBtn = document.createElement("button");
+      ackBtn.className = "btn";
+      ackBtn.textContent = "Acknowledge";
+      ackBtn.addEventListener("click", () => ruleAction("ack", { method: "POST" }));
+      actions.appendChild(ackBtn);
+    }
+    const snoozeBtn = document.createElement("button");
+    snoozeBtn.className = "btn";
+    snoozeBtn.textContent = snoozed ? "Unsnooze" : "Snooze";
+    snoozeBtn.addEventListener("click", () => {
+      if (snoozed) {
+        ruleAction("snooze", { method: "DELETE" });
+        return;
+      }
+      const duration = prompt(`Snooze "${rule.name}" for (e.g. 30m, 4h, 24h):`, "4h");
+      if (!duration) return;
+      ruleAction("snooze", { method: "POST", body: JSON.stringify({ duration }) });
+    });
+    actions.appendChild(snoozeBtn);
+
+    const toggleBtn = document.createElement("button");
+    toggleBtn.className = "schedule-btn schedule-btn-toggle";
+    toggleBtn.innerHTML = rule.enabled ? "✓" : "○";
+    toggleBtn.title = rule.enabled ? "Disable" : "Enable";
+    toggleBtn.addEventListener("click", async () => {
+      try {
+        await fetchJSON(`/api/alerts/rules/${encodeURIComponent(rule.id)}`, {
+          method: "PUT",
+          body: JSON.stringify({ ...rule, enabled: !rule.enabled }),
+        });
+        await loadAlertRules();
+      } catch (err) {
+        console.error("toggle alert rule failed", err);
+      }
+    });
+
+    const editBtn = document.createElement("button");
+    editBtn.className = "schedule-btn schedule-btn-edit";
+    editBtn.innerHTML = "✎";
+    editBtn.title = "Edit";
+    editBtn.addEventListener("click", () => {
+      editingAlertRule = rule;
+      ($("alert-rule-form-name") as HTMLInputElement).value = rule.name;
+      ($("alert-rule-form-metric") as HTMLSelectElement).value = rule.metric;
+      ($("alert-rule-form-operator") as HTMLSelectElement).value = rule.operator;
+      ($("alert-rule-form-threshold") as HTMLInputElement).value = String(rule.threshold);
+      ($("alert-rule-form-for") as HTMLInputElement).value = rule.for ? String(rule.for) : "";
+      ($("alert-rule-form-severity") as HTMLSelectElement).value = rule.severity || "warning";
+      ($("alert-rule-form-enabled") as HTMLInputElement).checked = rule.enabled;
+      ($("alert-rule-form-submit") as HTMLButtonElement).textContent = "Update";
+      ($("alert-rule-form-cancel") as HTMLButtonElement).style.display = "inline-block";
+      document.getElementById("alert-rule-form")?.scrollIntoView({ behavior: "smooth", block: "nearest" });
+    });
+
+    const deleteBtn = document.createElement("button");
+    deleteBtn.className = "schedule-btn schedule-btn-delete";
+    deleteBtn.innerHTML = "🗑";
+    deleteBtn.title = "Delete";
+    deleteBtn.addEventListener("click", async () => {
+      if (!confirm(`Delete alert rule "${rule.name}"?`)) return;
+      try {
+        // 204 No Content, so not through fetchJSON
+        const res = await fetch(`/api/alerts/rules/${encodeURIComponent(rule.id)}`, { method: "DELETE" });
+        if (!res.ok) throw new Error(`${res.status} ${res.statusText}`);
+        await loadAlertRules();
+      } catch (err) {
+        console.error("delete alert rule failed", err);
+        alert("Failed to delete alert rule. Please refresh the page.");
+      }
+    });
+
+    actions.appendChild(toggleBtn);
+    actions.appendChild(editBtn);
+    actions.appendChild(deleteBtn);
+    card.appendChild(info);
+    card.appendChild(actions);
+    list.appendChild(card);
+  }
+}
+
+function setupAlertRuleForm(): void {
+  const form = document.getElementById("alert-rule-form") as HTMLFormElement | null;
+  if (!form) return;
+
+  const cancelBtn = $("alert-rule-form-cancel") as HTMLButtonElement;
+  const resetForm = () => {
+    editingAlertRule = null;
+    form.reset();
+    ($("alert-rule-form-submit") as HTMLButtonElement).textContent = "Add";
+    cancelBtn.style.display = "none";
+  };
+  cancelBtn.addEventListener("click", resetForm);
+
+  form.addEventListener("submit", async (ev) => {
+    ev.preventDefault();
+
+    const data = new FormData(form);
+    // Fields the form doesn't show are kept from the rule being edited
+    const payload: AlertRule = {
+      ...(editingAlertRule ?? { id: "" }),
+      name: String(data.get("name") || ""),
+      metric: String(data.get("metric")),
+      operator: data.get("operator") === ">" ? ">" : "<",
+      threshold: Number(data.get("threshold")),
+      for: Number(data.get("for")) || undefined,
+      severity: String(data.get("severity") || ""),
+      enabled: data.get("enabled") === "on",
+    };
+
+    try {
+      if (editingAlertRule) {
+        await fetchJSON(`/api/alerts/rules/${encodeURIComponent(editingAlertRule.id)}`, {
+          method: "PUT",
+          body: JSON.stringify(payload),
+        });
+      } else {
+        await fetchJSON("/api/alerts/rules", {
+          method: "POST",
+          body: JSON.stringify(payload),
+        });
+      }
+      resetForm();
+      await loadAlertRules();
+    } catch (err) {
+      console.error("save alert rule failed", err);
+      alert(`Failed to save alert rule: ${err instanceof Error ? err.message : String(err)}`);
+    }
+  });
+}
+
+async function loadAlertHistory(): Promise<void> {
+  const events = await fetchJSON<AlertRecord[]>("/api/alerts/history?limit=50");
+  const list = $("alert-history-list");
+  list.innerHTML = "";
+
+  if (!events.length) {
+    list.textContent = "No alerts in the last 30 days.";
+    return;
+  }
+
+  for (const ev of events) {
+    const card = document.createElement("div");
+    card.className = "schedule-card";
+
+    const info = document.createElement("div");
+    info.className = "schedule-info";
+    const nameEl = document.createElement("div");
+    nameEl.className = "schedule-name";
+    nameEl.textContent = `[${ev.kind}] ${ev.rule_name}`;
+    const detailsEl = document.createElement("div");
+    detailsEl.className = "schedule-details";
+    detailsEl.textContent = `${new Date(ev.time).toLocaleString()} • ${ev.metric} ${ev.value.toFixed(2)} (${ev.operator} ${ev.threshold}) • ${ev.severity}`;
+    if (ev.acknowledged_at) {
+      detailsEl.textContent += ` • Acknowledged ${new Date(ev.acknowledged_at).toLocaleString()}`;
+    }
+    if (ev.snoozed) {
+      detailsEl.textContent += " • Snoozed, not sent";
+    }
+    info.appendChild(nameEl);
+    info.appendChild(detailsEl);
+    card.appendChild(info);
+
+    if (!ev.acknowledged_at && ev.kind !== "recovered") {
+      const actions = document.createElement("div");
+      actions.className = "schedule-actions";
+      const ackBtn = document.createElement("button");
+      ackBtn.className = "btn";
+      ackBtn.textContent = "Acknowledge";
+      ackBtn.addEventListener("click", async () => {
+        try {
+          await fetchJSON(`/api/alerts/history/${ev.id}/ack`, { method: "POST" });
+          await loadAlertHistory();
+        } catch (err) {
+          console.error("acknowledge alert failed", err);
+        }
+      });
+      actions.appendChild(ackBtn);
+      card.appendChild(actions);
+    }
+    list.appendChild(card);
+  }
+}
+
+/* ---------- CSV IMPORT ---------- */
+
+type CsvImportResponse = {
+  columns: string[];
+  rows: number;
+  preview?: SpeedtestResult[];
+  error?: string;
+  saved: number;
+};
+
+// Fields the import wizard maps, with the units each offers (the first is
+// the default) and words that suggest a column holds it.
+const CSV_IMPORT_FIELDS: { field: string; label: string; units?: string[]; hints: string[] }[] = [
+  { field: "timestamp", label: "Time", hints: ["time", "date"] },
+  { field: "download_mbps", label: "Download", units: ["Mbps", "kbps", "bps", "Gbps", "MB/s", "kB/s", "B/s"], hints: ["down"] },
+  { field: "upload_mbps", label: "Upload", units: ["Mbps", "kbps", "bps", "Gbps", "MB/s", "kB/s", "B/s"], hints: ["up"] },
+  { field: "ping_ms", label: "Ping", units: ["ms", "s", "us"], hints: ["ping", "latency"] },
+  { field: "jitter_ms", label: "Jitter", units: ["ms", "s", "us"], hints: ["jitter"] },
+  { field: "packet_loss_pct", label: "Packet loss (%)", hints: ["loss"] },
+  { field: "isp", label: "ISP", hints: ["isp", "provider"] },
+  { field: "external_ip", label: "External IP", hints: ["ip"] },
+  { field: "server_name", label: "Server", hints: ["server"] },
+  { field: "id", label: "ID", hints: [] },
+];
+
+let csvImportText = "";
+
+function setupCsvImport(): void {
+  const fileInput = document.getElementById("csv-import-file") as HTMLInputElement | null;
+  if (!fileInput) return;
+  const previewBtn = $("csv-import-preview") as HTMLButtonElement;
+  const runBtn = $("csv-import-run") as HTMLButtonElement;
+  const status = $("csv-import-status");
+
+  const load = async () => {
+    const file = fileInput.files?.[0];
+    if (!file) return;
+    csvImportText = await file.text();
+    $("csv-import-result").innerHTML = "";
+    try {
+      const resp = await postCsvImport(true);
+      renderCsvImportMapping(resp.columns);
+      status.textContent = `${resp.rows} rows, ${resp.columns.length} columns. Check the mapping, then preview.`;
+      previewBtn.disabled = false;
+      runBtn.disabled = true;
+    } catch (err) {
+      status.textContent = `Failed to read file: ${err instanceof Error ? err.message : String(err)}`;
+    }
+  };
+  fileInput.addEventListener("change", load);
+  $("csv-import-delimiter").addEventListener("change", load);
+
+  previewBtn.addEventListener("click", async () => {
+    try {
+      const resp = await postCsvImport(true);
+      renderCsvImportPreview(resp);
+      runBtn.disabled = !!resp.error || resp.rows === 0;
+      status.textContent = resp.error ? `Not importable: ${resp.error}` : `All ${resp.rows} rows map. The first are shown below.`;
+    } catch (err) {
+      status.textContent = `Preview failed: ${err instanceof Error ? err.message : String(err)}`;
+    }
+  });
+
+  runBtn.addEventListener("click", async () => {
+    runBtn.disabled = true;
+    try {
+      const resp = await postCsvImport(false);
+      status.textContent = `Imported ${resp.saved} rows; rows already stored were skipped.`;
+      $("csv-import-result").innerHTML = "";
+      await refreshDashboard();
+    } catch (err) {
+      status.textContent = `Import failed: ${err instanceof Error ? err.message : String(err)}`;
+      runBtn.disabled = false;
+    }
+  });
+}
+
+// renderCsvImportMapping lists the fields with a column, unit and format
+// picker each, preselecting columns whose names suggest the field.
+function renderCsvImportMapping(columns: string[]): void {
+  const container = $("csv-import-mapping");
+  container.innerHTML = "";
+  const used = new Set<string>();
+
+  for (const f of CSV_IMPORT_FIELDS) {
+    const row = document.createElement("div");
+    row.className = "form-row form-row-inline";
+    row.dataset.field = f.field;
+
+    const field = document.createElement("div");
+    field.className = "form-field";
+    const label = document.createElement("label");
+    label.textContent = f.label;
+    const column = document.createElement("select");
+    column.className = "csv-import-column";
+    column.add(new Option("Not mapped", ""));
+    for (const c of columns) column.add(new Option(c, c));
+    const guess = columns.find(
+      (c) => !used.has(c) && (c === f.field || f.hints.some((h) => c.toLowerCase().includes(h))),
+    );
+    if (guess) {
+      column.value = guess;
+      used.add(guess);
+    }
+    field.appendChild(label);
+    field.appendChild(column);
+    row.appendChild(field);
+
+    if (f.units) {
+      const unitField = document.createElement("div");
+      unitField.className = "form-field";
+      const unitLabel = document.createElement("label");
+      unitLabel.textContent = "Unit";
+      const unit = document.createElement("select");
+      unit.className = "csv-import-unit";
+      for (const u of f.units) unit.add(new Option(u, u));
+      unitField.appendChild(unitLabel);
+      unitField.appendChild(unit);
+      row.appendChild(unitField);
+    }
+    if (f.field === "timestamp") {
+      const formatField = document.createElement("div");
+      formatField.className = "form-field";
+      const formatLabel = document.createElement("label");
+      formatLabel.textContent = "Format";
+      const format = document.createElement("input");
+      format.type = "text";
+      format.className = "csv-import-format";
+      format.placeholder = "RFC 3339 or Unix seconds";
+      formatField.appendChild(formatLabel);
+      formatField.appendChild(format);
+      row.appendChild(formatField);
+    }
+    container.appendChild(row);
+  }
+}
+
+// csvImportFields reads the mapping from the wizard. Fields left unmapped
+// are left out, so the server reads them from a column of the same name, if
+// there is one.
+function csvImportFields(): Record<string, { path: string; unit?: string; format?: string }> {
+  const fields: Record<string, { path: string; unit?: string; format?: string }> = {};
+  $("csv-import-mapping")
+    .querySelectorAll<HTMLElement>("[data-field]")
+    .forEach((row) => {
+      const path = row.querySelector<HTMLSelectElement>(".csv-import-column")?.value;
+      if (!path) return;
+      const unit = row.querySelector<HTMLSelectElement>(".csv-import-unit")?.value;
+      const format = row.querySelector<HTMLInputElement>(".csv-import-format")?.value.trim();
+      fields[row.dataset.field!] = { path, unit: unit || undefined, format: format || undefined };
+    });
+  return fields;
+}
+
+async function postCsvImport(dryRun: boolean): Promise<CsvImportResponse> {
+  const tags = ($("csv-import-tags") as HTMLInputElement).value
+    .split(",")
+    .map((t) => t.trim())
+    .filter((t) => t);
+  const res = await fetch("/api/import/csv", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({
+      csv: csvImportText,
+      delimiter: ($("csv-import-delimiter") as HTMLSelectElement).value,
+      fields: csvImportFields(),
+      connection: ($("csv-import-connection") as HTMLInputElement).value.trim(),
+      tags,
+      dry_run: dryRun,
+    }),
+  });
+  if (!res.ok) {
+    // The server's message says which row or setting is wrong
+    throw new Error((await res.text()).trim());
+  }
+  return (await res.json()) as CsvImportResponse;
+}
+
+function renderCsvImportPreview(resp: CsvImportResponse): void {
+  const container = $("csv-import-result");
+  container.innerHTML = "";
+  if (!resp.preview?.length) return;
+
+  const table = document.createElement("table");
+  table.className = "table";
+  table.style.width = "100%";
+  const head = table.createTHead().insertRow();
+  for (const h of ["Time", "Download", "Upload", "Ping", "Jitter", "Loss", "Server"]) {
+    const th = document.createElement("th");
+    th.textContent = h;
+    head.appendChild(th);
+  }
+  const body = table.createTBody();
+  for (const r of resp.preview) {
+    const row = body.insertRow();
+    const cells = [
+      new Date(r.timestamp).toLocaleString(),
+      r.download_mbps.toFixed(2),
+      r.upload_mbps.toFixed(2),
+      r.ping_ms.toFixed(1),
+      r.jitter_ms !== undefined ? r.jitter_ms.toFixed(1) : "",
+      r.packet_loss_pct !== undefined ? r.packet_loss_pct.toFixed(1) : "",
+      r.server_name || "",
+    ];
+    for (const c of cells) row.insertCell().textContent = c;
+  }
+  container.appendChild(table);
+}
+
 /* ---------- NAV ---------- */
 
 let sidebarManuallyToggled = false;
@@ -1792,16 +2772,35 @@ function setupNav(): void {
         scheduleAutoCollapse();
       }
 
-      buttons.forEach((b) => b.classList.remove("nav-item-active"));
-      btn.classList.add("nav-item-active");
-
-      document
-        .querySelectorAll<HTMLElement>(".view")
-        .forEach((v) => v.classList.remove("view-active"));
-      const el = document.getElementById(`view-${view}`);
-      if (el) el.classList.add("view-active");
+      showView(view);
+      if (view !== viewFromPath()) {
+        history.pushState(null, "", view === "dashboard" ? "./" : view);
+      }
     });
   });
+
+  showView(viewFromPath());
+  window.addEventListener("popstate", () => showView(viewFromPath()));
+}
+
+// Views other than the dashboard have a path of their own (/history,
+// /preferences, /about), which the server answers with the index page, so
+// they can be bookmarked and reloaded.
+function viewFromPath(): string {
+  const name = location.pathname.split("/").pop();
+  return name && document.getElementById(`view-${name}`) ? name : "dashboard";
+}
+
+function showView(view: string): void {
+  document
+    .querySelectorAll<HTMLButtonElement>(".nav-item")
+    .forEach((b) => b.classList.toggle("nav-item-active", b.dataset.view === view));
+
+  document
+    .querySelectorAll<HTMLElement>(".view")
+    .forEach((v) => v.classList.remove("view-active"));
+  const el = document.getElementById(`view-${view}`);
+  if (el) el.classList.add("view-active");
 }
 
 function scheduleAutoCollapse(): void {
@@ -1830,91 +2829,220 @@ function scheduleAutoCollapse(): void {
 
 /* ---------- RUN NOW ---------- */
 
+// Overrides for a single manual run, see POST /api/run.
+type RunOptions = {
+  engine?: string;
+  server_id?: string;
+  phases?: string[];
+  tags?: string[];
+  save?: boolean;
+};
+
 function setupRunNow(): void {
   const btn = document.getElementById("run-now-btn") as HTMLButtonElement | null;
   if (!btn) return;
 
-  btn.addEventListener("click", async () => {
-    btn.disabled = true;
-    btn.textContent = "Starting...";
-
-    // Show progress modal
-    const modal = showProgressModal();
-    const statusEl = modal.querySelector(".progress-status") as HTMLElement;
-    const messageEl = modal.querySelector(".progress-message") as HTMLElement;
+  btn.addEventListener("click", () => runNow(btn));
 
+  const advancedBtn = document.getElementById("advanced-run-btn") as HTMLButtonElement | null;
+  advancedBtn?.addEventListener("click", async () => {
+    const options = await showAdvancedRunModal();
+    if (!options) return;
+    advancedBtn.disabled = true;
     try {
-      const detailsEl = modal.querySelector(".progress-details") as HTMLElement;
-      const userInfoEl = modal.querySelector("#progress-user-info") as HTMLElement;
-      const serverInfoEl = modal.querySelector("#progress-server-info") as HTMLElement;
-      const pingInfoEl = modal.querySelector("#progress-ping-info") as HTMLElement;
-      const downloadInfoEl = modal.querySelector("#progress-download-info") as HTMLElement;
-      const uploadInfoEl = modal.querySelector("#progress-upload-info") as HTMLElement;
-
-      const result = await runSpeedtestWithProgress((stage: string, message: string) => {
-        if (statusEl) statusEl.textContent = stage;
-        if (messageEl) messageEl.textContent = message;
-        btn.textContent = message;
-
-        // Show details based on stage
-        if (stage === "user" && message.includes("Connected from")) {
-          const match = message.match(/Connected from (.+?) \((.+?)\)/);
-          if (match) {
-            userInfoEl.innerHTML = `<strong>IP:</strong> ${match[1]} | <strong>ISP:</strong> ${match[2]}`;
-            userInfoEl.style.display = "block";
-          }
-        } else if (stage === "servers" && message.includes("Selected server")) {
-          const match = message.match(/Selected server: (.+?)$/);
-          if (match) {
-            serverInfoEl.innerHTML = `<strong>Server:</strong> ${match[1]}`;
-            serverInfoEl.style.display = "block";
-          }
-        } else if (stage === "ping" && message.includes("Ping:")) {
-          const match = message.match(/Ping: (.+?) ms, Jitter: (.+?) ms/);
-          if (match) {
-            pingInfoEl.innerHTML = `<strong>Ping:</strong> ${match[1]} ms | <strong>Jitter:</strong> ${match[2]} ms`;
-            pingInfoEl.style.display = "block";
-          }
-        } else if (stage === "download" && message.includes("Download:")) {
-          const match = message.match(/Download: (.+?) Mbps/);
-          if (match) {
-            downloadInfoEl.innerHTML = `<strong>Download Speed:</strong> <span style="color: #4a9eff; font-weight: bold;">${match[1]} Mbps</span>`;
-            downloadInfoEl.style.display = "block";
-          }
-        } else if (stage === "upload" && message.includes("Upload:")) {
-          const match = message.match(/Upload: (.+?) Mbps/);
-          if (match) {
-            uploadInfoEl.innerHTML = `<strong>Upload Speed:</strong> <span style="color: #4a9eff; font-weight: bold;">${match[1]} Mbps</span>`;
-            uploadInfoEl.style.display = "block";
-          }
-        }
-      });
+      await runNow(btn, options);
+    } finally {
+      advancedBtn.disabled = false;
+    }
+  });
+}
 
-      // Close progress modal
-      closeProgressModal(modal);
-
-      // Show results modal
-      const saved = await showResultsModal(result);
-
-      // Refresh data if result was saved
-      if (saved) {
-        await Promise.all([
-          loadSummary(),
-          loadHistoryTable(),
-          updateDownloadChart(),
-          updateUploadChart(),
-          updateLatencyChart(),
-          updateJitterChart(),
-        ]);
+async function runNow(btn: HTMLButtonElement, options?: RunOptions): Promise<void> {
+  btn.disabled = true;
+  btn.textContent = "Starting...";
+
+  // Show progress modal
+  const modal = showProgressModal();
+  const statusEl = modal.querySelector(".progress-status") as HTMLElement;
+  const messageEl = modal.querySelector(".progress-message") as HTMLElement;
+
+  try {
+    const detailsEl = modal.querySelector(".progress-details") as HTMLElement;
+    const userInfoEl = modal.querySelector("#progress-user-info") as HTMLElement;
+    const serverInfoEl = modal.querySelector("#progress-server-info") as HTMLElement;
+    const pingInfoEl = modal.querySelector("#progress-ping-info") as HTMLElement;
+    const downloadInfoEl = modal.querySelector("#progress-download-info") as HTMLElement;
+    const uploadInfoEl = modal.querySelector("#progress-upload-info") as HTMLElement;
+
+    const { result, saved: autoSaved } = await runSpeedtestWithProgress(options, (stage: string, message: string) => {
+      if (statusEl) statusEl.textContent = stage;
+      if (messageEl) messageEl.textContent = message;
+      btn.textContent = message;
+
+      // Show details based on stage
+      if (stage === "user" && message.includes("Connected from")) {
+        const match = message.match(/Connected from (.+?) \((.+?)\)/);
+        if (match) {
+          userInfoEl.innerHTML = `<strong>IP:</strong> ${match[1]} | <strong>ISP:</strong> ${match[2]}`;
+          userInfoEl.style.display = "block";
+        }
+      } else if (stage === "servers" && message.includes("Selected server")) {
+        const match = message.match(/Selected server: (.+?)$/);
+        if (match) {
+          serverInfoEl.innerHTML = `<strong>Server:</strong> ${match[1]}`;
+          serverInfoEl.style.display = "block";
+        }
+      } else if (stage === "ping" && message.includes("Ping:")) {
+        const match = message.match(/Ping: (.+?) ms, Jitter: (.+?) ms/);
+        if (match) {
+          pingInfoEl.innerHTML = `<strong>Ping:</strong> ${match[1]} ms | <strong>Jitter:</strong> ${match[2]} ms`;
+          pingInfoEl.style.display = "block";
+        }
+      } else if (stage === "download" && message.includes("Download:")) {
+        const match = message.match(/Download: (.+?) Mbps/);
+        if (match) {
+          downloadInfoEl.innerHTML = `<strong>Download Speed:</strong> <span style="color: #4a9eff; font-weight: bold;">${match[1]} Mbps</span>`;
+          downloadInfoEl.style.display = "block";
+        }
+      } else if (stage === "upload" && message.includes("Upload:")) {
+        const match = message.match(/Upload: (.+?) Mbps/);
+        if (match) {
+          uploadInfoEl.innerHTML = `<strong>Upload Speed:</strong> <span style="color: #4a9eff; font-weight: bold;">${match[1]} Mbps</span>`;
+          uploadInfoEl.style.display = "block";
+        }
       }
-    } catch (err) {
-      console.error("run-now failed", err);
-      closeProgressModal(modal);
-      alert("Speedtest failed: " + (err instanceof Error ? err.message : String(err)));
-    } finally {
-      btn.disabled = false;
-      btn.textContent = "Run speedtest now";
+    });
+
+    // Close progress modal
+    closeProgressModal(modal);
+
+    // Show results modal; runs that skipped phases can't be saved
+    const partial = !!options?.phases && options.phases.length < 3;
+    const saved = await showResultsModal(result, autoSaved, partial);
+
+    // Refresh data if result was saved, otherwise list it with the
+    // other unsaved runs
+    if (saved) {
+      await Promise.all([
+        loadSummary(),
+        loadHistoryTable(),
+        loadManualResults(),
+        updateDownloadChart(),
+        updateUploadChart(),
+        updateLatencyChart(),
+        updateJitterChart(),
+      ]);
+    } else {
+      await loadManualResults();
     }
+  } catch (err) {
+    console.error("run-now failed", err);
+    closeProgressModal(modal);
+    alert("Speedtest failed: " + (err instanceof Error ? err.message : String(err)));
+  } finally {
+    btn.disabled = false;
+    btn.textContent = "Run speedtest now";
+  }
+}
+
+// showAdvancedRunModal asks for the overrides of an advanced test. It
+// resolves to them, or to null if cancelled.
+function showAdvancedRunModal(): Promise<RunOptions | null> {
+  return new Promise((resolve) => {
+    const modal = document.createElement("div");
+    modal.className = "progress-modal-overlay";
+    const label = "font-size: 12px; color: #888; margin-bottom: 4px;";
+    modal.innerHTML = `
+      <div class="progress-modal" style="max-width: 480px;">
+        <div class="progress-header">
+          <h3>Advanced Test</h3>
+        </div>
+        <form id="advanced-run-form" class="progress-content" style="padding: 20px; display: grid; gap: 16px;">
+          <label>
+            <div style="${label}">Engine</div>
+            <select name="engine" class="select">
+              <option value="">Default</option>
+              <option value="ookla">ookla</option>
+              <option value="cloudflare">cloudflare</option>
+            </select>
+          </label>
+          <label>
+            <div style="${label}">Server ID (ookla only, blank for the closest)</div>
+            <input type="text" name="server_id" inputmode="numeric" pattern="[0-9]*" />
+          </label>
+          <div>
+            <div style="${label}">Phases</div>
+            <label><input type="checkbox" name="phase" value="ping" checked /> Ping</label>
+            <label style="margin-left: 12px;"><input type="checkbox" name="phase" value="download" checked /> Download</label>
+            <label style="margin-left: 12px;"><input type="checkbox" name="phase" value="upload" checked /> Upload</label>
+          </div>
+          <label>
+            <div style="${label}">Tags (comma separated)</div>
+            <input type="text" name="tags" />
+          </label>
+          <label>
+            <div style="${label}">Save result</div>
+            <select name="save" class="select">
+              <option value="">As in preferences</option>
+              <option value="true">Save</option>
+              <option value="false">Don't save</option>
+            </select>
+          </label>
+          <div id="advanced-run-error" style="color: #ff6b6b; font-size: 12px; display: none;"></div>
+          <div style="display: flex; gap: 12px; justify-content: flex-end; padding-top: 16px; border-top: 1px solid #333;">
+            <button type="button" id="advanced-run-cancel" style="padding: 8px 16px; cursor: pointer;">Cancel</button>
+            <button type="submit" style="padding: 8px 16px; cursor: pointer; background: #4a9eff; color: white; border: none;">Run</button>
+          </div>
+        </form>
+      </div>
+    `;
+    document.body.appendChild(modal);
+
+    const form = modal.querySelector("#advanced-run-form") as HTMLFormElement;
+    const errorEl = modal.querySelector("#advanced-run-error") as HTMLElement;
+
+    const close = (options: RunOptions | null) => {
+      document.removeEventListener("keydown", escHandler);
+      if (modal.parentNode) {
+        modal.parentNode.removeChild(modal);
+      }
+      resolve(options);
+    };
+    const escHandler = (e: KeyboardEvent) => {
+      if (e.key === "Escape") {
+        e.preventDefault();
+        close(null);
+      }
+    };
+    document.addEventListener("keydown", escHandler);
+    (modal.querySelector("#advanced-run-cancel") as HTMLButtonElement).addEventListener("click", () => close(null));
+
+    form.addEventListener("submit", (e) => {
+      e.preventDefault();
+      const data = new FormData(form);
+      const options: RunOptions = {};
+      const engine = String(data.get("engine") || "");
+      if (engine) options.engine = engine;
+      const serverID = String(data.get("server_id") || "").trim();
+      if (serverID) options.server_id = serverID;
+      const phases = data.getAll("phase").map(String);
+      if (phases.length === 0) {
+        errorEl.textContent = "Select at least one phase.";
+        errorEl.style.display = "block";
+        return;
+      }
+      if (phases.length < 3) options.phases = phases;
+      const tags = String(data.get("tags") || "").split(",").map((t) => t.trim()).filter((t) => t);
+      if (tags.length > 0) options.tags = tags;
+      const save = String(data.get("save") || "");
+      if (save) options.save = save === "true";
+      if (options.save && options.phases) {
+        errorEl.textContent = "Tests that skip phases can't be saved.";
+        errorEl.style.display = "block";
+        return;
+      }
+      close(options);
+    });
   });
 }
 
@@ -1950,14 +3078,17 @@ function closeProgressModal(modal: HTMLElement): void {
   }
 }
 
-function showResultsModal(result: SpeedtestResult): Promise<boolean> {
+// showResultsModal shows a manual run's result, offering to save it unless
+// it already was or skipped phases. It resolves to whether the result is
+// saved.
+function showResultsModal(result: SpeedtestResult, saved: boolean, partial = false): Promise<boolean> {
   return new Promise((resolve) => {
     const modal = document.createElement("div");
     modal.className = "progress-modal-overlay";
 
-    const serverInfo = result.server_name
+    const serverInfo = (result.server_name
       ? `${result.server_name}${result.server_country ? ` (${result.server_country})` : ""}${result.server_id ? ` [${result.server_id}]` : ""}`
-      : result.server_id || "–";
+      : result.server_id || "–") + (result.engine ? `, ${result.engine}` : "");
 
     modal.innerHTML = `
       <div class="progress-modal" style="max-width: 600px;">
@@ -2012,6 +3143,40 @@ function showResultsModal(result: SpeedtestResult): Promise<boolean> {
               <span style="font-size: 12px; color: #888;">Server:</span>
               <span style="margin-left: 8px;">${serverInfo}</span>
             </div>
+            ${result.link ? `
+              <div style="margin-bottom: 8px;">
+                <span style="font-size: 12px; color: #888;">Link:</span>
+                <span style="margin-left: 8px;">${formatLink(result.link)}</span>
+              </div>
+            ` : ""}
+            ${result.lan ? `
+              <div style="margin-bottom: 8px;">
+                <span style="font-size: 12px; color: #888;">Gateway:</span>
+                <span style="margin-left: 8px;">${formatPing(result.lan.gateway)}</span>
+              </div>
+              <div style="margin-bottom: 8px;">
+                <span style="font-size: 12px; color: #888;">DNS:</span>
+                <span style="margin-left: 8px;">${formatPing(result.lan.dns)}</span>
+              </div>
+              ${result.lan.interface ? `
+                <div style="margin-bottom: 8px;">
+                  <span style="font-size: 12px; color: #888;">Interface errors:</span>
+                  <span style="margin-left: 8px;">${result.lan.interface.rx_errors + result.lan.interface.tx_errors} errors, ${result.lan.interface.rx_dropped + result.lan.interface.tx_dropped} dropped</span>
+                </div>
+              ` : ""}
+            ` : ""}
+            ${result.path_mtu ? `
+              <div style="margin-bottom: 8px;">
+                <span style="font-size: 12px; color: #888;">Path MTU:</span>
+                <span style="margin-left: 8px;">${result.path_mtu.mtu ? `${result.path_mtu.mtu} bytes` : result.path_mtu.error || "–"}</span>
+              </div>
+            ` : ""}
+            ${result.timings ? `
+              <div style="margin-bottom: 8px;">
+                <span style="font-size: 12px; color: #888;">Timings:</span>
+                <span style="margin-left: 8px;">${formatTimings(result.timings)}</span>
+              </div>
+            ` : ""}
             <div style="margin-bottom: 8px;">
               <span style="font-size: 12px; color: #888;">ID:</span>
               <span style="margin-left: 8px; font-family: monospace; font-size: 11px;">${result.id}</span>
@@ -2020,7 +3185,7 @@ function showResultsModal(result: SpeedtestResult): Promise<boolean> {
 
           <div style="display: flex; gap: 12px; justify-content: flex-end; margin-top: 24px; padding-top: 16px; border-top: 1px solid #333;">
             <button id="results-modal-ok" style="padding: 8px 16px; cursor: pointer;">OK</button>
-            <button id="results-modal-save" style="padding: 8px 16px; cursor: pointer; background: #4a9eff; color: white; border: none;">Save</button>
+            <button id="results-modal-save" style="padding: 8px 16px; cursor: pointer; background: #4a9eff; color: white; border: none;"${saved || partial ? " disabled" : ""}>${saved ? "Saved" : partial ? "Partial test, not saved" : "Save"}</button>
           </div>
         </div>
       </div>
@@ -2037,7 +3202,7 @@ function showResultsModal(result: SpeedtestResult): Promise<boolean> {
 
     // OK button
     const okBtn = modal.querySelector("#results-modal-ok") as HTMLButtonElement;
-    okBtn.addEventListener("click", () => handleClose(false));
+    okBtn.addEventListener("click", () => handleClose(saved));
 
     // Save button
     const saveBtn = modal.querySelector("#results-modal-save") as HTMLButtonElement;
@@ -2063,7 +3228,7 @@ function showResultsModal(result: SpeedtestResult): Promise<boolean> {
       if (e.key === "Escape") {
         e.preventDefault();
         document.removeEventListener("keydown", escHandler);
-        handleClose(false);
+        handleClose(saved);
       }
     };
     document.addEventListener("keydown", escHandler);
@@ -2073,13 +3238,20 @@ function showResultsModal(result: SpeedtestResult): Promise<boolean> {
 }
 
 async function runSpeedtestWithProgress(
+  options: RunOptions | undefined,
   onProgress: (stage: string, message: string) => void
-): Promise<any> {
+): Promise<{ result: SpeedtestResult; saved: boolean }> {
   return new Promise((resolve, reject) => {
-    fetch("/api/run/stream", { method: "POST" })
-      .then((response) => {
+    fetch("/api/run/stream?" + connectionParam().slice(1), {
+      method: "POST",
+      headers: options ? { "Content-Type": "application/json" } : undefined,
+      body: options ? JSON.stringify(options) : undefined,
+    })
+      .then(async (response) => {
         if (!response.ok) {
-          throw new Error(`HTTP error! status: ${response.status}`);
+          // Rejected options are explained in the body
+          const text = (await response.text()).trim();
+          throw new Error(text || `HTTP error! status: ${response.status}`);
         }
 
         if (!response.body) {
@@ -2101,7 +3273,7 @@ async function runSpeedtestWithProgress(
                     try {
                       const data = JSON.parse(line.slice(6));
                       if (data.type === "completed") {
-                        resolve(data.result);
+                        resolve({ result: data.result, saved: !!data.saved });
                         return;
                       } else if (data.type === "error") {
                         reject(new Error(data.message || "Speedtest failed"));
@@ -2128,7 +3300,7 @@ async function runSpeedtestWithProgress(
                     onProgress(data.stage || "", data.message || "");
                   } else if (data.type === "completed") {
                     reader.cancel();
-                    resolve(data.result);
+                    resolve({ result: data.result, saved: !!data.saved });
                     return;
                   } else if (data.type === "error") {
                     reader.cancel();
@@ -2158,14 +3330,11 @@ async function runSpeedtestWithProgress(
 function toggleScheduleFields(type: string): void {
   const everyField = document.getElementById("schedule-form-every-field");
   const timeOfDayField = document.getElementById("schedule-form-timeOfDay-field");
+  const cronField = document.getElementById("schedule-form-cron-field");
 
-  if (type === "interval") {
-    if (everyField) everyField.style.display = "";
-    if (timeOfDayField) timeOfDayField.style.display = "none";
-  } else if (type === "daily") {
-    if (everyField) everyField.style.display = "none";
-    if (timeOfDayField) timeOfDayField.style.display = "";
-  }
+  if (everyField) everyField.style.display = type === "interval" ? "" : "none";
+  if (timeOfDayField) timeOfDayField.style.display = type === "daily" ? "" : "none";
+  if (cronField) cronField.style.display = type === "cron" ? "" : "none";
 }
 
 function setupScheduleForm(): void {
@@ -2202,6 +3371,10 @@ function setupScheduleForm(): void {
       enabled: data.get("enabled") === "on",
       every: data.get("every") || "",
       time_of_day: data.get("timeOfDay") || "",
+      cron: data.get("cron") || "",
+      connection: data.get("connection") || "",
+      engines: String(data.get("engines") || "").split(",").map((e) => e.trim()).filter((e) => e),
+      alerts: editingScheduleId ? editingScheduleAlerts : undefined,
     };
 
     try {
@@ -2530,42 +3703,59 @@ let intervalDuration: number | null = null; // Full interval duration in millise
 let intervalStartTime: number | null = null; // When the current interval started
 let ws: WebSocket | null = null;
 
+type NextRunResponse = {
+  next_run: string | null;
+  remaining?: number;
+  interval_duration?: number;
+  timestamp?: number;
+  paused_until?: string; // Set during maintenance, see /api/admin/maintenance
+};
+
+let pausedUntil: number | null = null;
+
 async function updateScheduleTimer(): Promise<void> {
   try {
-    const data = await fetchJSON<{
-      next_run: string | null;
-      remaining: number;
-      interval_duration: number;
-      timestamp: number;
-    }>("/api/next-run");
-
-    const timerEl = document.getElementById("schedule-timer");
-    if (!timerEl) return;
-
-    if (!data.next_run) {
-      timerEl.style.display = "none";
-      if (scheduleTimerInterval) {
-        clearInterval(scheduleTimerInterval);
-        scheduleTimerInterval = null;
-      }
-      nextRunTime = null;
-      intervalDuration = null;
-      intervalStartTime = null;
-      return;
-    }
-
-    timerEl.style.display = "block";
-    const nextRun = new Date(data.next_run).getTime();
-    nextRunTime = nextRun;
-    intervalDuration = (data.interval_duration || 0) * 1000; // Convert to milliseconds
-    // Calculate when the current interval started: nextRun - intervalDuration
-    intervalStartTime = nextRun - intervalDuration;
-    updateTimerDisplay();
+    const data =
+      bootstrap.next_run ??
+      (await fetchJSON<NextRunResponse>("/api/next-run"));
+    bootstrap.next_run = undefined;
+    applyNextRun(data);
   } catch (err) {
     console.error("Failed to fetch next run time:", err);
   }
 }
 
+// applyNextRun updates the countdown from /api/next-run or a next-run
+// WebSocket message.
+function applyNextRun(data: NextRunResponse): void {
+  const timerEl = document.getElementById("schedule-timer");
+  if (!timerEl) return;
+
+  if (!data.next_run) {
+    timerEl.style.display = "none";
+    if (scheduleTimerInterval) {
+      clearInterval(scheduleTimerInterval);
+      scheduleTimerInterval = null;
+    }
+    nextRunTime = null;
+    intervalDuration = null;
+    intervalStartTime = null;
+    return;
+  }
+
+  timerEl.style.display = "block";
+  pausedUntil = data.paused_until ? new Date(data.paused_until).getTime() : null;
+  const nextRun = new Date(data.next_run).getTime();
+  nextRunTime = nextRun;
+  intervalDuration = (data.interval_duration || 0) * 1000; // Convert to milliseconds
+  // Calculate when the current interval started: nextRun - intervalDuration
+  intervalStartTime = nextRun - intervalDuration;
+  if (!scheduleTimerInterval) {
+    scheduleTimerInterval = window.setInterval(updateTimerDisplay, 1000);
+  }
+  updateTimerDisplay();
+}
+
 function updateTimerDisplay(): void {
   const timerEl = document.getElementById("schedule-timer");
   if (!timerEl || !nextRunTime || !intervalDuration || !intervalStartTime) return;
@@ -2590,7 +3780,11 @@ function updateTimerDisplay(): void {
 
   const timeStr = parts.join(" ");
 
-  if (remaining > 0) {
+  if (pausedUntil && now < pausedUntil) {
+    timerEl.title = `Paused for maintenance, next speedtest in ${timeStr}`;
+    timerEl.classList.add("paused");
+    timerEl.style.setProperty("--progress-percent", percent + "%");
+  } else if (remaining > 0) {
     timerEl.title = `Next speedtest in ${timeStr}`;
     timerEl.classList.remove("paused");
     timerEl.style.setProperty("--progress-percent", percent + "%");
@@ -2606,13 +3800,57 @@ function startScheduleTimer(): void {
   if (scheduleTimerInterval) {
     clearInterval(scheduleTimerInterval);
   }
-  scheduleTimerInterval = window.setInterval(() => {
-    updateTimerDisplay();
-    // Refresh next run time every 30 seconds
-    if (Date.now() % 30000 < 1000) {
-      updateScheduleTimer();
-    }
-  }, 1000);
+  // The server pushes next-run updates over the WebSocket; this only ticks
+  // the countdown.
+  scheduleTimerInterval = window.setInterval(updateTimerDisplay, 1000);
+}
+
+let scheduledProgressTimer: number | undefined;
+
+// Shows what a scheduled or triggered test is doing in the header; null
+// hides it. Failures stay visible for a few seconds.
+function showScheduledProgress(
+  update: { stage: string; message: string } | null,
+): void {
+  const el = $("scheduled-progress");
+  window.clearTimeout(scheduledProgressTimer);
+  if (!update) {
+    el.style.display = "none";
+    return;
+  }
+  if (update.stage === "error") {
+    el.textContent = "Scheduled test failed: " + update.message;
+    scheduledProgressTimer = window.setTimeout(
+      () => showScheduledProgress(null),
+      5000,
+    );
+  } else {
+    el.textContent = "Scheduled test in progress: " + update.message;
+  }
+  el.style.display = "";
+}
+
+// Points to a newer release in the header, when update checks found one.
+function showUpdateNotice(latest: string, url: string): void {
+  const el = $("update-notice") as HTMLAnchorElement;
+  el.textContent = `speedplane ${latest} is available`;
+  if (url) {
+    el.href = url;
+  } else {
+    el.removeAttribute("href");
+  }
+  el.style.display = "";
+}
+
+async function loadUpdateNotice(): Promise<void> {
+  const v = await fetchJSON<{
+    latest?: string;
+    update_available: boolean;
+    release_url?: string;
+  }>("/api/version");
+  if (v.update_available && v.latest) {
+    showUpdateNotice(v.latest, v.release_url || "");
+  }
 }
 
 function connectWebSocket(): void {
@@ -2632,20 +3870,19 @@ function connectWebSocket(): void {
 
         if (data.type === "speedtest-complete") {
           // New speedtest completed, refresh all data
-          const isCombinedGraph = localStorage.getItem("combined-graph") === "true";
-          const chartPromises = isCombinedGraph
-            ? [updateCombinedChart()]
-            : [
-                updateDownloadChart(),
-                updateUploadChart(),
-                updateLatencyChart(),
-                updateJitterChart(),
-              ];
-          Promise.all([
-            loadSummary(),
-            loadHistoryTable(),
-            ...chartPromises,
-          ]).catch((err) => console.error("refresh after speedtest failed", err));
+          showScheduledProgress(null);
+          refreshDashboard().catch((err) =>
+            console.error("refresh after speedtest failed", err),
+          );
+        } else if (data.type === "data-reset") {
+          // All recorded data was deleted, start over
+          window.location.reload();
+        } else if (data.type === "next-run" && !readOnly) {
+          applyNextRun(data);
+        } else if (data.type === "speedtest-progress") {
+          showScheduledProgress(data);
+        } else if (data.type === "update-available") {
+          showUpdateNotice(data.latest, data.url || "");
         } else if (data.type === "ping") {
           // Keep-alive ping, no action needed
         } else if (data.type === "status") {
@@ -2673,36 +3910,133 @@ function connectWebSocket(): void {
   }
 }
 
+/* ---------- PUSH NOTIFICATIONS ---------- */
+
+// urlBase64ToBytes decodes the server's VAPID key for PushManager.subscribe.
+function urlBase64ToBytes(s: string): Uint8Array {
+  const b64 = (s + "=".repeat((4 - (s.length % 4)) % 4))
+    .replace(/-/g, "+")
+    .replace(/_/g, "/");
+  return Uint8Array.from(atob(b64), (c) => c.charCodeAt(0));
+}
+
+// setupPushNotifications offers alert and outage notifications on this
+// device when the server has Web Push enabled and the browser supports it.
+async function setupPushNotifications(): Promise<void> {
+  if (!("serviceWorker" in navigator) || !("PushManager" in window)) return;
+  let key: string;
+  try {
+    key = (await fetchJSON<{ public_key: string }>("/api/push/key")).public_key;
+  } catch {
+    return; // Not enabled on the server
+  }
+  const reg = await navigator.serviceWorker.ready;
+  const checkbox = $("pref-push") as HTMLInputElement;
+  const testBtn = $("push-test-btn") as HTMLButtonElement;
+  $("push-panel").style.display = "";
+
+  const sendSubscription = async (sub: PushSubscription, method: string) => {
+    const res = await fetch("/api/push/subscribe", {
+      method,
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(sub),
+    });
+    if (!res.ok && res.status !== 404) {
+      throw new Error(`${res.status} ${res.statusText}`);
+    }
+  };
+
+  let sub = await reg.pushManager.getSubscription();
+  if (sub) {
+    // Store it again in case the server lost it, e.g. to a database reset
+    sendSubscription(sub, "POST").catch((err) => console.error(err));
+  }
+  checkbox.checked = sub !== null;
+  testBtn.disabled = sub === null;
+
+  checkbox.addEventListener("change", async () => {
+    try {
+      if (checkbox.checked) {
+        if ((await Notification.requestPermission()) !== "granted") {
+          throw new Error("notifications are blocked for this site");
+        }
+        sub = await reg.pushManager.subscribe({
+          userVisibleOnly: true,
+          applicationServerKey: urlBase64ToBytes(key),
+        });
+        await sendSubscription(sub, "POST");
+      } else if (sub) {
+        await sendSubscription(sub, "DELETE");
+        await sub.unsubscribe();
+        sub = null;
+      }
+    } catch (err) {
+      console.error("Failed to change push subscription:", err);
+      alert(`Failed to change notifications: ${err}`);
+      checkbox.checked = !checkbox.checked;
+    }
+    testBtn.disabled = !checkbox.checked;
+  });
+
+  testBtn.addEventListener("click", async () => {
+    const res = await fetch("/api/push/test", { method: "POST" });
+    if (!res.ok) {
+      alert(`Failed to send test notification: ${await res.text()}`);
+    }
+  });
+}
+
 /* ---------- INIT ---------- */
 
+// registerServiceWorker makes the dashboard installable as an app. Browsers
+// only offer service workers over HTTPS and on localhost.
+function registerServiceWorker(): void {
+  if (!("serviceWorker" in navigator)) return;
+  navigator.serviceWorker
+    .register("sw.js")
+    .catch((err) => console.error("Failed to register service worker:", err));
+}
+
+// initReadOnly sets up the dashboard for a read-only visitor, hiding the
+// controls that need the admin token.
+async function initReadOnly(): Promise<void> {
+  document.querySelectorAll<HTMLElement>("[data-admin]").forEach((el) => {
+    el.style.display = "none";
+  });
+  setupNav();
+  setupRangeSelectors();
+  setupThemeSelection();
+  setupCombinedGraphPreference();
+  connectWebSocket();
+  registerServiceWorker();
+
+  await refreshDashboard();
+}
+
 async function init(): Promise<void> {
+  if (readOnly) return initReadOnly();
   setupNav();
   setupRunNow();
   setupScheduleForm();
+  setupAlertRuleForm();
+  setupCsvImport();
   setupRangeSelectors();
   setupHistoryPagination();
   setupThemeSelection();
   setupCombinedGraphPreference();
   setupSaveManualRunsPreference();
+  setupManualResults();
   startScheduleTimer();
   connectWebSocket();
+  setupConnectionSelect().catch((err) => console.error(err));
+  loadUpdateNotice().catch((err) => console.error(err));
+  registerServiceWorker();
+  setupPushNotifications().catch((err) => console.error(err));
 
-  const isCombinedGraph = localStorage.getItem("combined-graph") === "true";
-  const chartPromises = isCombinedGraph
-    ? [updateCombinedChart()]
-    : [
-        updateDownloadChart(),
-        updateUploadChart(),
-        updateLatencyChart(),
-        updateJitterChart(),
-      ];
+  loadAlertRules().catch((err) => console.error(err));
+  loadAlertHistory().catch((err) => console.error(err));
 
-  await Promise.all([
-    loadSummary(),
-    loadHistoryTable(),
-    loadSchedules(),
-    ...chartPromises,
-  ]);
+  await Promise.all([refreshDashboard(), loadSchedules()]);
 }
 
 document.addEventListener("DOMContentLoaded", () => {
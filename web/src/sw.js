@@ -0,0 +1,79 @@
+// Service worker of the installed dashboard. It keeps the last copy of the
+// page and its script, so the app still opens offline with the data that
+// was embedded in the page; API requests always go to the network. It also
+// shows the alert and outage notifications the server pushes.
+const CACHE = "speedplane-v1";
+
+self.addEventListener("install", () => {
+  self.skipWaiting();
+});
+
+self.addEventListener("activate", (event) => {
+  event.waitUntil(
+    caches
+      .keys()
+      .then((keys) =>
+        Promise.all(keys.filter((k) => k !== CACHE).map((k) => caches.delete(k))),
+      )
+      .then(() => self.clients.claim()),
+  );
+});
+
+self.addEventListener("fetch", (event) => {
+  const req = event.request;
+  const url = new URL(req.url);
+  if (req.method !== "GET" || url.origin !== self.location.origin) return;
+
+  const page = req.mode === "navigate";
+  const script = url.pathname.endsWith("/main.js");
+  if (!page && !script) return;
+
+  // Every view is the same page, so one copy serves them all
+  const key = page ? new URL("./", self.registration.scope).href : req;
+  event.respondWith(
+    fetch(req)
+      .then((res) => {
+        if (res.ok) {
+          const copy = res.clone();
+          caches.open(CACHE).then(async (cache) => {
+            // Drop the script of the previous version
+            await cache.delete(key, { ignoreSearch: true });
+            await cache.put(key, copy);
+          });
+        }
+        return res;
+      })
+      .catch(async () => (await caches.match(key)) ?? Response.error()),
+  );
+});
+
+// Messages are JSON: {title, body, tag, url}, see push.Message
+self.addEventListener("push", (event) => {
+  let msg = { title: "speedplane", body: "" };
+  try {
+    msg = { ...msg, ...event.data.json() };
+  } catch {
+    msg.body = event.data ? event.data.text() : "";
+  }
+  event.waitUntil(
+    self.registration.showNotification(msg.title, {
+      body: msg.body,
+      tag: msg.tag,
+      icon: "icons/icon-192.png",
+      badge: "favicon.svg",
+      data: { url: new URL(msg.url || "./", self.registration.scope).href },
+    }),
+  );
+});
+
+// Clicking a notification focuses an open dashboard, or opens one
+self.addEventListener("notificationclick", (event) => {
+  event.notification.close();
+  const url = event.notification.data?.url ?? self.registration.scope;
+  event.waitUntil(
+    self.clients.matchAll({ type: "window", includeUncontrolled: true }).then((windows) => {
+      const open = windows.find((w) => w.url.startsWith(self.registration.scope));
+      return open ? open.focus() : self.clients.openWindow(url);
+    }),
+  );
+});